@@ -0,0 +1,93 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// attachPrefix starts the query parameters naming the databases to attach.
+const attachPrefix = "_attach."
+
+// Database describes a database of a connection, see Databases.
+type Database struct {
+	Schema string // "main", "temp" or the name used by ATTACH.
+	File   string // Empty for temporary and in-memory databases.
+}
+
+// Attach attaches the database file path to the connection as schema, see
+// https://www.sqlite.org/lang_attach.html. Its tables can then be used
+// qualified by the schema name, like "select * from schema.t", also together
+// with those of the other databases of the connection. path is interpreted
+// like the name passed to Driver.Open, for example "shard1.db?mode=ro", but
+// parameters starting with an underscore are ignored.
+//
+// Attach, Detach and Databases can be reached using (*sql.Conn).Raw. They
+// affect that connection only, use the _attach query parameter of Driver.Open
+// to attach a database to all the connections of a sql.DB.
+func (c *conn) Attach(path, schema string) error {
+	_, err := c.exec(context.Background(), "attach database ? as "+quoteIdentifier(schema), []driver.NamedValue{{Ordinal: 1, Value: attachName(path)}})
+	return err
+}
+
+// Detach detaches the database attached as schema.
+func (c *conn) Detach(schema string) error {
+	_, err := c.exec(context.Background(), "detach database "+quoteIdentifier(schema), nil)
+	return err
+}
+
+// Databases returns the databases of the connection, the main database first.
+func (c *conn) Databases() (r []Database, err error) {
+	rows, err := c.pragma(context.Background(), "database_list")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if len(row) < 3 {
+			return nil, fmt.Errorf("sqlite: Databases: unexpected result %v", row)
+		}
+
+		schema, _ := row[1].(string)
+		file, _ := row[2].(string)
+		r = append(r, Database{Schema: schema, File: file})
+	}
+	return r, nil
+}
+
+// attachName converts a name given to Attach like newConn does.
+func attachName(path string) string {
+	name, _ := openName(path)
+	return name
+}
+
+// attachAll attaches the databases named by the _attach.schema query
+// parameters.
+func (c *conn) attachAll(q map[string][]string) error {
+	var schemas []string
+	for k := range q {
+		if strings.HasPrefix(k, attachPrefix) {
+			schemas = append(schemas, k)
+		}
+	}
+	sort.Strings(schemas)
+	for _, k := range schemas {
+		schema := k[len(attachPrefix):]
+		if schema == "" {
+			return fmt.Errorf("missing schema name in %s", k)
+		}
+
+		for _, v := range q[k] {
+			if err := c.Attach(v, schema); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
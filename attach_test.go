@@ -0,0 +1,141 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttach(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "a.db")
+	db := openMemory(t)
+
+	defer db.Close()
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	var dbs []Database
+	raw := func(f func(*conn) error) {
+		if err := c.Raw(func(dc interface{}) error { return f(dc.(*conn)) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw(func(c *conn) error {
+		if err := c.Attach(fn, `we"ird`); err != nil {
+			return err
+		}
+
+		dbs, err = c.Databases()
+		return err
+	})
+	if g, e := fmt.Sprint(dbs), fmt.Sprintf("[{main } {we\"ird %s}]", fn); g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+
+	if _, err := c.ExecContext(ctx, `create table "we""ird".t(i); insert into "we""ird".t values(1)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Parameters starting with an underscore are not passed to SQLite.
+	raw(func(c *conn) error { return c.Attach(fn+"?mode=ro&_pragma=foo(1)", "ro") })
+	var n int
+	if err := c.QueryRowContext(ctx, "select count(*) from ro.t").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("got %v %v, want 1", n, err)
+	}
+
+	if _, err := c.ExecContext(ctx, "insert into ro.t values(2)"); err == nil || !strings.Contains(err.Error(), "readonly") {
+		t.Fatalf("got %v, want a read only error", err)
+	}
+
+	raw(func(c *conn) error {
+		if err := c.Detach(`we"ird`); err != nil {
+			return err
+		}
+
+		if err := c.Detach("ro"); err != nil {
+			return err
+		}
+
+		if err := c.Detach("nonexistent"); err == nil || !strings.Contains(err.Error(), "no such database: nonexistent") {
+			t.Fatalf("got %v, want no such database", err)
+		}
+
+		dbs, err = c.Databases()
+		return err
+	})
+	if g, e := fmt.Sprint(dbs), "[{main }]"; g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+}
+
+// TestAttachParameter checks the databases named by _attach parameters are
+// attached to every connection of a pool, before the _pragma parameters are
+// applied.
+func TestAttachParameter(t *testing.T) {
+	dir := t.TempDir()
+	main, archive := filepath.Join(dir, "main.db"), filepath.Join(dir, "archive.db")
+	db, err := sql.Open(driverName, main+"?_attach.archive="+archive+"&_attach.b="+archive+"&_pragma=archive.journal_mode(wal)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table archive.t(i); insert into archive.t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		// Both connections are open at the same time.
+		c, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer c.Close()
+
+		var n int
+		var mode string
+		if err := c.QueryRowContext(ctx, "select count(*), (select journal_mode from pragma_journal_mode('archive')) from b.t").Scan(&n, &mode); err != nil || n != 1 || mode != "wal" {
+			t.Fatalf("%d: got %v %q %v, want 1 wal", i, n, mode, err)
+		}
+
+		var dbs []Database
+		if err := c.Raw(func(dc interface{}) (err error) {
+			dbs, err = dc.(*conn).Databases()
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if g, e := fmt.Sprint(dbs), fmt.Sprintf("[{main %s} {archive %s} {b %s}]", main, archive, archive); g != e {
+			t.Fatalf("got %s, want %s", g, e)
+		}
+	}
+
+	db2, err := sql.Open(driverName, main+"?_attach.="+archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db2.Close()
+
+	if err := db2.Ping(); err == nil || !strings.Contains(err.Error(), "missing schema name in _attach.") {
+		t.Fatalf("got %v, want missing schema name", err)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"sync"
+
+	"modernc.org/libc"
+	"modernc.org/sqlite/auditlog"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// AuditLogSuffix is appended to the name of a database file opened using an
+// audit VFS to form the name of its audit log.
+const AuditLogSuffix = "-audit"
+
+// auditLogs are the audit logs currently in use, shared by all connections
+// of the process using the same database.
+var auditLogs = struct {
+	sync.Mutex
+	m map[string]*auditLog
+}{m: map[string]*auditLog{}}
+
+type auditLog struct {
+	*auditlog.Writer
+	refs int
+}
+
+func acquireAuditLog(name string) (*auditLog, error) {
+	auditLogs.Lock()
+
+	defer auditLogs.Unlock()
+
+	if l := auditLogs.m[name]; l != nil {
+		l.refs++
+		return l, nil
+	}
+
+	w, err := auditlog.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &auditLog{Writer: w, refs: 1}
+	auditLogs.m[name] = l
+	return l, nil
+}
+
+func releaseAuditLog(name string, l *auditLog) {
+	auditLogs.Lock()
+
+	defer auditLogs.Unlock()
+
+	if l.refs--; l.refs == 0 {
+		delete(auditLogs.m, name)
+		if err := l.Close(); err != nil {
+			logf(sqlite3.SQLITE_IOERR, "sqlite: closing audit log %s: %v", name, err)
+		}
+	}
+}
+
+// RegisterAuditVFS registers a VFS named name which forwards to the VFS named
+// parent, or to the default VFS if parent is empty, and records every
+// modification of a database file, and of its write-ahead log, in an
+// append-only, hash-chained audit log before performing it. The log of
+// database file F is the file F+AuditLogSuffix, see package
+// modernc.org/sqlite/auditlog for its format and verification. A modification
+// which cannot be logged fails with an I/O error.
+//
+// To use the VFS, pass its name in the vfs query parameter of a URI file
+// name, for example
+//
+//	db, err := sql.Open("sqlite3", "file:app.db?vfs=audit")
+//
+// Journal and temporary files are not logged. The audit log of a database must
+// not be written by multiple processes concurrently. A database whose audit
+// log ends with a record partially written by a crash cannot be opened until
+// the record is removed by auditlog.Repair, or by the auditverify command.
+func RegisterAuditVFS(name, parent string) error {
+	_, err := registerShimVFS(name, parent, openAudited)
+	return err
+}
+
+func openAudited(tls *libc.TLS, f *shimFile) (fileHooks, error) {
+	var db string
+	var kind auditlog.Kind
+	switch {
+	case f.isMainDB():
+		db = f.name
+		kind = auditlog.Write
+	case f.isWAL():
+		db = libc.GoString(sqlite3.Xsqlite3_filename_database(tls, f.zName))
+		kind = auditlog.WALWrite
+	default:
+		return nil, nil
+	}
+
+	l, err := acquireAuditLog(db + AuditLogSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditHooks{log: l, name: db + AuditLogSuffix, kind: kind}, nil
+}
+
+type auditHooks struct {
+	passThrough
+	kind auditlog.Kind
+	log  *auditLog
+	name string
+}
+
+func (h *auditHooks) close(tls *libc.TLS, f *shimFile) int32 {
+	rc := h.passThrough.close(tls, f)
+	releaseAuditLog(h.name, h.log)
+	return rc
+}
+
+func (h *auditHooks) write(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32 {
+	if err := h.log.Append(h.kind, off, memBytes(p, n)); err != nil {
+		logf(sqlite3.SQLITE_IOERR_WRITE, "sqlite: writing audit log %s: %v", h.name, err)
+		return sqlite3.SQLITE_IOERR_WRITE
+	}
+
+	return h.passThrough.write(tls, f, p, n, off)
+}
+
+func (h *auditHooks) truncate(tls *libc.TLS, f *shimFile, size int64) int32 {
+	if h.kind == auditlog.Write {
+		if err := h.log.Append(auditlog.Truncate, size, nil); err != nil {
+			logf(sqlite3.SQLITE_IOERR_TRUNCATE, "sqlite: writing audit log %s: %v", h.name, err)
+			return sqlite3.SQLITE_IOERR_TRUNCATE
+		}
+	}
+
+	return h.passThrough.truncate(tls, f, size)
+}
+
+func (h *auditHooks) sync(tls *libc.TLS, f *shimFile, flags int32) int32 {
+	// The log must reach stable storage no later than the data it describes.
+	if err := h.log.Sync(); err != nil {
+		logf(sqlite3.SQLITE_IOERR_FSYNC, "sqlite: syncing audit log %s: %v", h.name, err)
+		return sqlite3.SQLITE_IOERR_FSYNC
+	}
+
+	return h.passThrough.sync(tls, f, flags)
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"modernc.org/sqlite/auditlog"
+)
+
+func TestAuditVFS(t *testing.T) {
+	if err := RegisterAuditVFS("audit-test", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, "file:"+fn+"?vfs=audit-test&_pragma=journal_mode(wal)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("create table t(i); insert into t values(1); pragma wal_checkpoint(truncate)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(fn + AuditLogSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	kinds := map[auditlog.Kind]int{}
+	if err := auditlog.Scan(f, func(r *auditlog.Record) error {
+		kinds[r.Kind]++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if kinds[auditlog.Write] == 0 || kinds[auditlog.WALWrite] == 0 {
+		t.Fatalf("unexpected records %v", kinds)
+	}
+}
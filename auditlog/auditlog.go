@@ -0,0 +1,332 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package auditlog implements the append-only, hash-chained log written by
+// the audit VFS of modernc.org/sqlite.
+//
+// An audit log starts with a 16 byte magic header followed by a sequence of
+// records. Every record describes one modification of a database file or of
+// its write-ahead log:
+//
+//	offset	size	field
+//	0	8	sequence number, starting at 1
+//	8	8	time of the modification, Unix nanoseconds
+//	16	1	kind of the modification
+//	17	8	file offset of the write or new size of a truncated file
+//	25	4	length of the data, N, at most 1 MiB
+//	29	N	data written
+//	29+N	32	SHA-256 of the previous record hash and bytes 0 to 29+N
+//
+// The previous record hash of the first record is all zeros. All integers are
+// big endian. Modifying, removing or reordering records breaks the hash chain,
+// which Verify detects.
+package auditlog // import "modernc.org/sqlite/auditlog"
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Magic is the header of an audit log file.
+const Magic = "SQLite audit 1\n\x00"
+
+const (
+	headerSize = 29
+
+	// maxDataSize bounds the data of a record. SQLite writes at most a page,
+	// of up to 64 KiB, and a frame header at once.
+	maxDataSize = 1 << 20
+)
+
+// Kind is the kind of a modification.
+type Kind byte
+
+// Values of Kind.
+const (
+	Write    Kind = iota + 1 // Write to the database file.
+	WALWrite                 // Write to the write-ahead log.
+	Truncate                 // Truncation of the database file.
+)
+
+// String implements fmt.Stringer.
+func (k Kind) String() string {
+	switch k {
+	case Write:
+		return "write"
+	case WALWrite:
+		return "wal-write"
+	case Truncate:
+		return "truncate"
+	default:
+		return fmt.Sprintf("Kind(%d)", byte(k))
+	}
+}
+
+// Record is a single entry of an audit log.
+type Record struct {
+	Seq    uint64
+	Time   time.Time
+	Kind   Kind
+	Offset int64 // Offset of the write or the new size of a truncated file.
+	Data   []byte
+	Hash   [sha256.Size]byte
+}
+
+// ErrBroken is wrapped by the errors reporting a broken hash chain or an
+// otherwise inconsistent audit log.
+var ErrBroken = errors.New("audit log is broken")
+
+// Scan reads the audit log from r and calls fn for every record, in order,
+// after verifying it. A record truncated by the end of r is reported as
+// io.ErrUnexpectedEOF. The data of a record passed to fn is only valid until
+// fn returns.
+func Scan(r io.Reader, fn func(*Record) error) error {
+	_, _, err := scan(bufio.NewReader(r), fn)
+	return err
+}
+
+// Verify reads the audit log from r and reports the number of valid records
+// and the hash of the last one. err is non nil if the log is not intact.
+func Verify(r io.Reader) (n int, last [sha256.Size]byte, err error) {
+	err = Scan(r, func(rec *Record) error {
+		n++
+		last = rec.Hash
+		return nil
+	})
+	return n, last, err
+}
+
+// scan returns the number of bytes of r forming complete, valid records,
+// including the header, and the last record read.
+func scan(r io.Reader, fn func(*Record) error) (size int64, last Record, err error) {
+	var magic [len(Magic)]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		if err == io.EOF {
+			return 0, last, nil
+		}
+
+		return 0, last, err
+	}
+
+	if string(magic[:]) != Magic {
+		return 0, last, fmt.Errorf("%w: invalid header", ErrBroken)
+	}
+
+	size = int64(len(magic))
+	var prev [sha256.Size]byte
+	var hdr [headerSize]byte
+	var data []byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return size, last, nil
+			}
+
+			return size, last, io.ErrUnexpectedEOF
+		}
+
+		rec := Record{
+			Seq:    binary.BigEndian.Uint64(hdr[0:]),
+			Time:   time.Unix(0, int64(binary.BigEndian.Uint64(hdr[8:]))),
+			Kind:   Kind(hdr[16]),
+			Offset: int64(binary.BigEndian.Uint64(hdr[17:])),
+		}
+		n := binary.BigEndian.Uint32(hdr[25:])
+		if n > maxDataSize {
+			return size, last, fmt.Errorf("%w: record %d: invalid data length %d", ErrBroken, last.Seq+1, n)
+		}
+
+		if cap(data) < int(n) {
+			data = make([]byte, n)
+		}
+		data = data[:n]
+		if _, err := io.ReadFull(r, data); err != nil {
+			return size, last, io.ErrUnexpectedEOF
+		}
+
+		if _, err := io.ReadFull(r, rec.Hash[:]); err != nil {
+			return size, last, io.ErrUnexpectedEOF
+		}
+
+		if g, e := rec.Seq, last.Seq+1; g != e {
+			return size, last, fmt.Errorf("%w: record %d: sequence number %d", ErrBroken, e, g)
+		}
+
+		if h := hash(prev, hdr[:], data); h != rec.Hash {
+			return size, last, fmt.Errorf("%w: record %d: hash mismatch", ErrBroken, rec.Seq)
+		}
+
+		rec.Data = data
+		if fn != nil {
+			if err := fn(&rec); err != nil {
+				return size, last, err
+			}
+		}
+
+		size += int64(headerSize) + int64(n) + sha256.Size
+		prev = rec.Hash
+		rec.Data = nil
+		last = rec
+	}
+}
+
+func hash(prev [sha256.Size]byte, hdr, data []byte) (r [sha256.Size]byte) {
+	h := sha256.New()
+	h.Write(prev[:])
+	h.Write(hdr)
+	h.Write(data)
+	copy(r[:], h.Sum(nil))
+	return r
+}
+
+// Writer appends records to an audit log file. A Writer is safe for
+// concurrent use by multiple goroutines. Only one Writer per file may exist
+// at a time, the log of a database shared by multiple processes is not
+// supported.
+type Writer struct {
+	mu   sync.Mutex
+	f    *os.File
+	prev [sha256.Size]byte
+	seq  uint64
+	size int64
+	buf  bytes.Buffer
+}
+
+// Create opens the audit log file name for appending, creating it if it does
+// not exist. The existing content is verified first, any damage makes Create
+// fail. A record partially written by a crash at the end of the file is
+// reported as io.ErrUnexpectedEOF, use Repair to remove it.
+func Create(name string) (*Writer, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	size, last, err := scan(bufio.NewReader(f), nil)
+	if err == nil && size == 0 {
+		_, err = f.WriteAt([]byte(Magic), 0)
+		size = int64(len(Magic))
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return &Writer{f: f, prev: last.Hash, seq: last.Seq, size: size}, nil
+}
+
+// Repair removes a record partially written by a crash from the end of the
+// audit log file name and returns the number of bytes removed. The records
+// before it are verified first, Repair fails without modifying the file if
+// the log is damaged otherwise.
+func Repair(name string) (removed int64, err error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	size, _, err := scan(bufio.NewReader(f), nil)
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		if err := f.Truncate(size); err != nil {
+			return 0, err
+		}
+
+		return fi.Size() - size, f.Sync()
+	case err != nil:
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return 0, nil
+}
+
+// Append adds a record describing a modification of kind at offset writing
+// data.
+func (w *Writer) Append(kind Kind, offset int64, data []byte) error {
+	w.mu.Lock()
+
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return os.ErrClosed
+	}
+
+	if len(data) > maxDataSize {
+		return fmt.Errorf("auditlog: %d bytes of data exceed the limit of a record", len(data))
+	}
+
+	var hdr [headerSize]byte
+	binary.BigEndian.PutUint64(hdr[0:], w.seq+1)
+	binary.BigEndian.PutUint64(hdr[8:], uint64(time.Now().UnixNano()))
+	hdr[16] = byte(kind)
+	binary.BigEndian.PutUint64(hdr[17:], uint64(offset))
+	binary.BigEndian.PutUint32(hdr[25:], uint32(len(data)))
+	h := hash(w.prev, hdr[:], data)
+	w.buf.Reset()
+	w.buf.Write(hdr[:])
+	w.buf.Write(data)
+	w.buf.Write(h[:])
+	if _, err := w.f.Write(w.buf.Bytes()); err != nil {
+		// Do not leave a partial record behind.
+		if e := w.f.Truncate(w.size); e == nil {
+			w.f.Seek(w.size, io.SeekStart)
+		}
+		return err
+	}
+
+	w.size += int64(w.buf.Len())
+	w.seq++
+	w.prev = h
+	return nil
+}
+
+// Sync commits the appended records to stable storage.
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return os.ErrClosed
+	}
+
+	return w.f.Sync()
+}
+
+// Close closes the audit log file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
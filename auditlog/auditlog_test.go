@@ -0,0 +1,164 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auditlog // import "modernc.org/sqlite/auditlog"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeLog creates the audit log name with n records.
+func writeLog(t *testing.T, name string, n int) {
+	w, err := Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := w.Append(Write, int64(i)*4096, bytes.Repeat([]byte{byte(i)}, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func verifyFile(t *testing.T, name string) (int, [32]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	return Verify(f)
+}
+
+// recordSize is the size of the records written by writeLog.
+const recordSize = headerSize + 100 + 32
+
+func TestAppendVerify(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log")
+	writeLog(t, name, 3)
+	n, last, err := verifyFile(t, name)
+	if err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+
+	// Create continues the chain.
+	writeLog(t, name, 2)
+	n2, last2, err := verifyFile(t, name)
+	if err != nil || n2 != 5 || last2 == last {
+		t.Fatal(n2, err)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	var seqs []uint64
+	if err := Scan(f, func(r *Record) error {
+		if r.Kind != Write || len(r.Data) != 100 {
+			t.Errorf("unexpected record %+v", r)
+		}
+		seqs = append(seqs, r.Seq)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seqs) != 5 || seqs[0] != 1 || seqs[4] != 5 {
+		t.Fatal(seqs)
+	}
+}
+
+func TestTamper(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log")
+	writeLog(t, name, 3)
+	orig, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := func(i int) []byte {
+		off := len(Magic) + i*recordSize
+		return orig[off : off+recordSize]
+	}
+	for _, v := range []struct {
+		name string
+		b    []byte
+	}{
+		{"modified", func() []byte {
+			b := append([]byte(nil), orig...)
+			b[len(Magic)+recordSize+headerSize+10]++
+			return b
+		}()},
+		{"removed", bytes.Join([][]byte{[]byte(Magic), rec(0), rec(2)}, nil)},
+		{"reordered", bytes.Join([][]byte{[]byte(Magic), rec(1), rec(0), rec(2)}, nil)},
+		{"huge", func() []byte {
+			b := append([]byte(nil), orig[:len(Magic)+recordSize]...)
+			var hdr [headerSize]byte
+			binary.BigEndian.PutUint64(hdr[0:], 2)
+			binary.BigEndian.PutUint32(hdr[25:], 1<<32-1)
+			return append(b, hdr[:]...)
+		}()},
+	} {
+		if err := os.WriteFile(name, v.b, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := verifyFile(t, name); !errors.Is(err, ErrBroken) {
+			t.Errorf("%s: got %v, want %v", v.name, err, ErrBroken)
+		}
+
+		if _, err := Create(name); !errors.Is(err, ErrBroken) {
+			t.Errorf("%s: Create: got %v, want %v", v.name, err, ErrBroken)
+		}
+
+		if _, err := Repair(name); !errors.Is(err, ErrBroken) {
+			t.Errorf("%s: Repair: got %v, want %v", v.name, err, ErrBroken)
+		}
+	}
+}
+
+func TestTruncatedTail(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log")
+	writeLog(t, name, 3)
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Truncate(name, fi.Size()-10); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Create(name); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	n, err := Repair(name)
+	if err != nil || n != recordSize-10 {
+		t.Fatalf("got %d, %v, want %d", n, err, recordSize-10)
+	}
+
+	if n, err := Repair(name); err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+
+	writeLog(t, name, 1)
+	if n, _, err := verifyFile(t, name); err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+// CheckNamedValue implements driver.NamedValueChecker. It converts the
+// arguments of the statements the way database/sql does by default, except
+// that
+//
+//   - the result of a driver.Valuer is converted again, so a Valuer may
+//     return any value database/sql accepts as an argument, like an int or a
+//     nil pointer, instead of only the driver.Value types. A nil pointer to
+//     a Valuer implemented by its element type binds NULL, like a Valuer
+//     returning nil,
+//   - with the _decimal_text query parameter, *big.Int, *big.Rat and
+//     *big.Float values are bound as TEXT, see Driver.Open,
+//   - with the _uint64 query parameter, unsigned integers larger than
+//     math.MaxInt64 are bound as TEXT or as a BLOB, see Driver.Open.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) (err error) {
+	v := nv.Value
+	if x, ok := v.(driver.Valuer); ok {
+		if rv := reflect.ValueOf(x); rv.Kind() == reflect.Ptr && rv.IsNil() && rv.Type().Elem().Implements(valuerType) {
+			nv.Value = nil
+			return nil
+		}
+
+		if v, err = x.Value(); err != nil {
+			return err
+		}
+
+		if _, ok := v.(driver.Valuer); ok {
+			return fmt.Errorf("sqlite: Value of %T returned the driver.Valuer %T", x, v)
+		}
+	}
+
+	switch x := v.(type) {
+	case *big.Int, *big.Rat, *big.Float:
+		if c.decimalText {
+			nv.Value, err = decimalText(x)
+			return err
+		}
+	default:
+		rv := reflect.ValueOf(v)
+		for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		switch rv.Kind() {
+		case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+			if u := rv.Uint(); u > math.MaxInt64 {
+				nv.Value, err = c.bindUint64(u)
+				return err
+			}
+		}
+	}
+
+	nv.Value, err = driver.DefaultParameterConverter.ConvertValue(v)
+	return err
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// setDecimalText handles the _decimal_text query parameter.
+func (c *conn) setDecimalText(v string) error {
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid _decimal_text %q", v)
+	}
+
+	c.decimalText = on
+	return nil
+}
+
+// decimalText returns the exact decimal representation of v, a *big.Int,
+// *big.Rat or *big.Float, or nil if v is a nil pointer.
+func decimalText(v interface{}) (driver.Value, error) {
+	switch x := v.(type) {
+	case *big.Int:
+		if x == nil {
+			return nil, nil
+		}
+
+		return x.String(), nil
+	case *big.Rat:
+		if x == nil {
+			return nil, nil
+		}
+
+		if x.IsInt() {
+			return x.Num().String(), nil
+		}
+
+		// The decimal expansion of a fraction is finite if its reduced
+		// denominator has no prime factors but 2 and 5. It then has as
+		// many digits after the point as the larger of their exponents.
+		d := new(big.Int).Set(x.Denom())
+		digits := 0
+		for _, p := range []int64{2, 5} {
+			n := 0
+			for q, m := new(big.Int), new(big.Int); ; n++ {
+				if q.DivMod(d, big.NewInt(p), m); m.Sign() != 0 {
+					break
+				}
+
+				d.Set(q)
+			}
+			if n > digits {
+				digits = n
+			}
+		}
+		if d.Cmp(big.NewInt(1)) != 0 {
+			return nil, fmt.Errorf("sqlite: %v has no finite decimal representation", x)
+		}
+
+		return x.FloatString(digits), nil
+	case *big.Float:
+		if x == nil {
+			return nil, nil
+		}
+
+		if x.IsInf() {
+			return nil, fmt.Errorf("sqlite: cannot bind %v as decimal text", x)
+		}
+
+		// The shortest decimal that rounds back to x.
+		return x.Text('g', -1), nil
+	default:
+		return nil, fmt.Errorf("sqlite: unsupported decimal type %T", v)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// nilValuer returns nil from a value receiver.
+type nilValuer struct{}
+
+func (nilValuer) Value() (driver.Value, error) { return nil, nil }
+
+// intValuer returns a value which is not a driver.Value.
+type intValuer int
+
+func (v intValuer) Value() (driver.Value, error) { return int(v), nil }
+
+// ptrValuer returns a nil pointer.
+type ptrValuer struct{}
+
+func (ptrValuer) Value() (driver.Value, error) { return (*string)(nil), nil }
+
+func TestNullRoundTrip(t *testing.T) {
+	db, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("create table t(s text, i integer, i32 integer, f real, b boolean, tm datetime)"); err != nil {
+		t.Fatal(err)
+	}
+
+	tm := time.Date(2022, 11, 30, 12, 34, 56, 789000000, time.UTC)
+	for _, valid := range []bool{false, true} {
+		in := []interface{}{
+			sql.NullString{String: "a", Valid: valid},
+			sql.NullInt64{Int64: -1 << 40, Valid: valid},
+			sql.NullInt32{Int32: 7, Valid: valid},
+			sql.NullFloat64{Float64: 1.5, Valid: valid},
+			sql.NullBool{Bool: true, Valid: valid},
+			sql.NullTime{Time: tm, Valid: valid},
+		}
+		if _, err := db.Exec("delete from t; insert into t values(?, ?, ?, ?, ?, ?)", in...); err != nil {
+			t.Fatal(err)
+		}
+
+		var nulls int
+		if err := db.QueryRow("select (s is null) + (i is null) + (i32 is null) + (f is null) + (b is null) + (tm is null) from t").Scan(&nulls); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := map[bool]int{false: 6, true: 0}[valid]; nulls != want {
+			t.Errorf("valid %v: %d NULLs, want %d", valid, nulls, want)
+		}
+
+		out := []interface{}{&sql.NullString{}, &sql.NullInt64{}, &sql.NullInt32{}, &sql.NullFloat64{}, &sql.NullBool{}, &sql.NullTime{}}
+		if err := db.QueryRow("select * from t").Scan(out...); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, v := range out {
+			got := reflect.ValueOf(v).Elem().Interface()
+			if nt, ok := got.(sql.NullTime); ok && nt.Valid && nt.Time.Equal(tm) {
+				continue
+			}
+
+			if !valid {
+				in[i] = reflect.Zero(reflect.TypeOf(in[i])).Interface()
+			}
+			if got != in[i] {
+				t.Errorf("valid %v: got %#v, want %#v", valid, got, in[i])
+			}
+		}
+	}
+
+	for _, v := range []interface{}{nil, (*int)(nil), []byte(nil), nilValuer{}, (*nilValuer)(nil), ptrValuer{}, (*big.Int)(nil)} {
+		var typ string
+		if err := db.QueryRow("select typeof(?)", v).Scan(&typ); err != nil || typ != "null" {
+			t.Errorf("%#v: %q, %v, want null", v, typ, err)
+		}
+	}
+
+	var n int
+	if err := db.QueryRow("select ?", intValuer(42)).Scan(&n); err != nil || n != 42 {
+		t.Errorf("%v, %v, want 42", n, err)
+	}
+}
+
+func TestDecimalText(t *testing.T) {
+	db, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if err := db.QueryRow("select ?", big.NewInt(1)).Scan(new(string)); err == nil {
+		t.Fatal("unexpected success binding *big.Int without _decimal_text")
+	}
+
+	db.Close()
+	if db, err = sql.Open(driverName, "file::memory:?_decimal_text=1"); err != nil {
+		t.Fatal(err)
+	}
+
+	i, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	f, _ := new(big.Float).SetPrec(200).SetString("3.14159265358979323846264338327950288")
+	for _, test := range []struct {
+		v    interface{}
+		want string
+	}{
+		{i, "-123456789012345678901234567890"},
+		{big.NewRat(-101, 8), "-12.625"},
+		{big.NewRat(3, 1), "3"},
+		{new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil)), "0.000000000000000000000000000001"},
+		{f, "3.14159265358979323846264338327950288"},
+	} {
+		var s, typ string
+		if err := db.QueryRow("select ?1, typeof(?1)", test.v).Scan(&s, &typ); err != nil || s != test.want || typ != "text" {
+			t.Errorf("%v: %q %s, %v, want %q text", test.v, s, typ, err, test.want)
+		}
+	}
+
+	for _, v := range []interface{}{big.NewRat(1, 3), new(big.Float).SetInf(false)} {
+		if err := db.QueryRow("select ?", v).Scan(new(string)); err == nil {
+			t.Errorf("%v: unexpected success", v)
+		}
+	}
+}
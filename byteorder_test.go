@@ -0,0 +1,162 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// putVarint appends the SQLite varint encoding of v to b, see
+// https://www.sqlite.org/fileformat2.html#varint.
+func putVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var a [9]byte
+		a[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			a[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, a[:]...)
+	}
+
+	var a [8]byte
+	i := len(a) - 1
+	a[i] = byte(v & 0x7f)
+	for v >>= 7; v != 0; v >>= 7 {
+		i--
+		a[i] = byte(v&0x7f) | 0x80
+	}
+	return append(b, a[i:]...)
+}
+
+// TestByteOrder checks the database file written is big endian, as required
+// by the file format, independently of the byte order of the target, and that
+// values written to the file directly are read back correctly.
+func TestByteOrder(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, name+"?_pragma=page_size(4096)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		rowid   = 0x123456789
+		integer = 0x0102030405060708
+		float   = 1.5
+		text    = "abc"
+	)
+	if _, err := db.Exec(`
+pragma user_version = 0x01020304;
+pragma application_id = 0x0a0b0c0d;
+create table t(x, y, z);
+insert into t(rowid, x, y, z) values(?, ?, ?, ?);
+`, int64(rowid), int64(integer), float, text); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	db.Close()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) != 2*4096 {
+		t.Fatalf("file size %d, want two pages", len(b))
+	}
+
+	be := binary.BigEndian
+	if g, e := string(b[:16]), "SQLite format 3\x00"; g != e {
+		t.Errorf("header string %q, want %q", g, e)
+	}
+
+	for _, v := range []struct {
+		off  int
+		got  uint32
+		want uint32
+	}{
+		{16, uint32(be.Uint16(b[16:])), 4096},
+		{28, be.Uint32(b[28:]), 2}, // Database size in pages.
+		{60, be.Uint32(b[60:]), 0x01020304},
+		{68, be.Uint32(b[68:]), 0x0a0b0c0d},
+	} {
+		if v.got != v.want {
+			t.Errorf("header offset %d: %#x, want %#x", v.off, v.got, v.want)
+		}
+	}
+
+	// Page 2 is the table leaf page holding the single row.
+	page := b[4096:]
+	if page[0] != 13 || be.Uint16(page[3:]) != 1 {
+		t.Fatalf("page 2: type %d with %d cells, want a table leaf with 1 cell", page[0], be.Uint16(page[3:]))
+	}
+
+	values := make([]byte, 16, 16+len(text))
+	be.PutUint64(values, integer)
+	be.PutUint64(values[8:], math.Float64bits(float))
+	values = append(values, text...)
+	hdr := []byte{4, 6, 7, byte(2*len(text) + 13)} // Serial types of the record.
+	record := append(hdr, values...)
+	want := putVarint(nil, uint64(len(record)))
+	want = putVarint(want, rowid)
+	want = append(want, record...)
+	cell := be.Uint16(page[8:])
+	if g := page[cell:]; !bytes.HasPrefix(g, want) {
+		t.Errorf("cell\ngot  % x\nwant % x", g[:len(want)], want)
+	}
+
+	// Rewrite the values directly in the file.
+	off := 4096 + int(cell) + len(want) - len(values)
+	be.PutUint64(b[off:], 0x1122334455667788)
+	be.PutUint64(b[off+8:], math.Float64bits(-0.25))
+	be.PutUint32(b[60:], 0x05060708)
+	if err := os.WriteFile(name, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = sql.Open(driverName, name); err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	var (
+		id, x, version int64
+		y              float64
+	)
+	if err := db.QueryRow("select t.rowid, x, y, user_version from t, pragma_user_version").Scan(&id, &x, &y, &version); err != nil {
+		t.Fatal(err)
+	}
+
+	if id != rowid || x != 0x1122334455667788 || y != -0.25 || version != 0x05060708 {
+		t.Errorf("got %#x, %#x, %v, %#x", id, x, y, version)
+	}
+}
+
+func TestPutVarint(t *testing.T) {
+	for _, v := range []struct {
+		v    uint64
+		want []byte
+	}{
+		{0, []byte{0}},
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0x81, 0x00}},
+		{0x3fff, []byte{0xff, 0x7f}},
+		{1<<56 - 1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+		{1 << 56, []byte{0x80, 0xc0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}},
+		{math.MaxUint64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	} {
+		if g := putVarint(nil, v.v); !bytes.Equal(g, v.want) {
+			t.Errorf("%#x: % x, want % x", v.v, g, v.want)
+		}
+	}
+}
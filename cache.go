@@ -0,0 +1,72 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// CacheFlush writes the dirty pages of the page caches of the connection to
+// the database files while keeping the write transaction open, see
+// https://www.sqlite.org/c3ref/db_cacheflush.html. It lets a long write
+// transaction bound the memory held by its dirty pages at points chosen by
+// the application. Outside of a write transaction, or with spilling disabled
+// by SetCacheSpill, CacheFlush does nothing. A page that cannot be written
+// because another connection holds a lock on the database makes CacheFlush
+// fail with SQLITE_BUSY, after writing the other pages.
+//
+// CacheFlush can be reached using (*sql.Conn).Raw.
+func (c *conn) CacheFlush() error {
+	// int sqlite3_db_cacheflush(sqlite3*);
+	if rc := sqlite3.Xsqlite3_db_cacheflush(c.tls, c.db); rc != sqlite3.SQLITE_OK {
+		return c.errstr(rc)
+	}
+
+	return nil
+}
+
+// CacheStatus is a snapshot of the page cache of a connection.
+type CacheStatus struct {
+	PageSize int64 // Of the main database, in bytes.
+	Size     int64 // Suggested maximum size, see CacheSize.
+	Spill    int64 // Spill threshold, see CacheSpill.
+
+	Hits   int64 // Page cache hits.
+	Misses int64 // Page cache misses.
+	Writes int64 // Pages written from the cache to the database file.
+	Spills int64 // Dirty pages written before the end of the transaction.
+	Used   int64 // Bytes of page cache memory in use.
+}
+
+// CacheStatus returns the configuration and the counters of the page cache of
+// the main database of the connection. If reset is true, the counters of
+// Status are reset to zero afterwards.
+//
+// CacheStatus can be reached using (*sql.Conn).Raw.
+func (c *conn) CacheStatus(reset bool) (r CacheStatus, err error) {
+	if r.PageSize, err = c.pragmaInt64("page_size"); err != nil {
+		return r, err
+	}
+
+	if r.Size, err = c.CacheSize(); err != nil {
+		return r, err
+	}
+
+	if r.Spill, err = c.CacheSpill(); err != nil {
+		return r, err
+	}
+
+	s, err := c.Status(reset)
+	if err != nil {
+		return r, err
+	}
+
+	r.Hits = s.CacheHits
+	r.Misses = s.CacheMisses
+	r.Writes = s.CacheWrites
+	r.Spills = s.CacheSpills
+	r.Used = s.CacheUsed
+	return r, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func TestCacheFlush(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, fn+"?_pragma=busy_timeout(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if _, err := c.ExecContext(ctx, "create table t(b)"); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := func(f func(*conn) error) {
+		if err := c.Raw(func(dc interface{}) error { return f(dc.(*conn)) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var s CacheStatus
+	raw(func(c *conn) (err error) {
+		// Nothing to flush outside of a transaction.
+		if err := c.CacheFlush(); err != nil {
+			return err
+		}
+
+		s, err = c.CacheStatus(true)
+		return err
+	})
+	if s.PageSize != 4096 || s.Size != sqlite3.SQLITE_DEFAULT_CACHE_SIZE || s.Spill <= 0 || s.Used <= 0 {
+		t.Fatalf("got %+v", s)
+	}
+
+	// The spill threshold reported is at least the cache size.
+	raw(func(c *conn) error { return c.SetCacheSize(5) })
+
+	for _, v := range []struct {
+		spill          int64
+		spills, writes bool // Before and after CacheFlush.
+	}{
+		{0, false, false},
+		{1000, false, true},
+		{7, true, true},
+	} {
+		raw(func(c *conn) error { return c.SetCacheSpill(v.spill) })
+		if _, err := c.ExecContext(ctx, "begin; insert into t select randomblob(1000) from (with recursive s(i) as (select 1 union all select i + 1 from s where i < 100) select i from s)"); err != nil {
+			t.Fatal(err)
+		}
+
+		var before, after CacheStatus
+		raw(func(c *conn) (err error) {
+			if before, err = c.CacheStatus(true); err != nil {
+				return err
+			}
+
+			if err := c.CacheFlush(); err != nil {
+				return err
+			}
+
+			after, err = c.CacheStatus(true)
+			return err
+		})
+		if before.Spill != v.spill || (before.Spills > 0) != v.spills || (after.Writes > 0) != v.writes {
+			t.Errorf("spill %d: got %+v, %+v", v.spill, before, after)
+		}
+
+		if _, err := c.ExecContext(ctx, "commit"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var n int
+	if err := c.QueryRowContext(ctx, "select count(*) from t").Scan(&n); err != nil || n != 300 {
+		t.Fatalf("got %v %v, want 300", n, err)
+	}
+
+	raw(func(c *conn) (err error) {
+		s, err = c.CacheStatus(false)
+		return err
+	})
+	if s.Hits == 0 || s.Misses == 0 {
+		t.Fatalf("got %+v", s)
+	}
+}
+
+// TestCacheFlushBusy checks CacheFlush fails with SQLITE_BUSY while another
+// connection reads the database.
+func TestCacheFlushBusy(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, fn+"?_pragma=busy_timeout(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(b); insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another pool plays the part of another process.
+	other, err := sql.Open(driverName, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer other.Close()
+
+	tx, err := other.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRow("select count(*) from t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if _, err := c.ExecContext(ctx, "begin; insert into t values(2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Raw(func(dc interface{}) error { return dc.(*conn).CacheFlush() })
+	var e *Error
+	if !errors.As(err, &e) || e.Code() != sqlite3.SQLITE_BUSY {
+		t.Fatalf("got %v, want SQLITE_BUSY", err)
+	}
+
+	tx.Rollback()
+	if _, err := c.ExecContext(ctx, "commit"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// carrayMagic starts the blobs produced by CArray.
+const carrayMagic = "\x00carray\x01"
+
+// Element kinds of a carray blob.
+const (
+	carrayInt64   = 'i'
+	carrayFloat64 = 'f'
+	carrayText    = 't'
+	carrayBlob    = 'b'
+)
+
+// CArray returns a value binding the Go slice v as the argument of the carray
+// table-valued function, which every connection provides. It allows to use a
+// slice in an IN clause without constructing a placeholder list:
+//
+//	rows, err := db.Query("select * from t where id in carray(?)", sqlite.CArray(ids))
+//
+// carray(?) is a table of one column, value, having a row for every element of
+// the slice. Supported are slices of the Go integer types except uint64, of
+// float32, float64, bool, string and []byte. See also
+// https://www.sqlite.org/carray.html, which this function resembles, but
+// carray here accepts only values produced by CArray.
+func CArray(v interface{}) driver.Valuer {
+	return carray{v}
+}
+
+type carray struct {
+	v interface{}
+}
+
+// Value implements driver.Valuer.
+func (a carray) Value() (driver.Value, error) {
+	b := []byte(carrayMagic)
+	var buf [binary.MaxVarintLen64]byte
+	u64 := func(n uint64) {
+		binary.LittleEndian.PutUint64(buf[:], n)
+		b = append(b, buf[:8]...)
+	}
+	bytes := func(v []byte) {
+		b = append(b, buf[:binary.PutUvarint(buf[:], uint64(len(v)))]...)
+		b = append(b, v...)
+	}
+	switch x := a.v.(type) {
+	case []int:
+		b = append(b, carrayInt64)
+		for _, v := range x {
+			u64(uint64(v))
+		}
+	case []int8:
+		b = append(b, carrayInt64)
+		for _, v := range x {
+			u64(uint64(v))
+		}
+	case []int16:
+		b = append(b, carrayInt64)
+		for _, v := range x {
+			u64(uint64(v))
+		}
+	case []int32:
+		b = append(b, carrayInt64)
+		for _, v := range x {
+			u64(uint64(v))
+		}
+	case []int64:
+		b = append(b, carrayInt64)
+		for _, v := range x {
+			u64(uint64(v))
+		}
+	case []uint:
+		b = append(b, carrayInt64)
+		for _, v := range x {
+			u64(uint64(v))
+		}
+	case []uint16:
+		b = append(b, carrayInt64)
+		for _, v := range x {
+			u64(uint64(v))
+		}
+	case []uint32:
+		b = append(b, carrayInt64)
+		for _, v := range x {
+			u64(uint64(v))
+		}
+	case []bool:
+		b = append(b, carrayInt64)
+		for _, v := range x {
+			var n uint64
+			if v {
+				n = 1
+			}
+			u64(n)
+		}
+	case []float32:
+		b = append(b, carrayFloat64)
+		for _, v := range x {
+			u64(math.Float64bits(float64(v)))
+		}
+	case []float64:
+		b = append(b, carrayFloat64)
+		for _, v := range x {
+			u64(math.Float64bits(v))
+		}
+	case []string:
+		b = append(b, carrayText)
+		for _, v := range x {
+			bytes([]byte(v))
+		}
+	case [][]byte:
+		b = append(b, carrayBlob)
+		for _, v := range x {
+			bytes(v)
+		}
+	default:
+		return nil, fmt.Errorf("sqlite: CArray: unsupported type %T", a.v)
+	}
+	return b, nil
+}
+
+// carrayCursor is the state of a carray cursor.
+type carrayCursor struct {
+	kind byte
+	data []byte // Elements not yet visited.
+	n    int    // Elements visited.
+	eof  bool
+}
+
+var (
+	carrayCursorsMu sync.Mutex
+	carrayCursors   = map[uintptr]*carrayCursor{}
+)
+
+func init() {
+	// Eponymous-only virtual table: no xCreate/xDestroy.
+	registerModule("carray", &goModule{
+		connect:    carrayConnect,
+		bestIndex:  carrayBestIndex,
+		disconnect: carrayDisconnect,
+		open:       carrayOpen,
+		close:      carrayClose,
+		filter:     carrayFilter,
+		next:       carrayNext,
+		eof:        carrayEOF,
+		column:     carrayColumn,
+		rowid:      carrayRowid,
+	})
+}
+
+// Columns of the carray table.
+const (
+	carrayColValue = iota
+	carrayColPointer
+)
+
+func carrayConnect(tls *libc.TLS, db, pAux uintptr, argc int32, argv, ppVtab, pzErr uintptr) int32 {
+	if rc := declareVtab(tls, db, "create table x(value, pointer hidden)"); rc != sqlite3.SQLITE_OK {
+		return rc
+	}
+
+	p := newVtab(tls)
+	if p == 0 {
+		return sqlite3.SQLITE_NOMEM
+	}
+
+	*(*uintptr)(unsafe.Pointer(ppVtab)) = p
+	return sqlite3.SQLITE_OK
+}
+
+func carrayDisconnect(tls *libc.TLS, pVtab uintptr) int32 {
+	sqlite3.Xsqlite3_free(tls, pVtab)
+	return sqlite3.SQLITE_OK
+}
+
+func carrayBestIndex(tls *libc.TLS, pVtab, pInfo uintptr) int32 {
+	info := (*sqlite3.Sqlite3_index_info)(unsafe.Pointer(pInfo))
+	unusable := false
+	for i := int32(0); i < info.FnConstraint; i++ {
+		c := constraint(info, i)
+		if c.iColumn != carrayColPointer || c.op != sqlite3.SQLITE_INDEX_CONSTRAINT_EQ {
+			continue
+		}
+
+		if c.usable == 0 {
+			unusable = true
+			continue
+		}
+
+		u := constraintUsage(info, i)
+		u.argvIndex = 1
+		u.omit = 1
+		info.FidxNum = 1
+		info.FestimatedCost = 1
+		info.FestimatedRows = 100
+		return sqlite3.SQLITE_OK
+	}
+
+	if unusable {
+		// Make SQLite try another plan, the argument is required.
+		return sqlite3.SQLITE_CONSTRAINT
+	}
+
+	info.FidxNum = 0
+	info.FestimatedCost = 2147483647
+	info.FestimatedRows = 2147483647
+	return sqlite3.SQLITE_OK
+}
+
+func carrayOpen(tls *libc.TLS, pVtab, ppCursor uintptr) int32 {
+	p := newVtabCursor(tls)
+	if p == 0 {
+		return sqlite3.SQLITE_NOMEM
+	}
+
+	carrayCursorsMu.Lock()
+	carrayCursors[p] = &carrayCursor{eof: true}
+	carrayCursorsMu.Unlock()
+	*(*uintptr)(unsafe.Pointer(ppCursor)) = p
+	return sqlite3.SQLITE_OK
+}
+
+func carrayClose(tls *libc.TLS, pCursor uintptr) int32 {
+	carrayCursorsMu.Lock()
+	delete(carrayCursors, pCursor)
+	carrayCursorsMu.Unlock()
+	sqlite3.Xsqlite3_free(tls, pCursor)
+	return sqlite3.SQLITE_OK
+}
+
+func carrayCursorOf(pCursor uintptr) *carrayCursor {
+	carrayCursorsMu.Lock()
+
+	defer carrayCursorsMu.Unlock()
+
+	return carrayCursors[pCursor]
+}
+
+func carrayFilter(tls *libc.TLS, pCursor uintptr, idxNum int32, idxStr uintptr, argc int32, argv uintptr) int32 {
+	cur := carrayCursorOf(pCursor)
+	*cur = carrayCursor{eof: true}
+	if idxNum != 1 || argc < 1 {
+		return sqlite3.SQLITE_OK
+	}
+
+	val := *(*uintptr)(unsafe.Pointer(argv))
+	if sqlite3.Xsqlite3_value_type(tls, val) == sqlite3.SQLITE_NULL {
+		return sqlite3.SQLITE_OK
+	}
+
+	n := sqlite3.Xsqlite3_value_bytes(tls, val)
+	p := sqlite3.Xsqlite3_value_blob(tls, val)
+	var b []byte
+	if p != 0 && n != 0 {
+		b = make([]byte, n)
+		copy(b, (*libc.RawMem)(unsafe.Pointer(p))[:n:n])
+	}
+	if len(b) <= len(carrayMagic) || string(b[:len(carrayMagic)]) != carrayMagic {
+		return carrayError(tls, pCursor, "carray: argument not produced by sqlite.CArray")
+	}
+
+	cur.kind = b[len(carrayMagic)]
+	cur.data = b[len(carrayMagic)+1:]
+	cur.eof = len(cur.data) == 0
+	return sqlite3.SQLITE_OK
+}
+
+// carrayError sets the error message of the virtual table of pCursor.
+func carrayError(tls *libc.TLS, pCursor uintptr, msg string) int32 {
+	return vtabError(tls, cursorVtab(pCursor), msg)
+}
+
+// current returns the encoded current element and its size.
+func (c *carrayCursor) current() (v []byte, size int) {
+	switch c.kind {
+	case carrayInt64, carrayFloat64:
+		if len(c.data) < 8 {
+			return nil, -1
+		}
+
+		return c.data[:8], 8
+	case carrayText, carrayBlob:
+		n, k := binary.Uvarint(c.data)
+		if k <= 0 || uint64(len(c.data)-k) < n {
+			return nil, -1
+		}
+
+		return c.data[k : k+int(n)], k + int(n)
+	default:
+		return nil, -1
+	}
+}
+
+func carrayNext(tls *libc.TLS, pCursor uintptr) int32 {
+	cur := carrayCursorOf(pCursor)
+	_, size := cur.current()
+	if size < 0 {
+		return carrayError(tls, pCursor, "carray: malformed argument")
+	}
+
+	cur.data = cur.data[size:]
+	cur.n++
+	cur.eof = len(cur.data) == 0
+	return sqlite3.SQLITE_OK
+}
+
+func carrayEOF(tls *libc.TLS, pCursor uintptr) int32 {
+	if carrayCursorOf(pCursor).eof {
+		return 1
+	}
+
+	return 0
+}
+
+func carrayColumn(tls *libc.TLS, pCursor, ctx uintptr, i int32) int32 {
+	cur := carrayCursorOf(pCursor)
+	if i != carrayColValue {
+		sqlite3.Xsqlite3_result_null(tls, ctx)
+		return sqlite3.SQLITE_OK
+	}
+
+	v, size := cur.current()
+	if size < 0 {
+		return carrayError(tls, pCursor, "carray: malformed argument")
+	}
+
+	switch cur.kind {
+	case carrayInt64:
+		sqlite3.Xsqlite3_result_int64(tls, ctx, int64(binary.LittleEndian.Uint64(v)))
+	case carrayFloat64:
+		sqlite3.Xsqlite3_result_double(tls, ctx, math.Float64frombits(binary.LittleEndian.Uint64(v)))
+	case carrayText, carrayBlob:
+		p := sqlite3.Xsqlite3_malloc64(tls, uint64(len(v))+1)
+		if p == 0 {
+			sqlite3.Xsqlite3_result_error_nomem(tls, ctx)
+			return sqlite3.SQLITE_NOMEM
+		}
+
+		copy((*libc.RawMem)(unsafe.Pointer(p))[:len(v):len(v)], v)
+		// The text/blob takes ownership of p, freed by sqlite3_free.
+		xDel := *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr)
+		}{sqlite3.Xsqlite3_free}))
+		if cur.kind == carrayText {
+			sqlite3.Xsqlite3_result_text64(tls, ctx, p, uint64(len(v)), xDel, sqlite3.SQLITE_UTF8)
+		} else {
+			sqlite3.Xsqlite3_result_blob64(tls, ctx, p, uint64(len(v)), xDel)
+		}
+	}
+	return sqlite3.SQLITE_OK
+}
+
+func carrayRowid(tls *libc.TLS, pCursor, pRowid uintptr) int32 {
+	*(*int64)(unsafe.Pointer(pRowid)) = int64(carrayCursorOf(pCursor).n + 1)
+	return sqlite3.SQLITE_OK
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestCArray checks the values, types and rowids carray returns for every
+// supported slice type.
+func TestCArray(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	for i, v := range []struct {
+		slice interface{}
+		want  string
+	}{
+		{[]int{1, -2}, "1 integer, -2 integer"},
+		{[]int8{-128}, "-128 integer"},
+		{[]int16{3}, "3 integer"},
+		{[]int32{4}, "4 integer"},
+		{[]int64{1 << 62}, "4611686018427387904 integer"},
+		{[]uint{5}, "5 integer"},
+		{[]uint16{6}, "6 integer"},
+		{[]uint32{1<<32 - 1}, "4294967295 integer"},
+		{[]bool{true, false}, "1 integer, 0 integer"},
+		{[]float32{0.5}, "0.5 real"},
+		{[]float64{1.25, -3}, "1.25 real, -3 real"},
+		{[]string{"a", "", "héllo"}, "a text,  text, héllo text"},
+		{[][]byte{{1, 2}, {}}, "0102 blob,  blob"},
+		{[]int{}, ""},
+	} {
+		rows, err := db.Query("select rowid, case typeof(value) when 'blob' then hex(value) else value end, typeof(value) from carray(?)", CArray(v.slice))
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		var got []string
+		for n := 1; rows.Next(); n++ {
+			var rowid int
+			var value, typ string
+			if err := rows.Scan(&rowid, &value, &typ); err != nil {
+				t.Fatal(err)
+			}
+
+			if rowid != n {
+				t.Errorf("%d: rowid %d, want %d", i, rowid, n)
+			}
+			got = append(got, value+" "+typ)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		rows.Close()
+		if g, e := strings.Join(got, ", "), v.want; g != e {
+			t.Errorf("%d: %T: got %q, want %q", i, v.slice, g, e)
+		}
+	}
+}
+
+func TestCArrayIn(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(id integer primary key, name); insert into t values(1, 'a'), (2, 'b'), (3, 'c')"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("select name from t where id in carray(?) and name not in carray(?) order by id", CArray([]int64{1, 3, 4}), CArray([]string{"c"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprint(got), "[a]"; g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+}
+
+// TestCArrayErrors checks unsupported types and blobs not produced by CArray
+// are rejected, while NULL is an empty array.
+func TestCArrayErrors(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec("select * from carray(?)", CArray([]uint64{1})); err == nil || !strings.Contains(err.Error(), "unsupported type []uint64") {
+		t.Errorf("got %v, want unsupported type", err)
+	}
+
+	for _, v := range []interface{}{
+		[]byte("not a carray"),
+		[]byte(carrayMagic + "i\x01\x02"),
+		[]byte(carrayMagic + "t\x05ab"),
+		[]byte(carrayMagic + "?x"),
+	} {
+		var n int
+		if err := db.QueryRow("select count(*) from carray(?)", v).Scan(&n); err == nil || !strings.Contains(err.Error(), "carray: ") {
+			t.Errorf("%q: got %v, %v, want an error", v, n, err)
+		}
+	}
+
+	var n int
+	if err := db.QueryRow("select count(*) from carray(null)").Scan(&n); err != nil || n != 0 {
+		t.Errorf("NULL argument: got %v, %v, want 0 rows", n, err)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// CheckpointMode selects how much of the WAL a checkpoint copies back into
+// the database and what it waits for, see
+// https://www.sqlite.org/c3ref/wal_checkpoint_v2.html.
+type CheckpointMode int32
+
+// Values of CheckpointMode.
+const (
+	// CheckpointPassive copies the frames no reader needs anymore, without
+	// waiting.
+	CheckpointPassive CheckpointMode = sqlite3.SQLITE_CHECKPOINT_PASSIVE
+	// CheckpointFull waits for the writer and for the readers of old
+	// frames, then copies all frames.
+	CheckpointFull CheckpointMode = sqlite3.SQLITE_CHECKPOINT_FULL
+	// CheckpointRestart is CheckpointFull which then waits for all readers
+	// of the WAL, so the next writer reuses the WAL from its start.
+	CheckpointRestart CheckpointMode = sqlite3.SQLITE_CHECKPOINT_RESTART
+	// CheckpointTruncate is CheckpointRestart which then truncates the WAL
+	// file to zero bytes.
+	CheckpointTruncate CheckpointMode = sqlite3.SQLITE_CHECKPOINT_TRUNCATE
+)
+
+// CheckpointResult reports the state of the WAL after a checkpoint.
+type CheckpointResult struct {
+	Frames       int // Frames in the WAL, -1 if the database is not in WAL mode.
+	Checkpointed int // Frames copied into the database, -1 if not in WAL mode.
+}
+
+// Checkpoint runs a checkpoint of the databases of the connection in WAL
+// mode. Except for CheckpointPassive, it retries, polling at increasing
+// intervals, while the writer or the readers it waits for are busy, until it
+// succeeds or ctx is done. It then fails with the error of ctx, like
+// context.DeadlineExceeded, and the result reports the frames checkpointed
+// so far. Each attempt also waits as long as the busy handler of the
+// connection does, see _lock_wait. A forced reset of a WAL grown by
+// long-lived readers, with a deadline, is for example
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+//	defer cancel()
+//	_, err := c.Checkpoint(ctx, sqlite.CheckpointTruncate)
+//
+// Checkpoint can be reached using (*sql.Conn).Raw.
+func (c *conn) Checkpoint(ctx context.Context, mode CheckpointMode) (r CheckpointResult, err error) {
+	p, err := c.malloc(8)
+	if err != nil {
+		return r, err
+	}
+
+	defer c.free(p)
+
+	if ctx.Done() != nil {
+		defer func() { err = ctxError(ctx, err) }()
+		defer interruptOnDone(ctx, c, nil)()
+	} else {
+		c.resetLockWait()
+	}
+
+	for i := 0; ; i++ {
+		// int sqlite3_wal_checkpoint_v2(
+		//   sqlite3 *db,                    /* Database handle */
+		//   const char *zDb,                /* Name of attached database (or NULL) */
+		//   int eMode,                      /* SQLITE_CHECKPOINT_* value */
+		//   int *pnLog,                     /* OUT: Size of WAL log in frames */
+		//   int *pnCkpt                     /* OUT: Total number of frames checkpointed */
+		// );
+		rc := sqlite3.Xsqlite3_wal_checkpoint_v2(c.tls, c.db, 0, int32(mode), p, p+4)
+		r = CheckpointResult{int(*(*int32)(unsafe.Pointer(p))), int(*(*int32)(unsafe.Pointer(p + 4)))}
+		if rc == sqlite3.SQLITE_OK {
+			return r, nil
+		}
+
+		if rc&0xff != sqlite3.SQLITE_BUSY || mode == CheckpointPassive {
+			return r, c.errstr(rc)
+		}
+
+		t := time.NewTimer(checkpointPoll(i))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return r, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// checkpointPoll returns the interval before the retry i of a checkpoint.
+func checkpointPoll(i int) time.Duration {
+	if i < len(lockWaitPolls) {
+		return lockWaitPolls[i]
+	}
+
+	return lockWaitPolls[len(lockWaitPolls)-1]
+}
+
+// maxCheckpointDelay bounds the delay of the waiting automatic checkpoints of
+// a connection after waits that timed out, see _checkpoint_wait.
+const maxCheckpointDelay = time.Minute
+
+// walHook is the WAL hook state of a connection, see registerWALHook.
+type walHook struct {
+	threshold int32         // Of automatic checkpoints, 0 if disabled.
+	wait      time.Duration // See _checkpoint_wait.
+	delay     time.Duration // Of the next waiting checkpoint, after timeouts.
+	next      time.Time     // Of the next waiting checkpoint.
+
+	checkpointer *checkpointer // See _checkpointer, nil if disabled.
+}
+
+var (
+	walHooksMu sync.Mutex
+	walHooks   = map[uintptr]*walHook{}
+	walHookID  uintptr
+)
+
+// setCheckpointWait handles the _checkpoint_wait query parameter.
+func (c *conn) setCheckpointWait(v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid _checkpoint_wait %q", v)
+	}
+
+	c.checkpointWait = d
+	return nil
+}
+
+// registerWALHook replaces the default WAL hook of the connection, which runs
+// the automatic checkpoints, by xWALHook.
+func (c *conn) registerWALHook() {
+	// void *sqlite3_wal_hook(
+	//   sqlite3*,
+	//   int(*)(void *,sqlite3*,const char*,int),
+	//   void*
+	// );
+	//
+	// The argument of the default hook, installed by
+	// sqlite3_wal_autocheckpoint, is the checkpoint threshold, or 0 if it
+	// is disabled.
+	threshold := sqlite3.Xsqlite3_wal_hook(c.tls, c.db, 0, 0)
+	h := &walHook{threshold: int32(threshold), wait: c.checkpointWait, checkpointer: c.checkpointer}
+	walHooksMu.Lock()
+	walHookID++
+	id := walHookID
+	walHooks[id] = h
+	walHooksMu.Unlock()
+	sqlite3.Xsqlite3_wal_hook(
+		c.tls,
+		c.db,
+		*(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, uintptr, uintptr, int32) int32
+		}{xWALHook})),
+		id,
+	)
+	c.walHookID = id
+}
+
+func (c *conn) unregisterWALHook() {
+	if c.walHookID == 0 {
+		return
+	}
+
+	walHooksMu.Lock()
+	delete(walHooks, c.walHookID)
+	walHooksMu.Unlock()
+	c.walHookID = 0
+}
+
+// xWALHook is invoked by SQLite after a commit in WAL mode. It records the
+// position of the commit, see Pool.LastCommit, and, like the default hook,
+// runs a checkpoint when the WAL holds at least threshold frames. With
+// _checkpointer, a process not elected leaves the checkpoints of the main
+// database to the elected one until the WAL holds checkpointerFallback times
+// as many frames.
+func xWALHook(tls *libc.TLS, id, db, zDb uintptr, nFrame int32) int32 {
+	recordCommit(tls, db, zDb, nFrame)
+	walHooksMu.Lock()
+	h := walHooks[id]
+	walHooksMu.Unlock()
+	if h == nil || h.threshold <= 0 || nFrame < h.threshold {
+		return sqlite3.SQLITE_OK
+	}
+
+	if h.checkpointer != nil && nFrame < checkpointerFallback*h.threshold && libc.GoString(zDb) == "main" && !h.checkpointer.elected() {
+		return sqlite3.SQLITE_OK
+	}
+
+	if h.wait > 0 && !time.Now().Before(h.next) {
+		h.restart(tls, db, zDb)
+	} else {
+		sqlite3.Xsqlite3_wal_checkpoint(tls, db, zDb)
+	}
+	atomic.AddInt64(&autoCheckpoints, 1)
+	return sqlite3.SQLITE_OK
+}
+
+// restart runs a CheckpointRestart of the database zDb of db, retrying for up
+// to h.wait. If the readers do not finish in time, the frames they do not
+// need are still checkpointed and the waiting checkpoints are delayed.
+func (h *walHook) restart(tls *libc.TLS, db, zDb uintptr) {
+	deadline := time.Now().Add(h.wait)
+	for i := 0; ; i++ {
+		rc := sqlite3.Xsqlite3_wal_checkpoint_v2(tls, db, zDb, sqlite3.SQLITE_CHECKPOINT_RESTART, 0, 0)
+		if rc == sqlite3.SQLITE_OK {
+			h.delay = 0
+			return
+		}
+
+		left := time.Until(deadline)
+		if rc&0xff != sqlite3.SQLITE_BUSY || left <= 0 {
+			break
+		}
+
+		poll := checkpointPoll(i)
+		if poll > left {
+			poll = left
+		}
+		time.Sleep(poll)
+	}
+
+	switch {
+	case h.delay == 0:
+		h.delay = h.wait
+	case h.delay < maxCheckpointDelay:
+		h.delay *= 2
+	}
+	if h.delay > maxCheckpointDelay {
+		h.delay = maxCheckpointDelay
+	}
+	h.next = time.Now().Add(h.delay)
+}
@@ -0,0 +1,164 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openReader returns a connection of db in a read transaction.
+func openReader(t *testing.T, db *sql.DB) *sql.Tx {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := tx.QueryRow("select count(*) from t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+func TestCheckpoint(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, name+"?_pragma=journal_mode(wal)&_pragma=wal_autocheckpoint(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i); insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := openReader(t, db)
+
+	defer reader.Rollback()
+
+	if _, err := db.Exec("insert into t values(2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint := func(ctx context.Context, mode CheckpointMode) (r CheckpointResult, err error) {
+		sc, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer sc.Close()
+
+		err = sc.Raw(func(c interface{}) (err error) {
+			r, err = c.(*conn).Checkpoint(ctx, mode)
+			return err
+		})
+		return r, err
+	}
+
+	r, err := checkpoint(context.Background(), CheckpointPassive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Frames == 0 || r.Checkpointed >= r.Frames {
+		t.Errorf("passive checkpoint with a reader: %+v", r)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+
+	defer cancel()
+
+	t0 := time.Now()
+	if _, err := checkpoint(ctx, CheckpointTruncate); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("truncate checkpoint with a reader: %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if d := time.Since(t0); d < 100*time.Millisecond || d > 5*time.Second {
+		t.Errorf("truncate checkpoint waited %v", d)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		reader.Rollback()
+	}()
+	if r, err = checkpoint(context.Background(), CheckpointTruncate); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(name + "-wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Frames != 0 || fi.Size() != 0 {
+		t.Errorf("after truncate: %+v, WAL of %d bytes", r, fi.Size())
+	}
+}
+
+func TestCheckpointWait(t *testing.T) {
+	p, err := OpenPool(filepath.Join(t.TempDir(), "test.db")+"?_pragma=wal_autocheckpoint(1)&_checkpoint_wait=50ms", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer p.Close()
+
+	if _, err := p.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	insert := func() (WALPosition, time.Duration) {
+		t0 := time.Now()
+		if _, err := p.Exec("insert into t values(1)"); err != nil {
+			t.Fatal(err)
+		}
+
+		return p.LastCommit(), time.Since(t0)
+	}
+
+	// The waiting checkpoint of a commit times out and the next one is
+	// delayed while a reader stays.
+	reader := openReader(t, p.Reader())
+	pos, d := insert()
+	if d < 50*time.Millisecond {
+		t.Errorf("commit with a waiting checkpoint took %v", d)
+	}
+
+	if _, d = insert(); d >= 50*time.Millisecond {
+		t.Errorf("commit with a delayed checkpoint took %v", d)
+	}
+
+	// Once the reader is gone the WAL can be restarted, incrementing its
+	// salt.
+	reader.Rollback()
+	time.Sleep(100 * time.Millisecond)
+	insert()
+	if pos2, _ := insert(); pos2.Salt != pos.Salt+1 {
+		t.Errorf("position %v after %v, want a restarted WAL", pos2, pos)
+	}
+
+	// A reader ending while the commit waits lets the WAL restart.
+	reader = openReader(t, p.Reader())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		reader.Rollback()
+	}()
+	pos, d = insert()
+	if d < 20*time.Millisecond {
+		t.Errorf("commit with a waiting checkpoint took %v", d)
+	}
+
+	if pos2, _ := insert(); pos2.Salt != pos.Salt+1 {
+		t.Errorf("position %v after %v, want a restarted WAL", pos2, pos)
+	}
+}
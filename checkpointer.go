@@ -0,0 +1,145 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	// checkpointerFallback is the multiple of the automatic checkpoint
+	// threshold at which a process not elected as the checkpointer runs the
+	// checkpoint anyway, see _checkpointer.
+	checkpointerFallback = 4
+
+	// checkpointerRetry is the minimum interval between the attempts of a
+	// process to become the checkpointer.
+	checkpointerRetry = time.Second
+)
+
+// checkpointer elects one of the processes sharing a database file to run its
+// automatic checkpoints, see _checkpointer. The elected process holds an
+// exclusive lock on the file named like the database with "-checkpointer"
+// appended, as long as it has connections to the database using
+// _checkpointer.
+type checkpointer struct {
+	sync.Mutex
+	filename string
+	path     string    // Of the lock file.
+	f        *os.File  // The locked lock file, nil if not elected.
+	retry    time.Time // Of the next attempt to become elected.
+	refs     int
+}
+
+var (
+	checkpointersMu sync.Mutex
+	checkpointers   = map[string]*checkpointer{}
+)
+
+func acquireCheckpointer(filename string) *checkpointer {
+	checkpointersMu.Lock()
+
+	defer checkpointersMu.Unlock()
+
+	p := checkpointers[filename]
+	if p == nil {
+		p = &checkpointer{filename: filename, path: filename + "-checkpointer"}
+		checkpointers[filename] = p
+	}
+	p.refs++
+	return p
+}
+
+// release gives up the election of p when the last connection using it
+// closes.
+func (p *checkpointer) release() {
+	checkpointersMu.Lock()
+
+	defer checkpointersMu.Unlock()
+
+	if p.refs--; p.refs != 0 {
+		return
+	}
+
+	delete(checkpointers, p.filename)
+	p.Lock()
+	if p.f != nil {
+		p.f.Close()
+		p.f = nil
+	}
+	p.Unlock()
+}
+
+// elected reports whether the process is the checkpointer of the database,
+// trying to become it if no other process is. If the lock file cannot be
+// used, the checkpoints are not coordinated and elected returns true.
+func (p *checkpointer) elected() bool {
+	p.Lock()
+
+	defer p.Unlock()
+
+	if p.f != nil {
+		return true
+	}
+
+	now := time.Now()
+	if now.Before(p.retry) {
+		return false
+	}
+
+	p.retry = now.Add(checkpointerRetry)
+	f, err := os.OpenFile(p.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return true
+	}
+
+	ok, err := tryLockFile(f)
+	if err != nil || !ok {
+		f.Close()
+		return err != nil
+	}
+
+	logf(sqlite3.SQLITE_NOTICE, "sqlite: the process is the checkpointer of %s", p.filename)
+	p.f = f
+	return true
+}
+
+// setCheckpointer handles the _checkpointer query parameter.
+func (c *conn) setCheckpointer(v string) error {
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid _checkpointer %q", v)
+	}
+
+	if c.checkpointer != nil {
+		c.checkpointer.release()
+		c.checkpointer = nil
+	}
+	if !on || c.readOnly {
+		return nil
+	}
+
+	filename := libc.GoString(sqlite3.Xsqlite3_db_filename(c.tls, c.db, 0))
+	if filename == "" { // Temporary or private in-memory database.
+		return nil
+	}
+
+	c.checkpointer = acquireCheckpointer(filename)
+	return nil
+}
+
+func (c *conn) releaseCheckpointer() {
+	if c.checkpointer != nil {
+		c.checkpointer.release()
+		c.checkpointer = nil
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointer(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	dsn := fn + "?_pragma=journal_mode(wal)&_pragma=wal_autocheckpoint(10)&_checkpointer=1"
+	insert := func(db *sql.DB, n int) int64 {
+		before := ReadDriverStats().AutoCheckpoints
+		for i := 0; i < n; i++ {
+			if _, err := db.Exec("insert into t values(?)", i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return ReadDriverStats().AutoCheckpoints - before
+	}
+
+	// Another open file holding the lock plays the part of the checkpointer
+	// process.
+	other, err := os.OpenFile(fn+"-checkpointer", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer other.Close()
+
+	if ok, err := tryLockFile(other); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := insert(db, 15); n != 0 {
+		t.Fatalf("%d checkpoints run by a process not elected", n)
+	}
+
+	if n := insert(db, 40); n == 0 {
+		t.Fatal("the WAL grows without bound")
+	}
+
+	db.Close()
+	other.Close()
+	if db, err = sql.Open(driverName, dsn); err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if n := insert(db, 15); n == 0 {
+		t.Fatal("no checkpoint run by the elected process")
+	}
+
+	f, err := os.Open(fn + "-checkpointer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if ok, err := tryLockFile(f); ok || err != nil {
+		t.Fatal(ok, err)
+	}
+}
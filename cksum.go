@@ -0,0 +1,269 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ChecksumReserve is the number of bytes reserved at the end of every page
+// of a database to hold its checksum, see RegisterChecksumVFS.
+const ChecksumReserve = 8
+
+// RegisterChecksumVFS registers a VFS named name which forwards to the VFS
+// named parent, or to the default VFS if parent is empty, and protects the
+// pages of databases by checksums, like the cksumvfs extension of SQLite, see
+// https://www.sqlite.org/cksumvfs.html. The checksum of a page is computed
+// when the page is written to the database file or to its write-ahead log and
+// stored in the last ChecksumReserve bytes of the page. When a page is read,
+// its checksum is verified and a mismatch fails the read with
+// SQLITE_IOERR_DATA, so silent corruption of the storage is detected instead
+// of being served as data. The files of the two extensions are compatible.
+//
+// To use the VFS, pass its name in the vfs query parameter of a URI file
+// name, for example
+//
+//	db, err := sql.Open("sqlite3", "file:app.db?vfs=cksm")
+//
+// Checksums are only kept for databases whose pages reserve ChecksumReserve
+// bytes, other databases are accessed unchanged. Use EnableChecksums to
+// convert a database. Verification can be turned off and on by
+// "PRAGMA checksum_verification=OFF" and "=ON", the pragma without a value
+// reports the current setting. Checksums are still computed while
+// verification is off. IntegrityCheck reads every page in use and thus
+// verifies all their checksums. Memory mapped I/O is disabled for all the
+// databases of the VFS, as memory mapped pages cannot be verified.
+func RegisterChecksumVFS(name, parent string) error {
+	_, err := registerShimVFS(name, parent, openChecksummed)
+	return err
+}
+
+func openChecksummed(tls *libc.TLS, f *shimFile) (fileHooks, error) {
+	switch {
+	case f.isMainDB():
+		return &cksmHooks{}, nil
+	case f.isWAL():
+		// The main database file of the WAL is open and has its hooks
+		// already, see sqlite3_database_file_object.
+		if db := shimFileOf(sqlite3.Xsqlite3_database_file_object(tls, f.zName)); db != nil {
+			if h, ok := db.hooks.(*cksmHooks); ok {
+				return &cksmHooks{db: h}, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// cksmHooks implement the checksum VFS for a database file and for its WAL.
+type cksmHooks struct {
+	passThrough
+	db *cksmHooks // Hooks of the database file of a WAL, nil for the database file.
+
+	mu      sync.Mutex
+	compute bool // The pages have reserved bytes for the checksum.
+	verify  bool // Checksums are verified when reading.
+	inCkpt  bool // A checkpoint copies pages from the WAL to the database file.
+}
+
+// flags returns the state shared by the database file and its WAL.
+func (h *cksmHooks) flags() (compute, verify bool) {
+	if h.db != nil {
+		return h.db.flags()
+	}
+
+	h.mu.Lock()
+
+	defer h.mu.Unlock()
+
+	return h.compute && !h.inCkpt, h.verify && !h.inCkpt
+}
+
+// setHeader updates the state from page 1 of the database file.
+func (h *cksmHooks) setHeader(b []byte) {
+	if h.db != nil || len(b) < 100 || string(b[:16]) != "SQLite format 3\x00" {
+		return
+	}
+
+	h.mu.Lock()
+	h.compute = b[20] == ChecksumReserve
+	h.verify = h.compute
+	h.mu.Unlock()
+}
+
+// isPage reports whether an I/O of n bytes transfers a whole page.
+func isPage(n int32) bool { return n >= 512 && n&(n-1) == 0 }
+
+func (h *cksmHooks) read(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32 {
+	rc := h.passThrough.read(tls, f, p, n, off)
+	if rc != sqlite3.SQLITE_OK {
+		return rc
+	}
+
+	b := memBytes(p, n)
+	if off == 0 {
+		h.setHeader(b)
+	}
+	if _, verify := h.flags(); verify && isPage(n) {
+		var sum [ChecksumReserve]byte
+		pageChecksum(sum[:], b[:n-ChecksumReserve])
+		if string(sum[:]) != string(b[n-ChecksumReserve:]) {
+			logf(sqlite3.SQLITE_IOERR_DATA, "sqlite: checksum fault at offset %d of %s", off, f.name)
+			return sqlite3.SQLITE_IOERR_DATA
+		}
+	}
+	return rc
+}
+
+func (h *cksmHooks) write(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32 {
+	b := memBytes(p, n)
+	if off == 0 {
+		h.setHeader(b)
+	}
+	if compute, _ := h.flags(); compute && isPage(n) {
+		pageChecksum(b[n-ChecksumReserve:], b[:n-ChecksumReserve])
+	}
+	return h.passThrough.write(tls, f, p, n, off)
+}
+
+func (h *cksmHooks) fileControl(tls *libc.TLS, f *shimFile, op int32, pArg uintptr) int32 {
+	if h.db != nil {
+		return h.passThrough.fileControl(tls, f, op, pArg)
+	}
+
+	switch op {
+	case sqlite3.SQLITE_FCNTL_PRAGMA:
+		// pArg is char*[3]: the error message or result, the name of the
+		// pragma and its argument.
+		az := (*[3]uintptr)(unsafe.Pointer(pArg))
+		if !strings.EqualFold(libc.GoString(az[1]), "checksum_verification") {
+			break
+		}
+
+		h.mu.Lock()
+		if az[2] != 0 {
+			switch strings.ToLower(libc.GoString(az[2])) {
+			case "1", "on", "true", "yes":
+				h.verify = h.compute
+			default:
+				h.verify = false
+			}
+		}
+		v := h.verify
+		h.mu.Unlock()
+		az[0] = sqliteString(tls, map[bool]string{false: "0", true: "1"}[v])
+		return sqlite3.SQLITE_OK
+	case sqlite3.SQLITE_FCNTL_CKPT_START, sqlite3.SQLITE_FCNTL_CKPT_DONE:
+		// The pages copied by a checkpoint were verified when read from
+		// the WAL and carry their checksums.
+		h.mu.Lock()
+		h.inCkpt = op == sqlite3.SQLITE_FCNTL_CKPT_START
+		h.mu.Unlock()
+	case sqlite3.SQLITE_FCNTL_MMAP_SIZE:
+		// Whether the database has checksums is not known before its
+		// header is read, so memory mapped I/O is disabled regardless.
+		*(*int64)(unsafe.Pointer(pArg)) = 0
+	}
+	return h.passThrough.fileControl(tls, f, op, pArg)
+}
+
+// fetch returns no page, so SQLite reads the pages by read, which verifies
+// them, even if memory mapped I/O was enabled before page 1 was read.
+func (h *cksmHooks) fetch(tls *libc.TLS, f *shimFile, off int64, n int32, pp uintptr) int32 {
+	*(*uintptr)(unsafe.Pointer(pp)) = 0
+	return sqlite3.SQLITE_OK
+}
+
+// pageChecksum computes the checksum of b, a multiple of 8 bytes, into sum
+// the way cksumvfs does: two running sums of the little endian 32 bit words
+// of b, stored little endian.
+func pageChecksum(sum, b []byte) {
+	le := binary.LittleEndian
+	var s1, s2 uint32
+	for i := 0; i < len(b); i += 8 {
+		s1 += le.Uint32(b[i:]) + s2
+		s2 += le.Uint32(b[i+4:]) + s1
+	}
+	le.PutUint32(sum, s1)
+	le.PutUint32(sum[4:], s2)
+}
+
+// sqliteString returns s in memory allocated by sqlite3_malloc, or 0 if out
+// of memory.
+func sqliteString(tls *libc.TLS, s string) uintptr {
+	p := sqlite3.Xsqlite3_malloc(tls, int32(len(s)+1))
+	if p != 0 {
+		b := memBytes(p, int32(len(s)+1))
+		copy(b, s)
+		b[len(s)] = 0
+	}
+	return p
+}
+
+// EnableChecksums makes the pages of the main database reserve
+// ChecksumReserve bytes for their checksum, rewriting the database by VACUUM,
+// see RegisterChecksumVFS. The connection must have opened the database using
+// a checksum VFS and the database must not be in WAL mode while it is
+// converted, the journal mode can be changed back afterwards.
+// EnableChecksums does nothing if the database has checksums already.
+//
+// EnableChecksums can be reached using (*sql.Conn).Raw.
+func (c *conn) EnableChecksums() error {
+	p, err := c.malloc(8)
+	if err != nil {
+		return err
+	}
+
+	defer c.free(p)
+
+	zDb, err := libc.CString("main")
+	if err != nil {
+		return err
+	}
+
+	defer c.free(zDb)
+
+	// int sqlite3_file_control(sqlite3*, const char *zDbName, int op, void*);
+	*(*uintptr)(unsafe.Pointer(p)) = 0
+	if rc := sqlite3.Xsqlite3_file_control(c.tls, c.db, zDb, sqlite3.SQLITE_FCNTL_FILE_POINTER, p); rc != sqlite3.SQLITE_OK {
+		return c.errstr(rc)
+	}
+
+	f := shimFileOf(*(*uintptr)(unsafe.Pointer(p)))
+	if f == nil {
+		return fmt.Errorf("sqlite: EnableChecksums: the database is not opened using a checksum VFS")
+	}
+
+	h, ok := f.hooks.(*cksmHooks)
+	if !ok {
+		return fmt.Errorf("sqlite: EnableChecksums: the database is not opened using a checksum VFS")
+	}
+
+	if mode, err := c.JournalMode(); err != nil {
+		return err
+	} else if strings.EqualFold(mode, "wal") {
+		return fmt.Errorf("sqlite: EnableChecksums: the database is in WAL mode")
+	}
+
+	if compute, _ := h.flags(); compute {
+		return nil
+	}
+
+	*(*int32)(unsafe.Pointer(p)) = ChecksumReserve
+	if rc := sqlite3.Xsqlite3_file_control(c.tls, c.db, zDb, sqlite3.SQLITE_FCNTL_RESERVE_BYTES, p); rc != sqlite3.SQLITE_OK {
+		return c.errstr(rc)
+	}
+
+	_, err = c.exec(context.Background(), "vacuum", nil)
+	return err
+}
@@ -0,0 +1,184 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func TestChecksumVFS(t *testing.T) {
+	if err := RegisterChecksumVFS("test-cksm", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, "file:"+uriEscape(name)+"?vfs=test-cksm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+create table t(i integer primary key, b blob);
+insert into t(b) with recursive s(i) as (select 1 union all select i + 1 from s where i < 100) select randomblob(1000) from s;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	sc, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var verify string
+	if err := sc.QueryRowContext(context.Background(), "pragma checksum_verification").Scan(&verify); err != nil || verify != "0" {
+		t.Fatalf("checksum_verification %q, %v, want 0", verify, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := sc.Raw(func(dc interface{}) error { return dc.(*conn).EnableChecksums() }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sc.QueryRowContext(context.Background(), "pragma checksum_verification").Scan(&verify); err != nil || verify != "1" {
+		t.Fatalf("checksum_verification %q, %v, want 1", verify, err)
+	}
+
+	sc.Close()
+	if _, err := db.Exec("pragma journal_mode=wal; update t set b = randomblob(900) where i % 2 = 0"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pageSize := int(b[16])<<8 | int(b[17])
+	if b[20] != ChecksumReserve {
+		t.Fatalf("%d reserved bytes", b[20])
+	}
+
+	for off := 0; off < len(b); off += pageSize {
+		page := b[off : off+pageSize]
+		var sum [ChecksumReserve]byte
+		pageChecksum(sum[:], page[:pageSize-ChecksumReserve])
+		if string(sum[:]) != string(page[pageSize-ChecksumReserve:]) {
+			t.Fatalf("checksum of page %d", off/pageSize+1)
+		}
+	}
+
+	// Corrupt a byte of the last row.
+	b[len(b)-ChecksumReserve-1] ^= 1
+	if err := os.WriteFile(name, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = sql.Open(driverName, "file:"+uriEscape(name)+"?vfs=test-cksm"); err != nil {
+		t.Fatal(err)
+	}
+
+	db.SetMaxOpenConns(1)
+	var n int
+	var e *Error
+	if err := db.QueryRow("select count(*) from t where length(b) > 0").Scan(&n); !errors.As(err, &e) || e.Code() != sqlite3.SQLITE_IOERR_DATA {
+		t.Fatalf("got %v, want SQLITE_IOERR_DATA", err)
+	}
+
+	if err := db.QueryRow("pragma checksum_verification=off").Scan(&verify); err != nil || verify != "0" {
+		t.Fatalf("checksum_verification %q, %v, want 0", verify, err)
+	}
+
+	if err := db.QueryRow("select count(*) from t where length(b) > 0").Scan(&n); err != nil || n != 100 {
+		t.Fatalf("%d rows, %v", n, err)
+	}
+}
+
+// TestChecksumVFSMmap checks memory mapped I/O stays disabled for a database
+// of the checksum VFS when it is enabled before the database header is read,
+// here of a new database, which gets checksums only later.
+func TestChecksumVFSMmap(t *testing.T) {
+	if err := RegisterChecksumVFS("test-cksm-mmap", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "test.db")
+	dsn := "file:" + uriEscape(name) + "?vfs=test-cksm-mmap&_pragma=mmap_size(268435456)"
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.SetMaxOpenConns(1)
+	mmapSize := func() {
+		t.Helper()
+		var n int64
+		if err := db.QueryRow("pragma mmap_size").Scan(&n); err != nil || n != 0 {
+			t.Fatalf("mmap_size %v, %v, want 0", n, err)
+		}
+	}
+
+	mmapSize()
+	if _, err := db.Exec(`
+create table t(i integer primary key, b blob);
+insert into t(b) with recursive s(i) as (select 1 union all select i + 1 from s where i < 100) select randomblob(1000) from s;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	sc, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sc.Raw(func(dc interface{}) error { return dc.(*conn).EnableChecksums() }); err != nil {
+		t.Fatal(err)
+	}
+
+	sc.Close()
+	mmapSize()
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt a byte of the last row.
+	b[len(b)-ChecksumReserve-1] ^= 1
+	if err := os.WriteFile(name, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = sql.Open(driverName, dsn); err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	var n int
+	var e *Error
+	if err := db.QueryRow("select count(*) from t where length(b) > 0").Scan(&n); !errors.As(err, &e) || e.Code() != sqlite3.SQLITE_IOERR_DATA {
+		t.Fatalf("got %v, want SQLITE_IOERR_DATA", err)
+	}
+
+	mmapSize()
+}
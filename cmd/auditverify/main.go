@@ -0,0 +1,87 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command auditverify checks the hash chain of audit logs written by the
+// audit VFS of modernc.org/sqlite, see sqlite.RegisterAuditVFS.
+//
+// Usage:
+//
+//	auditverify [-v] [-repair] file...
+//
+// For every intact log the number of records and the hash of the last record
+// is printed. Publishing the last hash allows to detect later a log that was
+// rewritten as a whole. With -v every record is listed as well. With -repair a
+// record partially written by a crash is first removed from the end of the
+// logs, see auditlog.Repair. The exit status is 1 if any of the logs is
+// broken.
+package main // import "modernc.org/sqlite/cmd/auditverify"
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"modernc.org/sqlite/auditlog"
+)
+
+func main() {
+	verbose := flag.Bool("v", false, "list all records")
+	repair := flag.Bool("repair", false, "remove a record partially written by a crash")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-v] [-repair] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rc := 0
+	for _, name := range flag.Args() {
+		if *repair {
+			n, err := auditlog.Repair(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				rc = 1
+				continue
+			}
+
+			if n != 0 {
+				fmt.Printf("%s: removed a partial record of %d bytes\n", name, n)
+			}
+		}
+		if err := verify(name, *verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			rc = 1
+		}
+	}
+	os.Exit(rc)
+}
+
+func verify(name string, verbose bool) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var n int
+	var last auditlog.Record
+	if err := auditlog.Scan(f, func(r *auditlog.Record) error {
+		if verbose {
+			fmt.Printf("%s: %d %s %s offset %d len %d %x\n", name, r.Seq, r.Time.UTC().Format(time.RFC3339Nano), r.Kind, r.Offset, len(r.Data), r.Hash)
+		}
+		n++
+		last = *r
+		return nil
+	}); err != nil {
+		return fmt.Errorf("after %d valid records: %w", n, err)
+	}
+
+	fmt.Printf("%s: ok, %d records, last %x\n", name, n, last.Hash)
+	return nil
+}
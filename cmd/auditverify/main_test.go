@@ -0,0 +1,51 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main // import "modernc.org/sqlite/cmd/auditverify"
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"modernc.org/sqlite/auditlog"
+)
+
+func TestVerify(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log")
+	w, err := auditlog.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := w.Append(auditlog.Write, int64(i)*4096, []byte("data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, verbose := range []bool{false, true} {
+		if err := verify(name, verbose); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b[len(b)-40]++
+	if err := os.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verify(name, false); !errors.Is(err, auditlog.ErrBroken) {
+		t.Fatalf("got %v, want %v", err, auditlog.ErrBroken)
+	}
+}
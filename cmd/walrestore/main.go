@@ -0,0 +1,79 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command walrestore restores a database from an archive written by package
+// modernc.org/sqlite/walarchive, as it was at a chosen time.
+//
+// Usage:
+//
+//	walrestore -l archive
+//	walrestore [-t time] archive dst
+//
+// With -l the base backups and the range of archived transactions are listed.
+// Otherwise the database is written to the new file dst as it was at time,
+// given in RFC 3339 format like 2022-12-01T10:00:00Z, or at the time of the
+// last archived transaction if -t is not given.
+package main // import "modernc.org/sqlite/cmd/walrestore"
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"modernc.org/sqlite/walarchive"
+)
+
+func main() {
+	list := flag.Bool("l", false, "list the content of the archive")
+	at := flag.String("t", "", "restore the database as it was at this RFC 3339 time")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -l archive\n       %s [-t time] archive dst\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	switch {
+	case *list && flag.NArg() == 1:
+		if err := stat(flag.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case !*list && flag.NArg() == 2:
+		until := time.Now()
+		if *at != "" {
+			var err error
+			if until, err = time.Parse(time.RFC3339Nano, *at); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		}
+
+		last, err := walarchive.Restore(flag.Arg(0), flag.Arg(1), until)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("%s: restored as of %s\n", flag.Arg(1), last.UTC().Format(time.RFC3339Nano))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func stat(dir string) error {
+	info, err := walarchive.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("database %s\n", info.Database)
+	for _, v := range info.Backups {
+		fmt.Printf("backup %s after transaction %d, %d bytes\n", v.Time.UTC().Format(time.RFC3339Nano), v.Seq, v.Size)
+	}
+	if info.Last != 0 {
+		fmt.Printf("transactions %d to %d, last %s\n", info.First, info.Last, info.LastTime.UTC().Format(time.RFC3339Nano))
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main // import "modernc.org/sqlite/cmd/walrestore"
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"modernc.org/sqlite"
+	"modernc.org/sqlite/walarchive"
+)
+
+func TestRestore(t *testing.T) {
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "archive")
+	a, err := walarchive.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer a.Close()
+
+	if err := sqlite.RegisterWALVFS("walrestore-test", "", a.Ship); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(tmp, "test.db")+"?vfs=walrestore-test&_pragma=journal_mode(wal)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Backup(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("insert into t values(42)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stat(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(tmp, "restored.db")
+	args := os.Args
+
+	defer func() { os.Args = args }()
+
+	os.Args = []string{"walrestore", dir, dst}
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	main()
+	rdb, err := sql.Open("sqlite3", dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rdb.Close()
+
+	var i int
+	if err := rdb.QueryRow("select i from t").Scan(&i); err != nil || i != 42 {
+		t.Fatal(i, err)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"sync"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var (
+	// registryMu guards the functions and collations of the driver and
+	// registrySeq, the number of registrations so far. Every registration
+	// records its sequence number, so a connection knows which it has
+	// created already, see conn.applyRegistry.
+	registryMu  sync.Mutex
+	registrySeq int
+)
+
+// goCollation is a collation registered by RegisterCollation.
+type goCollation struct {
+	zName uintptr
+	id    uintptr // See newCollationID.
+	seq   int     // See registrySeq.
+	cmp   func(a, b string) int
+}
+
+func (g *goCollation) compare(a, b []byte) int {
+	switch n := g.cmp(string(a), string(b)); {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// RegisterCollation registers a collation named name, which orders text by
+// cmp. Like strings.Compare, cmp returns a negative number if a sorts before
+// b, a positive number if a sorts after b, and 0 if they are equal. cmp must
+// be safe for concurrent use and consistent, see
+// https://www.sqlite.org/c3ref/create_collation.html. The text of indexes
+// using the collation depends on cmp, so changing cmp requires a REINDEX.
+//
+// The collation is created on every connection opened by the driver, also
+// on the connections opened before RegisterCollation was called: those get
+// it when database/sql takes them from its pool of idle connections. The
+// same holds for the functions registered by RegisterScalarFunction and its
+// variants, so a pool never hands out a connection missing them.
+func RegisterCollation(name string, cmp func(a, b string) int) error {
+	if name == "" {
+		return fmt.Errorf("a collation name is required")
+	}
+
+	if cmp == nil {
+		return fmt.Errorf("the collation %q has no compare function", name)
+	}
+
+	registryMu.Lock()
+
+	defer registryMu.Unlock()
+
+	if _, ok := d.collations[name]; ok {
+		return fmt.Errorf("a collation named %q is already registered", name)
+	}
+
+	// Don't free, collations registered on the driver live as long as the
+	// program.
+	zName, err := libc.CString(name)
+	if err != nil {
+		return err
+	}
+
+	g := &goCollation{zName: zName, cmp: cmp}
+	g.id = newCollationID(g)
+	registrySeq++
+	g.seq = registrySeq
+	d.collations[name] = g
+	return nil
+}
+
+// MustRegisterCollation is like RegisterCollation but panics on error.
+func MustRegisterCollation(name string, cmp func(a, b string) int) {
+	if err := RegisterCollation(name, cmp); err != nil {
+		panic(err)
+	}
+}
+
+// applyRegistry creates on c the functions and collations of the driver
+// registered after c last called applyRegistry.
+func (c *conn) applyRegistry() error {
+	registryMu.Lock()
+
+	defer registryMu.Unlock()
+
+	if c.registrySeq == registrySeq {
+		return nil
+	}
+
+	for _, udf := range d.udfs {
+		if udf.seq <= c.registrySeq {
+			continue
+		}
+
+		if err := c.createFunctionInternal(udf); err != nil {
+			return err
+		}
+	}
+
+	for _, g := range d.collations {
+		if g.seq <= c.registrySeq {
+			continue
+		}
+
+		// int sqlite3_create_collation_v2(
+		//   sqlite3*,
+		//   const char *zName,
+		//   int eTextRep,
+		//   void *pArg,
+		//   int(*xCompare)(void*,int,const void*,int,const void*),
+		//   void(*xDestroy)(void*)
+		// );
+		if rc := sqlite3.Xsqlite3_create_collation_v2(c.tls, c.db, g.zName, sqlite3.SQLITE_UTF8, g.id, xCollationCompare, 0); rc != sqlite3.SQLITE_OK {
+			return c.errstr(rc)
+		}
+	}
+
+	c.registrySeq = registrySeq
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegisterCollation(t *testing.T) {
+	db, err := sql.Open(driverName, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	// Open two connections before registering, and keep them in the pool.
+	db.SetMaxIdleConns(2)
+	ctx := context.Background()
+	var conns []*sql.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	byLength := func(a, b string) int {
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+
+		return strings.Compare(a, b)
+	}
+	if err := RegisterCollation("test_length", byLength); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterCollation("test_length", byLength); err == nil {
+		t.Fatal("unexpected success registering a collation twice")
+	}
+
+	if err := RegisterScalarFunction("test_registry", 0, func(*FunctionContext, []driver.Value) (driver.Value, error) {
+		return "ok", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("create table t(s text collate test_length); insert into t values('ccc'), ('a'), ('bb'), ('aa')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every connection, pooled or new, has the collation and the function.
+	for i := 0; i < 3; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer conn.Close()
+
+		var got []string
+		rows, err := conn.QueryContext(ctx, "select s from t order by s")
+		if err != nil {
+			t.Fatal(i, err)
+		}
+
+		for rows.Next() {
+			var s string
+			if err := rows.Scan(&s); err != nil {
+				t.Fatal(err)
+			}
+
+			got = append(got, s)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		rows.Close()
+		if g, e := strings.Join(got, " "), "a aa bb ccc"; g != e {
+			t.Fatalf("%d: got %q, expected %q", i, g, e)
+		}
+
+		var s string
+		if err := conn.QueryRowContext(ctx, "select test_registry()").Scan(&s); err != nil || s != "ok" {
+			t.Fatal(i, s, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !(windows && 386)
+// +build !windows !386
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// The library of windows/386 is SQLite 3.33.0, the one of the other targets
+// is SQLite 3.40.0. This file and compat_windows_386.go provide the parts of
+// the API the older version lacks.
+
+// Extended result codes added after SQLite 3.33.0.
+const (
+	sqliteConstraintDatatype = sqlite3.SQLITE_CONSTRAINT_DATATYPE
+	sqliteIOErrCorruptFS     = sqlite3.SQLITE_IOERR_CORRUPTFS
+)
+
+// Constraint operators of xBestIndex added after SQLite 3.33.0.
+const (
+	sqliteIndexConstraintLimit  = sqlite3.SQLITE_INDEX_CONSTRAINT_LIMIT
+	sqliteIndexConstraintOffset = sqlite3.SQLITE_INDEX_CONSTRAINT_OFFSET
+)
+
+// stmtFilterStatus returns the Bloom filter counters of pstmt.
+func stmtFilterStatus(tls *libc.TLS, pstmt uintptr) (hits, misses int64) {
+	// int sqlite3_stmt_status(sqlite3_stmt*, int op,int resetFlg);
+	return int64(sqlite3.Xsqlite3_stmt_status(tls, pstmt, sqlite3.SQLITE_STMTSTATUS_FILTER_HIT, 0)),
+		int64(sqlite3.Xsqlite3_stmt_status(tls, pstmt, sqlite3.SQLITE_STMTSTATUS_FILTER_MISS, 0))
+}
+
+// serialize returns the content of the database zSchema of db, or 0 on
+// failure, and stores its size at pSize, see Serialize.
+func serialize(tls *libc.TLS, db, zSchema, pSize uintptr) (uintptr, error) {
+	// unsigned char *sqlite3_serialize(
+	//   sqlite3 *db,           /* The database connection */
+	//   const char *zSchema,   /* Which DB to serialize. ex: "main", "temp", ... */
+	//   sqlite3_int64 *piSize, /* Write size of the DB here, if not NULL */
+	//   unsigned int mFlags    /* Zero or more SQLITE_SERIALIZE_* flags */
+	// );
+	return sqlite3.Xsqlite3_serialize(tls, db, zSchema, pSize, 0), nil
+}
+
+// sqlite3_int64 sqlite3_changes64(sqlite3*);
+func changes64(tls *libc.TLS, db uintptr) int64 { return sqlite3.Xsqlite3_changes64(tls, db) }
+
+// sqlite3_int64 sqlite3_total_changes64(sqlite3*);
+func totalChanges64(tls *libc.TLS, db uintptr) int64 {
+	return sqlite3.Xsqlite3_total_changes64(tls, db)
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// The library of windows/386 is SQLite 3.33.0, see compat.go.
+
+// Extended result codes added after SQLite 3.33.0, see sqlite3.h of SQLite
+// 3.40.0. SQLite 3.33.0 never returns them.
+const (
+	sqliteConstraintDatatype = sqlite3.SQLITE_CONSTRAINT | 12<<8
+	sqliteIOErrCorruptFS     = sqlite3.SQLITE_IOERR | 33<<8
+)
+
+// Constraint operators of xBestIndex added after SQLite 3.33.0, which never
+// passes LIMIT and OFFSET to virtual tables.
+const (
+	sqliteIndexConstraintLimit  = 73
+	sqliteIndexConstraintOffset = 74
+)
+
+// stmtFilterStatus returns zeros, SQLite 3.33.0 has no Bloom filters. Its
+// sqlite3_stmt_status does not check the counter number, asking for the
+// counters of 3.40.0 reads past the counters of the statement.
+func stmtFilterStatus(tls *libc.TLS, pstmt uintptr) (hits, misses int64) {
+	return 0, 0
+}
+
+// serialize fails, SQLite 3.33.0 is built without sqlite3_serialize.
+func serialize(tls *libc.TLS, db, zSchema, pSize uintptr) (uintptr, error) {
+	return 0, fmt.Errorf("sqlite: Serialize is not supported on windows/386")
+}
+
+// changes64 returns the 32-bit counter of SQLite 3.33.0, which has no
+// sqlite3_changes64.
+func changes64(tls *libc.TLS, db uintptr) int64 { return int64(sqlite3.Xsqlite3_changes(tls, db)) }
+
+// totalChanges64 returns the 32-bit counter of SQLite 3.33.0, which has no
+// sqlite3_total_changes64.
+func totalChanges64(tls *libc.TLS, db uintptr) int64 {
+	return int64(sqlite3.Xsqlite3_total_changes(tls, db))
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"strings"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Constraint describes the violated constraint reported by an Error, as far as
+// the error message of SQLite names it, see Error.Constraint.
+type Constraint struct {
+	// Table of Columns.
+	Table string
+	// Columns of a NOT NULL, UNIQUE or PRIMARY KEY constraint.
+	Columns []string
+	// Index enforcing a UNIQUE or PRIMARY KEY constraint. Empty for an
+	// INTEGER PRIMARY KEY, which is the rowid of the table and has no index.
+	Index string
+	// Check is the name of a CHECK constraint, or its expression if it has no
+	// name.
+	Check string
+}
+
+// Constraint returns the details of the violated constraint if e reports a
+// constraint violation, like SQLITE_CONSTRAINT_UNIQUE, and nil otherwise. The
+// fields SQLite does not provide for the kind of constraint, like all of them
+// for a foreign key constraint, are empty.
+func (e *Error) Constraint() *Constraint { return e.constraint }
+
+// parseConstraint parses the error message msg of the constraint violation
+// code, like "UNIQUE constraint failed: t.a, t.b", "UNIQUE constraint failed:
+// index 'i'" or "CHECK constraint failed: c > 0".
+func parseConstraint(code int32, msg string) *Constraint {
+	r := &Constraint{}
+	const failed = " constraint failed: "
+	i := strings.Index(msg, failed)
+	if i < 0 {
+		return r
+	}
+
+	detail := msg[i+len(failed):]
+	switch {
+	case code == sqlite3.SQLITE_CONSTRAINT_CHECK:
+		r.Check = detail
+	case strings.HasPrefix(detail, "index '") && strings.HasSuffix(detail, "'"):
+		r.Index = detail[len("index '") : len(detail)-1]
+	default:
+		for _, v := range strings.Split(detail, ", ") {
+			j := strings.IndexByte(v, '.')
+			if j < 0 {
+				return &Constraint{}
+			}
+
+			if r.Table == "" {
+				r.Table = v[:j]
+			}
+			r.Columns = append(r.Columns, v[j+1:])
+		}
+	}
+	return r
+}
+
+// constraint returns the details of the constraint violation code with the
+// message msg, or nil if code is not a constraint violation.
+func (c *conn) constraint(code int32, msg string) *Constraint {
+	if code&0xff != sqlite3.SQLITE_CONSTRAINT {
+		return nil
+	}
+
+	r := parseConstraint(code, msg)
+	switch code {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		if r.Index == "" && len(r.Columns) != 0 && c.db != 0 && !c.panic {
+			r.Index = c.uniqueIndex(r.Table, r.Columns)
+		}
+	}
+	return r
+}
+
+// uniqueIndex returns the name of the unique index of table on exactly the
+// columns, or "" if there is none or on errors. It does not go through the
+// statement machinery so the lookup does not affect Status, and it is not
+// reported to the tracer of the connection.
+func (c *conn) uniqueIndex(table string, columns []string) (r string) {
+	psql, err := libc.CString(`select l.name from pragma_index_list(?1) l where l."unique" and (select group_concat(i.name, x'00') from pragma_index_info(l.name) i) = ?2`)
+	if err != nil {
+		return ""
+	}
+
+	defer c.free(psql)
+
+	zSQL := psql
+	pstmt, err := c.prepareV2(&zSQL)
+	if err != nil || pstmt == 0 {
+		return ""
+	}
+
+	var bound []uintptr
+
+	c.untrace(pstmt)
+
+	defer func() {
+		sqlite3.Xsqlite3_finalize(c.tls, pstmt)
+		c.untrace(0)
+		for _, p := range bound {
+			c.free(p)
+		}
+	}()
+
+	for i, v := range []string{table, strings.Join(columns, "\x00")} {
+		p, err := c.bindText(pstmt, i+1, v)
+		if err != nil {
+			return ""
+		}
+
+		bound = append(bound, p)
+	}
+
+	if rc, err := c.step(pstmt); err != nil || rc != sqlite3.SQLITE_ROW {
+		return ""
+	}
+
+	r, _ = c.columnText(pstmt, 0)
+	return r
+}
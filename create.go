@@ -0,0 +1,200 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// createBusyTimeout is the time in milliseconds a connection waits for
+// another one creating the same database, see setCreate.
+const createBusyTimeout = 5000
+
+// setCreate handles the _create query parameters. The values use the syntax
+// of _pragma, like "page_size(8192)". The pragmas are applied only if the
+// main database is empty, that is, if the connection creates it. page_size,
+// auto_vacuum and application_id take effect in the transaction writing the
+// first page of the database, so other connections never see the database
+// without them. journal_mode is set after that transaction commits.
+func (c *conn) setCreate(vs []string) error {
+	set := map[string]string{"application_id": "0"}
+	for _, v := range vs {
+		name, arg, err := parseCreate(v)
+		if err != nil {
+			return err
+		}
+
+		set[name] = arg
+	}
+	if c.readOnly {
+		return nil
+	}
+
+	// Another connection creating the database holds its locks until it is
+	// done.
+	sqlite3.Xsqlite3_busy_timeout(c.tls, c.db, createBusyTimeout)
+
+	defer sqlite3.Xsqlite3_busy_timeout(c.tls, c.db, 0)
+
+	for retries := 0; ; retries++ {
+		created, err := c.create(set)
+		// The transaction of a concurrent creator fails with SQLITE_BUSY
+		// without waiting, instead of deadlocking, if it read the database
+		// before the other one started writing. It then waits for the
+		// other one to finish and finds the database created.
+		var e *Error
+		if errors.As(err, &e) && e.code&0xff == sqlite3.SQLITE_BUSY && retries < 10 {
+			continue
+		}
+
+		if err != nil || !created {
+			return err
+		}
+
+		break
+	}
+
+	if journalMode := set["journal_mode"]; journalMode != "" {
+		mode, err := c.SetJournalMode(journalMode)
+		if err != nil {
+			return err
+		}
+
+		if !strings.EqualFold(mode, journalMode) {
+			return fmt.Errorf("sqlite: cannot set the journal mode %s of the new database, it is %s", journalMode, mode)
+		}
+	}
+	return nil
+}
+
+// create creates the main database with the settings set, if it is empty,
+// and reports whether it did, see setCreate.
+func (c *conn) create(set map[string]string) (bool, error) {
+	if n, err := c.pragmaInt64("page_count"); err != nil || n != 0 {
+		return false, err
+	}
+
+	// The page size and the auto-vacuum mode of an empty database are
+	// settings of the connection until its first write transaction, which
+	// fixes them. The auto_vacuum pragma may start the transaction, writing
+	// the auto-vacuum mode to the first page, so it must follow page_size
+	// and happen in the transaction. Writing the application ID makes sure
+	// the transaction writes the first page.
+	ctx := context.Background()
+	if _, err := c.exec(ctx, "begin", nil); err != nil {
+		return false, err
+	}
+
+	var err error
+	for _, name := range []string{"page_size", "auto_vacuum", "application_id"} {
+		if arg, ok := set[name]; ok {
+			if _, err = c.exec(ctx, fmt.Sprintf("pragma %s = %s", name, arg), nil); err != nil {
+				break
+			}
+		}
+	}
+
+	// The write transaction holds the write lock now. The file is not empty
+	// if another connection created the database in the meantime, the
+	// changes of the transaction are then discarded. page_count cannot tell,
+	// the transaction allocated the first page already.
+	var size int64
+	if err == nil {
+		size, err = c.fileSize()
+	}
+	if err != nil || size > 0 {
+		c.exec(ctx, "rollback", nil)
+		return false, err
+	}
+
+	if _, err := c.exec(ctx, "commit", nil); err != nil {
+		c.exec(ctx, "rollback", nil)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// fileSize returns the size of the file of the main database, or -1 if it
+// has none, like an in-memory database.
+func (c *conn) fileSize() (int64, error) {
+	p, err := c.malloc(8)
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.free(p)
+
+	zDb, err := libc.CString("main")
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.free(zDb)
+
+	// int sqlite3_file_control(sqlite3*, const char *zDbName, int op, void*);
+	*(*uintptr)(unsafe.Pointer(p)) = 0
+	if rc := sqlite3.Xsqlite3_file_control(c.tls, c.db, zDb, sqlite3.SQLITE_FCNTL_FILE_POINTER, p); rc != sqlite3.SQLITE_OK {
+		return 0, c.errstr(rc)
+	}
+
+	pFile := *(*uintptr)(unsafe.Pointer(p))
+	if pFile == 0 || (*sqlite3.Sqlite3_file)(unsafe.Pointer(pFile)).FpMethods == 0 {
+		return -1, nil
+	}
+
+	if rc := sqlite3.Xsqlite3OsFileSize(c.tls, pFile, p); rc != sqlite3.SQLITE_OK {
+		return 0, c.errstr(rc)
+	}
+
+	return *(*int64)(unsafe.Pointer(p)), nil
+}
+
+// parseCreate parses the value v of a _create query parameter.
+func parseCreate(v string) (name, arg string, err error) {
+	i := strings.IndexByte(v, '(')
+	if i < 0 || !strings.HasSuffix(v, ")") {
+		return "", "", fmt.Errorf("invalid _create %q", v)
+	}
+
+	name, arg = strings.ToLower(strings.TrimSpace(v[:i])), strings.TrimSpace(v[i+1:len(v)-1])
+	switch name {
+	case "page_size":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 512 || n > 65536 || n&(n-1) != 0 {
+			return "", "", fmt.Errorf("invalid _create %q", v)
+		}
+	case "auto_vacuum":
+		switch strings.ToLower(arg) {
+		case "none", "full", "incremental", "0", "1", "2":
+		default:
+			return "", "", fmt.Errorf("invalid _create %q", v)
+		}
+	case "journal_mode":
+		switch strings.ToLower(arg) {
+		case "delete", "truncate", "persist", "memory", "wal", "off":
+		default:
+			return "", "", fmt.Errorf("invalid _create %q", v)
+		}
+	case "application_id":
+		n, err := strconv.ParseInt(arg, 0, 32)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid _create %q", v)
+		}
+
+		arg = strconv.FormatInt(n, 10)
+	default:
+		return "", "", fmt.Errorf("unsupported _create pragma %q", name)
+	}
+	return name, arg, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCreate(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	dsn := fn + "?_create=page_size(8192)&_create=auto_vacuum(incremental)&_create=journal_mode(wal)&_create=application_id(0x1234)"
+
+	// Concurrent connections creating the same database.
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			db, err := sql.Open(driverName, dsn)
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			defer db.Close()
+
+			errs <- db.Ping()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(dsn string) {
+		db, err := sql.Open(driverName, dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer db.Close()
+
+		for _, v := range []struct {
+			pragma string
+			want   string
+		}{
+			{"page_size", "8192"},
+			{"auto_vacuum", "2"},
+			{"journal_mode", "wal"},
+			{"application_id", "4660"},
+		} {
+			var got string
+			if err := db.QueryRow("pragma " + v.pragma).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got != v.want {
+				t.Errorf("%s: got %s, want %s", v.pragma, got, v.want)
+			}
+		}
+	}
+	check(fn)
+
+	// The parameters of an existing database are ignored.
+	check(fn + "?_create=page_size(1024)&_create=auto_vacuum(none)&_create=journal_mode(delete)&_create=application_id(1)")
+
+	for _, v := range []string{
+		"page_size(1000)",
+		"auto_vacuum(sometimes)",
+		"journal_mode(wall)",
+		"application_id(x)",
+		"user_version(1)",
+		"page_size",
+	} {
+		db, err := sql.Open(driverName, fn+"?_create="+v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Ping(); err == nil {
+			t.Errorf("%s: unexpected success", v)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// monotonicBase is the origin of monotonic_now(). Time values obtained by
+// time.Now carry a monotonic clock reading, time.Since uses it.
+var monotonicBase = time.Now()
+
+func init() {
+	MustRegisterScalarFunction("monotonic_now", 0, monotonicNow)
+}
+
+// monotonic_now() returns the number of seconds, with nanosecond resolution,
+// elapsed since an arbitrary fixed point in the past. The value is unaffected
+// by changes of the wall clock and is suitable for measuring durations only.
+func monotonicNow(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	return time.Since(monotonicBase).Seconds(), nil
+}
+
+var (
+	tzFuncOnce sync.Once
+	tzFunc     *userDefinedFunction
+	tzFuncErr  error
+
+	tzLocations sync.Map // Zone name: *time.Location.
+)
+
+// setTZ handles the _tz query parameter. The function is created on c only,
+// like the function of _regexp.
+func (c *conn) setTZ(v string) error {
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid _tz %q", v)
+	}
+
+	if !on {
+		return nil
+	}
+
+	tzFuncOnce.Do(func() {
+		tzFunc, tzFuncErr = newScalarFunction("tz", -1, sqlite3.SQLITE_UTF8|sqlite3.SQLITE_DETERMINISTIC, tzConvert)
+	})
+	if tzFuncErr != nil {
+		return tzFuncErr
+	}
+
+	return c.createFunctionInternal(tzFunc)
+}
+
+// tzLocation returns the location of the IANA time zone name, loaded once.
+func tzLocation(name string) (*time.Location, error) {
+	if strings.EqualFold(name, "local") {
+		return time.Local, nil
+	}
+
+	if v, ok := tzLocations.Load(name); ok {
+		return v.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tzLocations.Store(name, loc)
+	return loc, nil
+}
+
+// tz(TIME, [FROM,] TO) converts TIME from the time zone FROM, UTC by default,
+// to the time zone TO, see the _tz query parameter.
+func tzConvert(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("wrong number of arguments to function tz()")
+	}
+
+	for _, v := range args {
+		if v == nil {
+			return nil, nil
+		}
+	}
+
+	from := time.UTC
+	if len(args) == 3 {
+		var err error
+		if from, err = tzLocation(fmt.Sprint(args[1])); err != nil {
+			return nil, fmt.Errorf("tz: %v", err)
+		}
+	}
+	to, err := tzLocation(fmt.Sprint(args[len(args)-1]))
+	if err != nil {
+		return nil, fmt.Errorf("tz: %v", err)
+	}
+
+	var t time.Time
+	switch x := args[0].(type) {
+	case int64:
+		t = time.Unix(x, 0)
+	case float64:
+		sec, frac := math.Modf(x)
+		t = time.Unix(int64(sec), int64(frac*1e9)).Round(time.Millisecond)
+	default:
+		s, _ := valueBytes(x)
+		ts, loc := strings.TrimSpace(string(s)), from
+		if strings.HasSuffix(ts, "Z") {
+			ts, loc = ts[:len(ts)-1], time.UTC
+		}
+		ok := strings.EqualFold(ts, "now")
+		if ok {
+			t = time.Now()
+		}
+		for _, f := range parseTimeFormats {
+			if ok {
+				break
+			}
+
+			var err error
+			t, err = time.ParseInLocation(f, ts, loc)
+			ok = err == nil
+		}
+		if !ok {
+			return nil, nil
+		}
+	}
+
+	t = t.In(to)
+	if t.Nanosecond() != 0 {
+		return t.Format("2006-01-02 15:04:05.000"), nil
+	}
+
+	return t.Format("2006-01-02 15:04:05"), nil
+}
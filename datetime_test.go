@@ -0,0 +1,114 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestTZ(t *testing.T) {
+	db, err := sql.Open(driverName, "file::memory:?_tz=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for _, v := range []struct {
+		sql  string
+		want interface{}
+	}{
+		{"select tz('2022-11-16 12:00', 'Europe/Prague')", "2022-11-16 13:00:00"},
+		{"select tz('2022-07-16T12:00:00.250Z', 'Europe/Prague')", "2022-07-16 14:00:00.250"},
+		{"select tz('2022-11-16 12:00:00', 'America/New_York', 'Asia/Tokyo')", "2022-11-17 02:00:00"},
+		{"select tz('2022-11-16 12:00:00+01:00', 'America/New_York', 'UTC')", "2022-11-16 11:00:00"},
+		{"select tz(1668600000, 'Australia/Sydney')", "2022-11-16 23:00:00"},
+		{"select tz(unixepoch('2022-11-16'), 'UTC')", "2022-11-16 00:00:00"},
+		{"select tz(null, 'UTC')", nil},
+		{"select tz('not a time', 'UTC')", nil},
+	} {
+		var g interface{}
+		if err := db.QueryRow(v.sql).Scan(&g); err != nil {
+			t.Errorf("%s: %v", v.sql, err)
+			continue
+		}
+
+		if g != v.want {
+			t.Errorf("%s: got %v, want %v", v.sql, g, v.want)
+		}
+	}
+
+	if _, err := db.Exec("select tz('2022-11-16', 'Nowhere/Nothing')"); err == nil {
+		t.Error("unexpected success with an unknown time zone")
+	}
+
+	if _, err := db.Exec("select tz('2022-11-16')"); err == nil {
+		t.Error("unexpected success with one argument")
+	}
+
+	bad, err := sql.Open(driverName, "file::memory:?_tz=maybe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer bad.Close()
+
+	if err := bad.Ping(); err == nil {
+		t.Error("unexpected success with an invalid _tz")
+	}
+}
+
+func TestMonotonicNow(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	var a, b float64
+	if err := db.QueryRow("select monotonic_now()").Scan(&a); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if err := db.QueryRow("select monotonic_now()").Scan(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := b - a; a < 0 || d < 0.02 || d > 10 {
+		t.Fatalf("got %v and %v, want 20ms apart", a, b)
+	}
+}
+
+// TestSubsecond checks the millisecond precision of the date and time
+// functions documented in doc.go.
+func TestSubsecond(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	for _, v := range []struct {
+		sql  string
+		want string
+	}{
+		{"select strftime('%Y-%m-%d %H:%M:%f', julianday('2022-11-16 12:00:00.123'))", "2022-11-16 12:00:00.123"},
+		{"select strftime('%Y-%m-%d %H:%M:%f', julianday('2022-11-16 23:59:59.999'))", "2022-11-16 23:59:59.999"},
+		{"select strftime('%f', '2022-11-16 12:00:01.5')", "01.500"},
+		{"select strftime('%f', '2022-11-16 12:00:01.123456')", "01.123"},
+		{"select datetime('2022-11-16 12:00:00.123')", "2022-11-16 12:00:00"},
+		{"select time('12:00:00.123', '+0.5 seconds')", "12:00:00"},
+		{"select strftime('%H:%M:%f', '12:00:00.123', '+0.5 seconds')", "12:00:00.623"},
+	} {
+		var g string
+		if err := db.QueryRow(v.sql).Scan(&g); err != nil {
+			t.Errorf("%s: %v", v.sql, err)
+			continue
+		}
+
+		if g != v.want {
+			t.Errorf("%s: got %q, want %q", v.sql, g, v.want)
+		}
+	}
+}
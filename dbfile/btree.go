@@ -0,0 +1,324 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dbfile // import "modernc.org/sqlite/dbfile"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf16"
+)
+
+// PageType is the type of a b-tree page.
+type PageType byte
+
+// Values of PageType.
+const (
+	InteriorIndex PageType = 2
+	InteriorTable PageType = 5
+	LeafIndex     PageType = 10
+	LeafTable     PageType = 13
+)
+
+// String implements fmt.Stringer.
+func (t PageType) String() string {
+	switch t {
+	case InteriorIndex:
+		return "interior index"
+	case InteriorTable:
+		return "interior table"
+	case LeafIndex:
+		return "leaf index"
+	case LeafTable:
+		return "leaf table"
+	default:
+		return fmt.Sprintf("PageType(%d)", byte(t))
+	}
+}
+
+// maxPayload bounds the payload of a cell, like SQLITE_MAX_LENGTH.
+const maxPayload = 1e9
+
+// Page is a parsed b-tree page.
+type Page struct {
+	Number uint32
+	Type   PageType
+	// Children are the child pages of an interior page, in key order. The
+	// right-most child is the last one.
+	Children []uint32
+	// Rows are the rows of a table leaf page, in rowid order.
+	Rows []Row
+	// Overflow are the overflow pages of the cells of the page.
+	Overflow []uint32
+}
+
+// Row is a row of a table b-tree.
+type Row struct {
+	Rowid int64
+	// Values are the columns of the row, int64, float64, string, []byte or
+	// nil. Rows written before columns were added by ALTER TABLE have
+	// fewer values than the table has columns.
+	Values []interface{}
+}
+
+// ReadPage reads and parses the b-tree page pgno of the database file r with
+// the header h. If some cells of the page are corrupt, the page holding the
+// other cells is returned together with the error.
+func ReadPage(r io.ReaderAt, h *Header, pgno uint32) (*Page, error) {
+	b, err := readPage(r, h, pgno)
+	if err != nil {
+		return nil, err
+	}
+
+	off := 0
+	if pgno == 1 {
+		off = HeaderSize
+	}
+	u := h.UsableSize()
+	p := &Page{Number: pgno, Type: PageType(b[off])}
+	hdr := 8
+	switch p.Type {
+	case InteriorIndex, InteriorTable:
+		hdr = 12
+	case LeafIndex, LeafTable:
+		// ok
+	default:
+		return nil, fmt.Errorf("%w: page %d is not a b-tree page", ErrCorrupt, pgno)
+	}
+
+	be := binary.BigEndian
+	n := int(be.Uint16(b[off+3:]))
+	ptrs := off + hdr
+	if ptrs+2*n > u {
+		return nil, fmt.Errorf("%w: %d cells on page %d", ErrCorrupt, n, pgno)
+	}
+
+	var firstErr error
+	for i := 0; i < n; i++ {
+		cell := int(be.Uint16(b[ptrs+2*i:]))
+		if cell < ptrs+2*n || cell >= u {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%w: cell %d of page %d at offset %d", ErrCorrupt, i, pgno, cell)
+			}
+			continue
+		}
+
+		if err := p.parseCell(r, h, b[cell:u]); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%w: cell %d of page %d: %v", ErrCorrupt, i, pgno, err)
+		}
+	}
+	if hdr == 12 {
+		p.Children = append(p.Children, be.Uint32(b[off+8:]))
+	}
+	return p, firstErr
+}
+
+func readPage(r io.ReaderAt, h *Header, pgno uint32) ([]byte, error) {
+	if pgno == 0 || h.PageCountValid() && pgno > h.PageCount {
+		return nil, fmt.Errorf("%w: page %d out of range", ErrCorrupt, pgno)
+	}
+
+	b := make([]byte, h.PageSize)
+	if _, err := r.ReadAt(b, int64(pgno-1)*int64(h.PageSize)); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("%w: page %d beyond the end of the file", ErrCorrupt, pgno)
+		}
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// parseCell adds the content of the cell b to p.
+func (p *Page) parseCell(r io.ReaderAt, h *Header, b []byte) error {
+	be := binary.BigEndian
+	switch p.Type {
+	case InteriorIndex, InteriorTable:
+		if len(b) < 4 {
+			return io.ErrUnexpectedEOF
+		}
+
+		p.Children = append(p.Children, be.Uint32(b))
+		return nil
+	case LeafIndex:
+		return nil
+	}
+
+	size, n := varint(b)
+	if n == 0 {
+		return io.ErrUnexpectedEOF
+	}
+
+	b = b[n:]
+	rowid, n := varint(b)
+	if n == 0 {
+		return io.ErrUnexpectedEOF
+	}
+
+	if size > maxPayload {
+		return fmt.Errorf("payload of %d bytes", size)
+	}
+
+	payload, err := p.payload(r, h, b[n:], int(size))
+	if err != nil {
+		return err
+	}
+
+	v, err := DecodeRecord(payload, h.TextEncoding)
+	if err != nil {
+		return err
+	}
+
+	p.Rows = append(p.Rows, Row{int64(rowid), v})
+	return nil
+}
+
+// payload returns the size bytes of the payload of a table leaf cell starting
+// with b, following its overflow pages.
+func (p *Page) payload(r io.ReaderAt, h *Header, b []byte, size int) ([]byte, error) {
+	u := h.UsableSize()
+	local := size
+	if x := u - 35; size > x {
+		m := (u-12)*32/255 - 23
+		local = m + (size-m)%(u-4)
+		if local > x {
+			local = m
+		}
+	}
+	if local == size {
+		if len(b) < size {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return b[:size], nil
+	}
+
+	if len(b) < local+4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	r2 := append([]byte(nil), b[:local]...)
+	for next := binary.BigEndian.Uint32(b[local:]); len(r2) < size; {
+		if next == 0 {
+			return nil, fmt.Errorf("overflow pages end after %d of %d bytes", len(r2), size)
+		}
+
+		o, err := readPage(r, h, next)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Overflow = append(p.Overflow, next)
+		n := size - len(r2)
+		if n > u-4 {
+			n = u - 4
+		}
+		r2 = append(r2, o[4:4+n]...)
+		next = binary.BigEndian.Uint32(o)
+	}
+	return r2, nil
+}
+
+// DecodeRecord decodes the record b, the content of a row or of an index
+// entry, see https://www.sqlite.org/fileformat2.html#record_format. The
+// values are int64, float64, string, []byte or nil. Text values are decoded
+// from enc.
+func DecodeRecord(b []byte, enc TextEncoding) ([]interface{}, error) {
+	hs, n := varint(b)
+	if n == 0 || hs > uint64(len(b)) || hs < uint64(n) {
+		return nil, fmt.Errorf("%w: record header size", ErrCorrupt)
+	}
+
+	hdr, data := b[n:hs], b[hs:]
+	var r []interface{}
+	for len(hdr) != 0 {
+		typ, n := varint(hdr)
+		if n == 0 {
+			return nil, fmt.Errorf("%w: record header", ErrCorrupt)
+		}
+
+		hdr = hdr[n:]
+		size := serialSize(typ)
+		if size > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: record value of serial type %d", ErrCorrupt, typ)
+		}
+
+		v := data[:size]
+		data = data[size:]
+		switch {
+		case typ == 0:
+			r = append(r, nil)
+		case typ <= 6:
+			x := int64(int8(v[0]))
+			for _, c := range v[1:] {
+				x = x<<8 | int64(c)
+			}
+			r = append(r, x)
+		case typ == 7:
+			r = append(r, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case typ == 8, typ == 9:
+			r = append(r, int64(typ-8))
+		case typ%2 == 0:
+			r = append(r, append([]byte{}, v...))
+		default:
+			r = append(r, decodeText(v, enc))
+		}
+	}
+	return r, nil
+}
+
+// serialSize returns the size of a value of serial type typ, or
+// math.MaxUint64 if typ is reserved.
+func serialSize(typ uint64) uint64 {
+	switch {
+	case typ <= 4:
+		return [...]uint64{0, 1, 2, 3, 4}[typ]
+	case typ == 5:
+		return 6
+	case typ <= 7:
+		return 8
+	case typ <= 9:
+		return 0
+	case typ <= 11:
+		return math.MaxUint64
+	default:
+		return (typ - 12) / 2
+	}
+}
+
+func decodeText(b []byte, enc TextEncoding) string {
+	var bo binary.ByteOrder
+	switch enc {
+	case UTF16LE:
+		bo = binary.LittleEndian
+	case UTF16BE:
+		bo = binary.BigEndian
+	default:
+		return string(b)
+	}
+
+	s := make([]uint16, len(b)/2)
+	for i := range s {
+		s[i] = bo.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(s))
+}
+
+// varint decodes the variable-length integer at the start of b and returns it
+// with the number of bytes used, 0 if b is too short.
+func varint(b []byte) (v uint64, n int) {
+	for i, c := range b {
+		if i == 8 {
+			return v<<8 | uint64(c), 9
+		}
+
+		v = v<<7 | uint64(c&0x7f)
+		if c < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
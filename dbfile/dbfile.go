@@ -0,0 +1,201 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dbfile parses the header and the freelist of SQLite database files,
+// see https://www.sqlite.org/fileformat2.html, without opening a connection.
+// It is meant for tools validating backups or reporting on databases, for
+// example
+//
+//	f, err := os.Open("app.db")
+//	...
+//	h, err := dbfile.ReadHeader(f)
+//	...
+//	fmt.Println(h.PageSize, h.PageCount, h.FreelistCount)
+//
+// The file of a database in WAL mode does not reflect the transactions not
+// yet checkpointed, and the file of a database being written may be read in
+// an inconsistent state. Read a copy made by a backup, or a database no
+// connection writes to, for reliable results.
+package dbfile // import "modernc.org/sqlite/dbfile"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Magic is the header string at the start of every database file.
+const Magic = "SQLite format 3\x00"
+
+// HeaderSize is the size of the database header, stored at the start of the
+// first page.
+const HeaderSize = 100
+
+var (
+	// ErrNotDatabase reports a file not starting with Magic.
+	ErrNotDatabase = errors.New("dbfile: not a database file")
+	// ErrCorrupt reports inconsistent header fields or freelist pages.
+	ErrCorrupt = errors.New("dbfile: database file is corrupt")
+)
+
+// TextEncoding is the encoding of all the text of a database.
+type TextEncoding uint32
+
+// Values of TextEncoding.
+const (
+	UTF8    TextEncoding = 1
+	UTF16LE TextEncoding = 2
+	UTF16BE TextEncoding = 3
+)
+
+// String implements fmt.Stringer.
+func (e TextEncoding) String() string {
+	switch e {
+	case UTF8:
+		return "UTF-8"
+	case UTF16LE:
+		return "UTF-16le"
+	case UTF16BE:
+		return "UTF-16be"
+	default:
+		return fmt.Sprintf("TextEncoding(%d)", uint32(e))
+	}
+}
+
+// Header is the database header.
+type Header struct {
+	PageSize      int // In bytes, a power of two from 512 to 65536.
+	WriteVersion  int // File format write version, 1 for legacy and 2 for WAL.
+	ReadVersion   int // File format read version, 1 for legacy and 2 for WAL.
+	ReservedSpace int // Bytes reserved at the end of each page, for extensions.
+	// ChangeCounter is incremented by each transaction modifying the file
+	// in rollback journal mode.
+	ChangeCounter uint32
+	// PageCount is the size of the database in pages, if PageCountValid
+	// reports true.
+	PageCount          uint32
+	FirstFreelistTrunk uint32 // Page number of the first freelist trunk page, 0 if none.
+	FreelistCount      uint32 // Free pages, including the trunk pages.
+	SchemaCookie       uint32 // Incremented when the schema changes, see "pragma schema_version".
+	SchemaFormat       uint32 // Schema format number, 1 to 4.
+	DefaultCacheSize   int32  // See "pragma default_cache_size".
+	// LargestRootPage is the page number of the largest root b-tree page
+	// in auto-vacuum and incremental vacuum modes, zero otherwise.
+	LargestRootPage   uint32
+	TextEncoding      TextEncoding
+	UserVersion       int32 // See "pragma user_version".
+	IncrementalVacuum bool  // Incremental vacuum mode, if LargestRootPage is not zero.
+	ApplicationID     int32 // See "pragma application_id".
+	VersionValidFor   uint32
+	// SQLiteVersion is the SQLITE_VERSION_NUMBER, like 3040000, of the
+	// library which last modified the file.
+	SQLiteVersion uint32
+}
+
+// ParseHeader parses the database header at the start of b.
+func ParseHeader(b []byte) (*Header, error) {
+	if len(b) < HeaderSize || string(b[:len(Magic)]) != Magic {
+		return nil, ErrNotDatabase
+	}
+
+	be := binary.BigEndian
+	r := &Header{
+		PageSize:           int(be.Uint16(b[16:])),
+		WriteVersion:       int(b[18]),
+		ReadVersion:        int(b[19]),
+		ReservedSpace:      int(b[20]),
+		ChangeCounter:      be.Uint32(b[24:]),
+		PageCount:          be.Uint32(b[28:]),
+		FirstFreelistTrunk: be.Uint32(b[32:]),
+		FreelistCount:      be.Uint32(b[36:]),
+		SchemaCookie:       be.Uint32(b[40:]),
+		SchemaFormat:       be.Uint32(b[44:]),
+		DefaultCacheSize:   int32(be.Uint32(b[48:])),
+		LargestRootPage:    be.Uint32(b[52:]),
+		TextEncoding:       TextEncoding(be.Uint32(b[56:])),
+		UserVersion:        int32(be.Uint32(b[60:])),
+		IncrementalVacuum:  be.Uint32(b[64:]) != 0,
+		ApplicationID:      int32(be.Uint32(b[68:])),
+		VersionValidFor:    be.Uint32(b[92:]),
+		SQLiteVersion:      be.Uint32(b[96:]),
+	}
+	if r.PageSize == 1 {
+		r.PageSize = 65536
+	}
+	if r.PageSize < 512 || r.PageSize&(r.PageSize-1) != 0 || r.PageSize-r.ReservedSpace < 480 {
+		return nil, fmt.Errorf("%w: page size %d with %d reserved bytes", ErrCorrupt, r.PageSize, r.ReservedSpace)
+	}
+
+	return r, nil
+}
+
+// ReadHeader reads and parses the database header of the database file r.
+func ReadHeader(r io.ReaderAt) (*Header, error) {
+	b := make([]byte, HeaderSize)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		if err == io.EOF {
+			return nil, ErrNotDatabase
+		}
+
+		return nil, err
+	}
+
+	return ParseHeader(b)
+}
+
+// PageCountValid reports whether PageCount is the size of the database. Old
+// versions of SQLite did not maintain it, the page count is then the size of
+// the file divided by PageSize.
+func (h *Header) PageCountValid() bool {
+	return h.PageCount != 0 && h.VersionValidFor == h.ChangeCounter
+}
+
+// UsableSize returns the bytes of a page available to SQLite.
+func (h *Header) UsableSize() int { return h.PageSize - h.ReservedSpace }
+
+// Freelist lists the unused pages of a database.
+type Freelist struct {
+	Trunks []uint32 // Trunk pages, in the order of the list.
+	Leaves []uint32 // Leaf pages, in the order of the list.
+}
+
+// ReadFreelist reads the freelist of the database file r with the header h.
+// The number of pages found must match h.FreelistCount.
+func ReadFreelist(r io.ReaderAt, h *Header) (*Freelist, error) {
+	fl := &Freelist{}
+	maxLeaves := uint32(h.UsableSize()/4 - 2)
+	b := make([]byte, h.UsableSize())
+	n := uint32(0)
+	for trunk := h.FirstFreelistTrunk; trunk != 0; {
+		if n >= h.FreelistCount || h.PageCountValid() && trunk > h.PageCount {
+			return nil, fmt.Errorf("%w: freelist trunk page %d", ErrCorrupt, trunk)
+		}
+
+		if _, err := r.ReadAt(b, int64(trunk-1)*int64(h.PageSize)); err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("%w: freelist trunk page %d beyond the end of the file", ErrCorrupt, trunk)
+			}
+			return nil, err
+		}
+
+		fl.Trunks = append(fl.Trunks, trunk)
+		n++
+		leaves := binary.BigEndian.Uint32(b[4:])
+		if leaves > maxLeaves || leaves > h.FreelistCount-n {
+			return nil, fmt.Errorf("%w: %d leaves on freelist trunk page %d", ErrCorrupt, leaves, trunk)
+		}
+
+		for i := uint32(0); i < leaves; i++ {
+			fl.Leaves = append(fl.Leaves, binary.BigEndian.Uint32(b[8+4*i:]))
+		}
+		n += leaves
+		trunk = binary.BigEndian.Uint32(b)
+	}
+	if n != h.FreelistCount {
+		return nil, fmt.Errorf("%w: %d freelist pages, the header reports %d", ErrCorrupt, n, h.FreelistCount)
+	}
+
+	return fl, nil
+}
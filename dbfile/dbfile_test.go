@@ -0,0 +1,112 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dbfile_test // import "modernc.org/sqlite/dbfile"
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+	"modernc.org/sqlite/dbfile"
+)
+
+func TestReadHeader(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite3", name+"?_pragma=page_size(1024)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	// Free enough pages to need two freelist trunk pages.
+	if _, err := db.Exec(`
+pragma user_version = 42;
+pragma application_id = -7;
+create table t(b);
+with recursive n(i) as (select 1 union all select i+1 from n where i < 300)
+insert into t select zeroblob(1000) from n;
+delete from t;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	var pageSize, pageCount, freelistCount, schemaVersion int64
+	if err := db.QueryRow("select * from pragma_page_size, pragma_page_count, pragma_freelist_count, pragma_schema_version").Scan(&pageSize, &pageCount, &freelistCount, &schemaVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	h, err := dbfile.ReadHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if int64(h.PageSize) != pageSize || int64(h.PageCount) != pageCount || int64(h.FreelistCount) != freelistCount || int64(h.SchemaCookie) != schemaVersion {
+		t.Errorf("header %+v, want page size %d, %d pages, %d free pages, schema cookie %d", h, pageSize, pageCount, freelistCount, schemaVersion)
+	}
+
+	if !h.PageCountValid() || h.TextEncoding != dbfile.UTF8 || h.UserVersion != 42 || h.ApplicationID != -7 || h.ChangeCounter == 0 || h.SQLiteVersion < 3040000 {
+		t.Errorf("header %+v", h)
+	}
+
+	fl, err := dbfile.ReadFreelist(f, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fl.Trunks) < 2 || int64(len(fl.Trunks)+len(fl.Leaves)) != freelistCount {
+		t.Errorf("%d trunk and %d leaf pages, want %d pages on at least two trunks", len(fl.Trunks), len(fl.Leaves), freelistCount)
+	}
+
+	seen := map[uint32]bool{}
+	for _, v := range append(fl.Trunks, fl.Leaves...) {
+		if v < 2 || int64(v) > pageCount || seen[v] {
+			t.Fatalf("free page %d", v)
+		}
+
+		seen[v] = true
+	}
+
+	// A freelist count not matching the list.
+	h.FreelistCount--
+	if _, err := dbfile.ReadFreelist(f, h); !errors.Is(err, dbfile.ErrCorrupt) {
+		t.Errorf("got %v, want %v", err, dbfile.ErrCorrupt)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	if _, err := dbfile.ParseHeader(bytes.Repeat([]byte{'x'}, dbfile.HeaderSize)); err != dbfile.ErrNotDatabase {
+		t.Errorf("got %v, want %v", err, dbfile.ErrNotDatabase)
+	}
+
+	if _, err := dbfile.ReadHeader(bytes.NewReader([]byte(dbfile.Magic))); err != dbfile.ErrNotDatabase {
+		t.Errorf("got %v, want %v", err, dbfile.ErrNotDatabase)
+	}
+
+	b := make([]byte, dbfile.HeaderSize)
+	copy(b, dbfile.Magic)
+	b[16], b[17] = 0, 1 // 65536
+	h, err := dbfile.ParseHeader(b)
+	if err != nil || h.PageSize != 65536 {
+		t.Errorf("page size %v, %v, want 65536", h, err)
+	}
+
+	b[17] = 3
+	if _, err := dbfile.ParseHeader(b); !errors.Is(err, dbfile.ErrCorrupt) {
+		t.Errorf("got %v, want %v", err, dbfile.ErrCorrupt)
+	}
+}
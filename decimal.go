@@ -0,0 +1,189 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql/driver"
+	"math/big"
+	"strings"
+)
+
+func init() {
+	MustRegisterDeterministicScalarFunction("decimal", 1, decimalFunc)
+	MustRegisterDeterministicScalarFunction("decimal_cmp", 2, decimalCmp)
+	MustRegisterDeterministicScalarFunction("decimal_add", 2, decimalAdd)
+	MustRegisterDeterministicScalarFunction("decimal_sub", 2, decimalSub)
+	MustRegisterDeterministicScalarFunction("decimal_mul", 2, decimalMul)
+}
+
+// decimal is the exact number m * 10^-scale.
+type decimal struct {
+	m     big.Int
+	scale int
+}
+
+// parseDecimal parses the text or number v, like "-12.50" or "1.5e-3". ok is
+// false if v is NULL or not a number.
+func parseDecimal(v driver.Value) (d *decimal, ok bool) {
+	b, ok := valueBytes(v)
+	if !ok {
+		return nil, false
+	}
+
+	s := strings.TrimSpace(string(b))
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, ok := parseExponent(s[i+1:])
+		if !ok {
+			return nil, false
+		}
+
+		exp, s = e, s[:i]
+	}
+
+	neg := false
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		neg, s = s[0] == '-', s[1:]
+	}
+	d = &decimal{}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		d.scale = len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+	if s == "" || strings.Trim(s, "0123456789") != "" {
+		return nil, false
+	}
+
+	d.m.SetString(s, 10)
+	if neg {
+		d.m.Neg(&d.m)
+	}
+	d.scale -= exp
+	if d.scale < 0 {
+		d.m.Mul(&d.m, pow10(-d.scale))
+		d.scale = 0
+	}
+	return d, true
+}
+
+func parseExponent(s string) (int, bool) {
+	neg := false
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		neg, s = s[0] == '-', s[1:]
+	}
+	if s == "" || len(s) > 4 || strings.Trim(s, "0123456789") != "" {
+		return 0, false
+	}
+
+	n := 0
+	for i := 0; i < len(s); i++ {
+		n = 10*n + int(s[i]-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// align returns the mantissas of a and b scaled to the same exponent.
+func align(a, b *decimal) (ma, mb *big.Int, scale int) {
+	ma, mb = new(big.Int).Set(&a.m), new(big.Int).Set(&b.m)
+	switch {
+	case a.scale < b.scale:
+		ma.Mul(ma, pow10(b.scale-a.scale))
+	case a.scale > b.scale:
+		mb.Mul(mb, pow10(a.scale-b.scale))
+	}
+	scale = a.scale
+	if b.scale > scale {
+		scale = b.scale
+	}
+	return ma, mb, scale
+}
+
+// String returns d without an exponent and without trailing fractional zeros.
+func (d *decimal) String() string {
+	neg := d.m.Sign() < 0
+	s := new(big.Int).Abs(&d.m).String()
+	if d.scale > 0 {
+		if len(s) <= d.scale {
+			s = strings.Repeat("0", d.scale-len(s)+1) + s
+		}
+		s = strings.TrimRight(s[:len(s)-d.scale]+"."+s[len(s)-d.scale:], "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	if neg && s != "0" {
+		s = "-" + s
+	}
+	return s
+}
+
+// decimal(X) returns X, a number or its text, as a decimal text. It returns
+// NULL if X is NULL or not a number.
+func decimalFunc(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	d, ok := parseDecimal(args[0])
+	if !ok {
+		return nil, nil
+	}
+
+	return d.String(), nil
+}
+
+// decimal_cmp(A, B) returns -1, 0 or 1 if the decimal A is less than, equal to
+// or greater than B. It returns NULL if A or B is not a number.
+func decimalCmp(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	return decimalOp(args, func(a, b *decimal) driver.Value {
+		ma, mb, _ := align(a, b)
+		return int64(ma.Cmp(mb))
+	})
+}
+
+// decimal_add(A, B) returns the exact sum of the decimals A and B as text.
+func decimalAdd(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	return decimalOp(args, func(a, b *decimal) driver.Value {
+		ma, mb, scale := align(a, b)
+		r := &decimal{scale: scale}
+		r.m.Add(ma, mb)
+		return r.String()
+	})
+}
+
+// decimal_sub(A, B) returns the exact difference of the decimals A and B as
+// text.
+func decimalSub(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	return decimalOp(args, func(a, b *decimal) driver.Value {
+		ma, mb, scale := align(a, b)
+		r := &decimal{scale: scale}
+		r.m.Sub(ma, mb)
+		return r.String()
+	})
+}
+
+// decimal_mul(A, B) returns the exact product of the decimals A and B as text.
+func decimalMul(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	return decimalOp(args, func(a, b *decimal) driver.Value {
+		r := &decimal{scale: a.scale + b.scale}
+		r.m.Mul(&a.m, &b.m)
+		return r.String()
+	})
+}
+
+func decimalOp(args []driver.Value, f func(a, b *decimal) driver.Value) (driver.Value, error) {
+	a, ok := parseDecimal(args[0])
+	if !ok {
+		return nil, nil
+	}
+
+	b, ok := parseDecimal(args[1])
+	if !ok {
+		return nil, nil
+	}
+
+	return f(a, b), nil
+}
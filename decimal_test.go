@@ -0,0 +1,56 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"testing"
+)
+
+func TestDecimal(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	for _, v := range []struct {
+		sql  string
+		want interface{}
+	}{
+		{"select decimal('1.50')", "1.5"},
+		{"select decimal(' -12.0 ')", "-12"},
+		{"select decimal('.5')", "0.5"},
+		{"select decimal('-0.00')", "0"},
+		{"select decimal('1.5e3')", "1500"},
+		{"select decimal('15E-4')", "0.0015"},
+		{"select decimal(42)", "42"},
+		{"select decimal(0.25)", "0.25"},
+		{"select decimal('123456789012345678901234567890.1')", "123456789012345678901234567890.1"},
+		{"select decimal('abc')", nil},
+		{"select decimal('1.2.3')", nil},
+		{"select decimal('1e')", nil},
+		{"select decimal('-')", nil},
+		{"select decimal(null)", nil},
+		{"select decimal_add('0.1', '0.2')", "0.3"},
+		{"select decimal_add('99999999999999999999', 1)", "100000000000000000000"},
+		{"select decimal_sub('1', '1.0001')", "-0.0001"},
+		{"select decimal_sub('2.5', '2.5')", "0"},
+		{"select decimal_mul('1.5', '-2')", "-3"},
+		{"select decimal_mul('0.1', '0.1')", "0.01"},
+		{"select decimal_cmp('1.10', '1.1')", int64(0)},
+		{"select decimal_cmp('-1', '0.5')", int64(-1)},
+		{"select decimal_cmp('1e2', '99.99')", int64(1)},
+		{"select decimal_add('1', 'x')", nil},
+		{"select decimal_mul(null, '1')", nil},
+	} {
+		var g interface{}
+		if err := db.QueryRow(v.sql).Scan(&g); err != nil {
+			t.Errorf("%s: %v", v.sql, err)
+			continue
+		}
+
+		if g != v.want {
+			t.Errorf("%s: got %v, want %v", v.sql, g, v.want)
+		}
+	}
+}
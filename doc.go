@@ -21,6 +21,7 @@
 //	------------------------------
 //	darwin	amd64   3.40.0
 //	darwin	arm64   3.40.0
+//	freebsd	386     3.40.0
 //	freebsd	amd64   3.40.0
 //	freebsd	arm64   3.40.0
 //	linux	386     3.40.0
@@ -29,9 +30,20 @@
 //	linux	arm64   3.40.0
 //	linux	ppc64le 3.40.0
 //	linux	riscv64 3.40.0
+//	linux	s390x   3.40.0
+//	netbsd	amd64   3.40.0
+//	openbsd	amd64   3.40.0
+//	openbsd	arm64   3.40.0
 //	windows	amd64   3.40.0
 //	windows	arm64   3.40.0
 //
+// Other targets need a port of modernc.org/libc, which the generated code
+// depends on, before their lib files can be generated. DragonFly BSD,
+// Solaris/illumos and the big endian linux/mips64 have no such port yet. This
+// applies to in-memory databases as well, for example on AIX or Plan 9: the
+// memdb VFS is part of the same generated library as the rest of SQLite, so
+// without a port the package does not build at all.
+//
 // Builders
 //
 // Builder results available at
@@ -182,6 +194,140 @@
 //
 //	...
 //
+// Shared cache
+//
+// Connections opened with the URI parameter cache=shared, for example
+//
+//	db, err := sql.Open("sqlite3", "file:demo.db?cache=shared")
+//
+// share a single page cache per database, see
+// https://www.sqlite.org/sharedcache.html. Access to the tables of a shared
+// cache is controlled by table level locks instead of file locks. A
+// statement, BEGIN or COMMIT finding a table locked by another connection
+// blocks until the lock is released, using sqlite3_unlock_notify, instead of
+// failing with SQLITE_LOCKED. The wait fails with SQLITE_LOCKED only if it
+// would deadlock, for example when two transactions wait for the tables
+// locked by each other. Readers can opt out of the table locks using
+// "_pragma=read_uncommitted(1)".
+//
+// Shared cache is mainly useful to share an in-memory database between the
+// connections of a database/sql pool, like
+//
+//	db, err := sql.Open("sqlite3", "file:demo?mode=memory&cache=shared")
+//
+// Note that such a database is deleted when its last connection is closed.
+//
+// SQL functions
+//
+// Besides the built-in SQL functions of SQLite, every connection provides
+//
+//	monotonic_now()
+//
+// which returns the number of seconds, with nanosecond resolution, elapsed
+// since an arbitrary fixed point in the past, measured using the monotonic
+// clock of the Go runtime. Unlike julianday('now') it is not affected by wall
+// clock adjustments, so the difference of two values is a reliable duration.
+//
+// The functions of the uuid, sha1, shathree and decimal extensions of the
+// SQLite source tree are provided as well, implemented in Go:
+//
+//	uuid(), uuid_str(X), uuid_blob(X)
+//	sha1(X), sha3(X[, SIZE])
+//	decimal(X), decimal_cmp(A, B), decimal_add(A, B), decimal_sub(A, B), decimal_mul(A, B)
+//
+// sha3_query, the decimal_sum aggregate and the decimal collation are not
+// available. See https://sqlite.org/src/dir/ext/misc for the documentation.
+//
+// soundex(X), enabled in C by SQLITE_SOUNDEX, and the spellfix1 virtual table
+// for approximate string matching, see https://www.sqlite.org/spellfix1.html,
+// are also provided:
+//
+//	create virtual table demo using spellfix1;
+//	insert into demo(word) select term from search_vocab;
+//	select word from demo where word match 'speling' and top=5;
+//
+// The candidates of a MATCH are the words with the same langid whose soundex
+// code shares the first scope characters, 3 by default, with the one of the
+// pattern. They are ranked by a plain edit distance, spellfix1_editdist(A, B),
+// instead of the configurable costs of the C version.
+// The FTS5 vocabulary, from a fts5vocab table, is a natural source of words.
+//
+// The carray table-valued function returns the elements of a Go slice bound
+// using CArray as rows, for example
+//
+//	db.Query("select * from t where id in carray(?)", sqlite.CArray([]int64{1, 2, 3}))
+//
+// The vec virtual table stores float32 vectors of a fixed dimension, for
+// example embeddings, and finds the k nearest neighbors of a vector by L2
+// (the default) or cosine distance:
+//
+//	create virtual table docs_vec using vec(dims=384, distance=cosine);
+//	insert into docs_vec(rowid, vector) values(?, ?);
+//	select rowid, distance from docs_vec where vector match ? and k = 10;
+//
+// Vectors are bound and scanned using Vector, or written as JSON arrays. A
+// query compares the vector against all rows of the table. The functions
+// vec_f32(X), vec_to_json(X), vec_distance_l2(A, B) and
+// vec_distance_cosine(A, B) convert vectors and compute distances.
+//
+// The sqlar_compress(X) and sqlar_uncompress(X, SZ) functions of SQLite
+// Archive files, see https://www.sqlite.org/sqlar.html, and the zipfile
+// table-valued function, which lists the entries of a ZIP archive given as a
+// file name or a blob, are provided as well:
+//
+//	select name, data from zipfile('archive.zip');
+//
+// zipfile is read-only, there is no zipfile() aggregate to write archives.
+// The modernc.org/sqlite/sqlar package creates and extracts SQLite Archives.
+//
+// The date and time functions of SQLite keep fractional seconds with
+// millisecond precision: '%f' of strftime formats them as SS.SSS and julianday
+// values round-trip to the millisecond, for example
+// strftime('%Y-%m-%d %H:%M:%f', julianday('2022-11-16 12:00:00.123')).
+// datetime() and time() omit them. Finer precision in SQL and the subsec
+// modifier of SQLite 3.42 are not provided, replacing the built-in date and
+// time functions by Go ones would subtly change their results. Time values
+// bound as parameters are written with nanosecond precision when the "sqlite"
+// _time_format is used, see Driver.Open, and are parsed back without loss.
+//
+// Memory
+//
+// SQLite allocates its memory using the malloc of modernc.org/libc, which
+// obtains it from the operating system on demand. There is no fixed size heap
+// to configure. In particular the library is not built with MEMSYS5 or any
+// other arena of SQLite, which is sized before the first connection is opened
+// and fails allocations once it is full, so no reserve has to be provisioned
+// up front, and the heap grows as long as the operating system provides
+// memory. To bound the memory used by SQLite, for example on small devices,
+// use HardHeapLimit and SoftHeapLimit. MemoryUsed and MemoryHighwater report
+// the current and peak usage.
+//
+// Binary size
+//
+// Importing the package adds about 10MB to a linux/amd64 binary, of which
+// about a third is symbol and debug information removed by
+//
+//	$ go build -ldflags="-s -w"
+//
+// Most of the rest is the generated library, which the linker cannot trim:
+// like in C, the built-in functions, virtual tables and extensions of SQLite
+// are reachable from tables initialized when the package is loaded, whether
+// a program uses them or not. Omitting them needs a library generated with
+// the corresponding SQLITE_OMIT_* options, see below.
+//
+// Build time
+//
+// Compiling the generated library from scratch takes tens of seconds. Go
+// compiles a package as a single unit however it is split into files, and
+// already compiles its functions in parallel, so splitting the generated file
+// would not make it faster. The result is kept in the Go build cache, so
+// builds are only slow when the cache is cold. For CI, persist the directory
+// reported by
+//
+//	$ go env GOCACHE
+//
+// between runs.
+//
 // Debug and development versions
 //
 // A comma separated list of options can be passed to `go generate` via the
@@ -197,6 +343,29 @@
 //
 // Note: To run `go generate` you need to have modernc.org/ccgo/v3 installed.
 //
+// The lib files shipped with the package are generated without these options,
+// so the assertions of SQLite are compiled out. A debug version replaces them,
+// there is no build tag selecting between the two.
+//
+// Features of SQLite depending on compile time options the library was not
+// generated with are not available, "pragma compile_options" lists the
+// options used. For example the batch atomic write path, which lets commits
+// on F2FS file systems skip the rollback journal, needs a version generated
+// with
+//
+//	$ GO_GENERATE=-DSQLITE_ENABLE_BATCH_ATOMIC_WRITE go generate
+//
+// whose unix VFS then detects the atomic write support of the file system on
+// Linux and reports it as SQLITE_IOCAP_BATCH_ATOMIC.
+//
+// The lib files are generated from the amalgamation of a SQLite release only.
+// The experimental begin-concurrent and wal2 branches of SQLite, providing
+// BEGIN CONCURRENT transactions with page level conflict detection and a WAL
+// of two alternating files, are not available. Such a variant would need a
+// complete second set of generated lib files for all supported targets,
+// selected by a build tag; BEGIN CONCURRENT fails with a syntax error and
+// "pragma journal_mode=wal2" leaves the journal mode unchanged.
+//
 // Sqlite documentation
 //
 // See https://sqlite.org/docs.html
@@ -0,0 +1,289 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package docstore uses SQLite as an embedded document database. A
+// collection stores JSON documents by their string IDs in a table with the
+// columns id and doc. Documents are selected by filters on the values at JSON
+// paths, evaluated by the JSON functions of SQLite, see
+// https://www.sqlite.org/json1.html. A path can be indexed, which adds a
+// virtual generated column holding the value at the path to the table and
+// an index on that column, used by the filters and ordering on the path.
+//
+// A JSON path is written as in SQLite, for example "$.name" or
+// "$.tags[0]", the leading "$." may be omitted.
+package docstore // import "modernc.org/sqlite/docstore"
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"modernc.org/sqlite/schema"
+)
+
+// ErrNotFound is returned by Get for an ID not in the collection.
+var ErrNotFound = errors.New("docstore: document not found")
+
+// Collection is a collection of JSON documents stored in a table.
+type Collection struct {
+	db    *sql.DB
+	name  string
+	table string // Quoted name.
+
+	mu      sync.RWMutex
+	indexed map[string]string // Path: quoted generated column.
+}
+
+// Open returns the collection stored in the table name of db, creating the
+// table if it does not exist.
+func Open(ctx context.Context, db *sql.DB, name string) (*Collection, error) {
+	c := &Collection{db: db, name: name, table: quoteIdentifier(name), indexed: map[string]string{}}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("create table if not exists %s(id text primary key, doc text not null check(json_valid(doc)))", c.table)); err != nil {
+		return nil, err
+	}
+
+	cols, err := schema.Columns(ctx, db, "main", name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range cols {
+		if v.Hidden == 2 && strings.HasPrefix(v.Name, "$") {
+			c.indexed[v.Name] = quoteIdentifier(v.Name)
+		}
+	}
+	return c, nil
+}
+
+// Name returns the name of the table of c.
+func (c *Collection) Name() string { return c.name }
+
+// Put stores doc, marshaled by encoding/json, as the document id, replacing
+// the document of that ID if it exists.
+func (c *Collection) Put(ctx context.Context, id string, doc interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db.ExecContext(ctx, fmt.Sprintf("insert into %s(id, doc) values(?, ?) on conflict(id) do update set doc = excluded.doc", c.table), id, string(b))
+	return err
+}
+
+// Get unmarshals the document id into dest. It returns ErrNotFound if the
+// document does not exist.
+func (c *Collection) Get(ctx context.Context, id string, dest interface{}) error {
+	var doc string
+	switch err := c.db.QueryRowContext(ctx, fmt.Sprintf("select doc from %s where id = ?", c.table), id).Scan(&doc); {
+	case err == sql.ErrNoRows:
+		return ErrNotFound
+	case err != nil:
+		return err
+	}
+
+	return json.Unmarshal([]byte(doc), dest)
+}
+
+// Delete removes the document id. It reports whether the document existed.
+func (c *Collection) Delete(ctx context.Context, id string) (bool, error) {
+	r, err := c.db.ExecContext(ctx, fmt.Sprintf("delete from %s where id = ?", c.table), id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := r.RowsAffected()
+	return n != 0, err
+}
+
+// Index makes filters and ordering on path use an index. It adds the virtual
+// generated column named path to the table and an index on it. Index does
+// nothing if path is indexed already.
+func (c *Collection) Index(ctx context.Context, path string) error {
+	path = normalizePath(path)
+	c.mu.Lock()
+
+	defer c.mu.Unlock()
+
+	if _, ok := c.indexed[path]; ok {
+		return nil
+	}
+
+	// The path is part of the column definition, it cannot be a parameter.
+	var valid sql.NullString
+	if err := c.db.QueryRowContext(ctx, "select json_extract('{}', ?)", path).Scan(&valid); err != nil {
+		return fmt.Errorf("docstore: invalid path %q: %v", path, err)
+	}
+
+	col := quoteIdentifier(path)
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("alter table %s add column %s as (json_extract(doc, %s))", c.table, col, quoteString(path))); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("create index %s on %s(%s)", quoteIdentifier(c.name+path), c.table, col)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	c.indexed[path] = col
+	return nil
+}
+
+// Filter selects the documents whose value at Path compares to Value by Op,
+// one of "=", "!=", "<", "<=", ">", ">=", "like" and "glob". JSON true and
+// false compare as 1 and 0, a JSON null or a missing value never satisfies a
+// filter.
+type Filter struct {
+	Path  string
+	Op    string
+	Value interface{}
+}
+
+// Where returns a Filter.
+func Where(path, op string, value interface{}) Filter {
+	return Filter{Path: path, Op: op, Value: value}
+}
+
+var ops = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "like": true, "glob": true}
+
+// Query selects documents.
+type Query struct {
+	Filters []Filter // All must be satisfied.
+	OrderBy string   // The path of the sort key, by ID if empty.
+	Desc    bool     // Descending order.
+	Limit   int      // Maximum number of documents, 0 is no limit.
+}
+
+// Query returns the documents selected by q.
+func (c *Collection) Query(ctx context.Context, q Query) (*Iter, error) {
+	var b strings.Builder
+	var args []interface{}
+	fmt.Fprintf(&b, "select id, doc from %s", c.table)
+	for i, v := range q.Filters {
+		op := strings.ToLower(v.Op)
+		if !ops[op] {
+			return nil, fmt.Errorf("docstore: invalid operator %q", v.Op)
+		}
+
+		if i == 0 {
+			b.WriteString(" where ")
+		} else {
+			b.WriteString(" and ")
+		}
+		args = c.value(&b, args, v.Path)
+		fmt.Fprintf(&b, " %s ?", op)
+		args = append(args, v.Value)
+	}
+	desc := ""
+	if q.Desc {
+		desc = " desc"
+	}
+	b.WriteString(" order by ")
+	if q.OrderBy != "" {
+		// Ties are ordered by ID.
+		args = c.value(&b, args, q.OrderBy)
+		b.WriteString(desc + ", ")
+	}
+	b.WriteString("id" + desc)
+	if q.Limit > 0 {
+		b.WriteString(" limit ?")
+		args = append(args, q.Limit)
+	}
+
+	rows, err := c.db.QueryContext(ctx, b.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Iter{rows: rows}, nil
+}
+
+// value writes the expression of the value at path to b.
+func (c *Collection) value(b *strings.Builder, args []interface{}, path string) []interface{} {
+	path = normalizePath(path)
+	c.mu.RLock()
+	col, ok := c.indexed[path]
+	c.mu.RUnlock()
+	if ok {
+		b.WriteString(col)
+		return args
+	}
+
+	b.WriteString("json_extract(doc, ?)")
+	return append(args, path)
+}
+
+// Iter iterates over the documents returned by Query.
+type Iter struct {
+	rows *sql.Rows
+	id   string
+	doc  string
+	err  error
+}
+
+// Next advances to the next document. It returns false when there are no
+// more documents or on error, see Err.
+func (it *Iter) Next() bool {
+	if !it.rows.Next() {
+		return false
+	}
+
+	if it.err = it.rows.Scan(&it.id, &it.doc); it.err != nil {
+		it.rows.Close()
+		return false
+	}
+
+	return true
+}
+
+// ID returns the ID of the current document.
+func (it *Iter) ID() string { return it.id }
+
+// Decode unmarshals the current document into dest.
+func (it *Iter) Decode(dest interface{}) error { return json.Unmarshal([]byte(it.doc), dest) }
+
+// Err returns the error, if any, that stopped the iteration.
+func (it *Iter) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+
+	return it.rows.Err()
+}
+
+// Close releases the resources of it. It is safe to call Close more than
+// once.
+func (it *Iter) Close() error { return it.rows.Close() }
+
+// normalizePath prefixes path with "$." if it does not start with "$".
+func normalizePath(path string) string {
+	if strings.HasPrefix(path, "$") {
+		return path
+	}
+
+	return "$." + path
+}
+
+// quoteIdentifier returns s quoted as an SQL identifier.
+func quoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// quoteString returns s quoted as an SQL string literal.
+func quoteString(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
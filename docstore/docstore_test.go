@@ -0,0 +1,156 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docstore_test // import "modernc.org/sqlite/docstore"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+	"modernc.org/sqlite/docstore"
+)
+
+type person struct {
+	Name    string `json:"name"`
+	Age     int    `json:"age"`
+	Address struct {
+		City string `json:"city"`
+	} `json:"address"`
+	Tags []string `json:"tags"`
+}
+
+func TestCollection(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	ctx := context.Background()
+	c, err := docstore.Open(ctx, db, "people")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		var p person
+		p.Name = fmt.Sprintf("p%d", i)
+		p.Age = 20 + i
+		p.Address.City = []string{"Prague", "Oslo"}[i%2]
+		p.Tags = []string{fmt.Sprint(i % 3)}
+		if err := c.Put(ctx, p.Name, &p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var p person
+	if err := c.Get(ctx, "p3", &p); err != nil || p.Age != 23 || p.Address.City != "Oslo" {
+		t.Fatalf("%+v, %v", p, err)
+	}
+
+	if err := c.Get(ctx, "nobody", &p); err != docstore.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	query := func(q docstore.Query) (ids []string) {
+		t.Helper()
+		it, err := c.Query(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer it.Close()
+
+		for it.Next() {
+			var p person
+			if err := it.Decode(&p); err != nil || p.Name != it.ID() {
+				t.Fatalf("%+v, %v", p, err)
+			}
+
+			ids = append(ids, it.ID())
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		return ids
+	}
+
+	q := docstore.Query{
+		Filters: []docstore.Filter{docstore.Where("address.city", "=", "Oslo"), docstore.Where("$.age", "<", 27)},
+		OrderBy: "age",
+		Desc:    true,
+	}
+	if g, e := strings.Join(query(q), " "), "p5 p3 p1"; g != e {
+		t.Fatalf("got %q, want %q", g, e)
+	}
+
+	if err := c.Index(ctx, "address.city"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Index(ctx, "$.address.city"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Index(ctx, "$.["); err == nil {
+		t.Fatal("unexpected success indexing an invalid path")
+	}
+
+	// A reopened collection uses the existing index.
+	if c, err = docstore.Open(ctx, db, "people"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := strings.Join(query(q), " "), "p5 p3 p1"; g != e {
+		t.Fatalf("got %q, want %q", g, e)
+	}
+
+	rows, err := db.Query(`explain query plan select id from people where "$.address.city" = 'Oslo'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			t.Fatal(err)
+		}
+
+		plan = append(plan, detail)
+	}
+	rows.Close()
+	if s := strings.Join(plan, "\n"); !strings.Contains(s, "USING INDEX") {
+		t.Fatalf("query plan %q", s)
+	}
+
+	q = docstore.Query{Filters: []docstore.Filter{docstore.Where("tags[0]", "=", "0")}, Limit: 3}
+	if g, e := strings.Join(query(q), " "), "p0 p3 p6"; g != e {
+		t.Fatalf("got %q, want %q", g, e)
+	}
+
+	if ok, err := c.Delete(ctx, "p0"); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+
+	if ok, err := c.Delete(ctx, "p0"); ok || err != nil {
+		t.Fatal(ok, err)
+	}
+
+	if g, e := strings.Join(query(q), " "), "p3 p6 p9"; g != e {
+		t.Fatalf("got %q, want %q", g, e)
+	}
+
+	if _, err := c.Query(ctx, docstore.Query{Filters: []docstore.Filter{docstore.Where("age", "; drop", 1)}}); err == nil {
+		t.Fatal("unexpected success with an invalid operator")
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Advice is a recommendation produced by Doctor.
+type Advice struct {
+	Check   string // Name of the check, for example "journal_mode".
+	Current string // The setting found.
+	Message string // What to change and why.
+}
+
+// String implements fmt.Stringer.
+func (a Advice) String() string {
+	if a.Current == "" {
+		return fmt.Sprintf("%s: %s", a.Check, a.Message)
+	}
+
+	return fmt.Sprintf("%s (%s): %s", a.Check, a.Current, a.Message)
+}
+
+// Doctor inspects the settings of the main database of db and of the
+// database/sql connection pool of db and returns recommendations for the
+// settings found to be inappropriate for typical use. The settings are
+// inspected on a single connection of db, settings made differently on other
+// connections are not noticed. An empty result means no problems were found.
+//
+// The checks currently include the journal mode, the synchronous setting, the
+// page and cache sizes, the busy timeout, the size of the connection pool
+// relative to the journal mode and foreign key columns not covered by an
+// index.
+func Doctor(db *sql.DB) (r []Advice, err error) {
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.Close()
+
+	var file, journalMode string
+	var synchronous, pageSize, cacheSize, busyTimeout, pageCount int64
+	for _, v := range []struct {
+		q    string
+		dest interface{}
+	}{
+		{"select file from pragma_database_list where name = 'main'", &file},
+		{"pragma journal_mode", &journalMode},
+		{"pragma synchronous", &synchronous},
+		{"pragma page_size", &pageSize},
+		{"pragma cache_size", &cacheSize},
+		{"pragma busy_timeout", &busyTimeout},
+		{"pragma page_count", &pageCount},
+	} {
+		if err := c.QueryRowContext(ctx, v.q).Scan(v.dest); err != nil {
+			return nil, fmt.Errorf("sqlite: Doctor: %s: %v", v.q, err)
+		}
+	}
+
+	journalMode = strings.ToLower(journalMode)
+	onDisk := file != ""
+	wal := journalMode == "wal"
+	if onDisk && !wal {
+		r = append(r, Advice{"journal_mode", journalMode, "use WAL mode, _pragma=journal_mode(wal), to let readers run concurrently with a writer"})
+	}
+
+	switch {
+	case synchronous == 0 && onDisk:
+		r = append(r, Advice{"synchronous", "off", "a power loss or OS crash can corrupt the database, use NORMAL or FULL"})
+	case synchronous >= 2 && wal:
+		r = append(r, Advice{"synchronous", synchronousNames[synchronous], "NORMAL is safe from corruption in WAL mode and avoids a sync per commit"})
+	}
+
+	if pageSize < 4096 {
+		r = append(r, Advice{"page_size", fmt.Sprint(pageSize), "use at least 4096 bytes, the change takes effect on VACUUM or for a new database"})
+	}
+
+	// Databases opened by the driver use the compiled default unless told
+	// otherwise, it is not worth a warning.
+	if cache := cacheBytes(cacheSize, pageSize); cache < cacheBytes(sqlite3.SQLITE_DEFAULT_CACHE_SIZE, pageSize) && cache < pageCount*pageSize {
+		r = append(r, Advice{"cache_size", fmt.Sprint(cacheSize), fmt.Sprintf("the page cache is smaller than the default, cache_size(%d), and than the database, a larger cache_size avoids repeated reads", sqlite3.SQLITE_DEFAULT_CACHE_SIZE)})
+	}
+
+	maxOpen := db.Stats().MaxOpenConnections
+	switch {
+	case !onDisk:
+		// Nothing to contend for.
+	case !wal && maxOpen != 1:
+		r = append(r, Advice{"pool", poolSize(maxOpen), "readers and writers on concurrent connections fail with SQLITE_BUSY in rollback journal mode, use SetMaxOpenConns(1), _serialize_writes or OpenPool"})
+	case maxOpen != 1 && busyTimeout == 0:
+		r = append(r, Advice{"busy_timeout", "0", "concurrent writers fail with SQLITE_BUSY at once, set _pragma=busy_timeout(5000) or use _serialize_writes"})
+	}
+
+	fk, err := unindexedForeignKeys(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(r, fk...), nil
+}
+
+// cacheBytes returns the size of the page cache set by cache_size(n).
+func cacheBytes(n, pageSize int64) int64 {
+	if n < 0 {
+		return -n << 10
+	}
+
+	return n * pageSize
+}
+
+var synchronousNames = map[int64]string{0: "off", 1: "normal", 2: "full", 3: "extra"}
+
+func poolSize(n int) string {
+	if n == 0 {
+		return "unlimited connections"
+	}
+
+	return fmt.Sprintf("%d connections", n)
+}
+
+// unindexedForeignKeys reports the foreign keys whose child columns are not
+// the leading columns of an index, which makes every update or delete of the
+// parent table scan the child table.
+func unindexedForeignKeys(ctx context.Context, c *sql.Conn) (r []Advice, err error) {
+	tables, err := queryStrings(ctx, c, "select name from sqlite_master where type = 'table' and name not like 'sqlite_%' order by name")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, table := range tables {
+		keys, err := foreignKeys(ctx, c, table)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(keys) == 0 {
+			continue
+		}
+
+		indexes, err := indexPrefixes(ctx, c, table)
+		if err != nil {
+			return nil, err
+		}
+
+	keys:
+		for _, key := range keys {
+			for _, index := range indexes {
+				if covers(index, key.columns) {
+					continue keys
+				}
+			}
+
+			r = append(r, Advice{
+				"foreign_key",
+				fmt.Sprintf("%s(%s) references %s", table, strings.Join(key.columns, ", "), key.parent),
+				fmt.Sprintf("create an index on %s(%s)", table, strings.Join(key.columns, ", ")),
+			})
+		}
+	}
+	return r, nil
+}
+
+type foreignKey struct {
+	parent  string
+	columns []string
+}
+
+func foreignKeys(ctx context.Context, c *sql.Conn, table string) (r []foreignKey, err error) {
+	rows, err := c.QueryContext(ctx, `select id, "table", "from" from pragma_foreign_key_list(?) order by id, seq`, table)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	last := int64(-1)
+	for rows.Next() {
+		var id int64
+		var parent, column string
+		if err := rows.Scan(&id, &parent, &column); err != nil {
+			return nil, err
+		}
+
+		if id != last {
+			r = append(r, foreignKey{parent: parent})
+			last = id
+		}
+		r[len(r)-1].columns = append(r[len(r)-1].columns, column)
+	}
+	return r, rows.Err()
+}
+
+// indexPrefixes returns the columns of the indexes of table, including the
+// rowid alias if any.
+func indexPrefixes(ctx context.Context, c *sql.Conn, table string) (r [][]string, err error) {
+	names, err := queryStrings(ctx, c, "select name from pragma_index_list(?)", table)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		columns, err := queryStrings(ctx, c, "select ifnull(name, '') from pragma_index_info(?) order by seqno", name)
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, columns)
+	}
+
+	pk, err := queryStrings(ctx, c, "select name from pragma_table_info(?) where pk = 1 and lower(type) = 'integer' and (select count(*) from pragma_table_info(?) where pk != 0) = 1", table, table)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pk) != 0 {
+		r = append(r, pk)
+	}
+	return r, nil
+}
+
+// covers reports whether the leading columns of index are columns, in any
+// order.
+func covers(index, columns []string) bool {
+	if len(index) < len(columns) {
+		return false
+	}
+
+	m := map[string]bool{}
+	for _, v := range index[:len(columns)] {
+		m[strings.ToLower(v)] = true
+	}
+	for _, v := range columns {
+		if !m[strings.ToLower(v)] {
+			return false
+		}
+	}
+	return true
+}
+
+func queryStrings(ctx context.Context, c *sql.Conn, q string, args ...interface{}) (r []string, err error) {
+	rows, err := c.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+
+		r = append(r, s)
+	}
+	return r, rows.Err()
+}
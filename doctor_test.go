@@ -0,0 +1,77 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func doctorChecks(t *testing.T, db *sql.DB) (r []string) {
+	advice, err := Doctor(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range advice {
+		r = append(r, v.Check)
+	}
+	return r
+}
+
+func TestDoctor(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open(driverName, filepath.Join(dir, "test.db")+"?_pragma=journal_mode(wal)&_pragma=synchronous(normal)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	// A database larger than the default page cache.
+	if _, err := db.Exec(`
+create table p(i integer primary key);
+create table c(i, p references p);
+create index c_p on c(p);
+create table b(x);
+with recursive n(i) as (select 1 union all select i+1 from n where i < 1000) insert into b select randomblob(4096) from n;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := doctorChecks(t, db); len(g) != 0 {
+		t.Fatalf("unexpected advice %v", g)
+	}
+
+	db.Close()
+	bad, err := sql.Open(driverName, filepath.Join(dir, "test.db")+"?_pragma=journal_mode(delete)&_pragma=cache_size(100)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer bad.Close()
+
+	if _, err := bad.Exec("create table c2(i, p references p)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := doctorChecks(t, bad), []string{"journal_mode", "cache_size", "pool", "foreign_key"}; !equalStrings(g, e) {
+		t.Fatalf("got %v, want %v", g, e)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
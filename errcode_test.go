@@ -0,0 +1,114 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"modernc.org/sqlite/sqlitecode"
+)
+
+// TestExtendedCodes checks constraint violations report the extended result
+// code of the constraint.
+func TestExtendedCodes(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+pragma foreign_keys = on;
+create table p(id int primary key, u unique, n not null, c check (c > 0));
+create table r(p references p(id));
+insert into p values(1, 1, 1, 1);
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		sql  string
+		code int
+	}{
+		{"insert into p values(1, 2, 1, 1)", sqlitecode.ConstraintPrimaryKey},
+		{"insert into p values(2, 1, 1, 1)", sqlitecode.ConstraintUnique},
+		{"insert into p values(2, 2, null, 1)", sqlitecode.ConstraintNotNull},
+		{"insert into p values(2, 2, 1, 0)", sqlitecode.ConstraintCheck},
+		{"insert into r values(3)", sqlitecode.ConstraintForeignKey},
+		{"select * from nosuchtable", sqlitecode.Error},
+	} {
+		_, err := db.Exec(v.sql)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: %v, want *Error", v.sql, err)
+			continue
+		}
+
+		if g := e.Code(); g != v.code {
+			t.Errorf("%s: code %s (%d), want %s (%d)", v.sql, sqlitecode.Name(g), g, sqlitecode.Name(v.code), v.code)
+		}
+
+		if sqlitecode.Primary(e.Code()) != sqlitecode.Primary(v.code) {
+			t.Errorf("%s: primary code %d", v.sql, sqlitecode.Primary(e.Code()))
+		}
+
+		if ErrorCodeString[e.Code()] == "" {
+			t.Errorf("%s: no ErrorCodeString for %d", v.sql, e.Code())
+		}
+	}
+
+	if g, e := sqlitecode.Name(sqlitecode.IOErrShortRead), "SQLITE_IOERR_SHORT_READ"; g != e {
+		t.Errorf("Name %q, want %q", g, e)
+	}
+
+	if g := sqlitecode.Primary(sqlitecode.BusySnapshot); g != sqlitecode.Busy {
+		t.Errorf("Primary %d, want %d", g, sqlitecode.Busy)
+	}
+}
+
+func TestConstraintDetails(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+pragma foreign_keys = on;
+create table p(id text primary key, u unique, a, b, e, n not null, c constraint positive check (c > 0), d check (d < 10));
+create unique index pab on p(a, b);
+create unique index pe on p(lower(e));
+create table q(id integer primary key, p references p(id));
+insert into p values('x', 1, 1, 1, 'e', 1, 1, 1);
+insert into q values(1, 'x');
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		sql  string
+		want *Constraint
+	}{
+		{"insert into p values('x', 2, 2, 2, 'f', 1, 1, 1)", &Constraint{Table: "p", Columns: []string{"id"}, Index: "sqlite_autoindex_p_1"}},
+		{"insert into p values('y', 1, 2, 2, 'f', 1, 1, 1)", &Constraint{Table: "p", Columns: []string{"u"}, Index: "sqlite_autoindex_p_2"}},
+		{"insert into p values('y', 2, 1, 1, 'f', 1, 1, 1)", &Constraint{Table: "p", Columns: []string{"a", "b"}, Index: "pab"}},
+		{"insert into p values('y', 2, 2, 2, 'E', 1, 1, 1)", &Constraint{Index: "pe"}},
+		{"insert into p values('y', 2, 2, 2, 'f', null, 1, 1)", &Constraint{Table: "p", Columns: []string{"n"}}},
+		{"insert into p values('y', 2, 2, 2, 'f', 1, 0, 1)", &Constraint{Check: "positive"}},
+		{"insert into p values('y', 2, 2, 2, 'f', 1, 1, 10)", &Constraint{Check: "d < 10"}},
+		{"insert into q values(1, 'x')", &Constraint{Table: "q", Columns: []string{"id"}}},
+		{"insert into q values(2, 'y')", &Constraint{}},
+		{"select * from nosuchtable", nil},
+	} {
+		_, err := db.Exec(v.sql)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: %v, want *Error", v.sql, err)
+			continue
+		}
+
+		if g := e.Constraint(); !reflect.DeepEqual(g, v.want) {
+			t.Errorf("%s: %v\ngot  %+v\nwant %+v", v.sql, err, g, v.want)
+		}
+	}
+}
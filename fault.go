@@ -0,0 +1,496 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"modernc.org/libc"
+	"modernc.org/libc/sys/types"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// FaultKind is the kind of a fault injected by a FaultVFS.
+type FaultKind int
+
+// Values of FaultKind.
+const (
+	// FaultIOError makes the operation fail with an I/O error without
+	// performing it. Later operations succeed.
+	FaultIOError FaultKind = iota + 1
+	// FaultPowerLoss simulates a power loss right before the operation:
+	// everything written to the files of the VFS since their last sync is
+	// lost and every further operation on the files open at that moment
+	// fails, as if the process had died, until Reset.
+	FaultPowerLoss
+	// FaultTornWrite is FaultPowerLoss during a write, where only the first
+	// half of the written data, rounded down to a multiple of 512 bytes,
+	// reaches the file.
+	FaultTornWrite
+)
+
+// FaultOp selects the operations a fault applies to.
+type FaultOp int
+
+// Values of FaultOp.
+const (
+	FaultAnyOp FaultOp = iota
+	FaultRead
+	FaultWrite
+	FaultSync
+	FaultTruncate
+)
+
+// FaultFile selects the files a fault applies to.
+type FaultFile int
+
+// Values of FaultFile.
+const (
+	FaultAnyFile FaultFile = iota
+	FaultMainDB            // Main database files.
+	FaultJournal           // Rollback journals.
+	FaultWAL               // Write-ahead logs.
+)
+
+// Fault describes a fault to inject, see FaultVFS.Inject.
+type Fault struct {
+	Kind  FaultKind
+	Op    FaultOp
+	File  FaultFile
+	After int // Number of matching operations to perform before the fault.
+}
+
+// String implements fmt.Stringer.
+func (f Fault) String() string {
+	kind := map[FaultKind]string{FaultIOError: "I/O error", FaultPowerLoss: "power loss", FaultTornWrite: "torn write"}[f.Kind]
+	op := map[FaultOp]string{FaultAnyOp: "operation", FaultRead: "read", FaultWrite: "write", FaultSync: "sync", FaultTruncate: "truncate"}[f.Op]
+	file := map[FaultFile]string{FaultAnyFile: "any file", FaultMainDB: "the database", FaultJournal: "the journal", FaultWAL: "the WAL"}[f.File]
+	return fmt.Sprintf("%s at %s %d of %s", kind, op, f.After+1, file)
+}
+
+// FaultVFS is a VFS injecting faults into the I/O of the files it opens, see
+// RegisterFaultVFS.
+type FaultVFS struct {
+	name string
+
+	mu        sync.Mutex
+	fault     *Fault
+	count     int
+	triggered bool
+	crashed   bool
+	files     map[*faultHooks]struct{}
+}
+
+// RegisterFaultVFS registers a VFS named name which forwards to the VFS named
+// parent, or to the default VFS if parent is empty, and injects the faults
+// set by Inject. It is meant for testing how an application and its settings,
+// like the journal mode and the synchronous pragma, cope with I/O errors and
+// crashes, see CrashCheck.
+//
+// Power loss is simulated by undoing, when the fault is injected, all the
+// writes and truncations not followed by a sync of their file. Files created,
+// deleted or renamed are not undone, neither is the content of the -shm file
+// of a database in WAL mode, which SQLite rebuilds when the database is next
+// opened.
+func RegisterFaultVFS(name, parent string) (*FaultVFS, error) {
+	v := &FaultVFS{name: name, files: map[*faultHooks]struct{}{}}
+	if _, err := registerShimVFS(name, parent, v.open); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// Name returns the name of the VFS.
+func (v *FaultVFS) Name() string { return v.name }
+
+// Inject arms f. Only one fault is armed at a time, Inject replaces a fault
+// not yet injected.
+func (v *FaultVFS) Inject(f Fault) {
+	v.mu.Lock()
+
+	defer v.mu.Unlock()
+
+	v.fault = &f
+	v.count = 0
+	v.triggered = false
+}
+
+// Triggered reports whether the fault set by Inject was injected.
+func (v *FaultVFS) Triggered() bool {
+	v.mu.Lock()
+
+	defer v.mu.Unlock()
+
+	return v.triggered
+}
+
+// Reset disarms the fault and ends a simulated power loss. Close all the
+// connections using the VFS before calling Reset after a power loss.
+func (v *FaultVFS) Reset() {
+	v.mu.Lock()
+
+	defer v.mu.Unlock()
+
+	v.fault = nil
+	v.count = 0
+	v.triggered = false
+	v.crashed = false
+}
+
+func (v *FaultVFS) open(tls *libc.TLS, f *shimFile) (fileHooks, error) {
+	v.mu.Lock()
+
+	defer v.mu.Unlock()
+
+	if v.crashed {
+		return nil, fmt.Errorf("simulated power loss")
+	}
+
+	h := &faultHooks{vfs: v, f: f, synced: -1}
+	v.files[h] = struct{}{}
+	return h, nil
+}
+
+// inject reports whether a fault is to be injected into the operation op of
+// f and of what kind. It must be called with v.mu held.
+func (v *FaultVFS) inject(f *shimFile, op FaultOp) FaultKind {
+	ft := v.fault
+	if ft == nil || v.triggered {
+		return 0
+	}
+
+	if ft.Op != FaultAnyOp && ft.Op != op || ft.Kind == FaultTornWrite && op != FaultWrite {
+		return 0
+	}
+
+	switch ft.File {
+	case FaultMainDB:
+		if !f.isMainDB() {
+			return 0
+		}
+	case FaultJournal:
+		if f.flags&sqlite3.SQLITE_OPEN_MAIN_JOURNAL == 0 {
+			return 0
+		}
+	case FaultWAL:
+		if !f.isWAL() {
+			return 0
+		}
+	}
+
+	if v.count++; v.count <= ft.After {
+		return 0
+	}
+
+	v.triggered = true
+	return ft.Kind
+}
+
+// powerLoss undoes the unsynced modifications of all open files. It must be
+// called with v.mu held.
+func (v *FaultVFS) powerLoss(tls *libc.TLS) {
+	for h := range v.files {
+		h.revert(tls)
+	}
+	v.crashed = true
+}
+
+type faultUndo struct {
+	off  int64
+	data []byte
+}
+
+type faultHooks struct {
+	passThrough
+	vfs    *FaultVFS
+	f      *shimFile
+	undo   []faultUndo
+	synced int64 // File size at the last sync, -1 if not modified since.
+}
+
+// check is called, with v.mu held, before every operation op of f and
+// returns a non zero result code if the operation must fail.
+func (h *faultHooks) check(tls *libc.TLS, f *shimFile, op FaultOp, rc int32) int32 {
+	v := h.vfs
+	if v.crashed {
+		return rc
+	}
+
+	switch v.inject(f, op) {
+	case FaultIOError:
+		return rc
+	case FaultPowerLoss:
+		v.powerLoss(tls)
+		return rc
+	}
+	return sqlite3.SQLITE_OK
+}
+
+func (h *faultHooks) close(tls *libc.TLS, f *shimFile) int32 {
+	h.vfs.mu.Lock()
+	delete(h.vfs.files, h)
+	h.vfs.mu.Unlock()
+	return h.passThrough.close(tls, f)
+}
+
+func (h *faultHooks) read(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32 {
+	h.vfs.mu.Lock()
+	rc := h.check(tls, f, FaultRead, sqlite3.SQLITE_IOERR_READ)
+	h.vfs.mu.Unlock()
+	if rc != sqlite3.SQLITE_OK {
+		return rc
+	}
+
+	return h.passThrough.read(tls, f, p, n, off)
+}
+
+func (h *faultHooks) write(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32 {
+	v := h.vfs
+	v.mu.Lock()
+
+	defer v.mu.Unlock()
+
+	if v.crashed {
+		return sqlite3.SQLITE_IOERR_WRITE
+	}
+
+	switch v.inject(f, FaultWrite) {
+	case FaultIOError:
+		return sqlite3.SQLITE_IOERR_WRITE
+	case FaultPowerLoss:
+		v.powerLoss(tls)
+		return sqlite3.SQLITE_IOERR_WRITE
+	case FaultTornWrite:
+		v.powerLoss(tls)
+		torn := (n / 2) &^ 511
+		if torn == 0 {
+			torn = n / 2
+		}
+		if torn != 0 {
+			h.passThrough.write(tls, f, p, torn, off)
+		}
+		return sqlite3.SQLITE_IOERR_WRITE
+	}
+
+	if err := h.save(tls, f, off, int64(n)); err != sqlite3.SQLITE_OK {
+		return err
+	}
+
+	return h.passThrough.write(tls, f, p, n, off)
+}
+
+func (h *faultHooks) truncate(tls *libc.TLS, f *shimFile, size int64) int32 {
+	v := h.vfs
+	v.mu.Lock()
+
+	defer v.mu.Unlock()
+
+	if rc := h.check(tls, f, FaultTruncate, sqlite3.SQLITE_IOERR_TRUNCATE); rc != sqlite3.SQLITE_OK {
+		return rc
+	}
+
+	cur, rc := h.size(tls, f)
+	if rc != sqlite3.SQLITE_OK {
+		return rc
+	}
+
+	if size < cur {
+		if rc := h.save(tls, f, size, cur-size); rc != sqlite3.SQLITE_OK {
+			return rc
+		}
+	}
+	return h.passThrough.truncate(tls, f, size)
+}
+
+func (h *faultHooks) sync(tls *libc.TLS, f *shimFile, flags int32) int32 {
+	v := h.vfs
+	v.mu.Lock()
+
+	defer v.mu.Unlock()
+
+	if rc := h.check(tls, f, FaultSync, sqlite3.SQLITE_IOERR_FSYNC); rc != sqlite3.SQLITE_OK {
+		return rc
+	}
+
+	rc := h.passThrough.sync(tls, f, flags)
+	if rc == sqlite3.SQLITE_OK {
+		h.undo = nil
+		h.synced = -1
+	}
+	return rc
+}
+
+func (h *faultHooks) fileSize(tls *libc.TLS, f *shimFile, pSize uintptr) int32 {
+	h.vfs.mu.Lock()
+	crashed := h.vfs.crashed
+	h.vfs.mu.Unlock()
+	if crashed {
+		return sqlite3.SQLITE_IOERR_FSTAT
+	}
+
+	return h.passThrough.fileSize(tls, f, pSize)
+}
+
+func (h *faultHooks) lock(tls *libc.TLS, f *shimFile, lock int32) int32 {
+	h.vfs.mu.Lock()
+	crashed := h.vfs.crashed
+	h.vfs.mu.Unlock()
+	if crashed {
+		return sqlite3.SQLITE_IOERR_LOCK
+	}
+
+	return h.passThrough.lock(tls, f, lock)
+}
+
+func (h *faultHooks) size(tls *libc.TLS, f *shimFile) (int64, int32) {
+	p := libc.Xmalloc(tls, 8)
+	if p == 0 {
+		return 0, sqlite3.SQLITE_IOERR_NOMEM
+	}
+
+	defer libc.Xfree(tls, p)
+
+	if rc := h.passThrough.fileSize(tls, f, p); rc != sqlite3.SQLITE_OK {
+		return 0, rc
+	}
+
+	return *(*int64)(unsafe.Pointer(p)), sqlite3.SQLITE_OK
+}
+
+// faultChunk is the largest number of bytes saved by a single undo record.
+// The unix VFS reads and writes less than 128 KiB per call.
+const faultChunk = 65536
+
+// save records the n bytes at off of f before they are modified.
+func (h *faultHooks) save(tls *libc.TLS, f *shimFile, off, n int64) int32 {
+	if h.synced < 0 {
+		size, rc := h.size(tls, f)
+		if rc != sqlite3.SQLITE_OK {
+			return rc
+		}
+
+		h.synced = size
+	}
+	if off >= h.synced || n == 0 {
+		return sqlite3.SQLITE_OK // Removed by the truncation on revert.
+	}
+
+	if off+n > h.synced {
+		n = h.synced - off
+	}
+	bufSize := n
+	if bufSize > faultChunk {
+		bufSize = faultChunk
+	}
+	p := libc.Xmalloc(tls, types.Size_t(bufSize))
+	if p == 0 {
+		return sqlite3.SQLITE_IOERR_NOMEM
+	}
+
+	defer libc.Xfree(tls, p)
+
+	// A truncation can remove more than fits in an int32, the bytes are
+	// saved in chunks.
+	for n > 0 {
+		m := n
+		if m > faultChunk {
+			m = faultChunk
+		}
+		if rc := h.passThrough.read(tls, f, p, int32(m), off); rc != sqlite3.SQLITE_OK && rc != sqlite3.SQLITE_IOERR_SHORT_READ {
+			return rc
+		}
+
+		h.undo = append(h.undo, faultUndo{off, append([]byte(nil), memBytes(p, int32(m))...)})
+		off += m
+		n -= m
+	}
+	return sqlite3.SQLITE_OK
+}
+
+// revert undoes the modifications of the file since its last sync.
+func (h *faultHooks) revert(tls *libc.TLS) {
+	if h.synced < 0 {
+		return
+	}
+
+	for i := len(h.undo) - 1; i >= 0; i-- {
+		u := h.undo[i]
+		p := libc.Xmalloc(tls, types.Size_t(len(u.data)))
+		if p == 0 {
+			continue
+		}
+
+		copy(memBytes(p, int32(len(u.data))), u.data)
+		h.passThrough.write(tls, h.f, p, int32(len(u.data)), u.off)
+		libc.Xfree(tls, p)
+	}
+	h.passThrough.truncate(tls, h.f, h.synced)
+	h.undo = nil
+	h.synced = -1
+}
+
+// CrashCheck tests that the database file name recovers from fault f. It
+// opens the database using v, with the Driver.Open query parameters query,
+// injects f and runs workload. Once workload returns, the database is closed
+// and opened again, without faults, and its integrity is checked before
+// verify is called. verify should check that the transactions workload saw
+// committed are all present. The result reports whether the fault was
+// injected, CrashCheck fails if workload fails without it.
+//
+// To test the recovery from a fault at any point of a workload, call
+// CrashCheck with increasing f.After, recreating the database every time,
+// until the fault is no longer injected.
+func (v *FaultVFS) CrashCheck(name, query string, f Fault, workload, verify func(*sql.DB) error) (injected bool, err error) {
+	dsn := "file:" + uriEscape(name) + "?vfs=" + uriEscape(v.name)
+	if query != "" {
+		dsn += "&" + query
+	}
+	v.Reset()
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return false, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return false, err
+	}
+
+	v.Inject(f)
+	werr := workload(db)
+	injected = v.Triggered()
+	db.Close()
+	v.Reset()
+	if !injected && werr != nil {
+		return false, werr
+	}
+
+	if db, err = sql.Open(driverName, dsn); err != nil {
+		return injected, err
+	}
+
+	defer db.Close()
+
+	var s string
+	if err := db.QueryRow("pragma integrity_check").Scan(&s); err != nil {
+		return injected, fmt.Errorf("sqlite: CrashCheck: after %v: %v", f, err)
+	}
+
+	if s != "ok" {
+		return injected, fmt.Errorf("sqlite: CrashCheck: after %v: integrity check: %s", f, s)
+	}
+
+	if verify != nil {
+		if err := verify(db); err != nil {
+			return injected, fmt.Errorf("sqlite: CrashCheck: after %v: %v", f, err)
+		}
+	}
+
+	return injected, nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+var (
+	faultVFSOnce sync.Once
+	faultVFS     *FaultVFS
+	faultVFSErr  error
+)
+
+func testFaultVFS(t *testing.T) *FaultVFS {
+	faultVFSOnce.Do(func() { faultVFS, faultVFSErr = RegisterFaultVFS("fault-test", "") })
+	if faultVFSErr != nil {
+		t.Fatal(faultVFSErr)
+	}
+
+	return faultVFS
+}
+
+func TestFaultIOError(t *testing.T) {
+	v := testFaultVFS(t)
+
+	defer v.Reset()
+
+	fn := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, "file:"+fn+"?vfs="+v.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	v.Inject(Fault{Kind: FaultIOError, Op: FaultWrite, File: FaultMainDB})
+	if _, err := db.Exec("insert into t values(1)"); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	if !v.Triggered() {
+		t.Fatal("fault not injected")
+	}
+
+	// Only one operation fails.
+	if _, err := db.Exec("insert into t values(2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := db.QueryRow("select count(*) from t").Scan(&n); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+}
+
+// TestCrashCheck injects power losses and torn writes at every write and
+// sync of a workload and checks no committed transaction is lost.
+func TestCrashCheck(t *testing.T) {
+	v := testFaultVFS(t)
+
+	defer v.Reset()
+
+	dir := t.TempDir()
+	for _, query := range []string{
+		"_pragma=journal_mode(delete)&_pragma=synchronous(full)",
+		"_pragma=journal_mode(wal)&_pragma=synchronous(full)",
+	} {
+		for _, f := range []Fault{
+			{Kind: FaultPowerLoss, Op: FaultSync},
+			{Kind: FaultTornWrite},
+		} {
+			for f.After = 0; ; f.After++ {
+				name := filepath.Join(dir, fmt.Sprintf("test%d.db", f.After))
+				var committed int
+				injected, err := v.CrashCheck(name, query, f, func(db *sql.DB) error {
+					if _, err := db.Exec("create table if not exists t(i, b)"); err != nil {
+						return err
+					}
+
+					for i := 0; i < 5; i++ {
+						if _, err := db.Exec("insert into t values(?, randomblob(3000))", i); err != nil {
+							return err
+						}
+
+						committed++
+					}
+					return nil
+				}, func(db *sql.DB) error {
+					if committed == 0 {
+						return nil
+					}
+
+					var n int
+					if err := db.QueryRow("select count(*) from t").Scan(&n); err != nil {
+						return err
+					}
+
+					if n < committed {
+						return fmt.Errorf("got %d rows, want at least %d", n, committed)
+					}
+
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("%s: %v", query, err)
+				}
+
+				if !injected {
+					if f.After == 0 {
+						t.Fatalf("%s: %v: not injected", query, f)
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+// TestFaultPowerLoss checks a power loss undoes everything written since the
+// last sync, including a truncation by more than one undo record, see
+// faultChunk.
+func TestFaultPowerLoss(t *testing.T) {
+	v := testFaultVFS(t)
+
+	defer v.Reset()
+
+	name := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("create table t(i, b); insert into t values(1, randomblob(3*?)); update t set b = null", faultChunk); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+	orig, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(orig) <= 2*faultChunk {
+		t.Fatalf("database too small: %d", len(orig))
+	}
+
+	// Nothing is synced, the power loss reverts all the modifications.
+	if db, err = sql.Open(driverName, "file:"+name+"?vfs="+v.Name()+"&_pragma=synchronous(off)"); err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("vacuum; insert into t values(2, null)"); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Size() >= faultChunk {
+		t.Fatalf("database not truncated: %d", fi.Size())
+	}
+
+	v.Inject(Fault{Kind: FaultPowerLoss})
+	if _, err := db.Exec("insert into t values(3, null)"); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	db.Close()
+	v.Reset()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, orig) {
+		t.Fatalf("database not reverted, size %d, want %d", len(b), len(orig))
+	}
+}
+
+func TestFaultString(t *testing.T) {
+	if g, e := (Fault{Kind: FaultTornWrite, Op: FaultWrite, File: FaultWAL, After: 2}).String(), "torn write at write 3 of the WAL"; g != e {
+		t.Fatalf("got %q, want %q", g, e)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// flockVFS is the name of the VFS locking database files using flock(2), see
+// the _locking query parameter. It differs from unix-flock, which the library
+// provides on darwin.
+const flockVFS = "unix-flock-go"
+
+var (
+	flockOnce sync.Once
+	flockErr  error
+)
+
+// registerFlockVFS registers the flock locking VFS on first use. It forwards
+// to the unix-none VFS, which provides no shared memory, so like unix-dotfile
+// it does not support WAL mode unless the locking mode is exclusive.
+func registerFlockVFS() (string, error) {
+	flockOnce.Do(func() {
+		_, flockErr = registerShimVFS(flockVFS, "unix-none", func(tls *libc.TLS, f *shimFile) (fileHooks, error) {
+			if !f.isMainDB() {
+				return nil, nil
+			}
+
+			return &flockLock{fd: int((*sqlite3.UnixFile)(unsafe.Pointer(f.real)).Fh)}, nil
+		})
+	})
+	return flockVFS, flockErr
+}
+
+// flockLock implements the locking protocol of SQLite using flock(2), like
+// the unix-flock VFS of SQLite builds having SQLITE_ENABLE_LOCKING_STYLE. A
+// flock lock is exclusive, so a connection holding any lock, even for
+// reading, excludes all others.
+type flockLock struct {
+	passThrough
+	fd    int
+	level int32 // SQLITE_LOCK_*
+}
+
+func (l *flockLock) lock(tls *libc.TLS, f *shimFile, level int32) int32 {
+	if l.level > sqlite3.SQLITE_LOCK_NONE {
+		if level > l.level {
+			l.level = level
+		}
+		return sqlite3.SQLITE_OK
+	}
+
+	switch err := unix.Flock(l.fd, unix.LOCK_EX|unix.LOCK_NB); err {
+	case nil:
+		l.level = level
+		return sqlite3.SQLITE_OK
+	case unix.EWOULDBLOCK, unix.EINTR:
+		return sqlite3.SQLITE_BUSY
+	default:
+		return sqlite3.SQLITE_IOERR_LOCK
+	}
+}
+
+func (l *flockLock) unlock(tls *libc.TLS, f *shimFile, level int32) int32 {
+	if l.level <= level {
+		return sqlite3.SQLITE_OK
+	}
+
+	if level == sqlite3.SQLITE_LOCK_SHARED {
+		l.level = level
+		return sqlite3.SQLITE_OK
+	}
+
+	if err := unix.Flock(l.fd, unix.LOCK_UN); err != nil {
+		return sqlite3.SQLITE_IOERR_UNLOCK
+	}
+
+	l.level = sqlite3.SQLITE_LOCK_NONE
+	return sqlite3.SQLITE_OK
+}
+
+func (l *flockLock) checkReservedLock(tls *libc.TLS, f *shimFile, pResOut uintptr) int32 {
+	reserved := l.level > sqlite3.SQLITE_LOCK_SHARED
+	if l.level == sqlite3.SQLITE_LOCK_NONE {
+		switch err := unix.Flock(l.fd, unix.LOCK_EX|unix.LOCK_NB); err {
+		case nil:
+			unix.Flock(l.fd, unix.LOCK_UN)
+		case unix.EWOULDBLOCK:
+			reserved = true
+		default:
+			return sqlite3.SQLITE_IOERR_CHECKRESERVEDLOCK
+		}
+	}
+	*(*int32)(unsafe.Pointer(pResOut)) = libc.Bool32(reserved)
+	return sqlite3.SQLITE_OK
+}
+
+func (l *flockLock) fileControl(tls *libc.TLS, f *shimFile, op int32, pArg uintptr) int32 {
+	if op == sqlite3.SQLITE_FCNTL_LOCKSTATE {
+		*(*int32)(unsafe.Pointer(pArg)) = l.level
+		return sqlite3.SQLITE_OK
+	}
+
+	return l.passThrough.fileControl(tls, f, op, pArg)
+}
@@ -0,0 +1,285 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fts adds full-text search to the tables of an SQLite database
+// using FTS5, see https://www.sqlite.org/fts5.html. An Index describes an
+// FTS5 table indexing some text columns of a content table. Create creates
+// the FTS5 table as an external content table together with the triggers
+// keeping it in sync with the content table, so rows are indexed by the
+// ordinary INSERT, UPDATE and DELETE statements of the application. Search
+// runs ranked queries returning the matching rows with the matches
+// highlighted.
+package fts // import "modernc.org/sqlite/fts"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// DB is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Index describes a full-text index of a table.
+type Index struct {
+	// Name is the name of the FTS5 table and the prefix of the names of
+	// its triggers.
+	Name string
+	// Table is the content table.
+	Table string
+	// Rowid is the INTEGER PRIMARY KEY column of Table, "rowid" if empty.
+	// It must be stable, as VACUUM may change the implicit rowids of a
+	// table without an INTEGER PRIMARY KEY.
+	Rowid string
+	// Columns are the indexed text columns of Table.
+	Columns []string
+	// Tokenize is the tokenizer specification, for example
+	// "porter unicode61 remove_diacritics 2", the FTS5 default if empty.
+	Tokenize string
+	// Prefix lists the lengths of the prefixes to index, making prefix
+	// queries like "abc*" fast.
+	Prefix []int
+}
+
+func (ix *Index) rowid() string {
+	if ix.Rowid == "" {
+		return "rowid"
+	}
+
+	return ix.Rowid
+}
+
+// Create creates the FTS5 table and the triggers of ix unless they exist.
+// A new FTS5 table is filled with the existing rows of the content table.
+// Pass a *sql.Tx to create the index atomically.
+func (ix *Index) Create(ctx context.Context, db DB) error {
+	if len(ix.Columns) == 0 {
+		return fmt.Errorf("fts: index %q has no columns", ix.Name)
+	}
+
+	rows, err := db.QueryContext(ctx, "select count(*) from sqlite_master where type = 'table' and name = ?", ix.Name)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	for rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	name := quoteIdentifier(ix.Name)
+	var cols, newCols, oldCols []string
+	for _, v := range ix.Columns {
+		c := quoteIdentifier(v)
+		cols = append(cols, c)
+		newCols = append(newCols, "new."+c)
+		oldCols = append(oldCols, "old."+c)
+	}
+	rowid := quoteIdentifier(ix.rowid())
+	options := []string{
+		"content=" + quoteString(ix.Table),
+		"content_rowid=" + quoteString(ix.rowid()),
+	}
+	if ix.Tokenize != "" {
+		options = append(options, "tokenize="+quoteString(ix.Tokenize))
+	}
+	if len(ix.Prefix) != 0 {
+		var a []string
+		for _, v := range ix.Prefix {
+			a = append(a, fmt.Sprint(v))
+		}
+		options = append(options, "prefix="+quoteString(strings.Join(a, " ")))
+	}
+
+	insert := fmt.Sprintf("insert into %s(rowid, %s) values(new.%s, %s);", name, strings.Join(cols, ", "), rowid, strings.Join(newCols, ", "))
+	remove := fmt.Sprintf("insert into %s(%[1]s, rowid, %s) values('delete', old.%s, %s);", name, strings.Join(cols, ", "), rowid, strings.Join(oldCols, ", "))
+	table := quoteIdentifier(ix.Table)
+	for _, v := range []string{
+		fmt.Sprintf("create virtual table if not exists %s using fts5(%s, %s)", name, strings.Join(cols, ", "), strings.Join(options, ", ")),
+		fmt.Sprintf("create trigger if not exists %s after insert on %s begin %s end", quoteIdentifier(ix.Name+"_ai"), table, insert),
+		fmt.Sprintf("create trigger if not exists %s after delete on %s begin %s end", quoteIdentifier(ix.Name+"_ad"), table, remove),
+		fmt.Sprintf("create trigger if not exists %s after update on %s begin %s %s end", quoteIdentifier(ix.Name+"_au"), table, remove, insert),
+	} {
+		if _, err := db.ExecContext(ctx, v); err != nil {
+			return err
+		}
+	}
+
+	if n != 0 {
+		return nil
+	}
+
+	return ix.Rebuild(ctx, db)
+}
+
+// Rebuild rebuilds the FTS5 table of ix from the content table, for example
+// after the content table was modified while the triggers did not exist.
+func (ix *Index) Rebuild(ctx context.Context, db DB) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("insert into %s(%[1]s) values('rebuild')", quoteIdentifier(ix.Name)))
+	return err
+}
+
+// Optimize merges the b-trees of the FTS5 table of ix, which makes queries
+// faster, see https://www.sqlite.org/fts5.html#the_optimize_command.
+func (ix *Index) Optimize(ctx context.Context, db DB) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("insert into %s(%[1]s) values('optimize')", quoteIdentifier(ix.Name)))
+	return err
+}
+
+// Drop drops the triggers and the FTS5 table of ix. The content table is not
+// changed.
+func (ix *Index) Drop(ctx context.Context, db DB) error {
+	for _, v := range []string{"_ai", "_ad", "_au"} {
+		if _, err := db.ExecContext(ctx, "drop trigger if exists "+quoteIdentifier(ix.Name+v)); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.ExecContext(ctx, "drop table if exists "+quoteIdentifier(ix.Name))
+	return err
+}
+
+// SearchOptions configure Search.
+type SearchOptions struct {
+	// Limit is the maximum number of hits, 0 is no limit.
+	Limit int
+	// Offset is the number of best hits to skip.
+	Offset int
+	// Open and Close enclose the matches in Hit.Fields and Hit.Snippet,
+	// "<b>" and "</b>" if both are empty.
+	Open, Close string
+	// Weights are the weights of the columns in the ranking, in the order
+	// of Index.Columns. Missing weights are 1.
+	Weights []float64
+	// SnippetTokens, if positive, is the maximum number of tokens of
+	// Hit.Snippet, at most 64.
+	SnippetTokens int
+	// Ellipsis marks the text left out of Hit.Snippet, "..." if empty.
+	Ellipsis string
+}
+
+// Hit is a row matching a query.
+type Hit struct {
+	// Rowid is the rowid of the content table row.
+	Rowid int64
+	// Rank is the bm25 rank of the row, better matches have lower ranks.
+	Rank float64
+	// Fields are the values of the indexed columns of the row, in the
+	// order of Index.Columns, with the matches highlighted.
+	Fields []string
+	// Snippet is the fragment of the row with the most matches, if
+	// SearchOptions.SnippetTokens is positive.
+	Snippet string
+}
+
+// Search returns the rows matching query, an FTS5 full-text query, see
+// https://www.sqlite.org/fts5.html#full_text_query_syntax, best match first.
+// Use Quote to search for text typed by users. The options may be nil.
+func (ix *Index) Search(ctx context.Context, db DB, query string, opts *SearchOptions) (r []Hit, err error) {
+	if opts == nil {
+		opts = &SearchOptions{}
+	}
+
+	open, close := opts.Open, opts.Close
+	if open == "" && close == "" {
+		open, close = "<b>", "</b>"
+	}
+
+	name := quoteIdentifier(ix.Name)
+	var args []interface{}
+	var b strings.Builder
+	fmt.Fprintf(&b, "select rowid, bm25(%s", name)
+	if len(opts.Weights) != 0 {
+		for i := range ix.Columns {
+			w := 1.0
+			if i < len(opts.Weights) {
+				w = opts.Weights[i]
+			}
+			b.WriteString(", ?")
+			args = append(args, w)
+		}
+	}
+	b.WriteString(") as rank")
+	for i := range ix.Columns {
+		fmt.Fprintf(&b, ", highlight(%s, %d, ?, ?)", name, i)
+		args = append(args, open, close)
+	}
+	if opts.SnippetTokens > 0 {
+		ellipsis := opts.Ellipsis
+		if ellipsis == "" {
+			ellipsis = "..."
+		}
+		fmt.Fprintf(&b, ", snippet(%s, -1, ?, ?, ?, ?)", name)
+		args = append(args, open, close, ellipsis, opts.SnippetTokens)
+	}
+	fmt.Fprintf(&b, " from %s where %[1]s match ? order by rank", name)
+	args = append(args, query)
+	if opts.Limit > 0 || opts.Offset > 0 {
+		limit := opts.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		b.WriteString(" limit ? offset ?")
+		args = append(args, limit, opts.Offset)
+	}
+
+	rows, err := db.QueryContext(ctx, b.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		h := Hit{Fields: make([]string, len(ix.Columns))}
+		fields := make([]sql.NullString, len(ix.Columns))
+		dest := []interface{}{&h.Rowid, &h.Rank}
+		for i := range fields {
+			dest = append(dest, &fields[i])
+		}
+		if opts.SnippetTokens > 0 {
+			dest = append(dest, &h.Snippet)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		for i, v := range fields {
+			h.Fields[i] = v.String
+		}
+		r = append(r, h)
+	}
+	return r, rows.Err()
+}
+
+// Quote returns s as an FTS5 query matching the rows containing all the
+// words of s, treating characters like '*', '"', '-' and keywords like OR
+// literally. Quote returns "" if s has no words.
+func Quote(s string) string {
+	var a []string
+	for _, v := range strings.Fields(s) {
+		a = append(a, `"`+strings.ReplaceAll(v, `"`, `""`)+`"`)
+	}
+	return strings.Join(a, " ")
+}
+
+// quoteIdentifier returns s quoted as an SQL identifier.
+func quoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// quoteString returns s quoted as an SQL string literal.
+func quoteString(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fts_test // import "modernc.org/sqlite/fts"
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "modernc.org/sqlite"
+	"modernc.org/sqlite/fts"
+)
+
+func TestIndex(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`
+create table posts(id integer primary key, title text, body text, author text);
+insert into posts values(1, 'Go and SQLite', 'Embedding a database in a Go program.', 'ann');
+insert into posts values(2, 'Cooking', 'Recipes for running out of time.', 'bob');
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	ix := &fts.Index{Name: "posts_fts", Table: "posts", Rowid: "id", Columns: []string{"title", "body"}, Tokenize: "porter", Prefix: []int{2}}
+	for i := 0; i < 2; i++ {
+		if err := ix.Create(ctx, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rows of the content table are indexed when the index is created and
+	// by the triggers.
+	if _, err := db.Exec(`
+insert into posts values(3, 'Running SQLite', 'Run a database without a server: SQLite is serverless.', 'ann');
+update posts set body = 'Recipes for busy evenings.' where id = 2;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err := ix.Search(ctx, db, "sqlite", &fts.SearchOptions{Weights: []float64{10}, SnippetTokens: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hits) != 2 || hits[0].Rowid != 3 || hits[1].Rowid != 1 || hits[0].Rank > hits[1].Rank {
+		t.Fatalf("%+v", hits)
+	}
+
+	if g, e := hits[0].Fields[0], "Running <b>SQLite</b>"; g != e {
+		t.Errorf("got %q, want %q", g, e)
+	}
+
+	if g, e := hits[0].Snippet, "Running <b>SQLite</b>"; g != e {
+		t.Errorf("got %q, want %q", g, e)
+	}
+
+	// Porter stemming matches "Running" and "Run".
+	hits, err = ix.Search(ctx, db, "runs", &fts.SearchOptions{Open: "[", Close: "]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hits) != 1 || hits[0].Rowid != 3 || hits[0].Fields[0] != "[Running] SQLite" || hits[0].Fields[1] != "[Run] a database without a server: SQLite is serverless." {
+		t.Fatalf("%+v", hits)
+	}
+
+	if hits, err = ix.Search(ctx, db, "running", nil); err != nil || len(hits) != 1 {
+		t.Fatalf("%+v, %v", hits, err)
+	}
+
+	// The query syntax characters and keywords in quoted text are words.
+	if hits, err = ix.Search(ctx, db, fts.Quote(`database OR "go"* -`), &fts.SearchOptions{Limit: 1}); err != nil || len(hits) != 0 {
+		t.Fatalf("%+v, %v", hits, err)
+	}
+
+	if hits, err = ix.Search(ctx, db, fts.Quote(`database "go"*`), &fts.SearchOptions{Limit: 1}); err != nil || len(hits) != 1 || hits[0].Rowid != 1 {
+		t.Fatalf("%+v, %v", hits, err)
+	}
+
+	if _, err := db.Exec("delete from posts where id = 3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if hits, err = ix.Search(ctx, db, "da*", nil); err != nil || len(hits) != 1 || hits[0].Rowid != 1 {
+		t.Fatalf("%+v, %v", hits, err)
+	}
+
+	if err := ix.Optimize(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.Drop(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := db.QueryRow("select count(*) from sqlite_master where name like 'posts_fts%'").Scan(&n); err != nil || n != 0 {
+		t.Fatalf("%d objects left, %v", n, err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func TestRegisterScalarFunctionFlags(t *testing.T) {
+	double := func(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+		n, _ := args[0].(int64)
+		return 2 * n, nil
+	}
+	if err := RegisterScalarFunctionFlags("test_flags_innocuous", 1, FunctionDeterministic|FunctionInnocuous, double); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterScalarFunctionFlags("test_flags_direct", 1, FunctionDirectOnly, double); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterScalarFunctionFlags("test_flags_plain", 1, 0, double); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterScalarFunctionFlags("test_flags_invalid", 1, FunctionDirectOnly|FunctionInnocuous, double); err == nil {
+		t.Fatal("unexpected success registering a direct only and innocuous function")
+	}
+
+	if err := RegisterScalarFunctionFlags("test_flags_invalid", 1, 1, double); err == nil {
+		t.Fatal("unexpected success registering a function with invalid flags")
+	}
+
+	db, err := sql.Open(driverName, "file::memory:?_pragma=trusted_schema(off)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`
+create table t(i int, j as (test_flags_innocuous(i)));
+create index x on t(test_flags_innocuous(i));
+insert into t(i) values(21);
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	var j int
+	if err := db.QueryRow("select j from t where test_flags_innocuous(i) = 42").Scan(&j); err != nil || j != 42 {
+		t.Fatal(j, err)
+	}
+
+	// Only deterministic functions are allowed in generated columns.
+	if _, err := db.Exec("create table u(i int, j as (test_flags_plain(i)))"); err == nil || !strings.Contains(err.Error(), "non-deterministic") {
+		t.Fatalf("got %v, want a non-deterministic function error", err)
+	}
+
+	if err := db.QueryRow("select test_flags_direct(1)").Scan(&j); err != nil || j != 2 {
+		t.Fatal(j, err)
+	}
+
+	if _, err := db.Exec("create view v as select test_flags_direct(i) from t"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.QueryRow("select * from v").Scan(&j); err == nil || !strings.Contains(err.Error(), "unsafe use of test_flags_direct") {
+		t.Fatalf("got %v, want an unsafe use error", err)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"modernc.org/sqlite/internal/slt"
+)
+
+// fuzzTimeout bounds the run time of one fuzz input, the statements are
+// interrupted when it expires.
+const fuzzTimeout = time.Second
+
+// fuzzSchema is the database the SQL inputs of FuzzSQL run against.
+const fuzzSchema = `
+create table t1(a integer primary key, b text, c real, d blob);
+create index t1_bc on t1(b, c);
+create table t2(x, y, z, primary key(x, y)) without rowid;
+create view v1 as select a, b, x from t1 left join t2 on a = x;
+create trigger t1_ins after insert on t1 begin insert or ignore into t2 values(new.a, new.b, new.c); end;
+insert into t1(b, c, d) values('one', 1.5, x'01'), ('two', null, zeroblob(3)), (null, -2, 'text');
+insert into t2 values(10, 'y', 3.25);
+`
+
+// fuzzOpen opens db for untrusted input: defensive, with limits on sizes and
+// on the number of virtual machine instructions of a statement.
+func fuzzOpen(t *testing.T, name string) *sql.DB {
+	db, err := sql.Open(driverName, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.SetMaxOpenConns(1)
+	sc, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	defer sc.Close()
+
+	if err := sc.Raw(func(dc interface{}) error {
+		c := dc.(*conn)
+		c.SetLimit(LimitLength, 1<<20)
+		c.SetLimit(LimitSQLLength, 1<<16)
+		c.SetLimit(LimitVDBEOp, 1<<16)
+		c.SetLimit(LimitAttached, 0)
+		return c.Harden()
+	}); err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// fuzzRun executes query, then queries it reading all the rows. Errors are
+// expected, the fuzzer looks for panics and crashes.
+func fuzzRun(db *sql.DB, query string) {
+	ctx, cancel := context.WithTimeout(context.Background(), fuzzTimeout)
+
+	defer cancel()
+
+	db.ExecContext(ctx, query)
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return
+	}
+
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		rows.Scan(ptrs...)
+	}
+}
+
+// FuzzSQL feeds SQL text to the parser and the virtual machine. The corpus is
+// seeded with the statements of the scripts in testdata/slt.
+func FuzzSQL(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "slt", "*.test"))
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	for _, v := range files {
+		b, err := os.Open(v)
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		a, err := slt.Statements(b)
+		b.Close()
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		for _, s := range a {
+			f.Add(s)
+		}
+	}
+	f.Fuzz(func(t *testing.T, query string) {
+		db := fuzzOpen(t, ":memory:")
+
+		defer db.Close()
+
+		if _, err := db.Exec(fuzzSchema); err != nil {
+			t.Fatal(err)
+		}
+
+		fuzzRun(db, query)
+	})
+}
+
+// FuzzDatabaseFile opens malformed database files and reads them. The corpus
+// is seeded with valid databases and truncated copies of them.
+func FuzzDatabaseFile(f *testing.F) {
+	for _, v := range []string{
+		fuzzSchema,
+		"pragma page_size=512; create table t(a, b); create index t_b on t(b); insert into t with recursive s(i) as (select 1 union all select i + 1 from s where i < 200) select i, randomblob(i * 10) from s;",
+		"pragma auto_vacuum=full; create table t(a text primary key, b) without rowid; insert into t values('a', 1), ('b', zeroblob(5000)); delete from t where a = 'a';",
+	} {
+		b := fuzzDatabase(f, v)
+		f.Add(b)
+		f.Add(b[:len(b)/2])
+		f.Add(b[:100])
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		name := filepath.Join(t.TempDir(), "fuzz.db")
+		if err := os.WriteFile(name, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		db := fuzzOpen(t, "file:"+uriEscape(name)+"?mode=ro&_pragma=mmap_size(0)")
+
+		defer db.Close()
+
+		fuzzRun(db, "pragma integrity_check")
+		fuzzRun(db, "select * from sqlite_schema")
+		rows, err := db.Query("select name from sqlite_schema where type in ('table', 'view')")
+		if err != nil {
+			return
+		}
+
+		var tables []string
+		for rows.Next() {
+			var s string
+			if rows.Scan(&s) == nil {
+				tables = append(tables, s)
+			}
+		}
+		rows.Close()
+		for _, v := range tables {
+			fuzzRun(db, "select * from "+quoteIdentifier(v)+" order by 1 desc")
+		}
+	})
+}
+
+// fuzzDatabase returns the content of a database created by query.
+func fuzzDatabase(f *testing.F, query string) []byte {
+	db, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(query); err != nil {
+		f.Fatal(err)
+	}
+
+	sc, err := db.Conn(context.Background())
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	defer sc.Close()
+
+	var b []byte
+	if err := sc.Raw(func(dc interface{}) (err error) {
+		b, err = dc.(*conn).Serialize("main")
+		return err
+	}); err != nil {
+		f.Fatal(err)
+	}
+
+	return b
+}
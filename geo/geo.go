@@ -0,0 +1,280 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package geo indexes points and boxes given by latitude and longitude, in
+// degrees, for bounding box and radius queries. It is built on the R*Tree
+// extension of SQLite, see https://www.sqlite.org/rtree.html, and covers what
+// location-based applications typically need without a full spatial database
+// like SpatiaLite.
+//
+// The R*Tree stores coordinates as 32 bit floats, which is accurate to about
+// a meter. Boxes must not cross the antimeridian, split such a box into two
+// entries.
+//
+// Importing the package registers the SQL function
+//
+//	haversine(LAT1, LON1, LAT2, LON2)
+//
+// which returns the great-circle distance of two points in meters, see
+// Distance.
+package geo // import "modernc.org/sqlite/geo"
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"modernc.org/sqlite"
+)
+
+// EarthRadius is the mean radius of the Earth in meters.
+const EarthRadius = 6371008.8
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("haversine", 4, haversine)
+}
+
+// DB is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Point is a location.
+type Point struct {
+	Lat, Lon float64
+}
+
+// Box is the area between two latitudes and two longitudes.
+type Box struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// valid reports whether b is a box of valid coordinates, not crossing the
+// antimeridian.
+func (b Box) valid() bool {
+	return -90 <= b.MinLat && b.MinLat <= b.MaxLat && b.MaxLat <= 90 &&
+		-180 <= b.MinLon && b.MinLon <= b.MaxLon && b.MaxLon <= 180
+}
+
+// nearest returns the point of b nearest to p.
+func (b Box) nearest(p Point) Point {
+	lat := math.Max(b.MinLat, math.Min(p.Lat, b.MaxLat))
+	lon := p.Lon
+	if lon < b.MinLon || lon > b.MaxLon {
+		// The closer edge, measured around the globe.
+		if lonDelta(lon, b.MinLon) <= lonDelta(lon, b.MaxLon) {
+			lon = b.MinLon
+		} else {
+			lon = b.MaxLon
+		}
+	}
+	return Point{lat, lon}
+}
+
+// lonDelta returns the angle between two longitudes, at most 180.
+func lonDelta(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
+
+// Distance returns the great-circle distance of a and b in meters, computed
+// by the haversine formula on a sphere of EarthRadius. The error against the
+// ellipsoid of the Earth is below 0.5 percent.
+func Distance(a, b Point) float64 {
+	rad := math.Pi / 180
+	dLat := (b.Lat - a.Lat) * rad
+	dLon := (b.Lon - a.Lon) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(a.Lat*rad)*math.Cos(b.Lat*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(math.Min(h, 1)))
+}
+
+// haversine(LAT1, LON1, LAT2, LON2) returns the distance of two points in
+// meters, or NULL if an argument is NULL.
+func haversine(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	var f [4]float64
+	for i, v := range args {
+		switch x := v.(type) {
+		case nil:
+			return nil, nil
+		case int64:
+			f[i] = float64(x)
+		case float64:
+			f[i] = x
+		default:
+			return nil, fmt.Errorf("haversine: invalid coordinate %v", v)
+		}
+	}
+	return Distance(Point{f[0], f[1]}, Point{f[2], f[3]}), nil
+}
+
+// Index is an R*Tree of points and boxes identified by integer IDs, for
+// example the rowids of the table of the locations.
+type Index struct {
+	// Name is the name of the R*Tree virtual table.
+	Name string
+}
+
+func (ix *Index) table() string {
+	return `"` + strings.ReplaceAll(ix.Name, `"`, `""`) + `"`
+}
+
+// Create creates the R*Tree table of ix unless it exists.
+func (ix *Index) Create(ctx context.Context, db DB) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("create virtual table if not exists %s using rtree(id, min_lon, max_lon, min_lat, max_lat)", ix.table()))
+	return err
+}
+
+// Drop drops the R*Tree table of ix.
+func (ix *Index) Drop(ctx context.Context, db DB) error {
+	_, err := db.ExecContext(ctx, "drop table if exists "+ix.table())
+	return err
+}
+
+// PutPoint adds or replaces the entry id as the point p.
+func (ix *Index) PutPoint(ctx context.Context, db DB, id int64, p Point) error {
+	return ix.PutBox(ctx, db, id, Box{p.Lat, p.Lon, p.Lat, p.Lon})
+}
+
+// PutBox adds or replaces the entry id as the box b.
+func (ix *Index) PutBox(ctx context.Context, db DB, id int64, b Box) error {
+	if !b.valid() {
+		return fmt.Errorf("geo: invalid box %+v", b)
+	}
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf("insert or replace into %s values(?, ?, ?, ?, ?)", ix.table()), id, b.MinLon, b.MaxLon, b.MinLat, b.MaxLat)
+	return err
+}
+
+// Delete removes the entry id. It reports whether the entry existed.
+func (ix *Index) Delete(ctx context.Context, db DB, id int64) (bool, error) {
+	r, err := db.ExecContext(ctx, fmt.Sprintf("delete from %s where id = ?", ix.table()), id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := r.RowsAffected()
+	return n != 0, err
+}
+
+// Get returns the box of the entry id, the box of a point has no extent.
+// ok is false if the entry does not exist.
+func (ix *Index) Get(ctx context.Context, db DB, id int64) (b Box, ok bool, err error) {
+	err = ix.query(ctx, db, func(_ int64, v Box) { b, ok = v, true }, "where id = ?", id)
+	return b, ok, err
+}
+
+// query calls fn for the entries selected by where.
+func (ix *Index) query(ctx context.Context, db DB, fn func(id int64, b Box), where string, args ...interface{}) error {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("select id, min_lat, min_lon, max_lat, max_lon from %s %s", ix.table(), where), args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var b Box
+		if err := rows.Scan(&id, &b.MinLat, &b.MinLon, &b.MaxLat, &b.MaxLon); err != nil {
+			return err
+		}
+
+		fn(id, b)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return rows.Close()
+}
+
+// InBox returns the IDs of the entries overlapping b, in ascending order.
+func (ix *Index) InBox(ctx context.Context, db DB, b Box) (r []int64, err error) {
+	if !b.valid() {
+		return nil, fmt.Errorf("geo: invalid box %+v", b)
+	}
+
+	err = ix.query(ctx, db, func(id int64, _ Box) { r = append(r, id) }, "where max_lon >= ? and min_lon <= ? and max_lat >= ? and min_lat <= ? order by id", b.MinLon, b.MaxLon, b.MinLat, b.MaxLat)
+	return r, err
+}
+
+// Hit is an entry found by Within.
+type Hit struct {
+	ID int64
+	// Distance is the distance in meters from the center of the query to
+	// the point, or to the nearest point of the box, of the entry.
+	Distance float64
+}
+
+// Within returns the entries at most radius meters from center, nearest
+// first. A box is within the radius if any of its points is.
+func (ix *Index) Within(ctx context.Context, db DB, center Point, radius float64) (r []Hit, err error) {
+	for _, b := range BoundingBoxes(center, radius) {
+		if err = ix.query(ctx, db, func(id int64, v Box) {
+			if d := Distance(center, v.nearest(center)); d <= radius {
+				r = append(r, Hit{id, d})
+			}
+		}, "where max_lon >= ? and min_lon <= ? and max_lat >= ? and min_lat <= ?", b.MinLon, b.MaxLon, b.MinLat, b.MaxLat); err != nil {
+			return nil, err
+		}
+	}
+
+	// An entry overlapping two boxes is found twice.
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Distance != r[j].Distance {
+			return r[i].Distance < r[j].Distance
+		}
+
+		return r[i].ID < r[j].ID
+	})
+	w := 0
+	for i, v := range r {
+		if i == 0 || v.ID != r[w-1].ID || v.Distance != r[w-1].Distance {
+			r[w] = v
+			w++
+		}
+	}
+	return r[:w], nil
+}
+
+// BoundingBoxes returns the boxes covering the points at most radius meters
+// from center. It returns two boxes if the area crosses the antimeridian and
+// one box otherwise.
+func BoundingBoxes(center Point, radius float64) []Box {
+	// The boxes are widened slightly so that the rounding of the
+	// coordinates of the R*Tree does not drop entries on their edges.
+	const margin = 1e-5
+	dLat := radius/EarthRadius*180/math.Pi + margin
+	minLat, maxLat := center.Lat-dLat, center.Lat+dLat
+	if minLat <= -90 || maxLat >= 90 {
+		// A pole is within the radius, all longitudes are.
+		return []Box{{math.Max(minLat, -90), -180, math.Min(maxLat, 90), 180}}
+	}
+
+	// The widest longitude difference is at the latitude farthest from
+	// the equator.
+	lat := math.Max(math.Abs(minLat), math.Abs(maxLat)) * math.Pi / 180
+	dLon := dLat/math.Cos(lat) + margin
+	if dLon >= 180 {
+		return []Box{{minLat, -180, maxLat, 180}}
+	}
+
+	minLon, maxLon := center.Lon-dLon, center.Lon+dLon
+	switch {
+	case minLon < -180:
+		return []Box{{minLat, minLon + 360, maxLat, 180}, {minLat, -180, maxLat, maxLon}}
+	case maxLon > 180:
+		return []Box{{minLat, minLon, maxLat, 180}, {minLat, -180, maxLat, maxLon - 360}}
+	default:
+		return []Box{{minLat, minLon, maxLat, maxLon}}
+	}
+}
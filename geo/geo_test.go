@@ -0,0 +1,149 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package geo_test // import "modernc.org/sqlite/geo"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"testing"
+
+	"modernc.org/sqlite/geo"
+)
+
+var (
+	prague  = geo.Point{Lat: 50.0755, Lon: 14.4378}
+	brno    = geo.Point{Lat: 49.1951, Lon: 16.6068}
+	vienna  = geo.Point{Lat: 48.2082, Lon: 16.3738}
+	berlin  = geo.Point{Lat: 52.5200, Lon: 13.4050}
+	suva    = geo.Point{Lat: -18.1416, Lon: 178.4419}
+	taveuni = geo.Point{Lat: -16.8500, Lon: -179.9500}
+)
+
+func TestIndex(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+	ix := &geo.Index{Name: "places"}
+	if err := ix.Create(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, p := range []geo.Point{prague, brno, vienna, berlin, suva, taveuni} {
+		if err := ix.PutPoint(ctx, db, int64(i+1), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The Czech Republic.
+	cz := geo.Box{MinLat: 48.55, MinLon: 12.09, MaxLat: 51.06, MaxLon: 18.86}
+	if err := ix.PutBox(ctx, db, 7, cz); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.PutBox(ctx, db, 8, geo.Box{MinLat: 1, MaxLat: 0}); err == nil {
+		t.Fatal("unexpected success adding an invalid box")
+	}
+
+	ids, err := ix.InBox(ctx, db, geo.Box{MinLat: 49, MinLon: 14, MaxLat: 51, MaxLon: 17})
+	if err != nil || fmt.Sprint(ids) != "[1 2 7]" {
+		t.Fatalf("%v, %v", ids, err)
+	}
+
+	d := geo.Distance(prague, brno)
+	if math.Abs(d-185e3) > 2e3 {
+		t.Fatalf("Prague-Brno %v m", d)
+	}
+
+	var sd float64
+	if err := db.QueryRow("select haversine(?, ?, ?, ?)", prague.Lat, prague.Lon, brno.Lat, brno.Lon).Scan(&sd); err != nil || sd != d {
+		t.Fatalf("%v, %v, want %v", sd, err, d)
+	}
+
+	hits, err := ix.Within(ctx, db, prague, 200e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprint(hits[0].ID, hits[1].ID, hits[2].ID, len(hits)), "1 7 2 3"; g != e || hits[0].Distance != 0 || hits[1].Distance != 0 {
+		t.Fatalf("%+v", hits)
+	}
+
+	// Vienna is outside the box, close to its southern border.
+	if hits, err = ix.Within(ctx, db, vienna, 50e3); err != nil || len(hits) != 2 || hits[0].ID != 3 || hits[1].ID != 7 || hits[1].Distance > 50e3 {
+		t.Fatalf("%+v, %v", hits, err)
+	}
+
+	// Suva and Taveuni are on opposite sides of the antimeridian.
+	if hits, err = ix.Within(ctx, db, suva, 300e3); err != nil || len(hits) != 2 || hits[1].ID != 6 {
+		t.Fatalf("%+v, %v", hits, err)
+	}
+
+	if b, ok, err := ix.Get(ctx, db, 7); err != nil || !ok || math.Abs(b.MaxLon-cz.MaxLon) > 1e-5 {
+		t.Fatalf("%+v, %v, %v", b, ok, err)
+	}
+
+	if ok, err := ix.Delete(ctx, db, 7); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+
+	if _, ok, err := ix.Get(ctx, db, 7); ok || err != nil {
+		t.Fatal(ok, err)
+	}
+
+	if err := ix.Drop(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBoundingBoxes(t *testing.T) {
+	for _, v := range []struct {
+		center geo.Point
+		radius float64
+		n      int
+	}{
+		{prague, 10e3, 1},
+		{suva, 300e3, 2},
+		{geo.Point{Lat: 89.9, Lon: 0}, 20e3, 1},
+		{geo.Point{Lat: 0, Lon: -179.99}, 10e3, 2},
+	} {
+		boxes := geo.BoundingBoxes(v.center, v.radius)
+		if len(boxes) != v.n {
+			t.Errorf("%+v: %+v", v, boxes)
+			continue
+		}
+
+		// Points just inside the circle are in a box.
+		for a := 0.0; a < 2*math.Pi; a += math.Pi / 16 {
+			p := destination(v.center, a, v.radius*0.999)
+			found := false
+			for _, b := range boxes {
+				if b.MinLat <= p.Lat && p.Lat <= b.MaxLat && b.MinLon <= p.Lon && p.Lon <= b.MaxLon {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("%+v: %+v not in %+v", v, p, boxes)
+			}
+		}
+	}
+}
+
+// destination returns the point d meters from p in the direction bearing, in
+// radians clockwise from north.
+func destination(p geo.Point, bearing, d float64) geo.Point {
+	rad := math.Pi / 180
+	lat, lon, a := p.Lat*rad, p.Lon*rad, d/geo.EarthRadius
+	lat2 := math.Asin(math.Sin(lat)*math.Cos(a) + math.Cos(lat)*math.Sin(a)*math.Cos(bearing))
+	lon2 := lon + math.Atan2(math.Sin(bearing)*math.Sin(a)*math.Cos(lat), math.Cos(a)-math.Sin(lat)*math.Sin(lat2))
+	return geo.Point{Lat: lat2 / rad, Lon: math.Mod(lon2/rad+540, 360) - 180}
+}
@@ -4,6 +4,7 @@ go 1.17
 
 require (
 	golang.org/x/sys v0.0.0-20220811171246-fbc7d0a398ab
+	golang.org/x/text v0.4.0
 	modernc.org/libc v1.21.5
 )
 
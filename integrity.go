@@ -0,0 +1,78 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// IntegrityCheck runs a thorough check of the integrity of the attached
+// databases, see https://www.sqlite.org/pragma.html#pragma_integrity_check,
+// and returns the problems found, at most maxErrors of them, one per item and
+// prefixed by the name of the database concerned, like in
+//
+//	main: On tree page 6 cell 72: Offset 0 out of range 164..4092
+//
+// A maxErrors value less than 1 selects the SQLite default of 100. A nil
+// result means the databases are intact. err reports a failure to perform the
+// check, for example a database so damaged that it cannot be read at all, or
+// the cancellation of ctx.
+//
+// IntegrityCheck and QuickCheck can be reached using (*sql.Conn).Raw.
+func (c *conn) IntegrityCheck(ctx context.Context, maxErrors int) ([]string, error) {
+	return c.check(ctx, "integrity_check", maxErrors)
+}
+
+// QuickCheck is like IntegrityCheck but skips the verification of the
+// content of indexes against their tables, which makes it run in O(N) time
+// instead of O(NlogN).
+func (c *conn) QuickCheck(ctx context.Context, maxErrors int) ([]string, error) {
+	return c.check(ctx, "quick_check", maxErrors)
+}
+
+func (c *conn) check(ctx context.Context, pragma string, maxErrors int) (r []string, err error) {
+	var arg []interface{}
+	if maxErrors > 0 {
+		arg = append(arg, maxErrors)
+	}
+	rows, err := c.pragma(ctx, pragma, arg...)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := "main"
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+
+		s, ok := row[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("sqlite: %s: unexpected result type %T", pragma, row[0])
+		}
+
+		if s == "ok" && len(rows) == 1 {
+			return nil, nil
+		}
+
+		// A row can report several problems, grouped by database as in
+		//
+		//	*** in database main ***
+		//	On tree page 6 cell 72: ...
+		for _, line := range strings.Split(s, "\n") {
+			if strings.HasPrefix(line, "*** in database ") && strings.HasSuffix(line, " ***") {
+				schema = strings.TrimSuffix(strings.TrimPrefix(line, "*** in database "), " ***")
+				continue
+			}
+
+			if line != "" {
+				r = append(r, schema+": "+line)
+			}
+		}
+	}
+	return r, nil
+}
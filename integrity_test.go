@@ -0,0 +1,99 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type checker interface {
+	IntegrityCheck(ctx context.Context, maxErrors int) ([]string, error)
+	QuickCheck(ctx context.Context, maxErrors int) ([]string, error)
+}
+
+func runChecks(t *testing.T, db *sql.DB, maxErrors int) (integrity, quick []string) {
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if err := c.Raw(func(dc interface{}) (err error) {
+		if integrity, err = dc.(checker).IntegrityCheck(ctx, maxErrors); err != nil {
+			return err
+		}
+
+		quick, err = dc.(checker).QuickCheck(ctx, maxErrors)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return integrity, quick
+}
+
+func TestIntegrityCheck(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+create table t(i, j);
+create index x on t(i);
+insert into t values(1, 10), (2, 20), (3, 30);
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	if integrity, quick := runChecks(t, db, 0); integrity != nil || quick != nil {
+		t.Fatalf("unexpected problems %q, %q", integrity, quick)
+	}
+
+	// Index x now claims to index j, its entries do not match the table.
+	if _, err := db.Exec(`
+pragma writable_schema = on;
+update sqlite_master set sql = 'create index x on t(j)' where name = 'x';
+pragma writable_schema = off;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+	if db, err = sql.Open(driverName, fn); err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	integrity, quick := runChecks(t, db, 0)
+	if len(integrity) < 2 {
+		t.Fatalf("got %q, want several problems", integrity)
+	}
+
+	for _, v := range integrity {
+		if !strings.HasPrefix(v, "main: ") || !strings.Contains(v, "index x") {
+			t.Errorf("unexpected problem %q", v)
+		}
+	}
+
+	// quick_check does not compare indexes to their tables.
+	if quick != nil {
+		t.Errorf("unexpected quick_check problems %q", quick)
+	}
+
+	if integrity, _ = runChecks(t, db, 1); len(integrity) != 1 {
+		t.Errorf("got %q, want 1 problem", integrity)
+	}
+}
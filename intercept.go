@@ -0,0 +1,207 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"time"
+
+	"modernc.org/libc"
+)
+
+// InterceptEventKind is the kind of an InterceptEvent.
+type InterceptEventKind int
+
+// Values of InterceptEventKind.
+const (
+	InterceptExec     InterceptEventKind = iota // SQL is executed by Exec.
+	InterceptQuery                              // SQL is queried, until its rows are closed.
+	InterceptBegin                              // A transaction begins.
+	InterceptCommit                             // A transaction is committed.
+	InterceptRollback                           // A transaction is rolled back.
+	InterceptClose                              // The connection is closed.
+)
+
+// String implements fmt.Stringer.
+func (k InterceptEventKind) String() string {
+	switch k {
+	case InterceptExec:
+		return "exec"
+	case InterceptQuery:
+		return "query"
+	case InterceptBegin:
+		return "begin"
+	case InterceptCommit:
+		return "commit"
+	case InterceptRollback:
+		return "rollback"
+	case InterceptClose:
+		return "close"
+	default:
+		return "InterceptEventKind(?)"
+	}
+}
+
+// InterceptEvent describes an operation of a connection, see WrapDriver.
+type InterceptEvent struct {
+	Kind InterceptEventKind
+	// Conn is the connection performing the operation. It tells apart the
+	// operations of different connections, for example to associate them
+	// with state kept per connection, but must not be used otherwise.
+	Conn driver.Conn
+	// SQL and Args are the statements and their arguments, for InterceptExec
+	// and InterceptQuery. Args must not be modified.
+	SQL  string
+	Args []driver.NamedValue
+	// Start is when the operation started.
+	Start time.Time
+
+	// The remaining fields are set when the operation finished.
+
+	// Duration is the wall time of the operation, measured by the Go
+	// runtime clock. For InterceptQuery it includes reading the rows.
+	Duration time.Duration
+	// RowsAffected is the number of rows changed by InterceptExec.
+	RowsAffected int64
+	// Rows is the number of rows read by InterceptQuery.
+	Rows int64
+	// Err is the error of the operation, or the first error of reading the
+	// rows of InterceptQuery.
+	Err error
+}
+
+// Interceptor is called when a connection starts an operation, with the
+// context of the operation. The function it returns, if not nil, is called
+// when the operation finished, after e was completed. For a transaction, the
+// context of Commit and Rollback is the one passed to BeginTx.
+//
+// Both are called synchronously by the goroutine using the connection and
+// must not use the connection.
+type Interceptor func(ctx context.Context, e *InterceptEvent) (end func())
+
+// WrapDriver returns a driver opening connections like the "sqlite3" driver,
+// which report every Exec, Query, Begin, Commit, Rollback and Close to
+// interceptor,
+// for example to collect metrics, log slow queries or trace requests without
+// changing the code using the database. Statements an operation runs
+// internally, like the PRAGMAs of the _pragma query parameter, are not
+// reported.
+//
+//	sql.Register("sqlite3-logged", sqlite.WrapDriver(func(ctx context.Context, e *sqlite.InterceptEvent) func() {
+//		return func() {
+//			if e.Duration > 100*time.Millisecond {
+//				log.Printf("slow %s %q: %v", e.Kind, e.SQL, e.Duration)
+//			}
+//		}
+//	}))
+//	db, err := sql.Open("sqlite3-logged", "app.db")
+//
+// The functions registered by RegisterScalarFunction and the collations
+// registered by RegisterCollation are available to its connections as well. The module modernc.org/sqlite/otelsqlite builds
+// OpenTelemetry tracing on WrapDriver and SetTracer.
+func WrapDriver(interceptor Interceptor) *Driver {
+	return &Driver{udfs: d.udfs, collations: d.collations, interceptor: interceptor}
+}
+
+// intercept reports the start of the operation e to the interceptor of the
+// connection and returns the function reporting its end with the error err.
+// It returns nil if the connection has no interceptor.
+func (c *conn) intercept(ctx context.Context, e *InterceptEvent) func(err error) {
+	if c.interceptor == nil {
+		return nil
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	e.Conn = c
+	e.Start = time.Now()
+	end := c.interceptor(ctx, e)
+	return func(err error) {
+		if end == nil {
+			return
+		}
+
+		e.Duration = time.Since(e.Start)
+		if e.Err == nil {
+			e.Err = err
+		}
+		end()
+	}
+}
+
+// interceptExec runs exec, the execution of sql with args, reporting it to the
+// interceptor of the connection.
+func (c *conn) interceptExec(ctx context.Context, sql string, args []driver.NamedValue, exec func() (driver.Result, error)) (driver.Result, error) {
+	if c.interceptor == nil {
+		return exec()
+	}
+
+	e := &InterceptEvent{Kind: InterceptExec, SQL: sql, Args: args}
+	end := c.intercept(ctx, e)
+	r, err := exec()
+	if r != nil {
+		e.RowsAffected, _ = r.RowsAffected()
+	}
+	end(err)
+	return r, err
+}
+
+// interceptQuery runs query, the query of sql with args, reporting it to the
+// interceptor of the connection. The end of the query is reported when its
+// rows are closed.
+func (c *conn) interceptQuery(ctx context.Context, sql string, args []driver.NamedValue, query func() (driver.Rows, error)) (driver.Rows, error) {
+	if c.interceptor == nil {
+		return query()
+	}
+
+	e := &InterceptEvent{Kind: InterceptQuery, SQL: sql, Args: args}
+	end := c.intercept(ctx, e)
+	r, err := query()
+	if err != nil {
+		end(err)
+		return nil, err
+	}
+
+	rs := r.(*rows)
+	rs.event = e
+	rs.end = end
+	return rs, nil
+}
+
+// interceptOp runs f, the operation kind not running SQL of its own, like
+// the commit of a transaction, reporting it to the interceptor of the
+// connection.
+func (c *conn) interceptOp(ctx context.Context, kind InterceptEventKind, f func() error) error {
+	end := c.intercept(ctx, &InterceptEvent{Kind: kind})
+	err := f()
+	if end != nil {
+		end(err)
+	}
+	return err
+}
+
+// observe records the result err of rows.Next in the event of an intercepted
+// query.
+func (r *rows) observe(err error) {
+	switch {
+	case err == nil:
+		r.event.Rows++
+	case err != io.EOF && r.event.Err == nil:
+		r.event.Err = err
+	}
+}
+
+// interceptSQL returns the SQL text of the prepared statement s, or "" if the
+// connection has no interceptor.
+func (s *stmt) interceptSQL() string {
+	if s.c.interceptor == nil || s.psql == 0 {
+		return ""
+	}
+
+	return libc.GoString(s.psql)
+}
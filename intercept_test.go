@@ -0,0 +1,147 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWrapDriver(t *testing.T) {
+	if err := RegisterScalarFunction("test_intercept", 0, func(*FunctionContext, []driver.Value) (driver.Value, error) {
+		return int64(42), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	var open int
+	sql.Register("sqlite3-intercept-test", WrapDriver(func(ctx context.Context, e *InterceptEvent) func() {
+		open++
+		return func() {
+			open--
+			if e.Conn == nil {
+				t.Errorf("%v: no connection", e.Kind)
+			}
+			s := e.Kind.String()
+			if e.SQL != "" {
+				s += " " + e.SQL
+			}
+			for _, v := range e.Args {
+				s += fmt.Sprintf(" %v", v.Value)
+			}
+			switch e.Kind {
+			case InterceptExec:
+				s += fmt.Sprintf(" affected=%d", e.RowsAffected)
+			case InterceptQuery:
+				s += fmt.Sprintf(" rows=%d", e.Rows)
+			}
+			if e.Err != nil {
+				s += " error"
+			}
+			if e.Start.IsZero() || e.Duration < 0 {
+				s += " bad timing"
+			}
+			events = append(events, s)
+		}
+	}))
+	db, err := sql.Open("sqlite3-intercept-test", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("create table t(x)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("insert into t values(?), (?)", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("select x from t where x > ?", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for rows.Next() {
+		if open != 1 {
+			t.Errorf("%d operations open before the rows are closed, want 1", open)
+		}
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Query("select nonexistent from t"); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	var n int
+	if err := db.QueryRow("select test_intercept()").Scan(&n); err != nil || n != 42 {
+		t.Fatalf("test_intercept() %d, %v, want 42", n, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tx.Exec("delete from t where x = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if tx, err = db.Begin(); err != nil {
+		t.Fatal(err)
+	}
+
+	stmt, err := tx.Prepare("update t set x = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stmt.Exec(3); err != nil {
+		t.Fatal(err)
+	}
+
+	stmt.Close()
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if open != 0 {
+		t.Errorf("%d operations open, want 0", open)
+	}
+	if g, e := events, []string{
+		"exec create table t(x) affected=0",
+		"exec insert into t values(?), (?) 1 2 affected=2",
+		"query select x from t where x > ? 0 rows=2",
+		"query select nonexistent from t rows=0 error",
+		"query select test_intercept() rows=1",
+		"begin",
+		"exec delete from t where x = 1 affected=1",
+		"rollback",
+		"begin",
+		"exec update t set x = ? 3 affected=2",
+		"commit",
+		"close",
+	}; !reflect.DeepEqual(g, e) {
+		t.Errorf("events\ngot  %q\nwant %q", g, e)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sha3 implements the SHA-3 hash functions of FIPS 202, used by the
+// sha3() SQL function of modernc.org/sqlite.
+package sha3 // import "modernc.org/sqlite/internal/sha3"
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+var rc = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808A, 0x8000000080008000,
+	0x000000000000808B, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008A, 0x0000000000000088, 0x0000000080008009, 0x000000008000000A,
+	0x000000008000808B, 0x800000000000008B, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800A, 0x800000008000000A,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+// Rotation offsets and lane permutation of the rho and pi steps.
+var (
+	rotc = [24]int{1, 3, 6, 10, 15, 21, 28, 36, 45, 55, 2, 14, 27, 41, 56, 8, 25, 43, 62, 18, 39, 61, 20, 44}
+	piln = [24]int{10, 7, 11, 17, 18, 3, 5, 16, 8, 21, 24, 4, 15, 23, 19, 13, 12, 2, 20, 14, 22, 9, 6, 1}
+)
+
+func keccakF(a *[25]uint64) {
+	var c [5]uint64
+	for round := 0; round < 24; round++ {
+		// Theta.
+		for i := 0; i < 5; i++ {
+			c[i] = a[i] ^ a[i+5] ^ a[i+10] ^ a[i+15] ^ a[i+20]
+		}
+		for i := 0; i < 5; i++ {
+			t := c[(i+4)%5] ^ bits.RotateLeft64(c[(i+1)%5], 1)
+			for j := 0; j < 25; j += 5 {
+				a[j+i] ^= t
+			}
+		}
+		// Rho and pi.
+		t := a[1]
+		for i := 0; i < 24; i++ {
+			j := piln[i]
+			t, a[j] = a[j], bits.RotateLeft64(t, rotc[i])
+		}
+		// Chi.
+		for j := 0; j < 25; j += 5 {
+			copy(c[:], a[j:j+5])
+			for i := 0; i < 5; i++ {
+				a[j+i] ^= ^c[(i+1)%5] & c[(i+2)%5]
+			}
+		}
+		// Iota.
+		a[0] ^= rc[round]
+	}
+}
+
+// Sum returns the SHA3 hash of data having size bits. size must be one of
+// 224, 256, 384 or 512.
+func Sum(data []byte, size int) []byte {
+	var a [25]uint64
+	rate := 200 - 2*size/8
+	for len(data) >= rate {
+		absorb(&a, data[:rate])
+		keccakF(&a)
+		data = data[rate:]
+	}
+
+	block := make([]byte, rate)
+	copy(block, data)
+	block[len(data)] ^= 0x06
+	block[rate-1] ^= 0x80
+	absorb(&a, block)
+	keccakF(&a)
+
+	out := make([]byte, 200)
+	for i := range a {
+		binary.LittleEndian.PutUint64(out[8*i:], a[i])
+	}
+	return out[:size/8]
+}
+
+func absorb(a *[25]uint64, block []byte) {
+	for i := 0; i < len(block)/8; i++ {
+		a[i] ^= binary.LittleEndian.Uint64(block[8*i:])
+	}
+}
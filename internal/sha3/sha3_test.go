@@ -0,0 +1,62 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sha3 // import "modernc.org/sqlite/internal/sha3"
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// TestSum checks the FIPS 202 hashes of inputs around the rate of each size,
+// where the padding spills into another block.
+func TestSum(t *testing.T) {
+	for _, v := range []struct {
+		data string
+		size int
+		want string
+	}{
+		{"", 224, "6b4e03423667dbb73b6e15454f0eb1abd4597f9a1b078e3f5b5a6bc7"},
+		{"", 256, "a7ffc6f8bf1ed76651c14756a061d662f580ff4de43b49fa82d80a4b80f8434a"},
+		{"", 384, "0c63a75b845e4f7d01107d852e4c2485c51a50aaaa94fc61995e71bbee983a2ac3713831264adb47fb6bd1e058d5f004"},
+		{"", 512, "a69f73cca23a9ac5c8b567dc185a756e97c982164fe25859e0d1dcc1475c80a615b2123af1f5f94c11e3e9402c3ac558f500199d95b6d3e301758586281dcd26"},
+		{"abc", 224, "e642824c3f8cf24ad09234ee7d3c766fc9a3a5168d0c94ad73b46fdf"},
+		{"abc", 256, "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532"},
+		{"abc", 384, "ec01498288516fc926459f58e2c6ad8df9b473cb0fc08c2596da7cf0e49be4b298d88cea927ac7f539f1edf228376d25"},
+		{"abc", 512, "b751850b1a57168a5693cd924b6b096e08f621827444f70d884f5d0240d2712e10e116e9192af3c91a7ec57647e3934057340b4cf408d5a56592f8274eec53f0"},
+		{strings.Repeat("a", 71), 224, "1d2323974642ca52588f035832c00257b6c5c1b667041a60efbfe221"},
+		{strings.Repeat("a", 71), 256, "788b75537b2b9a3da45a8d56ff647324c2b2354f641651b4d33996682286acbc"},
+		{strings.Repeat("a", 71), 384, "e18bdd25c83206e3f3ca9fdd49b7fac9d7dcc4feafc44481a336ec06c5ecd8408f70a8da97d36f69027b0b03c149c2a7"},
+		{strings.Repeat("a", 71), 512, "070faf98d2a8fddf8ed886408744dc06456096c2e045f26f3c7b010530e6bbb3db535a54d636856f4e0e1e982461cb9a7e8e57ff8895cff1619af9f0e486e28c"},
+		{strings.Repeat("a", 72), 224, "0b98a46d4e243d8c5bfcdd957629fc435c671b15c0d195e39de8efd1"},
+		{strings.Repeat("a", 72), 256, "faf7e2ca748a48eff17f1f0c6b495ab3f2c3dd34c8d335aee79ceff5fe780a01"},
+		{strings.Repeat("a", 72), 384, "36ed8cf277398426c25d4c8cdbf29dd22db8c1298ce34882a7bcc633d65b8db249c2bd6c64e5a4f2edc5a5fc5adc8140"},
+		{strings.Repeat("a", 72), 512, "a8ae722a78e10cbbc413886c02eb5b369a03f6560084aff566bd597bb7ad8c1ccd86e81296852359bf2faddb5153c0a7445722987875e74287adac21adebe952"},
+		{strings.Repeat("a", 135), 224, "f9f28c21a2b0884bbd3594cae82bf811c0c1ede427e083d5576e909d"},
+		{strings.Repeat("a", 135), 256, "8094bb53c44cfb1e67b7c30447f9a1c33696d2463ecc1d9c92538913392843c9"},
+		{strings.Repeat("a", 135), 384, "a2d51907c0611e25c058f0675042e8f53cc473dc347c5ea8a813d886b3aa8f8dcab61a236237d94de404cd66606243f9"},
+		{strings.Repeat("a", 135), 512, "4be1e70276f9122f470a54c27240c7d0709dab7469958b48a950d69da6dd07ca135826d9d23e975cb9283e7d236ef98a80451dca8e311f52096308b2c8d70cc7"},
+		{strings.Repeat("a", 136), 224, "96136a6a094433b4aa855f163829a2ce6bca7d56cfd2163b47f1f1c4"},
+		{strings.Repeat("a", 136), 256, "3fc5559f14db8e453a0a3091edbd2bc25e11528d81c66fa570a4efdcc2695ee1"},
+		{strings.Repeat("a", 136), 384, "cbbcb466417a2f6d466479bb6dc659434d9589de3a53acc9b427580482e305948888c8fa6d069c5e6a899aa34a9af15a"},
+		{strings.Repeat("a", 136), 512, "e50392c91ed95768c8dcf52a12e5db1ecd0347fb995f7ff4ea06994649bbd1a0de7ae36a62aadc00a704d730b52bda191b72951e2afc9b6fb6824787b2086257"},
+		{strings.Repeat("a", 137), 224, "d0c9e8452b199b5149b9d06ec79e70ccd82ffa317bf61196f12b7207"},
+		{strings.Repeat("a", 137), 256, "f8d6846cedd2ccfadf15c5879ef95af724d799eed7391fb1c91f95344e738614"},
+		{strings.Repeat("a", 137), 384, "8a9e401af96cfcdc6ee9e848a2ba4d94be808a753e7673df1252c9706fdef18943dbc7487cdecca0efcfef152891ab03"},
+		{strings.Repeat("a", 137), 512, "c1a51bff785ff8443c873d0f9b9534222f99b476b357091b00f52bcbf214be6c9febe2ab320f6f24c9d770d4ed2708611b4d6f3c03bcd7aec27a1d1d6b5f8768"},
+		{strings.Repeat("a", 144), 224, "f9019111996dcf160e284e320fd6d8825cabcd41a5ffdc4c5e9d64b6"},
+		{strings.Repeat("a", 144), 256, "fe4206d88b37fb533f957c384ad50f2a7cb86a74eb53e4e591f1c07d5c719dcf"},
+		{strings.Repeat("a", 144), 384, "a488d710c7e776359ce145d8383c304cae0e5dbb05ff64536f23caf3c27aa192e8342e271ea98fd30309e00c427cb61e"},
+		{strings.Repeat("a", 144), 512, "446cd4d7ba19510dcc776b21045bc68d424b5b840e14685e149bb238b5f473c0356b69e04f0f5785eefce20ff09e678b080d8aac64568c5edf001cd32b2ed7a8"},
+		{strings.Repeat("a", 200), 224, "455e0ccfc6010738ed93a793dffd79aff36debbd1a7eb6621bd6c722"},
+		{strings.Repeat("a", 200), 256, "cce34485baf2bf2aca99b94833892a4f52896d3d153f7b840cc4f9fe695f1387"},
+		{strings.Repeat("a", 200), 384, "f97756776c1874724c94a8008f7f155553b4bf00fbf8fbeac246624ad59c258a3c0977d9f2543d7cbd75b9ac8fdc0d40"},
+		{strings.Repeat("a", 200), 512, "eae6c85c6904f11075de9f9d5e1064371d000510fa3d2d79d40cf9be34892fb01859d0a0234e138bcb0ad5c84f6c0dca226a414b0c9a2897cb695f5185fe36ec"},
+	} {
+		if g := hex.EncodeToString(Sum([]byte(v.data), v.size)); g != v.want {
+			t.Errorf("SHA3-%d of %d bytes: got %s, want %s", v.size, len(v.data), g, v.want)
+		}
+	}
+}
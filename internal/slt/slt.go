@@ -0,0 +1,433 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package slt interprets test scripts in the sqllogictest format of the SQLite
+// project, see https://www.sqlite.org/sqllogictest/doc/trunk/about.wiki.
+//
+// A script is a sequence of records separated by blank lines. A statement
+// record
+//
+//	statement ok|error
+//	SQL
+//
+// executes SQL and checks whether it succeeds. A query record
+//
+//	query TYPES [nosort|rowsort|valuesort] [LABEL]
+//	SQL
+//	----
+//	RESULTS
+//
+// runs the query SQL and compares its results, one value per line, to
+// RESULTS. TYPES has one letter per column: I for integer, R for real, printed
+// with three decimals, and T for text. NULL is printed as NULL and the empty
+// string as (empty). Results of more than hash-threshold values are given as
+// "N values hashing to MD5". Queries with the same label must have the same
+// results. The conditions skipif and onlyif, naming a database engine,
+// select the records meant for SQLite, halt ends a script early.
+package slt // import "modernc.org/sqlite/internal/slt"
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Engine is the database engine name matched by skipif and onlyif.
+const Engine = "sqlite"
+
+// Error is a failed record of a script.
+type Error struct {
+	Name string // Of the script.
+	Line int    // Of the record.
+	SQL  string
+	Msg  string
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s\n%s", e.Name, e.Line, e.Msg, e.SQL)
+}
+
+// Stats counts the records run by Run.
+type Stats struct {
+	Statements int
+	Queries    int
+	Skipped    int
+}
+
+type record struct {
+	line    int
+	lines   []string
+	sql     string
+	results []string
+}
+
+// Run runs the script read from r against db. The script is named name in
+// the errors returned. Run does not stop at a failed record, it returns the
+// errors of all of them, each an *Error. Reading or parsing errors end the
+// script. The records run on a single connection of db, so a transaction
+// started by one record spans the following ones.
+func Run(db *sql.DB, name string, r io.Reader) (Stats, []error) {
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		return Stats{}, []error{err}
+	}
+
+	defer c.Close()
+
+	var (
+		stats     Stats
+		errs      []error
+		threshold int
+		labels    = map[string]string{}
+	)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	line := 0
+	for {
+		rec, err := next(sc, &line)
+		if err != nil {
+			return stats, append(errs, fmt.Errorf("%s:%d: %v", name, line, err))
+		}
+
+		if rec == nil {
+			return stats, errs
+		}
+
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, &Error{name, rec.line, rec.sql, fmt.Sprintf(format, args...)})
+		}
+		skip := false
+		for len(rec.lines) != 0 {
+			f := strings.Fields(rec.lines[0])
+			if len(f) < 2 || f[0] != "skipif" && f[0] != "onlyif" {
+				break
+			}
+
+			if f[0] == "skipif" && f[1] == Engine || f[0] == "onlyif" && f[1] != Engine {
+				skip = true
+			}
+			rec.lines = rec.lines[1:]
+		}
+		if len(rec.lines) == 0 {
+			continue
+		}
+
+		f := strings.Fields(rec.lines[0])
+		switch {
+		case f[0] == "halt":
+			if !skip {
+				return stats, errs
+			}
+		case f[0] == "hash-threshold" && len(f) == 2:
+			if threshold, err = strconv.Atoi(f[1]); err != nil {
+				return stats, append(errs, fmt.Errorf("%s:%d: invalid hash-threshold %q", name, rec.line, f[1]))
+			}
+		case f[0] == "statement" && len(f) == 2 && (f[1] == "ok" || f[1] == "error"):
+			if skip {
+				stats.Skipped++
+				break
+			}
+
+			stats.Statements++
+			_, err := c.ExecContext(ctx, rec.sql)
+			switch {
+			case f[1] == "ok" && err != nil:
+				fail("unexpected error: %v", err)
+			case f[1] == "error" && err == nil:
+				fail("statement succeeded, error expected")
+			}
+		case f[0] == "query" && len(f) >= 2:
+			if skip {
+				stats.Skipped++
+				break
+			}
+
+			stats.Queries++
+			mode, label := "nosort", ""
+			if len(f) > 2 {
+				mode = f[2]
+			}
+			if len(f) > 3 {
+				label = f[3]
+			}
+			got, err := query(c, rec.sql, f[1], mode)
+			if err != nil {
+				fail("%v", err)
+				break
+			}
+
+			want := rec.results
+			if len(got) > threshold && threshold > 0 || len(want) == 1 && strings.Contains(want[0], " values hashing to ") {
+				got = []string{hash(got)}
+			}
+			if label != "" {
+				if prev, ok := labels[label]; ok && prev != strings.Join(got, "\n") {
+					fail("results of label %s differ:\n%s\nwant\n%s", label, strings.Join(got, "\n"), prev)
+					break
+				}
+
+				labels[label] = strings.Join(got, "\n")
+			}
+			if !equal(got, want) {
+				fail("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		default:
+			return stats, append(errs, fmt.Errorf("%s:%d: invalid record %q", name, rec.line, rec.lines[0]))
+		}
+	}
+}
+
+// next returns the next record, or nil at the end of the script.
+func next(sc *bufio.Scanner, line *int) (*record, error) {
+	var rec *record
+	results := false
+	for sc.Scan() {
+		*line++
+		s := strings.TrimRight(sc.Text(), " \t\r")
+		if strings.HasPrefix(s, "#") {
+			continue
+		}
+
+		if s == "" {
+			if rec != nil {
+				break
+			}
+
+			continue
+		}
+
+		if rec == nil {
+			rec = &record{line: *line}
+		}
+		switch {
+		case results:
+			rec.results = append(rec.results, s)
+		case s == "----":
+			results = true
+		default:
+			rec.lines = append(rec.lines, s)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if rec == nil {
+		return nil, nil
+	}
+
+	// The header is the first line not a condition.
+	for i, s := range rec.lines {
+		if f := strings.Fields(s); f[0] != "skipif" && f[0] != "onlyif" {
+			rec.sql = strings.Join(rec.lines[i+1:], "\n")
+			rec.lines = rec.lines[:i+1]
+			break
+		}
+	}
+	return rec, nil
+}
+
+func query(c *sql.Conn, q, types, mode string) (r []string, err error) {
+	rows, err := c.QueryContext(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cols) != len(types) {
+		return nil, fmt.Errorf("query has %d columns, types %q has %d", len(cols), types, len(types))
+	}
+
+	var table [][]string
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		row := make([]string, len(cols))
+		for i, v := range vals {
+			row[i] = format(v, types[i])
+		}
+		table = append(table, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	switch mode {
+	case "nosort":
+	case "rowsort":
+		sort.Slice(table, func(i, j int) bool {
+			a, b := table[i], table[j]
+			for k := range a {
+				if a[k] != b[k] {
+					return a[k] < b[k]
+				}
+			}
+			return false
+		})
+	case "valuesort":
+	default:
+		return nil, fmt.Errorf("invalid sort mode %q", mode)
+	}
+	for _, row := range table {
+		r = append(r, row...)
+	}
+	if mode == "valuesort" {
+		sort.Strings(r)
+	}
+	return r, nil
+}
+
+// format formats v the way the reference implementation of sqllogictest
+// does.
+func format(v interface{}, typ byte) string {
+	if v == nil {
+		return "NULL"
+	}
+
+	switch typ {
+	case 'I':
+		switch x := v.(type) {
+		case int64:
+			return strconv.FormatInt(x, 10)
+		case float64:
+			return strconv.FormatInt(int64(x), 10)
+		case bool:
+			if x {
+				return "1"
+			}
+			return "0"
+		default:
+			return strconv.FormatInt(atoi(text(v)), 10)
+		}
+	case 'R':
+		switch x := v.(type) {
+		case int64:
+			return fmt.Sprintf("%.3f", float64(x))
+		case float64:
+			return fmt.Sprintf("%.3f", x)
+		default:
+			f, _ := strconv.ParseFloat(strings.TrimSpace(text(v)), 64)
+			return fmt.Sprintf("%.3f", f)
+		}
+	default:
+		s := text(v)
+		if s == "" {
+			return "(empty)"
+		}
+
+		b := []byte(s)
+		for i, c := range b {
+			if c < ' ' || c > '~' {
+				b[i] = '@'
+			}
+		}
+		return string(b)
+	}
+}
+
+// text converts v to text like sqlite3_column_text.
+func text(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return strconv.FormatFloat(x, 'g', -1, 64)
+		}
+
+		s := strconv.FormatFloat(x, 'g', 15, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		return s
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// atoi converts the leading integer of s like sqlite3_column_int64.
+func atoi(s string) int64 {
+	s = strings.TrimLeft(s, " \t\n\r")
+	i := 0
+	if i < len(s) && (s[i] == '-' || s[i] == '+') {
+		i++
+	}
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.ParseInt(s[:i], 10, 64)
+	return n
+}
+
+func hash(vals []string) string {
+	h := md5.New()
+	for _, v := range vals {
+		io.WriteString(h, v)
+		io.WriteString(h, "\n")
+	}
+	return fmt.Sprintf("%d values hashing to %x", len(vals), h.Sum(nil))
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Statements returns the SQL of the statement and query records of the
+// script read from r, whatever their conditions. It is meant for seeding
+// fuzzers.
+func Statements(r io.Reader) ([]string, error) {
+	var a []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	line := 0
+	for {
+		rec, err := next(sc, &line)
+		if err != nil {
+			return a, err
+		}
+
+		if rec == nil {
+			return a, nil
+		}
+
+		if rec.sql != "" {
+			a = append(a, rec.sql)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package kv provides a key-value store backed by an SQLite database. Keys
+// and values are byte slices, keys are ordered bytewise. An entry can expire
+// after a time to live, expired entries are invisible and are deleted by
+// Sweep or, optionally, by a background goroutine.
+//
+// The database is opened in WAL mode, so readers do not block the writer and
+// the writer does not block readers, see https://www.sqlite.org/wal.html.
+package kv // import "modernc.org/sqlite/kv"
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// ErrNotFound is returned by Get for a key not in the store.
+var ErrNotFound = errors.New("kv: key not found")
+
+// Options configure Open.
+type Options struct {
+	// Table is the name of the table holding the entries, "kv" if empty.
+	Table string
+	// SweepInterval, if positive, starts a goroutine deleting the expired
+	// entries every SweepInterval.
+	SweepInterval time.Duration
+}
+
+// Store is a key-value store. It is safe for concurrent use.
+type Store struct {
+	db *sql.DB
+
+	get, set, del, sweep, iter, iterAll *sql.Stmt
+
+	mu  sync.Mutex
+	err error // Of the last sweep by the goroutine.
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// Open opens the store in the database name, a data source name as passed to
+// sql.Open for this driver, creating the database and the table of the
+// entries if they do not exist. The options may be nil.
+func Open(name string, opts *Options) (s *Store, err error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	table := opts.Table
+	if table == "" {
+		table = "kv"
+	}
+
+	sep := "?"
+	if strings.Contains(name, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("sqlite3", name+sep+"_pragma=journal_mode(wal)&_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+
+	s = &Store{db: db}
+
+	defer func() {
+		if err != nil {
+			s.closeStmts()
+			db.Close()
+			s = nil
+		}
+	}()
+
+	q := quoteIdentifier(table)
+	if _, err := db.Exec(fmt.Sprintf(`
+create table if not exists %[1]s(k blob primary key, v blob not null, expires integer) without rowid;
+create index if not exists %[2]s on %[1]s(expires) where expires is not null;
+`, q, quoteIdentifier(table+"_expires"))); err != nil {
+		return nil, err
+	}
+
+	for _, v := range []struct {
+		stmt **sql.Stmt
+		sql  string
+	}{
+		{&s.get, "select v from %s where k = ? and (expires is null or expires > ?)"},
+		{&s.set, "insert into %s(k, v, expires) values(?, ?, ?) on conflict(k) do update set v = excluded.v, expires = excluded.expires"},
+		{&s.del, "delete from %s where k = ? and (expires is null or expires > ?)"},
+		{&s.sweep, "delete from %s where expires <= ?"},
+		{&s.iter, "select k, v from %s where k >= ? and k < ? and (expires is null or expires > ?) order by k"},
+		{&s.iterAll, "select k, v from %s where k >= ? and (expires is null or expires > ?) order by k"},
+	} {
+		if *v.stmt, err = db.Prepare(fmt.Sprintf(v.sql, q)); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.SweepInterval > 0 {
+		s.done = make(chan struct{})
+		s.stopped = make(chan struct{})
+		go s.run(opts.SweepInterval)
+	}
+	return s, nil
+}
+
+// DB returns the database of s.
+func (s *Store) DB() *sql.DB { return s.db }
+
+func now() int64 { return time.Now().UnixNano() }
+
+// Get returns the value of key. It returns ErrNotFound if key is not in the
+// store or its entry expired.
+func (s *Store) Get(ctx context.Context, key []byte) (v []byte, err error) {
+	switch err = s.get.QueryRowContext(ctx, key, now()).Scan(&v); {
+	case err == sql.ErrNoRows:
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	if v == nil {
+		v = []byte{}
+	}
+	return v, nil
+}
+
+// Set sets the value of key, replacing its existing entry.
+func (s *Store) Set(ctx context.Context, key, value []byte) error {
+	return s.SetTTL(ctx, key, value, 0)
+}
+
+// SetTTL sets the value of key, replacing its existing entry. If ttl is
+// positive, the entry expires after ttl.
+func (s *Store) SetTTL(ctx context.Context, key, value []byte, ttl time.Duration) error {
+	var expires interface{}
+	if ttl > 0 {
+		expires = now() + int64(ttl)
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := s.set.ExecContext(ctx, key, value, expires)
+	return err
+}
+
+// Delete removes key from the store. It reports whether key was in the
+// store.
+func (s *Store) Delete(ctx context.Context, key []byte) (bool, error) {
+	r, err := s.del.ExecContext(ctx, key, now())
+	if err != nil {
+		return false, err
+	}
+
+	n, err := r.RowsAffected()
+	return n != 0, err
+}
+
+// Iterate calls fn for the entries whose keys start with prefix, all entries
+// if prefix is empty, in key order. An error returned by fn stops the
+// iteration and is returned by Iterate. The slices passed to fn are valid
+// only until fn returns.
+func (s *Store) Iterate(ctx context.Context, prefix []byte, fn func(key, value []byte) error) error {
+	var rows *sql.Rows
+	var err error
+	if end := prefixEnd(prefix); end != nil {
+		rows, err = s.iter.QueryContext(ctx, prefix, end, now())
+	} else {
+		rows, err = s.iterAll.QueryContext(ctx, append([]byte{}, prefix...), now())
+	}
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var k, v sql.RawBytes
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return rows.Close()
+}
+
+// prefixEnd returns the least key greater than all keys starting with
+// prefix, or nil if there is none.
+func prefixEnd(prefix []byte) []byte {
+	end := bytes.TrimRight(prefix, "\xff")
+	if len(end) == 0 {
+		return nil
+	}
+
+	end = append([]byte(nil), end...)
+	end[len(end)-1]++
+	return end
+}
+
+// Sweep deletes the expired entries and returns their number.
+func (s *Store) Sweep(ctx context.Context) (int64, error) {
+	r, err := s.sweep.ExecContext(ctx, now())
+	if err != nil {
+		return 0, err
+	}
+
+	return r.RowsAffected()
+}
+
+// Err returns the error of the last sweep by the goroutine started by Open,
+// nil if it succeeded.
+func (s *Store) Err() error {
+	s.mu.Lock()
+
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *Store) run(interval time.Duration) {
+	defer close(s.stopped)
+
+	t := time.NewTicker(interval)
+
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-s.done:
+			return
+		}
+
+		_, err := s.Sweep(context.Background())
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+	}
+}
+
+// Close stops the sweeping goroutine, if any, and closes the database.
+func (s *Store) Close() error {
+	if s.done != nil {
+		s.closeOnce.Do(func() { close(s.done) })
+		<-s.stopped
+	}
+	s.closeStmts()
+	return s.db.Close()
+}
+
+func (s *Store) closeStmts() {
+	for _, v := range []*sql.Stmt{s.get, s.set, s.del, s.sweep, s.iter, s.iterAll} {
+		if v != nil {
+			v.Close()
+		}
+	}
+}
+
+// quoteIdentifier returns s quoted as an SQL identifier.
+func quoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
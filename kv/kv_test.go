@@ -0,0 +1,124 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kv_test // import "modernc.org/sqlite/kv"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"modernc.org/sqlite/kv"
+)
+
+func TestStore(t *testing.T) {
+	s, err := kv.Open(filepath.Join(t.TempDir(), "test.db"), &kv.Options{SweepInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	var mode string
+	if err := s.DB().QueryRow("pragma journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("journal mode %q, %v", mode, err)
+	}
+
+	ctx := context.Background()
+	for _, k := range []string{"a", "b\xff", "b\xff\xff", "b\xff\x00", "ba", "c"} {
+		if err := s.Set(ctx, []byte(k), []byte("v"+k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Set(ctx, []byte("a"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := s.Get(ctx, []byte("a")); err != nil || v == nil || len(v) != 0 {
+		t.Fatalf("%q, %v", v, err)
+	}
+
+	if v, err := s.Get(ctx, []byte("ba")); err != nil || string(v) != "vba" {
+		t.Fatalf("%q, %v", v, err)
+	}
+
+	if _, err := s.Get(ctx, []byte("x")); err != kv.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	keys := func(prefix string) string {
+		t.Helper()
+		var a []string
+		if err := s.Iterate(ctx, []byte(prefix), func(k, v []byte) error {
+			if string(v) != "v"+string(k) && len(v) != 0 {
+				return fmt.Errorf("%q: %q", k, v)
+			}
+
+			a = append(a, fmt.Sprintf("%q", k))
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		return strings.Join(a, " ")
+	}
+
+	for _, v := range []struct{ prefix, keys string }{
+		{"", `"a" "ba" "b\xff" "b\xff\x00" "b\xff\xff" "c"`},
+		{"b", `"ba" "b\xff" "b\xff\x00" "b\xff\xff"`},
+		{"b\xff", `"b\xff" "b\xff\x00" "b\xff\xff"`},
+		{"b\xff\xff", `"b\xff\xff"`},
+		{"d", ""},
+	} {
+		if g := keys(v.prefix); g != v.keys {
+			t.Errorf("prefix %q: got %s, want %s", v.prefix, g, v.keys)
+		}
+	}
+
+	stop := errors.New("stop")
+	if err := s.Iterate(ctx, nil, func(k, v []byte) error { return stop }); err != stop {
+		t.Fatalf("got %v, want %v", err, stop)
+	}
+
+	if ok, err := s.Delete(ctx, []byte("c")); !ok || err != nil {
+		t.Fatal(ok, err)
+	}
+
+	if ok, err := s.Delete(ctx, []byte("c")); ok || err != nil {
+		t.Fatal(ok, err)
+	}
+
+	if err := s.SetTTL(ctx, []byte("ttl"), []byte("x"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(ctx, []byte("ttl")); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := s.Get(ctx, []byte("ttl")); err != kv.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	var n int
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(time.Millisecond) {
+		if err := s.DB().QueryRow("select count(*) from kv where k = x'74746c'").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+
+		if n == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expired entry not swept, last error %v", s.Err())
+		}
+	}
+}
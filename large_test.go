@@ -0,0 +1,166 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var oLarge = flag.Bool("large", false, "run tests writing databases larger than 4GB, needs about 5GB of disk space")
+
+// TestLargeRowid checks rowids, counters and sums beyond the range of 32 bit
+// integers, which are used on 386 and arm.
+func TestLargeRowid(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(id integer primary key, x)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var sum int64
+	for _, id := range []int64{math.MaxInt32, math.MaxInt32 + 1, math.MaxUint32, math.MaxUint32 + 1, math.MaxInt64 - 1} {
+		r, err := db.Exec("insert into t values(?, ?)", id, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := r.LastInsertId()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != id {
+			t.Errorf("LastInsertId %d, want %d", got, id)
+		}
+
+		if id < math.MaxInt64/2 {
+			sum += id
+		}
+	}
+
+	// The next automatic rowid follows the largest one.
+	r, err := db.Exec("insert into t(x) values(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := r.LastInsertId(); err != nil || id != math.MaxInt64 {
+		t.Errorf("LastInsertId %d, %v, want %d", id, err, int64(math.MaxInt64))
+	}
+
+	var got int64
+	if err := db.QueryRow("select sum(x) from t where x < ?", int64(math.MaxInt64/2)).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got != sum {
+		t.Errorf("sum %d, want %d", got, sum)
+	}
+
+	if r, err = db.Exec("update t set x = x / 2 where id > ?", math.MaxInt32); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := r.RowsAffected(); err != nil || n != 5 {
+		t.Errorf("RowsAffected %d, %v, want 5", n, err)
+	}
+}
+
+// TestLargeDatabase checks a database file larger than 4GB can be written
+// and read back, in particular on 32 bit targets. It runs only with -large.
+//
+//	$ GOARCH=386 go test -run TestLargeDatabase -large
+func TestLargeDatabase(t *testing.T) {
+	if !*oLarge {
+		t.Skip("needs -large")
+	}
+
+	name := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, name+"?_pragma=page_size(65536)&_pragma=journal_mode(off)&_pragma=synchronous(off)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { db.Close() }()
+
+	const n, blobSize = 80, 64 << 20
+	if _, err := db.Exec("create table t(id integer primary key, b blob)"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		if _, err := db.Exec("insert into t(b) values(zeroblob(?))", blobSize); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+
+	// A row stored completely beyond 4GB.
+	last := []byte("last row")
+	if _, err := db.Exec("insert into t(b) values(?)", last); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi.Size() <= math.MaxUint32 {
+		t.Fatalf("file size %d, want more than 4GB", fi.Size())
+	}
+
+	var pages, pageSize int64
+	if err := db.QueryRow("select page_count, page_size from pragma_page_count, pragma_page_size").Scan(&pages, &pageSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if pages*pageSize != fi.Size() {
+		t.Errorf("%d pages of %d bytes, file size %d", pages, pageSize, fi.Size())
+	}
+
+	var count, total int64
+	if err := db.QueryRow("select count(*), sum(length(b)) from t").Scan(&count, &total); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := total, int64(n)*blobSize+int64(len(last)); count != n+1 || g != e {
+		t.Errorf("%d rows of %d bytes, want %d rows of %d bytes", count, g, n+1, e)
+	}
+
+	var b []byte
+	if err := db.QueryRow("select b from t where id = ?", n+1).Scan(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, last) {
+		t.Errorf("last row %q, want %q", b, last)
+	}
+
+	if _, err := db.Exec("update t set b = x'ff' where id = ?", n); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+	if db, err = sql.Open(driverName, name); err != nil {
+		t.Fatal(err)
+	}
+
+	var check string
+	if err := db.QueryRow("pragma quick_check").Scan(&check); err != nil {
+		t.Fatal(err)
+	}
+
+	if check != "ok" {
+		t.Errorf("quick_check: %s", check)
+	}
+}
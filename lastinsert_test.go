@@ -0,0 +1,224 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestLastInsertIdPool checks Result.LastInsertId reports on the connection
+// which executed the statement when a pool of connections inserts
+// concurrently.
+func TestLastInsertIdPool(t *testing.T) {
+	db, err := sql.Open(driverName, "file:"+uriEscape(filepath.Join(t.TempDir(), "test.db"))+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(wal)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(4)
+	if _, err := db.Exec("create table t(id integer primary key, k text unique)"); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, n = 4, 50
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < n; i++ {
+				k := fmt.Sprintf("%d-%d", w, i)
+				r, err := db.Exec("insert into t(k) values(?)", k)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				id, err := r.LastInsertId()
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				var got string
+				if err := db.QueryRow("select k from t where id = ?", id).Scan(&got); err != nil {
+					errs <- err
+					return
+				}
+
+				if got != k {
+					errs <- fmt.Errorf("LastInsertId %d is the row of %q, want %q", id, got, k)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// The SQL function last_insert_rowid() is only meaningful on the
+	// connection which inserted, pin it with a *sql.Conn.
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	r, err := c.ExecContext(ctx, "insert into t(k) values('pinned')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := r.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sqlID int64
+	if err := c.QueryRowContext(ctx, "select last_insert_rowid()").Scan(&sqlID); err != nil {
+		t.Fatal(err)
+	}
+
+	if sqlID != id {
+		t.Errorf("last_insert_rowid() %d, want %d", sqlID, id)
+	}
+
+	var rawID int64
+	if err := c.Raw(func(driverConn interface{}) error {
+		dc := driverConn.(*conn)
+		rawID = dc.LastInsertRowID()
+		dc.SetLastInsertRowID(42)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rawID != id {
+		t.Errorf("LastInsertRowID %d, want %d", rawID, id)
+	}
+
+	if err := c.QueryRowContext(ctx, "select last_insert_rowid()").Scan(&sqlID); err != nil {
+		t.Fatal(err)
+	}
+
+	if sqlID != 42 {
+		t.Errorf("last_insert_rowid() %d after SetLastInsertRowID, want 42", sqlID)
+	}
+}
+
+// TestLastInsertIdVirtualTable checks LastInsertId of an insert into a
+// virtual table writing to a shadow table.
+func TestLastInsertIdVirtualTable(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec("create virtual table s using spellfix1; create table u(x)"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		sql string
+		id  int64
+	}{
+		{"insert into u values(1)", 1},
+		{"insert into s(word) values('hello')", 1},
+		{"insert into s(rowid, word) values(10, 'world')", 10},
+		{"insert into u values(2)", 2},
+		{"insert into s(word) values('again')", 11},
+	} {
+		r, err := db.Exec(v.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", v.sql, err)
+		}
+
+		id, err := r.LastInsertId()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if id != v.id {
+			t.Errorf("%s: LastInsertId %d, want %d", v.sql, id, v.id)
+		}
+	}
+}
+
+// TestChanges checks Changes and TotalChanges count the rows of a trigger
+// cascade.
+func TestChanges(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+create table p(id integer primary key);
+create table c(p int references p(id) on delete cascade);
+create table log(n);
+create trigger tr after insert on p begin insert into log values(new.id); end;
+pragma foreign_keys = on;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	counters := func() (changes, total int64) {
+		if err := c.Raw(func(driverConn interface{}) error {
+			dc := driverConn.(*conn)
+			changes, total = dc.Changes(), dc.TotalChanges()
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return changes, total
+	}
+
+	_, total0 := counters()
+	for i, v := range []struct {
+		sql     string
+		changes int64
+		total   int64
+	}{
+		{"insert into p values(1), (2), (3)", 3, 6},
+		{"insert into c values(1), (1), (2)", 3, 3},
+		{"delete from p where id < 3", 2, 5},
+	} {
+		r, err := c.ExecContext(ctx, v.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", v.sql, err)
+		}
+
+		affected, err := r.RowsAffected()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		changes, total := counters()
+		if affected != v.changes || changes != v.changes || total-total0 != v.total {
+			t.Errorf("%d: %s: affected %d, changes %d, total %d, want %d, %d, %d", i, v.sql, affected, changes, total-total0, v.changes, v.changes, v.total)
+		}
+		total0 = total
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DBConfig is a boolean option of a connection, see
+// https://www.sqlite.org/c3ref/c_dbconfig_defensive.html.
+type DBConfig int32
+
+// Values of DBConfig.
+const (
+	DBConfigEnableFKey       DBConfig = sqlite3.SQLITE_DBCONFIG_ENABLE_FKEY        // Enforce foreign key constraints.
+	DBConfigEnableTrigger    DBConfig = sqlite3.SQLITE_DBCONFIG_ENABLE_TRIGGER     // Run triggers.
+	DBConfigEnableView       DBConfig = sqlite3.SQLITE_DBCONFIG_ENABLE_VIEW        // Allow using views.
+	DBConfigNoCkptOnClose    DBConfig = sqlite3.SQLITE_DBCONFIG_NO_CKPT_ON_CLOSE   // Do not checkpoint the WAL when closing.
+	DBConfigEnableQPSG       DBConfig = sqlite3.SQLITE_DBCONFIG_ENABLE_QPSG        // Query planner stability guarantee.
+	DBConfigTriggerEQP       DBConfig = sqlite3.SQLITE_DBCONFIG_TRIGGER_EQP        // EXPLAIN QUERY PLAN shows triggers.
+	DBConfigDefensive        DBConfig = sqlite3.SQLITE_DBCONFIG_DEFENSIVE          // Disallow SQL that can corrupt the database.
+	DBConfigWritableSchema   DBConfig = sqlite3.SQLITE_DBCONFIG_WRITABLE_SCHEMA    // Allow writing sqlite_schema.
+	DBConfigLegacyAlterTable DBConfig = sqlite3.SQLITE_DBCONFIG_LEGACY_ALTER_TABLE // Legacy ALTER TABLE RENAME.
+	DBConfigDQSDML           DBConfig = sqlite3.SQLITE_DBCONFIG_DQS_DML            // Double quoted strings in DML.
+	DBConfigDQSDDL           DBConfig = sqlite3.SQLITE_DBCONFIG_DQS_DDL            // Double quoted strings in DDL.
+	DBConfigLegacyFileFormat DBConfig = sqlite3.SQLITE_DBCONFIG_LEGACY_FILE_FORMAT // Create databases in the legacy format.
+	DBConfigTrustedSchema    DBConfig = sqlite3.SQLITE_DBCONFIG_TRUSTED_SCHEMA     // Allow functions with side effects in the schema.
+)
+
+// Limit identifies a run-time limit of a connection, see
+// https://www.sqlite.org/c3ref/c_limit_attached.html.
+type Limit int32
+
+// Values of Limit.
+const (
+	LimitLength            Limit = sqlite3.SQLITE_LIMIT_LENGTH              // Size of a string, blob or row.
+	LimitSQLLength         Limit = sqlite3.SQLITE_LIMIT_SQL_LENGTH          // Length of an SQL statement, in bytes.
+	LimitColumn            Limit = sqlite3.SQLITE_LIMIT_COLUMN              // Columns of a table, index, result set etc.
+	LimitExprDepth         Limit = sqlite3.SQLITE_LIMIT_EXPR_DEPTH          // Depth of the parse tree of an expression.
+	LimitCompoundSelect    Limit = sqlite3.SQLITE_LIMIT_COMPOUND_SELECT     // Terms of a compound SELECT.
+	LimitVDBEOp            Limit = sqlite3.SQLITE_LIMIT_VDBE_OP             // Virtual machine instructions of a statement.
+	LimitFunctionArg       Limit = sqlite3.SQLITE_LIMIT_FUNCTION_ARG        // Arguments of a function.
+	LimitAttached          Limit = sqlite3.SQLITE_LIMIT_ATTACHED            // Attached databases.
+	LimitLikePatternLength Limit = sqlite3.SQLITE_LIMIT_LIKE_PATTERN_LENGTH // Length of a LIKE or GLOB pattern.
+	LimitVariableNumber    Limit = sqlite3.SQLITE_LIMIT_VARIABLE_NUMBER     // Index of a parameter.
+	LimitTriggerDepth      Limit = sqlite3.SQLITE_LIMIT_TRIGGER_DEPTH       // Depth of recursive triggers.
+	LimitWorkerThreads     Limit = sqlite3.SQLITE_LIMIT_WORKER_THREADS      // Auxiliary threads of a statement.
+)
+
+// SetDBConfig turns the option op of the connection on or off and returns its
+// new state. See also Harden.
+//
+// SetDBConfig, DBConfig, SetLimit, Limit and Harden can be reached using
+// (*sql.Conn).Raw. The settings apply to that connection only.
+func (c *conn) SetDBConfig(op DBConfig, on bool) (bool, error) {
+	v := int32(0)
+	if on {
+		v = 1
+	}
+	return c.dbConfig(op, v)
+}
+
+// DBConfig reports whether the option op of the connection is on.
+func (c *conn) DBConfig(op DBConfig) (bool, error) {
+	return c.dbConfig(op, -1)
+}
+
+// int sqlite3_db_config(sqlite3*, int op, ...);
+func (c *conn) dbConfig(op DBConfig, v int32) (bool, error) {
+	p, err := c.malloc(3 * 8)
+	if err != nil {
+		return false, err
+	}
+
+	defer c.free(p)
+
+	pRes := p + 2*8
+	*(*int32)(unsafe.Pointer(pRes)) = 0
+	if rc := sqlite3.Xsqlite3_db_config(c.tls, c.db, int32(op), libc.VaList(p, v, pRes)); rc != sqlite3.SQLITE_OK {
+		return false, c.errstr(rc)
+	}
+
+	return *(*int32)(unsafe.Pointer(pRes)) != 0, nil
+}
+
+// SetLimit sets the limit id of the connection to value and returns the
+// previous value. A negative value leaves the limit unchanged. Values larger
+// than the maximum compiled into SQLite are truncated to that maximum.
+func (c *conn) SetLimit(id Limit, value int) int {
+	if value > 1<<31-1 {
+		value = 1<<31 - 1
+	}
+	// int sqlite3_limit(sqlite3*, int id, int newVal);
+	return int(sqlite3.Xsqlite3_limit(c.tls, c.db, int32(id), int32(value)))
+}
+
+// Limit returns the current value of the limit id of the connection.
+func (c *conn) Limit(id Limit) int {
+	return c.SetLimit(id, -1)
+}
+
+// Harden configures the connection for executing untrusted SQL: it turns on
+// DBConfigDefensive and turns off DBConfigTrustedSchema,
+// DBConfigWritableSchema, DBConfigDQSDML and DBConfigDQSDDL. See
+// https://www.sqlite.org/security.html for further measures, like
+// lowering limits using SetLimit.
+func (c *conn) Harden() error {
+	for _, v := range []struct {
+		op DBConfig
+		on bool
+	}{
+		{DBConfigDefensive, true},
+		{DBConfigTrustedSchema, false},
+		{DBConfigWritableSchema, false},
+		{DBConfigDQSDML, false},
+		{DBConfigDQSDDL, false},
+	} {
+		if _, err := c.SetDBConfig(v.op, v.on); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func TestDBConfig(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if _, err := c.ExecContext(ctx, "create table t(i); create table log(i); create trigger tr after insert on t begin insert into log values(new.i); end"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Raw(func(dc interface{}) error {
+		cn := dc.(*conn)
+		if on, err := cn.DBConfig(DBConfigEnableFKey); err != nil || on {
+			t.Fatalf("foreign keys: %v %v, want off", on, err)
+		}
+
+		if on, err := cn.SetDBConfig(DBConfigEnableFKey, true); err != nil || !on {
+			t.Fatalf("foreign keys: %v %v, want on", on, err)
+		}
+
+		if on, err := cn.SetDBConfig(DBConfigEnableTrigger, false); err != nil || on {
+			t.Fatalf("triggers: %v %v, want off", on, err)
+		}
+
+		if _, err := cn.SetDBConfig(DBConfig(-1), true); err == nil {
+			t.Fatal("unexpected success setting an unknown option")
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var fk, n int
+	if err := c.QueryRowContext(ctx, "pragma foreign_keys").Scan(&fk); err != nil || fk != 1 {
+		t.Fatalf("pragma foreign_keys %v %v, want 1", fk, err)
+	}
+
+	if _, err := c.ExecContext(ctx, "insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.QueryRowContext(ctx, "select count(*) from log").Scan(&n); err != nil || n != 0 {
+		t.Fatalf("trigger ran: %v %v", n, err)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	var max, prev int
+	if err := c.Raw(func(dc interface{}) error {
+		cn := dc.(*conn)
+		max = cn.Limit(LimitLength)
+		prev = cn.SetLimit(LimitLength, 100)
+		if g := cn.Limit(LimitLength); g != 100 {
+			t.Fatalf("got %d, want 100", g)
+		}
+
+		cn.SetLimit(LimitAttached, 0)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if prev != max || max <= 100 {
+		t.Fatalf("previous limit %d, want %d", prev, max)
+	}
+
+	var e *Error
+	if _, err := c.ExecContext(ctx, "select randomblob(101)"); !errors.As(err, &e) || e.Code() != sqlite3.SQLITE_TOOBIG {
+		t.Fatalf("got %v, want SQLITE_TOOBIG", err)
+	}
+
+	if _, err := c.ExecContext(ctx, "select randomblob(100)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ExecContext(ctx, "attach ':memory:' as aux"); err == nil || !strings.Contains(err.Error(), "too many attached databases") {
+		t.Fatalf("got %v, want too many attached databases", err)
+	}
+
+	// Values above the compiled maximum are truncated to it.
+	if err := c.Raw(func(dc interface{}) error {
+		cn := dc.(*conn)
+		cn.SetLimit(LimitLength, 1<<31-1)
+		if g := cn.Limit(LimitLength); g != max {
+			t.Fatalf("got %d, want %d", g, max)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHarden(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if _, err := c.ExecContext(ctx, `select "dqs"`); err != nil {
+		t.Fatalf("double quoted string: %v", err)
+	}
+
+	if err := c.Raw(func(dc interface{}) error {
+		cn := dc.(*conn)
+		if err := cn.Harden(); err != nil {
+			return err
+		}
+
+		for _, v := range []struct {
+			op DBConfig
+			on bool
+		}{
+			{DBConfigDefensive, true},
+			{DBConfigTrustedSchema, false},
+			{DBConfigWritableSchema, false},
+			{DBConfigDQSDML, false},
+			{DBConfigDQSDDL, false},
+		} {
+			if on, err := cn.DBConfig(v.op); err != nil || on != v.on {
+				t.Errorf("%d: got %v %v, want %v", v.op, on, err, v.on)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ExecContext(ctx, `select "dqs"`); err == nil || !strings.Contains(err.Error(), "no such column: dqs") {
+		t.Fatalf("got %v, want no such column", err)
+	}
+
+	// Defensive mode ignores writable_schema.
+	if _, err := c.ExecContext(ctx, "create table t(i); pragma writable_schema = on"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ExecContext(ctx, "update sqlite_master set sql = 'create table t(j)'"); err == nil {
+		t.Fatal("unexpected success writing the schema")
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"runtime"
+)
+
+// SetLockingMode sets the locking mode of the databases of the connection,
+// see https://www.sqlite.org/pragma.html#pragma_locking_mode. In exclusive
+// mode the file locks are acquired by the next read or write and not released
+// until the mode is switched back to normal, which saves the locking system
+// calls of every transaction but prevents any other connection from using the
+// database. Switching back to normal releases the locks right away.
+//
+// SetLockingMode can be reached using (*sql.Conn).Raw.
+func (c *conn) SetLockingMode(exclusive bool) error {
+	mode := "normal"
+	if exclusive {
+		mode = "exclusive"
+	}
+	if _, err := c.Pragma("locking_mode", mode); err != nil {
+		return err
+	}
+
+	if exclusive {
+		return nil
+	}
+
+	// The locks are released by the next access of the database.
+	if c.autocommit() {
+		_, err := c.pragma(context.Background(), "schema_version")
+		return err
+	}
+
+	return nil
+}
+
+// OpenExclusive opens the database name, see Driver.Open, for use by a single
+// process. The returned handle has one long lived connection which holds the
+// database file locked in exclusive locking mode, see SetLockingMode. This
+// speeds up small transactions, especially on file systems where locking is
+// slow, like network file systems. Other processes cannot access the database
+// until the handle is closed.
+func OpenExclusive(name string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", addQuery(name, "_pragma=locking_mode(exclusive)"))
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	return db, nil
+}
+
+// withLocking handles the _locking query parameter by selecting the VFS
+// implementing the locking method for the database name dsn.
+func withLocking(dsn, query string) (string, error) {
+	q, err := url.ParseQuery(query)
+	if err != nil { // Reported by applyQueryParams.
+		return dsn, nil
+	}
+
+	mode := q.Get("_locking")
+	if mode == "" {
+		return dsn, nil
+	}
+
+	if q.Get("vfs") != "" {
+		return "", fmt.Errorf("sqlite: _locking and vfs are mutually exclusive")
+	}
+
+	if runtime.GOOS == "windows" {
+		return "", fmt.Errorf("sqlite: _locking is not supported on Windows")
+	}
+
+	var vfs string
+	switch mode {
+	case "posix":
+		vfs = "unix"
+	case "dotfile":
+		vfs = "unix-dotfile"
+	case "none":
+		vfs = "unix-none"
+	case "ofd":
+		if vfs, err = registerOFDVFS(); err != nil {
+			return "", err
+		}
+	case "flock":
+		if vfs, err = registerFlockVFS(); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("sqlite: invalid _locking %q", mode)
+	}
+	return withURIParameter(dsn, "vfs", vfs), nil
+}
@@ -0,0 +1,281 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// TestLocking checks the locking methods selected by _locking.
+func TestLocking(t *testing.T) {
+	dir := t.TempDir()
+	for _, v := range []struct {
+		locking string
+		journal string
+	}{
+		{"posix", "wal"},
+		{"ofd", "wal"},
+		{"flock", "delete"},
+		{"dotfile", "delete"},
+		{"none", "delete"},
+	} {
+		name := filepath.Join(dir, v.locking+".db")
+		db, err := sql.Open(driverName, name+"?_locking="+v.locking)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var journal string
+		if err := db.QueryRow("pragma journal_mode = wal").Scan(&journal); err != nil {
+			t.Fatalf("%s: %v", v.locking, err)
+		}
+
+		if journal != v.journal {
+			t.Errorf("%s: journal mode %s, want %s", v.locking, journal, v.journal)
+		}
+
+		if _, err := db.Exec("create table t(i); insert into t values(1)"); err != nil {
+			t.Fatalf("%s: %v", v.locking, err)
+		}
+
+		db.Close()
+	}
+
+	for _, dsn := range []string{
+		"x.db?_locking=fcntl",
+		"x.db?_locking=ofd&vfs=unix",
+	} {
+		db, err := sql.Open(driverName, filepath.Join(dir, dsn))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Ping(); err == nil {
+			t.Errorf("%s: unexpected success", dsn)
+		}
+		db.Close()
+	}
+}
+
+// TestLockingOFD checks connections using OFD locks exclude each other and
+// keep their locks when the process closes another file descriptor of the
+// database.
+func TestLockingOFD(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, name+"?_locking=ofd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	a, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer a.Close()
+
+	b, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer b.Close()
+
+	if _, err := a.ExecContext(ctx, "begin immediate"); err != nil {
+		t.Fatal(err)
+	}
+
+	var e *Error
+	if _, err := b.ExecContext(ctx, "begin immediate"); !errors.As(err, &e) || e.Code() != sqlite3.SQLITE_BUSY {
+		t.Fatalf("got %v, want SQLITE_BUSY", err)
+	}
+
+	if _, err := a.ExecContext(ctx, "commit"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a holds a shared lock while reading.
+	if _, err := a.ExecContext(ctx, "begin; select count(*) from t"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Would drop all the POSIX locks of the process on the file.
+	f.Close()
+
+	f, err = os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	lk := unix.Flock_t{Type: unix.F_WRLCK, Start: ofdSharedFirst, Len: ofdSharedSize}
+	if err := unix.FcntlFlock(f.Fd(), unix.F_OFD_GETLK, &lk); err != nil {
+		t.Fatal(err)
+	}
+
+	if lk.Type != unix.F_RDLCK {
+		t.Errorf("shared lock lost, got lock type %d", lk.Type)
+	}
+
+	if _, err := a.ExecContext(ctx, "commit"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.ExecContext(ctx, "begin immediate; insert into t values(1); commit"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLockingFallback checks the fallback locking methods exclude other
+// connections while a connection reads.
+func TestLockingFallback(t *testing.T) {
+	for _, locking := range []string{"flock", "dotfile"} {
+		name := filepath.Join(t.TempDir(), "test.db")
+		db, err := sql.Open(driverName, name+"?_locking="+locking)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec("create table t(i)"); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := context.Background()
+		a, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := a.ExecContext(ctx, "begin; select count(*) from t"); err != nil {
+			t.Fatal(err)
+		}
+
+		var n int
+		var e *Error
+		if err := b.QueryRowContext(ctx, "select count(*) from t").Scan(&n); !errors.As(err, &e) || e.Code()&0xff != sqlite3.SQLITE_BUSY {
+			t.Errorf("%s: got %v, want SQLITE_BUSY", locking, err)
+		}
+
+		if _, err := a.ExecContext(ctx, "insert into t values(1); commit"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.QueryRowContext(ctx, "select count(*) from t").Scan(&n); err != nil || n != 1 {
+			t.Errorf("%s: got %v, %v, want 1", locking, n, err)
+		}
+
+		a.Close()
+		b.Close()
+		db.Close()
+	}
+}
+
+// TestLockingMode checks a connection in exclusive locking mode locks out
+// other connections until it switches back to normal or is closed.
+func TestLockingMode(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.db")
+	other, err := sql.Open(driverName, name+"?_pragma=busy_timeout(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer other.Close()
+
+	if _, err := other.Exec("create table t(i); insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	busy := func(step string, want bool) {
+		t.Helper()
+		var n int
+		var e *Error
+		err := other.QueryRow("select count(*) from t").Scan(&n)
+		switch {
+		case want && (!errors.As(err, &e) || e.Code()&0xff != sqlite3.SQLITE_BUSY):
+			t.Errorf("%s: got %v, want SQLITE_BUSY", step, err)
+		case !want && err != nil:
+			t.Errorf("%s: %v", step, err)
+		}
+	}
+
+	db, err := OpenExclusive(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("insert into t values(2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	busy("OpenExclusive", true)
+	db.Close()
+	busy("OpenExclusive closed", false)
+
+	if db, err = sql.Open(driverName, name); err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	setLockingMode := func(exclusive bool) {
+		if err := c.Raw(func(dc interface{}) error { return dc.(*conn).SetLockingMode(exclusive) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setLockingMode(true)
+	busy("exclusive mode before a write", false)
+	if _, err := c.ExecContext(context.Background(), "insert into t values(3)"); err != nil {
+		t.Fatal(err)
+	}
+
+	busy("exclusive mode", true)
+	setLockingMode(false)
+	busy("back to normal mode", false)
+	if _, err := other.Exec("insert into t values(4)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := c.QueryRowContext(context.Background(), "select count(*) from t").Scan(&n); err != nil || n != 4 {
+		t.Fatalf("got %v %v, want 4", n, err)
+	}
+}
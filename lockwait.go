@@ -0,0 +1,267 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// lockRelease is signalled when a connection of the process using the
+// database file may have released its file locks.
+type lockRelease struct {
+	sync.Mutex
+	ch chan struct{}
+}
+
+func (r *lockRelease) wait() <-chan struct{} {
+	r.Lock()
+
+	defer r.Unlock()
+
+	return r.ch
+}
+
+func (r *lockRelease) signal() {
+	r.Lock()
+
+	defer r.Unlock()
+
+	close(r.ch)
+	r.ch = make(chan struct{})
+}
+
+var (
+	lockReleasesMu sync.Mutex
+	lockReleases   = map[string]*lockRelease{}
+)
+
+func lockReleaseFor(filename string) *lockRelease {
+	lockReleasesMu.Lock()
+
+	defer lockReleasesMu.Unlock()
+
+	r := lockReleases[filename]
+	if r == nil {
+		r = &lockRelease{ch: make(chan struct{})}
+		lockReleases[filename] = r
+	}
+	return r
+}
+
+// lockWait is the busy handler state of a connection, see setLockWait.
+type lockWait struct {
+	release *lockRelease
+	timeout time.Duration
+	start   time.Time // Of the current busy episode.
+
+	mu          sync.Mutex
+	op          uint64          // Of the current operation, see beginOp.
+	done        <-chan struct{} // Of the context of the operation, see interruptOnDone.
+	interrupted bool            // The operation was interrupted because done is closed.
+}
+
+// beginOp starts a new operation of the connection whose context has the Done
+// channel done, nil if it cannot be canceled, and returns its number. The
+// state left by the previous operation is discarded, so a canceled operation
+// does not cut short the lock waits of the next ones.
+func (w *lockWait) beginOp(done <-chan struct{}) uint64 {
+	w.mu.Lock()
+
+	defer w.mu.Unlock()
+
+	w.op++
+	w.done = done
+	w.interrupted = false
+	return w.op
+}
+
+// endOp ends the operation op, unless another one started since.
+func (w *lockWait) endOp(op uint64) {
+	w.mu.Lock()
+
+	defer w.mu.Unlock()
+
+	if w.op == op {
+		w.op++
+		w.done = nil
+		w.interrupted = false
+	}
+}
+
+// interrupt records that the operation op is interrupted, unless it ended.
+func (w *lockWait) interrupt(op uint64) {
+	w.mu.Lock()
+
+	defer w.mu.Unlock()
+
+	if w.op == op {
+		w.interrupted = true
+	}
+}
+
+// state returns the Done channel of the context of the current operation and
+// whether it was interrupted.
+func (w *lockWait) state() (done <-chan struct{}, interrupted bool) {
+	w.mu.Lock()
+
+	defer w.mu.Unlock()
+
+	return w.done, w.interrupted
+}
+
+// resetLockWait starts an operation of c whose context cannot be canceled, see
+// beginOp.
+func (c *conn) resetLockWait() {
+	if c.lockWait != nil {
+		c.lockWait.beginOp(nil)
+	}
+}
+
+var (
+	lockWaitsMu sync.Mutex
+	lockWaits   = map[uintptr]*lockWait{}
+	lockWaitID  uintptr
+)
+
+// Lock wait polling intervals, for locks held by other processes.
+var lockWaitPolls = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+}
+
+// setLockWait handles the _lock_wait query parameter.
+func (c *conn) setLockWait(v string) error {
+	timeout, err := time.ParseDuration(v)
+	if err != nil {
+		ms, err2 := strconv.ParseUint(v, 10, 31)
+		if err2 != nil {
+			return fmt.Errorf("invalid _lock_wait %q", v)
+		}
+
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	filename := libc.GoString(sqlite3.Xsqlite3_db_filename(c.tls, c.db, 0))
+	if filename == "" || timeout <= 0 { // Temporary or in-memory database.
+		return nil
+	}
+
+	w := &lockWait{release: lockReleaseFor(filename), timeout: timeout}
+	lockWaitsMu.Lock()
+	lockWaitID++
+	id := lockWaitID
+	lockWaits[id] = w
+	lockWaitsMu.Unlock()
+
+	// int sqlite3_busy_handler(sqlite3*,int(*)(void*,int),void*);
+	if rc := sqlite3.Xsqlite3_busy_handler(
+		c.tls,
+		c.db,
+		*(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, int32) int32
+		}{xBusy})),
+		id,
+	); rc != sqlite3.SQLITE_OK {
+		lockWaitsMu.Lock()
+		delete(lockWaits, id)
+		lockWaitsMu.Unlock()
+		return c.errstr(rc)
+	}
+
+	c.lockWait = w
+	c.lockWaitID = id
+	return nil
+}
+
+func (c *conn) unregisterLockWait() {
+	if c.lockWaitID == 0 {
+		return
+	}
+
+	lockWaitsMu.Lock()
+	delete(lockWaits, c.lockWaitID)
+	lockWaitsMu.Unlock()
+	c.lockWaitID = 0
+}
+
+// signalLockRelease wakes up the connections waiting for a lock on the
+// database of c once c is no longer in a transaction.
+func (c *conn) signalLockRelease() {
+	if c.lockWait == nil || (c.db != 0 && !c.autocommit()) {
+		return
+	}
+
+	c.lockWait.release.signal()
+}
+
+// xBusy is invoked by SQLite when a lock cannot be acquired. Instead of
+// sleeping for fixed intervals, it waits until another connection of the
+// process releases its locks, polling for locks of other processes. The wait
+// ends early when the context of the operation is done.
+func xBusy(tls *libc.TLS, pArg uintptr, count int32) int32 {
+	lockWaitsMu.Lock()
+	w := lockWaits[pArg]
+	lockWaitsMu.Unlock()
+	if w == nil {
+		return 0
+	}
+
+	done, interrupted := w.state()
+	if interrupted {
+		return 0
+	}
+
+	select {
+	case <-done:
+		return 0
+	default:
+	}
+
+	ch := w.release.wait()
+	now := time.Now()
+	if count == 0 {
+		// The busy episode just started, the lock may be already free.
+		w.start = now
+		atomic.AddInt64(&busyRetries, 1)
+		return 1
+	}
+
+	left := w.timeout - now.Sub(w.start)
+	if left <= 0 {
+		return 0
+	}
+
+	poll := lockWaitPolls[len(lockWaitPolls)-1]
+	if int(count-1) < len(lockWaitPolls) {
+		poll = lockWaitPolls[count-1]
+	}
+	if left < poll {
+		poll = left
+	}
+	t := time.NewTimer(poll)
+
+	defer t.Stop()
+
+	select {
+	case <-ch:
+	case <-t.C:
+	case <-done:
+		return 0
+	}
+	atomic.AddInt64(&busyRetries, 1)
+	return 1
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLockWaitDeadline checks waiting for a lock ends at the deadline of the
+// context of the operation.
+func TestLockWaitDeadline(t *testing.T) {
+	name := "file:" + uriEscape(filepath.Join(t.TempDir(), "test.db")) + "?_lock_wait=1m"
+	holder, err := sql.Open(driverName, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer holder.Close()
+
+	if _, err := holder.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := holder.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open(driverName, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for _, v := range []struct {
+		name string
+		f    func(ctx context.Context) error
+	}{
+		{"exec", func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, "insert into t values(2)")
+			return err
+		}},
+		{"begin", func(ctx context.Context) error {
+			tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+			if err == nil {
+				tx.Rollback()
+			}
+			return err
+		}},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		t0 := time.Now()
+		err := v.f(ctx)
+		d := time.Since(t0)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: got %v, want %v", v.name, err, context.DeadlineExceeded)
+		}
+
+		if d > 5*time.Second {
+			t.Errorf("%s: waited %v", v.name, d)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock released, the connection waits no more.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	defer cancel()
+
+	if _, err := db.ExecContext(ctx, "insert into t values(3)"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLockWaitAfterCancel checks an operation canceled while waiting for a
+// lock does not cut short the lock waits of the next operations of the
+// connection.
+func TestLockWaitAfterCancel(t *testing.T) {
+	name := "file:" + uriEscape(filepath.Join(t.TempDir(), "test.db")) + "?_lock_wait=1m"
+	holder, err := sql.Open(driverName, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer holder.Close()
+
+	if _, err := holder.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open(driverName, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	hold := func() *sql.Tx {
+		tx, err := holder.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tx.Exec("insert into t values(1)"); err != nil {
+			t.Fatal(err)
+		}
+
+		return tx
+	}
+	for _, cancelled := range []bool{false, true} {
+		tx := hold()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		if cancelled {
+			time.AfterFunc(10*time.Millisecond, cancel)
+		}
+		if _, err := db.ExecContext(ctx, "insert into t values(2)"); !errors.Is(err, ctx.Err()) || ctx.Err() == nil {
+			t.Fatalf("got %v, want %v", err, ctx.Err())
+		}
+
+		cancel()
+		const hold = 200 * time.Millisecond
+		time.AfterFunc(hold, func() { tx.Commit() })
+		t0 := time.Now()
+		if _, err := db.Exec("insert into t values(3)"); err != nil {
+			t.Fatal(err)
+		}
+
+		if d := time.Since(t0); d < hold/2 {
+			t.Fatalf("waited only %v", d)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+
+	"modernc.org/libc"
+	"modernc.org/libc/sys/types"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type logFunc struct {
+	f func(code int, msg string)
+}
+
+var logger atomic.Value // logFunc
+
+func init() {
+	tls := libc.NewTLS()
+
+	defer tls.Close()
+
+	varArgs := libc.Xmalloc(tls, types.Size_t(2*ptrSize))
+	if varArgs == 0 {
+		panic(fmt.Errorf("cannot allocate memory"))
+	}
+
+	defer libc.Xfree(tls, varArgs)
+
+	// int sqlite3_config(int, ...);
+	if rc := sqlite3.Xsqlite3_config(
+		tls,
+		sqlite3.SQLITE_CONFIG_LOG,
+		libc.VaList(
+			varArgs,
+			*(*uintptr)(unsafe.Pointer(&struct {
+				f func(*libc.TLS, uintptr, int32, uintptr)
+			}{xLog})),
+			uintptr(0),
+		),
+	); rc != sqlite3.SQLITE_OK {
+		p := sqlite3.Xsqlite3_errstr(tls, rc)
+		str := libc.GoString(p)
+		panic(fmt.Errorf("sqlite: failed to configure error log: %v", str))
+	}
+}
+
+// SetLogger installs f as the receiver of the SQLite error log, see
+// https://www.sqlite.org/errlog.html, and of the events reported by the
+// driver itself, like those of the corruption recovery policy. The code
+// passed to f is the (extended) result code associated with the message.
+// Passing nil removes the logger.
+//
+// f may be invoked concurrently from multiple goroutines and must not use the
+// connection that produced the message.
+func SetLogger(f func(code int, msg string)) {
+	logger.Store(logFunc{f})
+}
+
+func logf(code int, s string, args ...interface{}) {
+	if v, ok := logger.Load().(logFunc); ok && v.f != nil {
+		v.f(code, fmt.Sprintf(s, args...))
+	}
+}
+
+// void (*)(void *pArg, int iErrCode, const char *zMsg);
+func xLog(tls *libc.TLS, pArg uintptr, iErrCode int32, zMsg uintptr) {
+	if v, ok := logger.Load().(logFunc); ok && v.f != nil {
+		v.f(int(iErrCode), libc.GoString(zMsg))
+	}
+}
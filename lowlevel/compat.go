@@ -0,0 +1,20 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !(windows && 386)
+// +build !windows !386
+
+package lowlevel // import "modernc.org/sqlite/lowlevel"
+
+import (
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// The library of windows/386 is SQLite 3.33.0, which has no 64-bit change
+// counters, see compat_windows_386.go.
+
+func changes(tls *libc.TLS, db uintptr) int64 { return sqlite3.Xsqlite3_changes64(tls, db) }
+
+func totalChanges(tls *libc.TLS, db uintptr) int64 { return sqlite3.Xsqlite3_total_changes64(tls, db) }
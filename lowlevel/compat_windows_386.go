@@ -0,0 +1,18 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lowlevel // import "modernc.org/sqlite/lowlevel"
+
+import (
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLite 3.33.0, the library of windows/386, has 32-bit change counters only.
+
+func changes(tls *libc.TLS, db uintptr) int64 { return int64(sqlite3.Xsqlite3_changes(tls, db)) }
+
+func totalChanges(tls *libc.TLS, db uintptr) int64 {
+	return int64(sqlite3.Xsqlite3_total_changes(tls, db))
+}
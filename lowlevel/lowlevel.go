@@ -0,0 +1,418 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lowlevel provides direct access to SQLite connections and prepared
+// statements, bypassing database/sql and its per-row allocations, for
+// performance sensitive code.
+//
+// The API is a thin layer over the C API of SQLite, see
+// https://www.sqlite.org/cintro.html. Column and parameter indexes follow the
+// C conventions: columns are numbered from 0, parameters from 1.
+//
+// A Conn, and the Stmts prepared by it, must not be used by multiple
+// goroutines concurrently. Stmts must be finalized before their Conn is
+// closed.
+package lowlevel // import "modernc.org/sqlite/lowlevel"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"modernc.org/libc"
+	"modernc.org/libc/sys/types"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Flags of Open.
+const (
+	OpenReadOnly  = sqlite3.SQLITE_OPEN_READONLY
+	OpenReadWrite = sqlite3.SQLITE_OPEN_READWRITE
+	OpenCreate    = sqlite3.SQLITE_OPEN_CREATE
+	OpenURI       = sqlite3.SQLITE_OPEN_URI
+	OpenMemory    = sqlite3.SQLITE_OPEN_MEMORY
+)
+
+// Fundamental datatypes reported by Stmt.ColumnType.
+const (
+	Integer = sqlite3.SQLITE_INTEGER
+	Float   = sqlite3.SQLITE_FLOAT
+	Text    = sqlite3.SQLITE_TEXT
+	Blob    = sqlite3.SQLITE_BLOB
+	Null    = sqlite3.SQLITE_NULL
+)
+
+// sqliteTransient is the SQLITE_TRANSIENT destructor: SQLite makes its own
+// copy of the bound value.
+const sqliteTransient = ^uintptr(0)
+
+// Error is an error reported by SQLite.
+type Error struct {
+	msg  string
+	code int
+}
+
+// Error implements error.
+func (e *Error) Error() string { return e.msg }
+
+// Code returns the (extended) SQLite result code of e.
+func (e *Error) Code() int { return e.code }
+
+// Conn is a database connection.
+type Conn struct {
+	db  uintptr // *sqlite3.Xsqlite3
+	tls *libc.TLS
+}
+
+// Open opens the database name, see https://www.sqlite.org/c3ref/open.html.
+// Zero flags are equivalent to OpenReadWrite|OpenCreate|OpenURI. Extended
+// result codes are enabled.
+func Open(name string, flags int) (*Conn, error) {
+	if flags == 0 {
+		flags = OpenReadWrite | OpenCreate | OpenURI
+	}
+	c := &Conn{tls: libc.NewTLS()}
+	s, err := libc.CString(name)
+	if err != nil {
+		c.tls.Close()
+		return nil, err
+	}
+
+	defer libc.Xfree(c.tls, s)
+
+	p, err := c.malloc(int(unsafe.Sizeof(uintptr(0))))
+	if err != nil {
+		c.tls.Close()
+		return nil, err
+	}
+
+	defer libc.Xfree(c.tls, p)
+
+	rc := sqlite3.Xsqlite3_open_v2(c.tls, s, p, int32(flags)|sqlite3.SQLITE_OPEN_FULLMUTEX, 0)
+	c.db = *(*uintptr)(unsafe.Pointer(p))
+	if rc != sqlite3.SQLITE_OK {
+		err := c.errstr(rc)
+		c.Close()
+		return nil, err
+	}
+
+	sqlite3.Xsqlite3_extended_result_codes(c.tls, c.db, 1)
+	return c, nil
+}
+
+func (c *Conn) malloc(n int) (uintptr, error) {
+	if p := libc.Xmalloc(c.tls, types.Size_t(n)); p != 0 || n == 0 {
+		return p, nil
+	}
+
+	return 0, fmt.Errorf("lowlevel: cannot allocate %d bytes of memory", n)
+}
+
+func (c *Conn) errstr(rc int32) error {
+	str := libc.GoString(sqlite3.Xsqlite3_errstr(c.tls, rc))
+	if c.db == 0 {
+		return &Error{msg: fmt.Sprintf("%s (%v)", str, rc), code: int(rc)}
+	}
+
+	switch msg := libc.GoString(sqlite3.Xsqlite3_errmsg(c.tls, c.db)); {
+	case msg == str:
+		return &Error{msg: fmt.Sprintf("%s (%v)", str, rc), code: int(rc)}
+	default:
+		return &Error{msg: fmt.Sprintf("%s: %s (%v)", str, msg, rc), code: int(rc)}
+	}
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	if c.db != 0 {
+		if rc := sqlite3.Xsqlite3_close_v2(c.tls, c.db); rc != sqlite3.SQLITE_OK {
+			return c.errstr(rc)
+		}
+
+		c.db = 0
+	}
+	if c.tls != nil {
+		c.tls.Close()
+		c.tls = nil
+	}
+	return nil
+}
+
+// Exec runs the SQL statements of sql, which must not return rows of
+// interest and cannot have parameters.
+func (c *Conn) Exec(sql string) error {
+	s, err := libc.CString(sql)
+	if err != nil {
+		return err
+	}
+
+	defer libc.Xfree(c.tls, s)
+
+	if rc := sqlite3.Xsqlite3_exec(c.tls, c.db, s, 0, 0, 0); rc != sqlite3.SQLITE_OK {
+		return c.errstr(rc)
+	}
+
+	return nil
+}
+
+// Interrupt makes the operation in progress on the connection, if any, fail
+// with SQLITE_INTERRUPT. It is the only method of Conn which may be called
+// concurrently with others, except Close.
+func (c *Conn) Interrupt() { sqlite3.Xsqlite3_interrupt(c.tls, c.db) }
+
+// LastInsertRowID returns the rowid of the most recent successful INSERT.
+func (c *Conn) LastInsertRowID() int64 { return sqlite3.Xsqlite3_last_insert_rowid(c.tls, c.db) }
+
+// SetLastInsertRowID sets the value returned by LastInsertRowID and by the SQL
+// function last_insert_rowid().
+func (c *Conn) SetLastInsertRowID(id int64) { sqlite3.Xsqlite3_set_last_insert_rowid(c.tls, c.db, id) }
+
+// Changes returns the number of rows modified by the most recent INSERT,
+// UPDATE or DELETE.
+func (c *Conn) Changes() int64 { return changes(c.tls, c.db) }
+
+// TotalChanges returns the number of rows modified by all the INSERT, UPDATE
+// and DELETE statements completed since the connection was opened, including
+// those of triggers.
+func (c *Conn) TotalChanges() int64 { return totalChanges(c.tls, c.db) }
+
+// Stmt is a prepared statement.
+type Stmt struct {
+	c     *Conn
+	pstmt uintptr
+}
+
+// Prepare compiles the first statement of sql and returns it together with
+// the remaining, unused part of sql. The returned Stmt is nil if sql
+// contains no statement, for example if it is only a comment.
+func (c *Conn) Prepare(sql string) (s *Stmt, tail string, err error) {
+	z, err := libc.CString(sql)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer libc.Xfree(c.tls, z)
+
+	p, err := c.malloc(2 * int(unsafe.Sizeof(uintptr(0))))
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer libc.Xfree(c.tls, p)
+
+	pptail := p + unsafe.Sizeof(uintptr(0))
+	if rc := sqlite3.Xsqlite3_prepare_v2(c.tls, c.db, z, -1, p, pptail); rc != sqlite3.SQLITE_OK {
+		return nil, "", c.errstr(rc)
+	}
+
+	tail = sql[*(*uintptr)(unsafe.Pointer(pptail))-z:]
+	if pstmt := *(*uintptr)(unsafe.Pointer(p)); pstmt != 0 {
+		s = &Stmt{c: c, pstmt: pstmt}
+	}
+	return s, tail, nil
+}
+
+// Step evaluates the statement. It reports true if a new row of the result
+// is available and false when the statement has finished.
+func (s *Stmt) Step() (bool, error) {
+	switch rc := sqlite3.Xsqlite3_step(s.c.tls, s.pstmt); rc {
+	case sqlite3.SQLITE_ROW:
+		return true, nil
+	case sqlite3.SQLITE_DONE:
+		return false, nil
+	default:
+		return false, s.c.errstr(rc)
+	}
+}
+
+// Reset resets the statement to be stepped again from the start. Bound
+// parameter values are retained, see ClearBindings.
+func (s *Stmt) Reset() error {
+	if rc := sqlite3.Xsqlite3_reset(s.c.tls, s.pstmt); rc != sqlite3.SQLITE_OK {
+		return s.c.errstr(rc)
+	}
+
+	return nil
+}
+
+// ClearBindings sets all parameters of the statement to NULL.
+func (s *Stmt) ClearBindings() error {
+	if rc := sqlite3.Xsqlite3_clear_bindings(s.c.tls, s.pstmt); rc != sqlite3.SQLITE_OK {
+		return s.c.errstr(rc)
+	}
+
+	return nil
+}
+
+// Finalize destroys the statement.
+func (s *Stmt) Finalize() error {
+	if s.pstmt == 0 {
+		return nil
+	}
+
+	rc := sqlite3.Xsqlite3_finalize(s.c.tls, s.pstmt)
+	s.pstmt = 0
+	if rc != sqlite3.SQLITE_OK {
+		return s.c.errstr(rc)
+	}
+
+	return nil
+}
+
+// SQL returns the text of the statement.
+func (s *Stmt) SQL() string { return libc.GoString(sqlite3.Xsqlite3_sql(s.c.tls, s.pstmt)) }
+
+// ExpandedSQL returns the text of the statement with its bound parameters
+// expanded as literals, see https://www.sqlite.org/c3ref/expanded_sql.html.
+func (s *Stmt) ExpandedSQL() string {
+	p := sqlite3.Xsqlite3_expanded_sql(s.c.tls, s.pstmt)
+	if p == 0 {
+		return s.SQL()
+	}
+
+	defer sqlite3.Xsqlite3_free(s.c.tls, p)
+
+	return libc.GoString(p)
+}
+
+func (s *Stmt) bindrc(rc int32) error {
+	if rc != sqlite3.SQLITE_OK {
+		return s.c.errstr(rc)
+	}
+
+	return nil
+}
+
+// BindParameterCount returns the number of the largest parameter of the
+// statement.
+func (s *Stmt) BindParameterCount() int {
+	return int(sqlite3.Xsqlite3_bind_parameter_count(s.c.tls, s.pstmt))
+}
+
+// ParamName returns the name of parameter i, including its prefix, like ":id"
+// or "?2". It returns "" for a nameless ? parameter, for a parameter not used
+// by the statement, like 2 in "?1, ?3", and if i is out of range.
+func (s *Stmt) ParamName(i int) string {
+	return libc.GoString(sqlite3.Xsqlite3_bind_parameter_name(s.c.tls, s.pstmt, int32(i)))
+}
+
+// BindParameterIndex returns the index of the parameter named name,
+// including its prefix, like ":id", or 0 if there is no such parameter.
+func (s *Stmt) BindParameterIndex(name string) int {
+	z, err := libc.CString(name)
+	if err != nil {
+		return 0
+	}
+
+	defer libc.Xfree(s.c.tls, z)
+
+	return int(sqlite3.Xsqlite3_bind_parameter_index(s.c.tls, s.pstmt, z))
+}
+
+// BindNull binds NULL to parameter i.
+func (s *Stmt) BindNull(i int) error {
+	return s.bindrc(sqlite3.Xsqlite3_bind_null(s.c.tls, s.pstmt, int32(i)))
+}
+
+// BindInt64 binds v to parameter i.
+func (s *Stmt) BindInt64(i int, v int64) error {
+	return s.bindrc(sqlite3.Xsqlite3_bind_int64(s.c.tls, s.pstmt, int32(i), v))
+}
+
+// BindFloat64 binds v to parameter i.
+func (s *Stmt) BindFloat64(i int, v float64) error {
+	return s.bindrc(sqlite3.Xsqlite3_bind_double(s.c.tls, s.pstmt, int32(i), v))
+}
+
+// BindText binds the text v to parameter i.
+func (s *Stmt) BindText(i int, v string) error {
+	// A NULL pointer would bind NULL instead of an empty text.
+	p, err := s.c.malloc(len(v) + 1)
+	if err != nil {
+		return err
+	}
+
+	defer libc.Xfree(s.c.tls, p)
+
+	copy((*libc.RawMem)(unsafe.Pointer(p))[:len(v):len(v)], v)
+	return s.bindrc(sqlite3.Xsqlite3_bind_text64(s.c.tls, s.pstmt, int32(i), p, uint64(len(v)), sqliteTransient, sqlite3.SQLITE_UTF8))
+}
+
+// BindBlob binds the blob v to parameter i. A nil v binds NULL.
+func (s *Stmt) BindBlob(i int, v []byte) error {
+	switch {
+	case v == nil:
+		return s.BindNull(i)
+	case len(v) == 0:
+		return s.bindrc(sqlite3.Xsqlite3_bind_zeroblob(s.c.tls, s.pstmt, int32(i), 0))
+	}
+
+	p, err := s.c.malloc(len(v))
+	if err != nil {
+		return err
+	}
+
+	defer libc.Xfree(s.c.tls, p)
+
+	copy((*libc.RawMem)(unsafe.Pointer(p))[:len(v):len(v)], v)
+	return s.bindrc(sqlite3.Xsqlite3_bind_blob64(s.c.tls, s.pstmt, int32(i), p, uint64(len(v)), sqliteTransient))
+}
+
+// ColumnCount returns the number of columns of the result of the statement.
+func (s *Stmt) ColumnCount() int { return int(sqlite3.Xsqlite3_column_count(s.c.tls, s.pstmt)) }
+
+// ColumnName returns the name of column i.
+func (s *Stmt) ColumnName(i int) string {
+	return libc.GoString(sqlite3.Xsqlite3_column_name(s.c.tls, s.pstmt, int32(i)))
+}
+
+// ColumnType returns the datatype of column i of the current row, one of
+// Integer, Float, Text, Blob or Null.
+func (s *Stmt) ColumnType(i int) int {
+	return int(sqlite3.Xsqlite3_column_type(s.c.tls, s.pstmt, int32(i)))
+}
+
+// ColumnInt64 returns column i of the current row as an integer.
+func (s *Stmt) ColumnInt64(i int) int64 {
+	return sqlite3.Xsqlite3_column_int64(s.c.tls, s.pstmt, int32(i))
+}
+
+// ColumnFloat64 returns column i of the current row as a float.
+func (s *Stmt) ColumnFloat64(i int) float64 {
+	return sqlite3.Xsqlite3_column_double(s.c.tls, s.pstmt, int32(i))
+}
+
+// ColumnText returns column i of the current row as text.
+func (s *Stmt) ColumnText(i int) string { return string(s.ColumnRawText(i)) }
+
+// ColumnBlob returns a copy of column i of the current row as a blob.
+func (s *Stmt) ColumnBlob(i int) []byte {
+	b := s.ColumnRawBlob(i)
+	if b == nil {
+		return nil
+	}
+
+	return append([]byte(nil), b...)
+}
+
+// ColumnRawText returns column i of the current row as UTF-8 text without
+// copying it. The result is valid only until the next call of Step, Reset or
+// Finalize or of another column accessor for column i, and must not be
+// modified.
+func (s *Stmt) ColumnRawText(i int) []byte {
+	return s.raw(sqlite3.Xsqlite3_column_text(s.c.tls, s.pstmt, int32(i)), i)
+}
+
+// ColumnRawBlob is like ColumnRawText but returns the column as a blob.
+func (s *Stmt) ColumnRawBlob(i int) []byte {
+	return s.raw(sqlite3.Xsqlite3_column_blob(s.c.tls, s.pstmt, int32(i)), i)
+}
+
+func (s *Stmt) raw(p uintptr, i int) []byte {
+	n := sqlite3.Xsqlite3_column_bytes(s.c.tls, s.pstmt, int32(i))
+	if p == 0 || n == 0 {
+		return nil
+	}
+
+	return (*libc.RawMem)(unsafe.Pointer(p))[:n:n]
+}
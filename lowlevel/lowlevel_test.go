@@ -0,0 +1,254 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lowlevel_test // import "modernc.org/sqlite/lowlevel"
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"modernc.org/sqlite/lowlevel"
+)
+
+func openMemory(t *testing.T) *lowlevel.Conn {
+	c, err := lowlevel.Open(":memory:", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func prepare(t *testing.T, c *lowlevel.Conn, sql string) *lowlevel.Stmt {
+	s, _, err := c.Prepare(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestParams(t *testing.T) {
+	c := openMemory(t)
+
+	defer c.Close()
+
+	s := prepare(t, c, "select ?, :a, ?4, @b, ?")
+
+	defer s.Finalize()
+
+	if g, e := s.BindParameterCount(), 6; g != e {
+		t.Fatalf("got %d parameters, want %d", g, e)
+	}
+
+	for i, e := range []string{"", ":a", "", "?4", "@b", "", ""} {
+		if g := s.ParamName(i + 1); g != e {
+			t.Errorf("parameter %d: got %q, want %q", i+1, g, e)
+		}
+	}
+
+	for _, v := range []struct {
+		name string
+		i    int
+	}{
+		{":a", 2},
+		{"?4", 4},
+		{"a", 0},
+		{"@b", 5},
+		{":b", 0},
+	} {
+		if g := s.BindParameterIndex(v.name); g != v.i {
+			t.Errorf("%q: got %d, want %d", v.name, g, v.i)
+		}
+	}
+}
+
+func TestConn(t *testing.T) {
+	c := openMemory(t)
+
+	defer c.Close()
+
+	if err := c.Exec("create table t(i integer primary key, f); insert into t(f) values(1), (2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := c.LastInsertRowID(), int64(2); g != e {
+		t.Fatalf("last insert rowid %d, want %d", g, e)
+	}
+
+	if g, e := c.Changes(), int64(2); g != e {
+		t.Fatalf("changes %d, want %d", g, e)
+	}
+
+	if err := c.Exec("update t set f = 3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := c.TotalChanges(), int64(4); g != e {
+		t.Fatalf("total changes %d, want %d", g, e)
+	}
+
+	c.SetLastInsertRowID(42)
+	if g, e := c.LastInsertRowID(), int64(42); g != e {
+		t.Fatalf("last insert rowid %d, want %d", g, e)
+	}
+
+	err := c.Exec("select nonexistent from t")
+	if e, ok := err.(*lowlevel.Error); !ok || e.Code() != 1 || !strings.Contains(e.Error(), "no such column: nonexistent") {
+		t.Fatalf("got %T %v, want SQLITE_ERROR", err, err)
+	}
+}
+
+func TestBindColumn(t *testing.T) {
+	c := openMemory(t)
+
+	defer c.Close()
+
+	if err := c.Exec("create table t(v)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ins := prepare(t, c, "insert into t values(?)")
+
+	defer ins.Finalize()
+
+	for i, bind := range []func() error{
+		func() error { return ins.BindNull(1) },
+		func() error { return ins.BindInt64(1, -1<<40) },
+		func() error { return ins.BindFloat64(1, 1.5) },
+		func() error { return ins.BindText(1, "héllo") },
+		func() error { return ins.BindText(1, "") },
+		func() error { return ins.BindBlob(1, []byte{0, 1}) },
+		func() error { return ins.BindBlob(1, []byte{}) },
+		func() error { return ins.BindBlob(1, nil) },
+	} {
+		if err := bind(); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		if ok, err := ins.Step(); ok || err != nil {
+			t.Fatalf("%d: %v %v", i, ok, err)
+		}
+
+		if err := ins.Reset(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ins.BindInt64(2, 1); err == nil {
+		t.Fatal("unexpected success binding a nonexistent parameter")
+	}
+
+	sel := prepare(t, c, "select v, typeof(v) from t order by rowid")
+
+	defer sel.Finalize()
+
+	if g, e := sel.ColumnCount(), 2; g != e {
+		t.Fatalf("got %d columns, want %d", g, e)
+	}
+
+	if g, e := sel.ColumnName(0), "v"; g != e {
+		t.Fatalf("got column %q, want %q", g, e)
+	}
+
+	var got []string
+	for {
+		ok, err := sel.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			break
+		}
+
+		var v interface{}
+		switch sel.ColumnType(0) {
+		case lowlevel.Integer:
+			v = sel.ColumnInt64(0)
+		case lowlevel.Float:
+			v = sel.ColumnFloat64(0)
+		case lowlevel.Text:
+			v = sel.ColumnText(0)
+		case lowlevel.Blob:
+			v = sel.ColumnBlob(0)
+		case lowlevel.Null:
+			v = nil
+		}
+		got = append(got, fmt.Sprintf("%s %v", sel.ColumnText(1), v))
+	}
+	if g, e := strings.Join(got, ", "), "null <nil>, integer -1099511627776, real 1.5, text héllo, text , blob [0 1], blob [], null <nil>"; g != e {
+		t.Fatalf("got\n%s\nwant\n%s", g, e)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	c := openMemory(t)
+
+	defer c.Close()
+
+	s, tail, err := c.Prepare("select ?1 + 1; select 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Finalize()
+
+	if g, e := tail, " select 2"; g != e {
+		t.Fatalf("got tail %q, want %q", g, e)
+	}
+
+	if g, e := s.SQL(), "select ?1 + 1;"; g != e {
+		t.Fatalf("got %q, want %q", g, e)
+	}
+
+	if err := s.BindInt64(1, 41); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := s.ExpandedSQL(), "select 41 + 1;"; g != e {
+		t.Fatalf("got %q, want %q", g, e)
+	}
+
+	for i := 0; i < 2; i++ {
+		if ok, err := s.Step(); !ok || err != nil {
+			t.Fatal(ok, err)
+		}
+
+		if g, e := s.ColumnInt64(0), int64(42); g != e {
+			t.Fatalf("%d: got %d, want %d", i, g, e)
+		}
+
+		// Reset keeps the bindings.
+		if err := s.Reset(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.ClearBindings(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := s.Step(); !ok || err != nil || s.ColumnType(0) != lowlevel.Null {
+		t.Fatal(ok, err, s.ColumnType(0))
+	}
+
+	if err := s.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Finalize is idempotent.
+	if err := s.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, tail, err = c.Prepare(" -- comment"); s != nil || tail != "" || err != nil {
+		t.Fatal(s, tail, err)
+	}
+
+	if _, _, err := c.Prepare("select from"); err == nil {
+		t.Fatal("unexpected success")
+	}
+}
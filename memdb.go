@@ -0,0 +1,46 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// OpenMemory opens the named in-memory database name, creating it if it does
+// not exist yet. All connections of the returned handle, and of any other
+// handle of the process opened with the same name, see the same database,
+// unlike connections of ":memory:" which each get a new, empty database.
+//
+// The database uses the memdb VFS, so it does not need a shared cache and its
+// connections lock each other as connections of a database file would. Use
+// _lock_wait or _serialize_writes for writers to wait for each other.
+// The handle keeps one connection open for its whole lifetime, so the
+// database survives times without any activity. The database is deleted when
+// the last connection using it is closed. The query parameters of Driver.Open
+// may be appended to name after a '?'.
+func OpenMemory(name string) (*sql.DB, error) {
+	var query string
+	if i := strings.IndexByte(name, '?'); i >= 0 {
+		name, query = name[:i], name[i+1:]
+	}
+	dsn := "file:/" + uriEscape(strings.TrimPrefix(name, "/")) + "?vfs=memdb"
+	if query != "" {
+		dsn += "&" + query
+	}
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
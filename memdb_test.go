@@ -0,0 +1,88 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestOpenMemory(t *testing.T) {
+	db, err := OpenMemory("memdb-test?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec("create table t(i); insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(c interface {
+		QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+	}) (n int) {
+		if err := c.QueryRowContext(context.Background(), "select count(*) from t").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+
+		return n
+	}
+
+	// Several connections of the pool at once.
+	ctx := context.Background()
+	var conns []*sql.Conn
+	for i := 0; i < 3; i++ {
+		c, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conns = append(conns, c)
+		if n := count(c); n != 1 {
+			t.Fatalf("connection %d: got %d rows, want 1", i, n)
+		}
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+
+	var timeout int
+	if err := db.QueryRow("pragma busy_timeout").Scan(&timeout); err != nil || timeout != 5000 {
+		t.Fatalf("busy_timeout %d, %v", timeout, err)
+	}
+
+	other, err := OpenMemory("/memdb-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(other); n != 1 {
+		t.Fatalf("got %d rows, want 1", n)
+	}
+
+	distinct, err := OpenMemory("memdb-test-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer distinct.Close()
+
+	if _, err := distinct.Exec("select count(*) from t"); err == nil {
+		t.Fatal("unexpected table t")
+	}
+
+	// The database is deleted with its last connection.
+	db.Close()
+	other.Close()
+	if db, err = OpenMemory("memdb-test"); err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("select count(*) from t"); err == nil {
+		t.Fatal("database not deleted")
+	}
+}
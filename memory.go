@@ -0,0 +1,62 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SoftHeapLimit sets the soft limit of the memory allocated by SQLite in the
+// process to n bytes and returns the previous limit, see
+// https://www.sqlite.org/c3ref/hard_heap_limit64.html. When the limit is
+// reached SQLite tries to free memory, mainly by shrinking page caches, but
+// allocations do not fail. Zero disables the limit, a negative n only reports
+// the current limit.
+func SoftHeapLimit(n int64) int64 {
+	tls := libc.NewTLS()
+
+	defer tls.Close()
+
+	return sqlite3.Xsqlite3_soft_heap_limit64(tls, n)
+}
+
+// HardHeapLimit sets the hard limit of the memory allocated by SQLite in the
+// process to n bytes and returns the previous limit. Allocations exceeding
+// the limit fail with SQLITE_NOMEM. Zero disables the limit, a negative n
+// only reports the current limit. The soft limit is lowered to the hard
+// limit if it is larger.
+func HardHeapLimit(n int64) int64 {
+	tls := libc.NewTLS()
+
+	defer tls.Close()
+
+	return sqlite3.Xsqlite3_hard_heap_limit64(tls, n)
+}
+
+// MemoryUsed returns the number of bytes of memory currently allocated by
+// SQLite in the process.
+func MemoryUsed() int64 {
+	tls := libc.NewTLS()
+
+	defer tls.Close()
+
+	return sqlite3.Xsqlite3_memory_used(tls)
+}
+
+// MemoryHighwater returns the maximum of MemoryUsed since the high water mark
+// was last reset. If reset is true the mark is then reset to the current
+// value of MemoryUsed.
+func MemoryHighwater(reset bool) int64 {
+	tls := libc.NewTLS()
+
+	defer tls.Close()
+
+	var r int32
+	if reset {
+		r = 1
+	}
+	return sqlite3.Xsqlite3_memory_highwater(tls, r)
+}
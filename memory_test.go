@@ -0,0 +1,88 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func TestHeapLimits(t *testing.T) {
+	soft, hard := SoftHeapLimit(-1), HardHeapLimit(-1)
+
+	defer func() {
+		HardHeapLimit(hard)
+		SoftHeapLimit(soft)
+	}()
+
+	if g := SoftHeapLimit(64 << 20); g != soft {
+		t.Fatalf("got %d, want %d", g, soft)
+	}
+
+	if g, e := SoftHeapLimit(-1), int64(64<<20); g != e {
+		t.Fatalf("got %d, want %d", g, e)
+	}
+
+	// The soft limit is lowered to the hard one.
+	HardHeapLimit(32 << 20)
+	if g, e := SoftHeapLimit(-1), int64(32<<20); g != e {
+		t.Fatalf("got %d, want %d", g, e)
+	}
+
+	db, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(b)"); err != nil {
+		t.Fatal(err)
+	}
+
+	HardHeapLimit(MemoryUsed() + 1<<20)
+	var e *Error
+	if _, err := db.Exec("insert into t values(zeroblob(4<<20) || x'00')"); !errors.As(err, &e) || e.Code() != sqlite3.SQLITE_NOMEM {
+		t.Fatalf("got %v, want SQLITE_NOMEM", err)
+	}
+
+	HardHeapLimit(0)
+	if _, err := db.Exec("insert into t values(zeroblob(4<<20) || x'00')"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryStatistics(t *testing.T) {
+	db, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(b); insert into t values(randomblob(1<<20))"); err != nil {
+		t.Fatal(err)
+	}
+
+	used := MemoryUsed()
+	if used <= 0 {
+		t.Fatalf("memory used %d", used)
+	}
+
+	if _, err := db.Exec("delete from t; select randomblob(2<<20)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := MemoryHighwater(true); g < used || g < 2<<20 {
+		t.Fatalf("high water mark %d, memory used %d", g, used)
+	}
+
+	if g, e := MemoryHighwater(false), MemoryUsed(); g >= 2<<20 && e < 2<<20 {
+		t.Fatalf("high water mark %d not reset to %d", g, e)
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build windows
+// +build windows
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+)
+
+func registerFlockVFS() (string, error) {
+	return "", fmt.Errorf("sqlite: _locking=flock is not supported on Windows")
+}
@@ -0,0 +1,221 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"strings"
+	"sync"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// NormalizeSQL returns the shape of the SQL text sql, which is the same for
+// statements differing only in their literal values, to aggregate metrics by
+// query instead of by the text of every execution. In the result
+//
+//   - string, blob and numeric literals and parameters are replaced by ?,
+//   - a list of only literals and parameters following IN is reduced to (?),
+//   - keywords and unquoted identifiers are in lower case,
+//   - comments are removed and the spacing of the tokens does not depend on
+//     the white space of sql: tokens are separated by a single space, except
+//     for none after "(", "." and unary operators, before ")", ",", ";" and
+//     ".", and between a name and "(", like in "count(*)". A keyword is
+//     followed by a space, like in "in (?)".
+//
+// NormalizeSQL serves the purpose of sqlite3_normalized_sql, see
+// https://www.sqlite.org/c3ref/expanded_sql.html, which the library is not
+// built with. It does not validate sql. TraceEvent.Normalized reports the
+// normalized text of the traced statements.
+func NormalizeSQL(sql string) string {
+	var toks []string
+	for i := 0; i < len(sql); {
+		s := sql[i:]
+		n, param := sqlToken(s)
+		tok := s[:n]
+		switch c := s[0]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || strings.HasPrefix(tok, "--") || strings.HasPrefix(tok, "/*"):
+			i += n
+			continue
+		case param || c == '\'':
+			tok = "?"
+		case (c == 'x' || c == 'X') && n == 1 && len(s) > 1 && s[1] == '\'':
+			n = 1 + sqlStringLen(s[1:])
+			tok = "?"
+		case c >= '0' && c <= '9' || c == '.' && len(s) > 1 && s[1] >= '0' && s[1] <= '9':
+			n = sqlNumberLen(s)
+			tok = "?"
+		case c == '"' || c == '`' || c == '[':
+			// Quoted identifiers are case sensitive.
+		case n == 1:
+			n = sqlOperatorLen(s)
+			tok = strings.ToLower(s[:n])
+		default:
+			tok = strings.ToLower(tok)
+		}
+		i += n
+		toks = append(toks, tok)
+		if tok == ")" {
+			toks = reduceInList(toks)
+		}
+	}
+
+	var b strings.Builder
+	for i, tok := range toks {
+		if i != 0 && sqlSpaceBefore(toks[:i], tok) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tok)
+	}
+	return b.String()
+}
+
+// sqlSpaceBefore reports whether NormalizeSQL separates tok from the tokens
+// prev preceding it by a space.
+func sqlSpaceBefore(prev []string, tok string) bool {
+	switch p := prev[len(prev)-1]; {
+	case tok == ")" || tok == "," || tok == ";" || tok == "." || p == "(" || p == ".":
+		return false
+	case tok == "(":
+		// Function calls and the column lists of tables and indexes.
+		return !sqlName(p)
+	case p == "-" || p == "+" || p == "~":
+		return !sqlUnary(prev[:len(prev)-1])
+	default:
+		return true
+	}
+}
+
+// sqlName reports whether tok is an identifier, which is not a keyword.
+func sqlName(tok string) bool {
+	switch c := tok[0]; {
+	case c == '"' || c == '`' || c == '[':
+		return true
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 0x80:
+		return !isSQLKeyword(tok)
+	default:
+		return false
+	}
+}
+
+// sqlUnary reports whether an operator following the tokens prev is unary.
+func sqlUnary(prev []string) bool {
+	if len(prev) == 0 {
+		return true
+	}
+
+	switch p := prev[len(prev)-1]; {
+	case p == ")" || p == "?":
+		return false
+	case p == "(" || p == ",":
+		return true
+	default:
+		// Another operator or a keyword.
+		return !sqlName(p)
+	}
+}
+
+// sqlOperatorLen returns the length of the operator at the start of s, see
+// https://www.sqlite.org/lang_expr.html#operators_and_parse_affecting_attributes.
+func sqlOperatorLen(s string) int {
+	for _, op := range []string{"->>", "->", "<<", ">>", "<=", ">=", "<>", "!=", "==", "||"} {
+		if strings.HasPrefix(s, op) {
+			return len(op)
+		}
+	}
+	return 1
+}
+
+var (
+	sqlKeywordsOnce sync.Once
+	sqlKeywords     map[string]bool
+)
+
+// isSQLKeyword reports whether the lower case word tok is a keyword of the
+// library, see https://www.sqlite.org/c3ref/keyword_check.html.
+func isSQLKeyword(tok string) bool {
+	sqlKeywordsOnce.Do(func() {
+		tls := libc.NewTLS()
+
+		defer tls.Close()
+
+		p := libc.Xmalloc(tls, 16)
+		if p == 0 {
+			panic("OOM")
+		}
+
+		defer libc.Xfree(tls, p)
+
+		pn := p + unsafe.Sizeof(uintptr(0))
+		n := sqlite3.Xsqlite3_keyword_count(tls)
+		sqlKeywords = make(map[string]bool, n)
+		for i := int32(0); i < n; i++ {
+			if sqlite3.Xsqlite3_keyword_name(tls, i, p, pn) != sqlite3.SQLITE_OK {
+				continue
+			}
+
+			name := libc.GoBytes(*(*uintptr)(unsafe.Pointer(p)), int(*(*int32)(unsafe.Pointer(pn))))
+			sqlKeywords[strings.ToLower(string(name))] = true
+		}
+	})
+	return sqlKeywords[tok]
+}
+
+// reduceInList replaces a list of only ? following IN at the end of toks,
+// which ends with ")", by (?).
+func reduceInList(toks []string) []string {
+	i := len(toks) - 2
+	for ; i >= 0; i-- {
+		switch toks[i] {
+		case "?", ",":
+			continue
+		}
+
+		break
+	}
+	if i < 1 || toks[i] != "(" || i == len(toks)-2 || toks[i-1] != "in" {
+		return toks
+	}
+
+	return append(toks[:i+1], "?", ")")
+}
+
+// sqlStringLen returns the length of the quoted string at the start of s.
+func sqlStringLen(s string) int {
+	n, _ := sqlToken(s)
+	return n
+}
+
+// sqlNumberLen returns the length of the numeric literal at the start of s,
+// see https://www.sqlite.org/syntax/numeric-literal.html.
+func sqlNumberLen(s string) int {
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	i := 0
+	if len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		for i = 2; i < len(s) && (isDigit(s[i]) || s[i] >= 'a' && s[i] <= 'f' || s[i] >= 'A' && s[i] <= 'F'); i++ {
+		}
+		return i
+	}
+
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	if i < len(s) && s[i] == '.' {
+		for i++; i < len(s) && isDigit(s[i]); i++ {
+		}
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && isDigit(s[j]) {
+			for i = j; i < len(s) && isDigit(s[i]); i++ {
+			}
+		}
+	}
+	return i
+}
@@ -0,0 +1,96 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNormalizeSQL(t *testing.T) {
+	for _, v := range []struct {
+		sql, want string
+	}{
+		{"SELECT * FROM t WHERE a = 1", "select * from t where a = ?"},
+		{"select *\n  from t -- comment\n where a=1.5e-3 and b='it''s'", "select * from t where a = ? and b = ?"},
+		{"select /* c */ x'00ff', .5, 0x1F, 12., 1e10", "select ?, ?, ?, ?, ?"},
+		{"select a from t where b in (1, 2, 3) and c in (?,?)", "select a from t where b in (?) and c in (?)"},
+		{"select a from t where b in (select c from u) and d not in(:x, 'y')", "select a from t where b in (select c from u) and d not in (?)"},
+		{"insert into t values(?1, :a, @b, $c, ?)", "insert into t values (?, ?, ?, ?, ?)"},
+		{`select "Mixed Case", [Br], ` + "`Bq`" + ` from T1`, `select "Mixed Case", [Br], ` + "`Bq`" + ` from t1`},
+		{"select null, true, -1", "select null, true, -?"},
+		{"  select 1;  select 2  ", "select ?; select ?"},
+		{"select x from t where x > 10 and y < f(2)", "select x from t where x > ? and y < f(?)"},
+		{"select count( * ), t . a, f (1,2) from t", "select count(*), t.a, f(?, ?) from t"},
+		{"create table t(a, b); create index x on t (a)", "create table t(a, b); create index x on t(a)"},
+		{"select a<=1, a>=1, a<>1, a!=1, a==1, a||b, a->>'$', a<<1", "select a <= ?, a >= ?, a <> ?, a != ?, a == ?, a || b, a ->> ?, a << ?"},
+		{"select a-1, a - 1, -a, - a, (-1), 2*-1, not -a, ~a, +a", "select a - ?, a - ?, -a, -a, (-?), ? * -?, not -a, ~a, +a"},
+		{"select 1 from t where (a=1 or b=2) and exists(select 1)", "select ? from t where (a = ? or b = ?) and exists (select ?)"},
+		{`select "F"(1), [g] (2) from t`, `select "F"(?), [g](?) from t`},
+	} {
+		if g := NormalizeSQL(v.sql); g != v.want {
+			t.Errorf("%q: got %q, want %q", v.sql, g, v.want)
+		}
+	}
+
+	// Statements differing only in white space and comments have the same
+	// shape.
+	for _, v := range [][]string{
+		{"select a from t where b = 2", "select a from t where b=2", "select a\nfrom t\twhere b /*c*/= 2", "select a from t where b/*c*/=2", "select a from t -- c\nwhere b=2 -- c"},
+		{"select f(a, b) from t", "select f (a,b) from t", "select f( a , b )from t", "select f/**/(a/**/,b)/**/from t"},
+		{"select a from t where b in (1, 2)", "select a from t where b in(1,2)", "select a from t where b in ( 1 , 2 )"},
+		{"select -1, a - 1", "select - 1,a-1", "select -/**/1 , a -1"},
+	} {
+		want := NormalizeSQL(v[0])
+		for _, sql := range v[1:] {
+			if g := NormalizeSQL(sql); g != want {
+				t.Errorf("%q: got %q, want %q", sql, g, want)
+			}
+		}
+	}
+}
+
+func TestTraceNormalized(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	var got []TraceEvent
+	if err := c.Raw(func(dc interface{}) error {
+		return dc.(*conn).SetTracer(func(e TraceEvent) {
+			if e.Kind == TraceProfile {
+				got = append(got, e)
+			}
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []int{1, 2} {
+		if err := c.QueryRowContext(ctx, "select ? + 40", v).Scan(new(int)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2", len(got))
+	}
+
+	for _, e := range got {
+		if g, w := e.Normalized, "select ? + ?"; g != w {
+			t.Errorf("%q: got %q, want %q", e.SQL, g, w)
+		}
+	}
+	if got[0].SQL == got[1].SQL {
+		t.Errorf("unexpected equal SQL %q", got[0].SQL)
+	}
+}
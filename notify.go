@@ -0,0 +1,413 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Change reports the rows of a table modified by the transactions committed
+// during a notification interval, see Notify.
+type Change struct {
+	Schema  string // "main" or the name of an attached database.
+	Table   string
+	Inserts int64
+	Updates int64
+	Deletes int64
+}
+
+type changeKey struct {
+	schema, table string
+}
+
+type changeSet map[changeKey]*Change
+
+func (s changeSet) add(schema, table string, inserts, updates, deletes int64) {
+	k := changeKey{schema, table}
+	ch := s[k]
+	if ch == nil {
+		ch = &Change{Schema: schema, Table: table}
+		s[k] = ch
+	}
+	ch.Inserts += inserts
+	ch.Updates += updates
+	ch.Deletes += deletes
+}
+
+// notifier distributes the changes committed to a database file by the
+// connections of the process to the subscriptions of the file.
+type notifier struct {
+	sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+var (
+	notifiersMu sync.Mutex
+	notifiers   = map[string]*notifier{}
+)
+
+func notifierFor(filename string) *notifier {
+	notifiersMu.Lock()
+
+	defer notifiersMu.Unlock()
+
+	n := notifiers[filename]
+	if n == nil {
+		n = &notifier{subs: map[*Subscription]struct{}{}}
+		notifiers[filename] = n
+	}
+	return n
+}
+
+func (n *notifier) publish(s changeSet) {
+	n.Lock()
+
+	defer n.Unlock()
+
+	for sub := range n.subs {
+		sub.add(s)
+	}
+}
+
+// changeHooks is the preupdate, commit and rollback hook state of a
+// connection, see setNotify.
+type changeHooks struct {
+	notifier  *notifier
+	pending   changeSet // Changes of the current transaction.
+	committed changeSet // Changes of transactions committed, not yet published.
+}
+
+var (
+	changeHooksMu sync.Mutex
+	changeHookSet = map[uintptr]*changeHooks{}
+	changeHookID  uintptr
+)
+
+func changeHooksFor(id uintptr) *changeHooks {
+	changeHooksMu.Lock()
+
+	defer changeHooksMu.Unlock()
+
+	return changeHookSet[id]
+}
+
+// setNotify handles the _notify query parameter.
+func (c *conn) setNotify(v string) error {
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid _notify %q", v)
+	}
+
+	filename := libc.GoString(sqlite3.Xsqlite3_db_filename(c.tls, c.db, 0))
+	if !on || filename == "" || c.readOnly { // Nothing other connections can observe.
+		return nil
+	}
+
+	h := &changeHooks{notifier: notifierFor(filename), pending: changeSet{}, committed: changeSet{}}
+	changeHooksMu.Lock()
+	changeHookID++
+	id := changeHookID
+	changeHookSet[id] = h
+	changeHooksMu.Unlock()
+
+	// The preupdate hook is used, unlike the update hook it is invoked for
+	// WITHOUT ROWID tables and for the rows deleted by REPLACE conflict
+	// resolution or by the truncate optimization.
+	//
+	// void *sqlite3_preupdate_hook(
+	//   sqlite3 *db,
+	//   void(*xPreUpdate)(
+	//     void *pCtx,
+	//     sqlite3 *db,
+	//     int op,
+	//     char const *zDb,
+	//     char const *zName,
+	//     sqlite3_int64 iKey1,
+	//     sqlite3_int64 iKey2
+	//   ),
+	//   void*
+	// );
+	sqlite3.Xsqlite3_preupdate_hook(
+		c.tls,
+		c.db,
+		*(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, uintptr, int32, uintptr, uintptr, int64, int64)
+		}{xPreUpdateHook})),
+		id,
+	)
+
+	// void *sqlite3_commit_hook(sqlite3*, int(*)(void*), void*);
+	sqlite3.Xsqlite3_commit_hook(
+		c.tls,
+		c.db,
+		*(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr) int32
+		}{xCommitHook})),
+		id,
+	)
+
+	// void *sqlite3_rollback_hook(sqlite3*, void(*)(void *), void*);
+	sqlite3.Xsqlite3_rollback_hook(
+		c.tls,
+		c.db,
+		*(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr)
+		}{xRollbackHook})),
+		id,
+	)
+
+	c.changeHooks = h
+	c.changeHooksID = id
+	return nil
+}
+
+func (c *conn) unregisterChangeHooks() {
+	if c.changeHooksID == 0 {
+		return
+	}
+
+	changeHooksMu.Lock()
+	delete(changeHookSet, c.changeHooksID)
+	changeHooksMu.Unlock()
+	c.changeHooksID = 0
+}
+
+// publishChanges hands the changes of the transactions committed by c to the
+// subscriptions of its database once c is no longer in a transaction. It
+// checks the quota of the database as well, see checkQuota.
+func (c *conn) publishChanges() {
+	c.checkQuota()
+	h := c.changeHooks
+	if h == nil || len(h.committed) == 0 || c.db == 0 || !c.autocommit() {
+		return
+	}
+
+	s := h.committed
+	h.committed = changeSet{}
+	h.notifier.publish(s)
+}
+
+func xPreUpdateHook(tls *libc.TLS, pArg, db uintptr, op int32, zDb, zTbl uintptr, key1, key2 int64) {
+	h := changeHooksFor(pArg)
+	if h == nil {
+		return
+	}
+
+	schema := libc.GoString(zDb)
+	if schema == "temp" { // Not visible to other connections.
+		return
+	}
+
+	var inserts, updates, deletes int64
+	switch op {
+	case sqlite3.SQLITE_INSERT:
+		inserts = 1
+	case sqlite3.SQLITE_UPDATE:
+		updates = 1
+	case sqlite3.SQLITE_DELETE:
+		deletes = 1
+	}
+	h.pending.add(schema, libc.GoString(zTbl), inserts, updates, deletes)
+}
+
+func xCommitHook(tls *libc.TLS, pArg uintptr) int32 {
+	if h := changeHooksFor(pArg); h != nil {
+		// The commit may still fail with SQLITE_BUSY, leaving the transaction
+		// open, so the changes are published only when it has ended.
+		for _, v := range h.pending {
+			h.committed.add(v.Schema, v.Table, v.Inserts, v.Updates, v.Deletes)
+		}
+		h.pending = changeSet{}
+	}
+	return 0
+}
+
+func xRollbackHook(tls *libc.TLS, pArg uintptr) {
+	if h := changeHooksFor(pArg); h != nil {
+		h.pending = changeSet{}
+		h.committed = changeSet{}
+	}
+}
+
+// Subscription delivers the changes of a database, see Notify.
+type Subscription struct {
+	// C receives one Change per modified table at the end of every
+	// notification interval in which changes were committed. It is closed by
+	// Close.
+	C <-chan Change
+
+	c        chan Change
+	n        *notifier
+	tables   []string
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending changeSet
+	kick    chan struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Notify subscribes to the changes committed to the main database of db, and
+// to the databases attached to it, by the connections of the process opened
+// with the _notify query parameter, see Driver.Open. Changes are reported
+// only after their transaction commits, changes of transactions rolled back
+// are not reported. If tables are given, only changes of the tables of those
+// names, optionally qualified by a schema name like "main.users", are
+// reported.
+//
+// The changes committed within interval after the first one are coalesced,
+// so a burst of transactions results in a single Change per table. The
+// counts of the coalesced Changes are summed. If the receiver falls behind,
+// the changes keep being coalesced until C is read again. Notify is meant for
+// invalidating caches and refreshing views, the exact counts are best effort:
+// rows restored by ROLLBACK TO or by a failed statement of a transaction are
+// still counted. Changes of virtual tables and changes made by other
+// processes are not reported.
+//
+// Call Close to release the Subscription.
+func Notify(db *sql.DB, interval time.Duration, tables ...string) (*Subscription, error) {
+	ctx := context.Background()
+	sc, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer sc.Close()
+
+	var n *notifier
+	if err := sc.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*conn)
+		if !ok {
+			return fmt.Errorf("sqlite: Notify: unexpected driver connection %T", driverConn)
+		}
+
+		if c.changeHooks == nil {
+			return fmt.Errorf("sqlite: Notify: the database is not opened with _notify or has no file name")
+		}
+
+		n = c.changeHooks.notifier
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Change)
+	s := &Subscription{
+		C:        ch,
+		c:        ch,
+		n:        n,
+		tables:   tables,
+		interval: interval,
+		pending:  changeSet{},
+		kick:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	n.Lock()
+	n.subs[s] = struct{}{}
+	n.Unlock()
+	go s.run()
+	return s, nil
+}
+
+// Close ends the subscription and closes C.
+func (s *Subscription) Close() error {
+	s.closeOnce.Do(func() {
+		s.n.Lock()
+		delete(s.n.subs, s)
+		s.n.Unlock()
+		close(s.done)
+	})
+	return nil
+}
+
+func (s *Subscription) wants(ch *Change) bool {
+	if len(s.tables) == 0 {
+		return true
+	}
+
+	for _, v := range s.tables {
+		if strings.EqualFold(v, ch.Table) || strings.EqualFold(v, ch.Schema+"."+ch.Table) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription) add(cs changeSet) {
+	s.mu.Lock()
+	added := false
+	for _, v := range cs {
+		if s.wants(v) {
+			s.pending.add(v.Schema, v.Table, v.Inserts, v.Updates, v.Deletes)
+			added = true
+		}
+	}
+	s.mu.Unlock()
+	if !added {
+		return
+	}
+
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) run() {
+	defer close(s.c)
+
+	for {
+		select {
+		case <-s.kick:
+		case <-s.done:
+			return
+		}
+
+		if s.interval > 0 {
+			t := time.NewTimer(s.interval)
+			select {
+			case <-t.C:
+			case <-s.done:
+				t.Stop()
+				return
+			}
+		}
+
+		s.mu.Lock()
+		cs := make([]Change, 0, len(s.pending))
+		for _, v := range s.pending {
+			cs = append(cs, *v)
+		}
+		s.pending = changeSet{}
+		s.mu.Unlock()
+		sort.Slice(cs, func(i, j int) bool {
+			if cs[i].Schema != cs[j].Schema {
+				return cs[i].Schema < cs[j].Schema
+			}
+
+			return cs[i].Table < cs[j].Table
+		})
+		for _, v := range cs {
+			select {
+			case s.c <- v:
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
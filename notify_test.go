@@ -0,0 +1,165 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// changes returns the Changes received from s, waiting for the first one at
+// most wait.
+func changes(s *Subscription, wait time.Duration) (r []Change) {
+	select {
+	case ch := <-s.C:
+		r = append(r, ch)
+	case <-time.After(wait):
+		return nil
+	}
+
+	for {
+		select {
+		case ch := <-s.C:
+			r = append(r, ch)
+		case <-time.After(50 * time.Millisecond):
+			return r
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	open := func() *sql.DB {
+		db, err := sql.Open(driverName, fn+"?_notify=1&_pragma=busy_timeout(10000)")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return db
+	}
+	db := open()
+
+	defer db.Close()
+
+	// Another handle of the same file, the changes of all the connections of
+	// the process are reported.
+	other := open()
+
+	defer other.Close()
+
+	if _, err := db.Exec("create table t(i); create table u(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := Notify(db, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer all.Close()
+
+	onlyU, err := Notify(other, 0, "main.u")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer onlyU.Close()
+
+	if _, err := other.Exec("insert into t values(1); insert into t values(2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := changes(all, 10*time.Second), []Change{{Schema: "main", Table: "t", Inserts: 2}}; !equalChanges(g, e) {
+		t.Fatalf("got %+v, want %+v", g, e)
+	}
+
+	// Changes are reported after the commit only.
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tx.Exec("insert into u values(1); update t set i = 3 where i = 2; delete from t where i = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := changes(all, 50*time.Millisecond); len(g) != 0 {
+		t.Fatalf("unexpected changes before commit %+v", g)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := changes(all, 10*time.Second), []Change{
+		{Schema: "main", Table: "t", Updates: 1, Deletes: 1},
+		{Schema: "main", Table: "u", Inserts: 1},
+	}; !equalChanges(g, e) {
+		t.Fatalf("got %+v, want %+v", g, e)
+	}
+
+	if g, e := changes(onlyU, 10*time.Second), []Change{{Schema: "main", Table: "u", Inserts: 1}}; !equalChanges(g, e) {
+		t.Fatalf("got %+v, want %+v", g, e)
+	}
+
+	// Changes of transactions rolled back are not reported.
+	for _, db := range []*sql.DB{db, other} {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tx.Exec("insert into t values(4); insert into u values(4)"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if g := changes(all, 100*time.Millisecond); len(g) != 0 {
+		t.Fatalf("unexpected changes after rollback %+v", g)
+	}
+
+	if err := all.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case _, ok := <-all.C:
+		if ok {
+			t.Fatal("C is not closed")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("C is not closed")
+	}
+
+	mem, err := sql.Open(driverName, ":memory:?_notify=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer mem.Close()
+
+	if _, err := Notify(mem, 0); err == nil {
+		t.Fatal("unexpected success")
+	}
+}
+
+func equalChanges(a, b []Change) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
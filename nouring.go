@@ -0,0 +1,20 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux || !sqlite_uring
+// +build !linux !sqlite_uring
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"modernc.org/libc"
+)
+
+// RegisterIOUringVFS registers a VFS named name. With the sqlite_uring build
+// tag on Linux it performs I/O using io_uring. In this build it forwards
+// everything to the default VFS.
+func RegisterIOUringVFS(name string) error {
+	_, err := registerShimVFS(name, "", func(*libc.TLS, *shimFile) (fileHooks, error) { return nil, nil })
+	return err
+}
@@ -0,0 +1,173 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ofdVFS is the name of the VFS locking database files using open file
+// description locks, see the _locking query parameter.
+const ofdVFS = "unix-ofd"
+
+// The byte ranges of the database file SQLite locks, see os.h of the SQLite
+// sources.
+const (
+	ofdPendingByte  = 0x40000000
+	ofdReservedByte = ofdPendingByte + 1
+	ofdSharedFirst  = ofdPendingByte + 2
+	ofdSharedSize   = 510
+)
+
+var (
+	ofdOnce sync.Once
+	ofdErr  error
+)
+
+// registerOFDVFS registers the OFD locking VFS on first use. It forwards to
+// the unix VFS, which keeps providing the shared memory of WAL mode, and takes
+// over the locking of main database files.
+func registerOFDVFS() (string, error) {
+	ofdOnce.Do(func() {
+		_, ofdErr = registerShimVFS(ofdVFS, "unix", func(tls *libc.TLS, f *shimFile) (fileHooks, error) {
+			if !f.isMainDB() {
+				return nil, nil
+			}
+
+			return &ofdLock{fd: uintptr((*sqlite3.UnixFile)(unsafe.Pointer(f.real)).Fh)}, nil
+		})
+	})
+	return ofdVFS, ofdErr
+}
+
+// ofdLock implements the locking protocol of SQLite using OFD locks on the
+// file descriptor of the underlying unix file. Every connection opens the
+// database file itself, so its locks are its own, unlike the POSIX locks the
+// unix VFS shares between the connections of the process.
+type ofdLock struct {
+	passThrough
+	fd    uintptr
+	level int32 // SQLITE_LOCK_*
+}
+
+// set changes the lock of the n bytes at off to typ. It fails with
+// SQLITE_BUSY if a conflicting lock is held by another open file, and with
+// ioerr on other errors.
+func (l *ofdLock) set(typ int16, off, n int64, ioerr int32) int32 {
+	lk := unix.Flock_t{Type: typ, Whence: 0, Start: off, Len: n}
+	switch err := unix.FcntlFlock(l.fd, unix.F_OFD_SETLK, &lk); err {
+	case nil:
+		return sqlite3.SQLITE_OK
+	case unix.EAGAIN, unix.EACCES, unix.EBUSY, unix.EINTR, unix.ENOLCK, unix.ETIMEDOUT:
+		return sqlite3.SQLITE_BUSY
+	case unix.EPERM:
+		return sqlite3.SQLITE_PERM
+	default:
+		return ioerr
+	}
+}
+
+func (l *ofdLock) lock(tls *libc.TLS, f *shimFile, level int32) int32 {
+	if l.level >= level {
+		return sqlite3.SQLITE_OK
+	}
+
+	switch level {
+	case sqlite3.SQLITE_LOCK_SHARED:
+		// Holding the pending byte while taking the shared range keeps out
+		// new readers once a writer waits for exclusive access.
+		if rc := l.set(unix.F_RDLCK, ofdPendingByte, 1, sqlite3.SQLITE_IOERR_LOCK); rc != sqlite3.SQLITE_OK {
+			return rc
+		}
+
+		rc := l.set(unix.F_RDLCK, ofdSharedFirst, ofdSharedSize, sqlite3.SQLITE_IOERR_RDLOCK)
+		if rc2 := l.set(unix.F_UNLCK, ofdPendingByte, 1, sqlite3.SQLITE_IOERR_UNLOCK); rc == sqlite3.SQLITE_OK {
+			rc = rc2
+		}
+		if rc != sqlite3.SQLITE_OK {
+			return rc
+		}
+	case sqlite3.SQLITE_LOCK_RESERVED:
+		if rc := l.set(unix.F_WRLCK, ofdReservedByte, 1, sqlite3.SQLITE_IOERR_LOCK); rc != sqlite3.SQLITE_OK {
+			return rc
+		}
+	case sqlite3.SQLITE_LOCK_PENDING, sqlite3.SQLITE_LOCK_EXCLUSIVE:
+		if l.level < sqlite3.SQLITE_LOCK_PENDING {
+			if rc := l.set(unix.F_WRLCK, ofdPendingByte, 1, sqlite3.SQLITE_IOERR_LOCK); rc != sqlite3.SQLITE_OK {
+				return rc
+			}
+
+			l.level = sqlite3.SQLITE_LOCK_PENDING
+		}
+		if level == sqlite3.SQLITE_LOCK_PENDING {
+			return sqlite3.SQLITE_OK
+		}
+
+		if rc := l.set(unix.F_WRLCK, ofdSharedFirst, ofdSharedSize, sqlite3.SQLITE_IOERR_LOCK); rc != sqlite3.SQLITE_OK {
+			return rc
+		}
+	}
+	l.level = level
+	return sqlite3.SQLITE_OK
+}
+
+func (l *ofdLock) unlock(tls *libc.TLS, f *shimFile, level int32) int32 {
+	if l.level <= level {
+		return sqlite3.SQLITE_OK
+	}
+
+	if level == sqlite3.SQLITE_LOCK_SHARED {
+		if l.level == sqlite3.SQLITE_LOCK_EXCLUSIVE {
+			if rc := l.set(unix.F_RDLCK, ofdSharedFirst, ofdSharedSize, sqlite3.SQLITE_IOERR_RDLOCK); rc != sqlite3.SQLITE_OK {
+				return rc
+			}
+		}
+
+		if rc := l.set(unix.F_UNLCK, ofdPendingByte, 2, sqlite3.SQLITE_IOERR_UNLOCK); rc != sqlite3.SQLITE_OK {
+			return rc
+		}
+
+		l.level = level
+		return sqlite3.SQLITE_OK
+	}
+
+	if rc := l.set(unix.F_UNLCK, ofdPendingByte, 2+ofdSharedSize, sqlite3.SQLITE_IOERR_UNLOCK); rc != sqlite3.SQLITE_OK {
+		return rc
+	}
+
+	l.level = sqlite3.SQLITE_LOCK_NONE
+	return sqlite3.SQLITE_OK
+}
+
+func (l *ofdLock) checkReservedLock(tls *libc.TLS, f *shimFile, pResOut uintptr) int32 {
+	reserved := l.level > sqlite3.SQLITE_LOCK_SHARED
+	if !reserved {
+		lk := unix.Flock_t{Type: unix.F_WRLCK, Whence: 0, Start: ofdReservedByte, Len: 1}
+		if err := unix.FcntlFlock(l.fd, unix.F_OFD_GETLK, &lk); err != nil {
+			return sqlite3.SQLITE_IOERR_CHECKRESERVEDLOCK
+		}
+
+		reserved = lk.Type != unix.F_UNLCK
+	}
+	*(*int32)(unsafe.Pointer(pResOut)) = libc.Bool32(reserved)
+	return sqlite3.SQLITE_OK
+}
+
+func (l *ofdLock) fileControl(tls *libc.TLS, f *shimFile, op int32, pArg uintptr) int32 {
+	if op == sqlite3.SQLITE_FCNTL_LOCKSTATE {
+		*(*int32)(unsafe.Pointer(pArg)) = l.level
+		return sqlite3.SQLITE_OK
+	}
+
+	return l.passThrough.fileControl(tls, f, op, pArg)
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// optimizeAnalysisLimit bounds the rows ANALYZE examines per index while
+// Optimize runs, the value recommended by
+// https://www.sqlite.org/lang_analyze.html#approx.
+const optimizeAnalysisLimit = 400
+
+// Optimize runs PRAGMA optimize, see
+// https://www.sqlite.org/pragma.html#pragma_optimize, which runs ANALYZE on
+// the tables whose statistics are missing or outdated and which the queries
+// of the connection would benefit from, so query plans stay good as the data
+// changes. It usually takes a few milliseconds, it does nothing when there is
+// nothing to do. If the analysis_limit of the connection is zero, unlimited,
+// it is set to 400 while Optimize runs, so analyzing large tables does not
+// take long. See also the _optimize query parameter of Driver.Open.
+//
+// Optimize can be reached using (*sql.Conn).Raw.
+func (c *conn) Optimize(ctx context.Context) (err error) {
+	limit, err := c.pragmaInt64("analysis_limit")
+	if err != nil {
+		return err
+	}
+
+	if limit == 0 {
+		if _, err := c.Pragma("analysis_limit", optimizeAnalysisLimit); err != nil {
+			return err
+		}
+
+		defer func() {
+			if _, e := c.Pragma("analysis_limit", 0); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+
+	if _, err = c.exec(ctx, "pragma optimize", nil); err == nil {
+		c.optimized = time.Now()
+	}
+	return err
+}
+
+// setOptimize handles the _optimize query parameter.
+func (c *conn) setOptimize(v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid _optimize %q", v)
+	}
+
+	c.optimize = true
+	c.optimizeEvery = d
+	c.optimized = time.Now()
+	return nil
+}
+
+// optimizeIdle runs Optimize for the _optimize query parameter when the
+// connection is taken from the pool for reuse, if the interval passed since
+// the last run. Failures are only logged, they do not affect the connection.
+func (c *conn) optimizeIdle(ctx context.Context) {
+	if !c.optimize || c.optimizeEvery == 0 || time.Since(c.optimized) < c.optimizeEvery {
+		return
+	}
+
+	if err := c.Optimize(ctx); err != nil {
+		logf(sqlite3.SQLITE_WARNING, "sqlite: optimize: %v", err)
+	}
+}
+
+// optimizeOnClose runs Optimize for the _optimize query parameter before the
+// connection is closed.
+func (c *conn) optimizeOnClose() {
+	if !c.optimize || c.db == 0 || c.panic || !c.autocommit() {
+		return
+	}
+
+	if err := c.Optimize(context.Background()); err != nil {
+		logf(sqlite3.SQLITE_WARNING, "sqlite: optimize: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, name+"?_optimize=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+create table t(i integer primary key, j);
+create index x on t(j);
+insert into t(j) with recursive s(i) as (select 1 union all select i + 1 from s where i < 1000) select i % 10 from s;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := db.QueryRow("select count(*) from t where j = 3").Scan(&n); err != nil || n != 100 {
+		t.Fatalf("%d rows, %v", n, err)
+	}
+
+	stats := func() (n int) {
+		t.Helper()
+		if err := db.QueryRow("select count(*) from sqlite_master where name = 'sqlite_stat1'").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+
+		return n
+	}
+
+	if stats() != 0 {
+		t.Fatal("unexpected sqlite_stat1")
+	}
+
+	// Closing the connection analyzes t.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = sql.Open(driverName, name); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats() != 1 {
+		t.Fatal("missing sqlite_stat1")
+	}
+
+	sc, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sc.Close()
+
+	var limit int64
+	if err := sc.Raw(func(dc interface{}) (err error) {
+		c := dc.(*conn)
+		if err = c.Optimize(context.Background()); err != nil {
+			return err
+		}
+
+		limit, err = c.pragmaInt64("analysis_limit")
+		return err
+	}); err != nil || limit != 0 {
+		t.Fatalf("analysis_limit %d, %v, want 0", limit, err)
+	}
+}
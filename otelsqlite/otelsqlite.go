@@ -0,0 +1,295 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package otelsqlite instruments modernc.org/sqlite with OpenTelemetry
+// tracing.
+//
+// The connections of its driver create a span for every statement they run,
+// as a child of the span in the context of the Exec, Query, BeginTx, Commit or
+// Rollback running it:
+//
+//	sql.Register("sqlite3-otel", otelsqlite.NewDriver())
+//	db, err := sql.Open("sqlite3-otel", "app.db")
+//
+//	...
+//
+//	rows, err := db.QueryContext(ctx, "select * from t where x = ?", x)
+//
+// The spans are built from the statement tracer of the connections, see
+// SetTracer in modernc.org/sqlite, so executing several statements at once
+// produces a span of each and a transaction produces spans of its BEGIN and
+// COMMIT statements. The span of a query ends when its rows are closed. Spans
+// are named after the first keyword of their statement, like SELECT, and
+// have the attributes
+//
+//	db.system                "sqlite"
+//	db.statement             the SQL text with parameters expanded
+//	db.sqlite.rows           the number of result rows
+//	db.sqlite.fullscan_steps the counters of sqlite.StmtStatus
+//	db.sqlite.sorts
+//	db.sqlite.autoindexes
+//	db.sqlite.vm_steps
+//	db.sqlite.reprepares
+//	db.sqlite.filter_hits
+//	db.sqlite.filter_misses
+//
+// Statements run by triggers are recorded as "trigger" events of the span of
+// the statement firing them. If an operation fails, the error is recorded on
+// the span of its last statement, or on a span of its own if it failed before
+// any statement ran, like on a syntax error. Statements run outside of these
+// operations, like the one of Ping, are not traced.
+package otelsqlite // import "modernc.org/sqlite/otelsqlite"
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"modernc.org/sqlite"
+)
+
+const instrumentationName = "modernc.org/sqlite/otelsqlite"
+
+// Attribute keys of the spans.
+const (
+	System        = attribute.Key("db.system")
+	Statement     = attribute.Key("db.statement")
+	Rows          = attribute.Key("db.sqlite.rows")
+	FullscanSteps = attribute.Key("db.sqlite.fullscan_steps")
+	Sorts         = attribute.Key("db.sqlite.sorts")
+	AutoIndexes   = attribute.Key("db.sqlite.autoindexes")
+	VMSteps       = attribute.Key("db.sqlite.vm_steps")
+	Reprepares    = attribute.Key("db.sqlite.reprepares")
+	FilterHits    = attribute.Key("db.sqlite.filter_hits")
+	FilterMisses  = attribute.Key("db.sqlite.filter_misses")
+)
+
+type config struct {
+	provider trace.TracerProvider
+	redact   func(param string) bool
+}
+
+// Option configures the driver returned by NewDriver.
+type Option func(*config)
+
+// WithTracerProvider sets the provider of the tracer creating the spans. The
+// default is the global provider, see otel.GetTracerProvider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) { c.provider = provider }
+}
+
+// WithRedaction leaves the values of the parameters selected by f out of the
+// db.statement attribute, see SetTraceRedaction in modernc.org/sqlite.
+func WithRedaction(f func(param string) bool) Option {
+	return func(c *config) { c.redact = f }
+}
+
+// Driver is a database/sql driver opening instrumented connections, see
+// NewDriver.
+type Driver struct {
+	d      *sqlite.Driver
+	tracer trace.Tracer
+	redact func(string) bool
+
+	mu    sync.Mutex
+	conns map[driver.Conn]*conn
+}
+
+// NewDriver returns a driver opening connections like the "sqlite3" driver of
+// modernc.org/sqlite, which trace their statements. The tracer of the
+// connections must not be replaced using SetTracer.
+func NewDriver(opts ...Option) *Driver {
+	cfg := config{provider: otel.GetTracerProvider()}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	r := &Driver{
+		tracer: cfg.provider.Tracer(instrumentationName),
+		redact: cfg.redact,
+		conns:  map[driver.Conn]*conn{},
+	}
+	r.d = sqlite.WrapDriver(r.intercept)
+	return r
+}
+
+// Open implements driver.Driver.
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	c, err := d.d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	t := c.(interface {
+		SetTracer(func(sqlite.TraceEvent)) error
+		SetTraceRedaction(func(string) bool)
+	})
+	t.SetTraceRedaction(d.redact)
+	state := &conn{tracer: d.tracer}
+	if err := t.SetTracer(state.trace); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.conns[c] = state
+	d.mu.Unlock()
+	return c, nil
+}
+
+func (d *Driver) intercept(ctx context.Context, e *sqlite.InterceptEvent) func() {
+	d.mu.Lock()
+	c := d.conns[e.Conn]
+	d.mu.Unlock()
+	if c == nil {
+		return nil
+	}
+
+	o := &operation{ctx: ctx, start: e.Start}
+	c.ops = append(c.ops, o)
+	return func() {
+		c.end(o, e)
+		if e.Kind == sqlite.InterceptClose {
+			d.mu.Lock()
+			delete(d.conns, e.Conn)
+			d.mu.Unlock()
+		}
+	}
+}
+
+// conn is the tracing state of a connection. It is used only by the goroutine
+// using the connection.
+type conn struct {
+	tracer  trace.Tracer
+	ops     []*operation // In progress, in the order they started.
+	running []*statement // In the order they started.
+}
+
+// operation is an operation reported by the connection, which runs the
+// statements started while it is the last one in progress.
+type operation struct {
+	ctx   context.Context
+	start time.Time
+	spans []finished // Of the statements of the operation.
+}
+
+type finished struct {
+	span trace.Span
+	end  time.Time
+}
+
+type statement struct {
+	sql  string
+	span trace.Span
+	op   *operation
+}
+
+func (c *conn) trace(e sqlite.TraceEvent) {
+	switch e.Kind {
+	case sqlite.TraceStmt:
+		if e.Trigger {
+			if n := len(c.running); n != 0 {
+				c.running[n-1].span.AddEvent("trigger", trace.WithAttributes(Statement.String(e.SQL)))
+			}
+			return
+		}
+
+		if len(c.ops) == 0 {
+			return
+		}
+
+		o := c.ops[len(c.ops)-1]
+		_, span := c.tracer.Start(o.ctx, spanName(e.SQL),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(System.String("sqlite"), Statement.String(e.SQL)),
+		)
+		c.running = append(c.running, &statement{sql: e.SQL, span: span, op: o})
+	case sqlite.TraceProfile:
+		for i := len(c.running) - 1; i >= 0; i-- {
+			s := c.running[i]
+			if s.sql != e.SQL {
+				continue
+			}
+
+			st := e.Status
+			s.span.SetAttributes(
+				Rows.Int64(e.Rows),
+				FullscanSteps.Int64(st.FullscanSteps),
+				Sorts.Int64(st.Sorts),
+				AutoIndexes.Int64(st.AutoIndexes),
+				VMSteps.Int64(st.VMSteps),
+				Reprepares.Int64(st.Reprepares),
+				FilterHits.Int64(st.FilterHits),
+				FilterMisses.Int64(st.FilterMisses),
+			)
+			// The span ends with its operation, which knows whether the
+			// statement failed.
+			s.op.spans = append(s.op.spans, finished{s.span, time.Now()})
+			c.running = append(c.running[:i], c.running[i+1:]...)
+			return
+		}
+	}
+}
+
+// end ends the spans of the operation o, reported as e.
+func (c *conn) end(o *operation, e *sqlite.InterceptEvent) {
+	for i, v := range c.ops {
+		if v == o {
+			c.ops = append(c.ops[:i], c.ops[i+1:]...)
+			break
+		}
+	}
+
+	// Statements not finished yet, because their operation failed or
+	// abandoned them, end now.
+	w := 0
+	for _, s := range c.running {
+		if s.op != o {
+			c.running[w] = s
+			w++
+			continue
+		}
+
+		o.spans = append(o.spans, finished{s.span, time.Now()})
+	}
+	c.running = c.running[:w]
+
+	if e.Err != nil {
+		if len(o.spans) == 0 {
+			_, span := c.tracer.Start(o.ctx, spanName(e.SQL),
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithTimestamp(o.start),
+				trace.WithAttributes(System.String("sqlite"), Statement.String(e.SQL)),
+			)
+			o.spans = append(o.spans, finished{span, time.Now()})
+		}
+		span := o.spans[len(o.spans)-1].span
+		span.RecordError(e.Err)
+		span.SetStatus(codes.Error, e.Err.Error())
+	}
+	for _, v := range o.spans {
+		v.span.End(trace.WithTimestamp(v.end))
+	}
+}
+
+// spanName returns the first keyword of sql, in upper case, or "sqlite".
+func spanName(sql string) string {
+	sql = strings.TrimSpace(sql)
+	i := strings.IndexFunc(sql, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})
+	if i < 0 {
+		i = len(sql)
+	}
+	if i == 0 {
+		return "sqlite"
+	}
+
+	return strings.ToUpper(sql[:i])
+}
@@ -0,0 +1,134 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otelsqlite // import "modernc.org/sqlite/otelsqlite"
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func attr(s sdktrace.ReadOnlySpan, k attribute.Key) attribute.Value {
+	for _, v := range s.Attributes() {
+		if v.Key == k {
+			return v.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	sql.Register("sqlite3-otel-test", NewDriver(
+		WithTracerProvider(provider),
+		WithRedaction(func(param string) bool { return param == ":secret" }),
+	))
+	db, err := sql.Open("sqlite3-otel-test", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	if _, err := db.ExecContext(ctx, `
+create table t(x unique);
+create table log(x);
+create trigger tr after insert on t begin insert into log values(new.x); end;
+insert into t values(1), (2);
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.QueryContext(ctx, "select x from t where x > ? or x = :secret", 0, sql.Named("secret", 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for rows.Next() {
+	}
+	rows.Close()
+
+	if _, err := db.ExecContext(ctx, "insert into t values(1)"); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	if _, err := db.ExecContext(ctx, "insert into t values("); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "delete from t"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	parent.End()
+	spans := recorder.Ended()
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name())
+	}
+	if g, e := strings.Join(names, " "), "CREATE CREATE CREATE INSERT SELECT INSERT INSERT BEGIN DELETE COMMIT parent"; g != e {
+		t.Fatalf("spans\ngot  %s\nwant %s", g, e)
+	}
+
+	for i, s := range spans[:len(spans)-1] {
+		if s.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%d %s: not a child of the parent span", i, s.Name())
+		}
+		if g := attr(s, System).AsString(); g != "sqlite" {
+			t.Errorf("%d %s: db.system %q", i, s.Name(), g)
+		}
+		if i != 6 && attr(s, VMSteps).AsInt64() == 0 {
+			t.Errorf("%d %s: no db.sqlite.vm_steps", i, s.Name())
+		}
+		if g, e := s.Status().Code, codes.Unset; (i == 5 || i == 6) != (g != e) {
+			t.Errorf("%d %s: status %v", i, s.Name(), s.Status())
+		}
+	}
+
+	insert := spans[3]
+	if g, e := attr(insert, Statement).AsString(), "insert into t values(1), (2);"; g != e {
+		t.Errorf("db.statement %q, want %q", g, e)
+	}
+
+	// The trigger runs for each of the two rows.
+	if ev := insert.Events(); len(ev) != 4 || ev[0].Name != "trigger" || attr(insert, Rows).AsInt64() != 0 {
+		t.Errorf("insert events %v, want four trigger events", ev)
+	}
+
+	query := spans[4]
+	if g, e := attr(query, Statement).AsString(), "select x from t where x > 0 or x = :secret"; g != e {
+		t.Errorf("db.statement %q, want %q", g, e)
+	}
+
+	if g := attr(query, Rows).AsInt64(); g != 2 {
+		t.Errorf("db.sqlite.rows %d, want 2", g)
+	}
+
+	if g, e := attr(spans[6], Statement).AsString(), "insert into t values("; g != e {
+		t.Errorf("db.statement %q, want %q", g, e)
+	}
+}
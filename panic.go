@@ -0,0 +1,95 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// panicked converts r, the value of a panic recovered from the library
+// function fn, to an error and marks c as unusable: the state of the library
+// is unknown after a panic, so c does not call into it anymore and
+// database/sql discards c. sql returns the statement being run, it is called
+// with panics recovered. panicked must be called by the deferred function
+// recovering the panic.
+//
+// If the panic was raised by Go code called by the library, like a user
+// defined function, the data structures of the library are intact and Close
+// finalizes the statements of c and closes its database handle, releasing
+// its file locks. If it was raised by the library itself, Close leaves the
+// handle alone, leaking its memory, and the file locks it holds are kept
+// until the process exits.
+//
+// Panics are caused by bugs of the translation of the C code, like nil
+// pointer dereferences and unaligned accesses, or by panicking user defined
+// functions. Faults accessing memory are recoverable only if the running
+// goroutine has debug.SetPanicOnFault set. Errors the Go runtime deems fatal,
+// like a stack overflow, still end the process.
+func (c *conn) panicked(fn string, r interface{}, sql func() string) error {
+	c.panic = true
+	c.panicInLib = panicInLib()
+	var s string
+	func() {
+		defer func() { recover() }()
+
+		s = sql()
+	}()
+	logf(sqlite3.SQLITE_INTERNAL, "sqlite: panic in %s on %s/%s: %v\nSQL: %s\n%s", fn, runtime.GOOS, runtime.GOARCH, r, s, debug.Stack())
+	return &Error{
+		msg:  fmt.Sprintf("sqlite: panic in %s on %s/%s: %v (SQL: %s)", fn, runtime.GOOS, runtime.GOARCH, r, s),
+		code: sqlite3.SQLITE_INTERNAL,
+	}
+}
+
+// stmtSQL returns the text of the prepared statement pstmt.
+func (c *conn) stmtSQL(pstmt uintptr) string {
+	return libc.GoString(sqlite3.Xsqlite3_sql(c.tls, pstmt))
+}
+
+// panicInLib reports whether the panic being recovered was raised by the code
+// of the library, as opposed to the Go code it calls. It must be called by
+// the deferred function recovering the panic or by a function it calls.
+func panicInLib() bool {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	unwinding := false
+	for {
+		f, more := frames.Next()
+		switch {
+		case f.Function == "runtime.gopanic":
+			unwinding = true
+		case unwinding && !strings.HasPrefix(f.Function, "runtime."):
+			// The frame raising the panic.
+			return strings.HasPrefix(f.Function, "modernc.org/sqlite/lib.") || strings.HasPrefix(f.Function, "modernc.org/libc")
+		}
+		if !more {
+			return true
+		}
+	}
+}
+
+// closeAfterPanic finalizes the statements of c and closes its database
+// handle after a panic of Go code called by the library, see panicked.
+func (c *conn) closeAfterPanic() {
+	defer func() {
+		if r := recover(); r != nil {
+			logf(sqlite3.SQLITE_INTERNAL, "sqlite: panic closing the connection after a panic: %v", r)
+		}
+	}()
+
+	// sqlite3_stmt *sqlite3_next_stmt(sqlite3 *pDb, sqlite3_stmt *pStmt);
+	for p := sqlite3.Xsqlite3_next_stmt(c.tls, c.db, 0); p != 0; p = sqlite3.Xsqlite3_next_stmt(c.tls, c.db, 0) {
+		sqlite3.Xsqlite3_finalize(c.tls, p)
+	}
+	if err := c.closeV2(c.db); err != nil {
+		logf(sqlite3.SQLITE_INTERNAL, "sqlite: closing the connection after a panic: %v", err)
+	}
+}
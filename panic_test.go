@@ -0,0 +1,78 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"path/filepath"
+	"testing"
+)
+
+// TestPanicCloseReleasesLocks checks the connection of a panicking user
+// defined function is closed, so it does not keep its database locked.
+func TestPanicCloseReleasesLocks(t *testing.T) {
+	if err := RegisterScalarFunction("test_panic_close", 0, func(*FunctionContext, []driver.Value) (driver.Value, error) {
+		var p *int
+		return *p, nil // A runtime error of Go code called by the library.
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ExecContext(ctx, "begin; insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ExecContext(ctx, "select test_panic_close()"); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	var inLib bool
+	c.Raw(func(dc interface{}) error {
+		inLib = dc.(*conn).panicInLib
+		return nil
+	})
+	if inLib {
+		t.Fatal("panic of a user defined function attributed to the library")
+	}
+
+	c.Close()
+
+	// Another pool plays the part of another process.
+	other, err := sql.Open(driverName, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer other.Close()
+
+	if _, err := other.Exec("insert into t values(2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := other.QueryRow("select count(*) from t").Scan(&n); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+}
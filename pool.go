@@ -0,0 +1,147 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Pool is a pair of database handles sharing one database file in WAL mode:
+// a read-write handle limited to a single connection and a read-only handle
+// of several connections. As SQLite allows only one writer at a time, this
+// is the recommended way to size the database/sql connection pool for
+// concurrent use. Pool routes queries to the readers and everything else to
+// the writer.
+type Pool struct {
+	r        *sql.DB
+	w        *sql.DB
+	filename string // Of the database, see LastCommit.
+}
+
+// OpenPool opens the database name, which must be a file name or a "file:"
+// URI naming a database file, and returns a Pool of readers read-only
+// connections and one read-write connection. The query parameters of name,
+// see Driver.Open, apply to all connections. The database is switched to WAL
+// mode and the writer starts its transactions immediately, see _txlock. A
+// readers value less than 1 is treated as 1.
+func OpenPool(name string, readers int) (*Pool, error) {
+	if readers < 1 {
+		readers = 1
+	}
+
+	w, err := sql.Open("sqlite3", addQuery(name, "_pragma=journal_mode(wal)&_txlock=immediate"))
+	if err != nil {
+		return nil, err
+	}
+
+	w.SetMaxOpenConns(1)
+	w.SetMaxIdleConns(1)
+	w.SetConnMaxLifetime(0)
+	w.SetConnMaxIdleTime(0)
+	// Make sure the database is in WAL mode before any reader opens it.
+	sc, err := w.Conn(context.Background())
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	var filename string
+	err = sc.Raw(func(dc interface{}) error {
+		c := dc.(*conn)
+		filename = libc.GoString(sqlite3.Xsqlite3_db_filename(c.tls, c.db, 0))
+		return nil
+	})
+	sc.Close()
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	r, err := sql.Open("sqlite3", addQuery(name, "_pragma=query_only(1)"))
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	r.SetMaxOpenConns(readers)
+	r.SetMaxIdleConns(readers)
+	return &Pool{r: r, w: w, filename: filename}, nil
+}
+
+// addQuery appends the query parameters query to the data source name name.
+func addQuery(name, query string) string {
+	if strings.IndexByte(name, '?') >= 0 {
+		return name + "&" + query
+	}
+
+	return name + "?" + query
+}
+
+// Reader returns the handle of the read-only connections.
+func (p *Pool) Reader() *sql.DB { return p.r }
+
+// Writer returns the handle of the read-write connection. Queries that modify
+// the database, like INSERT ... RETURNING, must use the writer explicitly.
+func (p *Pool) Writer() *sql.DB { return p.w }
+
+// Close closes both handles.
+func (p *Pool) Close() error {
+	err := p.r.Close()
+	if e := p.w.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Begin starts a read-write transaction on the writer.
+func (p *Pool) Begin() (*sql.Tx, error) {
+	return p.BeginTx(context.Background(), nil)
+}
+
+// BeginTx starts a transaction. Read only transactions use a reader, all
+// others the writer.
+func (p *Pool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if opts != nil && opts.ReadOnly {
+		return p.r.BeginTx(ctx, opts)
+	}
+
+	return p.w.BeginTx(ctx, opts)
+}
+
+// Exec executes a statement on the writer.
+func (p *Pool) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return p.w.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext executes a statement on the writer.
+func (p *Pool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.w.ExecContext(ctx, query, args...)
+}
+
+// Query executes a query on a reader.
+func (p *Pool) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return p.r.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext executes a query on a reader.
+func (p *Pool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.r.QueryContext(ctx, query, args...)
+}
+
+// QueryRow executes a query expected to return at most one row on a reader.
+func (p *Pool) QueryRow(query string, args ...interface{}) *sql.Row {
+	return p.r.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext executes a query expected to return at most one row on a
+// reader.
+func (p *Pool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.r.QueryRowContext(ctx, query, args...)
+}
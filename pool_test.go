@@ -0,0 +1,162 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func TestPool(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	p, err := OpenPool(fn, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer p.Close()
+
+	if _, err := p.Exec("create table t(i); insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var mode string
+	var n int
+	if err := p.QueryRow("select (select journal_mode from pragma_journal_mode), count(*) from t").Scan(&mode, &n); err != nil || mode != "wal" || n != 1 {
+		t.Fatalf("got %q %v %v, want wal 1", mode, n, err)
+	}
+
+	if g, e := p.Writer().Stats().MaxOpenConnections, 1; g != e {
+		t.Fatalf("writer connections %d, want %d", g, e)
+	}
+
+	if g, e := p.Reader().Stats().MaxOpenConnections, 2; g != e {
+		t.Fatalf("reader connections %d, want %d", g, e)
+	}
+
+	// Readers reject writes, also in read only transactions.
+	if _, err := p.Reader().Exec("insert into t values(2)"); err == nil || !strings.Contains(err.Error(), "readonly") {
+		t.Fatalf("got %v, want a read only error", err)
+	}
+
+	tx, err := p.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tx.Exec("insert into t values(2)"); err == nil || !strings.Contains(err.Error(), "read only transaction") {
+		t.Fatalf("got %v, want a read only error", err)
+	}
+
+	tx.Rollback()
+	if _, err := OpenPool(t.TempDir(), 1); err == nil {
+		t.Fatal("unexpected success opening a directory")
+	}
+}
+
+// TestPoolWriter checks write transactions of the pool run one at a time and
+// take the write lock when they begin.
+func TestPoolWriter(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	p, err := OpenPool(fn+"?_pragma=busy_timeout(0)", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer p.Close()
+
+	if _, err := p.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			tx, err := p.Begin()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			// A reader of the pool is not blocked by the transaction.
+			var m int
+			if err := p.QueryRow("select count(*) from t").Scan(&m); err != nil {
+				tx.Rollback()
+				errs <- err
+				return
+			}
+
+			if _, err := tx.Exec("insert into t values(?)", i); err != nil {
+				tx.Rollback()
+				errs <- err
+				return
+			}
+
+			time.Sleep(time.Millisecond)
+			errs <- tx.Commit()
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var m int
+	if err := p.QueryRow("select count(*) from t").Scan(&m); err != nil || m != n {
+		t.Fatalf("got %v %v, want %v", m, err, n)
+	}
+
+	// Another handle cannot write while a transaction of the writer is open,
+	// even before its first statement.
+	other, err := sql.Open(driverName, fn+"?_pragma=busy_timeout(0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer other.Close()
+
+	tx, err := p.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e *Error
+	if _, err := other.Exec("insert into t values(-1)"); !errors.As(err, &e) || e.Code() != sqlite3.SQLITE_BUSY {
+		t.Fatalf("got %v, want SQLITE_BUSY", err)
+	}
+
+	// A second write transaction of the pool waits for the writer.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+	defer cancel()
+
+	if _, err := p.BeginTx(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := other.Exec("insert into t values(-1)"); err != nil {
+		t.Fatal(err)
+	}
+}
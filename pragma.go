@@ -0,0 +1,268 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Pragma runs the PRAGMA statement name, see
+// https://www.sqlite.org/pragma.html, and returns the rows it produces. The
+// name may be qualified by a schema name, for example "temp.cache_size". If
+// arg is given, the pragma is invoked with it as its only argument. The
+// argument may be an integer, float, bool or string value. The values of the
+// result are int64, float64, string, []byte or nil, as stored by SQLite.
+// Unlike SQLite, which ignores unknown pragmas, Pragma reports them as an
+// error.
+//
+// Pragma and the typed helpers below can be reached using (*sql.Conn).Raw.
+func (c *conn) Pragma(name string, arg ...interface{}) (r [][]interface{}, err error) {
+	return c.pragma(context.Background(), name, arg...)
+}
+
+func (c *conn) pragma(ctx context.Context, name string, arg ...interface{}) (r [][]interface{}, err error) {
+	q, err := pragmaSQL(name, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	known, err := c.knownPragma(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !known {
+		return nil, fmt.Errorf("sqlite: Pragma %s: unknown pragma", name)
+	}
+
+	rs, err := c.internalQuery(ctx, q, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if e := rs.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	dest := make([]driver.Value, len(rs.Columns()))
+	for {
+		if err := rs.Next(dest); err != nil {
+			if err == io.EOF {
+				return r, nil
+			}
+
+			return r, err
+		}
+
+		row := make([]interface{}, len(dest))
+		for i, v := range dest {
+			row[i] = v
+		}
+		r = append(r, row)
+	}
+}
+
+// knownPragma reports whether SQLite knows the pragma name, which may be
+// qualified by a schema name.
+func (c *conn) knownPragma(ctx context.Context, name string) (r bool, err error) {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+
+	rs, err := c.internalQuery(ctx, "select 1 from pragma_pragma_list where name = lower(?)", []driver.NamedValue{{Ordinal: 1, Value: name}})
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if e := rs.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	switch err := rs.Next(make([]driver.Value, 1)); err {
+	case nil:
+		return true, nil
+	case io.EOF:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func pragmaSQL(name string, arg []interface{}) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("sqlite: Pragma: empty name")
+	}
+
+	var b strings.Builder
+	b.WriteString("pragma ")
+	for i, v := range strings.SplitN(name, ".", 2) {
+		if i != 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(quoteIdentifier(v))
+	}
+	switch len(arg) {
+	case 0:
+		return b.String(), nil
+	case 1:
+		// ok
+	default:
+		return "", fmt.Errorf("sqlite: Pragma %s: too many arguments", name)
+	}
+
+	var s string
+	switch x := arg[0].(type) {
+	case int:
+		s = strconv.FormatInt(int64(x), 10)
+	case int8:
+		s = strconv.FormatInt(int64(x), 10)
+	case int16:
+		s = strconv.FormatInt(int64(x), 10)
+	case int32:
+		s = strconv.FormatInt(int64(x), 10)
+	case int64:
+		s = strconv.FormatInt(x, 10)
+	case uint:
+		s = strconv.FormatUint(uint64(x), 10)
+	case uint8:
+		s = strconv.FormatUint(uint64(x), 10)
+	case uint16:
+		s = strconv.FormatUint(uint64(x), 10)
+	case uint32:
+		s = strconv.FormatUint(uint64(x), 10)
+	case uint64:
+		s = strconv.FormatUint(x, 10)
+	case float32:
+		s = strconv.FormatFloat(float64(x), 'g', -1, 32)
+	case float64:
+		s = strconv.FormatFloat(x, 'g', -1, 64)
+	case bool:
+		s = "0"
+		if x {
+			s = "1"
+		}
+	case string:
+		s = "'" + strings.ReplaceAll(x, "'", "''") + "'"
+	default:
+		return "", fmt.Errorf("sqlite: Pragma %s: unsupported argument type %T", name, x)
+	}
+	return b.String() + "(" + s + ")", nil
+}
+
+// pragmaValue returns the single value produced by the pragma.
+func (c *conn) pragmaValue(name string, arg ...interface{}) (interface{}, error) {
+	r, err := c.Pragma(name, arg...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r) == 0 || len(r[0]) == 0 {
+		return nil, nil
+	}
+
+	return r[0][0], nil
+}
+
+func (c *conn) pragmaInt64(name string, arg ...interface{}) (int64, error) {
+	v, err := c.pragmaValue(name, arg...)
+	if err != nil {
+		return 0, err
+	}
+
+	switch x := v.(type) {
+	case int64:
+		return x, nil
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("sqlite: Pragma %s: unexpected result type %T", name, v)
+	}
+}
+
+func (c *conn) pragmaString(name string, arg ...interface{}) (string, error) {
+	v, err := c.pragmaValue(name, arg...)
+	if err != nil {
+		return "", err
+	}
+
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("sqlite: Pragma %s: unexpected result type %T", name, v)
+	}
+}
+
+// JournalMode returns the journal mode of the main database.
+func (c *conn) JournalMode() (string, error) {
+	return c.pragmaString("journal_mode")
+}
+
+// SetJournalMode changes the journal mode of the main database and returns
+// the new mode, which is the old one if the change was not possible.
+func (c *conn) SetJournalMode(mode string) (string, error) {
+	return c.pragmaString("journal_mode", mode)
+}
+
+// UserVersion returns the user version of the main database.
+func (c *conn) UserVersion() (int64, error) {
+	return c.pragmaInt64("user_version")
+}
+
+// SetUserVersion sets the user version of the main database, a 32 bit
+// integer.
+func (c *conn) SetUserVersion(v int32) error {
+	_, err := c.Pragma("user_version", v)
+	return err
+}
+
+// ApplicationID returns the application ID of the main database.
+func (c *conn) ApplicationID() (int64, error) {
+	return c.pragmaInt64("application_id")
+}
+
+// SetApplicationID sets the application ID of the main database, a 32 bit
+// integer.
+func (c *conn) SetApplicationID(id int32) error {
+	_, err := c.Pragma("application_id", id)
+	return err
+}
+
+// CacheSize returns the suggested maximum number of pages of the page cache,
+// or, if negative, the suggested limit in KiB.
+func (c *conn) CacheSize() (int64, error) {
+	return c.pragmaInt64("cache_size")
+}
+
+// SetCacheSize sets the suggested size of the page cache, see CacheSize.
+func (c *conn) SetCacheSize(n int64) error {
+	_, err := c.Pragma("cache_size", n)
+	return err
+}
+
+// CacheSpill returns the number of dirty pages of the page cache above which
+// they may be written to the database file before the end of a transaction,
+// at least the size of the cache in pages, or zero if spilling is disabled.
+func (c *conn) CacheSpill() (int64, error) {
+	return c.pragmaInt64("cache_spill")
+}
+
+// SetCacheSpill sets the cache spill threshold, see CacheSpill. Zero disables
+// spilling, which keeps dirty pages in memory until the transaction commits.
+func (c *conn) SetCacheSpill(n int64) error {
+	_, err := c.Pragma("cache_spill", n)
+	return err
+}
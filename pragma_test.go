@@ -0,0 +1,191 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPragma checks Pragma and its typed helpers round trip their values.
+func TestPragma(t *testing.T) {
+	db := openMemory(t)
+	defer db.Close()
+
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if err := c.Raw(func(dc interface{}) error {
+		cn := dc.(*conn)
+		for _, v := range []struct {
+			name string
+			arg  []interface{}
+			want string
+		}{
+			{"user_version", []interface{}{42}, "[]"},
+			{"user_version", nil, "[[42]]"},
+			{"main.user_version", nil, "[[42]]"},
+			{"temp.cache_size", []interface{}{int64(-100)}, "[]"},
+			{"temp.cache_size", nil, "[[-100]]"},
+			{"encoding", nil, "[[UTF-8]]"},
+		} {
+			r, err := cn.Pragma(v.name, v.arg...)
+			if g := fmt.Sprint(r); err != nil || g != v.want {
+				t.Errorf("Pragma(%q, %v): got %v %v, want %v", v.name, v.arg, g, err, v.want)
+			}
+		}
+
+		if err := cn.SetUserVersion(-7); err != nil {
+			t.Fatal(err)
+		}
+
+		if v, err := cn.UserVersion(); err != nil || v != -7 {
+			t.Errorf("UserVersion: got %v %v, want -7", v, err)
+		}
+
+		if err := cn.SetApplicationID(0x1234abcd); err != nil {
+			t.Fatal(err)
+		}
+
+		if v, err := cn.ApplicationID(); err != nil || v != 0x1234abcd {
+			t.Errorf("ApplicationID: got %#x %v, want 0x1234abcd", v, err)
+		}
+
+		if err := cn.SetCacheSize(-4096); err != nil {
+			t.Fatal(err)
+		}
+
+		if v, err := cn.CacheSize(); err != nil || v != -4096 {
+			t.Errorf("CacheSize: got %v %v, want -4096", v, err)
+		}
+
+		if err := cn.SetCacheSize(100); err != nil {
+			t.Fatal(err)
+		}
+
+		// The threshold read back is at least the size of the cache in
+		// pages.
+		for _, v := range []struct{ set, want int64 }{{0, 0}, {1000, 1000}, {10, 100}} {
+			if err := cn.SetCacheSpill(v.set); err != nil {
+				t.Fatal(err)
+			}
+
+			if g, err := cn.CacheSpill(); err != nil || g != v.want {
+				t.Errorf("CacheSpill %v: got %v %v, want %v", v.set, g, err, v.want)
+			}
+		}
+
+		if m, err := cn.JournalMode(); err != nil || m != "memory" {
+			t.Errorf("JournalMode: got %q %v, want memory", m, err)
+		}
+
+		// An in-memory database cannot use WAL.
+		if m, err := cn.SetJournalMode("wal"); err != nil || m != "memory" {
+			t.Errorf("SetJournalMode: got %q %v, want memory", m, err)
+		}
+
+		if m, err := cn.SetJournalMode("off"); err != nil || m != "off" {
+			t.Errorf("SetJournalMode: got %q %v, want off", m, err)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPragmaJournalMode checks SetJournalMode switches a database file to and
+// from WAL.
+func TestPragmaJournalMode(t *testing.T) {
+	db, err := sql.Open(driverName, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if err := c.Raw(func(dc interface{}) error {
+		cn := dc.(*conn)
+		for _, v := range []string{"delete", "WAL", "truncate", "wal"} {
+			m, err := cn.SetJournalMode(v)
+			if err != nil || m != strings.ToLower(v) {
+				t.Errorf("SetJournalMode(%q): got %q %v", v, m, err)
+			}
+
+			if m, err := cn.JournalMode(); err != nil || m != strings.ToLower(v) {
+				t.Errorf("JournalMode after %q: got %q %v", v, m, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPragmaError checks Pragma rejects unknown pragmas, which SQLite
+// ignores, and arguments it cannot pass.
+func TestPragmaError(t *testing.T) {
+	db := openMemory(t)
+	defer db.Close()
+
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if err := c.Raw(func(dc interface{}) error {
+		cn := dc.(*conn)
+		for _, v := range []struct {
+			name string
+			arg  []interface{}
+			want string
+		}{
+			{"no_such_pragma", nil, "unknown pragma"},
+			{"main.no_such_pragma", []interface{}{1}, "unknown pragma"},
+			{"", nil, "empty name"},
+			{"user_version", []interface{}{1, 2}, "too many arguments"},
+			{"user_version", []interface{}{[]byte{1}}, "unsupported argument type []uint8"},
+			{"nosuchschema.user_version", nil, `unknown database "nosuchschema"`},
+			{"journal_mode", []interface{}{"'); drop table t; --"}, ""},
+		} {
+			_, err := cn.Pragma(v.name, v.arg...)
+			switch {
+			case v.want == "" && err != nil:
+				t.Errorf("Pragma(%q, %v): %v", v.name, v.arg, err)
+			case v.want != "" && (err == nil || !strings.Contains(err.Error(), v.want)):
+				t.Errorf("Pragma(%q, %v): got %v, want %q", v.name, v.arg, err, v.want)
+			}
+		}
+
+		if _, err := cn.UserVersion(); err != nil {
+			t.Error(err)
+		}
+
+		if _, err := cn.pragmaInt64("encoding"); err == nil || !strings.Contains(err.Error(), "unexpected result type string") {
+			t.Errorf("got %v, want unexpected result type", err)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
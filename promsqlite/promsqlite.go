@@ -0,0 +1,80 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package promsqlite exports the process wide statistics of modernc.org/sqlite
+// as Prometheus metrics.
+//
+//	prometheus.MustRegister(promsqlite.NewCollector())
+//
+// The collector reads sqlite.ReadDriverStats when it is scraped and exports
+//
+//	sqlite_open_connections         gauge, connections open
+//	sqlite_busy_retries_total       counter, retries of the _lock_wait busy handler
+//	sqlite_auto_checkpoints_total   counter, automatic WAL checkpoints
+//	sqlite_page_cache_hits_total    counter, page cache hits
+//	sqlite_page_cache_misses_total  counter, page cache misses
+//	sqlite_memory_used_bytes        gauge, memory allocated by SQLite
+//	sqlite_memory_highwater_bytes   gauge, maximum of sqlite_memory_used_bytes
+//
+// The page cache hit rate is then, for example,
+//
+//	rate(sqlite_page_cache_hits_total[5m]) / (rate(sqlite_page_cache_hits_total[5m]) + rate(sqlite_page_cache_misses_total[5m]))
+//
+// The package does not cache prepared statements, so there is no statement
+// cache metric. The connection pool of database/sql has its own statistics,
+// see sql.DB.Stats.
+package promsqlite // import "modernc.org/sqlite/promsqlite"
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"modernc.org/sqlite"
+)
+
+type metric struct {
+	desc  *prometheus.Desc
+	kind  prometheus.ValueType
+	value func(*sqlite.DriverStats) int64
+}
+
+type collector struct {
+	metrics []metric
+}
+
+// NewCollector returns a collector of the statistics of modernc.org/sqlite.
+func NewCollector() prometheus.Collector {
+	m := func(name, help string, kind prometheus.ValueType, value func(*sqlite.DriverStats) int64) metric {
+		return metric{prometheus.NewDesc(name, help, nil, nil), kind, value}
+	}
+	return &collector{[]metric{
+		m("sqlite_open_connections", "Number of open connections.", prometheus.GaugeValue,
+			func(s *sqlite.DriverStats) int64 { return s.OpenConns }),
+		m("sqlite_busy_retries_total", "Number of retries of the _lock_wait busy handler.", prometheus.CounterValue,
+			func(s *sqlite.DriverStats) int64 { return s.BusyRetries }),
+		m("sqlite_auto_checkpoints_total", "Number of automatic WAL checkpoints.", prometheus.CounterValue,
+			func(s *sqlite.DriverStats) int64 { return s.AutoCheckpoints }),
+		m("sqlite_page_cache_hits_total", "Number of page cache hits.", prometheus.CounterValue,
+			func(s *sqlite.DriverStats) int64 { return s.CacheHits }),
+		m("sqlite_page_cache_misses_total", "Number of page cache misses.", prometheus.CounterValue,
+			func(s *sqlite.DriverStats) int64 { return s.CacheMisses }),
+		m("sqlite_memory_used_bytes", "Bytes of memory allocated by SQLite.", prometheus.GaugeValue,
+			func(s *sqlite.DriverStats) int64 { return s.MemoryUsed }),
+		m("sqlite_memory_highwater_bytes", "Maximum of sqlite_memory_used_bytes.", prometheus.GaugeValue,
+			func(s *sqlite.DriverStats) int64 { return s.MemoryHighwater }),
+	}}
+}
+
+// Describe implements prometheus.Collector.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, v := range c.metrics {
+		ch <- v.desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	s := sqlite.ReadDriverStats()
+	for _, v := range c.metrics {
+		ch <- prometheus.MustNewConstMetric(v.desc, v.kind, float64(v.value(&s)))
+	}
+}
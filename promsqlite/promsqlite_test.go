@@ -0,0 +1,57 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promsqlite // import "modernc.org/sqlite/promsqlite"
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	_ "modernc.org/sqlite"
+)
+
+func TestCollector(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCollector()
+	if n := testutil.CollectAndCount(c); n != 7 {
+		t.Errorf("%d metrics, want 7", n)
+	}
+
+	if problems, err := testutil.CollectAndLint(c); err != nil || len(problems) != 0 {
+		t.Errorf("lint: %v %v", problems, err)
+	}
+
+	r := prometheus.NewPedanticRegistry()
+	r.MustRegister(c)
+	families, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]float64{}
+	for _, f := range families {
+		m := f.GetMetric()[0]
+		switch {
+		case m.Gauge != nil:
+			values[f.GetName()] = m.Gauge.GetValue()
+		case m.Counter != nil:
+			values[f.GetName()] = m.Counter.GetValue()
+		}
+	}
+	if values["sqlite_open_connections"] < 1 || values["sqlite_memory_used_bytes"] <= 0 {
+		t.Errorf("got %v", values)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var (
+	// ErrMaxRows is returned by Rows.Next for a result set having more rows
+	// than allowed, see SetQueryLimits.
+	ErrMaxRows = errors.New("sqlite: the query returns more rows than allowed")
+
+	// ErrMaxDuration is returned by a query running longer than allowed,
+	// see SetQueryLimits.
+	ErrMaxDuration = errors.New("sqlite: the query runs longer than allowed")
+)
+
+// progressOps is the number of virtual machine instructions between the
+// invocations of the progress handler checking the duration of a query.
+const progressOps = 1000
+
+var (
+	queryLimitsMu sync.Mutex
+	queryLimits   = map[uintptr]*queryLimit{}
+	queryLimitID  uintptr
+)
+
+// queryLimit holds the limits of the queries of a connection, see
+// SetQueryLimits.
+type queryLimit struct {
+	maxRows     int64
+	maxDuration time.Duration
+
+	deadline time.Time // Of the running query, zero if none.
+	exceeded bool      // The progress handler interrupted the query.
+}
+
+// SetQueryLimits limits the queries executed by the connection, protecting
+// services executing semi-trusted SQL. The iteration of a result set having
+// more than maxRows rows fails with ErrMaxRows. A query whose statements are
+// still running maxDuration after it started is interrupted and fails with
+// ErrMaxDuration. The duration includes the time spent between the calls of
+// Rows.Next. Zero disables a limit. The limits apply to the queries started
+// after SetQueryLimits, the _max_rows and _max_duration query parameters set
+// them for every connection of a DSN.
+//
+// The duration is checked by a progress handler, see
+// https://www.sqlite.org/c3ref/progress_handler.html, which is invoked every
+// few thousand virtual machine instructions, so a statement blocked in a
+// single operation, like waiting for a lock, is not interrupted before it
+// proceeds. Use a context with a deadline to bound those.
+//
+// SetQueryLimits can be reached using (*sql.Conn).Raw.
+func (c *conn) SetQueryLimits(maxRows int64, maxDuration time.Duration) error {
+	if maxRows < 0 || maxDuration < 0 {
+		return fmt.Errorf("sqlite: SetQueryLimits: negative limit")
+	}
+
+	if c.queryLimit == 0 {
+		if maxDuration == 0 && maxRows == 0 {
+			return nil
+		}
+
+		queryLimitsMu.Lock()
+		queryLimitID++
+		id := queryLimitID
+		queryLimits[id] = &queryLimit{}
+		queryLimitsMu.Unlock()
+		c.queryLimit = id
+	}
+
+	l := queryLimitOf(c.queryLimit)
+	l.maxRows, l.maxDuration = maxRows, maxDuration
+
+	// void sqlite3_progress_handler(sqlite3*, int, int(*)(void*), void*);
+	if maxDuration == 0 {
+		sqlite3.Xsqlite3_progress_handler(c.tls, c.db, 0, 0, 0)
+		return nil
+	}
+
+	sqlite3.Xsqlite3_progress_handler(c.tls, c.db, progressOps, *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr) int32
+	}{xProgress})), c.queryLimit)
+	return nil
+}
+
+// setMaxRows handles the _max_rows query parameter.
+func (c *conn) setMaxRows(v string) error {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid _max_rows %q", v)
+	}
+
+	var d time.Duration
+	if l := queryLimitOf(c.queryLimit); l != nil {
+		d = l.maxDuration
+	}
+	return c.SetQueryLimits(n, d)
+}
+
+// setMaxDuration handles the _max_duration query parameter.
+func (c *conn) setMaxDuration(v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid _max_duration %q", v)
+	}
+
+	var n int64
+	if l := queryLimitOf(c.queryLimit); l != nil {
+		n = l.maxRows
+	}
+	return c.SetQueryLimits(n, d)
+}
+
+func queryLimitOf(id uintptr) *queryLimit {
+	if id == 0 {
+		return nil
+	}
+
+	queryLimitsMu.Lock()
+
+	defer queryLimitsMu.Unlock()
+
+	return queryLimits[id]
+}
+
+func (c *conn) unregisterQueryLimit() {
+	if c.queryLimit == 0 {
+		return
+	}
+
+	queryLimitsMu.Lock()
+	delete(queryLimits, c.queryLimit)
+	queryLimitsMu.Unlock()
+	c.queryLimit = 0
+}
+
+// startQuery starts the duration of a query. It returns the function ending
+// it, or nil if the duration is not limited or a query is running already,
+// like when a statement of the driver runs while the rows of a query are
+// iterated.
+func (c *conn) startQuery() func() {
+	l := queryLimitOf(c.queryLimit)
+	if l == nil || l.maxDuration == 0 || !l.deadline.IsZero() {
+		return nil
+	}
+
+	l.deadline = time.Now().Add(l.maxDuration)
+	l.exceeded = false
+	return func() { l.deadline = time.Time{} }
+}
+
+// maxRows returns the maximum number of rows of a result set, or zero if not
+// limited.
+func (c *conn) maxRows() int64 {
+	if l := queryLimitOf(c.queryLimit); l != nil {
+		return l.maxRows
+	}
+
+	return 0
+}
+
+// queryLimitError returns ErrMaxDuration instead of err if the progress
+// handler interrupted the statement failing with err.
+func (c *conn) queryLimitError(err error) error {
+	var e *Error
+	if err == nil || !errors.As(err, &e) || e.code&0xff != sqlite3.SQLITE_INTERRUPT {
+		return err
+	}
+
+	if l := queryLimitOf(c.queryLimit); l != nil && l.exceeded {
+		return ErrMaxDuration
+	}
+
+	return err
+}
+
+// int (*)(void*);
+func xProgress(tls *libc.TLS, pArg uintptr) int32 {
+	l := queryLimitOf(pArg)
+	if l == nil || l.deadline.IsZero() || time.Now().Before(l.deadline) {
+		return 0
+	}
+
+	l.exceeded = true
+	return 1
+}
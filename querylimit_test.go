@@ -0,0 +1,103 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+const endless = "with recursive c(x) as (select 1 union all select x+1 from c) select count(*) from c"
+
+func TestQueryLimits(t *testing.T) {
+	db, err := sql.Open(driverName, "file::memory:?_max_rows=5&_max_duration=100ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	count := func(n int) (int, error) {
+		rows, err := db.Query("with recursive c(x) as (select 1 union all select x+1 from c limit ?) select x from c", n)
+		if err != nil {
+			return 0, err
+		}
+
+		defer rows.Close()
+
+		got := 0
+		for rows.Next() {
+			got++
+		}
+		return got, rows.Err()
+	}
+	if n, err := count(5); n != 5 || err != nil {
+		t.Fatal(n, err)
+	}
+
+	if n, err := count(6); n != 5 || err != ErrMaxRows {
+		t.Fatalf("got %d, %v, want 5, %v", n, err, ErrMaxRows)
+	}
+
+	t0 := time.Now()
+	if err := db.QueryRow(endless).Scan(new(int)); err != ErrMaxDuration {
+		t.Fatalf("got %v, want %v", err, ErrMaxDuration)
+	}
+
+	if d := time.Since(t0); d > 5*time.Second {
+		t.Fatalf("the query ran for %v", d)
+	}
+
+	if _, err := db.Exec(endless); err != ErrMaxDuration {
+		t.Fatalf("got %v, want %v", err, ErrMaxDuration)
+	}
+
+	// The limits can be changed per connection.
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if err := c.Raw(func(dc interface{}) error { return dc.(*conn).SetQueryLimits(0, 0) }); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := c.QueryRowContext(ctx, "with recursive c(x) as (select 1 union all select x+1 from c limit 100000) select count(*) from c").Scan(&n); err != nil || n != 100000 {
+		t.Fatal(n, err)
+	}
+
+	rows, err := c.QueryContext(ctx, "select 1 union all select 2 union all select 3 union all select 4 union all select 5 union all select 6")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n = 0
+	for rows.Next() {
+		n++
+	}
+	if err := rows.Err(); err != nil || n != 6 {
+		t.Fatal(n, err)
+	}
+
+	rows.Close()
+	for _, v := range []string{"_max_rows=-1", "_max_duration=x"} {
+		db, err := sql.Open(driverName, "file::memory:?"+v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Ping(); err == nil {
+			t.Errorf("%s: unexpected success", v)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// QuotaEvent reports a database approaching or reaching its quota, see the
+// _quota query parameter and SetQuotaHandler.
+type QuotaEvent struct {
+	Filename string // Of the main database.
+	Size     int64  // Of the main database in bytes.
+	Quota    int64  // The maximum size in bytes.
+	Full     bool   // A write failed with SQLITE_FULL.
+}
+
+type quotaFunc struct {
+	f func(QuotaEvent)
+}
+
+var quotaHandler atomic.Value // quotaFunc
+
+// SetQuotaHandler installs f as the receiver of the QuotaEvents of the
+// connections opened with the _quota query parameter. Passing nil removes
+// the handler.
+//
+// f is invoked when the size of a database reaches the warning threshold of
+// the _quota_warn query parameter, once until the size drops below the
+// threshold again, and whenever a write fails because the database is full.
+// Every connection reports the events it observes. f is invoked by the
+// goroutine using the connection, after the statement or transaction
+// changing the database ended, and must not use that connection. f may be
+// invoked concurrently for different connections.
+func SetQuotaHandler(f func(QuotaEvent)) {
+	quotaHandler.Store(quotaFunc{f})
+}
+
+// quota is the quota of the main database of a connection, see setQuota.
+type quota struct {
+	max      int64   // In bytes.
+	warn     float64 // Fraction of max.
+	pageSize int64
+	changes  int64 // TotalChanges at the last check.
+	warned   bool  // The warning threshold was reported.
+	full     bool  // SQLITE_FULL was returned since the last check.
+}
+
+// setQuota handles the _quota and _quota_warn query parameters. The maximum
+// number of pages of the main database is set to the number of whole pages
+// fitting in v bytes.
+func (c *conn) setQuota(v, warn string) error {
+	max, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || max <= 0 {
+		return fmt.Errorf("invalid _quota %q", v)
+	}
+
+	q := &quota{max: max, warn: 0.9}
+	if warn != "" {
+		if q.warn, err = strconv.ParseFloat(warn, 64); err != nil || q.warn <= 0 || q.warn > 1 {
+			return fmt.Errorf("invalid _quota_warn %q", warn)
+		}
+	}
+
+	if q.pageSize, err = c.pragmaInt64("page_size"); err != nil {
+		return err
+	}
+
+	pages := max / q.pageSize
+	if pages == 0 {
+		return fmt.Errorf("invalid _quota %q: less than the page size %d", v, q.pageSize)
+	}
+
+	if _, err := c.Pragma("max_page_count", pages); err != nil {
+		return err
+	}
+
+	q.changes = c.TotalChanges()
+	c.quota = q
+	return nil
+}
+
+// checkQuota reports the QuotaEvents of the main database of c, see
+// SetQuotaHandler. It checks the size of the database only if c changed
+// rows, or a write failed with SQLITE_FULL, since the last check.
+func (c *conn) checkQuota() {
+	q := c.quota
+	if q == nil || c.db == 0 || !c.autocommit() {
+		return
+	}
+
+	n := c.TotalChanges()
+	if n == q.changes && !q.full {
+		return
+	}
+
+	// Reading the page count invokes checkQuota again, which then returns
+	// above.
+	q.changes = n
+	full := q.full
+	q.full = false
+	pages, err := c.pragmaInt64("page_count")
+	if err != nil {
+		return
+	}
+
+	e := QuotaEvent{Size: pages * q.pageSize, Quota: q.max, Full: full}
+	switch {
+	case full:
+		// Report.
+	case float64(e.Size) >= q.warn*float64(q.max):
+		if q.warned {
+			return
+		}
+
+		q.warned = true
+	default:
+		q.warned = false
+		return
+	}
+
+	if v, ok := quotaHandler.Load().(quotaFunc); ok && v.f != nil {
+		e.Filename = libc.GoString(sqlite3.Xsqlite3_db_filename(c.tls, c.db, 0))
+		v.f(e)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func TestQuota(t *testing.T) {
+	var mu sync.Mutex
+	var events []QuotaEvent
+	SetQuotaHandler(func(e QuotaEvent) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})
+
+	defer SetQuotaHandler(nil)
+
+	fn := filepath.Join(t.TempDir(), "test.db")
+	const quota = 100 * 4096
+	db, err := sql.Open(driverName, fn+"?_pragma=page_size(4096)&_quota=409600&_quota_warn=0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("create table t(b blob)"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; ; i++ {
+		_, err := db.Exec("insert into t values(randomblob(10000))")
+		if err == nil {
+			if i > 100 {
+				t.Fatal("the quota is not enforced")
+			}
+
+			continue
+		}
+
+		var e *Error
+		if !errors.As(err, &e) || e.Code()&0xff != sqlite3.SQLITE_FULL {
+			t.Fatal(err)
+		}
+
+		break
+	}
+
+	mu.Lock()
+
+	defer mu.Unlock()
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+
+	if e := events[0]; e.Full || e.Size < quota/2 || e.Size > quota || e.Quota != quota || e.Filename != fn {
+		t.Errorf("unexpected warning %+v", e)
+	}
+
+	if e := events[1]; !e.Full || e.Size > quota || e.Quota != quota {
+		t.Errorf("unexpected full event %+v", e)
+	}
+
+	for _, v := range []string{"_quota=x", "_quota=0", "_quota=100", "_quota=409600&_quota_warn=2"} {
+		db, err := sql.Open(driverName, fn+"?"+v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.Ping(); err == nil {
+			t.Errorf("%s: unexpected success", v)
+		}
+		db.Close()
+	}
+}
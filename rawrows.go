@@ -0,0 +1,108 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Step advances the rows to the next row without converting its values, for
+// use with RawText, RawBlob and the other accessors of the current row. It
+// reports false at the end of the result set. Step and Next must not be mixed
+// while iterating the same result set.
+//
+// Step and the accessors of the current row are available on the driver.Rows
+// returned by the Query method of the driver connection, reachable using
+// (*sql.Conn).Raw, for loops where the allocations made by database/sql for
+// every row matter:
+//
+//	err := conn.Raw(func(dc interface{}) error {
+//		rs, err := dc.(driver.Queryer).Query("select name from t", nil)
+//		if err != nil {
+//			return err
+//		}
+//
+//		defer rs.Close()
+//
+//		r := rs.(interface {
+//			Step() (bool, error)
+//			RawText(int) []byte
+//		})
+//		for {
+//			ok, err := r.Step()
+//			if !ok || err != nil {
+//				return err
+//			}
+//
+//			process(r.RawText(0))
+//		}
+//	})
+func (r *rows) Step() (bool, error) {
+	if r.empty {
+		return false, nil
+	}
+
+	rc := sqlite3.SQLITE_ROW
+	if r.doStep {
+		var err error
+		if rc, err = r.c.step(r.pstmt); err != nil {
+			return false, err
+		}
+	}
+
+	r.doStep = true
+	switch rc {
+	case sqlite3.SQLITE_ROW:
+		return true, nil
+	case sqlite3.SQLITE_DONE:
+		r.empty = true
+		return false, nil
+	default:
+		return false, r.c.errstr(int32(rc))
+	}
+}
+
+// RawText returns the value of column i of the current row as UTF-8 text,
+// without copying it. The result is valid only until the next call of Step,
+// RawBlob or Close, and must not be modified.
+func (r *rows) RawText(i int) []byte {
+	p := sqlite3.Xsqlite3_column_text(r.c.tls, r.pstmt, int32(i))
+	return r.raw(p, i)
+}
+
+// RawBlob returns the value of column i of the current row as a blob, without
+// copying it. The result is valid only until the next call of Step, RawText
+// or Close, and must not be modified.
+func (r *rows) RawBlob(i int) []byte {
+	p := sqlite3.Xsqlite3_column_blob(r.c.tls, r.pstmt, int32(i))
+	return r.raw(p, i)
+}
+
+func (r *rows) raw(p uintptr, i int) []byte {
+	n := sqlite3.Xsqlite3_column_bytes(r.c.tls, r.pstmt, int32(i))
+	if p == 0 || n == 0 {
+		return nil
+	}
+
+	return (*libc.RawMem)(unsafe.Pointer(p))[:n:n]
+}
+
+// Int64 returns the value of column i of the current row as an integer.
+func (r *rows) Int64(i int) int64 {
+	return sqlite3.Xsqlite3_column_int64(r.c.tls, r.pstmt, int32(i))
+}
+
+// Float64 returns the value of column i of the current row as a float.
+func (r *rows) Float64(i int) float64 {
+	return sqlite3.Xsqlite3_column_double(r.c.tls, r.pstmt, int32(i))
+}
+
+// IsNull reports whether column i of the current row is NULL.
+func (r *rows) IsNull(i int) bool {
+	return sqlite3.Xsqlite3_column_type(r.c.tls, r.pstmt, int32(i)) == sqlite3.SQLITE_NULL
+}
@@ -0,0 +1,171 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+)
+
+type rawRows interface {
+	driver.Rows
+	Step() (bool, error)
+	RawText(int) []byte
+	RawBlob(int) []byte
+	Int64(int) int64
+	Float64(int) float64
+	IsNull(int) bool
+}
+
+// rawQuery runs query on a connection of db and passes its rows to f.
+func rawQuery(db *sql.DB, query string, f func(rawRows) error) error {
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+
+	defer c.Close()
+
+	return c.Raw(func(dc interface{}) error {
+		rs, err := dc.(driver.Queryer).Query(query, nil)
+		if err != nil {
+			return err
+		}
+
+		defer rs.Close()
+
+		return f(rs.(rawRows))
+	})
+}
+
+func TestRawRows(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+create table t(i, f, s, b);
+insert into t values(1, 1.5, 'a', x'0102'), (2, null, '', x'');
+create table e(i);
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	if err := rawQuery(db, "select i, f, s, b from t order by i", func(r rawRows) error {
+		for {
+			ok, err := r.Step()
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				break
+			}
+
+			got = append(got, fmt.Sprintf("%d %v %v %q %x", r.Int64(0), r.Float64(1), r.IsNull(1), r.RawText(2), r.RawBlob(3)))
+		}
+
+		// The end of the result set is sticky.
+		if ok, err := r.Step(); ok || err != nil {
+			return fmt.Errorf("Step after the end: %v, %v", ok, err)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprint(got), `[1 1.5 false "a" 0102 2 0 true "" ]`; g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+
+	if err := rawQuery(db, "select i from e", func(r rawRows) error {
+		if ok, err := r.Step(); ok || err != nil {
+			return fmt.Errorf("empty result: %v, %v", ok, err)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func benchmarkRowsDB(b *testing.B) *sql.DB {
+	db, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`
+create table t(s, b);
+with recursive n(i) as (select 1 union all select i+1 from n where i < 1000)
+insert into t select printf('name %d', i), randomblob(100) from n;
+`); err != nil {
+		db.Close()
+		b.Fatal(err)
+	}
+
+	return db
+}
+
+func BenchmarkRowsScan(b *testing.B) {
+	db := benchmarkRowsDB(b)
+
+	defer db.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows, err := db.Query("select s, b from t")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		var n int
+		for rows.Next() {
+			var s string
+			var blob []byte
+			if err := rows.Scan(&s, &blob); err != nil {
+				b.Fatal(err)
+			}
+
+			n += len(s) + len(blob)
+		}
+		if err := rows.Err(); err != nil {
+			b.Fatal(err)
+		}
+
+		rows.Close()
+	}
+}
+
+func BenchmarkRowsRaw(b *testing.B) {
+	db := benchmarkRowsDB(b)
+
+	defer db.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := rawQuery(db, "select s, b from t", func(r rawRows) error {
+			var n int
+			for {
+				ok, err := r.Step()
+				if !ok || err != nil {
+					return err
+				}
+
+				n += len(r.RawText(0)) + len(r.RawBlob(1))
+			}
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
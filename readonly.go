@@ -0,0 +1,85 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// needsImmutable reports whether c is a read only connection to a WAL
+// database that cannot be read because its -shm file cannot be created, like
+// on a read only file system, and that has no -wal file. Such a database
+// cannot change as long as no -wal file exists, it can be read safely when
+// opened with immutable=1. Only such a database is probed by reading its
+// schema, other read only opens cost no extra query.
+func (c *conn) needsImmutable() bool {
+	if !c.readOnly {
+		return false
+	}
+
+	zFilename := sqlite3.Xsqlite3_db_filename(c.tls, c.db, 0)
+	filename := libc.GoString(zFilename)
+	if filename == "" {
+		return false
+	}
+
+	zImmutable, err := libc.CString("immutable")
+	if err != nil {
+		return false
+	}
+
+	defer libc.Xfree(c.tls, zImmutable)
+
+	// int sqlite3_uri_boolean(const char *z, const char *zParam, int bDefault);
+	if sqlite3.Xsqlite3_uri_boolean(c.tls, zFilename, zImmutable, 0) != 0 {
+		return false
+	}
+
+	if !isWALFile(filename) {
+		return false
+	}
+
+	if _, err := os.Stat(filename + "-wal"); !os.IsNotExist(err) {
+		return false
+	}
+
+	_, err = c.exec(context.Background(), "select 1 from sqlite_master limit 1", nil)
+	// Creating the -wal or -shm file fails with SQLITE_CANTOPEN, or with
+	// SQLITE_READONLY_DIRECTORY in a read only directory.
+	if e, ok := err.(*Error); !ok || e.Code()&0xff != sqlite3.SQLITE_CANTOPEN && e.Code() != sqlite3.SQLITE_READONLY_DIRECTORY {
+		return false
+	}
+
+	logf(sqlite3.SQLITE_NOTICE, "sqlite: cannot create the -shm file of %s, reading it as immutable", filename)
+	return true
+}
+
+// isWALFile reports whether the header of the database file name marks it as
+// a database in WAL mode.
+func isWALFile(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+
+	defer f.Close()
+
+	var b [20]byte
+	if _, err := io.ReadFull(f, b[:]); err != nil {
+		return false
+	}
+
+	// File format write and read versions, 2 for WAL.
+	return string(b[:16]) == "SQLite format 3\x00" && b[18] == 2 && b[19] == 2
+}
+
+// withImmutable returns the database name dsn, as passed to sqlite3_open_v2,
+// with the URI parameter immutable=1 added.
+func withImmutable(dsn string) string { return withURIParameter(dsn, "immutable", "1") }
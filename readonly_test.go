@@ -0,0 +1,115 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// createReadOnlyTestDB creates the database fn in journal mode with 3 rows
+// in table t.
+func createReadOnlyTestDB(t *testing.T, fn, mode string) {
+	db, err := sql.Open(driverName, fn+"?_pragma=journal_mode("+mode+")")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i); insert into t values(1), (2), (3)"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countReadOnly(t *testing.T, dsn string) (n int, err error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	err = db.QueryRow("select count(*) from t").Scan(&n)
+	return n, err
+}
+
+// TestReadOnlyFallback checks a database in WAL mode whose -shm file cannot be
+// created, like on a read only file system, is read as immutable.
+func TestReadOnlyFallback(t *testing.T) {
+	for _, mode := range []string{"delete", "wal"} {
+		fn := filepath.Join(t.TempDir(), "test.db")
+		createReadOnlyTestDB(t, fn, mode)
+		if _, err := os.Stat(fn + "-wal"); !os.IsNotExist(err) {
+			t.Fatalf("%s: -wal file not removed: %v", mode, err)
+		}
+
+		// A directory in place of the -shm file makes opening it fail even
+		// for root, which ignores the permissions of a read only directory.
+		if err := os.Mkdir(fn+"-shm", 0o500); err != nil {
+			t.Fatal(err)
+		}
+
+		if n, err := countReadOnly(t, "file:"+fn+"?mode=ro"); err != nil || n != 3 {
+			t.Fatalf("%s: %v %v", mode, n, err)
+		}
+	}
+}
+
+// TestReadOnlyDirectory checks databases in a read only directory can be read
+// in either journal mode, without creating any files.
+func TestReadOnlyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for _, mode := range []string{"delete", "wal"} {
+		createReadOnlyTestDB(t, filepath.Join(dir, mode+".db"), mode)
+	}
+	if err := os.Chmod(dir, 0o500); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Chmod(dir, 0o700)
+
+	if err := os.WriteFile(filepath.Join(dir, "probe"), nil, 0o600); err == nil {
+		t.Skip("cannot make a read only directory, for example when running as root")
+	}
+
+	for _, mode := range []string{"delete", "wal"} {
+		fn := filepath.Join(dir, mode+".db")
+		for _, dsn := range []string{
+			"file:" + fn + "?mode=ro",
+			"file:" + fn + "?immutable=1",
+		} {
+			if n, err := countReadOnly(t, dsn); err != nil || n != 3 {
+				t.Fatalf("%s: %v %v", dsn, n, err)
+			}
+		}
+	}
+
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(des) != 2 {
+		t.Fatalf("files created: %v", des)
+	}
+}
+
+func TestIsWALFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, mode := range []string{"delete", "wal"} {
+		fn := filepath.Join(dir, mode+".db")
+		createReadOnlyTestDB(t, fn, mode)
+		if g, e := isWALFile(fn), mode == "wal"; g != e {
+			t.Errorf("%s: got %v, want %v", mode, g, e)
+		}
+	}
+
+	if isWALFile(filepath.Join(dir, "nonexistent.db")) {
+		t.Error("nonexistent file reported as WAL")
+	}
+}
@@ -0,0 +1,867 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/libc"
+	"modernc.org/sqlite/dbfile"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// recovery tracks the corruption recoveries of one database file shared by
+// all the connections using the quarantine policy.
+type recovery struct {
+	sync.Mutex
+	generation int64 // Incremented by every recovery of the file.
+}
+
+var (
+	recoveriesMu sync.Mutex
+	recoveries   = map[string]*recovery{}
+)
+
+func recoveryFor(filename string) *recovery {
+	recoveriesMu.Lock()
+
+	defer recoveriesMu.Unlock()
+
+	r := recoveries[filename]
+	if r == nil {
+		r = &recovery{}
+		recoveries[filename] = r
+	}
+	return r
+}
+
+func isCorrupt(rc int32) bool {
+	switch rc & 0xff {
+	case sqlite3.SQLITE_CORRUPT, sqlite3.SQLITE_NOTADB:
+		return true
+	}
+
+	return false
+}
+
+// setRecover enables the recovery policy for c.
+func (c *conn) setRecover(policy string) error {
+	switch strings.ToLower(policy) {
+	case "quarantine":
+		// ok
+	default:
+		return fmt.Errorf("unknown _recover %q", policy)
+	}
+
+	c.filename = libc.GoString(sqlite3.Xsqlite3_db_filename(c.tls, c.db, 0))
+	if c.filename == "" || c.readOnly { // Temporary, in-memory or read only database.
+		return nil
+	}
+
+	c.recovery = recoveryFor(c.filename)
+	c.recovery.Lock()
+	c.generation = c.recovery.generation
+	c.recovery.Unlock()
+	return nil
+}
+
+// probe checks the database can be read at all.
+func (c *conn) probe() error {
+	_, err := c.exec(context.Background(), "select count(*) from sqlite_master", nil)
+	return err
+}
+
+// health is checked before c starts a new operation. It returns
+// driver.ErrBadConn if the connection ran into a corrupted database, if its
+// database file was replaced by a recovery since the connection was opened, if
+// it must be reopened, see Reopen, or if a panic was recovered from the
+// library.
+func (c *conn) health() error {
+	if c.panic {
+		return driver.ErrBadConn
+	}
+
+	if err := c.checkReopen(); err != nil {
+		return err
+	}
+
+	if c.recovery == nil {
+		return nil
+	}
+
+	if c.corrupt {
+		return c.quarantine(driver.ErrBadConn)
+	}
+
+	c.recovery.Lock()
+	g := c.recovery.generation
+	c.recovery.Unlock()
+	if g != c.generation {
+		return driver.ErrBadConn
+	}
+
+	return nil
+}
+
+// checkCorrupt is passed the error of a finished operation. If the operation
+// ran into a corrupted database the recovery is performed and
+// driver.ErrBadConn is returned, so database/sql retries the operation using a
+// new connection.
+func (c *conn) checkCorrupt(err error) error {
+	if err == nil || c.recovery == nil || !c.corrupt {
+		return err
+	}
+
+	return c.quarantine(err)
+}
+
+// quarantine closes c, salvages the content of its database file into a new
+// file and renames the corrupted file to make it unavailable for new
+// connections, putting the new file in its place. On success it returns
+// driver.ErrBadConn, otherwise err, leaving the database file as it was.
+func (c *conn) quarantine(err error) error {
+	r := c.recovery
+
+	r.Lock()
+
+	defer r.Unlock()
+
+	if r.generation != c.generation { // Already recovered by another connection.
+		c.closeDB()
+		return driver.ErrBadConn
+	}
+
+	if e := c.closeDB(); e != nil {
+		logf(sqlite3.SQLITE_CORRUPT, "sqlite: cannot close corrupted database %s: %v", c.filename, e)
+		return err
+	}
+
+	q := fmt.Sprintf("%s.corrupt-%s", c.filename, time.Now().UTC().Format("20060102T150405.000000000Z"))
+	tmp := q + ".salvage"
+	if e := salvage(tmp, c.filename); e != nil {
+		logf(sqlite3.SQLITE_CORRUPT, "sqlite: salvaging %s: %v", c.filename, e)
+		removeDBFiles(tmp)
+		return err
+	}
+
+	if e := renameDBFiles(c.filename, q); e != nil {
+		logf(sqlite3.SQLITE_CORRUPT, "sqlite: cannot quarantine corrupted database %s: %v", c.filename, e)
+		removeDBFiles(tmp)
+		return err
+	}
+
+	if e := os.Rename(tmp, c.filename); e != nil {
+		logf(sqlite3.SQLITE_CORRUPT, "sqlite: cannot replace corrupted database %s: %v", c.filename, e)
+		removeDBFiles(tmp)
+		if e := renameDBFiles(q, c.filename); e != nil {
+			logf(sqlite3.SQLITE_CORRUPT, "sqlite: cannot restore %s from %s: %v", c.filename, q, e)
+		}
+		return err
+	}
+
+	r.generation++
+	logf(sqlite3.SQLITE_NOTICE, "sqlite: corrupted database %s quarantined as %s and recovered", c.filename, q)
+	return driver.ErrBadConn
+}
+
+// renameDBFiles renames the database file from and its journal, WAL and
+// shared memory files, if any, to to.
+func renameDBFiles(from, to string) error {
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if err := os.Rename(from+suffix, to+suffix); err != nil && !os.IsNotExist(err) {
+			logf(sqlite3.SQLITE_CORRUPT, "sqlite: cannot rename %s: %v", from+suffix, err)
+		}
+	}
+	return nil
+}
+
+// removeDBFiles removes the database file name and its journal.
+func removeDBFiles(name string) {
+	for _, suffix := range []string{"", "-journal"} {
+		os.Remove(name + suffix)
+	}
+}
+
+// closeDB closes the database handle of c but keeps c usable for Close.
+func (c *conn) closeDB() error {
+	c.Lock() // Defend against race with .interrupt invoked by context handling.
+
+	defer c.Unlock()
+
+	if c.db == 0 {
+		return nil
+	}
+
+	err := c.closeV2(c.db)
+	c.db = 0
+	return err
+}
+
+// openRaw opens the database file name using flags, without interpreting any
+// query parameters.
+func openRaw(name string, flags int32) (c *conn, err error) {
+	c = &conn{tls: libc.NewTLS()}
+	if c.db, err = c.openV2(name, flags); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	if err = c.extendedResultCodes(true); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// salvage copies whatever can still be read from the database file src into
+// the new database file dst, see Recover.
+func salvage(dst, src string) error {
+	_, err := Recover(dst, src)
+	return err
+}
+
+// RecoverResult reports what Recover copied.
+type RecoverResult struct {
+	Tables int   // Tables created in the new database.
+	Rows   int64 // Rows copied into these tables.
+	// LostRows counts the rows found on pages of the file which no table
+	// of the schema leads to, copied into the table LostAndFound.
+	LostRows     int64
+	LostAndFound string // Name of the table of the lost rows, "" if there are none.
+}
+
+// Recover copies as much as can still be read from the possibly corrupted
+// database file src into the new database file dst, like the .recover
+// command of the sqlite3 shell, see https://www.sqlite.org/recovery.html.
+//
+// The schema is read using SQL or, if that fails, from the first page of the
+// file. The tables are copied row by row using SQL. If a table cannot be read
+// to its end, the pages of its b-tree are then read from the file directly,
+// skipping the corrupt ones, and the rows not copied yet are added. The rows
+// of the table pages no table leads to, for example the pages below a corrupt
+// interior page, are copied into a table named lost_and_found, or
+// lost_and_found_<n> if the schema already has one, with the columns
+//
+//	rootpgno  the root page of the orphaned b-tree holding the row
+//	pgno      the page of the row
+//	nfield    the number of values of the row
+//	id        the rowid of the row
+//	c0, c1... the values
+//
+// Indexes, views and triggers are recreated after all the data is copied. The
+// page size, text encoding, auto vacuum mode, user version and application id
+// of src are kept. Virtual tables and the internal tables of SQLite, like
+// sqlite_sequence and sqlite_stat1, are not copied. WITHOUT ROWID tables are
+// copied using SQL only. The file is not read directly if src has a WAL file
+// holding transactions not yet checkpointed, as its pages are then outdated.
+//
+// Recover fails only if src cannot be opened at all, if dst exists, or if dst
+// cannot be written. The objects which could not be recovered completely are
+// reported to the logger installed by SetLogger.
+func Recover(dst, src string) (r RecoverResult, err error) {
+	if _, err := os.Lstat(dst); err == nil {
+		return r, fmt.Errorf("sqlite: Recover: %s already exists", dst)
+	}
+
+	rv := &recoverer{src: src, seen: map[uint32]bool{}}
+	rv.openFile()
+	if rv.f != nil {
+		defer rv.f.Close()
+	}
+
+	s, err := openRaw(src, sqlite3.SQLITE_OPEN_READWRITE)
+	if err != nil {
+		return r, err
+	}
+
+	defer s.Close()
+
+	schema, err := s.salvageSchema()
+	if err != nil {
+		if rv.f == nil {
+			return r, err
+		}
+
+		logf(sqlite3.SQLITE_CORRUPT, "sqlite: recovering %s: cannot read the schema, reading page 1: %v", src, err)
+		if schema, err = rv.readSchema(); err != nil {
+			return r, err
+		}
+	}
+
+	d, err := openRaw(dst, sqlite3.SQLITE_OPEN_READWRITE|sqlite3.SQLITE_OPEN_CREATE)
+	if err != nil {
+		return r, err
+	}
+
+	defer func() {
+		if e := d.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	ctx := context.Background()
+	if rv.h != nil {
+		for _, v := range rv.pragmas() {
+			if _, err = d.exec(ctx, v, nil); err != nil {
+				return r, err
+			}
+		}
+	}
+
+	if _, err = d.exec(ctx, "begin", nil); err != nil {
+		return r, err
+	}
+
+	if rv.f != nil {
+		rv.walk(1, nil) // sqlite_master
+	}
+	for _, v := range schema {
+		if v.typ != "table" {
+			continue
+		}
+
+		if v.internal() {
+			if rv.f != nil && v.root != 0 {
+				rv.walk(v.root, nil)
+			}
+			continue
+		}
+
+		if _, err := d.exec(ctx, v.sql, nil); err != nil {
+			logf(sqlite3.SQLITE_CORRUPT, "sqlite: recovering %s: cannot create table %s: %v", src, v.name, err)
+			continue
+		}
+
+		r.Tables++
+		n, err := s.salvageTable(d, v.name)
+		r.Rows += int64(n)
+		switch {
+		case rv.f == nil || v.root == 0:
+			// Nothing else to do.
+		case err == nil || v.withoutRowid():
+			rv.walk(v.root, nil)
+		default:
+			logf(sqlite3.SQLITE_CORRUPT, "sqlite: recovering %s: table %s: %v, reading its pages", src, v.name, err)
+			m, e := rv.copyPages(d, v)
+			n += int(m)
+			r.Rows += m
+			err = e
+		}
+		if err != nil {
+			logf(sqlite3.SQLITE_CORRUPT, "sqlite: recovering %s: table %s: %v", src, v.name, err)
+		}
+		logf(sqlite3.SQLITE_NOTICE, "sqlite: recovering %s: table %s: %d rows copied", src, v.name, n)
+	}
+
+	if rv.f != nil {
+		if r.LostAndFound, r.LostRows, err = rv.lostAndFound(d, schema); err != nil {
+			return r, err
+		}
+	}
+
+	for _, v := range schema {
+		if v.typ == "table" || v.internal() {
+			continue
+		}
+
+		if _, err := d.exec(ctx, v.sql, nil); err != nil {
+			logf(sqlite3.SQLITE_CORRUPT, "sqlite: recovering %s: cannot create %s %s: %v", src, v.typ, v.name, err)
+		}
+	}
+
+	_, err = d.exec(ctx, "commit", nil)
+	return r, err
+}
+
+// recoverer reads the pages of a database file for Recover.
+type recoverer struct {
+	src  string
+	f    *os.File       // Nil if the pages cannot be read.
+	h    *dbfile.Header // Of f.
+	seen map[uint32]bool
+}
+
+// openFile opens the database file for reading its pages, unless they are
+// outdated by a WAL file.
+func (rv *recoverer) openFile() {
+	if fi, err := os.Stat(rv.src + "-wal"); err == nil && fi.Size() != 0 {
+		logf(sqlite3.SQLITE_NOTICE, "sqlite: recovering %s: not reading the pages of a database with a WAL file", rv.src)
+		return
+	}
+
+	f, err := os.Open(rv.src)
+	if err != nil {
+		logf(sqlite3.SQLITE_CORRUPT, "sqlite: recovering %s: %v", rv.src, err)
+		return
+	}
+
+	if rv.h, err = dbfile.ReadHeader(f); err != nil {
+		logf(sqlite3.SQLITE_CORRUPT, "sqlite: recovering %s: %v", rv.src, err)
+		f.Close()
+		return
+	}
+
+	rv.f = f
+}
+
+// pragmas returns the statements setting the properties of the database
+// header in the new database.
+func (rv *recoverer) pragmas() []string {
+	h := rv.h
+	autoVacuum := 0
+	if h.LargestRootPage != 0 {
+		autoVacuum = 1
+		if h.IncrementalVacuum {
+			autoVacuum = 2
+		}
+	}
+	r := []string{
+		fmt.Sprintf("pragma page_size=%d", h.PageSize),
+		fmt.Sprintf("pragma auto_vacuum=%d", autoVacuum),
+		fmt.Sprintf("pragma user_version=%d", h.UserVersion),
+		fmt.Sprintf("pragma application_id=%d", h.ApplicationID),
+	}
+	switch h.TextEncoding {
+	case dbfile.UTF16LE, dbfile.UTF16BE:
+		r = append(r, fmt.Sprintf("pragma encoding='%s'", h.TextEncoding))
+	}
+	return r
+}
+
+// walk visits the pages of the table b-tree with the root page root, passing
+// its rows to row, if not nil. Pages already seen, or corrupt, are skipped.
+// walk returns the first error encountered.
+func (rv *recoverer) walk(root uint32, row func(pgno uint32, r dbfile.Row)) (err error) {
+	for stack := []uint32{root}; len(stack) != 0; {
+		pgno := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if rv.seen[pgno] {
+			if err == nil {
+				err = fmt.Errorf("%w: page %d is used more than once", dbfile.ErrCorrupt, pgno)
+			}
+			continue
+		}
+
+		rv.seen[pgno] = true
+		p, e := dbfile.ReadPage(rv.f, rv.h, pgno)
+		if e != nil && err == nil {
+			err = e
+		}
+		if p == nil {
+			continue
+		}
+
+		for _, v := range p.Overflow {
+			rv.seen[v] = true
+		}
+		switch p.Type {
+		case dbfile.InteriorTable:
+			for i := len(p.Children) - 1; i >= 0; i-- {
+				stack = append(stack, p.Children[i])
+			}
+		case dbfile.LeafTable:
+			if row != nil {
+				for _, v := range p.Rows {
+					row(pgno, v)
+				}
+			}
+		default:
+			if err == nil {
+				err = fmt.Errorf("%w: %s page %d in a table b-tree", dbfile.ErrCorrupt, p.Type, pgno)
+			}
+		}
+	}
+	return err
+}
+
+// readSchema reads the schema from the b-tree of sqlite_master. The pages
+// read are not marked as seen.
+func (rv *recoverer) readSchema() (r []schemaObject, err error) {
+	var rows []dbfile.Row
+	err = rv.walk(1, func(_ uint32, row dbfile.Row) { rows = append(rows, row) })
+	rv.seen = map[uint32]bool{}
+	if len(rows) == 0 {
+		return nil, err
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Rowid < rows[j].Rowid })
+	for _, row := range rows {
+		if len(row.Values) < 5 {
+			continue
+		}
+
+		typ, _ := row.Values[0].(string)
+		name, _ := row.Values[1].(string)
+		root, _ := row.Values[3].(int64)
+		sql, ok := row.Values[4].(string)
+		if ok && typ != "" && name != "" {
+			r = append(r, schemaObject{typ, name, uint32(root), sql})
+		}
+	}
+	return r, nil
+}
+
+// copyPages inserts the rows of the b-tree of table v not yet in d and
+// reports their number.
+func (rv *recoverer) copyPages(d *conn, v schemaObject) (n int64, err error) {
+	cols, ipk, err := d.tableColumns(v.name)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(cols) == 0 {
+		return 0, fmt.Errorf("cannot copy the pages of a table with generated columns")
+	}
+
+	ctx := context.Background()
+	var inserts []string
+	var firstErr error
+	err = rv.walk(v.root, func(_ uint32, row dbfile.Row) {
+		values := row.Values
+		if len(values) > len(cols) {
+			values = values[:len(cols)]
+		}
+		for len(inserts) <= len(values) {
+			inserts = append(inserts, "")
+		}
+		useRowid := ipk < 0 || ipk >= len(values)
+		q := inserts[len(values)]
+		if q == "" {
+			var names []string
+			if useRowid {
+				names = append(names, "_rowid_")
+			}
+			for _, v := range cols[:len(values)] {
+				names = append(names, quoteIdentifier(v))
+			}
+			q = "insert or ignore into " + quoteIdentifier(v.name) + "(" + strings.Join(names, ", ") + ") values(?" + strings.Repeat(",?", len(names)-1) + ")"
+			inserts[len(values)] = q
+		}
+
+		var args []driver.NamedValue
+		if useRowid {
+			args = append(args, driver.NamedValue{Ordinal: 1, Value: row.Rowid})
+		}
+		for i, v := range values {
+			if i == ipk && v == nil {
+				v = row.Rowid
+			}
+			args = append(args, driver.NamedValue{Ordinal: len(args) + 1, Value: v})
+		}
+		r, err := d.exec(ctx, q, args)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+
+		m, _ := r.RowsAffected()
+		n += m
+	})
+	if err == nil {
+		err = firstErr
+	}
+	return n, err
+}
+
+// tableColumns returns the names of the columns of table, and the index of
+// its INTEGER PRIMARY KEY, or -1 if it has none. No names are returned if
+// table has generated columns, which are missing from the rows stored.
+func (c *conn) tableColumns(table string) (names []string, ipk int, err error) {
+	r, err := c.internalQuery(context.Background(), "select name, upper(type), pk, hidden from pragma_table_xinfo(?)", []driver.NamedValue{{Ordinal: 1, Value: table}})
+	if err != nil {
+		return nil, -1, err
+	}
+
+	defer r.Close()
+
+	ipk = -1
+	pks := 0
+	dest := make([]driver.Value, 4)
+	for {
+		if err := r.Next(dest); err != nil {
+			if err != io.EOF {
+				return nil, -1, err
+			}
+
+			break
+		}
+
+		if dest[3].(int64) != 0 {
+			return nil, -1, nil
+		}
+
+		if dest[2].(int64) != 0 {
+			pks++
+			if dest[1].(string) == "INTEGER" {
+				ipk = len(names)
+			}
+		}
+		names = append(names, dest[0].(string))
+	}
+	if pks != 1 {
+		ipk = -1
+	}
+	return names, ipk, nil
+}
+
+// lostAndFound copies the rows of the table pages not seen into a new table
+// of d and returns its name and the number of rows copied.
+func (rv *recoverer) lostAndFound(d *conn, schema []schemaObject) (name string, n int64, err error) {
+	if fl, err := dbfile.ReadFreelist(rv.f, rv.h); err == nil {
+		for _, v := range fl.Trunks {
+			rv.seen[v] = true
+		}
+		for _, v := range fl.Leaves {
+			rv.seen[v] = true
+		}
+	} else {
+		logf(sqlite3.SQLITE_CORRUPT, "sqlite: recovering %s: %v", rv.src, err)
+	}
+
+	pages := rv.h.PageCount
+	if !rv.h.PageCountValid() {
+		fi, err := rv.f.Stat()
+		if err != nil {
+			return "", 0, err
+		}
+
+		pages = uint32(fi.Size() / int64(rv.h.PageSize))
+	}
+
+	// The roots of the orphaned b-trees are the table pages not seen no
+	// other such page leads to. Cycles have no root, their pages are
+	// visited in a second pass.
+	var orphans []uint32
+	children := map[uint32]bool{}
+	for pgno := uint32(2); pgno <= pages; pgno++ {
+		if rv.seen[pgno] {
+			continue
+		}
+
+		p, _ := dbfile.ReadPage(rv.f, rv.h, pgno)
+		if p == nil {
+			continue
+		}
+
+		switch p.Type {
+		case dbfile.InteriorTable:
+			for _, v := range p.Children {
+				children[v] = true
+			}
+			fallthrough
+		case dbfile.LeafTable:
+			orphans = append(orphans, pgno)
+		}
+	}
+
+	type lostRow struct {
+		root, pgno uint32
+		dbfile.Row
+	}
+	var rows []lostRow
+	ncol := 0
+	for pass := 0; pass < 2; pass++ {
+		for _, root := range orphans {
+			if rv.seen[root] || pass == 0 && children[root] {
+				continue
+			}
+
+			rv.walk(root, func(pgno uint32, row dbfile.Row) {
+				rows = append(rows, lostRow{root, pgno, row})
+				if len(row.Values) > ncol {
+					ncol = len(row.Values)
+				}
+			})
+		}
+	}
+	if len(rows) == 0 {
+		return "", 0, nil
+	}
+
+	names := map[string]bool{}
+	for _, v := range schema {
+		names[strings.ToLower(v.name)] = true
+	}
+	name = "lost_and_found"
+	for i := 0; names[name]; i++ {
+		name = fmt.Sprintf("lost_and_found_%d", i)
+	}
+	var b strings.Builder
+	b.WriteString("create table " + name + "(rootpgno integer, pgno integer, nfield integer, id integer")
+	for i := 0; i < ncol; i++ {
+		fmt.Fprintf(&b, ", c%d", i)
+	}
+	b.WriteString(")")
+	ctx := context.Background()
+	if _, err := d.exec(ctx, b.String(), nil); err != nil {
+		return "", 0, err
+	}
+
+	q := "insert into " + name + " values(?,?,?,?" + strings.Repeat(",?", ncol) + ")"
+	args := make([]driver.NamedValue, 4+ncol)
+	for _, v := range rows {
+		for i := range args {
+			args[i] = driver.NamedValue{Ordinal: i + 1}
+		}
+		args[0].Value = int64(v.root)
+		args[1].Value = int64(v.pgno)
+		args[2].Value = int64(len(v.Values))
+		args[3].Value = v.Rowid
+		for i, w := range v.Values {
+			args[4+i].Value = w
+		}
+		if _, err := d.exec(ctx, q, args); err != nil {
+			return "", 0, err
+		}
+
+		n++
+	}
+	logf(sqlite3.SQLITE_NOTICE, "sqlite: recovering %s: %d rows copied into %s", rv.src, n, name)
+	return name, n, nil
+}
+
+type schemaObject struct {
+	typ  string
+	name string
+	root uint32 // Root page, 0 for views, triggers and virtual tables.
+	sql  string
+}
+
+// internal reports whether v is an internal object of SQLite or a virtual
+// table, which are not recovered.
+func (v schemaObject) internal() bool {
+	return strings.HasPrefix(v.name, "sqlite_") ||
+		v.typ == "table" && strings.HasPrefix(strings.ToLower(strings.TrimSpace(v.sql)), "create virtual")
+}
+
+// withoutRowid reports whether v is a WITHOUT ROWID table.
+func (v schemaObject) withoutRowid() bool {
+	return strings.Contains(strings.ToLower(strings.Join(strings.Fields(v.sql), " ")), "without rowid")
+}
+
+// salvageSchema returns the readable part of the schema of c.
+func (c *conn) salvageSchema() (r []schemaObject, err error) {
+	zSQL, err := libc.CString("select type, name, rootpage, sql from sqlite_master where sql is not null order by rowid")
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.free(zSQL)
+
+	psql := zSQL
+	pstmt, err := c.prepareV2(&psql)
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.finalize(pstmt)
+
+	for {
+		rc, err := c.step(pstmt)
+		if err != nil || rc != sqlite3.SQLITE_ROW {
+			return r, err
+		}
+
+		typ, _ := c.columnText(pstmt, 0)
+		name, _ := c.columnText(pstmt, 1)
+		root, _ := c.columnInt64(pstmt, 2)
+		sql, _ := c.columnText(pstmt, 3)
+		r = append(r, schemaObject{typ, name, uint32(root), sql})
+	}
+}
+
+// salvageTable copies the rows of table from c to d and reports the number of
+// rows copied.
+func (c *conn) salvageTable(d *conn, table string) (n int, err error) {
+	q := quoteIdentifier(table)
+	zSQL, err := libc.CString("select * from " + q)
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.free(zSQL)
+
+	psql := zSQL
+	pstmt, err := c.prepareV2(&psql)
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.finalize(pstmt)
+
+	ncol, err := c.columnCount(pstmt)
+	if err != nil {
+		return 0, err
+	}
+
+	insert := "insert or ignore into " + q + " values(?" + strings.Repeat(",?", ncol-1) + ")"
+	args := make([]driver.NamedValue, ncol)
+	ctx := context.Background()
+	for {
+		rc, err := c.step(pstmt)
+		if err != nil || rc != sqlite3.SQLITE_ROW {
+			return n, err
+		}
+
+		for i := range args {
+			if args[i].Value, err = c.columnValue(pstmt, i); err != nil {
+				return n, err
+			}
+
+			args[i].Ordinal = i + 1
+		}
+		if _, err := d.exec(ctx, insert, args); err != nil {
+			return n, err
+		}
+
+		n++
+	}
+}
+
+// columnValue returns column iCol of the current row of pstmt without any
+// conversions.
+func (c *conn) columnValue(pstmt uintptr, iCol int) (driver.Value, error) {
+	ct, err := c.columnType(pstmt, iCol)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ct {
+	case sqlite3.SQLITE_INTEGER:
+		return c.columnInt64(pstmt, iCol)
+	case sqlite3.SQLITE_FLOAT:
+		return c.columnDouble(pstmt, iCol)
+	case sqlite3.SQLITE_TEXT:
+		return c.columnText(pstmt, iCol)
+	case sqlite3.SQLITE_BLOB:
+		v, err := c.columnBlob(pstmt, iCol)
+		if v == nil && err == nil {
+			v = []byte{}
+		}
+		return v, err
+	default:
+		return nil, nil
+	}
+}
+
+// quoteIdentifier returns s quoted as an SQL identifier.
+func quoteIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
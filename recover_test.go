@@ -0,0 +1,252 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"modernc.org/sqlite/dbfile"
+)
+
+const recoverRows = 2000
+
+// recoverFixture creates a database with the table t of recoverRows rows and
+// returns its file name, header and the root page of t.
+func recoverFixture(t *testing.T) (name string, h *dbfile.Header, root uint32) {
+	name = filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, name+"?_pragma=page_size(4096)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+create table t(i integer primary key, s text);
+with recursive c(x) as (select 1 union all select x+1 from c where x < ?)
+insert into t select x, printf('%0100d', x) from c;
+create index x on t(s);
+pragma user_version = 7;
+`, recoverRows); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.QueryRow("select rootpage from sqlite_master where name = 't'").Scan(&root); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if h, err = dbfile.ReadHeader(f); err != nil {
+		t.Fatal(err)
+	}
+
+	return name, h, root
+}
+
+// corruptPage overwrites the page type of page pgno of name.
+func corruptPage(t *testing.T, name string, h *dbfile.Header, pgno uint32) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if _, err := f.WriteAt([]byte{0xff}, int64(pgno-1)*int64(h.PageSize)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	name, h, root := recoverFixture(t)
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := dbfile.ReadPage(f, h, root)
+	f.Close()
+	if err != nil || p.Type != dbfile.InteriorTable || len(p.Children) < 3 {
+		t.Fatalf("root page %+v, %v", p, err)
+	}
+
+	// A corrupt leaf page in the middle of t stops the SQL scan, the rows
+	// after it are read from the pages.
+	corruptPage(t, name, h, p.Children[len(p.Children)/2])
+	dst := filepath.Join(t.TempDir(), "recovered.db")
+	r, err := Recover(dst, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Tables != 1 || r.Rows < recoverRows/2 || r.Rows >= recoverRows || r.LostRows != 0 || r.LostAndFound != "" {
+		t.Fatalf("%+v", r)
+	}
+
+	db, err := sql.Open(driverName, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	var n, max, userVersion int64
+	var check string
+	if err := db.QueryRow("select count(*), max(i), (select user_version from pragma_user_version), (select * from pragma_integrity_check) from t").Scan(&n, &max, &userVersion, &check); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != r.Rows || max != recoverRows || userVersion != 7 || check != "ok" {
+		t.Errorf("%d rows, max %d, user version %d, integrity %q, want %d rows, max %d, user version 7, integrity ok", n, max, userVersion, check, r.Rows, recoverRows)
+	}
+
+	if _, err := Recover(dst, name); err == nil {
+		t.Error("unexpected success recovering into an existing file")
+	}
+}
+
+func TestRecoverLostAndFound(t *testing.T) {
+	name, h, root := recoverFixture(t)
+
+	// A corrupt root page orphans all the leaf pages of t.
+	corruptPage(t, name, h, root)
+	dst := filepath.Join(t.TempDir(), "recovered.db")
+	r, err := Recover(dst, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Tables != 1 || r.Rows != 0 || r.LostRows != recoverRows || r.LostAndFound != "lost_and_found" {
+		t.Fatalf("%+v", r)
+	}
+
+	db, err := sql.Open(driverName, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	var n, nfield int64
+	var s string
+	if err := db.QueryRow("select count(*), max(nfield), max(c1) from lost_and_found where id = coalesce(c0, id)").Scan(&n, &nfield, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != recoverRows || nfield != 2 || !strings.HasSuffix(s, "2000") {
+		t.Errorf("%d rows, %d fields, max %q", n, nfield, s)
+	}
+}
+
+// quarantined returns the files of the directory of name left by the
+// quarantine policy.
+func quarantined(t *testing.T, name string) []string {
+	m, err := filepath.Glob(name + ".corrupt-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestQuarantine(t *testing.T) {
+	name, h, root := recoverFixture(t)
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := dbfile.ReadPage(f, h, root)
+	f.Close()
+	if err != nil || p.Type != dbfile.InteriorTable || len(p.Children) < 3 {
+		t.Fatalf("root page %+v, %v", p, err)
+	}
+
+	corruptPage(t, name, h, p.Children[len(p.Children)/2])
+	db, err := sql.Open(driverName, name+"?_recover=quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	// The query fails on the corrupted file, database/sql retries it on a
+	// new connection to the recovered one.
+	var n, max int64
+	if err := db.QueryRow("select count(*), max(i) from t not indexed").Scan(&n, &max); err != nil {
+		t.Fatal(err)
+	}
+
+	if n < recoverRows/2 || n >= recoverRows || max != recoverRows {
+		t.Errorf("got %d rows, max %d", n, max)
+	}
+
+	if m := quarantined(t, name); len(m) != 1 || strings.HasSuffix(m[0], ".salvage") {
+		t.Fatalf("quarantined files %v", m)
+	}
+
+	if g := recoveryFor(name).generation; g != 1 {
+		t.Fatalf("got generation %d, want 1", g)
+	}
+}
+
+// TestQuarantineSalvageFails checks a file that cannot be salvaged is left in
+// place and does not invalidate the connections to it.
+func TestQuarantineSalvageFails(t *testing.T) {
+	name, _, _ := recoverFixture(t)
+	orig, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := append([]byte(nil), orig...)
+	copy(b, "not a database file")
+	if err := os.WriteFile(name, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open(driverName, name+"?_recover=quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if err := db.Ping(); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	if m := quarantined(t, name); len(m) != 0 {
+		t.Fatalf("quarantined files %v", m)
+	}
+
+	if g := recoveryFor(name).generation; g != 0 {
+		t.Fatalf("got generation %d, want 0", g)
+	}
+
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, b) {
+		t.Fatal("database file modified")
+	}
+}
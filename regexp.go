@@ -0,0 +1,94 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// regexpCacheSize bounds the number of compiled patterns kept by
+// regexpCompile.
+const regexpCacheSize = 64
+
+var (
+	regexpFuncOnce sync.Once
+	regexpFunc     *userDefinedFunction
+	regexpFuncErr  error
+
+	regexpCacheMu sync.Mutex
+	regexpCache   = map[string]*regexp.Regexp{}
+)
+
+// setRegexp handles the _regexp query parameter. The function is created on c
+// only, unlike the functions registered by RegisterScalarFunction.
+func (c *conn) setRegexp(v string) error {
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid _regexp %q", v)
+	}
+
+	if !on {
+		return nil
+	}
+
+	regexpFuncOnce.Do(func() {
+		regexpFunc, regexpFuncErr = newScalarFunction("regexp", 2, sqlite3.SQLITE_UTF8|sqlite3.SQLITE_DETERMINISTIC, regexpMatch)
+	})
+	if regexpFuncErr != nil {
+		return regexpFuncErr
+	}
+
+	return c.createFunctionInternal(regexpFunc)
+}
+
+// regexp(Y, X) implements X REGEXP Y. It reports whether the text X contains a
+// match of the pattern Y. It returns NULL if X or Y is NULL.
+func regexpMatch(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	pattern, ok := valueBytes(args[0])
+	if !ok {
+		return nil, nil
+	}
+
+	s, ok := valueBytes(args[1])
+	if !ok {
+		return nil, nil
+	}
+
+	re, err := regexpCompile(string(pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	return re.Match(s), nil
+}
+
+// regexpCompile returns the compiled pattern, which is cached as the same
+// pattern is typically matched against every row of a query.
+func regexpCompile(pattern string) (*regexp.Regexp, error) {
+	regexpCacheMu.Lock()
+
+	defer regexpCacheMu.Unlock()
+
+	if re := regexpCache[pattern]; re != nil {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(regexpCache) >= regexpCacheSize {
+		regexpCache = map[string]*regexp.Regexp{}
+	}
+	regexpCache[pattern] = re
+	return re, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRegexp(t *testing.T) {
+	db, err := sql.Open(driverName, "file::memory:?_regexp=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	for _, v := range []struct {
+		sql  string
+		want interface{}
+	}{
+		{"select 'abc' regexp 'b'", int64(1)},
+		{"select 'abc' regexp '^b'", int64(0)},
+		{"select 'ABC' regexp 'b'", int64(0)},
+		{"select 'ABC' regexp '(?i)b'", int64(1)},
+		{"select 'héllo' regexp '^h.llo$'", int64(1)},
+		{"select 12345 regexp '^\\d+$'", int64(1)},
+		{"select x'00ff' regexp '\\x00'", int64(1)},
+		{"select regexp('a+', 'caaat')", int64(1)},
+		{"select null regexp 'a'", nil},
+		{"select 'a' regexp null", nil},
+	} {
+		var g interface{}
+		if err := db.QueryRow(v.sql).Scan(&g); err != nil {
+			t.Errorf("%s: %v", v.sql, err)
+			continue
+		}
+
+		if g != v.want {
+			t.Errorf("%s: got %v, want %v", v.sql, g, v.want)
+		}
+	}
+
+	if _, err := db.Exec("create table t(s); insert into t values('apple'), ('banana'), ('cherry'), (null)"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	rows, err := db.Query("select s from t where s regexp '^[ab]' order by s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows.Close()
+	if g, e := fmt.Sprint(got), "[apple banana]"; g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+
+	if _, err := db.Exec("select 'a' regexp '('"); err == nil || !strings.Contains(err.Error(), "missing closing )") {
+		t.Fatalf("got %v, want an invalid pattern error", err)
+	}
+}
+
+// TestRegexpOff checks REGEXP is not available without the _regexp parameter
+// and an invalid value is rejected.
+func TestRegexpOff(t *testing.T) {
+	for _, dsn := range []string{"file::memory:", "file::memory:?_regexp=0"} {
+		db, err := sql.Open(driverName, dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = db.Exec("select 'a' regexp 'a'")
+		db.Close()
+		if err == nil || !strings.Contains(err.Error(), "no such function: regexp") {
+			t.Errorf("%s: got %v, want no such function", dsn, err)
+		}
+	}
+
+	db, err := sql.Open(driverName, "file::memory:?_regexp=maybe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if err := db.Ping(); err == nil || !strings.Contains(err.Error(), `invalid _regexp "maybe"`) {
+		t.Fatalf("got %v, want invalid _regexp", err)
+	}
+}
+
+func TestRegexpCache(t *testing.T) {
+	for i := 0; i <= regexpCacheSize; i++ {
+		if _, err := regexpCompile(fmt.Sprintf("^%d$", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	regexpCacheMu.Lock()
+	n := len(regexpCache)
+	regexpCacheMu.Unlock()
+	if n > regexpCacheSize {
+		t.Fatalf("cache holds %d patterns, want at most %d", n, regexpCacheSize)
+	}
+
+	a, _ := regexpCompile("^x$")
+	b, _ := regexpCompile("^x$")
+	if a != b {
+		t.Fatal("pattern not cached")
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// reopening tracks the invalidations of the connections to one database file,
+// see Reopen.
+type reopening struct {
+	generation int64 // Accessed atomically, incremented by every Reopen.
+}
+
+var (
+	reopeningsMu sync.Mutex
+	reopenings   = map[string]*reopening{}
+)
+
+func reopeningFor(filename string) *reopening {
+	reopeningsMu.Lock()
+
+	defer reopeningsMu.Unlock()
+
+	r := reopenings[filename]
+	if r == nil {
+		r = &reopening{}
+		reopenings[filename] = r
+	}
+	return r
+}
+
+// canonicalPath returns the absolute path of name with the symbolic links
+// resolved, if possible.
+func canonicalPath(name string) string {
+	if s, err := filepath.Abs(name); err == nil {
+		name = s
+	}
+	if s, err := filepath.EvalSymlinks(name); err == nil {
+		name = s
+	}
+	return name
+}
+
+// Reopen makes the connections opened by the driver to the database file name
+// fail their next operation with driver.ErrBadConn. database/sql then
+// discards them and opens new connections, retrying the operation unless it
+// runs on a sql.Conn or in a sql.Tx, so a long-running service uses a database
+// file replaced by another one, like by a restore from a backup, without being
+// restarted. Operations already running are not affected. Use _reopen to
+// detect the replacements automatically.
+//
+// The -wal and -shm files of the replaced database must be removed before its
+// replacement is reopened, SQLite would otherwise apply the write-ahead log of
+// the former database to the new one.
+func Reopen(name string) {
+	atomic.AddInt64(&reopeningFor(canonicalPath(name)).generation, 1)
+}
+
+// trackReopen records the identity of the database file of c, see Reopen and
+// setReopen. Temporary and in-memory databases are not tracked.
+func (c *conn) trackReopen() {
+	filename := libc.GoString(sqlite3.Xsqlite3_db_filename(c.tls, c.db, 0))
+	if filename == "" {
+		return
+	}
+
+	c.reopening = reopeningFor(canonicalPath(filename))
+	c.reopenGeneration = atomic.LoadInt64(&c.reopening.generation)
+	if !c.reopenAuto {
+		return
+	}
+
+	c.reopenPath = filename
+	if c.reopenFile, _ = os.Stat(filename); c.reopenFile == nil {
+		c.reopenPath = ""
+	}
+}
+
+// setReopen handles the _reopen query parameter.
+func (c *conn) setReopen(v string) error {
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid _reopen %q", v)
+	}
+
+	c.reopenAuto = on
+	return nil
+}
+
+// checkReopen returns driver.ErrBadConn if c must be replaced by a new
+// connection because Reopen was called for its database file or, with
+// _reopen, because the file was replaced by another one.
+func (c *conn) checkReopen() error {
+	if c.reopening == nil {
+		return nil
+	}
+
+	if atomic.LoadInt64(&c.reopening.generation) != c.reopenGeneration {
+		return driver.ErrBadConn
+	}
+
+	if c.reopenPath == "" {
+		return nil
+	}
+
+	// A file missing for a moment, like while it is being replaced, does not
+	// invalidate c, the new file is checked by the next operation.
+	if fi, err := os.Stat(c.reopenPath); err == nil && !os.SameFile(fi, c.reopenFile) {
+		logf(sqlite3.SQLITE_NOTICE, "sqlite: database file %s was replaced, reopening", c.reopenPath)
+		c.reopenPath = ""
+		c.reopenGeneration = -1 // Keep failing until database/sql discards c.
+		return driver.ErrBadConn
+	}
+
+	return nil
+}
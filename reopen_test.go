@@ -0,0 +1,99 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.db")
+	for i, name := range []string{fn, fn + ".new"} {
+		db, err := sql.Open(driverName, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec("create table t(i); insert into t values(?)", i); err != nil {
+			t.Fatal(err)
+		}
+
+		db.Close()
+	}
+
+	db, err := sql.Open(driverName, fn+"?_reopen=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	get := func() int {
+		var i int
+		if err := db.QueryRow("select i from t").Scan(&i); err != nil {
+			t.Fatal(err)
+		}
+
+		return i
+	}
+	if g, e := get(), 0; g != e {
+		t.Fatalf("got %d, want %d", g, e)
+	}
+
+	if err := os.Rename(fn+".new", fn); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := get(), 1; g != e {
+		t.Fatalf("got %d, want %d", g, e)
+	}
+
+	// Reopen invalidates the connections without _reopen as well.
+	db2, err := sql.Open(driverName, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db2.Close()
+
+	ctx := context.Background()
+	c, err := db2.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if _, err := c.ExecContext(ctx, "select 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	Reopen(fn)
+	if _, err := c.ExecContext(ctx, "select 1"); err != driver.ErrBadConn {
+		t.Fatalf("got %v, want %v", err, driver.ErrBadConn)
+	}
+
+	if _, err := db2.Exec("select 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	db3, err := sql.Open(driverName, fn+"?_reopen=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db3.Close()
+
+	if err := db3.Ping(); err == nil {
+		t.Error("_reopen=x: unexpected success")
+	}
+}
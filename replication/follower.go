@@ -0,0 +1,240 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package replication // import "modernc.org/sqlite/replication"
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	_ "modernc.org/sqlite" // Registers the driver.
+)
+
+// maxPageSize is the largest page size of SQLite.
+const maxPageSize = 65536
+
+// Follower applies a replication stream to a replica database file.
+type Follower struct {
+	mu      sync.Mutex
+	db      *sql.DB
+	f       *os.File
+	conn    *sql.Conn
+	counter uint32 // File change counter of the replica.
+}
+
+// NewFollower opens, or creates, the replica database file name. The file
+// must not be modified by anything but the Follower. Open it for reading
+// using mode=ro, for example
+//
+//	db, err := sql.Open("sqlite3", "file:replica.db?mode=ro")
+//
+// The replica is kept in rollback journal mode, whatever the journal mode of
+// the primary.
+func NewFollower(name string) (*Follower, error) {
+	db, err := sql.Open("sqlite3", name+"?_pragma=busy_timeout(60000)&_pragma=journal_mode(delete)")
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// The file is kept open until Close, closing a descriptor of a file
+	// drops the POSIX locks the process holds on it.
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, err
+	}
+
+	r := &Follower{db: db, f: f, conn: conn}
+	var b [4]byte
+	if _, err := f.ReadAt(b[:], 24); err == nil {
+		r.counter = be.Uint32(b[:])
+	}
+	return r, nil
+}
+
+// Close closes the replica. Close the handles reading the replica first.
+func (r *Follower) Close() error {
+	r.mu.Lock()
+
+	defer r.mu.Unlock()
+
+	err := r.conn.Close()
+	if e := r.db.Close(); e != nil && err == nil {
+		err = e
+	}
+	if e := r.f.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Follow reads a replication stream, as written by Primary.ServeConn, from
+// rd and applies it to the replica until reading fails. The stream of a
+// disconnected primary ends with io.EOF or io.ErrUnexpectedEOF. Call Follow
+// again with a new stream to resume.
+func (r *Follower) Follow(rd io.Reader) error {
+	r.mu.Lock()
+
+	defer r.mu.Unlock()
+
+	br := bufio.NewReader(rd)
+	var magic [len(Magic)]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return err
+	}
+
+	if string(magic[:]) != Magic {
+		return fmt.Errorf("%w: invalid header", ErrProtocol)
+	}
+
+	var page []byte
+	for {
+		kind, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		switch kind {
+		case kindSnapshot:
+			var hdr [4 + 8]byte
+			if _, err := io.ReadFull(br, hdr[:]); err != nil {
+				return unexpectedEOF(err)
+			}
+
+			pageSize := int64(be.Uint32(hdr[:]))
+			size := int64(be.Uint64(hdr[4:]))
+			if pageSize > maxPageSize || pageSize == 0 && size != 0 || pageSize != 0 && size%pageSize != 0 {
+				return fmt.Errorf("%w: invalid snapshot of %d bytes with a page size of %d", ErrProtocol, size, pageSize)
+			}
+
+			if err := r.apply(size, func(f *os.File) error {
+				buf := make([]byte, pageSize)
+				for off := int64(0); off < size; off += pageSize {
+					if _, err := io.ReadFull(br, buf); err != nil {
+						return unexpectedEOF(err)
+					}
+
+					if err := r.writePage(f, buf, off); err != nil {
+						return err
+					}
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		case kindCommit:
+			var hdr [4 + 4 + 4]byte
+			if _, err := io.ReadFull(br, hdr[:]); err != nil {
+				return unexpectedEOF(err)
+			}
+
+			pageSize := int64(be.Uint32(hdr[:]))
+			pages := int64(be.Uint32(hdr[4:]))
+			n := be.Uint32(hdr[8:])
+			if pageSize == 0 || pageSize > maxPageSize {
+				return fmt.Errorf("%w: invalid page size %d", ErrProtocol, pageSize)
+			}
+
+			if int64(cap(page)) < 4+pageSize {
+				page = make([]byte, 4+pageSize)
+			}
+			page = page[:4+pageSize]
+			if err := r.apply(pages*pageSize, func(f *os.File) error {
+				for i := uint32(0); i < n; i++ {
+					if _, err := io.ReadFull(br, page); err != nil {
+						return unexpectedEOF(err)
+					}
+
+					pgno := int64(be.Uint32(page))
+					if pgno == 0 {
+						return fmt.Errorf("%w: invalid page number 0", ErrProtocol)
+					}
+
+					if err := r.writePage(f, page[4:], (pgno-1)*pageSize); err != nil {
+						return err
+					}
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unknown message kind %#x", ErrProtocol, kind)
+		}
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// apply runs fn holding an exclusive lock on the replica, which keeps its
+// readers out, then truncates the replica to size bytes and updates its file
+// change counter, which makes the readers discard their page caches.
+func (r *Follower) apply(size int64, fn func(*os.File) error) (err error) {
+	ctx := context.Background()
+	if _, err := r.conn.ExecContext(ctx, "begin exclusive"); err != nil {
+		return err
+	}
+
+	// The transaction only takes the lock. It is rolled back as SQLite
+	// initializes page 1 in a write transaction of an empty database.
+	defer func() {
+		if _, e := r.conn.ExecContext(ctx, "rollback"); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	if err := fn(r.f); err != nil {
+		return err
+	}
+
+	if err := r.f.Truncate(size); err != nil {
+		return err
+	}
+
+	if size == 0 {
+		return nil
+	}
+
+	// Header bytes 24-27 hold the file change counter, 92-95 the change
+	// counter valid for the in-header database size. Making the latter
+	// differ makes SQLite use the size of the file.
+	r.counter++
+	var b [4]byte
+	be.PutUint32(b[:], r.counter)
+	if _, err := r.f.WriteAt(b[:], 24); err != nil {
+		return err
+	}
+
+	be.PutUint32(b[:], r.counter-1)
+	_, err = r.f.WriteAt(b[:], 92)
+	return err
+}
+
+// writePage writes b at off, switching page 1 to rollback journal mode.
+func (r *Follower) writePage(f *os.File, b []byte, off int64) error {
+	if off == 0 && len(b) >= 100 {
+		b[18] = 1 // File format write version: legacy, not WAL.
+		b[19] = 1 // File format read version.
+	}
+	_, err := f.WriteAt(b, off)
+	return err
+}
@@ -0,0 +1,243 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package replication // import "modernc.org/sqlite/replication"
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"modernc.org/sqlite"
+)
+
+// DefaultBacklog is the default number of transactions queued for a follower.
+const DefaultBacklog = 1024
+
+// ErrBacklog is returned by ServeConn when the follower did not keep up with
+// the primary.
+var ErrBacklog = errors.New("replication: follower fell behind")
+
+// Primary streams the transactions of its databases to followers.
+type Primary struct {
+	// Backlog is the maximum number of transactions queued for a follower.
+	// A follower falling further behind is disconnected. Zero means
+	// DefaultBacklog. Changes apply to followers connecting afterwards.
+	Backlog int
+
+	mu        sync.Mutex
+	followers map[string]map[*follower]struct{} // Database file name: followers.
+}
+
+type follower struct {
+	ch       chan *sqlite.WALCommit
+	overflow chan struct{}
+}
+
+// NewPrimary registers a VFS named vfs which forwards to the VFS named
+// parent, or to the default VFS if parent is empty, and returns a Primary
+// streaming the transactions of the databases opened using it, see
+// sqlite.RegisterWALVFS. The databases must be in WAL mode.
+func NewPrimary(vfs, parent string) (*Primary, error) {
+	p := &Primary{followers: map[string]map[*follower]struct{}{}}
+	if err := sqlite.RegisterWALVFS(vfs, parent, p.ship); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// ship queues c for the followers of its database. It must not block, the
+// committing connection holds the write lock of the database.
+func (p *Primary) ship(c *sqlite.WALCommit) error {
+	p.mu.Lock()
+
+	defer p.mu.Unlock()
+
+	for f := range p.followers[c.Database] {
+		select {
+		case f.ch <- c:
+		default:
+			delete(p.followers[c.Database], f)
+			close(f.overflow)
+		}
+	}
+	return nil
+}
+
+func (p *Primary) remove(db string, f *follower) {
+	p.mu.Lock()
+
+	defer p.mu.Unlock()
+
+	delete(p.followers[db], f)
+}
+
+// Serve accepts follower connections on l and serves each of them by
+// ServeConn in a new goroutine. It returns when Accept fails.
+func (p *Primary) Serve(l net.Listener, db *sql.DB) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer c.Close()
+
+			p.ServeConn(context.Background(), c, db)
+		}()
+	}
+}
+
+// ServeConn streams the main database of db to a follower, writing to w,
+// until writing fails or ctx is done. It starts with a snapshot of the
+// database. db must be opened using the VFS of p and allow at least two open
+// connections.
+func (p *Primary) ServeConn(ctx context.Context, w io.Writer, db *sql.DB) error {
+	bw := bufio.NewWriter(w)
+	f, file, snapshot, err := p.snapshot(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	defer p.remove(file, f)
+
+	if err := writeSnapshot(bw, snapshot); err != nil {
+		return err
+	}
+
+	snapshot = nil
+	for {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+
+		select {
+		case c := <-f.ch:
+			if err := writeCommit(bw, c); err != nil {
+				return err
+			}
+
+			for n := len(f.ch); n > 0; n-- {
+				if err := writeCommit(bw, <-f.ch); err != nil {
+					return err
+				}
+			}
+		case <-f.overflow:
+			return ErrBacklog
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// snapshot registers a new follower of the main database of db and returns
+// the content of the database right before the first transaction queued for
+// the follower.
+func (p *Primary) snapshot(ctx context.Context, db *sql.DB) (f *follower, file string, b []byte, err error) {
+	wc, err := db.Conn(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	defer wc.Close()
+
+	rc, err := db.Conn(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	defer rc.Close()
+
+	if err := wc.QueryRowContext(ctx, "select file from pragma_database_list where name = 'main'").Scan(&file); err != nil {
+		return nil, "", nil, err
+	}
+
+	// Holding the write lock, no transaction is being committed. Everything
+	// committed before is seen by the read transaction, everything committed
+	// after is queued.
+	if _, err := wc.ExecContext(ctx, "begin immediate"); err != nil {
+		return nil, "", nil, err
+	}
+
+	backlog := p.Backlog
+	if backlog <= 0 {
+		backlog = DefaultBacklog
+	}
+	f = &follower{ch: make(chan *sqlite.WALCommit, backlog), overflow: make(chan struct{})}
+	p.mu.Lock()
+	if p.followers[file] == nil {
+		p.followers[file] = map[*follower]struct{}{}
+	}
+	p.followers[file][f] = struct{}{}
+	p.mu.Unlock()
+	var n int
+	_, err = rc.ExecContext(ctx, "begin")
+	if err == nil {
+		err = rc.QueryRowContext(ctx, "select count(*) from sqlite_master").Scan(&n)
+	}
+	if _, e := wc.ExecContext(context.Background(), "rollback"); e != nil && err == nil {
+		err = e
+	}
+	if err == nil {
+		err = rc.Raw(func(driverConn interface{}) error {
+			s, ok := driverConn.(interface{ Serialize(string) ([]byte, error) })
+			if !ok {
+				return fmt.Errorf("replication: unexpected driver connection %T", driverConn)
+			}
+
+			b, err = s.Serialize("main")
+			return err
+		})
+	}
+	rc.ExecContext(context.Background(), "rollback")
+	if err != nil {
+		p.remove(file, f)
+		return nil, "", nil, err
+	}
+
+	return f, file, b, nil
+}
+
+func writeSnapshot(w *bufio.Writer, b []byte) error {
+	pageSize := 0
+	if len(b) >= 100 {
+		pageSize = int(be.Uint16(b[16:]))
+		if pageSize == 1 {
+			pageSize = 65536
+		}
+	}
+	var hdr [1 + 4 + 8]byte
+	hdr[0] = kindSnapshot
+	be.PutUint32(hdr[1:], uint32(pageSize))
+	be.PutUint64(hdr[5:], uint64(len(b)))
+	w.WriteString(Magic)
+	w.Write(hdr[:])
+	_, err := w.Write(b)
+	return err
+}
+
+func writeCommit(w *bufio.Writer, c *sqlite.WALCommit) error {
+	var hdr [1 + 4 + 4 + 4]byte
+	hdr[0] = kindCommit
+	be.PutUint32(hdr[1:], uint32(c.PageSize))
+	be.PutUint32(hdr[5:], c.Frames[len(c.Frames)-1].Commit)
+	be.PutUint32(hdr[9:], uint32(len(c.Frames)))
+	w.Write(hdr[:])
+	for _, v := range c.Frames {
+		var page [4]byte
+		be.PutUint32(page[:], v.Page)
+		w.Write(page[:])
+		if _, err := w.Write(v.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
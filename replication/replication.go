@@ -0,0 +1,68 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package replication streams the transactions committed to a database of
+// modernc.org/sqlite to read-only replicas, for example to serve reads from
+// multiple machines.
+//
+// A Primary observes the write-ahead log of its databases using a VFS
+// registered by sqlite.RegisterWALVFS. A follower connecting to it first
+// receives a consistent snapshot of the database, then the pages written by
+// every committed transaction. A Follower writes them to a replica file which
+// any number of connections of the follower's process can read:
+//
+//	// Primary
+//	p, err := replication.NewPrimary("repl", "")
+//	db, err := sql.Open("sqlite3", "file:app.db?vfs=repl&_pragma=journal_mode(wal)")
+//	ln, err := net.Listen("tcp", ":7000")
+//	err = p.Serve(ln, db)
+//
+//	// Follower
+//	f, err := replication.NewFollower("replica.db")
+//	go func() {
+//		for {
+//			if c, err := net.Dial("tcp", "primary:7000"); err == nil {
+//				f.Follow(c)
+//				c.Close()
+//			}
+//			time.Sleep(time.Second)
+//		}
+//	}()
+//	db, err := sql.Open("sqlite3", "file:replica.db?mode=ro")
+//
+// The stream starts with a 16 byte magic header followed by messages. Every
+// message is a kind byte followed by big endian integers:
+//
+//	kind	fields
+//	'S'	page size (4), length N (8), N bytes of the database file
+//	'C'	page size (4), database size in pages (4), number of pages M (4),
+//		M times: page number (4), page content
+//
+// A Follower resynchronizes from a new snapshot every time Follow is called.
+// Transactions are applied to the replica one at a time, readers of the
+// replica never see a partially applied transaction. The replica is not
+// synced to stable storage, after a crash of the follower it is only usable
+// after the next snapshot. Replication is asynchronous: a transaction is sent
+// when it is committed, a primary can fail before a follower receives it.
+package replication // import "modernc.org/sqlite/replication"
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Magic is the header of a replication stream.
+const Magic = "SQLite repl 1\n\x00\x00"
+
+// Message kinds.
+const (
+	kindSnapshot = 'S'
+	kindCommit   = 'C'
+)
+
+// ErrProtocol is wrapped by the errors reporting a malformed replication
+// stream.
+var ErrProtocol = errors.New("replication protocol error")
+
+var be = binary.BigEndian
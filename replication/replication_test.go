@@ -0,0 +1,177 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package replication // import "modernc.org/sqlite/replication"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	primaryOnce sync.Once
+	primary     *Primary
+	primaryErr  error
+)
+
+// testPrimary returns the Primary of the tests, its VFS is registered once.
+func testPrimary(t *testing.T) *Primary {
+	primaryOnce.Do(func() { primary, primaryErr = NewPrimary("replication-test", "") })
+	if primaryErr != nil {
+		t.Fatal(primaryErr)
+	}
+
+	return primary
+}
+
+func exec(t *testing.T, db *sql.DB, sql string, args ...interface{}) {
+	if _, err := db.Exec(sql, args...); err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+}
+
+// content checks the integrity of db and returns the content of table t.
+func content(db *sql.DB) (string, error) {
+	var check string
+	if err := db.QueryRow("pragma integrity_check").Scan(&check); err != nil {
+		return "", err
+	}
+
+	if check != "ok" {
+		return "", errors.New(check)
+	}
+
+	var s sql.NullString
+	err := db.QueryRow("select group_concat(i || ':' || hex(b), ',') from (select * from t order by i)").Scan(&s)
+	return s.String, err
+}
+
+func TestReplication(t *testing.T) {
+	p := testPrimary(t)
+	tmp := t.TempDir()
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(tmp, "primary.db")+"?vfs=replication-test&_pragma=journal_mode(wal)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	exec(t, db, "create table t(i integer primary key, b blob)")
+	exec(t, db, "insert into t values(1, randomblob(10000))")
+
+	f, err := NewFollower(filepath.Join(tmp, "replica.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	rdb, err := sql.Open("sqlite3", "file:"+filepath.Join(tmp, "replica.db")+"?mode=ro&_pragma=busy_timeout(10000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rdb.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pc, fc := net.Pipe()
+	served := make(chan error, 1)
+	followed := make(chan error, 1)
+	go func() {
+		served <- p.ServeConn(ctx, pc, db)
+		pc.Close()
+	}()
+	go func() { followed <- f.Follow(fc) }()
+
+	// catchUp waits for the replica to catch up with the primary.
+	catchUp := func() {
+		want, err := content(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			got, err := content(rdb)
+			if err == nil && got == want {
+				return
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("replica did not catch up: %v\ngot  %.80s\nwant %.80s", err, got, want)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	catchUp()
+	for i := 2; i <= 20; i++ {
+		exec(t, db, "insert into t values(?, randomblob(?))", i, i*1000)
+	}
+	exec(t, db, "delete from t where i % 3 = 0")
+	catchUp()
+
+	// The WAL is restarted, the pages written after the checkpoint replace
+	// frames of the previous generation.
+	var busy, log, ckpt int
+	if err := db.QueryRow("pragma wal_checkpoint(truncate)").Scan(&busy, &log, &ckpt); err != nil || busy != 0 {
+		t.Fatal(busy, err)
+	}
+
+	exec(t, db, "update t set b = randomblob(500) where i < 10")
+	exec(t, db, "vacuum")
+	exec(t, db, "insert into t values(100, randomblob(70000))")
+	catchUp()
+
+	cancel()
+	if err := <-served; !errors.Is(err, context.Canceled) {
+		t.Fatalf("ServeConn: got %v, want %v", err, context.Canceled)
+	}
+
+	if err := <-followed; err == nil {
+		t.Fatal("Follow: unexpected success")
+	}
+
+	// A follower resuming gets a new snapshot.
+	exec(t, db, "delete from t where i > 10")
+	ctx, cancel = context.WithCancel(context.Background())
+
+	defer cancel()
+
+	pc, fc = net.Pipe()
+	go func() {
+		served <- p.ServeConn(ctx, pc, db)
+		pc.Close()
+	}()
+	go func() { followed <- f.Follow(fc) }()
+	catchUp()
+}
+
+func TestFollowProtocolError(t *testing.T) {
+	tmp := t.TempDir()
+	f, err := NewFollower(filepath.Join(tmp, "replica.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	for _, v := range []string{
+		"not a replication stream",
+		Magic + "X",
+		Magic + "S\x00\x00\x10\x00\x00\x00\x00\x00\x00\x00\x00\x64",
+		Magic + "C\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x01",
+	} {
+		if err := f.Follow(strings.NewReader(v)); !errors.Is(err, ErrProtocol) {
+			t.Errorf("%q: got %v, want %v", v, err, ErrProtocol)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// resultSets returns the rows of all the result sets of rows.
+func resultSets(t *testing.T, rows *sql.Rows) (r []string) {
+	for {
+		cols, err := rows.Columns()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var set []string
+		for rows.Next() {
+			dest := make([]interface{}, len(cols))
+			for i := range dest {
+				dest[i] = new(interface{})
+			}
+			if err := rows.Scan(dest...); err != nil {
+				t.Fatal(err)
+			}
+
+			var row []string
+			for _, v := range dest {
+				row = append(row, fmt.Sprint(*v.(*interface{})))
+			}
+			set = append(set, strings.Join(row, ","))
+		}
+		r = append(r, strings.Join(cols, ",")+": "+strings.Join(set, " "))
+		if !rows.NextResultSet() {
+			return r
+		}
+	}
+}
+
+func TestResultSets(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	// Statements without columns are run but produce no result set, an empty
+	// statement and a trailing comment are skipped.
+	rows, err := db.Query(`
+create table t(i);
+insert into t values(1), (2);
+select i from t order by i;
+;
+insert into t values(3);
+select count(*) as n, ? as arg from t;
+-- done`, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	if g, e := fmt.Sprint(resultSets(t, rows)), "[i: 1 2 n,arg: 3,x]"; g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A result set can be left before its last row.
+	if rows, err = db.Query("select 1 union all select 2; select 3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !rows.Next() || !rows.NextResultSet() {
+		t.Fatal(rows.Err())
+	}
+
+	if g, e := fmt.Sprint(resultSets(t, rows)), "[3: 3]"; g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+
+	rows.Close()
+}
+
+// TestResultSetsError checks an error of a later statement is reported by
+// Rows.Err after the preceding result sets were read.
+func TestResultSetsError(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	for _, v := range []struct {
+		sql string
+		err string
+	}{
+		{"select 1; select nonexistent", "no such column: nonexistent"},
+		{"select 1; select abs(-9223372036854775807 - 1)", "integer overflow"},
+	} {
+		rows, err := db.Query(v.sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if g, e := fmt.Sprint(resultSets(t, rows)), "[1: 1]"; g != e {
+			t.Errorf("%s: got %s, want %s", v.sql, g, e)
+		}
+
+		if err := rows.Err(); err == nil || !strings.Contains(err.Error(), v.err) {
+			t.Errorf("%s: got %v, want %q", v.sql, err, v.err)
+		}
+
+		rows.Close()
+	}
+
+	// The first statement fails the query.
+	if _, err := db.Query("select nonexistent; select 1"); err == nil {
+		t.Fatal("unexpected success")
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || netbsd || openbsd || freebsd
+// +build linux darwin netbsd openbsd freebsd
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSetMaxOpenFiles(t *testing.T) {
+	var lim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &lim); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lowering the hard limit to the soft limit needs no privileges and
+	// leaves the number of files the tests can open unchanged.
+	n := int64(lim.Cur)
+	if err := setMaxOpenFiles(n); err != nil {
+		t.Fatal(err)
+	}
+
+	var got unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if int64(got.Cur) != n || int64(got.Max) != n {
+		t.Fatalf("got %+v, want %d", got, n)
+	}
+}
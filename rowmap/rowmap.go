@@ -0,0 +1,294 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rowmap maps the rows of query results to Go structs and the fields
+// of structs to named statement parameters, without the need for a larger
+// library like sqlx for basic mapping.
+//
+// A struct field maps to the column or parameter named by its db tag, or, if
+// it has none, by its name in lower case. Fields tagged `db:"-"` and
+// unexported fields are ignored. The fields of embedded structs are mapped as
+// if they were fields of the outer struct, a field of the outer struct wins
+// over a field of the same name of an embedded struct. Column names are
+// matched ignoring case, they are the names reported by the driver: the
+// alias given by AS or, for a plain column reference, the name of the
+// column, so expressions like count(*) need an alias.
+//
+// A column of a declared type like DATE or DATETIME holding text produces
+// time.Time values, the text of other columns is converted to a time.Time
+// field if it is in one of the formats the driver writes or that SQLite's
+// date and time functions produce. Integers are converted to a time.Time
+// field as Unix times in seconds and NULL to the zero time.
+package rowmap // import "modernc.org/sqlite/rowmap"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Execer is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type field struct {
+	name  string // Column name, as tagged.
+	index []int  // For reflect.Value.FieldByIndex.
+}
+
+// structMap lists the mapped fields of a struct type.
+type structMap struct {
+	fields []field
+	byName map[string]*field // Lower case name: field.
+}
+
+var structMaps sync.Map // reflect.Type: *structMap
+
+func structMapOf(t reflect.Type) *structMap {
+	if m, ok := structMaps.Load(t); ok {
+		return m.(*structMap)
+	}
+
+	m := &structMap{byName: map[string]*field{}}
+	m.add(t, nil)
+	for i := range m.fields {
+		m.byName[strings.ToLower(m.fields[i].name)] = &m.fields[i]
+	}
+	structMaps.Store(t, m)
+	return m
+}
+
+// add adds the fields of t, reached by index, which are not shadowed by the
+// fields already added.
+func (m *structMap) add(t reflect.Type, index []int) {
+	var embedded []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, tagged := f.Tag.Lookup("db")
+		switch {
+		case tag == "-":
+			continue
+		case f.Anonymous && !tagged && f.Type.Kind() == reflect.Struct:
+			embedded = append(embedded, i)
+			continue
+		case f.PkgPath != "": // Unexported.
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if m.has(name) {
+			continue
+		}
+
+		m.fields = append(m.fields, field{name, append(append([]int(nil), index...), i)})
+	}
+	for _, i := range embedded {
+		m.add(t.Field(i).Type, append(append([]int(nil), index...), i))
+	}
+}
+
+func (m *structMap) has(name string) bool {
+	for _, v := range m.fields {
+		if strings.EqualFold(v.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// structValue returns the struct pointed to by dest.
+func structValue(dest interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("rowmap: destination %T is not a non-nil pointer to a struct", dest)
+	}
+
+	return v.Elem(), nil
+}
+
+// scanner scans the rows of a result into structs of one type.
+type scanner struct {
+	fields  []*field
+	targets []interface{}
+}
+
+func newScanner(rows *sql.Rows, t reflect.Type) (*scanner, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	m := structMapOf(t)
+	s := &scanner{fields: make([]*field, len(cols)), targets: make([]interface{}, len(cols))}
+	for i, v := range cols {
+		if s.fields[i] = m.byName[strings.ToLower(v)]; s.fields[i] == nil {
+			return nil, fmt.Errorf("rowmap: column %q has no field in %v", v, t)
+		}
+	}
+	return s, nil
+}
+
+func (s *scanner) scan(rows *sql.Rows, v reflect.Value) error {
+	for i, f := range s.fields {
+		p := v.FieldByIndex(f.index).Addr().Interface()
+		if tm, ok := p.(*time.Time); ok {
+			p = (*timeScanner)(tm)
+		}
+		s.targets[i] = p
+	}
+	return rows.Scan(s.targets...)
+}
+
+// ScanStruct copies the columns of the current row of rows into the fields
+// of the struct pointed to by dest. Every column must map to a field, fields
+// without a column are left unchanged.
+func ScanStruct(rows *sql.Rows, dest interface{}) error {
+	v, err := structValue(dest)
+	if err != nil {
+		return err
+	}
+
+	s, err := newScanner(rows, v.Type())
+	if err != nil {
+		return err
+	}
+
+	return s.scan(rows, v)
+}
+
+// ScanAll appends all the remaining rows of rows, as by ScanStruct, to the
+// slice of structs, or of pointers to structs, pointed to by dest and closes
+// rows.
+func ScanAll(rows *sql.Rows, dest interface{}) error {
+	defer rows.Close()
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("rowmap: destination %T is not a non-nil pointer to a slice", dest)
+	}
+
+	slice := v.Elem()
+	elem := slice.Type().Elem()
+	t := elem
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("rowmap: destination %T is not a pointer to a slice of structs", dest)
+	}
+
+	s, err := newScanner(rows, t)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		p := reflect.New(t)
+		if err := s.scan(rows, p.Elem()); err != nil {
+			return err
+		}
+
+		if elem.Kind() == reflect.Ptr {
+			slice = reflect.Append(slice, p)
+		} else {
+			slice = reflect.Append(slice, p.Elem())
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	v.Elem().Set(slice)
+	return rows.Close()
+}
+
+// NamedArgs returns the fields of the struct v, or of the struct pointed to
+// by v, as sql.NamedArg values. The names can be used as :name, @name or
+// $name parameters of a statement. Parameter names are case sensitive and
+// must match the field names given by the db tag or the lower case field
+// names. Arguments not used by a statement are ignored by the driver.
+func NamedArgs(v interface{}) ([]interface{}, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("rowmap: argument %T is not a struct or a pointer to a struct", v)
+	}
+
+	m := structMapOf(rv.Type())
+	r := make([]interface{}, len(m.fields))
+	for i, f := range m.fields {
+		r[i] = sql.Named(f.name, rv.FieldByIndex(f.index).Interface())
+	}
+	return r, nil
+}
+
+// NamedExecStruct executes query with the fields of the struct v, or of the
+// struct pointed to by v, as its named parameters, see NamedArgs. For example
+//
+//	_, err := rowmap.NamedExecStruct(ctx, db, "insert into users(name, email) values(:name, :email)", &user)
+func NamedExecStruct(ctx context.Context, e Execer, query string, v interface{}) (sql.Result, error) {
+	args, err := NamedArgs(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.ExecContext(ctx, query, args...)
+}
+
+// timeFormats are the formats of the text converted to time.Time, the ones
+// the driver parses in DATE, DATETIME and TIMESTAMP columns.
+var timeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01-02 15:04:05.999999999 -0700 MST", // time.Time.String
+}
+
+// timeScanner scans a time.Time field.
+type timeScanner time.Time
+
+// Scan implements sql.Scanner.
+func (t *timeScanner) Scan(v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		*t = timeScanner{}
+		return nil
+	case time.Time:
+		*t = timeScanner(x)
+		return nil
+	case int64:
+		*t = timeScanner(time.Unix(x, 0).UTC())
+		return nil
+	case []byte:
+		return t.Scan(string(x))
+	case string:
+		s := strings.TrimSuffix(strings.TrimSpace(x), "Z")
+		if i := strings.Index(s, " m="); i >= 0 { // Monotonic clock reading of time.Time.String.
+			s = s[:i]
+		}
+		for _, f := range timeFormats {
+			if tm, err := time.Parse(f, s); err == nil {
+				*t = timeScanner(tm)
+				return nil
+			}
+		}
+		return fmt.Errorf("rowmap: cannot parse %q as time", x)
+	default:
+		return fmt.Errorf("rowmap: cannot scan %T into time.Time", v)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rowmap_test // import "modernc.org/sqlite/rowmap"
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+	"modernc.org/sqlite/rowmap"
+)
+
+type base struct {
+	ID      int64
+	Created time.Time `db:"created_at"`
+}
+
+type user struct {
+	base
+	Name   string
+	Email  sql.NullString `db:"mail"`
+	Score  float64
+	Secret string `db:"-"`
+	hidden int
+}
+
+func TestRowmap(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table users(id integer primary key, created_at datetime, name text, mail text, score real)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	created := time.Date(2022, 11, 16, 10, 20, 30, 0, time.UTC)
+	const insert = "insert into users(id, created_at, name, mail, score) values(:id, :created_at, @name, $mail, :score)"
+	for i, name := range []string{"alice", "bob"} {
+		u := user{base: base{ID: int64(i + 1), Created: created}, Name: name, Score: 1.5, Secret: "x"}
+		if name == "alice" {
+			u.Email = sql.NullString{String: "alice@example.com", Valid: true}
+		}
+		if _, err := rowmap.NamedExecStruct(ctx, db, insert, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := db.Query("select ID, created_at, name, mail, score from users order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+
+	var u user
+	if err := rowmap.ScanStruct(rows, &u); err != nil {
+		t.Fatal(err)
+	}
+
+	rows.Close()
+	if u.ID != 1 || !u.Created.Equal(created) || u.Name != "alice" || u.Email.String != "alice@example.com" || u.Score != 1.5 || u.Secret != "" {
+		t.Fatalf("%+v", u)
+	}
+
+	if rows, err = db.Query("select *, ? as created_at from users order by id", created.Unix()); err != nil {
+		t.Fatal(err)
+	}
+
+	var all []*user
+	if err := rowmap.ScanAll(rows, &all); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 2 || all[1].Name != "bob" || all[1].Email.Valid || !all[1].Created.Equal(created) {
+		t.Fatalf("%+v", all)
+	}
+
+	if rows, err = db.Query("select id, count(*) from users"); err != nil {
+		t.Fatal(err)
+	}
+
+	var none []user
+	if err := rowmap.ScanAll(rows, &none); err == nil || !strings.Contains(err.Error(), "count(*)") {
+		t.Fatalf("got %v, want an error naming the unmapped column", err)
+	}
+}
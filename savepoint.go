@@ -0,0 +1,101 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var savepointSeq int64
+
+// Savepoint starts a new savepoint named name. Outside of a transaction it
+// also starts a transaction, which is committed by releasing the savepoint.
+// See https://www.sqlite.org/lang_savepoint.html.
+//
+// Savepoint, Release and RollbackTo can be reached using (*sql.Conn).Raw.
+func (c *conn) Savepoint(name string) error {
+	_, err := c.exec(context.Background(), "savepoint "+quoteIdentifier(name), nil)
+	return err
+}
+
+// Release releases the savepoint named name and all the savepoints started
+// after it. Releasing the outermost savepoint commits the transaction it
+// started.
+func (c *conn) Release(name string) error {
+	_, err := c.exec(context.Background(), "release "+quoteIdentifier(name), nil)
+	return err
+}
+
+// RollbackTo reverts the database to the state it had when the savepoint
+// named name was started. The savepoint itself remains active.
+func (c *conn) RollbackTo(name string) error {
+	_, err := c.exec(context.Background(), "rollback to "+quoteIdentifier(name), nil)
+	return err
+}
+
+// int sqlite3_get_autocommit(sqlite3*);
+func (c *conn) autocommit() bool {
+	return sqlite3.Xsqlite3_get_autocommit(c.tls, c.db) != 0
+}
+
+// WithTx runs fn in a transaction on sc. The transaction is committed if fn
+// returns nil and rolled back if fn returns an error or panics.
+//
+// If sc is already in a transaction, for example because the caller of
+// WithTx is itself running in WithTx, fn runs in a savepoint nested in the
+// current transaction instead. An error returned by fn then reverts only the
+// changes made by fn and the enclosing transaction remains usable.
+//
+// fn is expected to use sc for its database operations.
+func WithTx(ctx context.Context, sc *sql.Conn, fn func(ctx context.Context) error) (err error) {
+	var inTx bool
+	var beginMode string
+	if err := sc.Raw(func(dc interface{}) error {
+		c, ok := dc.(*conn)
+		if !ok {
+			return fmt.Errorf("sqlite: WithTx: unsupported driver connection %T", dc)
+		}
+
+		inTx = !c.autocommit()
+		beginMode = c.beginMode
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	begin, commit, rollback := "begin "+beginMode, "commit", "rollback"
+	if inTx {
+		name := quoteIdentifier(fmt.Sprintf("sqlite_withtx_%d", atomic.AddInt64(&savepointSeq, 1)))
+		begin, commit, rollback = "savepoint "+name, "release "+name, "rollback to "+name+"; release "+name
+	}
+
+	if _, err = sc.ExecContext(ctx, begin); err != nil {
+		return err
+	}
+
+	defer func() {
+		if e := recover(); e != nil {
+			sc.ExecContext(context.Background(), rollback)
+			panic(e)
+		}
+
+		if err == nil {
+			if _, err = sc.ExecContext(ctx, commit); err == nil {
+				return
+			}
+		}
+
+		if _, e := sc.ExecContext(context.Background(), rollback); e != nil {
+			err = fmt.Errorf("%w (rollback: %v)", err, e)
+		}
+	}()
+
+	return fn(ctx)
+}
@@ -0,0 +1,238 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func savepointRows(t *testing.T, sc *sql.Conn) string {
+	rows, err := sc.QueryContext(context.Background(), "select i from t order by i")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	var a []int
+	for rows.Next() {
+		var i int
+		if err := rows.Scan(&i); err != nil {
+			t.Fatal(err)
+		}
+
+		a = append(a, i)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprint(a)
+}
+
+func savepointConn(t *testing.T) (*sql.DB, *sql.Conn) {
+	db := openMemory(t)
+	sc, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	if _, err := sc.ExecContext(context.Background(), "create table t(i)"); err != nil {
+		sc.Close()
+		db.Close()
+		t.Fatal(err)
+	}
+
+	return db, sc
+}
+
+func TestSavepoint(t *testing.T) {
+	db, sc := savepointConn(t)
+
+	defer db.Close()
+
+	defer sc.Close()
+
+	ctx := context.Background()
+	exec := func(s string) {
+		if _, err := sc.ExecContext(ctx, s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+	raw := func(f func(*conn) error) error {
+		return sc.Raw(func(dc interface{}) error { return f(dc.(*conn)) })
+	}
+	if err := raw(func(c *conn) error { return c.Savepoint("a") }); err != nil {
+		t.Fatal(err)
+	}
+
+	exec("insert into t values(1)")
+	if err := raw(func(c *conn) error { return c.Savepoint(`b"`) }); err != nil {
+		t.Fatal(err)
+	}
+
+	exec("insert into t values(2)")
+	if err := raw(func(c *conn) error { return c.RollbackTo(`b"`) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := savepointRows(t, sc), "[1]"; g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+
+	exec("insert into t values(3)")
+	if err := raw(func(c *conn) error {
+		if err := c.Release("a"); err != nil {
+			return err
+		}
+
+		if !c.autocommit() {
+			t.Fatal("transaction not committed by releasing the outermost savepoint")
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := savepointRows(t, sc), "[1 3]"; g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+
+	if err := raw(func(c *conn) error { return c.Release("a") }); err == nil || !strings.Contains(err.Error(), "no such savepoint") {
+		t.Fatalf("got %v, want no such savepoint", err)
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	db, sc := savepointConn(t)
+
+	defer db.Close()
+
+	defer sc.Close()
+
+	ctx := context.Background()
+	insert := func(i int) func(context.Context) error {
+		return func(ctx context.Context) error {
+			_, err := sc.ExecContext(ctx, "insert into t values(?)", i)
+			return err
+		}
+	}
+	errTest := errors.New("test")
+
+	if err := WithTx(ctx, sc, insert(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WithTx(ctx, sc, func(ctx context.Context) error {
+		if err := insert(2)(ctx); err != nil {
+			return err
+		}
+
+		return errTest
+	}); err != errTest {
+		t.Fatalf("got %v, want %v", err, errTest)
+	}
+
+	if g, e := savepointRows(t, sc), "[1]"; g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+
+	// A failing nested WithTx reverts its own changes only.
+	if err := WithTx(ctx, sc, func(ctx context.Context) error {
+		if err := insert(3)(ctx); err != nil {
+			return err
+		}
+
+		if err := WithTx(ctx, sc, insert(4)); err != nil {
+			return err
+		}
+
+		if err := WithTx(ctx, sc, func(ctx context.Context) error {
+			if err := insert(5)(ctx); err != nil {
+				return err
+			}
+
+			return errTest
+		}); err != errTest {
+			return fmt.Errorf("nested: got %v, want %v", err, errTest)
+		}
+
+		return insert(6)(ctx)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := savepointRows(t, sc), "[1 3 4 6]"; g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+
+	// The error of fn is kept when the rollback fails.
+	err := WithTx(ctx, sc, func(ctx context.Context) error {
+		if _, err := sc.ExecContext(ctx, "commit"); err != nil {
+			return err
+		}
+
+		return errTest
+	})
+	if !errors.Is(err, errTest) || !strings.Contains(err.Error(), "rollback:") {
+		t.Fatalf("got %v, want %v and the rollback error", err, errTest)
+	}
+}
+
+func TestWithTxPanic(t *testing.T) {
+	db, sc := savepointConn(t)
+
+	defer db.Close()
+
+	defer sc.Close()
+
+	ctx := context.Background()
+	for _, nested := range []bool{false, true} {
+		func() {
+			defer func() {
+				if e := recover(); e != "test" {
+					t.Fatalf("got %v, want the panic of fn", e)
+				}
+			}()
+
+			WithTx(ctx, sc, func(ctx context.Context) error {
+				if _, err := sc.ExecContext(ctx, "insert into t values(1)"); err != nil {
+					return err
+				}
+
+				if nested {
+					return WithTx(ctx, sc, func(ctx context.Context) error {
+						if _, err := sc.ExecContext(ctx, "insert into t values(2)"); err != nil {
+							return err
+						}
+
+						panic("test")
+					})
+				}
+
+				panic("test")
+			})
+		}()
+
+		var autocommit bool
+		if err := sc.Raw(func(dc interface{}) error {
+			autocommit = dc.(*conn).autocommit()
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if g := savepointRows(t, sc); g != "[]" || !autocommit {
+			t.Fatalf("nested %v: got %s, %v, want no rows and no transaction", nested, g, autocommit)
+		}
+	}
+}
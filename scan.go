@@ -0,0 +1,154 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// scanMode selects the conversions Next applies to the values of a row, see
+// the _scan query parameter of Driver.Open.
+type scanMode int
+
+const (
+	scanStorage  scanMode = iota // Values as stored.
+	scanAffinity                 // Converted to the declared type if possible.
+	scanStrict                   // Converted to the declared type or an error.
+)
+
+// setScan handles the _scan query parameter.
+func (c *conn) setScan(v string) error {
+	switch strings.ToLower(v) {
+	case "storage":
+		c.scan = scanStorage
+	case "affinity":
+		c.scan = scanAffinity
+	case "strict":
+		c.scan = scanStrict
+	default:
+		return fmt.Errorf("unknown _scan %q", v)
+	}
+	return nil
+}
+
+// setTextBytes handles the _text_bytes query parameter.
+func (c *conn) setTextBytes(v string) error {
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid _text_bytes %q", v)
+	}
+
+	c.textBytes = on
+	return nil
+}
+
+// columnKind is the type a declared column type converts the values of a
+// column to, see scanValue.
+type columnKind int
+
+const (
+	kindAny columnKind = iota
+	kindBool
+	kindInt
+	kindFloat
+)
+
+// declKind returns the kind of a column of declared type decl, following the
+// column affinity rules of
+// https://www.sqlite.org/datatype3.html#determination_of_column_affinity.
+// Columns of TEXT, BLOB and NUMERIC affinity, date and time columns and
+// expressions are of kindAny: SQLite already converts the text stored in a
+// NUMERIC column to a number when that is lossless.
+func declKind(decl string) columnKind {
+	switch decl = strings.ToUpper(decl); {
+	case decl == "BOOLEAN" || decl == "BOOL":
+		return kindBool
+	case decl == "DATE" || decl == "DATETIME" || decl == "TIME" || decl == "TIMESTAMP":
+		return kindAny
+	case strings.Contains(decl, "INT"):
+		return kindInt
+	case strings.Contains(decl, "CHAR") || strings.Contains(decl, "CLOB") || strings.Contains(decl, "TEXT") || strings.Contains(decl, "BLOB"):
+		return kindAny
+	case strings.Contains(decl, "REAL") || strings.Contains(decl, "FLOA") || strings.Contains(decl, "DOUB"):
+		return kindFloat
+	default:
+		return kindAny
+	}
+}
+
+// scanValue converts v, the value of column i, for the _scan query parameter.
+func (r *rows) scanValue(i int, v driver.Value) (driver.Value, error) {
+	if r.kinds == nil {
+		r.kinds = make([]columnKind, len(r.columns))
+		for j := range r.kinds {
+			r.kinds[j] = declKind(r.c.columnDeclType(r.pstmt, j))
+		}
+	}
+
+	k := r.kinds[i]
+	if k == kindAny || v == nil {
+		return v, nil
+	}
+
+	if w, ok := convertKind(k, v); ok {
+		return w, nil
+	}
+
+	if r.c.scan == scanStrict {
+		return nil, fmt.Errorf("sqlite: column %q of type %s: cannot convert %T value %v", r.columns[i], r.c.columnDeclType(r.pstmt, i), v, v)
+	}
+
+	return v, nil
+}
+
+// convertKind converts v to the type of kind k and reports whether it was
+// possible without losing information.
+func convertKind(k columnKind, v driver.Value) (driver.Value, bool) {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	switch k {
+	case kindBool:
+		switch x := v.(type) {
+		case int64:
+			return x != 0, true
+		case float64:
+			return x != 0, true
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(x)); err == nil {
+				return b, true
+			}
+		}
+	case kindInt:
+		switch x := v.(type) {
+		case int64:
+			return x, true
+		case float64:
+			if x == math.Trunc(x) && x >= math.MinInt64 && x < math.MaxInt64 {
+				return int64(x), true
+			}
+		case string:
+			if n, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64); err == nil {
+				return n, true
+			}
+		}
+	case kindFloat:
+		switch x := v.(type) {
+		case int64:
+			return float64(x), true
+		case float64:
+			return x, true
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(x), 64); err == nil {
+				return f, true
+			}
+		}
+	}
+	return nil, false
+}
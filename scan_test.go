@@ -0,0 +1,182 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanAffinity(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+create table t(i integer, r real, b boolean, s text);
+insert into t values(1.5, 'x', 'true', 'a');
+insert into t values(' 7 ', ' 2.5 ', 2, '');
+insert into t values(null, 3, 0.0, 'c');
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+	if db, err = sql.Open(driverName, name+"?_scan=affinity"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("select i, r, b from t order by rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []interface{}
+	for rows.Next() {
+		var i, r, b interface{}
+		if err := rows.Scan(&i, &r, &b); err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, i, r, b)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []interface{}{1.5, "x", true, int64(7), 2.5, true, nil, 3.0, false}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %#v, want %#v", got, want)
+		}
+	}
+
+	var ok bool
+	var f float32
+	if err := db.QueryRow("select b, r from t where rowid = 2").Scan(&ok, &f); err != nil || !ok || f != 2.5 {
+		t.Fatalf("%v, %v, %v", ok, f, err)
+	}
+
+	db.Close()
+	if db, err = sql.Open(driverName, name+"?_scan=strict&_text_bytes=1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows, err = db.Query("select i, s from t where rowid = 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int64
+	var s sql.RawBytes
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+
+	if err := rows.Scan(&n, &s); err != nil || n != 7 || s == nil || len(s) != 0 {
+		t.Fatalf("%v, %q, %v", n, s, err)
+	}
+
+	rows.Close()
+
+	if err := db.QueryRow("select i from t where rowid = 1").Scan(&n); err == nil || !strings.Contains(err.Error(), `column "i"`) {
+		t.Fatalf("got %v, want an error naming column i", err)
+	}
+
+	var v interface{}
+	if err := db.QueryRow("select s from t where rowid = 3").Scan(&v); err != nil || string(v.([]byte)) != "c" {
+		t.Fatalf("%#v, %v", v, err)
+	}
+
+	db.Close()
+	if db, err = sql.Open(driverName, name+"?_scan=loose"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Ping(); err == nil || !strings.Contains(err.Error(), "_scan") {
+		t.Fatalf("got %v, want an error about _scan", err)
+	}
+}
+
+// TestTextBytesInternal checks the queries of the package itself read text as
+// string with _text_bytes and _scan set.
+func TestTextBytesInternal(t *testing.T) {
+	if err := RegisterChecksumVFS("test-cksm-text-bytes", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, "file:"+uriEscape(name)+"?vfs=test-cksm-text-bytes&_text_bytes=1&_scan=strict")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i integer primary key, s text, b bool)"); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if err := c.Raw(func(dc interface{}) error {
+		cn := dc.(*conn)
+		if mode, err := cn.JournalMode(); err != nil || mode != "delete" {
+			t.Fatalf("JournalMode: %q %v", mode, err)
+		}
+
+		if err := cn.EnableChecksums(); err != nil {
+			t.Fatalf("EnableChecksums: %v", err)
+		}
+
+		if mode, err := cn.SetJournalMode("wal"); err != nil || mode != "wal" {
+			t.Fatalf("SetJournalMode: %q %v", mode, err)
+		}
+
+		r, err := cn.Pragma("table_info", "t")
+		if err != nil || len(r) != 3 {
+			t.Fatalf("Pragma: %v %v", r, err)
+		}
+
+		if s, ok := r[1][1].(string); !ok || s != "s" {
+			t.Fatalf("Pragma: got %#v, want string", r[1][1])
+		}
+
+		names, ipk, err := cn.tableColumns("t")
+		if g, e := fmt.Sprint(names, ipk, err), "[i s b] 0 <nil>"; g != e {
+			t.Fatalf("tableColumns: got %s, want %s", g, e)
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// User queries still return []byte.
+	var v interface{}
+	if err := c.QueryRowContext(context.Background(), "select 'x'").Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := v.([]byte); !ok {
+		t.Fatalf("got %T, want []byte", v)
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package schema reports the structure of SQLite databases: their tables and
+// views, columns, indexes and foreign keys. It is built on the schema pragmas
+// of SQLite, see https://www.sqlite.org/pragma.html#pragfunc, and works with
+// any database/sql handle of a modernc.org/sqlite database.
+//
+// In all functions, schema selects the database of the connection, "main",
+// "temp" or the name of an attached database. If it is empty, the table is
+// looked up like an unqualified table name in SQL, searching temp, main and
+// then the attached databases.
+package schema // import "modernc.org/sqlite/schema"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Queryer is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Table describes a table or a view.
+type Table struct {
+	Schema       string
+	Name         string
+	Type         string // "table", "view", "virtual" or "shadow".
+	Columns      int    // Number of columns, including hidden ones.
+	WithoutRowid bool
+	Strict       bool
+}
+
+// Column describes a column of a table or view.
+type Column struct {
+	Name       string
+	Type       string         // The declared type, may be empty.
+	NotNull    bool           //
+	Default    sql.NullString // The default value as an SQL expression.
+	PrimaryKey int            // 1-based position in the primary key, 0 if not part of it.
+	Hidden     int            // 1 hidden column of a virtual table, 2 virtual and 3 stored generated column.
+}
+
+// Index describes an index of a table.
+type Index struct {
+	Name    string
+	Unique  bool
+	Origin  string // "c" created by CREATE INDEX, "u" by a UNIQUE and "pk" by a PRIMARY KEY constraint.
+	Partial bool
+	Columns []IndexColumn
+}
+
+// IndexColumn describes a key column of an index.
+type IndexColumn struct {
+	Name      string // Empty for an expression.
+	Desc      bool
+	Collation string
+}
+
+// ForeignKey describes a foreign key constraint of a table.
+type ForeignKey struct {
+	ID       int
+	Table    string   // The parent table.
+	From     []string // The child key columns.
+	To       []string // The parent key columns, empty if referring to the primary key of Table.
+	OnUpdate string   // The action, like "NO ACTION" or "CASCADE".
+	OnDelete string
+	Match    string
+}
+
+// schemaArg returns the schema argument of a pragma function.
+func schemaArg(schema string) interface{} {
+	if schema == "" {
+		return nil
+	}
+
+	return schema
+}
+
+// Tables returns the tables and views of the database schema, or of all the
+// databases if schema is empty. The internal tables of SQLite, like
+// sqlite_schema, are not included.
+func Tables(ctx context.Context, q Queryer, schema string) (r []Table, err error) {
+	rows, err := q.QueryContext(ctx, "select schema, name, type, ncol, wr, strict from pragma_table_list where (?1 is null or schema = ?1) and name not like 'sqlite!_%' escape '!' order by schema = 'temp', schema != 'main', schema, name", schemaArg(schema))
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table: pragma_table_list") {
+			// SQLite before 3.37.0, like the one of windows/386.
+			return masterTables(ctx, q, schema)
+		}
+
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var t Table
+		if err := rows.Scan(&t.Schema, &t.Name, &t.Type, &t.Columns, &t.WithoutRowid, &t.Strict); err != nil {
+			return nil, err
+		}
+
+		r = append(r, t)
+	}
+	return r, rows.Err()
+}
+
+// masterTables implements Tables using the sqlite_master tables of the
+// databases, for SQLite versions without pragma_table_list. They have no
+// STRICT tables. A table is reported as a shadow table if its name is the
+// name of a virtual table of the same database followed by an underscore and
+// a suffix.
+func masterTables(ctx context.Context, q Queryer, schema string) (r []Table, err error) {
+	schemas, err := databases(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range schemas {
+		if schema != "" && name != schema {
+			continue
+		}
+
+		rows, err := q.QueryContext(ctx, fmt.Sprintf("select name, type, sql from %s.sqlite_master where type in ('table', 'view') and name not like 'sqlite!_%%' escape '!' order by name", quoteIdentifier(name)))
+		if err != nil {
+			return nil, err
+		}
+
+		var tables []Table
+		var virtual []string
+		for rows.Next() {
+			var stmt sql.NullString
+			t := Table{Schema: name}
+			if err := rows.Scan(&t.Name, &t.Type, &stmt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			if t.Type == "table" {
+				switch ddl := strings.ToLower(stmt.String); {
+				case strings.HasPrefix(ddl, "create virtual table"):
+					t.Type = "virtual"
+					virtual = append(virtual, strings.ToLower(t.Name)+"_")
+				default:
+					t.WithoutRowid = withoutRowid(ddl)
+				}
+			}
+			tables = append(tables, t)
+		}
+		err = rows.Err()
+		// Closing rows first allows q to be a *sql.Conn or *sql.Tx.
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range tables {
+			t := &tables[i]
+			for _, prefix := range virtual {
+				if t.Type == "table" && strings.HasPrefix(strings.ToLower(t.Name), prefix) {
+					t.Type = "shadow"
+				}
+			}
+			if t.Columns, err = columnCount(ctx, q, name, t.Name); err != nil {
+				return nil, err
+			}
+		}
+		r = append(r, tables...)
+	}
+	return r, nil
+}
+
+// databases returns the names of the databases of the connection in the
+// order of Tables.
+func databases(ctx context.Context, q Queryer) (r []string, err error) {
+	rows, err := q.QueryContext(ctx, "select name from pragma_database_list order by name = 'temp', name != 'main', name")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		r = append(r, name)
+	}
+	return r, rows.Err()
+}
+
+func columnCount(ctx context.Context, q Queryer, schema, table string) (n int, err error) {
+	rows, err := q.QueryContext(ctx, "select count(*) from pragma_table_xinfo(?, ?)", table, schema)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	if rows.Next() {
+		err = rows.Scan(&n)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	return n, err
+}
+
+// withoutRowid reports whether the table options following the column
+// definitions of the lower case CREATE TABLE statement ddl include WITHOUT
+// ROWID.
+func withoutRowid(ddl string) bool {
+	return strings.Contains(" "+strings.Join(strings.Fields(strings.Replace(ddl[strings.LastIndex(ddl, ")")+1:], ",", " , ", -1)), " ")+" ", " without rowid ")
+}
+
+func quoteIdentifier(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// Columns returns the columns of table, in order.
+func Columns(ctx context.Context, q Queryer, schema, table string) (r []Column, err error) {
+	rows, err := q.QueryContext(ctx, "select name, type, \"notnull\", dflt_value, pk, hidden from pragma_table_xinfo(?, ?) order by cid", table, schemaArg(schema))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Column
+		if err := rows.Scan(&c.Name, &c.Type, &c.NotNull, &c.Default, &c.PrimaryKey, &c.Hidden); err != nil {
+			return nil, err
+		}
+
+		r = append(r, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if r == nil {
+		return nil, noTable(schema, table)
+	}
+
+	return r, nil
+}
+
+// Indexes returns the indexes of table.
+func Indexes(ctx context.Context, q Queryer, schema, table string) (r []Index, err error) {
+	rows, err := q.QueryContext(ctx, "select name, \"unique\", origin, partial from pragma_index_list(?, ?) order by seq desc", table, schemaArg(schema))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var x Index
+		if err := rows.Scan(&x.Name, &x.Unique, &x.Origin, &x.Partial); err != nil {
+			return nil, err
+		}
+
+		r = append(r, x)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Closing rows first allows q to be a *sql.Conn or *sql.Tx.
+	rows.Close()
+	for i := range r {
+		if r[i].Columns, err = indexColumns(ctx, q, schema, r[i].Name); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func indexColumns(ctx context.Context, q Queryer, schema, index string) (r []IndexColumn, err error) {
+	rows, err := q.QueryContext(ctx, "select name, desc, coll from pragma_index_xinfo(?, ?) where key order by seqno", index, schemaArg(schema))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var c IndexColumn
+		var name sql.NullString
+		if err := rows.Scan(&name, &c.Desc, &c.Collation); err != nil {
+			return nil, err
+		}
+
+		c.Name = name.String
+		r = append(r, c)
+	}
+	return r, rows.Err()
+}
+
+// ForeignKeys returns the foreign key constraints of table.
+func ForeignKeys(ctx context.Context, q Queryer, schema, table string) (r []ForeignKey, err error) {
+	rows, err := q.QueryContext(ctx, "select id, \"table\", \"from\", \"to\", on_update, on_delete, match from pragma_foreign_key_list(?, ?) order by id desc, seq", table, schemaArg(schema))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var fk ForeignKey
+		var from string
+		var to sql.NullString
+		if err := rows.Scan(&fk.ID, &fk.Table, &from, &to, &fk.OnUpdate, &fk.OnDelete, &fk.Match); err != nil {
+			return nil, err
+		}
+
+		if n := len(r); n == 0 || r[n-1].ID != fk.ID {
+			r = append(r, fk)
+		}
+		last := &r[len(r)-1]
+		last.From = append(last.From, from)
+		if to.Valid {
+			last.To = append(last.To, to.String)
+		}
+	}
+	return r, rows.Err()
+}
+
+func noTable(schema, table string) error {
+	if schema != "" {
+		table = schema + "." + table
+	}
+	return fmt.Errorf("schema: no such table: %s", table)
+}
@@ -0,0 +1,193 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schema // import "modernc.org/sqlite/schema"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func testDB(t *testing.T) (*sql.Conn, func()) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	if _, err := c.ExecContext(ctx, `
+attach ':memory:' as aux;
+create table p(a integer primary key, b text not null default 'x', unique(b));
+create table c(
+	i int,
+	j,
+	k as (i+1),
+	foreign key(i, j) references p(a, b) on delete cascade,
+	foreign key(j) references p
+);
+create index c_ij on c(i desc, j collate nocase) where i > 0;
+create index c_expr on c(i+j);
+create table w(k primary key, v) without rowid;
+create table "w2"(k primary key,v)WITHOUT  ROWID;
+create view v as select * from p;
+create virtual table f using fts5(x);
+create temp table t(x);
+create table aux.a(x);
+`); err != nil {
+		c.Close()
+		db.Close()
+		t.Fatal(err)
+	}
+
+	return c, func() {
+		c.Close()
+		db.Close()
+	}
+}
+
+func TestTables(t *testing.T) {
+	c, done := testDB(t)
+
+	defer done()
+
+	ctx := context.Background()
+	all := []Table{
+		{Schema: "main", Name: "c", Type: "table", Columns: 3},
+		{Schema: "main", Name: "f", Type: "virtual", Columns: 3},
+		{Schema: "main", Name: "f_config", Type: "shadow", Columns: 2, WithoutRowid: true},
+		{Schema: "main", Name: "f_content", Type: "shadow", Columns: 2},
+		{Schema: "main", Name: "f_data", Type: "shadow", Columns: 2},
+		{Schema: "main", Name: "f_docsize", Type: "shadow", Columns: 2},
+		{Schema: "main", Name: "f_idx", Type: "shadow", Columns: 3, WithoutRowid: true},
+		{Schema: "main", Name: "p", Type: "table", Columns: 2},
+		{Schema: "main", Name: "v", Type: "view", Columns: 2},
+		{Schema: "main", Name: "w", Type: "table", Columns: 2, WithoutRowid: true},
+		{Schema: "main", Name: "w2", Type: "table", Columns: 2, WithoutRowid: true},
+		{Schema: "aux", Name: "a", Type: "table", Columns: 1},
+		{Schema: "temp", Name: "t", Type: "table", Columns: 1},
+	}
+	for _, f := range []struct {
+		name string
+		fn   func(context.Context, Queryer, string) ([]Table, error)
+	}{
+		{"pragma_table_list", Tables},
+		{"sqlite_master", masterTables},
+	} {
+		for _, test := range []struct {
+			schema string
+			want   []Table
+		}{
+			{"", all},
+			{"main", all[:11]},
+			{"aux", all[11:12]},
+			{"temp", all[12:]},
+			{"nonexistent", nil},
+		} {
+			g, err := f.fn(ctx, c, test.schema)
+			if err != nil {
+				t.Fatalf("%s %q: %v", f.name, test.schema, err)
+			}
+
+			if !reflect.DeepEqual(g, test.want) {
+				t.Errorf("%s %q:\ngot  %+v\nwant %+v", f.name, test.schema, g, test.want)
+			}
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	c, done := testDB(t)
+
+	defer done()
+
+	ctx := context.Background()
+	g, err := Columns(ctx, c, "", "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := []Column{
+		{Name: "a", Type: "INTEGER", PrimaryKey: 1},
+		{Name: "b", Type: "TEXT", NotNull: true, Default: sql.NullString{String: "'x'", Valid: true}},
+	}; !reflect.DeepEqual(g, e) {
+		t.Fatalf("got %+v, want %+v", g, e)
+	}
+
+	if g, err = Columns(ctx, c, "main", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := fmt.Sprint(g), fmt.Sprint([]Column{
+		{Name: "i", Type: "INT"},
+		{Name: "j"},
+		{Name: "k", Hidden: 2},
+	}); g != e {
+		t.Fatalf("got %s, want %s", g, e)
+	}
+
+	if _, err := Columns(ctx, c, "aux", "p"); err == nil || err.Error() != "schema: no such table: aux.p" {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	c, done := testDB(t)
+
+	defer done()
+
+	ctx := context.Background()
+	g, err := Indexes(ctx, c, "main", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := []Index{
+		{Name: "c_ij", Origin: "c", Partial: true, Columns: []IndexColumn{
+			{Name: "i", Desc: true, Collation: "BINARY"},
+			{Name: "j", Collation: "nocase"},
+		}},
+		{Name: "c_expr", Origin: "c", Columns: []IndexColumn{
+			{Collation: "BINARY"},
+		}},
+	}; !reflect.DeepEqual(g, e) {
+		t.Fatalf("got %+v, want %+v", g, e)
+	}
+
+	if g, err = Indexes(ctx, c, "", "p"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(g) != 1 || !g[0].Unique || g[0].Origin != "u" || len(g[0].Columns) != 1 || g[0].Columns[0].Name != "b" {
+		t.Fatalf("got %+v", g)
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	c, done := testDB(t)
+
+	defer done()
+
+	g, err := ForeignKeys(context.Background(), c, "", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := []ForeignKey{
+		{ID: 1, Table: "p", From: []string{"i", "j"}, To: []string{"a", "b"}, OnUpdate: "NO ACTION", OnDelete: "CASCADE", Match: "NONE"},
+		{ID: 0, Table: "p", From: []string{"j"}, OnUpdate: "NO ACTION", OnDelete: "NO ACTION", Match: "NONE"},
+	}; !reflect.DeepEqual(g, e) {
+		t.Fatalf("got %+v, want %+v", g, e)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Serialize returns the content of the database schema, "main" if empty, as
+// the bytes of a database file, see https://www.sqlite.org/c3ref/serialize.html.
+// Within a transaction the content is the one seen by the transaction, so
+// Serialize following BEGIN and a read takes a consistent snapshot while other
+// connections keep writing.
+//
+// Serialize is not supported on windows/386, whose SQLite is built without
+// it. Serialize can be reached using (*sql.Conn).Raw.
+func (c *conn) Serialize(schema string) ([]byte, error) {
+	var zSchema uintptr
+	if schema != "" {
+		var err error
+		if zSchema, err = libc.CString(schema); err != nil {
+			return nil, err
+		}
+
+		defer c.free(zSchema)
+	}
+
+	pSize, err := c.malloc(8)
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.free(pSize)
+
+	p, err := serialize(c.tls, c.db, zSchema, pSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if p == 0 {
+		if rc := sqlite3.Xsqlite3_errcode(c.tls, c.db); rc != sqlite3.SQLITE_OK {
+			return nil, c.errstr(rc)
+		}
+
+		return nil, fmt.Errorf("sqlite: Serialize %q: no such database or out of memory", schema)
+	}
+
+	defer sqlite3.Xsqlite3_free(c.tls, p)
+
+	n := *(*int64)(unsafe.Pointer(pSize))
+	b := make([]byte, n)
+	copy(b, (*libc.RawMem)(unsafe.Pointer(p))[:n:n])
+	return b, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// resetMode selects the state ResetSession clears, see setReset.
+type resetMode int
+
+const (
+	resetTx   resetMode = iota // Roll back an abandoned transaction.
+	resetNone                  // Leave a transaction open.
+	resetTemp                  // resetTx and drop the objects of the temp schema.
+)
+
+// setReset handles the _reset query parameter.
+func (c *conn) setReset(v string) error {
+	switch strings.ToLower(v) {
+	case "tx":
+		c.reset = resetTx
+	case "none":
+		c.reset = resetNone
+	case "temp":
+		c.reset = resetTemp
+	default:
+		return fmt.Errorf("unknown _reset %q", v)
+	}
+	return nil
+}
+
+// IsValid implements driver.Validator. database/sql calls it when a
+// connection is returned to the pool and closes the invalid ones. A
+// connection is invalid once it is closed or a panic was recovered from the
+// library.
+func (c *conn) IsValid() bool { return c.db != 0 && !c.panic }
+
+// ResetSession implements driver.SessionResetter. database/sql calls it
+// before reusing a pooled connection. It resets the statements left running
+// and rolls back a transaction left open, like one started by executing BEGIN
+// outside of a sql.Tx, so the next user of the connection does not fail with
+// "cannot start a transaction within a transaction" or run inside somebody
+// else's transaction. With the _reset query parameter set to "temp" it also
+// drops the tables, views and triggers of the temp schema, see Driver.Open.
+// It creates the functions and collations registered on the driver since the
+// connection was opened. A connection in an unknown state, or whose rollback
+// fails, is reported as driver.ErrBadConn and discarded.
+//
+// Rolling back the transaction left open is a breaking change for programs
+// limiting the pool to one connection by sql.DB.SetMaxOpenConns(1) and
+// running BEGIN and COMMIT by sql.DB.Exec, which relied on the connection
+// staying in the transaction between the calls. Use sql.Tx or sql.Conn
+// instead, or set _reset to "none" to keep the previous behavior.
+func (c *conn) ResetSession(ctx context.Context) error {
+	if !c.IsValid() {
+		return driver.ErrBadConn
+	}
+
+	if err := c.health(); err != nil {
+		return err
+	}
+
+	c.resetBusy()
+
+	// Connections opened before a function or collation was registered
+	// get it when reused.
+	if err := c.applyRegistry(); err != nil {
+		logf(sqlite3.SQLITE_WARNING, "sqlite: cannot create the registered functions and collations: %v", err)
+		return driver.ErrBadConn
+	}
+
+	if c.autocommit() {
+		if err := c.resetTempSchema(ctx); err != nil {
+			return err
+		}
+
+		c.optimizeIdle(ctx)
+		return nil
+	}
+
+	if c.reset == resetNone {
+		return nil
+	}
+
+	t := &tx{c: c}
+	err := t.exec(ctx, "rollback")
+	c.releaseWriter()
+	c.signalLockRelease()
+	c.publishChanges()
+	if err != nil || !c.autocommit() {
+		logf(sqlite3.SQLITE_WARNING, "sqlite: cannot roll back abandoned transaction: %v", err)
+		return driver.ErrBadConn
+	}
+
+	return c.resetTempSchema(ctx)
+}
+
+// resetTempSchema drops the objects of the temp schema if c.reset is
+// resetTemp.
+func (c *conn) resetTempSchema(ctx context.Context) error {
+	if c.reset != resetTemp {
+		return nil
+	}
+
+	objs, err := c.tempObjects(ctx)
+	if err != nil {
+		logf(sqlite3.SQLITE_WARNING, "sqlite: cannot list the temp schema: %v", err)
+		return driver.ErrBadConn
+	}
+
+	// Triggers and views first, the tables they refer to afterwards.
+	for _, v := range objs {
+		if _, err := c.exec(ctx, fmt.Sprintf("drop %s if exists temp.%s", v[0], quoteIdentifier(v[1])), nil); err != nil {
+			logf(sqlite3.SQLITE_WARNING, "sqlite: cannot drop temp %s %s: %v", v[0], v[1], err)
+			return driver.ErrBadConn
+		}
+	}
+	return nil
+}
+
+// resetBusy resets the prepared statements of c which were stepped but not
+// run to completion, releasing the read transactions they hold.
+func (c *conn) resetBusy() {
+	// sqlite3_stmt *sqlite3_next_stmt(sqlite3 *pDb, sqlite3_stmt *pStmt);
+	for p := sqlite3.Xsqlite3_next_stmt(c.tls, c.db, 0); p != 0; p = sqlite3.Xsqlite3_next_stmt(c.tls, c.db, p) {
+		if sqlite3.Xsqlite3_stmt_busy(c.tls, p) != 0 {
+			sqlite3.Xsqlite3_reset(c.tls, p)
+		}
+	}
+}
+
+// tempObjects returns the type and name of the tables, views and triggers of
+// the temp schema, tables last.
+func (c *conn) tempObjects(ctx context.Context) (r [][2]string, err error) {
+	rs, err := c.internalQuery(ctx, "select type, name from temp.sqlite_master where type in ('table', 'view', 'trigger') order by type = 'table'", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rs.Close()
+
+	dest := make([]driver.Value, 2)
+	for {
+		if err := rs.Next(dest); err != nil {
+			if err == io.EOF {
+				return r, nil
+			}
+
+			return nil, err
+		}
+
+		r = append(r, [2]string{dest[0].(string), dest[1].(string)})
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestResetSession checks a transaction abandoned on a pooled connection is
+// rolled back before the connection is reused.
+func TestResetSession(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ExecContext(ctx, "begin; insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := tx.QueryRow("select count(*) from t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 0 {
+		t.Errorf("got %d rows of the abandoned transaction, want 0", n)
+	}
+
+	if _, err := tx.Exec("insert into t values(2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.QueryRow("select count(*) from t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("got %d rows, want 1", n)
+	}
+
+	var valid bool
+	if c, err = db.Conn(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if err := c.Raw(func(driverConn interface{}) error {
+		valid = driverConn.(*conn).IsValid()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !valid {
+		t.Error("connection is not valid")
+	}
+}
+
+// TestResetSessionPanic checks a connection which recovered a panic in a
+// transaction is not reused.
+func TestResetSessionPanic(t *testing.T) {
+	if err := RegisterScalarFunction("test_session_panic", 0, func(*FunctionContext, []driver.Value) (driver.Value, error) {
+		panic("test")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open(driverName, "file:"+uriEscape(filepath.Join(t.TempDir(), "test.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ExecContext(ctx, "begin; insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.ExecContext(ctx, "select test_session_panic()"); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	c.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRow("select count(*) from t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 0 {
+		t.Errorf("got %d rows of the abandoned transaction, want 0", n)
+	}
+}
+
+// TestCancelRows checks the statement of rows being iterated is interrupted
+// when the context of the query is done, and that the connection is clean
+// for its next user.
+func TestCancelRows(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tx.Exec("insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second row takes practically forever.
+	rows, err := tx.QueryContext(ctx, `
+with recursive c(x) as (select 1 union all select x+1 from c)
+select x from c where x = 1 or x % 1000000000000 = 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if rows.Next() {
+		t.Fatal("unexpected row")
+	}
+
+	if err := rows.Err(); err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	rows.Close()
+	if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := db.QueryRow("select count(*) from t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 0 {
+		t.Errorf("got %d rows of the canceled transaction, want 0", n)
+	}
+
+	if _, err := db.Exec("insert into t values(2)"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestResetSessionModes checks the _reset query parameter using the pattern
+// of running BEGIN and COMMIT by sql.DB.Exec on a pool of one connection.
+func TestResetSessionModes(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	for _, v := range []struct {
+		mode   string
+		commit bool // COMMIT finds the transaction of BEGIN.
+		temp   int
+	}{
+		{"none", true, 3},
+		{"tx", false, 3},
+		{"temp", false, 0},
+		// The temp objects are listed regardless of _text_bytes.
+		{"temp&_text_bytes=1", false, 0},
+	} {
+		db, err := sql.Open(driverName, "file:"+uriEscape(fn)+"?_reset="+v.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db.SetMaxOpenConns(1)
+		for _, s := range []string{
+			"drop table if exists t",
+			"create table t(i)",
+			"create temp table tt(i); create temp view tv as select * from tt; create temp trigger tr after insert on t begin insert into tt values(new.i); end",
+			"begin",
+			"insert into t values(1)",
+		} {
+			if _, err := db.Exec(s); err != nil {
+				t.Fatalf("%s: %s: %v", v.mode, s, err)
+			}
+		}
+
+		if _, err := db.Exec("commit"); (err == nil) != v.commit {
+			t.Errorf("%s: commit: %v", v.mode, err)
+		}
+
+		var rows, temp int
+		if err := db.QueryRow("select count(*) from t").Scan(&rows); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.QueryRow("select count(*) from temp.sqlite_master").Scan(&temp); err != nil {
+			t.Fatal(err)
+		}
+
+		if rows != 1 || temp != v.temp {
+			t.Errorf("%s: got %d rows and %d temp objects, want 1 and %d", v.mode, rows, temp, v.temp)
+		}
+
+		db.Close()
+	}
+
+	db, err := sql.Open(driverName, "file:"+uriEscape(fn)+"?_reset=all")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if err := db.Ping(); err == nil {
+		t.Fatal("unexpected success")
+	}
+}
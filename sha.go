@@ -0,0 +1,96 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"crypto/sha1"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"modernc.org/sqlite/internal/sha3"
+)
+
+func init() {
+	MustRegisterDeterministicScalarFunction("sha1", 1, sha1Func)
+	MustRegisterDeterministicScalarFunction("sha3", -1, sha3Func)
+}
+
+// sha1(X) returns the SHA1 hash of X as hexadecimal text, or NULL if X is
+// NULL. Numbers are hashed in their text form.
+func sha1Func(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	b, ok := valueBytes(args[0])
+	if !ok {
+		return nil, nil
+	}
+
+	h := sha1.Sum(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// sha3(X[, SIZE]) returns the SHA3 hash of X as a blob, or NULL if X is NULL.
+// SIZE is the size of the hash in bits, 224, 256 (the default), 384 or 512.
+// Numbers are hashed in their text form.
+func sha3Func(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("wrong number of arguments to function sha3()")
+	}
+
+	size := int64(256)
+	if len(args) == 2 {
+		size, _ = args[1].(int64)
+		switch size {
+		case 224, 256, 384, 512:
+		default:
+			return nil, fmt.Errorf("SHA3 size should be one of: 224 256 384 512")
+		}
+	}
+
+	b, ok := valueBytes(args[0])
+	if !ok {
+		return nil, nil
+	}
+
+	return sha3.Sum(b, int(size)), nil
+}
+
+// valueBytes returns the bytes of v, the text representation SQLite uses for
+// numbers. ok is false if v is NULL.
+func valueBytes(v driver.Value) (b []byte, ok bool) {
+	switch x := v.(type) {
+	case nil:
+		return nil, false
+	case []byte:
+		return x, true
+	case string:
+		return []byte(x), true
+	case int64:
+		return strconv.AppendInt(nil, x, 10), true
+	case float64:
+		return []byte(formatReal(x)), true
+	default:
+		return []byte(fmt.Sprint(x)), true
+	}
+}
+
+// formatReal formats f like SQLite converts a REAL to text, using 15
+// significant digits and always including a decimal point or an exponent.
+func formatReal(f float64) string {
+	s := strconv.FormatFloat(f, 'g', 15, 64)
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		// SQLite writes 1e+20 as 1.0e+20.
+		if !strings.Contains(s[:i], ".") {
+			s = s[:i] + ".0" + s[i:]
+		}
+		return s
+	}
+
+	if !strings.ContainsAny(s, ".nN") {
+		s += ".0"
+	}
+	return s
+}
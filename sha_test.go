@@ -0,0 +1,69 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"testing"
+)
+
+func TestSHAFunctions(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	for _, v := range []struct {
+		sql  string
+		want interface{}
+	}{
+		{"select sha1('abc')", "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{"select sha1(x'616263')", "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{"select sha1(42)", "92cfceb39d57d914ed8b14d0e37643de0797ae56"},
+		{"select sha1(1.5)", "aa8f289ebe6d4db1b4a1038b8931ec8c2b5399fb"},
+		{"select sha1(null)", nil},
+		{"select hex(sha3('abc'))", "3A985DA74FE225B2045C172D6BD390BD855F086E3E9D525B46BFE24511431532"},
+		{"select hex(sha3('abc', 256))", "3A985DA74FE225B2045C172D6BD390BD855F086E3E9D525B46BFE24511431532"},
+		{"select hex(sha3('', 224))", "6B4E03423667DBB73B6E15454F0EB1ABD4597F9A1B078E3F5B5A6BC7"},
+		{"select lower(hex(sha3(42, 512)))", "4e94ccd8d7dc0381681ba14408f5a4f7a9834d0101b1e21db1396f9bf431c852a5a3eabd3aeb6195ff3d490625a6ea75d0a7fc3761b20e1fdbc57bd0758286dc"},
+		{"select length(sha3('abc', 384))", int64(48)},
+		{"select sha3(null)", nil},
+	} {
+		var g interface{}
+		if err := db.QueryRow(v.sql).Scan(&g); err != nil {
+			t.Errorf("%s: %v", v.sql, err)
+			continue
+		}
+
+		if g != v.want {
+			t.Errorf("%s: got %v, want %v", v.sql, g, v.want)
+		}
+	}
+
+	for _, s := range []string{
+		"select sha3('abc', 128)",
+		"select sha3()",
+		"select sha3('a', 256, 1)",
+	} {
+		if _, err := db.Exec(s); err == nil {
+			t.Errorf("%s: unexpected success", s)
+		}
+	}
+}
+
+func TestFormatReal(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	for _, f := range []float64{0, 1, -1.5, 0.1, 1e15, 1e20, 1.5e-7, 123456789.125, 1e300} {
+		var e string
+		if err := db.QueryRow("select cast(? as text)", f).Scan(&e); err != nil {
+			t.Fatal(err)
+		}
+
+		if g := formatReal(f); g != e {
+			t.Errorf("%v: got %q, want %q", f, g, e)
+		}
+	}
+}
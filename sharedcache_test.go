@@ -0,0 +1,110 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// TestSharedCache checks a statement and BEGIN finding a table of a shared
+// cache locked by the transaction of another connection wait until it
+// commits instead of failing with SQLITE_LOCKED.
+func TestSharedCache(t *testing.T) {
+	db, err := sql.Open(driverName, "file:TestSharedCache?mode=memory&cache=shared&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(2)
+	if _, err := db.Exec("create table t(i); insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	a, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer a.Close()
+
+	b, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer b.Close()
+
+	for _, v := range []struct {
+		name string
+		f    func() (int, error)
+	}{
+		{"select", func() (n int, err error) {
+			err = b.QueryRowContext(ctx, "select count(*) from t").Scan(&n)
+			return n, err
+		}},
+		{"begin", func() (n int, err error) {
+			tx, err := b.BeginTx(ctx, nil)
+			if err != nil {
+				return 0, err
+			}
+
+			defer tx.Rollback()
+
+			err = tx.QueryRow("select count(*) from t").Scan(&n)
+			return n, err
+		}},
+	} {
+		var want int
+		if err := a.QueryRowContext(ctx, "select count(*) from t").Scan(&want); err != nil {
+			t.Fatal(err)
+		}
+
+		tx, err := a.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tx.Exec("insert into t values(2)"); err != nil {
+			t.Fatal(err)
+		}
+
+		type result struct {
+			n   int
+			err error
+		}
+		ch := make(chan result, 1)
+		go func() {
+			n, err := v.f()
+			ch <- result{n, err}
+		}()
+
+		select {
+		case r := <-ch:
+			tx.Rollback()
+			t.Errorf("%s: did not wait for the table lock: %v %v", v.name, r.n, r.err)
+			continue
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case r := <-ch:
+			if r.err != nil || r.n != want+1 {
+				t.Errorf("%s: got %v %v, want %v", v.name, r.n, r.err, want+1)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: not released by the commit", v.name)
+		}
+	}
+}
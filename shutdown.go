@@ -0,0 +1,82 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Shutdown closes db for good, leaving its database file complete. It stops
+// db from handing out new connections, waits for the connections in use to be
+// returned, closes all of them but one, copies the whole WAL into the database
+// file and truncates it, see CheckpointTruncate, closes db and flushes the
+// database file to stable storage. SQLite removes the -wal and -shm files when
+// the last connection to the database closes, so unless other processes keep
+// the database open, the next start neither finds them nor has to recover
+// from them.
+//
+// If ctx is done before the other connections are returned or the checkpoint
+// completes, db is still closed and Shutdown returns the error of ctx. The
+// operations waiting for a connection of db when it is closed fail.
+func Shutdown(ctx context.Context, db *sql.DB) error {
+	sc, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	db.SetMaxOpenConns(1)
+	for i := 0; db.Stats().OpenConnections > 1; i++ {
+		t := time.NewTimer(checkpointPoll(i))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			sc.Close()
+			db.Close()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	var filename string
+	err = sc.Raw(func(dc interface{}) error {
+		c, ok := dc.(*conn)
+		if !ok {
+			return fmt.Errorf("sqlite: Shutdown: unexpected driver connection %T", dc)
+		}
+
+		filename = libc.GoString(sqlite3.Xsqlite3_db_filename(c.tls, c.db, 0))
+		_, err := c.Checkpoint(ctx, CheckpointTruncate)
+		return err
+	})
+	if e := sc.Close(); e != nil && err == nil {
+		err = e
+	}
+	if e := db.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err != nil || filename == "" {
+		return err
+	}
+
+	f, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	open := func() *sql.DB {
+		db, err := sql.Open(driverName, fn+"?_pragma=journal_mode(wal)")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return db
+	}
+	db := open()
+	if _, err := db.Exec("create table t(i); insert into t values(42)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A transaction still running when Shutdown is called completes.
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tx.Exec("insert into t values(43)"); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tx.Commit()
+	}()
+
+	if err := Shutdown(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Ping(); err == nil {
+		t.Fatal("the database is still open")
+	}
+
+	for _, v := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(fn + v); !os.IsNotExist(err) {
+			t.Errorf("%s: %v", v, err)
+		}
+	}
+
+	db = open()
+	var n int
+	if err := db.QueryRow("select count(*) from t").Scan(&n); err != nil || n != 2 {
+		t.Fatal(n, err)
+	}
+
+	// A connection never returned delays Shutdown until ctx is done.
+	sc, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sc.Close()
+
+	ctx2, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+
+	defer cancel()
+
+	if err := Shutdown(ctx2, db); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"modernc.org/sqlite/internal/slt"
+)
+
+var oSLT = flag.String("slt", "", "additional sqllogictest scripts to run, a glob pattern like $HOME/sqllogictest/test/select*.test")
+
+// TestSLT runs the sqllogictest scripts in testdata/slt, a curated set of
+// checks of the translated library, and the scripts selected by -slt. The
+// expected results of the scripts in testdata/slt are those of the C build of
+// the same SQLite version.
+func TestSLT(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "slt", "*.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *oSLT != "" {
+		more, err := filepath.Glob(*oSLT)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(more) == 0 {
+			t.Fatalf("-slt %s: no files", *oSLT)
+		}
+
+		files = append(files, more...)
+	}
+	sort.Strings(files)
+	for _, v := range files {
+		name := v
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			f, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer f.Close()
+
+			db, err := sql.Open(driverName, ":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer db.Close()
+
+			db.SetMaxOpenConns(1)
+			stats, errs := slt.Run(db, name, f)
+			for _, err := range errs {
+				t.Error(err)
+			}
+			t.Logf("%d statements, %d queries, %d skipped", stats.Statements, stats.Queries, stats.Skipped)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql/driver"
+)
+
+func init() {
+	MustRegisterDeterministicScalarFunction("soundex", 1, soundexFunc)
+}
+
+// soundexCodes maps the ASCII letters to their soundex digit. Other characters
+// map to zero.
+var soundexCodes = func() (r [128]byte) {
+	for _, v := range []struct {
+		letters string
+		code    byte
+	}{
+		{"BFPV", 1},
+		{"CGJKQSXZ", 2},
+		{"DT", 3},
+		{"L", 4},
+		{"MN", 5},
+		{"R", 6},
+	} {
+		for i := 0; i < len(v.letters); i++ {
+			r[v.letters[i]] = v.code
+			r[v.letters[i]+'a'-'A'] = v.code
+		}
+	}
+	return r
+}()
+
+// soundex(X) returns the soundex encoding of X, like the function SQLite
+// provides when compiled with SQLITE_SOUNDEX. It returns "?000" if X is NULL
+// or contains no ASCII letter.
+func soundexFunc(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	b, _ := valueBytes(args[0])
+	return soundex(b), nil
+}
+
+func soundex(b []byte) string {
+	i := 0
+	for i < len(b) && !isASCIILetter(b[i]) {
+		i++
+	}
+	if i == len(b) {
+		return "?000"
+	}
+
+	r := []byte{b[i] &^ 0x20, '0', '0', '0'}
+	prev := soundexCodes[b[i]&0x7f]
+	for j := 1; j < 4 && i < len(b); i++ {
+		code := soundexCodes[b[i]&0x7f]
+		if code == 0 {
+			prev = 0
+			continue
+		}
+
+		if code != prev {
+			prev = code
+			r[j] = '0' + code
+			j++
+		}
+	}
+	return string(r)
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,43 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"testing"
+)
+
+func TestSoundex(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	for _, v := range []struct {
+		s    interface{}
+		want string
+	}{
+		{"Robert", "R163"},
+		{"Rupert", "R163"},
+		{"rubin", "R150"},
+		{"Tymczak", "T522"},
+		{"Pfister", "P236"},
+		{"Ashcraft", "A226"},
+		{"Lee", "L000"},
+		{"  O'Hara", "O600"},
+		// Like in C, the bytes of other characters are masked to 7 bits.
+		{"Müller", "M246"},
+		{"123", "?000"},
+		{"", "?000"},
+		{nil, "?000"},
+	} {
+		var g string
+		if err := db.QueryRow("select soundex(?)", v.s).Scan(&g); err != nil {
+			t.Fatal(err)
+		}
+
+		if g != v.want {
+			t.Errorf("soundex(%q): got %q, want %q", v.s, g, v.want)
+		}
+	}
+}
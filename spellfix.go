@@ -0,0 +1,593 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// The spellfix1 virtual table, modeled after ext/misc/spellfix.c of the
+// SQLite source tree, see https://www.sqlite.org/spellfix1.html. The
+// vocabulary is kept in the shadow table <name>_vocab. Unlike the C
+// implementation, the phonetic hash k2 is the soundex code of the word and the
+// edit distance uses fixed costs, see spellfixDistance.
+
+func init() {
+	registerModule("spellfix1", &goModule{
+		create:     spellfixCreate,
+		connect:    spellfixConnect,
+		bestIndex:  spellfixBestIndex,
+		disconnect: spellfixDisconnect,
+		destroy:    spellfixDestroy,
+		open:       spellfixOpen,
+		close:      spellfixClose,
+		filter:     spellfixFilter,
+		next:       spellfixNext,
+		eof:        spellfixEOF,
+		column:     spellfixColumn,
+		rowid:      spellfixRowid,
+		update:     spellfixUpdate,
+		rename:     spellfixRename,
+	})
+	MustRegisterDeterministicScalarFunction("spellfix1_editdist", 2, spellfixEditdist)
+}
+
+// Columns of the spellfix1 table.
+const (
+	spellfixColWord = iota
+	spellfixColRank
+	spellfixColDistance
+	spellfixColLangid
+	spellfixColScore
+	spellfixColMatchlen
+	spellfixColPhonehash
+	spellfixColTop
+	spellfixColScope
+	spellfixColSrchcnt
+	spellfixColSoundslike
+	spellfixColCommand
+)
+
+// Bits of idxNum, the constraints passed to xFilter in this order.
+const (
+	spellfixIdxMatch = 1 << iota
+	spellfixIdxLangid
+	spellfixIdxTop
+	spellfixIdxScope
+	spellfixIdxDistLT
+	spellfixIdxDistLE
+	spellfixIdxRowid
+)
+
+const (
+	// spellfixTop is the default number of rows returned by a MATCH query.
+	spellfixTop = 20
+
+	// spellfixScope is the default number of leading characters of the
+	// phonetic hash a word must share with the pattern to be a candidate of
+	// a MATCH query.
+	spellfixScope = 3
+)
+
+type spellfixTable struct {
+	db     uintptr
+	schema string
+	name   string
+}
+
+// vocab returns the qualified name of the shadow table.
+func (t *spellfixTable) vocab() string {
+	return quoteIdentifier(t.schema) + "." + quoteIdentifier(t.name+"_vocab")
+}
+
+type spellfixRow struct {
+	id        int64
+	word      string
+	rank      int64
+	langid    int64
+	phonehash string
+	distance  int64
+	score     int64
+	matchlen  int64
+}
+
+type spellfixCursor struct {
+	rows    []spellfixRow
+	match   bool // distance, score and matchlen are valid.
+	srchcnt int64
+}
+
+var (
+	spellfixMu      sync.Mutex
+	spellfixTables  = map[uintptr]*spellfixTable{}
+	spellfixCursors = map[uintptr]*spellfixCursor{}
+)
+
+func spellfixTableOf(pVtab uintptr) *spellfixTable {
+	spellfixMu.Lock()
+
+	defer spellfixMu.Unlock()
+
+	return spellfixTables[pVtab]
+}
+
+func spellfixCursorOf(pCursor uintptr) *spellfixCursor {
+	spellfixMu.Lock()
+
+	defer spellfixMu.Unlock()
+
+	return spellfixCursors[pCursor]
+}
+
+func spellfixCreate(tls *libc.TLS, db, pAux uintptr, argc int32, argv, ppVtab, pzErr uintptr) int32 {
+	return spellfixInit(tls, db, argc, argv, ppVtab, pzErr, true)
+}
+
+func spellfixConnect(tls *libc.TLS, db, pAux uintptr, argc int32, argv, ppVtab, pzErr uintptr) int32 {
+	return spellfixInit(tls, db, argc, argv, ppVtab, pzErr, false)
+}
+
+func spellfixInit(tls *libc.TLS, db uintptr, argc int32, argv, ppVtab, pzErr uintptr, create bool) int32 {
+	arg := func(i int32) string {
+		return libc.GoString(*(*uintptr)(unsafe.Pointer(argv + uintptr(i)*ptrSize)))
+	}
+	fail := func(msg string) int32 {
+		*(*uintptr)(unsafe.Pointer(pzErr)) = mallocString(tls, msg)
+		return sqlite3.SQLITE_ERROR
+	}
+
+	if argc > 3 {
+		return fail(fmt.Sprintf("spellfix1: unsupported argument: %s", arg(3)))
+	}
+
+	t := &spellfixTable{db: db, schema: arg(1), name: arg(2)}
+	if rc := declareVtab(tls, db, "create table x(word, rank, distance, langid, score, matchlen, phonehash hidden, top hidden, scope hidden, srchcnt hidden, soundslike hidden, command hidden)"); rc != sqlite3.SQLITE_OK {
+		return rc
+	}
+
+	if create {
+		if err := vtabExec(tls, db, fmt.Sprintf("create table if not exists %s(id integer primary key, rank int, langid int, word text, k1 text, k2 text)", t.vocab()), nil, nil); err != nil {
+			return fail(err.Error())
+		}
+
+		if err := vtabExec(tls, db, fmt.Sprintf("create index if not exists %s on %s(langid, k2)", quoteIdentifier(t.schema)+"."+quoteIdentifier(t.name+"_vocab_index_langid_k2"), quoteIdentifier(t.name+"_vocab")), nil, nil); err != nil {
+			return fail(err.Error())
+		}
+	}
+
+	p := newVtab(tls)
+	if p == 0 {
+		return sqlite3.SQLITE_NOMEM
+	}
+
+	spellfixMu.Lock()
+	spellfixTables[p] = t
+	spellfixMu.Unlock()
+	*(*uintptr)(unsafe.Pointer(ppVtab)) = p
+	return sqlite3.SQLITE_OK
+}
+
+func spellfixDisconnect(tls *libc.TLS, pVtab uintptr) int32 {
+	spellfixMu.Lock()
+	delete(spellfixTables, pVtab)
+	spellfixMu.Unlock()
+	sqlite3.Xsqlite3_free(tls, pVtab)
+	return sqlite3.SQLITE_OK
+}
+
+func spellfixDestroy(tls *libc.TLS, pVtab uintptr) int32 {
+	t := spellfixTableOf(pVtab)
+	if err := vtabExec(tls, t.db, "drop table if exists "+t.vocab(), nil, nil); err != nil {
+		return vtabError(tls, pVtab, err.Error())
+	}
+
+	return spellfixDisconnect(tls, pVtab)
+}
+
+func spellfixRename(tls *libc.TLS, pVtab, zNew uintptr) int32 {
+	t := spellfixTableOf(pVtab)
+	name := libc.GoString(zNew)
+	if err := vtabExec(tls, t.db, fmt.Sprintf("alter table %s rename to %s", t.vocab(), quoteIdentifier(name+"_vocab")), nil, nil); err != nil {
+		return vtabError(tls, pVtab, err.Error())
+	}
+
+	t.name = name
+	return sqlite3.SQLITE_OK
+}
+
+func spellfixBestIndex(tls *libc.TLS, pVtab, pInfo uintptr) int32 {
+	info := (*sqlite3.Sqlite3_index_info)(unsafe.Pointer(pInfo))
+	var plan int32
+	var use [7]int32 // Constraint index per idxNum bit.
+	for i := int32(0); i < info.FnConstraint; i++ {
+		c := constraint(info, i)
+		if c.usable == 0 {
+			continue
+		}
+
+		var bit int32
+		switch {
+		case c.iColumn == spellfixColWord && c.op == sqlite3.SQLITE_INDEX_CONSTRAINT_MATCH:
+			bit = spellfixIdxMatch
+		case c.iColumn == spellfixColLangid && c.op == sqlite3.SQLITE_INDEX_CONSTRAINT_EQ:
+			bit = spellfixIdxLangid
+		case c.iColumn == spellfixColTop && c.op == sqlite3.SQLITE_INDEX_CONSTRAINT_EQ:
+			bit = spellfixIdxTop
+		case c.iColumn == spellfixColScope && c.op == sqlite3.SQLITE_INDEX_CONSTRAINT_EQ:
+			bit = spellfixIdxScope
+		case c.iColumn == spellfixColDistance && c.op == sqlite3.SQLITE_INDEX_CONSTRAINT_LT && plan&(spellfixIdxDistLT|spellfixIdxDistLE) == 0:
+			bit = spellfixIdxDistLT
+		case c.iColumn == spellfixColDistance && c.op == sqlite3.SQLITE_INDEX_CONSTRAINT_LE && plan&(spellfixIdxDistLT|spellfixIdxDistLE) == 0:
+			bit = spellfixIdxDistLE
+		case c.iColumn < 0 && c.op == sqlite3.SQLITE_INDEX_CONSTRAINT_EQ:
+			bit = spellfixIdxRowid
+		default:
+			continue
+		}
+		if plan&bit != 0 {
+			continue
+		}
+
+		plan |= bit
+		for j := range use {
+			if bit == 1<<j {
+				use[j] = i
+			}
+		}
+	}
+
+	argv := int32(0)
+	for j := range use {
+		if plan&(1<<j) != 0 {
+			argv++
+			u := constraintUsage(info, use[j])
+			u.argvIndex = argv
+			u.omit = 1
+		}
+	}
+	info.FidxNum = plan
+	switch {
+	case plan&spellfixIdxMatch != 0:
+		info.FestimatedCost = 1e5
+	case plan&spellfixIdxRowid != 0:
+		info.FestimatedCost = 5
+		info.FestimatedRows = 1
+	default:
+		info.FestimatedCost = 1e7
+	}
+	return sqlite3.SQLITE_OK
+}
+
+func spellfixOpen(tls *libc.TLS, pVtab, ppCursor uintptr) int32 {
+	p := newVtabCursor(tls)
+	if p == 0 {
+		return sqlite3.SQLITE_NOMEM
+	}
+
+	spellfixMu.Lock()
+	spellfixCursors[p] = &spellfixCursor{}
+	spellfixMu.Unlock()
+	*(*uintptr)(unsafe.Pointer(ppCursor)) = p
+	return sqlite3.SQLITE_OK
+}
+
+func spellfixClose(tls *libc.TLS, pCursor uintptr) int32 {
+	spellfixMu.Lock()
+	delete(spellfixCursors, pCursor)
+	spellfixMu.Unlock()
+	sqlite3.Xsqlite3_free(tls, pCursor)
+	return sqlite3.SQLITE_OK
+}
+
+func spellfixFilter(tls *libc.TLS, pCursor uintptr, idxNum int32, idxStr uintptr, argc int32, argv uintptr) int32 {
+	cur := spellfixCursorOf(pCursor)
+	t := spellfixTableOf(cursorVtab(pCursor))
+	*cur = spellfixCursor{match: idxNum&spellfixIdxMatch != 0}
+	var pattern string
+	langid, top, scope, limit := int64(0), int64(spellfixTop), int64(spellfixScope), int64(-1)
+	var rowid int64
+	iArg := int32(0)
+	for bit := int32(1); bit <= spellfixIdxRowid; bit <<= 1 {
+		if idxNum&bit == 0 {
+			continue
+		}
+
+		v := valueAt(argv, iArg)
+		switch bit {
+		case spellfixIdxMatch:
+			pattern = valueString(tls, argv, iArg)
+		case spellfixIdxLangid:
+			langid = sqlite3.Xsqlite3_value_int64(tls, v)
+		case spellfixIdxTop:
+			if top = sqlite3.Xsqlite3_value_int64(tls, v); top < 1 {
+				top = 1
+			}
+		case spellfixIdxScope:
+			scope = sqlite3.Xsqlite3_value_int64(tls, v)
+		case spellfixIdxDistLT:
+			limit = sqlite3.Xsqlite3_value_int64(tls, v) - 1
+		case spellfixIdxDistLE:
+			limit = sqlite3.Xsqlite3_value_int64(tls, v)
+		case spellfixIdxRowid:
+			rowid = sqlite3.Xsqlite3_value_int64(tls, v)
+		}
+		iArg++
+	}
+
+	prefix := strings.HasSuffix(pattern, "*")
+	p := []rune(strings.ToLower(strings.TrimSuffix(pattern, "*")))
+	q := fmt.Sprintf("select id, word, rank, langid, k1, k2 from %s", t.vocab())
+	var args []interface{}
+	switch {
+	case cur.match:
+		// The candidates are the range of the (langid, k2) index sharing the
+		// first scope characters of the phonetic hash of the pattern.
+		lo, hi := spellfixHashRange(soundex([]byte(string(p))), scope)
+		q += " where langid = ? and k2 >= ? and k2 < ?"
+		args = append(args, langid, lo, hi)
+	case idxNum&spellfixIdxLangid != 0:
+		q += " where langid = ?"
+		args = append(args, langid)
+	case idxNum&spellfixIdxRowid != 0:
+		q += " where id = ?"
+		args = append(args, rowid)
+	}
+
+	if err := vtabExec(tls, t.db, q, args, func(pstmt uintptr) {
+		cur.srchcnt++
+		r := spellfixRow{
+			id:        sqlite3.Xsqlite3_column_int64(tls, pstmt, 0),
+			word:      columnString(tls, pstmt, 1),
+			rank:      sqlite3.Xsqlite3_column_int64(tls, pstmt, 2),
+			langid:    sqlite3.Xsqlite3_column_int64(tls, pstmt, 3),
+			phonehash: columnString(tls, pstmt, 5),
+		}
+		if cur.match {
+			d, n := spellfixDistance(p, []rune(columnString(tls, pstmt, 4)), prefix)
+			if limit >= 0 && int64(d) > limit {
+				return
+			}
+
+			r.distance, r.matchlen = int64(d), int64(n)
+			r.score = spellfixScore(r.distance, r.rank)
+		}
+		cur.rows = append(cur.rows, r)
+	}); err != nil {
+		return vtabError(tls, cursorVtab(pCursor), err.Error())
+	}
+
+	if cur.match {
+		sort.SliceStable(cur.rows, func(i, j int) bool {
+			a, b := &cur.rows[i], &cur.rows[j]
+			if a.score != b.score {
+				return a.score < b.score
+			}
+
+			return a.distance < b.distance
+		})
+		if int64(len(cur.rows)) > top {
+			cur.rows = cur.rows[:top]
+		}
+	}
+	return sqlite3.SQLITE_OK
+}
+
+// spellfixHashRange returns the bounds of the phonetic hashes sharing the first
+// scope characters with hash, the lower one inclusive.
+func spellfixHashRange(hash string, scope int64) (lo, hi string) {
+	switch {
+	case scope < 1:
+		scope = 1
+	case scope > int64(len(hash)):
+		scope = int64(len(hash))
+	}
+	lo = hash[:scope]
+	return lo, lo[:scope-1] + string(lo[scope-1]+1)
+}
+
+// spellfixScore combines the distance and the rank of a word like spellfix1
+// does, more frequent words score better.
+func spellfixScore(distance, rank int64) int64 {
+	log2 := int64(0)
+	for ; rank > 0; rank >>= 1 {
+		log2++
+	}
+	return distance + 32 - log2
+}
+
+// spellfixDistance returns the edit distance of the pattern and the word. An
+// insertion or deletion costs 100, a substitution 150. If prefix is true, the
+// distance to the closest prefix of word is returned. matchlen is the length,
+// in characters, of the part of word matched.
+func spellfixDistance(pattern, word []rune, prefix bool) (distance, matchlen int) {
+	const ins, del, subst = 100, 100, 150
+	prev := make([]int, len(word)+1)
+	row := make([]int, len(word)+1)
+	for j := range prev {
+		prev[j] = j * ins
+	}
+	for i := 1; i <= len(pattern); i++ {
+		row[0] = i * del
+		for j := 1; j <= len(word); j++ {
+			d := prev[j-1]
+			if pattern[i-1] != word[j-1] {
+				d += subst
+			}
+			if v := prev[j] + del; v < d {
+				d = v
+			}
+			if v := row[j-1] + ins; v < d {
+				d = v
+			}
+			row[j] = d
+		}
+		prev, row = row, prev
+	}
+	if !prefix {
+		return prev[len(word)], len(word)
+	}
+
+	distance, matchlen = prev[0], 0
+	for j, d := range prev {
+		if d < distance {
+			distance, matchlen = d, j
+		}
+	}
+	return distance, matchlen
+}
+
+// spellfix1_editdist(A, B) returns the edit distance of A and B used by the
+// spellfix1 virtual table.
+func spellfixEditdist(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	a, ok := valueBytes(args[0])
+	if !ok {
+		return nil, nil
+	}
+
+	b, ok := valueBytes(args[1])
+	if !ok {
+		return nil, nil
+	}
+
+	d, _ := spellfixDistance([]rune(strings.ToLower(string(a))), []rune(strings.ToLower(string(b))), false)
+	return int64(d), nil
+}
+
+func spellfixNext(tls *libc.TLS, pCursor uintptr) int32 {
+	cur := spellfixCursorOf(pCursor)
+	cur.rows = cur.rows[1:]
+	return sqlite3.SQLITE_OK
+}
+
+func spellfixEOF(tls *libc.TLS, pCursor uintptr) int32 {
+	if len(spellfixCursorOf(pCursor).rows) == 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func spellfixColumn(tls *libc.TLS, pCursor, ctx uintptr, i int32) int32 {
+	cur := spellfixCursorOf(pCursor)
+	r := &cur.rows[0]
+	switch i {
+	case spellfixColWord:
+		resultText(tls, ctx, r.word)
+	case spellfixColRank:
+		sqlite3.Xsqlite3_result_int64(tls, ctx, r.rank)
+	case spellfixColLangid:
+		sqlite3.Xsqlite3_result_int64(tls, ctx, r.langid)
+	case spellfixColPhonehash:
+		resultText(tls, ctx, r.phonehash)
+	case spellfixColSrchcnt:
+		sqlite3.Xsqlite3_result_int64(tls, ctx, cur.srchcnt)
+	case spellfixColDistance, spellfixColScore, spellfixColMatchlen:
+		if !cur.match {
+			sqlite3.Xsqlite3_result_null(tls, ctx)
+			break
+		}
+
+		v := r.distance
+		switch i {
+		case spellfixColScore:
+			v = r.score
+		case spellfixColMatchlen:
+			v = r.matchlen
+		}
+		sqlite3.Xsqlite3_result_int64(tls, ctx, v)
+	default:
+		sqlite3.Xsqlite3_result_null(tls, ctx)
+	}
+	return sqlite3.SQLITE_OK
+}
+
+func spellfixRowid(tls *libc.TLS, pCursor, pRowid uintptr) int32 {
+	*(*int64)(unsafe.Pointer(pRowid)) = spellfixCursorOf(pCursor).rows[0].id
+	return sqlite3.SQLITE_OK
+}
+
+// spellfixConflict maps the result of sqlite3_vtab_on_conflict to the
+// conflict clause of the statement updating the shadow table.
+var spellfixConflict = map[int32]string{
+	sqlite3.SQLITE_ROLLBACK: "or rollback ",
+	sqlite3.SQLITE_IGNORE:   "or ignore ",
+	sqlite3.SQLITE_FAIL:     "or fail ",
+	sqlite3.SQLITE_REPLACE:  "or replace ",
+}
+
+func spellfixUpdate(tls *libc.TLS, pVtab uintptr, argc int32, argv, pRowid uintptr) int32 {
+	t := spellfixTableOf(pVtab)
+	if argc == 1 {
+		id := sqlite3.Xsqlite3_value_int64(tls, valueAt(argv, 0))
+		if err := vtabExec(tls, t.db, fmt.Sprintf("delete from %s where id = ?", t.vocab()), []interface{}{id}, nil); err != nil {
+			return vtabError(tls, pVtab, err.Error())
+		}
+
+		return sqlite3.SQLITE_OK
+	}
+
+	isNull := func(i int32) bool {
+		return sqlite3.Xsqlite3_value_type(tls, valueAt(argv, i)) == sqlite3.SQLITE_NULL
+	}
+	col := func(c int32) int32 { return c + 2 }
+	if !isNull(col(spellfixColCommand)) {
+		switch cmd := valueString(tls, argv, col(spellfixColCommand)); cmd {
+		case "reset", "null":
+			// There is no cache to reset.
+			return sqlite3.SQLITE_OK
+		default:
+			return vtabError(tls, pVtab, fmt.Sprintf("unknown value for %s.command: %q", t.name, cmd))
+		}
+	}
+
+	if isNull(col(spellfixColWord)) {
+		return vtabError(tls, pVtab, fmt.Sprintf("NOT NULL constraint failed: %s.word", t.name))
+	}
+
+	word := valueString(tls, argv, col(spellfixColWord))
+	rank, langid := int64(1), int64(0)
+	if !isNull(col(spellfixColRank)) {
+		rank = sqlite3.Xsqlite3_value_int64(tls, valueAt(argv, col(spellfixColRank)))
+	}
+	if !isNull(col(spellfixColLangid)) {
+		langid = sqlite3.Xsqlite3_value_int64(tls, valueAt(argv, col(spellfixColLangid)))
+	}
+	soundslike := word
+	if !isNull(col(spellfixColSoundslike)) {
+		soundslike = valueString(tls, argv, col(spellfixColSoundslike))
+	}
+	k1 := strings.ToLower(soundslike)
+	k2 := soundex([]byte(k1))
+
+	var newID interface{}
+	if !isNull(1) {
+		newID = sqlite3.Xsqlite3_value_int64(tls, valueAt(argv, 1))
+	}
+	conflict := spellfixConflict[sqlite3.Xsqlite3_vtab_on_conflict(tls, t.db)]
+	args := []interface{}{newID, rank, langid, word, k1, k2}
+	if isNull(0) {
+		if err := vtabExec(tls, t.db, fmt.Sprintf("insert %sinto %s(id, rank, langid, word, k1, k2) values(?, ?, ?, ?, ?, ?)", conflict, t.vocab()), args, nil); err != nil {
+			return vtabError(tls, pVtab, err.Error())
+		}
+
+		*(*int64)(unsafe.Pointer(pRowid)) = sqlite3.Xsqlite3_last_insert_rowid(tls, t.db)
+		return sqlite3.SQLITE_OK
+	}
+
+	args = append(args, sqlite3.Xsqlite3_value_int64(tls, valueAt(argv, 0)))
+	if err := vtabExec(tls, t.db, fmt.Sprintf("update %s%s set id = ?, rank = ?, langid = ?, word = ?, k1 = ?, k2 = ? where id = ?", conflict, t.vocab()), args, nil); err != nil {
+		return vtabError(tls, pVtab, err.Error())
+	}
+
+	return sqlite3.SQLITE_OK
+}
@@ -0,0 +1,220 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func spellfixWords(t *testing.T, db *sql.DB, q string, args ...interface{}) string {
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", q, err)
+	}
+
+	defer rows.Close()
+
+	var a []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+
+		a = append(a, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("%s: %v", q, err)
+	}
+
+	return strings.Join(a, " ")
+}
+
+func TestSpellfix(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+create virtual table s using spellfix1;
+insert into s(word, rank) values('spelling', 100), ('spewing', 1), ('spell', 10), ('smelling', 5), ('apple', 50);
+insert into s(word, langid) values('spelling', 1);
+insert into s(word, soundslike) values('phone', 'fone');
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		sql  string
+		want string
+	}{
+		// spewing and smelling differ in the first 3 characters of soundex.
+		{"select word from s where word match 'speling'", "spelling spell"},
+		{"select word from s where word match 'speling' and scope = 1", "spelling spewing smelling spell"},
+		{"select word from s where word match 'speling' and scope = 1 and top = 2", "spelling spewing"},
+		{"select word from s where word match 'speling' and distance <= 100", "spelling"},
+		{"select word from s where word match 'speling' and distance < 100", ""},
+		{"select word from s where word match 'SPELLING'", "spelling spell"},
+		{"select word || ' ' || distance || ' ' || matchlen from s where word match 'spel*' and top = 1", "spelling 0 4"},
+		{"select word || ' ' || langid from s where word match 'speling' and langid = 1", "spelling 1"},
+		{"select word from s where word match 'fone'", "phone"},
+		{"select word from s where word match 'aple'", "apple"},
+		{"select word from s where word match 'xyz'", ""},
+		{"select word from s where rowid = 3", "spell"},
+		{"select word from s where langid = 1", "spelling"},
+		{"select count(*) from s where distance is null", "7"},
+		{"select count(*) from s_vocab", "7"},
+	} {
+		if g := spellfixWords(t, db, v.sql); g != v.want {
+			t.Errorf("%s: got %q, want %q", v.sql, g, v.want)
+		}
+	}
+
+	var phonehash string
+	if err := db.QueryRow("select phonehash from s where rowid = 1").Scan(&phonehash); err != nil || phonehash != "S145" {
+		t.Fatalf("got %q %v, want S145", phonehash, err)
+	}
+
+	if _, err := db.Exec("update s set word = 'spelt' where rowid = 3; delete from s where word = 'spewing'"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := spellfixWords(t, db, "select word from s where word match 'spelt'"), "spelt spelling"; g != e {
+		t.Fatalf("got %q, want %q", g, e)
+	}
+
+	if _, err := db.Exec("insert into s(command) values('reset')"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		sql string
+		err string
+	}{
+		{"insert into s(command) values('bogus')", `unknown value for s.command: "bogus"`},
+		{"insert into s(word) values(null)", "NOT NULL constraint failed: s.word"},
+		{"create virtual table bad using spellfix1(x)", "unsupported argument"},
+	} {
+		if _, err := db.Exec(v.sql); err == nil || !strings.Contains(err.Error(), v.err) {
+			t.Errorf("%s: got %v, want %q", v.sql, err, v.err)
+		}
+	}
+
+	if _, err := db.Exec("alter table s rename to r"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := spellfixWords(t, db, "select word from r where word match 'aple'"), "apple"; g != e {
+		t.Fatalf("got %q, want %q", g, e)
+	}
+
+	if _, err := db.Exec("drop table r"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := spellfixWords(t, db, "select name from sqlite_master"); g != "" {
+		t.Fatalf("shadow tables not dropped: %s", g)
+	}
+}
+
+// TestSpellfixScope checks a MATCH examines only the words whose phonetic
+// hash shares the first scope characters with the one of the pattern.
+func TestSpellfixScope(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec("create virtual table s using spellfix1; insert into s(word) values('spelling'), ('spilling'), ('spoiling'), ('spells'), ('sobbing'), ('sweet')"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if _, err := db.Exec("insert into s(word) values(?)", fmt.Sprintf("word%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, v := range []struct {
+		scope   string
+		srchcnt int
+		words   string
+	}{
+		{"", 4, "spelling spilling spoiling spells"},
+		{"and scope = 4", 3, "spelling spilling spoiling"},
+		{"and scope = 9", 3, "spelling spilling spoiling"},
+		{"and scope = 2", 5, "spelling spilling spoiling spells sobbing"},
+		{"and scope = 1", 6, "spelling spilling spoiling spells sobbing sweet"},
+		{"and scope = 0", 6, "spelling spilling spoiling spells sobbing sweet"},
+	} {
+		q := "select word, srchcnt from s where word match 'speling' " + v.scope
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var words []string
+		var srchcnt int
+		for rows.Next() {
+			var w string
+			if err := rows.Scan(&w, &srchcnt); err != nil {
+				t.Fatal(err)
+			}
+
+			words = append(words, w)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		rows.Close()
+		if g := strings.Join(words, " "); g != v.words || srchcnt != v.srchcnt {
+			t.Errorf("%s: got %q %d, want %q %d", q, g, srchcnt, v.words, v.srchcnt)
+		}
+	}
+
+	// The vocabulary lookup uses the (langid, k2) index.
+	var id, parent, notused int
+	var plan string
+	if err := db.QueryRow("explain query plan select id from s_vocab where langid = 0 and k2 >= 'S14' and k2 < 'S15'").Scan(&id, &parent, &notused, &plan); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(plan, "s_vocab_index_langid_k2") {
+		t.Fatalf("got plan %q", plan)
+	}
+}
+
+func TestSpellfixEditdist(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	for _, v := range []struct {
+		a, b interface{}
+		want interface{}
+	}{
+		{"kitten", "kitten", int64(0)},
+		{"Kitten", "kitten", int64(0)},
+		{"kitten", "kittens", int64(100)},
+		{"kittens", "kitten", int64(100)},
+		{"kitten", "sitten", int64(150)},
+		{"kitten", "sitting", int64(400)},
+		{"", "abc", int64(300)},
+		{"héllo", "hello", int64(150)},
+		{nil, "a", nil},
+	} {
+		var g interface{}
+		if err := db.QueryRow("select spellfix1_editdist(?, ?)", v.a, v.b).Scan(&g); err != nil {
+			t.Fatal(err)
+		}
+
+		if g != v.want {
+			t.Errorf("spellfix1_editdist(%v, %v): got %v, want %v", v.a, v.b, g, v.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"bytes"
+	"compress/zlib"
+	"database/sql/driver"
+	"fmt"
+	"io"
+)
+
+// The functions of ext/misc/sqlar.c of the SQLite source tree, which compress
+// the content of SQLite Archive files, see https://www.sqlite.org/sqlar.html.
+
+func init() {
+	MustRegisterDeterministicScalarFunction("sqlar_compress", 1, sqlarCompress)
+	MustRegisterDeterministicScalarFunction("sqlar_uncompress", 2, sqlarUncompress)
+}
+
+// sqlar_compress(X) returns the blob X compressed by zlib if that makes it
+// smaller, X unchanged otherwise. Values other than blobs are returned
+// unchanged.
+func sqlarCompress(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	b, ok := args[0].([]byte)
+	if !ok {
+		return args[0], nil
+	}
+
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	if buf.Len() < len(b) {
+		return buf.Bytes(), nil
+	}
+
+	return b, nil
+}
+
+// sqlar_uncompress(X, SZ) returns X uncompressed to SZ bytes, or X unchanged
+// if SZ is not positive or the size of X is SZ already.
+func sqlarUncompress(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	sz, _ := args[1].(int64)
+	b, ok := valueBytes(args[0])
+	if !ok || sz <= 0 || int64(len(b)) == sz {
+		return args[0], nil
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("error in uncompress()")
+	}
+
+	out := make([]byte, sz)
+	if _, err := io.ReadFull(r, out); err != nil {
+		return nil, fmt.Errorf("error in uncompress()")
+	}
+
+	return out, nil
+}
@@ -0,0 +1,322 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sqlar reads and writes SQLite Archive files, databases holding
+// files in the table sqlar, see https://www.sqlite.org/sqlar.html. The
+// archives are compatible with the -A options of the sqlite3 command line
+// shell. File contents are compressed by zlib unless that does not make them
+// smaller, using the sqlar_compress and sqlar_uncompress SQL functions of
+// this driver.
+package sqlar // import "modernc.org/sqlite/sqlar"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// ErrNotFound is returned for a name not in the archive.
+var ErrNotFound = errors.New("sqlar: file not found")
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Archive is an SQLite Archive.
+type Archive struct {
+	db *sql.DB
+}
+
+// Open opens the archive name, a data source name as passed to sql.Open for
+// this driver, creating the database and the sqlar table if they do not
+// exist.
+func Open(name string) (*Archive, error) {
+	db, err := sql.Open("sqlite3", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec("create table if not exists sqlar(name text primary key, mode int, mtime int, sz int, data blob)"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Archive{db: db}, nil
+}
+
+// Close closes the database of a.
+func (a *Archive) Close() error { return a.db.Close() }
+
+// DB returns the database of a.
+func (a *Archive) DB() *sql.DB { return a.db }
+
+// Entry describes a file of an archive.
+type Entry struct {
+	Name    string
+	Mode    fs.FileMode
+	ModTime time.Time
+	Size    int64 // Uncompressed size of a regular file.
+}
+
+// Add adds the regular file name with the content data, replacing an
+// existing entry of that name.
+func (a *Archive) Add(ctx context.Context, name string, mode fs.FileMode, mtime time.Time, data []byte) error {
+	return put(ctx, a.db, name, mode.Perm(), mtime, data)
+}
+
+// AddDir adds the directory name.
+func (a *Archive) AddDir(ctx context.Context, name string, mode fs.FileMode, mtime time.Time) error {
+	return put(ctx, a.db, name, fs.ModeDir|mode.Perm(), mtime, nil)
+}
+
+// AddSymlink adds the symbolic link name pointing to target.
+func (a *Archive) AddSymlink(ctx context.Context, name, target string, mtime time.Time) error {
+	return put(ctx, a.db, name, fs.ModeSymlink|0o777, mtime, []byte(target))
+}
+
+// put adds an entry. Like the sqlite3 shell, put stores the size of a
+// directory as 0 and of a symbolic link as -1, the content of a symbolic link
+// is its target.
+func put(ctx context.Context, e execer, name string, mode fs.FileMode, mtime time.Time, data []byte) error {
+	if !fs.ValidPath(name) || name == "." {
+		return fmt.Errorf("sqlar: invalid name %q", name)
+	}
+
+	sz, value := int64(len(data)), "sqlar_compress(?)"
+	switch {
+	case mode.IsDir():
+		sz, value = 0, "?"
+		data = nil
+	case mode&fs.ModeSymlink != 0:
+		sz, value = -1, "?"
+	case data == nil:
+		data = []byte{}
+	}
+	_, err := e.ExecContext(ctx, "insert or replace into sqlar(name, mode, mtime, sz, data) values(?, ?, ?, ?, "+value+")", name, unixMode(mode), mtime.Unix(), sz, data)
+	return err
+}
+
+// AddFiles adds the files, directories, recursively, and symbolic links
+// named by paths in one transaction, like "sqlite3 -Ac ARCHIVE PATHS...".
+// The entries are named by the paths, in slash separated form, which must be
+// relative and must not contain ".." elements. Devices, pipes and sockets
+// are skipped.
+func (a *Archive) AddFiles(ctx context.Context, paths ...string) (err error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	for _, root := range paths {
+		if err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			name := filepath.ToSlash(filepath.Clean(p))
+			switch m := fi.Mode(); {
+			case m.IsDir():
+				return put(ctx, tx, name, m, fi.ModTime(), nil)
+			case m&fs.ModeSymlink != 0:
+				target, err := os.Readlink(p)
+				if err != nil {
+					return err
+				}
+
+				return put(ctx, tx, name, m, fi.ModTime(), []byte(target))
+			case m.IsRegular():
+				data, err := os.ReadFile(p)
+				if err != nil {
+					return err
+				}
+
+				return put(ctx, tx, name, m, fi.ModTime(), data)
+			default:
+				return nil
+			}
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the entries of the archive ordered by name.
+func (a *Archive) List(ctx context.Context) (r []Entry, err error) {
+	rows, err := a.db.QueryContext(ctx, "select name, mode, mtime, sz from sqlar order by name")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Entry
+		var mode, mtime int64
+		if err := rows.Scan(&e.Name, &mode, &mtime, &e.Size); err != nil {
+			return nil, err
+		}
+
+		e.Mode, e.ModTime = fileMode(mode), time.Unix(mtime, 0)
+		if !e.Mode.IsRegular() {
+			e.Size = 0
+		}
+		r = append(r, e)
+	}
+	return r, rows.Err()
+}
+
+// ReadFile returns the content of the regular file name, or the target of
+// the symbolic link name.
+func (a *Archive) ReadFile(ctx context.Context, name string) (data []byte, err error) {
+	var mode int64
+	switch err = a.db.QueryRowContext(ctx, "select mode, sqlar_uncompress(data, sz) from sqlar where name = ?", name).Scan(&mode, &data); {
+	case err == sql.ErrNoRows:
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, err
+	}
+
+	if fileMode(mode).IsDir() {
+		return nil, fmt.Errorf("sqlar: %s is a directory", name)
+	}
+
+	if data == nil {
+		data = []byte{}
+	}
+	return data, nil
+}
+
+// Extract writes the entries of the archive to the directory dir, like
+// "sqlite3 -Ax ARCHIVE". Existing files are overwritten. Names escaping dir
+// are an error. The modification times of directories are set after their
+// files are written.
+func (a *Archive) Extract(ctx context.Context, dir string) error {
+	entries, err := a.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var dirs []Entry
+	for _, e := range entries {
+		if !fs.ValidPath(e.Name) || strings.Contains(e.Name, `\`) {
+			return fmt.Errorf("sqlar: invalid name %q", e.Name)
+		}
+
+		p := filepath.Join(dir, filepath.FromSlash(e.Name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o777); err != nil {
+			return err
+		}
+
+		switch {
+		case e.Mode.IsDir():
+			if err := os.MkdirAll(p, e.Mode.Perm()|0o700); err != nil {
+				return err
+			}
+
+			dirs = append(dirs, e)
+			continue
+		case e.Mode&fs.ModeSymlink != 0:
+			target, err := a.ReadFile(ctx, e.Name)
+			if err != nil {
+				return err
+			}
+
+			os.Remove(p)
+			if err := os.Symlink(string(target), p); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		data, err := a.ReadFile(ctx, e.Name)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(p, data, e.Mode.Perm()); err != nil {
+			return err
+		}
+
+		if err := os.Chmod(p, e.Mode.Perm()); err != nil {
+			return err
+		}
+
+		if err := os.Chtimes(p, e.ModTime, e.ModTime); err != nil {
+			return err
+		}
+	}
+	// In reverse name order, so the time of a directory is set after the
+	// times of its subdirectories.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		e := dirs[i]
+		p := filepath.Join(dir, filepath.FromSlash(e.Name))
+		if err := os.Chtimes(p, e.ModTime, e.ModTime); err != nil {
+			return err
+		}
+
+		if err := os.Chmod(p, e.Mode.Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unix file types of the st_mode stored in the mode column.
+const (
+	modeType    = 0o170000
+	modeDir     = 0o040000
+	modeRegular = 0o100000
+	modeSymlink = 0o120000
+)
+
+// unixMode returns m as the st_mode of a Unix file.
+func unixMode(m fs.FileMode) int64 {
+	mode := int64(m.Perm())
+	switch {
+	case m.IsDir():
+		mode |= modeDir
+	case m&fs.ModeSymlink != 0:
+		mode |= modeSymlink
+	default:
+		mode |= modeRegular
+	}
+	return mode
+}
+
+// fileMode returns mode, the st_mode of a Unix file, as an fs.FileMode.
+func fileMode(mode int64) fs.FileMode {
+	m := fs.FileMode(mode & 0o777)
+	switch mode & modeType {
+	case modeDir:
+		m |= fs.ModeDir
+	case modeSymlink:
+		m |= fs.ModeSymlink
+	}
+	return m
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlar_test // import "modernc.org/sqlite/sqlar"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"modernc.org/sqlite/sqlar"
+)
+
+func TestArchive(t *testing.T) {
+	tmp := t.TempDir()
+	src := filepath.Join(tmp, "src")
+	big := bytes.Repeat([]byte("compressible "), 1000)
+	mtime := time.Date(2022, 11, 16, 12, 0, 0, 0, time.UTC)
+	for name, data := range map[string][]byte{"a.txt": []byte("hello"), "sub/big.txt": big, "sub/empty": nil} {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(p, data, 0o640); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlinks := runtime.GOOS != "windows"
+	if symlinks {
+		if err := os.Symlink("a.txt", filepath.Join(src, "link")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Chdir(wd)
+
+	a, err := sqlar.Open(filepath.Join(tmp, "test.sqlar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer a.Close()
+
+	ctx := context.Background()
+	if err := a.AddFiles(ctx, "src"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Add(ctx, "extra.txt", 0o600, mtime, []byte("extra")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Add(ctx, "../escape", 0o600, mtime, nil); err == nil {
+		t.Fatal("unexpected success adding an invalid name")
+	}
+
+	entries, err := a.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var list []string
+	for _, e := range entries {
+		list = append(list, fmt.Sprintf("%s %v %d", e.Name, e.Mode, e.Size))
+	}
+	want := "extra.txt -rw------- 5, src drwxr-xr-x 0, src/a.txt -rw-r----- 5, src/link Lrwxrwxrwx 0, src/sub drwxr-xr-x 0, src/sub/big.txt -rw-r----- 13000, src/sub/empty -rw-r----- 0"
+	if !symlinks {
+		want = strings.Replace(want, "src/link Lrwxrwxrwx 0, ", "", 1)
+	}
+	if g := strings.Join(list, ", "); g != want {
+		t.Fatalf("got\n%s\nwant\n%s", g, want)
+	}
+
+	// The big file is compressed.
+	var sz, n int
+	if err := a.DB().QueryRow("select sz, length(data) from sqlar where name = 'src/sub/big.txt'").Scan(&sz, &n); err != nil || n >= sz {
+		t.Fatalf("%d bytes stored for %d, %v", n, sz, err)
+	}
+
+	if data, err := a.ReadFile(ctx, "src/sub/big.txt"); err != nil || !bytes.Equal(data, big) {
+		t.Fatalf("%d bytes, %v", len(data), err)
+	}
+
+	if _, err := a.ReadFile(ctx, "nonexistent"); err != sqlar.ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	dst := filepath.Join(tmp, "dst")
+	if err := a.Extract(ctx, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"src/a.txt", "src/sub/big.txt", "src/sub/empty"} {
+		g, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		e, err := os.ReadFile(filepath.Join(tmp, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(g, e) {
+			t.Errorf("%s: content differs", name)
+		}
+
+		fi, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil || !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s: %v, %v", name, fi.ModTime(), err)
+		}
+	}
+	if symlinks {
+		if target, err := os.Readlink(filepath.Join(dst, "src", "link")); err != nil || target != "a.txt" {
+			t.Errorf("link target %q, %v", target, err)
+		}
+	}
+}
@@ -10,11 +10,14 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/url"
+	"os"
 	"reflect"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
@@ -41,8 +44,11 @@ var (
 	_ driver.RowsColumnTypeNullable         = (*rows)(nil)
 	_ driver.RowsColumnTypePrecisionScale   = (*rows)(nil)
 	_ driver.RowsColumnTypeScanType         = (*rows)(nil)
+	_ driver.RowsNextResultSet              = (*rows)(nil)
 	_ driver.Stmt                           = (*stmt)(nil)
 	_ driver.Tx                             = (*tx)(nil)
+	_ driver.SessionResetter                = (*conn)(nil)
+	_ driver.Validator                      = (*conn)(nil)
 	_ error                                 = (*Error)(nil)
 )
 
@@ -54,67 +60,126 @@ const (
 
 // Error represents sqlite library error code.
 type Error struct {
-	msg  string
-	code int
+	msg        string
+	code       int
+	constraint *Constraint // See Error.Constraint.
 }
 
 // Error implements error.
 func (e *Error) Error() string { return e.msg }
 
-// Code returns the sqlite result code for this error.
+// Code returns the sqlite result code for this error. Connections enable
+// extended result codes, so it is an extended code, like
+// SQLITE_CONSTRAINT_UNIQUE, where SQLite provides one. The codes are
+// available as constants in modernc.org/sqlite/sqlitecode.
 func (e *Error) Code() int { return e.code }
 
 var (
 	// ErrorCodeString maps Error.Code() to its string representation.
 	ErrorCodeString = map[int]string{
-		sqlite3.SQLITE_ABORT:             "Callback routine requested an abort (SQLITE_ABORT)",
-		sqlite3.SQLITE_AUTH:              "Authorization denied (SQLITE_AUTH)",
-		sqlite3.SQLITE_BUSY:              "The database file is locked (SQLITE_BUSY)",
-		sqlite3.SQLITE_CANTOPEN:          "Unable to open the database file (SQLITE_CANTOPEN)",
-		sqlite3.SQLITE_CONSTRAINT:        "Abort due to constraint violation (SQLITE_CONSTRAINT)",
-		sqlite3.SQLITE_CORRUPT:           "The database disk image is malformed (SQLITE_CORRUPT)",
-		sqlite3.SQLITE_DONE:              "sqlite3_step() has finished executing (SQLITE_DONE)",
-		sqlite3.SQLITE_EMPTY:             "Internal use only (SQLITE_EMPTY)",
-		sqlite3.SQLITE_ERROR:             "Generic error (SQLITE_ERROR)",
-		sqlite3.SQLITE_FORMAT:            "Not used (SQLITE_FORMAT)",
-		sqlite3.SQLITE_FULL:              "Insertion failed because database is full (SQLITE_FULL)",
-		sqlite3.SQLITE_INTERNAL:          "Internal logic error in SQLite (SQLITE_INTERNAL)",
-		sqlite3.SQLITE_INTERRUPT:         "Operation terminated by sqlite3_interrupt()(SQLITE_INTERRUPT)",
-		sqlite3.SQLITE_IOERR | (1 << 8):  "(SQLITE_IOERR_READ)",
-		sqlite3.SQLITE_IOERR | (10 << 8): "(SQLITE_IOERR_DELETE)",
-		sqlite3.SQLITE_IOERR | (11 << 8): "(SQLITE_IOERR_BLOCKED)",
-		sqlite3.SQLITE_IOERR | (12 << 8): "(SQLITE_IOERR_NOMEM)",
-		sqlite3.SQLITE_IOERR | (13 << 8): "(SQLITE_IOERR_ACCESS)",
-		sqlite3.SQLITE_IOERR | (14 << 8): "(SQLITE_IOERR_CHECKRESERVEDLOCK)",
-		sqlite3.SQLITE_IOERR | (15 << 8): "(SQLITE_IOERR_LOCK)",
-		sqlite3.SQLITE_IOERR | (16 << 8): "(SQLITE_IOERR_CLOSE)",
-		sqlite3.SQLITE_IOERR | (17 << 8): "(SQLITE_IOERR_DIR_CLOSE)",
-		sqlite3.SQLITE_IOERR | (2 << 8):  "(SQLITE_IOERR_SHORT_READ)",
-		sqlite3.SQLITE_IOERR | (3 << 8):  "(SQLITE_IOERR_WRITE)",
-		sqlite3.SQLITE_IOERR | (4 << 8):  "(SQLITE_IOERR_FSYNC)",
-		sqlite3.SQLITE_IOERR | (5 << 8):  "(SQLITE_IOERR_DIR_FSYNC)",
-		sqlite3.SQLITE_IOERR | (6 << 8):  "(SQLITE_IOERR_TRUNCATE)",
-		sqlite3.SQLITE_IOERR | (7 << 8):  "(SQLITE_IOERR_FSTAT)",
-		sqlite3.SQLITE_IOERR | (8 << 8):  "(SQLITE_IOERR_UNLOCK)",
-		sqlite3.SQLITE_IOERR | (9 << 8):  "(SQLITE_IOERR_RDLOCK)",
-		sqlite3.SQLITE_IOERR:             "Some kind of disk I/O error occurred (SQLITE_IOERR)",
-		sqlite3.SQLITE_LOCKED | (1 << 8): "(SQLITE_LOCKED_SHAREDCACHE)",
-		sqlite3.SQLITE_LOCKED:            "A table in the database is locked (SQLITE_LOCKED)",
-		sqlite3.SQLITE_MISMATCH:          "Data type mismatch (SQLITE_MISMATCH)",
-		sqlite3.SQLITE_MISUSE:            "Library used incorrectly (SQLITE_MISUSE)",
-		sqlite3.SQLITE_NOLFS:             "Uses OS features not supported on host (SQLITE_NOLFS)",
-		sqlite3.SQLITE_NOMEM:             "A malloc() failed (SQLITE_NOMEM)",
-		sqlite3.SQLITE_NOTADB:            "File opened that is not a database file (SQLITE_NOTADB)",
-		sqlite3.SQLITE_NOTFOUND:          "Unknown opcode in sqlite3_file_control() (SQLITE_NOTFOUND)",
-		sqlite3.SQLITE_NOTICE:            "Notifications from sqlite3_log() (SQLITE_NOTICE)",
-		sqlite3.SQLITE_PERM:              "Access permission denied (SQLITE_PERM)",
-		sqlite3.SQLITE_PROTOCOL:          "Database lock protocol error (SQLITE_PROTOCOL)",
-		sqlite3.SQLITE_RANGE:             "2nd parameter to sqlite3_bind out of range (SQLITE_RANGE)",
-		sqlite3.SQLITE_READONLY:          "Attempt to write a readonly database (SQLITE_READONLY)",
-		sqlite3.SQLITE_ROW:               "sqlite3_step() has another row ready (SQLITE_ROW)",
-		sqlite3.SQLITE_SCHEMA:            "The database schema changed (SQLITE_SCHEMA)",
-		sqlite3.SQLITE_TOOBIG:            "String or BLOB exceeds size limit (SQLITE_TOOBIG)",
-		sqlite3.SQLITE_WARNING:           "Warnings from sqlite3_log() (SQLITE_WARNING)",
+		sqlite3.SQLITE_ABORT:                   "Callback routine requested an abort (SQLITE_ABORT)",
+		sqlite3.SQLITE_ABORT_ROLLBACK:          "(SQLITE_ABORT_ROLLBACK)",
+		sqlite3.SQLITE_AUTH:                    "Authorization denied (SQLITE_AUTH)",
+		sqlite3.SQLITE_AUTH_USER:               "(SQLITE_AUTH_USER)",
+		sqlite3.SQLITE_BUSY:                    "The database file is locked (SQLITE_BUSY)",
+		sqlite3.SQLITE_BUSY_RECOVERY:           "(SQLITE_BUSY_RECOVERY)",
+		sqlite3.SQLITE_BUSY_SNAPSHOT:           "(SQLITE_BUSY_SNAPSHOT)",
+		sqlite3.SQLITE_BUSY_TIMEOUT:            "(SQLITE_BUSY_TIMEOUT)",
+		sqlite3.SQLITE_CANTOPEN:                "Unable to open the database file (SQLITE_CANTOPEN)",
+		sqlite3.SQLITE_CANTOPEN_CONVPATH:       "(SQLITE_CANTOPEN_CONVPATH)",
+		sqlite3.SQLITE_CANTOPEN_DIRTYWAL:       "(SQLITE_CANTOPEN_DIRTYWAL)",
+		sqlite3.SQLITE_CANTOPEN_FULLPATH:       "(SQLITE_CANTOPEN_FULLPATH)",
+		sqlite3.SQLITE_CANTOPEN_ISDIR:          "(SQLITE_CANTOPEN_ISDIR)",
+		sqlite3.SQLITE_CANTOPEN_NOTEMPDIR:      "(SQLITE_CANTOPEN_NOTEMPDIR)",
+		sqlite3.SQLITE_CANTOPEN_SYMLINK:        "(SQLITE_CANTOPEN_SYMLINK)",
+		sqlite3.SQLITE_CONSTRAINT:              "Abort due to constraint violation (SQLITE_CONSTRAINT)",
+		sqlite3.SQLITE_CONSTRAINT_CHECK:        "A CHECK constraint failed (SQLITE_CONSTRAINT_CHECK)",
+		sqlite3.SQLITE_CONSTRAINT_COMMITHOOK:   "A commit hook requested a rollback (SQLITE_CONSTRAINT_COMMITHOOK)",
+		sqliteConstraintDatatype:               "A value does not match the type of a STRICT table column (SQLITE_CONSTRAINT_DATATYPE)",
+		sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:   "A foreign key constraint failed (SQLITE_CONSTRAINT_FOREIGNKEY)",
+		sqlite3.SQLITE_CONSTRAINT_FUNCTION:     "A constraint raised by an extension function failed (SQLITE_CONSTRAINT_FUNCTION)",
+		sqlite3.SQLITE_CONSTRAINT_NOTNULL:      "A NOT NULL constraint failed (SQLITE_CONSTRAINT_NOTNULL)",
+		sqlite3.SQLITE_CONSTRAINT_PINNED:       "A row of an ON CONFLICT DO UPDATE is pinned (SQLITE_CONSTRAINT_PINNED)",
+		sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:   "A PRIMARY KEY constraint failed (SQLITE_CONSTRAINT_PRIMARYKEY)",
+		sqlite3.SQLITE_CONSTRAINT_ROWID:        "A rowid is not unique (SQLITE_CONSTRAINT_ROWID)",
+		sqlite3.SQLITE_CONSTRAINT_TRIGGER:      "A RAISE function in a trigger raised an error (SQLITE_CONSTRAINT_TRIGGER)",
+		sqlite3.SQLITE_CONSTRAINT_UNIQUE:       "A UNIQUE constraint failed (SQLITE_CONSTRAINT_UNIQUE)",
+		sqlite3.SQLITE_CONSTRAINT_VTAB:         "A constraint of a virtual table failed (SQLITE_CONSTRAINT_VTAB)",
+		sqlite3.SQLITE_CORRUPT:                 "The database disk image is malformed (SQLITE_CORRUPT)",
+		sqlite3.SQLITE_CORRUPT_INDEX:           "(SQLITE_CORRUPT_INDEX)",
+		sqlite3.SQLITE_CORRUPT_SEQUENCE:        "(SQLITE_CORRUPT_SEQUENCE)",
+		sqlite3.SQLITE_CORRUPT_VTAB:            "(SQLITE_CORRUPT_VTAB)",
+		sqlite3.SQLITE_DONE:                    "sqlite3_step() has finished executing (SQLITE_DONE)",
+		sqlite3.SQLITE_EMPTY:                   "Internal use only (SQLITE_EMPTY)",
+		sqlite3.SQLITE_ERROR:                   "Generic error (SQLITE_ERROR)",
+		sqlite3.SQLITE_ERROR_MISSING_COLLSEQ:   "(SQLITE_ERROR_MISSING_COLLSEQ)",
+		sqlite3.SQLITE_ERROR_RETRY:             "(SQLITE_ERROR_RETRY)",
+		sqlite3.SQLITE_ERROR_SNAPSHOT:          "(SQLITE_ERROR_SNAPSHOT)",
+		sqlite3.SQLITE_FORMAT:                  "Not used (SQLITE_FORMAT)",
+		sqlite3.SQLITE_FULL:                    "Insertion failed because database is full (SQLITE_FULL)",
+		sqlite3.SQLITE_INTERNAL:                "Internal logic error in SQLite (SQLITE_INTERNAL)",
+		sqlite3.SQLITE_INTERRUPT:               "Operation terminated by sqlite3_interrupt()(SQLITE_INTERRUPT)",
+		sqlite3.SQLITE_IOERR | (1 << 8):        "(SQLITE_IOERR_READ)",
+		sqlite3.SQLITE_IOERR | (10 << 8):       "(SQLITE_IOERR_DELETE)",
+		sqlite3.SQLITE_IOERR | (11 << 8):       "(SQLITE_IOERR_BLOCKED)",
+		sqlite3.SQLITE_IOERR | (12 << 8):       "(SQLITE_IOERR_NOMEM)",
+		sqlite3.SQLITE_IOERR | (13 << 8):       "(SQLITE_IOERR_ACCESS)",
+		sqlite3.SQLITE_IOERR | (14 << 8):       "(SQLITE_IOERR_CHECKRESERVEDLOCK)",
+		sqlite3.SQLITE_IOERR | (15 << 8):       "(SQLITE_IOERR_LOCK)",
+		sqlite3.SQLITE_IOERR | (16 << 8):       "(SQLITE_IOERR_CLOSE)",
+		sqlite3.SQLITE_IOERR | (17 << 8):       "(SQLITE_IOERR_DIR_CLOSE)",
+		sqlite3.SQLITE_IOERR | (2 << 8):        "(SQLITE_IOERR_SHORT_READ)",
+		sqlite3.SQLITE_IOERR | (3 << 8):        "(SQLITE_IOERR_WRITE)",
+		sqlite3.SQLITE_IOERR | (4 << 8):        "(SQLITE_IOERR_FSYNC)",
+		sqlite3.SQLITE_IOERR | (5 << 8):        "(SQLITE_IOERR_DIR_FSYNC)",
+		sqlite3.SQLITE_IOERR | (6 << 8):        "(SQLITE_IOERR_TRUNCATE)",
+		sqlite3.SQLITE_IOERR | (7 << 8):        "(SQLITE_IOERR_FSTAT)",
+		sqlite3.SQLITE_IOERR | (8 << 8):        "(SQLITE_IOERR_UNLOCK)",
+		sqlite3.SQLITE_IOERR | (9 << 8):        "(SQLITE_IOERR_RDLOCK)",
+		sqlite3.SQLITE_IOERR:                   "Some kind of disk I/O error occurred (SQLITE_IOERR)",
+		sqlite3.SQLITE_IOERR_AUTH:              "(SQLITE_IOERR_AUTH)",
+		sqlite3.SQLITE_IOERR_BEGIN_ATOMIC:      "(SQLITE_IOERR_BEGIN_ATOMIC)",
+		sqlite3.SQLITE_IOERR_COMMIT_ATOMIC:     "(SQLITE_IOERR_COMMIT_ATOMIC)",
+		sqlite3.SQLITE_IOERR_CONVPATH:          "(SQLITE_IOERR_CONVPATH)",
+		sqliteIOErrCorruptFS:                   "(SQLITE_IOERR_CORRUPTFS)",
+		sqlite3.SQLITE_IOERR_DATA:              "(SQLITE_IOERR_DATA)",
+		sqlite3.SQLITE_IOERR_DELETE_NOENT:      "(SQLITE_IOERR_DELETE_NOENT)",
+		sqlite3.SQLITE_IOERR_GETTEMPPATH:       "(SQLITE_IOERR_GETTEMPPATH)",
+		sqlite3.SQLITE_IOERR_MMAP:              "(SQLITE_IOERR_MMAP)",
+		sqlite3.SQLITE_IOERR_ROLLBACK_ATOMIC:   "(SQLITE_IOERR_ROLLBACK_ATOMIC)",
+		sqlite3.SQLITE_IOERR_SEEK:              "(SQLITE_IOERR_SEEK)",
+		sqlite3.SQLITE_IOERR_SHMLOCK:           "(SQLITE_IOERR_SHMLOCK)",
+		sqlite3.SQLITE_IOERR_SHMMAP:            "(SQLITE_IOERR_SHMMAP)",
+		sqlite3.SQLITE_IOERR_SHMOPEN:           "(SQLITE_IOERR_SHMOPEN)",
+		sqlite3.SQLITE_IOERR_SHMSIZE:           "(SQLITE_IOERR_SHMSIZE)",
+		sqlite3.SQLITE_IOERR_VNODE:             "(SQLITE_IOERR_VNODE)",
+		sqlite3.SQLITE_LOCKED | (1 << 8):       "(SQLITE_LOCKED_SHAREDCACHE)",
+		sqlite3.SQLITE_LOCKED:                  "A table in the database is locked (SQLITE_LOCKED)",
+		sqlite3.SQLITE_LOCKED_VTAB:             "(SQLITE_LOCKED_VTAB)",
+		sqlite3.SQLITE_MISMATCH:                "Data type mismatch (SQLITE_MISMATCH)",
+		sqlite3.SQLITE_MISUSE:                  "Library used incorrectly (SQLITE_MISUSE)",
+		sqlite3.SQLITE_NOLFS:                   "Uses OS features not supported on host (SQLITE_NOLFS)",
+		sqlite3.SQLITE_NOMEM:                   "A malloc() failed (SQLITE_NOMEM)",
+		sqlite3.SQLITE_NOTADB:                  "File opened that is not a database file (SQLITE_NOTADB)",
+		sqlite3.SQLITE_NOTFOUND:                "Unknown opcode in sqlite3_file_control() (SQLITE_NOTFOUND)",
+		sqlite3.SQLITE_NOTICE:                  "Notifications from sqlite3_log() (SQLITE_NOTICE)",
+		sqlite3.SQLITE_NOTICE_RECOVER_ROLLBACK: "(SQLITE_NOTICE_RECOVER_ROLLBACK)",
+		sqlite3.SQLITE_NOTICE_RECOVER_WAL:      "(SQLITE_NOTICE_RECOVER_WAL)",
+		sqlite3.SQLITE_PERM:                    "Access permission denied (SQLITE_PERM)",
+		sqlite3.SQLITE_PROTOCOL:                "Database lock protocol error (SQLITE_PROTOCOL)",
+		sqlite3.SQLITE_RANGE:                   "2nd parameter to sqlite3_bind out of range (SQLITE_RANGE)",
+		sqlite3.SQLITE_READONLY:                "Attempt to write a readonly database (SQLITE_READONLY)",
+		sqlite3.SQLITE_READONLY_CANTINIT:       "(SQLITE_READONLY_CANTINIT)",
+		sqlite3.SQLITE_READONLY_CANTLOCK:       "(SQLITE_READONLY_CANTLOCK)",
+		sqlite3.SQLITE_READONLY_DBMOVED:        "(SQLITE_READONLY_DBMOVED)",
+		sqlite3.SQLITE_READONLY_DIRECTORY:      "(SQLITE_READONLY_DIRECTORY)",
+		sqlite3.SQLITE_READONLY_RECOVERY:       "(SQLITE_READONLY_RECOVERY)",
+		sqlite3.SQLITE_READONLY_ROLLBACK:       "(SQLITE_READONLY_ROLLBACK)",
+		sqlite3.SQLITE_ROW:                     "sqlite3_step() has another row ready (SQLITE_ROW)",
+		sqlite3.SQLITE_SCHEMA:                  "The database schema changed (SQLITE_SCHEMA)",
+		sqlite3.SQLITE_TOOBIG:                  "String or BLOB exceeds size limit (SQLITE_TOOBIG)",
+		sqlite3.SQLITE_WARNING:                 "Warnings from sqlite3_log() (SQLITE_WARNING)",
+		sqlite3.SQLITE_WARNING_AUTOINDEX:       "(SQLITE_WARNING_AUTOINDEX)",
 	}
 )
 
@@ -124,11 +189,29 @@ func init() {
 
 type result struct {
 	lastInsertID int64
-	rowsAffected int
+	rowsAffected int64
 }
 
-func newResult(c *conn) (_ *result, err error) {
+// resultMark is the state of a connection before it executes statements, see
+// newResult.
+type resultMark struct {
+	totalChanges int64
+}
+
+func (c *conn) markResult() resultMark {
+	return resultMark{c.TotalChanges()}
+}
+
+// newResult returns the result of the statements executed since m. SQLite
+// leaves the number of changes and the last insert rowid of the last INSERT,
+// UPDATE or DELETE as they are when a statement modifies no row, like CREATE
+// TABLE or an upsert resolved by DO NOTHING, so both are zero then.
+func newResult(c *conn, m resultMark) (_ *result, err error) {
 	r := &result{}
+	if c.TotalChanges() == m.totalChanges {
+		return r, nil
+	}
+
 	if r.rowsAffected, err = c.changes(); err != nil {
 		return nil, err
 	}
@@ -141,7 +224,11 @@ func newResult(c *conn) (_ *result, err error) {
 }
 
 // LastInsertId returns the database's auto-generated ID after, for example, an
-// INSERT into a table with primary key.
+// INSERT into a table with primary key. It is the rowid of the last row
+// inserted by the connection, see
+// https://www.sqlite.org/c3ref/last_insert_rowid.html, or zero if the
+// statement modified no row. An upsert resolved by DO UPDATE inserts no row,
+// use a RETURNING clause to learn the rowid of the row it updates.
 func (r *result) LastInsertId() (int64, error) {
 	if r == nil {
 		return 0, nil
@@ -156,14 +243,32 @@ func (r *result) RowsAffected() (int64, error) {
 		return 0, nil
 	}
 
-	return int64(r.rowsAffected), nil
+	return r.rowsAffected, nil
 }
 
 type rows struct {
 	allocs  []uintptr
+	args    []driver.NamedValue
 	c       *conn
 	columns []string
 	pstmt   uintptr
+	sql     uintptr // Remaining statements of a multi statement query.
+	tail    uintptr // Unused portion of sql.
+
+	event *InterceptEvent // See conn.interceptQuery.
+	end   func(error)
+
+	// The context of the query, its statements are interrupted when it is
+	// done until the rows are closed, see stmt.query.
+	ctx           context.Context
+	done          *int32
+	stopInterrupt func()
+
+	endQuery func() // See conn.startQuery.
+	rowCount int64  // Of the current result set, see SetQueryLimits.
+
+	kinds    []columnKind // See scanValue.
+	internal bool         // See conn.internalQuery.
 
 	doStep bool
 	empty  bool
@@ -179,28 +284,116 @@ func newRows(c *conn, pstmt uintptr, allocs []uintptr, empty bool) (r *rows, err
 		}
 	}()
 
-	n, err := c.columnCount(pstmt)
-	if err != nil {
+	if err = r.setColumns(); err != nil {
 		return nil, err
 	}
 
+	return r, nil
+}
+
+func (r *rows) setColumns() error {
+	n, err := r.c.columnCount(r.pstmt)
+	if err != nil {
+		return err
+	}
+
 	r.columns = make([]string, n)
+	r.kinds = nil
 	for i := range r.columns {
-		if r.columns[i], err = r.c.columnName(pstmt, i); err != nil {
-			return nil, err
+		if r.columns[i], err = r.c.columnName(r.pstmt, i); err != nil {
+			return err
 		}
 	}
 
-	return r, nil
+	return nil
 }
 
-// Close closes the rows iterator.
+// Close closes the rows iterator. database/sql also calls Close when the
+// context of the query is done. The statement, interrupted already if it was
+// running, is finalized, which rolls back its changes if it did not run to
+// completion, so the connection is left without an active statement.
 func (r *rows) Close() (err error) {
+	err = r.finalize()
+	r.c.free(r.sql)
+	r.sql = 0
+	r.tail = 0
+	if r.stopInterrupt != nil {
+		r.stopInterrupt()
+		r.stopInterrupt = nil
+	}
+	if r.endQuery != nil {
+		r.endQuery()
+		r.endQuery = nil
+	}
+	if r.ctx != nil {
+		err = ctxError(r.ctx, err)
+	}
+	if r.end != nil {
+		r.end(err)
+		r.end = nil
+	}
+	return err
+}
+
+func (r *rows) finalize() error {
+	pstmt := r.pstmt
+	r.pstmt = 0
+	err := r.c.finalize(pstmt)
 	for _, v := range r.allocs {
 		r.c.free(v)
 	}
 	r.allocs = nil
-	return r.c.finalize(r.pstmt)
+	r.c.releaseWriter()
+	r.c.signalLockRelease()
+	r.c.publishChanges()
+	return err
+}
+
+// HasNextResultSet is called at the end of the current result set and reports
+// whether there is another result set after the current one.
+func (r *rows) HasNextResultSet() bool {
+	return r.tail != 0 && strings.TrimSpace(libc.GoString(r.tail)) != ""
+}
+
+// NextResultSet advances the driver to the next result set even if there are
+// remaining rows in the current result set.
+//
+// NextResultSet should return io.EOF when there are no more result sets.
+func (r *rows) NextResultSet() (err error) {
+	if r.tail == 0 {
+		return io.EOF
+	}
+
+	if err = r.finalize(); err != nil {
+		return err
+	}
+
+	defer func() { err = r.c.queryLimitError(err) }()
+
+	ctx, done := r.ctx, r.done
+	if ctx == nil {
+		ctx, done = context.Background(), new(int32)
+	} else {
+		defer func() { err = ctxError(ctx, err) }()
+	}
+
+	pstmt, allocs, rc, err := r.c.start(ctx, &r.tail, r.args, done)
+	if err != nil {
+		return err
+	}
+
+	if pstmt == 0 {
+		r.columns = nil
+		r.empty = true
+		return io.EOF
+	}
+
+	r.pstmt = pstmt
+	r.allocs = allocs
+	r.rowCount = 0
+	r.doStep = false
+	r.empty = rc != sqlite3.SQLITE_ROW
+	return r.setColumns()
 }
 
 // Columns returns the names of the columns. The number of columns of the
@@ -215,6 +408,16 @@ func (r *rows) Columns() (c []string) {
 //
 // Next should return io.EOF when there are no more rows.
 func (r *rows) Next(dest []driver.Value) (err error) {
+	if r.event != nil {
+		defer func() { r.observe(err) }()
+	}
+
+	if r.ctx != nil {
+		defer func() { err = ctxError(r.ctx, err) }()
+	}
+
+	defer func() { err = r.c.queryLimitError(err) }()
+
 	if r.empty {
 		return io.EOF
 	}
@@ -229,6 +432,12 @@ func (r *rows) Next(dest []driver.Value) (err error) {
 	r.doStep = true
 	switch rc {
 	case sqlite3.SQLITE_ROW:
+		if max := r.c.maxRows(); max != 0 {
+			if r.rowCount++; r.rowCount > max {
+				return ErrMaxRows
+			}
+		}
+
 		if g, e := len(dest), len(r.columns); g != e {
 			return fmt.Errorf("sqlite: Next: have %v destination values, expected %v", g, e)
 		}
@@ -255,15 +464,29 @@ func (r *rows) Next(dest []driver.Value) (err error) {
 
 				dest[i] = v
 			case sqlite3.SQLITE_TEXT:
-				v, err := r.c.columnText(r.pstmt, i)
-				if err != nil {
-					return err
-				}
-
 				switch r.ColumnTypeDatabaseTypeName(i) {
 				case "DATE", "DATETIME", "TIMESTAMP":
+					v, err := r.c.columnText(r.pstmt, i)
+					if err != nil {
+						return err
+					}
+
 					dest[i], _ = r.c.parseTime(v)
 				default:
+					if r.c.textBytes && !r.internal {
+						b := r.RawText(i)
+						if b == nil {
+							b = []byte{}
+						}
+						dest[i] = b
+						break
+					}
+
+					v, err := r.c.columnText(r.pstmt, i)
+					if err != nil {
+						return err
+					}
+
 					dest[i] = v
 				}
 			case sqlite3.SQLITE_BLOB:
@@ -278,6 +501,11 @@ func (r *rows) Next(dest []driver.Value) (err error) {
 			default:
 				return fmt.Errorf("internal error: rc %d", rc)
 			}
+			if r.c.scan != scanStorage && !r.internal {
+				if dest[i], err = r.scanValue(i, dest[i]); err != nil {
+					return err
+				}
+			}
 		}
 		return nil
 	case sqlite3.SQLITE_DONE:
@@ -416,6 +644,10 @@ func (r *rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok b
 // RowsColumnTypeScanType may be implemented by Rows. It should return the
 // value type that can be used to scan types into. For example, the database
 // column type "bigint" this should return "reflect.TypeOf(int64(0))".
+//
+// The type is the one of the value of the current row. If it is NULL, like
+// before the first row, the type follows the declared type of the column,
+// which determines the type of every value of a STRICT table column.
 func (r *rows) ColumnTypeScanType(index int) reflect.Type {
 	t, err := r.c.columnType(r.pstmt, index)
 	if err != nil {
@@ -437,14 +669,38 @@ func (r *rows) ColumnTypeScanType(index int) reflect.Type {
 	case sqlite3.SQLITE_TEXT:
 		return reflect.TypeOf("")
 	case sqlite3.SQLITE_BLOB:
-		return reflect.SliceOf(reflect.TypeOf([]byte{}))
+		return reflect.TypeOf([]byte(nil))
 	case sqlite3.SQLITE_NULL:
-		return reflect.TypeOf(nil)
+		return declScanType(r.c.columnDeclType(r.pstmt, index))
 	default:
 		return reflect.TypeOf("")
 	}
 }
 
+// declScanType returns the scan type of a column of declared type decl,
+// following the column affinity rules of
+// https://www.sqlite.org/datatype3.html#determination_of_column_affinity.
+// Columns of NUMERIC affinity, of type ANY and expressions can hold values of
+// any type.
+func declScanType(decl string) reflect.Type {
+	switch decl = strings.ToUpper(decl); {
+	case decl == "BOOLEAN":
+		return reflect.TypeOf(false)
+	case decl == "DATE" || decl == "DATETIME" || decl == "TIME" || decl == "TIMESTAMP":
+		return reflect.TypeOf(time.Time{})
+	case strings.Contains(decl, "INT"):
+		return reflect.TypeOf(int64(0))
+	case strings.Contains(decl, "CHAR") || strings.Contains(decl, "CLOB") || strings.Contains(decl, "TEXT"):
+		return reflect.TypeOf("")
+	case strings.Contains(decl, "BLOB"):
+		return reflect.TypeOf([]byte(nil))
+	case strings.Contains(decl, "REAL") || strings.Contains(decl, "FLOA") || strings.Contains(decl, "DOUB"):
+		return reflect.TypeOf(float64(0))
+	default:
+		return reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+}
+
 type stmt struct {
 	c    *conn
 	psql uintptr
@@ -474,7 +730,7 @@ func (s *stmt) Close() (err error) {
 // Deprecated: Drivers should implement StmtExecContext instead (or
 // additionally).
 func (s *stmt) Exec(args []driver.Value) (driver.Result, error) { //TODO StmtExecContext
-	return s.exec(context.Background(), toNamedValues(args))
+	return s.ExecContext(context.Background(), toNamedValues(args))
 }
 
 // toNamedValues converts []driver.Value to []driver.NamedValue
@@ -487,12 +743,28 @@ func toNamedValues(vals []driver.Value) (r []driver.NamedValue) {
 }
 
 func (s *stmt) exec(ctx context.Context, args []driver.NamedValue) (r driver.Result, err error) {
+	if err := s.c.health(); err != nil {
+		return nil, err
+	}
+
+	defer func() { err = s.c.checkCorrupt(err) }()
+
+	defer func() { err = s.c.queryLimitError(err) }()
+
+	if end := s.c.startQuery(); end != nil {
+		defer end()
+	}
+
 	var pstmt uintptr
 	var done int32
 	if ctx != nil && ctx.Done() != nil {
+		defer func() { err = ctxError(ctx, err) }()
 		defer interruptOnDone(ctx, s.c, &done)()
+	} else {
+		s.c.resetLockWait()
 	}
 
+	m := s.c.markResult()
 	for psql := s.psql; *(*byte)(unsafe.Pointer(psql)) != 0 && atomic.LoadInt32(&done) == 0; {
 		if pstmt, err = s.c.prepareV2(&psql); err != nil {
 			return nil, err
@@ -501,6 +773,8 @@ func (s *stmt) exec(ctx context.Context, args []driver.NamedValue) (r driver.Res
 		if pstmt == 0 {
 			continue
 		}
+
+		var allocs []uintptr
 		err = func() (err error) {
 			n, err := s.c.bindParameterCount(pstmt)
 			if err != nil {
@@ -508,18 +782,17 @@ func (s *stmt) exec(ctx context.Context, args []driver.NamedValue) (r driver.Res
 			}
 
 			if n != 0 {
-				allocs, err := s.c.bind(pstmt, n, args)
-				if err != nil {
+				if allocs, err = s.c.bind(pstmt, n, args); err != nil {
 					return err
 				}
+			}
 
-				if len(allocs) != 0 {
-					defer func() {
-						for _, v := range allocs {
-							s.c.free(v)
-						}
-					}()
-				}
+			if err := s.c.checkReadOnly(pstmt); err != nil {
+				return err
+			}
+
+			if err := s.c.acquireWriterFor(ctx, pstmt); err != nil {
+				return err
 			}
 
 			rc, err := s.c.step(pstmt)
@@ -537,15 +810,23 @@ func (s *stmt) exec(ctx context.Context, args []driver.NamedValue) (r driver.Res
 			return nil
 		}()
 
+		// The bound values are read by the tracer until the statement is
+		// finalized.
 		if e := s.c.finalize(pstmt); e != nil && err == nil {
 			err = e
 		}
+		for _, v := range allocs {
+			s.c.free(v)
+		}
+		s.c.releaseWriter()
+		s.c.signalLockRelease()
+		s.c.publishChanges()
 
 		if err != nil {
 			return nil, err
 		}
 	}
-	return newResult(s.c)
+	return newResult(s.c, m)
 }
 
 // NumInput returns the number of placeholder parameters.
@@ -567,104 +848,161 @@ func (s *stmt) NumInput() (n int) {
 // Deprecated: Drivers should implement StmtQueryContext instead (or
 // additionally).
 func (s *stmt) Query(args []driver.Value) (driver.Rows, error) { //TODO StmtQueryContext
-	return s.query(context.Background(), toNamedValues(args))
+	return s.QueryContext(context.Background(), toNamedValues(args))
 }
 
 func (s *stmt) query(ctx context.Context, args []driver.NamedValue) (r driver.Rows, err error) {
-	var pstmt uintptr
-	var done int32
+	if err := s.c.health(); err != nil {
+		return nil, err
+	}
+
+	defer func() { err = s.c.checkCorrupt(err) }()
+
+	defer func() { err = s.c.queryLimitError(err) }()
+
+	// The duration of the query ends when the rows are closed.
+	end := s.c.startQuery()
+	defer func() {
+		if end != nil {
+			end()
+		}
+	}()
+
+	// The statements keep being interrupted when ctx is done while the rows
+	// are iterated, until they are closed, not only while the first row is
+	// stepped.
+	done := new(int32)
+	var stop func()
 	if ctx != nil && ctx.Done() != nil {
-		defer interruptOnDone(ctx, s.c, &done)()
+		defer func() { err = ctxError(ctx, err) }()
+		stop = interruptOnDone(ctx, s.c, done)
+		defer func() {
+			if stop != nil {
+				stop()
+			}
+		}()
+	} else {
+		s.c.resetLockWait()
 	}
 
-	var allocs []uintptr
-	for psql := s.psql; *(*byte)(unsafe.Pointer(psql)) != 0 && atomic.LoadInt32(&done) == 0; {
-		if pstmt, err = s.c.prepareV2(&psql); err != nil {
+	psql := s.psql
+	pstmt, allocs, rc, err := s.c.start(ctx, &psql, args, done)
+	if err != nil {
+		return nil, err
+	}
+
+	rs, err := newRows(s.c, pstmt, allocs, rc != sqlite3.SQLITE_ROW)
+	if err != nil {
+		return nil, err
+	}
+
+	if stop != nil {
+		rs.ctx, rs.done, rs.stopInterrupt = ctx, done, stop
+		stop = nil
+	}
+	rs.endQuery, end = end, nil
+
+	if *(*byte)(unsafe.Pointer(psql)) != 0 {
+		// The remaining statements are run by rows.NextResultSet after this
+		// stmt is closed, so rows needs its own copy of the SQL text.
+		if rs.sql, err = libc.CString(libc.GoString(psql)); err != nil {
+			rs.Close()
 			return nil, err
 		}
 
+		rs.tail = rs.sql
+		rs.args = args
+	}
+	return rs, nil
+}
+
+// start prepares and steps the statements of the SQL text at *psql until one
+// of them produces a result set or the text is exhausted. Statements having
+// no result columns are executed and finalized on the way. On return *psql
+// points to the unused portion of the SQL text. A zero pstmt is returned if
+// the text contains no more statements.
+func (c *conn) start(ctx context.Context, psql *uintptr, args []driver.NamedValue, done *int32) (pstmt uintptr, allocs []uintptr, rc int, err error) {
+	for *(*byte)(unsafe.Pointer(*psql)) != 0 && atomic.LoadInt32(done) == 0 {
+		if pstmt, err = c.prepareV2(psql); err != nil {
+			return 0, nil, 0, err
+		}
+
 		if pstmt == 0 {
 			continue
 		}
 
 		err = func() (err error) {
-			n, err := s.c.bindParameterCount(pstmt)
+			n, err := c.bindParameterCount(pstmt)
 			if err != nil {
 				return err
 			}
 
 			if n != 0 {
-				if allocs, err = s.c.bind(pstmt, n, args); err != nil {
+				if allocs, err = c.bind(pstmt, n, args); err != nil {
 					return err
 				}
 			}
 
-			rc, err := s.c.step(pstmt)
-			if err != nil {
+			if err := c.checkReadOnly(pstmt); err != nil {
 				return err
 			}
 
-			switch rc & 0xff {
-			case sqlite3.SQLITE_ROW:
-				if r != nil {
-					r.Close()
-				}
-				if r, err = newRows(s.c, pstmt, allocs, false); err != nil {
-					return err
-				}
+			if err := c.acquireWriterFor(ctx, pstmt); err != nil {
+				return err
+			}
 
-				pstmt = 0
-				return nil
-			case sqlite3.SQLITE_DONE:
-				if r == nil {
-					if r, err = newRows(s.c, pstmt, allocs, true); err != nil {
-						return err
-					}
-					pstmt = 0
-					return nil
-				}
+			if rc, err = c.step(pstmt); err != nil {
+				return err
+			}
 
+			switch rc & 0xff {
+			case sqlite3.SQLITE_ROW, sqlite3.SQLITE_DONE:
 				// nop
 			default:
-				return s.c.errstr(int32(rc))
+				return c.errstr(int32(rc))
 			}
 
-			if *(*byte)(unsafe.Pointer(psql)) == 0 {
-				if r != nil {
-					r.Close()
-				}
-				if r, err = newRows(s.c, pstmt, allocs, true); err != nil {
-					return err
-				}
-
-				pstmt = 0
-			}
 			return nil
 		}()
-		if e := s.c.finalize(pstmt); e != nil && err == nil {
-			err = e
+		if err == nil {
+			var n int
+			if n, err = c.columnCount(pstmt); err == nil && (n != 0 || *(*byte)(unsafe.Pointer(*psql)) == 0) {
+				return pstmt, allocs, rc, nil
+			}
 		}
 
+		if e := c.finalize(pstmt); e != nil && err == nil {
+			err = e
+		}
+		for _, v := range allocs {
+			c.free(v)
+		}
+		allocs = nil
+		c.releaseWriter()
+		c.signalLockRelease()
+		c.publishChanges()
+		pstmt = 0
 		if err != nil {
-			return nil, err
+			return 0, nil, 0, err
 		}
 	}
-	return r, err
+	return 0, nil, sqlite3.SQLITE_DONE, nil
 }
 
 type tx struct {
-	c *conn
+	c   *conn
+	ctx context.Context // Of BeginTx, passed to the interceptor of c.
 }
 
-func newTx(c *conn) (*tx, error) {
-	r := &tx{c: c}
+func newTx(ctx context.Context, c *conn, beginMode string) (*tx, error) {
+	r := &tx{c: c, ctx: ctx}
 	var sql string
-	if c.beginMode != "" {
-		sql = "begin " + c.beginMode
+	if beginMode != "" {
+		sql = "begin " + beginMode
 	} else {
 		sql = "begin"
 	}
-	if err := r.exec(context.Background(), sql); err != nil {
+	if err := r.exec(ctx, sql); err != nil {
 		return nil, err
 	}
 
@@ -673,12 +1011,26 @@ func newTx(c *conn) (*tx, error) {
 
 // Commit implements driver.Tx.
 func (t *tx) Commit() (err error) {
-	return t.exec(context.Background(), "commit")
+	return t.c.interceptOp(t.ctx, InterceptCommit, func() error {
+		err := t.exec(context.Background(), "commit")
+		t.c.readOnlyTx = false
+		t.c.releaseWriter()
+		t.c.signalLockRelease()
+		t.c.publishChanges()
+		return err
+	})
 }
 
 // Rollback implements driver.Tx.
 func (t *tx) Rollback() (err error) {
-	return t.exec(context.Background(), "rollback")
+	return t.c.interceptOp(t.ctx, InterceptRollback, func() error {
+		err := t.exec(context.Background(), "rollback")
+		t.c.readOnlyTx = false
+		t.c.releaseWriter()
+		t.c.signalLockRelease()
+		t.c.publishChanges()
+		return err
+	})
 }
 
 func (t *tx) exec(ctx context.Context, sql string) (err error) {
@@ -691,14 +1043,24 @@ func (t *tx) exec(ctx context.Context, sql string) (err error) {
 	//TODO use t.conn.ExecContext() instead
 
 	if ctx != nil && ctx.Done() != nil {
+		defer func() { err = ctxError(ctx, err) }()
 		defer interruptOnDone(ctx, t.c, nil)()
+	} else {
+		t.c.resetLockWait()
 	}
 
-	if rc := sqlite3.Xsqlite3_exec(t.c.tls, t.c.db, psql, 0, 0, 0); rc != sqlite3.SQLITE_OK {
-		return t.c.errstr(rc)
+	for {
+		switch rc := sqlite3.Xsqlite3_exec(t.c.tls, t.c.db, psql, 0, 0, 0); rc {
+		case sqlite3.SQLITE_OK:
+			return nil
+		case sqliteLockedSharedcache:
+			if err := t.c.retry(0); err != nil {
+				return err
+			}
+		default:
+			return t.c.errstr(rc)
+		}
 	}
-
-	return nil
 }
 
 // interruptOnDone sets up a goroutine to interrupt the provided db when the
@@ -715,6 +1077,11 @@ func interruptOnDone(
 	}
 
 	donech := make(chan struct{})
+	w := c.lockWait
+	var op uint64
+	if w != nil {
+		op = w.beginOp(ctx.Done())
+	}
 
 	go func() {
 		select {
@@ -723,6 +1090,9 @@ func interruptOnDone(
 			// call to exec is no longer running and we would be interrupting
 			// nothing, or even possibly an unrelated later call to exec.
 			if atomic.AddInt32(done, 1) == 1 {
+				if w != nil {
+					w.interrupt(op)
+				}
 				c.interrupt(c.db)
 			}
 		case <-donech:
@@ -735,7 +1105,31 @@ func interruptOnDone(
 		// returns doesn't trigger a call to interrupt for some other statement.
 		atomic.AddInt32(done, 1)
 		close(donech)
+		if w != nil {
+			w.endOp(op)
+		}
+	}
+}
+
+// ctxError returns ctx.Err() instead of err if err reports an operation
+// interrupted, or a lock not acquired, because ctx is done. database/sql
+// callers can then recognize context.Canceled and context.DeadlineExceeded.
+func ctxError(ctx context.Context, err error) error {
+	if err == nil || ctx == nil || ctx.Err() == nil {
+		return err
+	}
+
+	var e *Error
+	if !errors.As(err, &e) {
+		return err
+	}
+
+	switch e.code & 0xff {
+	case sqlite3.SQLITE_INTERRUPT, sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return ctx.Err()
 	}
+
+	return err
 }
 
 type conn struct {
@@ -748,22 +1142,78 @@ type conn struct {
 
 	writeTimeFormat string
 	beginMode       string
+	scan            scanMode   // See setScan.
+	textBytes       bool       // See setTextBytes.
+	decimalText     bool       // See setDecimalText.
+	uintMode        uint64Mode // See setUint64.
+	readOnly        bool       // The main database is read only, like with mode=ro.
+	readOnlyTx      bool       // In a transaction started with TxOptions.ReadOnly, see checkReadOnly.
+	reset           resetMode  // See setReset.
+
+	// Corruption recovery policy, see setRecover.
+	recovery   *recovery
+	filename   string
+	generation int64
+	corrupt    bool
+
+	// Replacement of the database file, see Reopen and setReopen.
+	reopening        *reopening
+	reopenGeneration int64
+	reopenAuto       bool
+	reopenPath       string
+	reopenFile       os.FileInfo
+
+	// Write serialization, see setSerializeWrites.
+	writer      writerLock
+	holdsWriter bool
+
+	lockWait       *lockWait         // See setLockWait.
+	lockWaitID     uintptr           // Key of the lockWaits entry.
+	checkpointWait time.Duration     // See setCheckpointWait.
+	checkpointer   *checkpointer     // See setCheckpointer.
+	walHookID      uintptr           // Key of the walHooks entry, see registerWALHook.
+	tracer         uintptr           // Key of the tracers entry, see SetTracer.
+	traceRedact    func(string) bool // See SetTraceRedaction.
+	stmtStatus     StmtStatus        // Totals of the finalized statements, see Status.
+
+	changeHooks   *changeHooks // See setNotify.
+	changeHooksID uintptr      // Key of the changeHookSet entry.
+
+	interceptor Interceptor // See WrapDriver.
+	registrySeq int         // See applyRegistry.
+	quota       *quota      // See setQuota.
+	queryLimit  uintptr     // Key of the queryLimits entry, see SetQueryLimits.
+
+	// Optimization policy, see setOptimize.
+	optimize      bool
+	optimizeEvery time.Duration
+	optimized     time.Time // Of the last Optimize.
+
+	panic      bool // A panic was recovered from the library, see panicked.
+	panicInLib bool // The panic was raised by the code of the library.
 }
 
 func newConn(dsn string) (*conn, error) {
-	var query string
-
 	// Parse the query parameters from the dsn and them from the dsn if not prefixed by file:
 	// https://github.com/mattn/go-sqlite3/blob/3392062c729d77820afc1f5cae3427f0de39e954/sqlite3.go#L1046
 	// https://github.com/mattn/go-sqlite3/blob/3392062c729d77820afc1f5cae3427f0de39e954/sqlite3.go#L1383
-	pos := strings.IndexRune(dsn, '?')
-	if pos >= 1 {
-		query = dsn[pos+1:]
-		if !strings.HasPrefix(dsn, "file:") {
-			dsn = dsn[:pos]
+	dsn, query := openName(dsn)
+	dsn, err := withLocking(dsn, query)
+	if err != nil {
+		return nil, err
+	}
+
+	for retry := true; ; retry = false {
+		c, err := openConn(dsn, query)
+		if err == driver.ErrBadConn && retry { // Recovered from a corrupted database.
+			continue
 		}
+
+		return c, err
 	}
+}
 
+func openConn(dsn, query string) (*conn, error) {
 	c := &conn{tls: libc.NewTLS()}
 	db, err := c.openV2(
 		dsn,
@@ -781,11 +1231,30 @@ func newConn(dsn string) (*conn, error) {
 		return nil, err
 	}
 
-	if err = applyQueryParams(c, query); err != nil {
+	// int sqlite3_db_readonly(sqlite3 *db, const char *zDbName);
+	c.readOnly = sqlite3.Xsqlite3_db_readonly(c.tls, c.db, 0) == 1
+	if c.needsImmutable() {
+		c.Close()
+		return openConn(withImmutable(dsn), query)
+	}
+
+	if err = c.createModules(); err != nil {
 		c.Close()
 		return nil, err
 	}
 
+	if err = applyQueryParams(c, query); err == nil && c.recovery != nil {
+		err = c.probe()
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	c.trackReopen()
+
+	c.registerWALHook()
+	c.registerStats()
 	return c, nil
 }
 
@@ -795,6 +1264,28 @@ func applyQueryParams(c *conn, query string) error {
 		return err
 	}
 
+	if v := q.Get("_recover"); v != "" {
+		if err := c.setRecover(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_reopen"); v != "" {
+		if err := c.setReopen(v); err != nil {
+			return err
+		}
+	}
+
+	if err := c.attachAll(q); err != nil {
+		return err
+	}
+
+	if vs := q["_create"]; len(vs) != 0 {
+		if err := c.setCreate(vs); err != nil {
+			return err
+		}
+	}
+
 	for _, v := range q["_pragma"] {
 		cmd := "pragma " + v
 		_, err := c.exec(context.Background(), cmd, nil)
@@ -803,13 +1294,114 @@ func applyQueryParams(c *conn, query string) error {
 		}
 	}
 
+	if v := q.Get("_quota"); v != "" {
+		if err := c.setQuota(v, q.Get("_quota_warn")); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_max_rows"); v != "" {
+		if err := c.setMaxRows(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_max_duration"); v != "" {
+		if err := c.setMaxDuration(v); err != nil {
+			return err
+		}
+	}
+
 	if v := q.Get("_time_format"); v != "" {
 		f, ok := writeTimeFormats[v]
 		if !ok {
 			return fmt.Errorf("unknown _time_format %q", v)
 		}
 		c.writeTimeFormat = f
-		return nil
+	}
+
+	if v := q.Get("_scan"); v != "" {
+		if err := c.setScan(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_text_bytes"); v != "" {
+		if err := c.setTextBytes(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_decimal_text"); v != "" {
+		if err := c.setDecimalText(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_uint64"); v != "" {
+		if err := c.setUint64(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_reset"); v != "" {
+		if err := c.setReset(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_serialize_writes"); v != "" {
+		if err := c.setSerializeWrites(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_lock_wait"); v != "" {
+		if err := c.setLockWait(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_checkpoint_wait"); v != "" {
+		if err := c.setCheckpointWait(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_checkpointer"); v != "" {
+		if err := c.setCheckpointer(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_optimize"); v != "" {
+		if err := c.setOptimize(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_notify"); v != "" {
+		if err := c.setNotify(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_regexp"); v != "" {
+		if err := c.setRegexp(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_tz"); v != "" {
+		if err := c.setTZ(v); err != nil {
+			return err
+		}
+	}
+
+	if v := q.Get("_unicode"); v != "" {
+		if err := c.setUnicode(v); err != nil {
+			return err
+		}
 	}
 
 	if v := q.Get("_txlock"); v != "" {
@@ -903,14 +1495,67 @@ func (c *conn) lastInsertRowID() (v int64, _ error) {
 	return sqlite3.Xsqlite3_last_insert_rowid(c.tls, c.db), nil
 }
 
-// int sqlite3_changes(sqlite3*);
-func (c *conn) changes() (int, error) {
-	v := sqlite3.Xsqlite3_changes(c.tls, c.db)
-	return int(v), nil
+// LastInsertRowID returns the rowid of the last row inserted by the
+// connection, see https://www.sqlite.org/c3ref/last_insert_rowid.html. Unlike
+// the SQL function last_insert_rowid() run through a *sql.DB, which may pick
+// any connection of the pool, it always reports on c.
+//
+// LastInsertRowID can be reached using (*sql.Conn).Raw.
+func (c *conn) LastInsertRowID() int64 {
+	return sqlite3.Xsqlite3_last_insert_rowid(c.tls, c.db)
+}
+
+// SetLastInsertRowID sets the value LastInsertRowID and the SQL function
+// last_insert_rowid() return, see
+// https://www.sqlite.org/c3ref/set_last_insert_rowid.html. Virtual tables
+// inserting into shadow tables use it to restore the rowid their caller
+// expects.
+//
+// SetLastInsertRowID can be reached using (*sql.Conn).Raw.
+func (c *conn) SetLastInsertRowID(id int64) {
+	// void sqlite3_set_last_insert_rowid(sqlite3*,sqlite3_int64);
+	sqlite3.Xsqlite3_set_last_insert_rowid(c.tls, c.db, id)
+}
+
+func (c *conn) changes() (int64, error) {
+	return changes64(c.tls, c.db), nil
+}
+
+// Changes returns the number of rows modified, inserted or deleted by the
+// last INSERT, UPDATE or DELETE statement the connection completed, see
+// https://www.sqlite.org/c3ref/changes.html. Changes made by triggers,
+// foreign key actions and REPLACE conflict resolution are not counted.
+//
+// Changes can be reached using (*sql.Conn).Raw.
+func (c *conn) Changes() int64 {
+	return changes64(c.tls, c.db)
+}
+
+// TotalChanges returns the number of rows modified, inserted or deleted by
+// all the statements the connection completed since it was opened, including
+// the changes made by triggers and foreign key actions, see
+// https://www.sqlite.org/c3ref/total_changes.html. The difference of two
+// TotalChanges values measures the volume of the statements run in between,
+// compared with Changes it tells the rows a trigger cascade touched.
+//
+// TotalChanges can be reached using (*sql.Conn).Raw.
+func (c *conn) TotalChanges() int64 {
+	return totalChanges64(c.tls, c.db)
 }
 
 // int sqlite3_step(sqlite3_stmt*);
-func (c *conn) step(pstmt uintptr) (int, error) {
+func (c *conn) step(pstmt uintptr) (rc int, err error) {
+	if c.panic {
+		return sqlite3.SQLITE_INTERNAL, driver.ErrBadConn
+	}
+
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			rc, err = sqlite3.SQLITE_INTERNAL, c.panicked("sqlite3_step", r, func() string { return c.stmtSQL(pstmt) })
+		}
+	}()
+
 	for {
 		switch rc := sqlite3.Xsqlite3_step(c.tls, pstmt); rc {
 		case sqliteLockedSharedcache:
@@ -1072,14 +1717,14 @@ func (c *conn) bindNull(pstmt uintptr, idx1 int) (uintptr, error) {
 	return 0, nil
 }
 
-// int sqlite3_bind_text(sqlite3_stmt*,int,const char*,int,void(*)(void*));
+// int sqlite3_bind_text64(sqlite3_stmt*, int, const char*, sqlite3_uint64, void(*)(void*), unsigned char encoding);
 func (c *conn) bindText(pstmt uintptr, idx1 int, value string) (uintptr, error) {
 	p, err := libc.CString(value)
 	if err != nil {
 		return 0, err
 	}
 
-	if rc := sqlite3.Xsqlite3_bind_text(c.tls, pstmt, int32(idx1), p, int32(len(value)), 0); rc != sqlite3.SQLITE_OK {
+	if rc := sqlite3.Xsqlite3_bind_text64(c.tls, pstmt, int32(idx1), p, uint64(len(value)), 0, sqlite3.SQLITE_UTF8); rc != sqlite3.SQLITE_OK {
 		c.free(p)
 		return 0, c.errstr(rc)
 	}
@@ -1087,7 +1732,7 @@ func (c *conn) bindText(pstmt uintptr, idx1 int, value string) (uintptr, error)
 	return p, nil
 }
 
-// int sqlite3_bind_blob(sqlite3_stmt*, int, const void*, int n, void(*)(void*));
+// int sqlite3_bind_blob64(sqlite3_stmt*, int, const void*, sqlite3_uint64, void(*)(void*));
 func (c *conn) bindBlob(pstmt uintptr, idx1 int, value []byte) (uintptr, error) {
 	if value != nil && len(value) == 0 {
 		if rc := sqlite3.Xsqlite3_bind_zeroblob(c.tls, pstmt, int32(idx1), 0); rc != sqlite3.SQLITE_OK {
@@ -1103,7 +1748,7 @@ func (c *conn) bindBlob(pstmt uintptr, idx1 int, value []byte) (uintptr, error)
 	if len(value) != 0 {
 		copy((*libc.RawMem)(unsafe.Pointer(p))[:len(value):len(value)], value)
 	}
-	if rc := sqlite3.Xsqlite3_bind_blob(c.tls, pstmt, int32(idx1), p, int32(len(value)), 0); rc != sqlite3.SQLITE_OK {
+	if rc := sqlite3.Xsqlite3_bind_blob64(c.tls, pstmt, int32(idx1), p, uint64(len(value)), 0); rc != sqlite3.SQLITE_OK {
 		c.free(p)
 		return 0, c.errstr(rc)
 	}
@@ -1152,6 +1797,13 @@ func (c *conn) bindParameterCount(pstmt uintptr) (_ int, err error) {
 
 // int sqlite3_finalize(sqlite3_stmt *pStmt);
 func (c *conn) finalize(pstmt uintptr) error {
+	if c.panic {
+		return nil
+	}
+
+	if pstmt != 0 {
+		c.stmtStatus.add(stmtStatus(c.tls, pstmt))
+	}
 	if rc := sqlite3.Xsqlite3_finalize(c.tls, pstmt); rc != sqlite3.SQLITE_OK {
 		return c.errstr(rc)
 	}
@@ -1169,6 +1821,10 @@ func (c *conn) finalize(pstmt uintptr) error {
 //
 // );
 func (c *conn) prepareV2(zSQL *uintptr) (pstmt uintptr, err error) {
+	if c.panic {
+		return 0, driver.ErrBadConn
+	}
+
 	var ppstmt, pptail uintptr
 
 	defer func() {
@@ -1184,6 +1840,14 @@ func (c *conn) prepareV2(zSQL *uintptr) (pstmt uintptr, err error) {
 		return 0, err
 	}
 
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if r := recover(); r != nil {
+			sql := *zSQL
+			pstmt, err = 0, c.panicked("sqlite3_prepare_v2", r, func() string { return libc.GoString(sql) })
+		}
+	}()
+
 	for {
 		switch rc := sqlite3.Xsqlite3_prepare_v2(c.tls, c.db, *zSQL, -1, ppstmt, pptail); rc {
 		case sqlite3.SQLITE_OK:
@@ -1250,7 +1914,14 @@ func (c *conn) openV2(name string, flags int32) (uintptr, error) {
 	}
 
 	if rc := sqlite3.Xsqlite3_open_v2(c.tls, s, p, flags, 0); rc != sqlite3.SQLITE_OK {
-		return 0, c.errstr(rc)
+		// Unless out of memory, a handle reporting the error is returned. It
+		// must be closed.
+		db := *(*uintptr)(unsafe.Pointer(p))
+		c.db = db
+		err := c.errstr(rc)
+		c.db = 0
+		sqlite3.Xsqlite3_close_v2(c.tls, db)
+		return 0, err
 	}
 
 	return *(*uintptr)(unsafe.Pointer(p)), nil
@@ -1279,23 +1950,70 @@ func (c *conn) errstr(rc int32) error {
 	if rc == sqlite3.SQLITE_BUSY {
 		s = " (SQLITE_BUSY)"
 	}
+	if c.recovery != nil && isCorrupt(rc) {
+		c.corrupt = true
+	}
+	if c.quota != nil && rc&0xff == sqlite3.SQLITE_FULL {
+		c.quota.full = true
+	}
 	switch msg := libc.GoString(p); {
 	case msg == str:
 		return &Error{msg: fmt.Sprintf("%s (%v)%s", str, rc, s), code: int(rc)}
 	default:
-		return &Error{msg: fmt.Sprintf("%s: %s (%v)%s", str, msg, rc, s), code: int(rc)}
+		return &Error{msg: fmt.Sprintf("%s: %s (%v)%s", str, msg, rc, s), code: int(rc), constraint: c.constraint(rc, msg)}
 	}
 }
 
 // Begin starts a transaction.
 //
+// The kind of the transaction, see
+// https://www.sqlite.org/lang_transaction.html#deferred_immediate_and_exclusive_transactions,
+// is determined by the _txlock query parameter of the DSN. When started using
+// BeginTx, sql.TxOptions override it: a read only transaction is always
+// deferred, sql.LevelSerializable starts an immediate transaction and
+// sql.LevelLinearizable an exclusive one. Other isolation levels use the
+// _txlock default. The statements of a read only transaction fail before
+// they execute if they would write to the database, see IsReadOnly.
+//
 // Deprecated: Drivers should implement ConnBeginTx instead (or additionally).
 func (c *conn) Begin() (driver.Tx, error) {
-	return c.begin(context.Background(), driver.TxOptions{})
+	return c.BeginTx(context.Background(), driver.TxOptions{})
 }
 
 func (c *conn) begin(ctx context.Context, opts driver.TxOptions) (t driver.Tx, err error) {
-	return newTx(c)
+	if err := c.health(); err != nil {
+		return nil, err
+	}
+
+	defer func() { err = c.checkCorrupt(err) }()
+
+	beginMode := c.beginMode
+	switch {
+	case opts.ReadOnly, c.readOnly:
+		beginMode = "deferred"
+	case opts.Isolation == driver.IsolationLevel(sql.LevelSerializable):
+		beginMode = "immediate"
+	case opts.Isolation == driver.IsolationLevel(sql.LevelLinearizable):
+		beginMode = "exclusive"
+	}
+	if c.writer != nil && !opts.ReadOnly {
+		if err := c.acquireWriter(ctx); err != nil {
+			return nil, err
+		}
+
+		if beginMode != "exclusive" {
+			// Holding the writer lock, taking the database write lock
+			// right away cannot contend with the other connections.
+			beginMode = "immediate"
+		}
+	}
+	if t, err = newTx(ctx, c, beginMode); err != nil {
+		c.releaseWriter()
+		return nil, err
+	}
+
+	c.readOnlyTx = opts.ReadOnly
+	return t, nil
 }
 
 // Close invalidates and potentially stops any current prepared statements and
@@ -1305,18 +2023,36 @@ func (c *conn) begin(ctx context.Context, opts driver.TxOptions) (t driver.Tx, e
 // Close when there's a surplus of idle connections, it shouldn't be necessary
 // for drivers to do their own connection caching.
 func (c *conn) Close() error {
+	return c.interceptOp(nil, InterceptClose, c.close)
+}
+
+func (c *conn) close() error {
+	c.optimizeOnClose()
 	c.Lock() // Defend against race with .interrupt invoked by context handling.
 
 	defer c.Unlock()
 
-	if c.db != 0 {
+	c.unregisterStats()
+	switch {
+	case c.db == 0, c.panicInLib:
+		// nop
+	case c.panic:
+		c.closeAfterPanic()
+	default:
 		if err := c.closeV2(c.db); err != nil {
 			return err
 		}
-
-		c.db = 0
 	}
 
+	c.db = 0
+	c.releaseWriter()
+	c.signalLockRelease()
+	c.unregisterLockWait()
+	c.unregisterChangeHooks()
+	c.unregisterTracer()
+	c.unregisterQueryLimit()
+	c.unregisterWALHook()
+	c.releaseCheckpointer()
 	if c.tls != nil {
 		c.tls.Close()
 		c.tls = nil
@@ -1338,6 +2074,7 @@ type userDefinedFunction struct {
 	nArg      int32
 	eTextRep  int32
 	xFunc     func(*libc.TLS, uintptr, int32, uintptr)
+	seq       int // See registrySeq, 0 if not registered on the driver.
 
 	freeOnce sync.Once
 }
@@ -1368,7 +2105,7 @@ func (c *conn) createFunctionInternal(fun *userDefinedFunction) error {
 //
 // Deprecated: Drivers should implement ExecerContext instead.
 func (c *conn) Exec(query string, args []driver.Value) (driver.Result, error) {
-	return c.exec(context.Background(), query, toNamedValues(args))
+	return c.ExecContext(context.Background(), query, toNamedValues(args))
 }
 
 func (c *conn) exec(ctx context.Context, query string, args []driver.NamedValue) (r driver.Result, err error) {
@@ -1405,7 +2142,7 @@ func (c *conn) prepare(ctx context.Context, query string) (s driver.Stmt, err er
 //
 // Deprecated: Drivers should implement QueryerContext instead.
 func (c *conn) Query(query string, args []driver.Value) (driver.Rows, error) {
-	return c.query(context.Background(), query, toNamedValues(args))
+	return c.QueryContext(context.Background(), query, toNamedValues(args))
 }
 
 func (c *conn) query(ctx context.Context, query string, args []driver.NamedValue) (r driver.Rows, err error) {
@@ -1423,13 +2160,33 @@ func (c *conn) query(ctx context.Context, query string, args []driver.NamedValue
 	return s.(*stmt).query(ctx, args)
 }
 
+// internalQuery is like query for the queries of the package itself. Their
+// values are returned as stored, text as string, regardless of the _scan and
+// _text_bytes query parameters.
+func (c *conn) internalQuery(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	r.(*rows).internal = true
+	return r, nil
+}
+
 // Driver implements database/sql/driver.Driver.
 type Driver struct {
-	// user defined functions that are added to every new connection on Open
-	udfs map[string]*userDefinedFunction
+	// user defined functions and collations that are added to every new
+	// connection on Open, see conn.applyRegistry
+	udfs       map[string]*userDefinedFunction
+	collations map[string]*goCollation
+
+	interceptor Interceptor // See WrapDriver.
 }
 
-var d = &Driver{udfs: make(map[string]*userDefinedFunction)}
+var d = &Driver{
+	udfs:       make(map[string]*userDefinedFunction),
+	collations: make(map[string]*goCollation),
+}
 
 func newDriver() *Driver { return d }
 
@@ -1442,25 +2199,287 @@ func newDriver() *Driver { return d }
 //
 // The returned connection is only used by one goroutine at a time.
 //
-// If name contains a '?', what follows is treated as a query string. This
+// The name is passed to SQLite as a filename, or as an URI filename if it
+// starts with "file:", see https://www.sqlite.org/uri.html.
+//
+// If name contains a '?', what follows is treated as a query string.
+// Parameters not starting with an underscore are interpreted by SQLite and by
+// the VFS, for example vfs, mode, cache or immutable. They can be used with a
+// plain file name as well, which is then converted to an URI filename:
+//
+//	name                          opened as
+//	-------------------------------------------------------------------
+//	/tmp/a b.db                   /tmp/a b.db
+//	/tmp/a b.db?_txlock=immediate /tmp/a b.db
+//	/tmp/a b.db?mode=ro           file:///tmp/a%20b.db?mode=ro
+//	data/50%.db?vfs=audit         file:data/50%25.db?vfs=audit
+//	:memory:?cache=shared         file::memory:?cache=shared
+//	C:\db\x.db?mode=ro            file:///C:/db/x.db?mode=ro (Windows)
+//	file:x.db?mode=ro&_txlock=... file:x.db?mode=ro&_txlock=...
+//
+// A VFS reads its parameters using sqlite3_uri_parameter and friends.
+//
+// On Windows, plain file names too long for the Win32 file API, including
+// UNC names, are made absolute and converted to the \\?\ form, which is
+// not limited to MAX_PATH characters. If such a name is longer than the win32
+// VFS supports and no vfs parameter is given, the win32-longpath VFS is used.
+// Names starting with "file:" are passed to SQLite unchanged.
+//
+// On a connection to a database opened with mode=ro, or found on a read only
+// file system, transactions are always deferred and _serialize_writes and
+// _recover are ignored, so the driver never attempts to write. SQLite creates
+// no rollback journal for such a connection, but reading a database in WAL
+// mode requires its -wal and -shm files, which cannot be created on a read
+// only file system. If neither the -shm nor the -wal file
+// exist, such a database is opened with immutable=1 automatically, so
+// databases on read only mounts and in read only container layers can be
+// read in either journal mode. immutable=1 also avoids taking any file locks,
+// use it for files that are never modified while open.
+//
+// Parameters starting with an underscore are handled by the driver. This
 // driver supports the following query parameters:
 //
+// _attach.schema: The value names a database file to attach as schema, see
+// Attach. For example
+// "app.db?_attach.archive=archive.db&_pragma=archive.journal_mode(wal)"
+// makes the tables of archive.db available as archive.table on every
+// connection. The databases are attached before the _pragma parameters are
+// applied.
+//
+// _create: Like _pragma, but applied only when the connection creates the
+// main database, that is, when the database is empty, before the _pragma
+// parameters. May be specified more than once. The supported pragmas are
+// page_size, auto_vacuum, journal_mode and application_id, for example
+// "_create=page_size(8192)&_create=auto_vacuum(incremental)&_create=journal_mode(wal)".
+// The page size, auto-vacuum mode and application ID are written by the
+// transaction creating the database, so concurrent connections opening the
+// same new file see the database either not yet created or with these
+// settings, and none of them has to be set before the first write to take
+// effect. The journal mode is set after that transaction. Only the WAL mode
+// persists, other journal modes apply to the creating connection only.
+//
 // _pragma: Each value will be run as a "PRAGMA ..." statement (with the PRAGMA
 // keyword added for you). May be specified more than once. Example:
 // "_pragma=foreign_keys(1)" will enable foreign key enforcement. More
 // information on supported PRAGMAs is available from the SQLite documentation:
 // https://www.sqlite.org/pragma.html
 //
+// _quota: The maximum size of the main database in bytes. The max_page_count
+// of the connection, see https://www.sqlite.org/pragma.html#pragma_max_page_count,
+// is set to the number of whole pages fitting in the size, so a write growing
+// the database beyond it fails with SQLITE_FULL. A quota smaller than the
+// database does not shrink it, but prevents it from growing. The quota is
+// applied after the _pragma parameters, which may change the page size of a
+// new database. SetQuotaHandler installs a function notified when a database
+// approaches or reaches its quota, for example to enforce per-tenant storage
+// limits.
+//
+// _quota_warn: The fraction of the _quota, between 0 and 1, at which the
+// handler installed by SetQuotaHandler is notified. The default is 0.9.
+//
+// _max_rows: The maximum number of rows of a result set, see SetQueryLimits.
+//
+// _max_duration: The maximum duration of a query, like "2s", see
+// SetQueryLimits. The limits are set after the _pragma parameters are
+// applied.
+//
 // _time_format: The name of a format to use when writing time values to the
 // database. Currently the only supported value is "sqlite", which corresponds
 // to format 7 from https://www.sqlite.org/lang_datefunc.html#time_values,
 // including the timezone specifier. If this parameter is not specified, then
 // the default String() format will be used.
 //
+// _scan: The conversion of the values of the columns of a declared type of
+// INTEGER, REAL or BOOLEAN affinity, see
+// https://www.sqlite.org/datatype3.html#determination_of_column_affinity. A
+// column of such a type can hold values of any type unless its table is
+// STRICT, and database/sql fails to Scan, for example, 2 into a bool or the
+// text "1.5" stored in a REAL column, where other drivers succeed. "storage",
+// the default, returns the values as stored. "affinity" returns the values of
+// INTEGER columns as int64, including floats without a fractional part and
+// integer text, the values of REAL columns as float64, including integers and
+// numeric text, and the values of BOOLEAN or BOOL columns as bool, nonzero
+// numbers and text accepted by strconv.ParseBool included. Values that do
+// not convert are returned as stored. "strict" converts like "affinity" but
+// fails on a value that does not convert, naming its column, instead of
+// failing later or not at all in Scan. NULL is never converted. Columns of
+// other types and expressions are not affected.
+//
+// _text_bytes: A boolean. If true, text values are returned as []byte
+// referring to the memory of SQLite, valid until the next row, instead of
+// being copied into a string. Scanning them into a *sql.RawBytes then copies
+// nothing and scanning into a *[]byte copies them once instead of twice.
+// Scanning into a *interface{} then yields []byte instead of string. Like
+// _scan, it does not affect the results of the methods of the connection,
+// such as Pragma.
+//
+// _decimal_text: A boolean. If true, *big.Int, *big.Rat and *big.Float
+// arguments are bound as their exact decimal text, like "-12.625", instead
+// of being rejected. The text keeps all the digits, which a REAL would round
+// to 15 or 16 significant digits, for use with the decimal functions or for
+// converting back using SetString. A *big.Rat without a finite decimal
+// representation, like 1/3, and an infinite *big.Float are rejected. Store
+// such values in columns of TEXT affinity, or without a declared type, as
+// SQLite may convert text stored in a column of INTEGER, REAL or NUMERIC
+// affinity to a REAL, rounding it. Nil pointers of these types are bound as NULL.
+//
+// _uint64: How unsigned integer arguments larger than math.MaxInt64, which
+// SQLite integers cannot hold, are bound. "error", the default, fails the
+// statement. "text" binds them as decimal text. "blob" binds them as 8 byte
+// big endian blobs, which sort after all integers and in numeric order among
+// themselves, so the values of a column compare as the uint64 values do.
+// Smaller values are always bound as integers. Use Uint64 to scan the values
+// back in either representation.
+//
+// _recover: The policy applied when the database file is found to be corrupt.
+// The only supported value is "quarantine": whatever data can still be read
+// is salvaged into a new file, the corrupted file is renamed by appending
+// ".corrupt-<timestamp>" to its name, the new file takes its place and the
+// operation fails with driver.ErrBadConn, which makes database/sql retry it
+// on a new connection. Connections opened before the recovery are discarded
+// the same way. If the salvage fails, the corrupted file is left in place and
+// the operation fails with its original error. The progress of the recovery is reported to the logger installed by
+// SetLogger. Temporary and in-memory databases are not affected.
+//
+// _reopen: A boolean. If true, the connection fails its next operation with
+// driver.ErrBadConn once its database file was replaced by another file, like
+// by renaming a restored backup over it, so database/sql opens a new
+// connection to the new file, see Reopen. Changes to the content of the file
+// in place are detected by SQLite itself. Temporary and in-memory databases
+// are not affected.
+//
+// _reset: The state of a pooled connection cleared by ResetSession before
+// the connection is reused. "tx", the default, rolls back a transaction left
+// open, like one started by executing BEGIN using sql.DB.Exec. "temp" also
+// drops the tables, views and triggers of the temp schema, so they do not
+// leak to the next user of the connection. "none" leaves a transaction open,
+// as the driver did before ResetSession rolled back transactions.
+//
+// _serialize_writes: A boolean. If true, the write transactions of all the
+// connections of the process having _serialize_writes enabled and using the
+// same database file are run one at a time. A connection waits in the driver
+// for the previous writer to finish instead of failing with SQLITE_BUSY, which
+// avoids "database is locked" errors under the concurrency of the
+// database/sql connection pool. Readers are not serialized. In the default
+// rollback journal mode they can still conflict with the writer, combine with
+// "_pragma=journal_mode(wal)" to keep reading while a write is in progress.
+// Transactions started by BeginTx, except read only ones, acquire the writer
+// role at once and begin immediately. Autocommit statements and transactions
+// started by executing BEGIN acquire it at their first statement that can
+// modify the database, so a deferred transaction of the latter kind that reads
+// before writing may still fail with SQLITE_BUSY_SNAPSHOT in WAL mode.
+// Connections of other processes are not serialized. Temporary and private
+// in-memory databases are not affected.
+//
+// _lock_wait: The maximum time to wait for a lock held by another connection,
+// given as a time.Duration string like "5s" or as a number of milliseconds.
+// Unlike the sleeping busy handler installed by
+// "_pragma=busy_timeout(5000)", the waiting connection is woken up as soon as
+// a connection of the same process using the same database file ends its
+// transaction, so it does not spin on SQLITE_BUSY retries nor oversleep.
+// Locks held by other processes are polled for. The wait of an operation ends
+// as soon as its context is done, and the operation then fails with the error
+// of the context, like context.DeadlineExceeded, while a wait of the
+// busy_timeout handler lasts until its timeout regardless of the context.
+// _lock_wait overrides any busy_timeout set by _pragma. Locks of a shared
+// cache are waited for using sqlite3_unlock_notify regardless of this
+// setting.
+//
+// _checkpoint_wait: A time.Duration string like "100ms". The automatic
+// checkpoint, run by a commit leaving at least wal_autocheckpoint frames in
+// the WAL, normally skips the frames a read transaction may still need, so
+// readers that are always active make the WAL grow without bound. With
+// _checkpoint_wait the commit waits up to the given time for those readers to
+// finish, in the way of CheckpointRestart, so the WAL is reused from its start
+// afterwards. If the readers do not finish in time, the next waiting
+// checkpoint of the connection is delayed, by _checkpoint_wait at first and
+// then by twice the previous delay, up to a minute, so a reader that stays
+// does not slow down every commit. Like the checkpoints it affects, the
+// setting is lost when a PRAGMA statement changes wal_autocheckpoint. See
+// also Checkpoint.
+//
+// _checkpointer: A boolean. If true, the automatic checkpoints of the main
+// database are run by only one of the processes sharing the database file and
+// having _checkpointer enabled, instead of by every process committing a
+// transaction that leaves a WAL over the wal_autocheckpoint threshold. The
+// elected process holds an advisory lock on the file named like the database
+// with "-checkpointer" appended for as long as it has connections to the
+// database using _checkpointer, another process takes over when it closes
+// them or exits. The other processes still run a checkpoint when the WAL
+// reaches four times the threshold, so the WAL does not keep growing while the
+// elected process does not write. If the lock file cannot be created, every
+// process checkpoints as usual. Temporary, private in-memory and read only
+// databases are not affected.
+//
+// _locking: The method used to lock the database file. "posix", the
+// default on Unix systems, uses POSIX advisory locks. "ofd" uses open file
+// description locks, available on Linux only: they belong to the open file
+// of a connection instead of to the process, so the locks of a connection
+// are not dropped when the process closes another file descriptor of the
+// database, and connections of the process using the database lock each
+// other out like connections of different processes do. OFD locks conflict
+// with the POSIX locks of other processes, so both methods can be used on the
+// same database. The remaining methods are fallbacks for network and FUSE
+// file systems whose fcntl locks are unreliable, like some SMB and NFS
+// mounts. "flock" uses flock(2) locks, which such file systems often
+// implement separately. "dotfile" creates a lock directory named after the
+// database with a ".lock" suffix, which works wherever creating a directory
+// is atomic. Both exclude all other connections while a connection reads or
+// writes. "none" takes no locks at all, it is only safe if a single
+// connection uses the database. The three fallbacks do not support WAL mode
+// unless the locking mode is exclusive, and all connections to a database,
+// of all processes, must use the same fallback. _locking selects a VFS and
+// cannot be combined with the vfs parameter. It is not supported on Windows.
+//
+// _optimize: A time.Duration string like "1h". The connection runs
+// Optimize, which keeps the statistics used by the query planner current,
+// before it is closed, as recommended by
+// https://www.sqlite.org/lang_analyze.html#periodically_run_pragma_optimize_.
+// database/sql may keep connections open for the lifetime of the program, so
+// a connection also runs Optimize when it is taken from the pool for reuse if
+// at least the given time passed since it was opened or since its previous
+// run. "0" disables the periodic runs.
+//
+// _notify: A boolean. If true, the rows modified by the transactions the
+// connection commits are reported to the subscriptions made by Notify for the
+// same database file. Enable it on all the connections writing to the database
+// to get notified of all changes. Temporary, private in-memory and read only
+// databases are not affected.
+//
+// _regexp: A boolean. If true, the REGEXP operator is implemented by the Go
+// regexp package, see https://pkg.go.dev/regexp/syntax for the syntax. Without
+// it, "X REGEXP Y" fails with "no such function: regexp". The operator is
+// case sensitive, prefix the pattern with "(?i)" for case insensitive
+// matching.
+//
+// _tz: A boolean. If true, the connection provides the function
+// tz(TIME, [FROM,] TO) converting TIME from the IANA time zone FROM, UTC if
+// omitted, to the time zone TO, for example
+// tz('2022-11-16 12:00', 'Europe/Prague') returns '2022-11-16 13:00:00'.
+// TIME is text in one of the formats of the date and time functions of
+// SQLite, a time with an explicit UTC offset is converted from that offset,
+// or a number of seconds since the Unix epoch. Zone names are resolved by
+// time.LoadLocation, "local" is the local time zone of the process. The
+// result is formatted like the result of datetime(), with milliseconds if
+// TIME has a fraction of a second. NULL arguments, or a TIME that is not a
+// time, yield NULL.
+//
+// _unicode: A boolean. If true, LIKE, upper() and lower() handle all Unicode
+// letters instead of ASCII only, using golang.org/x/text. upper(X, LOCALE) and
+// lower(X, LOCALE) apply the rules of a locale like "tr_TR", and
+// icu_load_collation(LOCALE, NAME[, STRENGTH]) creates the collating sequence
+// NAME ordering text per LOCALE, where STRENGTH "PRIMARY" ignores case and
+// accents and "SECONDARY" ignores case. These resemble the functions of the
+// SQLite ICU extension, see https://sqlite.org/src/dir/ext/icu. Note that a
+// LIKE ignoring Unicode case cannot use an index.
+//
 // _txlock: The locking behavior to use when beginning a transaction. May be
 // "deferred", "immediate", or "exclusive" (case insensitive). The default is to
-// not specify one, which SQLite maps to "deferred". More information is
-// available at
+// not specify one, which SQLite maps to "deferred". Using "immediate" avoids
+// the SQLITE_BUSY errors of deferred transactions that fail to upgrade their
+// read lock to a write lock under write contention. The default can be
+// overridden per transaction by the sql.TxOptions passed to BeginTx, see
+// Begin. More information is available at
 // https://www.sqlite.org/lang_transaction.html#deferred_immediate_and_exclusive_transactions
 func (d *Driver) Open(name string) (driver.Conn, error) {
 	c, err := newConn(name)
@@ -1468,12 +2487,12 @@ func (d *Driver) Open(name string) (driver.Conn, error) {
 		return nil, err
 	}
 
-	for _, udf := range d.udfs {
-		if err = c.createFunctionInternal(udf); err != nil {
-			c.Close()
-			return nil, err
-		}
+	if err = c.applyRegistry(); err != nil {
+		c.Close()
+		return nil, err
 	}
+
+	c.interceptor = d.interceptor
 	return c, nil
 }
 
@@ -1535,24 +2554,100 @@ func RegisterDeterministicScalarFunction(
 	return registerScalarFunction(zFuncName, nArg, sqlite3.SQLITE_UTF8|sqlite3.SQLITE_DETERMINISTIC, xFunc)
 }
 
+// FunctionFlags are the properties of a function registered by
+// RegisterScalarFunctionFlags, see
+// https://www.sqlite.org/c3ref/c_deterministic.html.
+type FunctionFlags int32
+
+const (
+	// FunctionDeterministic marks a function that always returns the same
+	// result for the same arguments. Only deterministic functions can be
+	// used in indexes on expressions, generated columns, CHECK constraints
+	// and the WHERE clauses of partial indexes.
+	FunctionDeterministic FunctionFlags = sqlite3.SQLITE_DETERMINISTIC
+	// FunctionDirectOnly marks a function that can be used in top-level SQL
+	// only, never in triggers, views, CHECK constraints, generated columns
+	// or indexes, where an attacker modifying the schema could invoke it.
+	FunctionDirectOnly FunctionFlags = sqlite3.SQLITE_DIRECTONLY
+	// FunctionInnocuous marks a function without side effects that cannot
+	// leak information, which can be used in the schema when
+	// "PRAGMA trusted_schema=OFF" forbids other functions there.
+	FunctionInnocuous FunctionFlags = sqlite3.SQLITE_INNOCUOUS
+)
+
+// RegisterScalarFunctionFlags is like RegisterScalarFunction, but the function
+// has the properties flags, a combination of FunctionDeterministic and
+// either FunctionDirectOnly or FunctionInnocuous.
+func RegisterScalarFunctionFlags(
+	zFuncName string,
+	nArg int32,
+	flags FunctionFlags,
+	xFunc func(ctx *FunctionContext, args []driver.Value) (driver.Value, error),
+) error {
+	if flags&^(FunctionDeterministic|FunctionDirectOnly|FunctionInnocuous) != 0 {
+		return fmt.Errorf("invalid function flags %#x", int32(flags))
+	}
+
+	if flags&FunctionDirectOnly != 0 && flags&FunctionInnocuous != 0 {
+		return fmt.Errorf("a function cannot be both direct only and innocuous")
+	}
+
+	return registerScalarFunction(zFuncName, nArg, sqlite3.SQLITE_UTF8|int32(flags), xFunc)
+}
+
+// MustRegisterScalarFunctionFlags is like RegisterScalarFunctionFlags but
+// panics on error.
+func MustRegisterScalarFunctionFlags(
+	zFuncName string,
+	nArg int32,
+	flags FunctionFlags,
+	xFunc func(ctx *FunctionContext, args []driver.Value) (driver.Value, error),
+) {
+	if err := RegisterScalarFunctionFlags(zFuncName, nArg, flags, xFunc); err != nil {
+		panic(err)
+	}
+}
+
 func registerScalarFunction(
 	zFuncName string,
 	nArg int32,
 	eTextRep int32,
 	xFunc func(ctx *FunctionContext, args []driver.Value) (driver.Value, error),
 ) error {
+	registryMu.Lock()
+
+	defer registryMu.Unlock()
 
 	if _, ok := d.udfs[zFuncName]; ok {
 		return fmt.Errorf("a function named %q is already registered", zFuncName)
 	}
 
+	udf, err := newScalarFunction(zFuncName, nArg, eTextRep, xFunc)
+	if err != nil {
+		return err
+	}
+
+	registrySeq++
+	udf.seq = registrySeq
+	d.udfs[zFuncName] = udf
+	return nil
+}
+
+// newScalarFunction returns a function that can be created on connections
+// using createFunctionInternal.
+func newScalarFunction(
+	zFuncName string,
+	nArg int32,
+	eTextRep int32,
+	xFunc func(ctx *FunctionContext, args []driver.Value) (driver.Value, error),
+) (*userDefinedFunction, error) {
 	// dont free, functions registered on the driver live as long as the program
 	name, err := libc.CString(zFuncName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	udf := &userDefinedFunction{
+	return &userDefinedFunction{
 		zFuncName: name,
 		nArg:      nArg,
 		eTextRep:  eTextRep,
@@ -1584,7 +2679,9 @@ func registerScalarFunction(
 					size := sqlite3.Xsqlite3_value_bytes(tls, valPtr)
 					blobPtr := sqlite3.Xsqlite3_value_blob(tls, valPtr)
 					v := make([]byte, size)
-					copy(v, (*libc.RawMem)(unsafe.Pointer(blobPtr))[:size:size])
+					if size != 0 { // blobPtr is NULL for an empty blob.
+						copy(v, (*libc.RawMem)(unsafe.Pointer(blobPtr))[:size:size])
+					}
 					args[i] = v
 				default:
 					panic(fmt.Sprintf("unexpected argument type %q passed by sqlite", valType))
@@ -1609,15 +2706,15 @@ func registerScalarFunction(
 			case time.Time:
 				sqlite3.Xsqlite3_result_int64(tls, ctx, resTyped.Unix())
 			case string:
-				size := int32(len(resTyped))
+				size := uint64(len(resTyped))
 				cstr, err := libc.CString(resTyped)
 				if err != nil {
 					panic(err)
 				}
 				defer libc.Xfree(tls, cstr)
-				sqlite3.Xsqlite3_result_text(tls, ctx, cstr, size, sqlite3.SQLITE_TRANSIENT)
+				sqlite3.Xsqlite3_result_text64(tls, ctx, cstr, size, sqlite3.SQLITE_TRANSIENT, sqlite3.SQLITE_UTF8)
 			case []byte:
-				size := int32(len(resTyped))
+				size := len(resTyped)
 				if size == 0 {
 					sqlite3.Xsqlite3_result_zeroblob(tls, ctx, 0)
 					return
@@ -1629,14 +2726,11 @@ func registerScalarFunction(
 				defer libc.Xfree(tls, p)
 				copy((*libc.RawMem)(unsafe.Pointer(p))[:size:size], resTyped)
 
-				sqlite3.Xsqlite3_result_blob(tls, ctx, p, size, sqlite3.SQLITE_TRANSIENT)
+				sqlite3.Xsqlite3_result_blob64(tls, ctx, p, uint64(size), sqlite3.SQLITE_TRANSIENT)
 			default:
 				setErrorResult(fmt.Errorf("function did not return a valid driver.Value: %T", resTyped))
 				return
 			}
 		},
-	}
-	d.udfs[zFuncName] = udf
-
-	return nil
+	}, nil
 }
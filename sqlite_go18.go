@@ -14,13 +14,18 @@ import (
 
 // Ping implements driver.Pinger
 func (c *conn) Ping(ctx context.Context) error {
-	_, err := c.ExecContext(ctx, "select 1", nil)
+	_, err := c.exec(ctx, "select 1", nil)
 	return err
 }
 
 // BeginTx implements driver.ConnBeginTx
 func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
-	return c.begin(ctx, opts)
+	var t driver.Tx
+	err := c.interceptOp(ctx, InterceptBegin, func() (err error) {
+		t, err = c.begin(ctx, opts)
+		return err
+	})
+	return t, err
 }
 
 // PrepareContext implements driver.ConnPrepareContext
@@ -30,20 +35,20 @@ func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, e
 
 // ExecContext implements driver.ExecerContext
 func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
-	return c.exec(ctx, query, args)
+	return c.interceptExec(ctx, query, args, func() (driver.Result, error) { return c.exec(ctx, query, args) })
 }
 
 // QueryContext implements driver.QueryerContext
 func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
-	return c.query(ctx, query, args)
+	return c.interceptQuery(ctx, query, args, func() (driver.Rows, error) { return c.query(ctx, query, args) })
 }
 
 // ExecContext implements driver.StmtExecContext
 func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	return s.exec(ctx, args)
+	return s.c.interceptExec(ctx, s.interceptSQL(), args, func() (driver.Result, error) { return s.exec(ctx, args) })
 }
 
 // QueryContext implements driver.StmtQueryContext
 func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	return s.query(ctx, args)
+	return s.c.interceptQuery(ctx, s.interceptSQL(), args, func() (driver.Rows, error) { return s.query(ctx, args) })
 }
@@ -0,0 +1,271 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sqlitecode provides the result codes of SQLite, see
+// https://www.sqlite.org/rescode.html.
+//
+// Connections of the modernc.org/sqlite driver enable extended result codes,
+// so the Code method of its errors returns an extended code, like
+// ConstraintUnique, which can be compared with the constants of this package
+// directly. Use Primary to get the primary code, like Constraint:
+//
+//	var e *sqlite.Error
+//	if errors.As(err, &e) {
+//		switch e.Code() {
+//		case sqlitecode.ConstraintUnique, sqlitecode.ConstraintPrimaryKey:
+//			// Duplicate key.
+//		case sqlitecode.ConstraintNotNull:
+//			// Missing value.
+//		}
+//		if sqlitecode.Primary(e.Code()) == sqlitecode.Busy {
+//			// Retry later.
+//		}
+//	}
+package sqlitecode // import "modernc.org/sqlite/sqlitecode"
+
+import (
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Primary result codes.
+const (
+	OK         = sqlite3.SQLITE_OK
+	Error      = sqlite3.SQLITE_ERROR
+	Internal   = sqlite3.SQLITE_INTERNAL
+	Perm       = sqlite3.SQLITE_PERM
+	Abort      = sqlite3.SQLITE_ABORT
+	Busy       = sqlite3.SQLITE_BUSY
+	Locked     = sqlite3.SQLITE_LOCKED
+	NoMem      = sqlite3.SQLITE_NOMEM
+	ReadOnly   = sqlite3.SQLITE_READONLY
+	Interrupt  = sqlite3.SQLITE_INTERRUPT
+	IOErr      = sqlite3.SQLITE_IOERR
+	Corrupt    = sqlite3.SQLITE_CORRUPT
+	NotFound   = sqlite3.SQLITE_NOTFOUND
+	Full       = sqlite3.SQLITE_FULL
+	CantOpen   = sqlite3.SQLITE_CANTOPEN
+	Protocol   = sqlite3.SQLITE_PROTOCOL
+	Empty      = sqlite3.SQLITE_EMPTY
+	Schema     = sqlite3.SQLITE_SCHEMA
+	TooBig     = sqlite3.SQLITE_TOOBIG
+	Constraint = sqlite3.SQLITE_CONSTRAINT
+	Mismatch   = sqlite3.SQLITE_MISMATCH
+	Misuse     = sqlite3.SQLITE_MISUSE
+	NoLFS      = sqlite3.SQLITE_NOLFS
+	Auth       = sqlite3.SQLITE_AUTH
+	Format     = sqlite3.SQLITE_FORMAT
+	Range      = sqlite3.SQLITE_RANGE
+	NotADB     = sqlite3.SQLITE_NOTADB
+	Notice     = sqlite3.SQLITE_NOTICE
+	Warning    = sqlite3.SQLITE_WARNING
+	Row        = sqlite3.SQLITE_ROW
+	Done       = sqlite3.SQLITE_DONE
+)
+
+// Extended result codes.
+const (
+	OKLoadPermanently = sqlite3.SQLITE_OK_LOAD_PERMANENTLY
+	OKSymlink         = sqlite3.SQLITE_OK_SYMLINK
+
+	ErrorMissingCollSeq = sqlite3.SQLITE_ERROR_MISSING_COLLSEQ
+	ErrorRetry          = sqlite3.SQLITE_ERROR_RETRY
+	ErrorSnapshot       = sqlite3.SQLITE_ERROR_SNAPSHOT
+
+	AbortRollback = sqlite3.SQLITE_ABORT_ROLLBACK
+
+	BusyRecovery = sqlite3.SQLITE_BUSY_RECOVERY
+	BusySnapshot = sqlite3.SQLITE_BUSY_SNAPSHOT
+	BusyTimeout  = sqlite3.SQLITE_BUSY_TIMEOUT
+
+	LockedSharedCache = sqlite3.SQLITE_LOCKED_SHAREDCACHE
+	LockedVTab        = sqlite3.SQLITE_LOCKED_VTAB
+
+	ReadOnlyRecovery  = sqlite3.SQLITE_READONLY_RECOVERY
+	ReadOnlyCantLock  = sqlite3.SQLITE_READONLY_CANTLOCK
+	ReadOnlyRollback  = sqlite3.SQLITE_READONLY_ROLLBACK
+	ReadOnlyDBMoved   = sqlite3.SQLITE_READONLY_DBMOVED
+	ReadOnlyCantInit  = sqlite3.SQLITE_READONLY_CANTINIT
+	ReadOnlyDirectory = sqlite3.SQLITE_READONLY_DIRECTORY
+
+	IOErrRead              = sqlite3.SQLITE_IOERR_READ
+	IOErrShortRead         = sqlite3.SQLITE_IOERR_SHORT_READ
+	IOErrWrite             = sqlite3.SQLITE_IOERR_WRITE
+	IOErrFsync             = sqlite3.SQLITE_IOERR_FSYNC
+	IOErrDirFsync          = sqlite3.SQLITE_IOERR_DIR_FSYNC
+	IOErrTruncate          = sqlite3.SQLITE_IOERR_TRUNCATE
+	IOErrFstat             = sqlite3.SQLITE_IOERR_FSTAT
+	IOErrUnlock            = sqlite3.SQLITE_IOERR_UNLOCK
+	IOErrRdLock            = sqlite3.SQLITE_IOERR_RDLOCK
+	IOErrDelete            = sqlite3.SQLITE_IOERR_DELETE
+	IOErrBlocked           = sqlite3.SQLITE_IOERR_BLOCKED
+	IOErrNoMem             = sqlite3.SQLITE_IOERR_NOMEM
+	IOErrAccess            = sqlite3.SQLITE_IOERR_ACCESS
+	IOErrCheckReservedLock = sqlite3.SQLITE_IOERR_CHECKRESERVEDLOCK
+	IOErrLock              = sqlite3.SQLITE_IOERR_LOCK
+	IOErrClose             = sqlite3.SQLITE_IOERR_CLOSE
+	IOErrDirClose          = sqlite3.SQLITE_IOERR_DIR_CLOSE
+	IOErrShmOpen           = sqlite3.SQLITE_IOERR_SHMOPEN
+	IOErrShmSize           = sqlite3.SQLITE_IOERR_SHMSIZE
+	IOErrShmLock           = sqlite3.SQLITE_IOERR_SHMLOCK
+	IOErrShmMap            = sqlite3.SQLITE_IOERR_SHMMAP
+	IOErrSeek              = sqlite3.SQLITE_IOERR_SEEK
+	IOErrDeleteNoEnt       = sqlite3.SQLITE_IOERR_DELETE_NOENT
+	IOErrMmap              = sqlite3.SQLITE_IOERR_MMAP
+	IOErrGetTempPath       = sqlite3.SQLITE_IOERR_GETTEMPPATH
+	IOErrConvPath          = sqlite3.SQLITE_IOERR_CONVPATH
+	IOErrVnode             = sqlite3.SQLITE_IOERR_VNODE
+	IOErrAuth              = sqlite3.SQLITE_IOERR_AUTH
+	IOErrBeginAtomic       = sqlite3.SQLITE_IOERR_BEGIN_ATOMIC
+	IOErrCommitAtomic      = sqlite3.SQLITE_IOERR_COMMIT_ATOMIC
+	IOErrRollbackAtomic    = sqlite3.SQLITE_IOERR_ROLLBACK_ATOMIC
+	IOErrData              = sqlite3.SQLITE_IOERR_DATA
+	IOErrCorruptFS         = sqlite3.SQLITE_IOERR | 33<<8 // Not defined by SQLite 3.33.0 of windows/386.
+
+	CorruptVTab     = sqlite3.SQLITE_CORRUPT_VTAB
+	CorruptSequence = sqlite3.SQLITE_CORRUPT_SEQUENCE
+	CorruptIndex    = sqlite3.SQLITE_CORRUPT_INDEX
+
+	CantOpenNoTempDir = sqlite3.SQLITE_CANTOPEN_NOTEMPDIR
+	CantOpenIsDir     = sqlite3.SQLITE_CANTOPEN_ISDIR
+	CantOpenFullPath  = sqlite3.SQLITE_CANTOPEN_FULLPATH
+	CantOpenConvPath  = sqlite3.SQLITE_CANTOPEN_CONVPATH
+	CantOpenDirtyWAL  = sqlite3.SQLITE_CANTOPEN_DIRTYWAL
+	CantOpenSymlink   = sqlite3.SQLITE_CANTOPEN_SYMLINK
+
+	ConstraintCheck      = sqlite3.SQLITE_CONSTRAINT_CHECK
+	ConstraintCommitHook = sqlite3.SQLITE_CONSTRAINT_COMMITHOOK
+	ConstraintForeignKey = sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+	ConstraintFunction   = sqlite3.SQLITE_CONSTRAINT_FUNCTION
+	ConstraintNotNull    = sqlite3.SQLITE_CONSTRAINT_NOTNULL
+	ConstraintPrimaryKey = sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	ConstraintTrigger    = sqlite3.SQLITE_CONSTRAINT_TRIGGER
+	ConstraintUnique     = sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	ConstraintVTab       = sqlite3.SQLITE_CONSTRAINT_VTAB
+	ConstraintRowid      = sqlite3.SQLITE_CONSTRAINT_ROWID
+	ConstraintPinned     = sqlite3.SQLITE_CONSTRAINT_PINNED
+	ConstraintDataType   = sqlite3.SQLITE_CONSTRAINT | 12<<8 // Not defined by SQLite 3.33.0 of windows/386.
+
+	AuthUser = sqlite3.SQLITE_AUTH_USER
+
+	NoticeRecoverWAL      = sqlite3.SQLITE_NOTICE_RECOVER_WAL
+	NoticeRecoverRollback = sqlite3.SQLITE_NOTICE_RECOVER_ROLLBACK
+
+	WarningAutoIndex = sqlite3.SQLITE_WARNING_AUTOINDEX
+)
+
+var names = map[int]string{
+	OK:                     "SQLITE_OK",
+	Error:                  "SQLITE_ERROR",
+	Internal:               "SQLITE_INTERNAL",
+	Perm:                   "SQLITE_PERM",
+	Abort:                  "SQLITE_ABORT",
+	Busy:                   "SQLITE_BUSY",
+	Locked:                 "SQLITE_LOCKED",
+	NoMem:                  "SQLITE_NOMEM",
+	ReadOnly:               "SQLITE_READONLY",
+	Interrupt:              "SQLITE_INTERRUPT",
+	IOErr:                  "SQLITE_IOERR",
+	Corrupt:                "SQLITE_CORRUPT",
+	NotFound:               "SQLITE_NOTFOUND",
+	Full:                   "SQLITE_FULL",
+	CantOpen:               "SQLITE_CANTOPEN",
+	Protocol:               "SQLITE_PROTOCOL",
+	Empty:                  "SQLITE_EMPTY",
+	Schema:                 "SQLITE_SCHEMA",
+	TooBig:                 "SQLITE_TOOBIG",
+	Constraint:             "SQLITE_CONSTRAINT",
+	Mismatch:               "SQLITE_MISMATCH",
+	Misuse:                 "SQLITE_MISUSE",
+	NoLFS:                  "SQLITE_NOLFS",
+	Auth:                   "SQLITE_AUTH",
+	Format:                 "SQLITE_FORMAT",
+	Range:                  "SQLITE_RANGE",
+	NotADB:                 "SQLITE_NOTADB",
+	Notice:                 "SQLITE_NOTICE",
+	Warning:                "SQLITE_WARNING",
+	Row:                    "SQLITE_ROW",
+	Done:                   "SQLITE_DONE",
+	OKLoadPermanently:      "SQLITE_OK_LOAD_PERMANENTLY",
+	OKSymlink:              "SQLITE_OK_SYMLINK",
+	ErrorMissingCollSeq:    "SQLITE_ERROR_MISSING_COLLSEQ",
+	ErrorRetry:             "SQLITE_ERROR_RETRY",
+	ErrorSnapshot:          "SQLITE_ERROR_SNAPSHOT",
+	AbortRollback:          "SQLITE_ABORT_ROLLBACK",
+	BusyRecovery:           "SQLITE_BUSY_RECOVERY",
+	BusySnapshot:           "SQLITE_BUSY_SNAPSHOT",
+	BusyTimeout:            "SQLITE_BUSY_TIMEOUT",
+	LockedSharedCache:      "SQLITE_LOCKED_SHAREDCACHE",
+	LockedVTab:             "SQLITE_LOCKED_VTAB",
+	ReadOnlyRecovery:       "SQLITE_READONLY_RECOVERY",
+	ReadOnlyCantLock:       "SQLITE_READONLY_CANTLOCK",
+	ReadOnlyRollback:       "SQLITE_READONLY_ROLLBACK",
+	ReadOnlyDBMoved:        "SQLITE_READONLY_DBMOVED",
+	ReadOnlyCantInit:       "SQLITE_READONLY_CANTINIT",
+	ReadOnlyDirectory:      "SQLITE_READONLY_DIRECTORY",
+	IOErrRead:              "SQLITE_IOERR_READ",
+	IOErrShortRead:         "SQLITE_IOERR_SHORT_READ",
+	IOErrWrite:             "SQLITE_IOERR_WRITE",
+	IOErrFsync:             "SQLITE_IOERR_FSYNC",
+	IOErrDirFsync:          "SQLITE_IOERR_DIR_FSYNC",
+	IOErrTruncate:          "SQLITE_IOERR_TRUNCATE",
+	IOErrFstat:             "SQLITE_IOERR_FSTAT",
+	IOErrUnlock:            "SQLITE_IOERR_UNLOCK",
+	IOErrRdLock:            "SQLITE_IOERR_RDLOCK",
+	IOErrDelete:            "SQLITE_IOERR_DELETE",
+	IOErrBlocked:           "SQLITE_IOERR_BLOCKED",
+	IOErrNoMem:             "SQLITE_IOERR_NOMEM",
+	IOErrAccess:            "SQLITE_IOERR_ACCESS",
+	IOErrCheckReservedLock: "SQLITE_IOERR_CHECKRESERVEDLOCK",
+	IOErrLock:              "SQLITE_IOERR_LOCK",
+	IOErrClose:             "SQLITE_IOERR_CLOSE",
+	IOErrDirClose:          "SQLITE_IOERR_DIR_CLOSE",
+	IOErrShmOpen:           "SQLITE_IOERR_SHMOPEN",
+	IOErrShmSize:           "SQLITE_IOERR_SHMSIZE",
+	IOErrShmLock:           "SQLITE_IOERR_SHMLOCK",
+	IOErrShmMap:            "SQLITE_IOERR_SHMMAP",
+	IOErrSeek:              "SQLITE_IOERR_SEEK",
+	IOErrDeleteNoEnt:       "SQLITE_IOERR_DELETE_NOENT",
+	IOErrMmap:              "SQLITE_IOERR_MMAP",
+	IOErrGetTempPath:       "SQLITE_IOERR_GETTEMPPATH",
+	IOErrConvPath:          "SQLITE_IOERR_CONVPATH",
+	IOErrVnode:             "SQLITE_IOERR_VNODE",
+	IOErrAuth:              "SQLITE_IOERR_AUTH",
+	IOErrBeginAtomic:       "SQLITE_IOERR_BEGIN_ATOMIC",
+	IOErrCommitAtomic:      "SQLITE_IOERR_COMMIT_ATOMIC",
+	IOErrRollbackAtomic:    "SQLITE_IOERR_ROLLBACK_ATOMIC",
+	IOErrData:              "SQLITE_IOERR_DATA",
+	IOErrCorruptFS:         "SQLITE_IOERR_CORRUPTFS",
+	CorruptVTab:            "SQLITE_CORRUPT_VTAB",
+	CorruptSequence:        "SQLITE_CORRUPT_SEQUENCE",
+	CorruptIndex:           "SQLITE_CORRUPT_INDEX",
+	CantOpenNoTempDir:      "SQLITE_CANTOPEN_NOTEMPDIR",
+	CantOpenIsDir:          "SQLITE_CANTOPEN_ISDIR",
+	CantOpenFullPath:       "SQLITE_CANTOPEN_FULLPATH",
+	CantOpenConvPath:       "SQLITE_CANTOPEN_CONVPATH",
+	CantOpenDirtyWAL:       "SQLITE_CANTOPEN_DIRTYWAL",
+	CantOpenSymlink:        "SQLITE_CANTOPEN_SYMLINK",
+	ConstraintCheck:        "SQLITE_CONSTRAINT_CHECK",
+	ConstraintCommitHook:   "SQLITE_CONSTRAINT_COMMITHOOK",
+	ConstraintForeignKey:   "SQLITE_CONSTRAINT_FOREIGNKEY",
+	ConstraintFunction:     "SQLITE_CONSTRAINT_FUNCTION",
+	ConstraintNotNull:      "SQLITE_CONSTRAINT_NOTNULL",
+	ConstraintPrimaryKey:   "SQLITE_CONSTRAINT_PRIMARYKEY",
+	ConstraintTrigger:      "SQLITE_CONSTRAINT_TRIGGER",
+	ConstraintUnique:       "SQLITE_CONSTRAINT_UNIQUE",
+	ConstraintVTab:         "SQLITE_CONSTRAINT_VTAB",
+	ConstraintRowid:        "SQLITE_CONSTRAINT_ROWID",
+	ConstraintPinned:       "SQLITE_CONSTRAINT_PINNED",
+	ConstraintDataType:     "SQLITE_CONSTRAINT_DATATYPE",
+	AuthUser:               "SQLITE_AUTH_USER",
+	NoticeRecoverWAL:       "SQLITE_NOTICE_RECOVER_WAL",
+	NoticeRecoverRollback:  "SQLITE_NOTICE_RECOVER_ROLLBACK",
+	WarningAutoIndex:       "SQLITE_WARNING_AUTOINDEX",
+}
+
+// Primary returns the primary result code of the result code code.
+func Primary(code int) int { return code & 0xff }
+
+// Name returns the name of the result code code, like
+// "SQLITE_CONSTRAINT_UNIQUE", or "" if code is unknown.
+func Name(code int) string { return names[code] }
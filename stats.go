@@ -0,0 +1,134 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DriverStats holds process wide counters of the connections of the package,
+// see ReadDriverStats. The counters only grow, except OpenConns and
+// MemoryUsed.
+type DriverStats struct {
+	OpenConns   int64 // Connections open.
+	BusyRetries int64 // Retries of the busy handler of _lock_wait, see Driver.Open.
+	// AutoCheckpoints counts the WAL checkpoints run automatically on
+	// commit when the WAL exceeds wal_autocheckpoint pages. Connections
+	// changing wal_autocheckpoint using a PRAGMA statement, instead of the
+	// _pragma query parameter, stop counting them.
+	AutoCheckpoints int64
+	CacheHits       int64 // Page cache hits, see DBStatus.
+	CacheMisses     int64 // Page cache misses, see DBStatus.
+	MemoryUsed      int64 // See MemoryUsed.
+	MemoryHighwater int64 // See MemoryHighwater.
+}
+
+var (
+	busyRetries     int64 // Atomic.
+	autoCheckpoints int64 // Atomic.
+
+	statsMu     sync.Mutex
+	statsConns  = map[*conn]struct{}{}
+	cacheHits   int64 // Of connections closed or reset, see Status.
+	cacheMisses int64 // Of connections closed or reset, see Status.
+)
+
+// ReadDriverStats returns the process wide counters of the connections of the
+// package, for example to export them to a monitoring system. The module
+// modernc.org/sqlite/promsqlite exports them as Prometheus metrics.
+func ReadDriverStats() DriverStats {
+	tls := libc.NewTLS()
+
+	defer tls.Close()
+
+	p := libc.Xmalloc(tls, 8)
+	if p == 0 {
+		panic("OOM")
+	}
+
+	defer libc.Xfree(tls, p)
+
+	statsMu.Lock()
+	r := DriverStats{
+		OpenConns:       int64(len(statsConns)),
+		BusyRetries:     atomic.LoadInt64(&busyRetries),
+		AutoCheckpoints: atomic.LoadInt64(&autoCheckpoints),
+		CacheHits:       cacheHits,
+		CacheMisses:     cacheMisses,
+	}
+	// The connections are opened with SQLITE_OPEN_FULLMUTEX, so their
+	// counters can be read while they are used by other goroutines.
+	for c := range statsConns {
+		hits, misses := cacheStats(tls, c.db, p)
+		r.CacheHits += hits
+		r.CacheMisses += misses
+	}
+	statsMu.Unlock()
+	r.MemoryUsed = sqlite3.Xsqlite3_memory_used(tls)
+	r.MemoryHighwater = sqlite3.Xsqlite3_memory_highwater(tls, 0)
+	return r
+}
+
+// cacheStats returns the page cache hits and misses of db, using p to hold
+// the results.
+func cacheStats(tls *libc.TLS, db, p uintptr) (hits, misses int64) {
+	// int sqlite3_db_status(sqlite3*, int op, int *pCur, int *pHiwtr, int resetFlg);
+	if sqlite3.Xsqlite3_db_status(tls, db, sqlite3.SQLITE_DBSTATUS_CACHE_HIT, p, p+4, 0) == sqlite3.SQLITE_OK {
+		hits = int64(*(*int32)(unsafe.Pointer(p)))
+	}
+	if sqlite3.Xsqlite3_db_status(tls, db, sqlite3.SQLITE_DBSTATUS_CACHE_MISS, p, p+4, 0) == sqlite3.SQLITE_OK {
+		misses = int64(*(*int32)(unsafe.Pointer(p)))
+	}
+	return hits, misses
+}
+
+// registerStats adds the connection to the open ones of ReadDriverStats.
+func (c *conn) registerStats() {
+	statsMu.Lock()
+	statsConns[c] = struct{}{}
+	statsMu.Unlock()
+}
+
+// unregisterStats removes the connection from the open ones of
+// ReadDriverStats, keeping its counters. It must be called before the
+// connection is closed.
+func (c *conn) unregisterStats() {
+	statsMu.Lock()
+
+	defer statsMu.Unlock()
+
+	if _, ok := statsConns[c]; !ok {
+		return
+	}
+
+	delete(statsConns, c)
+	if c.db == 0 || c.panic {
+		return
+	}
+
+	p, err := c.malloc(8)
+	if err != nil {
+		return
+	}
+
+	defer c.free(p)
+
+	hits, misses := cacheStats(c.tls, c.db, p)
+	cacheHits += hits
+	cacheMisses += misses
+}
+
+// keepStats adds the counters of s, which were reset, to the totals of
+// ReadDriverStats. statsMu must be held since before the reset, so the totals
+// never shrink.
+func keepStats(s *DBStatus) {
+	cacheHits += s.CacheHits
+	cacheMisses += s.CacheMisses
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadDriverStats(t *testing.T) {
+	s0 := ReadDriverStats()
+	name := "file:" + uriEscape(filepath.Join(t.TempDir(), "test.db")) + "?_lock_wait=1m&_pragma=journal_mode(wal)&_pragma=wal_autocheckpoint(10)"
+	db, err := sql.Open(driverName, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("create table t(b)"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := db.Exec("insert into t values(zeroblob(10000))"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var n int
+	if err := db.QueryRow("select count(*) from t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second connection waits for the write lock of the first one.
+	other, err := sql.Open(driverName, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer other.Close()
+
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		tx.Commit()
+	}()
+	if _, err := other.Exec("insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := ReadDriverStats()
+	if g, e := s.OpenConns, s0.OpenConns+2; g < e {
+		t.Errorf("OpenConns %d, want at least %d", g, e)
+	}
+
+	if s.BusyRetries <= s0.BusyRetries {
+		t.Errorf("BusyRetries %d, want more than %d", s.BusyRetries, s0.BusyRetries)
+	}
+
+	if s.AutoCheckpoints <= s0.AutoCheckpoints {
+		t.Errorf("AutoCheckpoints %d, want more than %d", s.AutoCheckpoints, s0.AutoCheckpoints)
+	}
+
+	if s.CacheHits <= s0.CacheHits || s.CacheMisses <= s0.CacheMisses {
+		t.Errorf("cache hits %d and misses %d, want more than %d and %d", s.CacheHits, s.CacheMisses, s0.CacheHits, s0.CacheMisses)
+	}
+
+	if s.MemoryUsed <= 0 || s.MemoryHighwater < s.MemoryUsed {
+		t.Errorf("MemoryUsed %d, MemoryHighwater %d", s.MemoryUsed, s.MemoryHighwater)
+	}
+
+	// Closing and resetting connections keeps their counters.
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.Raw(func(c interface{}) error {
+		_, err := c.(interface{ Status(bool) (DBStatus, error) }).Status(true)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Close()
+	other.Close()
+	s2 := ReadDriverStats()
+	if s2.CacheHits < s.CacheHits || s2.CacheMisses < s.CacheMisses {
+		t.Errorf("cache hits %d and misses %d, want at least %d and %d", s2.CacheHits, s2.CacheMisses, s.CacheHits, s.CacheMisses)
+	}
+
+	if g, e := s2.OpenConns, s.OpenConns-1; g != e {
+		t.Errorf("OpenConns %d, want %d", g, e)
+	}
+}
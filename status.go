@@ -0,0 +1,135 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// StmtStatus holds the performance counters of statements, see
+// https://www.sqlite.org/c3ref/c_stmtstatus_counter.html.
+type StmtStatus struct {
+	FullscanSteps int64 // Forward steps of full table scans.
+	Sorts         int64 // Sort operations.
+	AutoIndexes   int64 // Rows inserted into automatic indexes.
+	VMSteps       int64 // Virtual machine operations executed.
+	Reprepares    int64 // Automatic re-preparations after schema changes.
+	Runs          int64 // Completed runs.
+	FilterHits    int64 // Bloom filter checks that found a possible match, zero on windows/386.
+	FilterMisses  int64 // Bloom filter checks that skipped a lookup, zero on windows/386.
+}
+
+func (s *StmtStatus) add(t StmtStatus) {
+	s.FullscanSteps += t.FullscanSteps
+	s.Sorts += t.Sorts
+	s.AutoIndexes += t.AutoIndexes
+	s.VMSteps += t.VMSteps
+	s.Reprepares += t.Reprepares
+	s.Runs += t.Runs
+	s.FilterHits += t.FilterHits
+	s.FilterMisses += t.FilterMisses
+}
+
+// int sqlite3_stmt_status(sqlite3_stmt*, int op,int resetFlg);
+func stmtStatus(tls *libc.TLS, pstmt uintptr) StmtStatus {
+	f := func(op int32) int64 { return int64(sqlite3.Xsqlite3_stmt_status(tls, pstmt, op, 0)) }
+	hits, misses := stmtFilterStatus(tls, pstmt)
+	return StmtStatus{
+		FullscanSteps: f(sqlite3.SQLITE_STMTSTATUS_FULLSCAN_STEP),
+		Sorts:         f(sqlite3.SQLITE_STMTSTATUS_SORT),
+		AutoIndexes:   f(sqlite3.SQLITE_STMTSTATUS_AUTOINDEX),
+		VMSteps:       f(sqlite3.SQLITE_STMTSTATUS_VM_STEP),
+		Reprepares:    f(sqlite3.SQLITE_STMTSTATUS_REPREPARE),
+		Runs:          f(sqlite3.SQLITE_STMTSTATUS_RUN),
+		FilterHits:    hits,
+		FilterMisses:  misses,
+	}
+}
+
+// DBStatus holds the status counters of a connection, see
+// https://www.sqlite.org/c3ref/c_dbstatus_options.html.
+type DBStatus struct {
+	CacheHits   int64 // Page cache hits.
+	CacheMisses int64 // Page cache misses.
+	CacheWrites int64 // Pages written from the cache to the database file.
+	CacheSpills int64 // Dirty pages written before the end of the transaction.
+	CacheUsed   int64 // Bytes of page cache memory in use.
+	SchemaUsed  int64 // Bytes of memory used by the schemas.
+	StmtUsed    int64 // Bytes of memory used by the prepared statements.
+
+	LookasideUsed       int64 // Lookaside memory slots in use.
+	LookasideHits       int64 // Allocations satisfied by lookaside memory.
+	LookasideMissesSize int64 // Allocations too large for lookaside memory.
+	LookasideMissesFull int64 // Allocations failed for lookaside memory being used up.
+
+	// Statements totals the counters of the statements finalized by the
+	// connection.
+	Statements StmtStatus
+}
+
+// Status returns the status counters of the connection. If reset is true, the
+// cache and lookaside hit and miss counters, and the statement totals, are
+// reset to zero afterwards.
+//
+// Status can be reached using (*sql.Conn).Raw.
+func (c *conn) Status(reset bool) (r DBStatus, err error) {
+	p, err := c.malloc(8)
+	if err != nil {
+		return r, err
+	}
+
+	defer c.free(p)
+
+	var resetFlag int32
+	if reset {
+		resetFlag = 1
+		statsMu.Lock()
+
+		defer statsMu.Unlock()
+	}
+	// int sqlite3_db_status(sqlite3*, int op, int *pCur, int *pHiwtr, int resetFlg);
+	f := func(op int32, hiwtr bool) int64 {
+		if err != nil {
+			return 0
+		}
+
+		if rc := sqlite3.Xsqlite3_db_status(c.tls, c.db, op, p, p+4, resetFlag); rc != sqlite3.SQLITE_OK {
+			err = c.errstr(rc)
+			return 0
+		}
+
+		if hiwtr {
+			return int64(*(*int32)(unsafe.Pointer(p + 4)))
+		}
+
+		return int64(*(*int32)(unsafe.Pointer(p)))
+	}
+	r = DBStatus{
+		CacheHits:           f(sqlite3.SQLITE_DBSTATUS_CACHE_HIT, false),
+		CacheMisses:         f(sqlite3.SQLITE_DBSTATUS_CACHE_MISS, false),
+		CacheWrites:         f(sqlite3.SQLITE_DBSTATUS_CACHE_WRITE, false),
+		CacheSpills:         f(sqlite3.SQLITE_DBSTATUS_CACHE_SPILL, false),
+		CacheUsed:           f(sqlite3.SQLITE_DBSTATUS_CACHE_USED, false),
+		SchemaUsed:          f(sqlite3.SQLITE_DBSTATUS_SCHEMA_USED, false),
+		StmtUsed:            f(sqlite3.SQLITE_DBSTATUS_STMT_USED, false),
+		LookasideUsed:       f(sqlite3.SQLITE_DBSTATUS_LOOKASIDE_USED, false),
+		LookasideHits:       f(sqlite3.SQLITE_DBSTATUS_LOOKASIDE_HIT, true),
+		LookasideMissesSize: f(sqlite3.SQLITE_DBSTATUS_LOOKASIDE_MISS_SIZE, true),
+		LookasideMissesFull: f(sqlite3.SQLITE_DBSTATUS_LOOKASIDE_MISS_FULL, true),
+		Statements:          c.stmtStatus,
+	}
+	if err != nil {
+		return DBStatus{}, err
+	}
+
+	if reset {
+		c.stmtStatus = StmtStatus{}
+		keepStats(&r)
+	}
+	return r, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// IsReadOnly reports whether none of the statements of query writes to the
+// database, see https://www.sqlite.org/c3ref/stmt_readonly.html. The
+// statements are prepared but not executed. Frameworks can use IsReadOnly to
+// route read only queries to replicas or to a pool of reading connections.
+// Transaction control statements, like BEGIN and COMMIT, and ATTACH and
+// DETACH are read only. The statements of a read only transaction, started by
+// BeginTx with sql.TxOptions.ReadOnly, are checked the same way and fail
+// before they execute if they would write.
+//
+// IsReadOnly can be reached using (*sql.Conn).Raw.
+func (c *conn) IsReadOnly(query string) (bool, error) {
+	psql, err := libc.CString(query)
+	if err != nil {
+		return false, err
+	}
+
+	defer c.free(psql)
+
+	for p := psql; *(*byte)(unsafe.Pointer(p)) != 0; {
+		pstmt, err := c.prepareV2(&p)
+		if err != nil {
+			return false, err
+		}
+
+		if pstmt == 0 {
+			continue
+		}
+
+		ro := c.stmtReadonly(pstmt)
+		if err := c.finalize(pstmt); err != nil {
+			return false, err
+		}
+
+		if !ro {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// checkReadOnly returns an error if c is in a read only transaction and the
+// prepared statement pstmt would write to the database.
+func (c *conn) checkReadOnly(pstmt uintptr) error {
+	if !c.readOnlyTx {
+		return nil
+	}
+
+	if c.autocommit() { // The transaction ended without Commit or Rollback.
+		c.readOnlyTx = false
+		return nil
+	}
+
+	if c.stmtReadonly(pstmt) {
+		return nil
+	}
+
+	return &Error{
+		msg:  fmt.Sprintf("sqlite: cannot write in a read only transaction: %s", libc.GoString(sqlite3.Xsqlite3_sql(c.tls, pstmt))),
+		code: sqlite3.SQLITE_READONLY,
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func TestIsReadOnly(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		sql string
+		ro  bool
+	}{
+		{"select * from t", true},
+		{"select 1; select 2", true},
+		{"begin; select * from t; commit", true},
+		{"insert into t values(1)", false},
+		{"select 1; delete from t", false},
+		{"create table u(i)", false},
+		{"", true},
+	} {
+		var got bool
+		if err := c.Raw(func(dc interface{}) (err error) {
+			got, err = dc.(*conn).IsReadOnly(v.sql)
+			return err
+		}); err != nil {
+			t.Fatal(v.sql, err)
+		}
+
+		if got != v.ro {
+			t.Errorf("%q: got %v, want %v", v.sql, got, v.ro)
+		}
+	}
+
+	if err := c.Raw(func(dc interface{}) error {
+		_, err := dc.(*conn).IsReadOnly("select * from nosuchtable")
+		return err
+	}); err == nil {
+		t.Error("unexpected success")
+	}
+
+	c.Close()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tx.Exec("insert into t values(1)")
+	var e *Error
+	if !errors.As(err, &e) || e.Code() != sqlite3.SQLITE_READONLY {
+		t.Fatalf("got %v, want SQLITE_READONLY", err)
+	}
+
+	if err := tx.QueryRow("select count(*) from t").Scan(new(int)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other transactions can write.
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = tx.Exec("insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !(windows && 386)
+// +build !windows !386
+
+// SQLite 3.33.0 of windows/386 has no STRICT tables.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// TestStrict checks the column types and the errors the driver reports for
+// STRICT tables and generated columns.
+func TestStrict(t *testing.T) {
+	db, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`
+create table s(i int, r real, t text, b blob, a any, g integer as (i + 1)) strict;
+insert into s(i, r, t, b, a) values(null, null, null, null, null), (1, 1.5, 'x', x'00', 'a');
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("insert into s(i) values('x')")
+	var e *Error
+	if !errors.As(err, &e) || e.Code() != sqlite3.SQLITE_CONSTRAINT_DATATYPE {
+		t.Fatalf("got %v, want SQLITE_CONSTRAINT_DATATYPE", err)
+	}
+
+	if ErrorCodeString[e.Code()] == "" {
+		t.Errorf("no ErrorCodeString for %d", e.Code())
+	}
+
+	rows, err := db.Query("select i, r, t, b, a, g from s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	names := []string{"INT", "REAL", "TEXT", "BLOB", "ANY", "INTEGER"}
+	scan := []reflect.Type{
+		reflect.TypeOf(int64(0)),
+		reflect.TypeOf(float64(0)),
+		reflect.TypeOf(""),
+		reflect.TypeOf([]byte(nil)),
+		reflect.TypeOf((*interface{})(nil)).Elem(),
+		reflect.TypeOf(int64(0)),
+	}
+	for row := 0; rows.Next(); row++ {
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, v := range types {
+			if g, e := v.DatabaseTypeName(), names[i]; g != e {
+				t.Errorf("row %d column %s: type name %q, want %q", row, v.Name(), g, e)
+			}
+
+			e := scan[i]
+			if row == 1 && i == 4 {
+				e = reflect.TypeOf("")
+			}
+			if g := v.ScanType(); g != e {
+				t.Errorf("row %d column %s: scan type %v, want %v", row, v.Name(), g, e)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,425 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// TraceEventKind is the kind of a TraceEvent.
+type TraceEventKind int
+
+// Values of TraceEventKind.
+const (
+	TraceStmt    TraceEventKind = iota // A statement starts running.
+	TraceProfile                       // A statement finished running.
+)
+
+// String implements fmt.Stringer.
+func (k TraceEventKind) String() string {
+	switch k {
+	case TraceStmt:
+		return "stmt"
+	case TraceProfile:
+		return "profile"
+	default:
+		return "TraceEventKind(?)"
+	}
+}
+
+// TraceEvent describes the execution of a statement, see SetTracer.
+type TraceEvent struct {
+	Kind TraceEventKind
+	// SQL is the text of the statement with its bound parameters expanded
+	// as literals. For a trigger and the statements it runs it is a
+	// comment starting with "--" instead, see Trigger.
+	SQL string
+	// Normalized is the text of the statement as prepared, normalized by
+	// NormalizeSQL, to aggregate the events of the executions of a query
+	// regardless of its literals and arguments. Empty for a trigger.
+	Normalized string
+	// Duration is the wall time the statement was running, measured by the
+	// Go runtime clock. Set for TraceProfile only.
+	Duration time.Duration
+	// Rows is the number of result rows produced by the statement. Set for
+	// TraceProfile only.
+	Rows int64
+	// Status holds the performance counters of the statement. Set for
+	// TraceProfile only.
+	Status StmtStatus
+	// Trigger reports whether the statement was run by a trigger.
+	Trigger bool
+}
+
+type tracer struct {
+	f       func(TraceEvent)
+	redact  func(param string) bool
+	running map[uintptr]*traced
+	skip    uintptr // Internal statement not reported, see conn.untrace.
+}
+
+// traced is a statement in progress.
+type traced struct {
+	start      time.Time
+	rows       int64
+	normalized string
+}
+
+var (
+	tracersMu sync.Mutex
+	tracers   = map[uintptr]*tracer{}
+	tracerID  uintptr
+)
+
+// SetTracer installs f to be called when a statement run by the connection
+// starts and when it finishes, see https://www.sqlite.org/c3ref/trace_v2.html.
+// f is called synchronously by the goroutine using the connection and must
+// not use the connection. The events of one statement can, for example, be
+// turned into a span of a distributed tracing system. Passing nil removes the
+// tracer.
+//
+// SetTracer can be reached using (*sql.Conn).Raw.
+func (c *conn) SetTracer(f func(TraceEvent)) error {
+	c.unregisterTracer()
+	if f == nil {
+		if rc := sqlite3.Xsqlite3_trace_v2(c.tls, c.db, 0, 0, 0); rc != sqlite3.SQLITE_OK {
+			return c.errstr(rc)
+		}
+
+		return nil
+	}
+
+	tracersMu.Lock()
+	tracerID++
+	id := tracerID
+	tracers[id] = &tracer{f: f, redact: c.traceRedact, running: map[uintptr]*traced{}}
+	tracersMu.Unlock()
+
+	// int sqlite3_trace_v2(
+	//   sqlite3*,
+	//   unsigned uMask,
+	//   int(*xCallback)(unsigned,void*,void*,void*),
+	//   void *pCtx
+	// );
+	if rc := sqlite3.Xsqlite3_trace_v2(
+		c.tls,
+		c.db,
+		sqlite3.SQLITE_TRACE_STMT|sqlite3.SQLITE_TRACE_PROFILE|sqlite3.SQLITE_TRACE_ROW|sqlite3.SQLITE_TRACE_CLOSE,
+		*(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uint32, uintptr, uintptr, uintptr) int32
+		}{xTrace})),
+		id,
+	); rc != sqlite3.SQLITE_OK {
+		tracersMu.Lock()
+		delete(tracers, id)
+		tracersMu.Unlock()
+		return c.errstr(rc)
+	}
+
+	c.tracer = id
+	return nil
+}
+
+// SetTraceRedaction installs f to select the parameters whose values are left
+// out of TraceEvent.SQL, like those holding passwords or tokens. f is passed
+// the name of a parameter, including its prefix, like ":password" or "$token",
+// or "?N" for the nameless parameter number N. Redacted parameters appear
+// unexpanded in TraceEvent.SQL. Statements whose text cannot be matched to
+// their expansion are traced without any parameter expanded. Passing nil
+// expands all parameters. The setting applies to the current and to later
+// tracers of the connection.
+//
+// SetTraceRedaction can be reached using (*sql.Conn).Raw.
+func (c *conn) SetTraceRedaction(f func(param string) bool) {
+	c.traceRedact = f
+	tracersMu.Lock()
+	if t := tracers[c.tracer]; t != nil {
+		t.redact = f
+	}
+	tracersMu.Unlock()
+}
+
+// untrace excludes the internal statement pstmt of the connection from the
+// events of its tracer, until untrace is called again.
+func (c *conn) untrace(pstmt uintptr) {
+	tracersMu.Lock()
+	if t := tracers[c.tracer]; t != nil {
+		t.skip = pstmt
+	}
+	tracersMu.Unlock()
+}
+
+func (c *conn) unregisterTracer() {
+	if c.tracer == 0 {
+		return
+	}
+
+	tracersMu.Lock()
+	delete(tracers, c.tracer)
+	tracersMu.Unlock()
+	c.tracer = 0
+}
+
+func xTrace(tls *libc.TLS, mask uint32, pCtx, p, x uintptr) int32 {
+	tracersMu.Lock()
+	t := tracers[pCtx]
+	var redact func(string) bool
+	var skip uintptr
+	if t != nil {
+		redact = t.redact
+		skip = t.skip
+	}
+	tracersMu.Unlock()
+	if t == nil || skip != 0 && p == skip {
+		return 0
+	}
+
+	switch mask {
+	case sqlite3.SQLITE_TRACE_STMT:
+		ev := TraceEvent{Kind: TraceStmt, SQL: libc.GoString(x)}
+		if strings.HasPrefix(ev.SQL, "--") {
+			ev.Trigger = true
+		} else {
+			ev.SQL = redactedSQL(tls, p, redact)
+			r := t.running[p]
+			if r == nil {
+				r = &traced{start: time.Now(), normalized: NormalizeSQL(libc.GoString(sqlite3.Xsqlite3_sql(tls, p)))}
+				t.running[p] = r
+			}
+			ev.Normalized = r.normalized
+		}
+		t.f(ev)
+	case sqlite3.SQLITE_TRACE_ROW:
+		if r := t.running[p]; r != nil {
+			r.rows++
+		}
+	case sqlite3.SQLITE_TRACE_PROFILE:
+		ev := TraceEvent{Kind: TraceProfile, SQL: redactedSQL(tls, p, redact), Status: stmtStatus(tls, p)}
+		if r := t.running[p]; r != nil {
+			ev.Duration = time.Since(r.start)
+			ev.Rows = r.rows
+			ev.Normalized = r.normalized
+			delete(t.running, p)
+		} else {
+			ev.Duration = time.Duration(*(*int64)(unsafe.Pointer(x)))
+			ev.Normalized = NormalizeSQL(libc.GoString(sqlite3.Xsqlite3_sql(tls, p)))
+		}
+		t.f(ev)
+	case sqlite3.SQLITE_TRACE_CLOSE:
+		t.running = map[uintptr]*traced{}
+	}
+	return 0
+}
+
+// char *sqlite3_expanded_sql(sqlite3_stmt *pStmt);
+func expandedSQL(tls *libc.TLS, pstmt uintptr) string {
+	p := sqlite3.Xsqlite3_expanded_sql(tls, pstmt)
+	if p == 0 {
+		return strings.TrimSpace(libc.GoString(sqlite3.Xsqlite3_sql(tls, pstmt)))
+	}
+
+	defer sqlite3.Xsqlite3_free(tls, p)
+
+	return strings.TrimSpace(libc.GoString(p))
+}
+
+// redactedSQL returns the expanded SQL of pstmt leaving the parameters
+// selected by redact unexpanded.
+func redactedSQL(tls *libc.TLS, pstmt uintptr, redact func(string) bool) string {
+	if redact == nil {
+		return expandedSQL(tls, pstmt)
+	}
+
+	sql := libc.GoString(sqlite3.Xsqlite3_sql(tls, pstmt))
+	p := sqlite3.Xsqlite3_expanded_sql(tls, pstmt)
+	if p == 0 {
+		return strings.TrimSpace(sql)
+	}
+
+	x := libc.GoString(p)
+	sqlite3.Xsqlite3_free(tls, p)
+	if r, ok := redactSQL(sql, x, redact); ok {
+		return strings.TrimSpace(r)
+	}
+
+	return strings.TrimSpace(sql)
+}
+
+// redactSQL walks sql and its expansion x, as produced by
+// sqlite3_expanded_sql, in step. It returns x with the literals of the
+// parameters selected by redact replaced by the parameter tokens of sql. The
+// result reports false if x is not an expansion of sql.
+func redactSQL(sql, x string, redact func(string) bool) (string, bool) {
+	var (
+		b     strings.Builder
+		names = map[string]int{}
+		nVar  int
+		j     int // Position in x.
+	)
+	for i := 0; i < len(sql); {
+		n, param := sqlToken(sql[i:])
+		tok := sql[i : i+n]
+		i += n
+		if !param {
+			if !strings.HasPrefix(x[j:], tok) {
+				return "", false
+			}
+
+			b.WriteString(tok)
+			j += n
+			continue
+		}
+
+		var name string
+		switch {
+		case tok == "?":
+			nVar++
+			name = "?" + strconv.Itoa(nVar)
+		case tok[0] == '?':
+			name = tok
+			if k, err := strconv.Atoi(tok[1:]); err == nil && k > nVar {
+				nVar = k
+			}
+		default:
+			name = tok
+			if _, ok := names[tok]; !ok {
+				nVar++
+				names[tok] = nVar
+			}
+		}
+		m := sqlLiteral(x[j:])
+		if m == 0 {
+			return "", false
+		}
+
+		if redact(name) {
+			b.WriteString(tok)
+		} else {
+			b.WriteString(x[j : j+m])
+		}
+		j += m
+	}
+	return b.String(), j == len(x)
+}
+
+// sqlToken returns the length of the token at the start of s, a quoted
+// string or identifier, a comment, a parameter or a single byte, and whether
+// it is a parameter.
+func sqlToken(s string) (int, bool) {
+	isID := func(c byte) bool {
+		return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+	}
+	switch c := s[0]; c {
+	case '\'', '"', '`', '[':
+		end := c
+		if c == '[' {
+			end = ']'
+		}
+		for i := 1; i < len(s); i++ {
+			if s[i] == end {
+				if end != ']' && i+1 < len(s) && s[i+1] == end {
+					i++
+					continue
+				}
+
+				return i + 1, false
+			}
+		}
+		return len(s), false
+	case '-':
+		if strings.HasPrefix(s, "--") {
+			if i := strings.IndexByte(s, '\n'); i >= 0 {
+				return i + 1, false
+			}
+
+			return len(s), false
+		}
+	case '/':
+		if strings.HasPrefix(s, "/*") {
+			if i := strings.Index(s[2:], "*/"); i >= 0 {
+				return i + 4, false
+			}
+
+			return len(s), false
+		}
+	case '?':
+		i := 1
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		return i, true
+	case ':', '@', '$':
+		i := 1
+		for i < len(s) && isID(s[i]) {
+			i++
+		}
+		if i > 1 {
+			return i, true
+		}
+	default:
+		if isID(c) {
+			i := 1
+			for i < len(s) && isID(s[i]) {
+				i++
+			}
+			return i, false
+		}
+	}
+	return 1, false
+}
+
+// sqlLiteral returns the length of the literal at the start of s as written
+// by sqlite3_expanded_sql: NULL, a number, a quoted string, a blob or a
+// zeroblob.
+func sqlLiteral(s string) int {
+	switch {
+	case s == "":
+		return 0
+	case s[0] == '\'' || strings.HasPrefix(s, "x'"):
+		for i := strings.IndexByte(s, '\'') + 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+					continue
+				}
+
+				return i + 1
+			}
+		}
+		return 0
+	case strings.HasPrefix(s, "zeroblob("):
+		return strings.IndexByte(s, ')') + 1
+	}
+
+	// NULL, Inf or a number formatted by %lld or %!.15g.
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	if i < len(s) && (s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z') {
+		for i < len(s) && (s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z') {
+			i++
+		}
+		return i
+	}
+
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	if i+1 < len(s) && s[i] == 'e' && (s[i+1] == '+' || s[i+1] == '-') {
+		i += 2
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+	}
+	return i
+}
@@ -0,0 +1,158 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// traceConn returns a connection of db whose trace events are appended to
+// *events.
+func traceConn(t *testing.T, db *sql.DB, events *[]TraceEvent) *sql.Conn {
+	c, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Raw(func(dc interface{}) error {
+		return dc.(*conn).SetTracer(func(e TraceEvent) { *events = append(*events, e) })
+	}); err != nil {
+		c.Close()
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestTracer(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	var events []TraceEvent
+	c := traceConn(t, db, &events)
+
+	defer c.Close()
+
+	ctx := context.Background()
+	if _, err := c.ExecContext(ctx, `
+create table t(i);
+create table log(i);
+create trigger tr after insert on t begin insert into log values(new.i); end;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	events = nil
+	if _, err := c.ExecContext(ctx, "insert into t values(?), (?), (?)", 1, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	var trigger bool
+	for _, e := range events {
+		if e.Trigger {
+			trigger = true
+			if e.Kind != TraceStmt || !strings.HasPrefix(e.SQL, "-- ") {
+				t.Errorf("unexpected trigger event %+v", e)
+			}
+		}
+	}
+	if !trigger {
+		t.Errorf("no trigger event in %+v", events)
+	}
+
+	events = nil
+	rows, err := c.QueryContext(ctx, "select i from t where i > ?", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for rows.Next() {
+	}
+	rows.Close()
+	if len(events) != 2 {
+		t.Fatalf("got %+v, want 2 events", events)
+	}
+
+	if g, e := events[0], (TraceEvent{Kind: TraceStmt, SQL: "select i from t where i > 0", Normalized: "select i from t where i > ?"}); g != e {
+		t.Errorf("got %+v, want %+v", g, e)
+	}
+
+	if e := events[1]; e.Kind != TraceProfile || e.SQL != "select i from t where i > 0" || e.Rows != 3 || e.Duration <= 0 || e.Status.VMSteps == 0 {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	if err := c.Raw(func(dc interface{}) error { return dc.(*conn).SetTracer(nil) }); err != nil {
+		t.Fatal(err)
+	}
+
+	events = nil
+	if _, err := c.ExecContext(ctx, "delete from t"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 0 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestTraceRedaction(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	var events []TraceEvent
+	c := traceConn(t, db, &events)
+
+	defer c.Close()
+
+	if err := c.Raw(func(dc interface{}) error {
+		dc.(*conn).SetTraceRedaction(func(param string) bool { return param == ":password" || param == "?2" })
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := c.QueryRowContext(ctx, "select :user, :password", sql.Named("user", "joe"), sql.Named("password", "secret")).Scan(new(string), new(string)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.QueryRowContext(ctx, "select ?, ?, 'it''s'", 1, "secret").Scan(new(int), new(string), new(string)); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, e := range events {
+		if e.Kind == TraceProfile {
+			got = append(got, e.SQL)
+		}
+	}
+	if g, e := strings.Join(got, "\n"), "select 'joe', :password\nselect 1, ?, 'it''s'"; g != e {
+		t.Fatalf("got\n%s\nwant\n%s", g, e)
+	}
+}
+
+func TestRedactSQL(t *testing.T) {
+	all := func(string) bool { return true }
+	for i, v := range []struct {
+		sql, x, want string
+		ok           bool
+	}{
+		{"select ?", "select 1", "select ?", true},
+		{"select ?, ?3, ?", "select 'a', x'00', 4.5e+20", "select ?, ?3, ?", true},
+		{"select $a /* ? */, '?' -- ?\n", "select NULL /* ? */, '?' -- ?\n", "select $a /* ? */, '?' -- ?\n", true},
+		{"select ?", "select 1, 2", "", false},
+		{"select ?", "insert 1", "", false},
+	} {
+		g, ok := redactSQL(v.sql, v.x, all)
+		if ok != v.ok || ok && g != v.want {
+			t.Errorf("%d: redactSQL(%q, %q) = %q, %v, want %q, %v", i, v.sql, v.x, g, ok, v.want, v.ok)
+		}
+	}
+}
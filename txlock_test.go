@@ -0,0 +1,94 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// TestTxLock checks the kind of the transactions started by BeginTx, set by
+// _txlock and sql.TxOptions.
+func TestTxLock(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	other, err := sql.Open(driverName, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer other.Close()
+
+	if _, err := other.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	busy := func(err error) bool {
+		var e *Error
+		return errors.As(err, &e) && e.Code()&0xff == sqlite3.SQLITE_BUSY
+	}
+	// canWrite and canRead report whether another connection can start a
+	// write or read a table.
+	canWrite := func() bool {
+		_, err := other.Exec("begin immediate; rollback")
+		if err != nil && !busy(err) {
+			t.Fatal(err)
+		}
+
+		return err == nil
+	}
+	canRead := func() bool {
+		var n int
+		err := other.QueryRow("select count(*) from t").Scan(&n)
+		if err != nil && !busy(err) {
+			t.Fatal(err)
+		}
+
+		return err == nil
+	}
+
+	ctx := context.Background()
+	for _, v := range []struct {
+		query string
+		opts  *sql.TxOptions
+		write bool
+		read  bool
+		kind  string
+	}{
+		{"", nil, true, true, "deferred"},
+		{"_txlock=immediate", nil, false, true, "immediate"},
+		{"_txlock=exclusive", nil, false, false, "exclusive"},
+		{"_time_format=sqlite&_txlock=immediate", nil, false, true, "immediate"},
+		{"_txlock=immediate", &sql.TxOptions{ReadOnly: true}, true, true, "deferred"},
+		{"", &sql.TxOptions{Isolation: sql.LevelSerializable}, false, true, "immediate"},
+		{"", &sql.TxOptions{Isolation: sql.LevelLinearizable}, false, false, "exclusive"},
+		{"_txlock=immediate", &sql.TxOptions{Isolation: sql.LevelReadCommitted}, false, true, "immediate"},
+	} {
+		db, err := sql.Open(driverName, fn+"?"+v.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tx, err := db.BeginTx(ctx, v.opts)
+		if err != nil {
+			t.Fatalf("%q %+v: %v", v.query, v.opts, err)
+		}
+
+		if g, e := canWrite(), v.write; g != e {
+			t.Errorf("%q %+v: can write %v, want %v (%s)", v.query, v.opts, g, e, v.kind)
+		}
+
+		if g, e := canRead(), v.read; g != e {
+			t.Errorf("%q %+v: can read %v, want %v (%s)", v.query, v.opts, g, e, v.kind)
+		}
+
+		tx.Rollback()
+		db.Close()
+	}
+}
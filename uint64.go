@@ -0,0 +1,94 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// uint64Mode selects how unsigned integers larger than math.MaxInt64 are
+// bound, see the _uint64 query parameter of Driver.Open.
+type uint64Mode int
+
+const (
+	uint64Error uint64Mode = iota
+	uint64Text
+	uint64Blob
+)
+
+// setUint64 handles the _uint64 query parameter.
+func (c *conn) setUint64(v string) error {
+	switch strings.ToLower(v) {
+	case "error":
+		c.uintMode = uint64Error
+	case "text":
+		c.uintMode = uint64Text
+	case "blob":
+		c.uintMode = uint64Blob
+	default:
+		return fmt.Errorf("unknown _uint64 %q", v)
+	}
+	return nil
+}
+
+// bindUint64 returns the value binding u, which is larger than
+// math.MaxInt64.
+func (c *conn) bindUint64(u uint64) (driver.Value, error) {
+	switch c.uintMode {
+	case uint64Text:
+		return strconv.FormatUint(u, 10), nil
+	case uint64Blob:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], u)
+		return b[:], nil
+	default:
+		return nil, fmt.Errorf("sqlite: uint64 value %d overflows an SQLite integer, see the _uint64 query parameter", u)
+	}
+}
+
+// Uint64 is an unsigned 64 bit integer which can be scanned from and bound
+// as any of the representations selected by the _uint64 query parameter, see
+// Driver.Open.
+type Uint64 uint64
+
+// Scan implements sql.Scanner. It accepts non-negative integers, decimal
+// text and 8 byte big endian blobs. Note that with the _text_bytes query
+// parameter text is scanned as []byte, so text of 8 characters is then taken
+// for a blob.
+func (u *Uint64) Scan(v interface{}) error {
+	switch x := v.(type) {
+	case int64:
+		if x < 0 {
+			return fmt.Errorf("sqlite: cannot scan %d into Uint64", x)
+		}
+
+		*u = Uint64(x)
+	case []byte:
+		if len(x) == 8 {
+			*u = Uint64(binary.BigEndian.Uint64(x))
+			return nil
+		}
+
+		return u.Scan(string(x))
+	case string:
+		n, err := strconv.ParseUint(strings.TrimSpace(x), 10, 64)
+		if err != nil {
+			return fmt.Errorf("sqlite: cannot scan %q into Uint64", x)
+		}
+
+		*u = Uint64(n)
+	default:
+		return fmt.Errorf("sqlite: cannot scan %T into Uint64", v)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer. The driver binds u as an integer if it fits,
+// otherwise as selected by the _uint64 query parameter.
+func (u Uint64) Value() (driver.Value, error) { return uint64(u), nil }
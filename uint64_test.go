@@ -0,0 +1,86 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+)
+
+func TestUint64(t *testing.T) {
+	values := []uint64{0, 42, math.MaxInt64, math.MaxInt64 + 1, 1e19, math.MaxUint64}
+	for _, mode := range []string{"error", "text", "blob"} {
+		db, err := sql.Open(driverName, "file::memory:?_uint64="+mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db.SetMaxOpenConns(1)
+		if _, err := db.Exec("create table t(u)"); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, v := range values {
+			_, err := db.Exec("insert into t values(?)", v)
+			if mode == "error" && v > math.MaxInt64 {
+				if err == nil {
+					t.Errorf("%s: %d: unexpected success", mode, v)
+				}
+				continue
+			}
+
+			if err != nil {
+				t.Fatalf("%s: %d: %v", mode, v, err)
+			}
+		}
+
+		p := Uint64(math.MaxUint64)
+		if _, err := db.Exec("insert into t values(?)", &p); err != nil && mode != "error" {
+			t.Fatalf("%s: %v", mode, err)
+		}
+
+		rows, err := db.Query("select u, typeof(u) from t order by u")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []uint64
+		for rows.Next() {
+			var u Uint64
+			var typ string
+			if err := rows.Scan(&u, &typ); err != nil {
+				t.Fatal(err)
+			}
+
+			if uint64(u) > math.MaxInt64 && typ != mode || uint64(u) <= math.MaxInt64 && typ != "integer" {
+				t.Errorf("%s: %d stored as %s", mode, u, typ)
+			}
+			got = append(got, uint64(u))
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := values[:3]
+		switch mode {
+		case "text":
+			// Text sorts as text.
+			want = []uint64{0, 42, math.MaxInt64, 1e19, math.MaxUint64, math.MaxUint64, math.MaxInt64 + 1}
+		case "blob":
+			want = append(values, math.MaxUint64)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %v, want %v", mode, got, want)
+		}
+
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%s: got %v, want %v", mode, got, want)
+			}
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var (
+	unicodeFuncsOnce sync.Once
+	unicodeFuncs     []*userDefinedFunction
+	unicodeFuncsErr  error
+
+	collationsMu sync.Mutex
+	collations   = map[uintptr]collator{}
+	collationID  uintptr
+)
+
+// collator is the Go implementation of a collation, see xCollationCompare.
+type collator interface {
+	compare(a, b []byte) int
+}
+
+// newCollationID returns the id passing coll to xCollationCompare. The id is
+// released by xCollationDestroy.
+func newCollationID(coll collator) uintptr {
+	collationsMu.Lock()
+
+	defer collationsMu.Unlock()
+
+	collationID++
+	collations[collationID] = coll
+	return collationID
+}
+
+// unicodeCollation is a collation created by icu_load_collation.
+type unicodeCollation struct {
+	mu sync.Mutex // collate.Collator is not safe for concurrent use.
+	c  *collate.Collator
+}
+
+func (u *unicodeCollation) compare(a, b []byte) int {
+	u.mu.Lock()
+
+	defer u.mu.Unlock()
+
+	return u.c.Compare(a, b)
+}
+
+// setUnicode handles the _unicode query parameter. Like _regexp, the functions
+// are created on c only.
+func (c *conn) setUnicode(v string) error {
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid _unicode %q", v)
+	}
+
+	if !on {
+		return nil
+	}
+
+	unicodeFuncsOnce.Do(func() {
+		for _, f := range []struct {
+			name  string
+			nArg  int32
+			xFunc func(ctx *FunctionContext, args []driver.Value) (driver.Value, error)
+		}{
+			{"like", -1, unicodeLike},
+			{"upper", -1, unicodeUpper},
+			{"lower", -1, unicodeLower},
+		} {
+			udf, err := newScalarFunction(f.name, f.nArg, sqlite3.SQLITE_UTF8|sqlite3.SQLITE_DETERMINISTIC, f.xFunc)
+			if err != nil {
+				unicodeFuncsErr = err
+				return
+			}
+
+			unicodeFuncs = append(unicodeFuncs, udf)
+		}
+
+		name, err := libc.CString("icu_load_collation")
+		if err != nil {
+			unicodeFuncsErr = err
+			return
+		}
+
+		unicodeFuncs = append(unicodeFuncs, &userDefinedFunction{
+			zFuncName: name,
+			nArg:      -1,
+			eTextRep:  sqlite3.SQLITE_UTF8,
+			xFunc:     loadCollation,
+		})
+	})
+	if unicodeFuncsErr != nil {
+		return unicodeFuncsErr
+	}
+
+	for _, udf := range unicodeFuncs {
+		if err := c.createFunctionInternal(udf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// like(Y, X[, Z]) implements X LIKE Y [ESCAPE Z] ignoring the case of all
+// Unicode letters, not only of the ASCII ones.
+func unicodeLike(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("wrong number of arguments to function like()")
+	}
+
+	escape := rune(-1)
+	if len(args) == 3 {
+		b, ok := valueBytes(args[2])
+		if !ok {
+			return nil, nil
+		}
+
+		r, n := utf8.DecodeRune(b)
+		if n == 0 || n != len(b) {
+			return nil, fmt.Errorf("ESCAPE expression must be a single character")
+		}
+
+		escape = r
+	}
+
+	pattern, ok := valueBytes(args[0])
+	if !ok {
+		return nil, nil
+	}
+
+	s, ok := valueBytes(args[1])
+	if !ok {
+		return nil, nil
+	}
+
+	return likeMatch([]rune(string(pattern)), []rune(string(s)), escape), nil
+}
+
+// likeMatch reports whether s matches the LIKE pattern, where % matches any
+// sequence of characters and _ matches a single character.
+func likeMatch(pattern, s []rune, escape rune) bool {
+	// Positions to resume at after the last %.
+	star, starS := -1, 0
+	p, i := 0, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			switch c := pattern[p]; {
+			case c == '%':
+				for p < len(pattern) && pattern[p] == '%' {
+					p++
+				}
+				star, starS = p, i
+				continue
+			case c == '_':
+				p++
+				i++
+				continue
+			default:
+				if c == escape && p+1 < len(pattern) {
+					p++
+					c = pattern[p]
+				}
+				if foldRune(c) == foldRune(s[i]) {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+
+		if star < 0 {
+			return false
+		}
+
+		// Let the last % match one more character.
+		starS++
+		p, i = star, starS
+	}
+
+	for p < len(pattern) && pattern[p] == '%' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// foldRune returns the smallest rune equivalent to r under simple Unicode case
+// folding.
+func foldRune(r rune) rune {
+	m := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < m {
+			m = f
+		}
+	}
+	return m
+}
+
+// upper(X[, LOCALE]) returns X converted to upper case using the Unicode rules
+// of LOCALE, for example "tr_TR", or the language independent ones.
+func unicodeUpper(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	return caseMap("upper", args, cases.Upper)
+}
+
+// lower(X[, LOCALE]) returns X converted to lower case using the Unicode rules
+// of LOCALE, for example "tr_TR", or the language independent ones.
+func unicodeLower(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	return caseMap("lower", args, cases.Lower)
+}
+
+func caseMap(name string, args []driver.Value, mapper func(language.Tag, ...cases.Option) cases.Caser) (driver.Value, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("wrong number of arguments to function %s()", name)
+	}
+
+	tag := language.Und
+	if len(args) == 2 {
+		var err error
+		if tag, err = parseLocale(args[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	switch x := args[0].(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		// Like the built-in functions, do not convert blobs to text.
+		if !utf8.Valid(x) {
+			return x, nil
+		}
+
+		return mapper(tag).Bytes(x), nil
+	default:
+		b, _ := valueBytes(x)
+		return mapper(tag).String(string(b)), nil
+	}
+}
+
+func parseLocale(v driver.Value) (language.Tag, error) {
+	b, ok := valueBytes(v)
+	if !ok {
+		return language.Und, fmt.Errorf("invalid locale: NULL")
+	}
+
+	// ICU locales use underscores, like "de_DE".
+	s := strings.ReplaceAll(string(b), "_", "-")
+	if s == "" || strings.EqualFold(s, "root") {
+		return language.Und, nil
+	}
+
+	tag, err := language.Parse(s)
+	if err != nil {
+		return language.Und, fmt.Errorf("invalid locale %q", b)
+	}
+
+	return tag, nil
+}
+
+// icu_load_collation(LOCALE, NAME[, STRENGTH]) creates on the connection the
+// collating sequence NAME comparing text according to the rules of LOCALE.
+// STRENGTH is one of "PRIMARY", which ignores case, accents and width,
+// "SECONDARY", which ignores case, or "TERTIARY", the default.
+func loadCollation(tls *libc.TLS, ctx uintptr, argc int32, argv uintptr) {
+	setError := func(msg string) {
+		p, err := libc.CString(msg)
+		if err != nil {
+			panic(err)
+		}
+
+		defer libc.Xfree(tls, p)
+
+		sqlite3.Xsqlite3_result_error(tls, ctx, p, -1)
+	}
+
+	if argc < 2 || argc > 3 {
+		setError("wrong number of arguments to function icu_load_collation()")
+		return
+	}
+
+	arg := func(i int) driver.Value {
+		p := *(*uintptr)(unsafe.Pointer(argv + uintptr(i)*sqliteValPtrSize))
+		if sqlite3.Xsqlite3_value_type(tls, p) == sqlite3.SQLITE_NULL {
+			return nil
+		}
+
+		return libc.GoString(sqlite3.Xsqlite3_value_text(tls, p))
+	}
+
+	tag, err := parseLocale(arg(0))
+	if err != nil {
+		setError(err.Error())
+		return
+	}
+
+	var opts []collate.Option
+	if argc == 3 {
+		strength, _ := arg(2).(string)
+		switch strings.ToUpper(strength) {
+		case "PRIMARY":
+			opts = append(opts, collate.Loose)
+		case "SECONDARY":
+			opts = append(opts, collate.IgnoreCase, collate.IgnoreWidth)
+		case "TERTIARY", "DEFAULT":
+		default:
+			setError(fmt.Sprintf("unknown collation strength: %q", strength))
+			return
+		}
+	}
+
+	name, _ := arg(1).(string)
+	zName, err := libc.CString(name)
+	if err != nil {
+		panic(err)
+	}
+
+	defer libc.Xfree(tls, zName)
+
+	id := newCollationID(&unicodeCollation{c: collate.New(tag, opts...)})
+
+	// xDestroy is not called when creating the collation fails.
+	db := sqlite3.Xsqlite3_context_db_handle(tls, ctx)
+	if rc := sqlite3.Xsqlite3_create_collation_v2(tls, db, zName, sqlite3.SQLITE_UTF8, id, xCollationCompare, xCollationDestroy); rc != sqlite3.SQLITE_OK {
+		collationDestroy(tls, id)
+		setError(fmt.Sprintf("icu_load_collation: %s", libc.GoString(sqlite3.Xsqlite3_errstr(tls, rc))))
+		return
+	}
+
+	sqlite3.Xsqlite3_result_null(tls, ctx)
+}
+
+var (
+	xCollationCompare = *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr, int32, uintptr, int32, uintptr) int32
+	}{collationCompare}))
+	xCollationDestroy = *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr)
+	}{collationDestroy}))
+)
+
+func collationCompare(tls *libc.TLS, pArg uintptr, n1 int32, p1 uintptr, n2 int32, p2 uintptr) int32 {
+	collationsMu.Lock()
+	coll := collations[pArg]
+	collationsMu.Unlock()
+
+	a, b := memBytes(p1, n1), memBytes(p2, n2)
+	if coll == nil {
+		return int32(bytes.Compare(a, b))
+	}
+
+	return int32(coll.compare(a, b))
+}
+
+func collationDestroy(tls *libc.TLS, pArg uintptr) {
+	collationsMu.Lock()
+	delete(collations, pArg)
+	collationsMu.Unlock()
+}
@@ -0,0 +1,168 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func openUnicode(t *testing.T) *sql.DB {
+	db, err := sql.Open(driverName, "file::memory:?_unicode=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Collations exist on the connection creating them only.
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestUnicodeFunctions(t *testing.T) {
+	db := openUnicode(t)
+
+	defer db.Close()
+
+	for _, v := range []struct {
+		sql  string
+		want interface{}
+	}{
+		{"select 'ÄBC' like 'äb%'", int64(1)},
+		{"select 'abc' like 'ABC'", int64(1)},
+		{"select 'é' like '_'", int64(1)},
+		{"select 'éé' like '_'", int64(0)},
+		{"select 'xaÿbz' like '%Ÿ_Z'", int64(1)},
+		{"select 'abc' like 'a%d'", int64(0)},
+		{"select '50%' like '50\\%' escape '\\'", int64(1)},
+		{"select '500' like '50\\%' escape '\\'", int64(0)},
+		{"select like('Ω%', 'ωmega')", int64(1)},
+		{"select null like 'a'", nil},
+		{"select upper('straße')", "STRASSE"},
+		{"select lower('ÀÉÎ')", "àéî"},
+		{"select upper('i', 'tr_TR')", "İ"},
+		{"select lower('I', 'tr')", "ı"},
+		{"select upper('i', 'root')", "I"},
+		{"select upper(42)", "42"},
+		{"select upper(null)", nil},
+		{"select hex(upper(x'ff61'))", "FF61"},
+	} {
+		var g interface{}
+		if err := db.QueryRow(v.sql).Scan(&g); err != nil {
+			t.Errorf("%s: %v", v.sql, err)
+			continue
+		}
+
+		if g != v.want {
+			t.Errorf("%s: got %v, want %v", v.sql, g, v.want)
+		}
+	}
+
+	for _, v := range []struct {
+		sql string
+		err string
+	}{
+		{"select 'a' like 'a' escape 'ab'", "ESCAPE expression must be a single character"},
+		{"select upper('a', 'not a locale!')", "invalid locale"},
+		{"select lower()", "wrong number of arguments"},
+		{"select icu_load_collation('de')", "wrong number of arguments"},
+		{"select icu_load_collation('de', 'x', 'QUATERNARY')", "unknown collation strength"},
+	} {
+		if _, err := db.Exec(v.sql); err == nil || !strings.Contains(err.Error(), v.err) {
+			t.Errorf("%s: got %v, want %q", v.sql, err, v.err)
+		}
+	}
+}
+
+// TestUnicodeCollation checks icu_load_collation orders text per locale and
+// strength.
+func TestUnicodeCollation(t *testing.T) {
+	db := openUnicode(t)
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+select icu_load_collation('de_DE', 'de');
+select icu_load_collation('sv_SE', 'sv');
+select icu_load_collation('de_DE', 'de1', 'PRIMARY');
+select icu_load_collation('de_DE', 'de2', 'secondary');
+create table t(s);
+insert into t values('z'), ('ä'), ('a'), ('B');
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []struct {
+		sql  string
+		want string
+	}{
+		{"select group_concat(s, ' ') from (select s from t order by s)", "B a z ä"},
+		{"select group_concat(s, ' ') from (select s from t order by s collate de)", "a ä B z"},
+		{"select group_concat(s, ' ') from (select s from t order by s collate sv)", "a B z ä"},
+		{"select 'a' = 'Ä' collate de1", "1"},
+		{"select 'a' = 'A' collate de2", "1"},
+		{"select 'a' = 'ä' collate de2", "0"},
+		{"select 'a' = 'A' collate de", "0"},
+	} {
+		var g string
+		if err := db.QueryRow(v.sql).Scan(&g); err != nil {
+			t.Errorf("%s: %v", v.sql, err)
+			continue
+		}
+
+		if g != v.want {
+			t.Errorf("%s: got %q, want %q", v.sql, g, v.want)
+		}
+	}
+
+	// Like in the ICU extension, replacing a collation fails as the calling
+	// statement is active, and the new one is released.
+	collationsMu.Lock()
+	n := len(collations)
+	collationsMu.Unlock()
+	if _, err := db.Exec("select icu_load_collation('sv_SE', 'de')"); err == nil || !strings.Contains(err.Error(), "database is locked") {
+		t.Fatalf("got %v, want database is locked", err)
+	}
+
+	collationsMu.Lock()
+	m := len(collations)
+	collationsMu.Unlock()
+	if m != n {
+		t.Fatalf("got %d collations, want %d", m, n)
+	}
+}
+
+// TestUnicodeOff checks the built-in functions handle ASCII case only without
+// the _unicode parameter.
+func TestUnicodeOff(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	var like int
+	var upper string
+	if err := db.QueryRow("select 'Ä' like 'ä', upper('ä')").Scan(&like, &upper); err != nil {
+		t.Fatal(err)
+	}
+
+	if like != 0 || upper != "ä" {
+		t.Fatalf("got %v %q, want 0 %q", like, upper, "ä")
+	}
+
+	if _, err := db.Exec("select icu_load_collation('de', 'de')"); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	db2, err := sql.Open(driverName, "file::memory:?_unicode=yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db2.Close()
+
+	if err := db2.Ping(); err == nil || !strings.Contains(err.Error(), `invalid _unicode "yes"`) {
+		t.Fatalf("got %v, want invalid _unicode", err)
+	}
+}
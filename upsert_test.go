@@ -0,0 +1,160 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func openMemory(t *testing.T) *sql.DB {
+	db, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+// TestUpsertResult checks RowsAffected and LastInsertId of upserts and of
+// statements modifying no row.
+func TestUpsertResult(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	for i, v := range []struct {
+		sql      string
+		affected int64
+		id       int64
+	}{
+		{"create table t(id integer primary key, k text unique, n int)", 0, 0},
+		{"insert into t(k, n) values('a', 1), ('b', 1), ('c', 1)", 3, 3},
+		{"insert into t(k, n) values('a', 1) on conflict(k) do update set n = n + 1", 1, 3},
+		{"insert into t(k, n) values('a', 1) on conflict(k) do nothing", 0, 0},
+		{"insert into t(k, n) values('d', 1) on conflict(k) do nothing", 1, 4},
+		{"insert into t(k, n) values('b', 1), ('e', 1) on conflict(k) do update set n = n + 1", 2, 5},
+		{"insert into t(k, n) values('a', 1) on conflict(k) do update set n = n + 1 where 0", 0, 0},
+		{"create table u(x)", 0, 0},
+		{"select 1", 0, 0},
+		{"update t set n = 0 where 0", 0, 0},
+		{"insert or replace into t(id, k, n) values(1, 'z', 5)", 1, 1},
+		{"insert into u values(last_insert_rowid())", 1, 1},
+	} {
+		r, err := db.Exec(v.sql)
+		if err != nil {
+			t.Fatalf("%d: %s: %v", i, v.sql, err)
+		}
+
+		affected, err := r.RowsAffected()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := r.LastInsertId()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if affected != v.affected || id != v.id {
+			t.Errorf("%d: %s: affected %d, id %d, want %d, %d", i, v.sql, affected, id, v.affected, v.id)
+		}
+	}
+
+	var n, x int64
+	if err := db.QueryRow("select n, (select x from u) from t where k = 'b'").Scan(&n, &x); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 || x != 1 {
+		t.Errorf("got n %d, x %d, want 2, 1", n, x)
+	}
+
+	var id int64
+	if err := db.QueryRow("insert into t(k, n) values('b', 1) on conflict(k) do update set n = 7 returning id").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+
+	if id != 2 {
+		t.Errorf("returning id %d, want 2", id)
+	}
+}
+
+// TestWindowRows checks window aggregates stream through Rows.
+func TestWindowRows(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	const n = 10000
+	if _, err := db.Exec(`
+create table w(i integer primary key, g int);
+insert into w with recursive s(i) as (select 1 union all select i + 1 from s where i < ?) select i, i % 3 from s;
+`, n); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`
+select i, sum(i) over (order by i), count(*) over (partition by g order by i), avg(i) over (order by i rows between 1 preceding and 1 following)
+from w order by i`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		i, sum, count int64
+		avg           float64
+		k             int64
+		counts        [3]int64
+	)
+	for rows.Next() {
+		if err := rows.Scan(&i, &sum, &count, &avg); err != nil {
+			t.Fatal(err)
+		}
+
+		k++
+		counts[k%3]++
+		ea := float64(3*k) / 3
+		switch k {
+		case 1:
+			ea = 1.5
+		case n:
+			ea = float64(2*k-1) / 2
+		}
+		if i != k || sum != k*(k+1)/2 || count != counts[k%3] || avg != ea {
+			t.Fatalf("row %d: got %d %d %d %v, want %d %d %d %v", k, i, sum, count, avg, k, k*(k+1)/2, counts[k%3], ea)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if k != n {
+		t.Fatalf("got %d rows, want %d", k, n)
+	}
+
+	// Closing a partially read window query frees the connection.
+	if rows, err = db.Query("select i, rank() over (order by g) from w"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var max int64
+	if err := db.QueryRow("select max(r) from (select dense_rank() over (order by g) as r from w)").Scan(&max); err != nil {
+		t.Fatal(err)
+	}
+
+	if max != 3 {
+		t.Errorf("got %d, want 3", max)
+	}
+}
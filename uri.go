@@ -0,0 +1,219 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// uriFilename returns the file name name, given with the query string query,
+// as an URI filename, see https://www.sqlite.org/uri.html, if query has
+// parameters for SQLite itself or for the VFS, ie. parameters not starting
+// with an underscore. Otherwise name is returned unchanged.
+func uriFilename(name, query string) string {
+	q, err := url.ParseQuery(query)
+	if err != nil { // Reported by applyQueryParams.
+		return name
+	}
+
+	var keys []string
+	for k := range q {
+		if !strings.HasPrefix(k, "_") {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return name
+	}
+
+	if runtime.GOOS == "windows" {
+		name = winURIPath(name)
+	}
+
+	var b strings.Builder
+	b.WriteString("file:")
+	if strings.HasPrefix(name, "/") {
+		b.WriteString("//") // Empty authority.
+	}
+	b.WriteString(uriEscape(name))
+	sort.Strings(keys)
+	sep := "?"
+	for _, k := range keys {
+		for _, v := range q[k] {
+			b.WriteString(sep)
+			b.WriteString(uriEscape(k))
+			b.WriteByte('=')
+			b.WriteString(uriEscape(v))
+			sep = "&"
+		}
+	}
+	return b.String()
+}
+
+// withURIParameter returns the database name dsn, as passed to
+// sqlite3_open_v2, with the URI parameter key=value added.
+func withURIParameter(dsn, key, value string) string {
+	param := uriEscape(key) + "=" + uriEscape(value)
+	if !strings.HasPrefix(dsn, "file:") {
+		return uriFilename(dsn, param)
+	}
+
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + param
+	}
+
+	return dsn + "?" + param
+}
+
+// openName returns the database name dsn, as given to Open or Attach, in the
+// form passed to sqlite3_open_v2, and the query string following it.
+func openName(dsn string) (name, query string) {
+	name = dsn
+	if pos := strings.IndexByte(dsn, '?'); pos >= 1 {
+		name, query = dsn[:pos], dsn[pos+1:]
+	}
+	if strings.HasPrefix(dsn, "file:") {
+		return dsn, query
+	}
+
+	if runtime.GOOS == "windows" {
+		name, query = winLongName(name, query)
+	}
+	return uriFilename(name, query), query
+}
+
+// Limits of the Win32 file API and of the win32 VFS of SQLite, see
+// https://learn.microsoft.com/windows/win32/fileio/maximum-file-path-limitation.
+const (
+	// Longer names of a database would leave no room for the "-journal"
+	// suffix of its rollback journal within MAX_PATH.
+	winMaxPath = 260 - len("-journal") - 1
+	// mxPathname of the win32 VFS, longer full names need win32-longpath.
+	winMaxPathBytes = 4 * 260
+)
+
+// winLongName returns the database name, given with the query string query,
+// in the \\?\ form if it is too long for the Win32 file API otherwise. The
+// query is extended to select the win32-longpath VFS if the name is also too
+// long for the win32 VFS and query does not select a VFS.
+func winLongName(name, query string) (string, string) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return name, query
+	}
+
+	long := winLongPath(name, cwd)
+	if long == name || len(long) < winMaxPathBytes {
+		return long, query
+	}
+
+	if q, err := url.ParseQuery(query); err != nil || q.Has("vfs") {
+		return long, query
+	}
+
+	if query != "" {
+		query += "&"
+	}
+	return long, query + "vfs=win32-longpath"
+}
+
+// winLongPath returns the Windows file name name, made absolute using the
+// working directory cwd, in the \\?\ or \\?\UNC\ form which is not limited
+// to MAX_PATH characters, if it is too long otherwise. Names in these forms
+// are not normalized by Windows, so the result uses backslashes only and has
+// no "." and ".." elements. Other names are returned unchanged.
+func winLongPath(name, cwd string) string {
+	switch name {
+	case "", ":memory:":
+		return name
+	}
+
+	s := strings.ReplaceAll(name, "/", `\`)
+	switch {
+	case strings.HasPrefix(s, `\\?\`), strings.HasPrefix(s, `\\.\`):
+		return name
+	case strings.HasPrefix(s, `\\`): // UNC
+	case isDriveLetter(s) && len(s) > 2 && s[2] == '\\':
+	case isDriveLetter(s): // Relative to the working directory of a drive.
+		return name
+	case strings.HasPrefix(s, `\`):
+		if !isDriveLetter(cwd) {
+			return name
+		}
+
+		s = cwd[:2] + s
+	default:
+		s = strings.TrimSuffix(strings.ReplaceAll(cwd, "/", `\`), `\`) + `\` + s
+	}
+	if len(s) < winMaxPath {
+		return name
+	}
+
+	prefix, root := `\\?\`, 1
+	if strings.HasPrefix(s, `\\`) {
+		prefix, root, s = `\\?\UNC\`, 2, s[2:]
+	}
+	var elems []string
+	for i, v := range strings.Split(s, `\`) {
+		switch {
+		case i < root:
+			elems = append(elems, v)
+		case v == "", v == ".":
+		case v == "..":
+			if len(elems) > root {
+				elems = elems[:len(elems)-1]
+			}
+		default:
+			elems = append(elems, v)
+		}
+	}
+	return prefix + strings.Join(elems, `\`)
+}
+
+// winURIPath returns the Windows file name name as the path of an URI
+// filename.
+func winURIPath(name string) string {
+	if strings.HasPrefix(name, `\\?\`) {
+		// Forward slashes are not allowed in this form. SQLite removes the
+		// slash before the prefix.
+		return "/" + name
+	}
+
+	name = strings.ReplaceAll(name, `\`, "/")
+	if isDriveLetter(name) {
+		name = "/" + name
+	}
+	return name
+}
+
+// isDriveLetter reports whether s starts with a Windows drive letter and a
+// colon.
+func isDriveLetter(s string) bool {
+	return len(s) >= 2 && s[1] == ':' && (s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z')
+}
+
+// uriEscape percent-encodes all bytes of s SQLite could interpret specially
+// in an URI filename. Unlike url.QueryEscape it never produces '+', which
+// SQLite does not decode.
+func uriEscape(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/', c == ':':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,192 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"modernc.org/libc"
+)
+
+func TestWinLongPath(t *testing.T) {
+	deep := strings.Repeat(`modcache\`, 30)
+	for i, v := range []struct {
+		name, cwd, want string
+	}{
+		{"", `C:\work`, ""},
+		{":memory:", `C:\work`, ":memory:"},
+		{"test.db", `C:\work`, "test.db"},
+		{`C:\work\test.db`, `C:\`, `C:\work\test.db`},
+		{`C:\` + deep + "test.db", `D:\`, `\\?\C:\` + deep + "test.db"},
+		{"C:/" + strings.ReplaceAll(deep, `\`, "/") + "test.db", `D:\`, `\\?\C:\` + deep + "test.db"},
+		{`C:\` + deep + `.\x\..\test.db`, `D:\`, `\\?\C:\` + deep + "test.db"},
+		{`C:a\` + deep + "test.db", `D:\`, `C:a\` + deep + "test.db"},
+		{deep + "test.db", `D:\work\`, `\\?\D:\work\` + deep + "test.db"},
+		{deep + "test.db", `D:/work`, `\\?\D:\work\` + deep + "test.db"},
+		{`\` + deep + "test.db", `D:\work`, `\\?\D:\` + deep + "test.db"},
+		{`\\server\share\` + deep + "test.db", `D:\`, `\\?\UNC\server\share\` + deep + "test.db"},
+		{`\\server\share\..\` + deep + "test.db", `D:\`, `\\?\UNC\server\share\` + deep + "test.db"},
+		{deep + "test.db", `\\server\share`, `\\?\UNC\server\share\` + deep + "test.db"},
+		{`\\?\C:\` + deep + "test.db", `D:\`, `\\?\C:\` + deep + "test.db"},
+		{`\\.\pipe\x`, `D:\` + deep, `\\.\pipe\x`},
+		{`C:\` + deep + "данные.db", `D:\`, `\\?\C:\` + deep + "данные.db"},
+	} {
+		if g, e := winLongPath(v.name, v.cwd), v.want; g != e {
+			t.Errorf("%d: winLongPath(%q, %q)\ngot  %q\nwant %q", i, v.name, v.cwd, g, e)
+		}
+	}
+}
+
+func TestWinURIPath(t *testing.T) {
+	for i, v := range []struct {
+		name, want string
+	}{
+		{"test.db", "test.db"},
+		{`dir\test.db`, "dir/test.db"},
+		{`C:\dir\test.db`, "/C:/dir/test.db"},
+		{`\\server\share\test.db`, "//server/share/test.db"},
+		{`\\?\C:\dir\test.db`, `/\\?\C:\dir\test.db`},
+		{`\\?\UNC\server\share\test.db`, `/\\?\UNC\server\share\test.db`},
+	} {
+		if g, e := winURIPath(v.name), v.want; g != e {
+			t.Errorf("%d: winURIPath(%q) %q, want %q", i, v.name, g, e)
+		}
+	}
+}
+
+// TestLongPath checks a database in a directory whose path is longer than
+// MAX_PATH of Windows and contains non-ASCII characters can be written using
+// a rollback journal, with and without URI parameters.
+func TestLongPath(t *testing.T) {
+	dir := t.TempDir()
+	for len(dir) < winMaxPath+100 { // The unix VFS is limited to 512 bytes.
+		dir = filepath.Join(dir, "модуль-"+strings.Repeat("x", 40))
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Skip(err)
+	}
+
+	name := filepath.Join(dir, "test.db")
+	for _, dsn := range []string{name, name + "?cache=private&_pragma=journal_mode(delete)"} {
+		db, err := sql.Open(driverName, dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec("create table if not exists t(x); insert into t values(1)"); err != nil {
+			db.Close()
+			t.Fatalf("%q: %v", dsn, err)
+		}
+
+		db.Close()
+	}
+
+	db, err := sql.Open(driverName, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow("select count(*) from t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("got %d rows, want 2", n)
+	}
+}
+
+func TestURIFilename(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows file names are tested by TestWinURIPath")
+	}
+
+	for i, v := range []struct {
+		name, query, want string
+	}{
+		{"/tmp/a b.db", "", "/tmp/a b.db"},
+		{"/tmp/a b.db", "_txlock=immediate", "/tmp/a b.db"},
+		{"/tmp/a b.db", "mode=ro", "file:///tmp/a%20b.db?mode=ro"},
+		{"/tmp/a b.db", "mode=ro&_txlock=immediate", "file:///tmp/a%20b.db?mode=ro"},
+		{"data/50%.db", "vfs=audit", "file:data/50%25.db?vfs=audit"},
+		{":memory:", "cache=shared", "file::memory:?cache=shared"},
+		{"a?#.db", "mode=ro", "file:a%3F%23.db?mode=ro"},
+		{"a.db", "vfs=x&mode=ro&key=a+b%2B&key=c", "file:a.db?key=a%20b%2B&key=c&mode=ro&vfs=x"},
+		{"a.db", "%zz", "a.db"},
+	} {
+		if g, e := uriFilename(v.name, v.query), v.want; g != e {
+			t.Errorf("%d: uriFilename(%q, %q)\ngot  %q\nwant %q", i, v.name, v.query, g, e)
+		}
+	}
+}
+
+var (
+	uriTestVFSOnce sync.Once
+	uriTestVFSErr  error
+	uriTestMu      sync.Mutex
+	uriTestParam   map[string]string // Main database file name: value of the "custom" parameter.
+)
+
+// TestURIParameters checks the parameters of a plain file name needing
+// escapes reach SQLite and the VFS.
+func TestURIParameters(t *testing.T) {
+	uriTestVFSOnce.Do(func() {
+		uriTestParam = map[string]string{}
+		_, uriTestVFSErr = registerShimVFS("uri-test", "", func(tls *libc.TLS, f *shimFile) (fileHooks, error) {
+			if v, ok := f.uriParameter(tls, "custom"); ok {
+				uriTestMu.Lock()
+				uriTestParam[filepath.Base(libc.GoString(f.zName))] = v
+				uriTestMu.Unlock()
+			}
+			return nil, nil
+		})
+	})
+	if uriTestVFSErr != nil {
+		t.Fatal(uriTestVFSErr)
+	}
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a b%#.db")
+	db, err := sql.Open(driverName, name+"?vfs=uri-test&custom=x+y%26z&_pragma=journal_mode(delete)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(name); err != nil {
+		t.Fatal(err)
+	}
+
+	uriTestMu.Lock()
+	v, ok := uriTestParam["a b%#.db"]
+	uriTestMu.Unlock()
+	if !ok || v != "x y&z" {
+		t.Fatalf("custom parameter %q, %v, want %q", v, ok, "x y&z")
+	}
+
+	ro, err := sql.Open(driverName, name+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ro.Close()
+
+	if _, err := ro.Exec("insert into t values(1)"); err == nil {
+		t.Fatal("unexpected success")
+	}
+}
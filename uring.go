@@ -0,0 +1,336 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux && sqlite_uring
+// +build linux,sqlite_uring
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// io_uring ABI, see include/uapi/linux/io_uring.h of the Linux sources.
+const (
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+
+	ioringFeatSingleMmap = 1 << 0
+	ioringEnterGetEvents = 1 << 0
+	ioringFsyncDatasync  = 1 << 0
+
+	ioringOpReadv  = 1
+	ioringOpWritev = 2
+	ioringOpFsync  = 3
+
+	uringEntries = 4
+)
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  uringSQOffsets
+	cqOff                                                                  uringCQOffsets
+}
+
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	pad         [2]uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// uring is an io_uring instance used synchronously: every operation is
+// submitted and waited for by a single io_uring_enter call.
+type uring struct {
+	fd       int
+	rings    [][]byte // Mappings, unmapped by close.
+	sqHead   *uint32
+	sqTail   *uint32
+	sqMask   uint32
+	sqArray  uintptr
+	sqes     uintptr
+	cqHead   *uint32
+	cqTail   *uint32
+	cqMask   uint32
+	cqes     uintptr
+	iov      unix.Iovec
+	disabled bool // An io_uring_enter failed, the ring state is unknown.
+}
+
+func newURing() (_ *uring, err error) {
+	var p uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uringEntries, uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	r := &uring{fd: int(fd)}
+
+	defer func() {
+		if err != nil {
+			r.close()
+		}
+	}()
+
+	mmap := func(off int64, n uint32) (uintptr, error) {
+		b, err := unix.Mmap(r.fd, off, int(n), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+		if err != nil {
+			return 0, err
+		}
+
+		r.rings = append(r.rings, b)
+		return uintptr(unsafe.Pointer(&b[0])), nil
+	}
+	sqSize := p.sqOff.array + p.sqEntries*4
+	cqSize := p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(uringCQE{}))
+	if p.features&ioringFeatSingleMmap != 0 && cqSize > sqSize {
+		sqSize = cqSize
+	}
+	sq, err := mmap(ioringOffSQRing, sqSize)
+	if err != nil {
+		return nil, err
+	}
+
+	cq := sq
+	if p.features&ioringFeatSingleMmap == 0 {
+		if cq, err = mmap(ioringOffCQRing, cqSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.sqes, err = mmap(ioringOffSQEs, p.sqEntries*uint32(unsafe.Sizeof(uringSQE{}))); err != nil {
+		return nil, err
+	}
+
+	r.sqHead = (*uint32)(unsafe.Pointer(sq + uintptr(p.sqOff.head)))
+	r.sqTail = (*uint32)(unsafe.Pointer(sq + uintptr(p.sqOff.tail)))
+	r.sqMask = *(*uint32)(unsafe.Pointer(sq + uintptr(p.sqOff.ringMask)))
+	r.sqArray = sq + uintptr(p.sqOff.array)
+	r.cqHead = (*uint32)(unsafe.Pointer(cq + uintptr(p.cqOff.head)))
+	r.cqTail = (*uint32)(unsafe.Pointer(cq + uintptr(p.cqOff.tail)))
+	r.cqMask = *(*uint32)(unsafe.Pointer(cq + uintptr(p.cqOff.ringMask)))
+	r.cqes = cq + uintptr(p.cqOff.cqes)
+	return r, nil
+}
+
+func (r *uring) close() {
+	for _, v := range r.rings {
+		unix.Munmap(v)
+	}
+	r.rings = nil
+	if r.fd >= 0 {
+		unix.Close(r.fd)
+		r.fd = -1
+	}
+}
+
+// do runs the operation op on the file descriptor fd and returns its result,
+// a negative errno on failure.
+func (r *uring) do(op uint8, fd int32, addr uintptr, n uint32, off int64, opFlags uint32) (int32, error) {
+	if r.disabled {
+		return 0, fmt.Errorf("io_uring disabled after a failure")
+	}
+
+	tail := *r.sqTail
+	i := tail & r.sqMask
+	*(*uringSQE)(unsafe.Pointer(r.sqes + uintptr(i)*unsafe.Sizeof(uringSQE{}))) = uringSQE{
+		opcode:  op,
+		fd:      fd,
+		off:     uint64(off),
+		addr:    uint64(addr),
+		len:     n,
+		opFlags: opFlags,
+	}
+	*(*uint32)(unsafe.Pointer(r.sqArray + uintptr(i)*4)) = i
+	atomic.StoreUint32(r.sqTail, tail+1)
+	head := *r.cqHead
+	for atomic.LoadUint32(r.cqTail) == head {
+		submit := tail + 1 - atomic.LoadUint32(r.sqHead)
+		if _, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(submit), 1, ioringEnterGetEvents, 0, 0); errno != 0 && errno != unix.EINTR {
+			r.disabled = true
+			return 0, errno
+		}
+	}
+	res := (*uringCQE)(unsafe.Pointer(r.cqes + uintptr(head&r.cqMask)*unsafe.Sizeof(uringCQE{}))).res
+	atomic.StoreUint32(r.cqHead, head+1)
+	return res, nil
+}
+
+// rw reads or writes the n bytes at p using a readv or writev of a single
+// buffer.
+func (r *uring) rw(op uint8, fd int32, p uintptr, n int32, off int64) (int32, error) {
+	r.iov.Base = (*byte)(unsafe.Pointer(p))
+	r.iov.SetLen(int(n))
+	return r.do(op, fd, uintptr(unsafe.Pointer(&r.iov)), 1, off, 0)
+}
+
+var (
+	uringNotice sync.Once
+
+	// Rings of closed files, for reuse by files opened later, like the
+	// rollback journals of consecutive transactions.
+	uringFreeMu sync.Mutex
+	uringFree   []*uring
+)
+
+const uringFreeMax = 16
+
+func acquireURing() (*uring, error) {
+	uringFreeMu.Lock()
+	if n := len(uringFree); n != 0 {
+		r := uringFree[n-1]
+		uringFree = uringFree[:n-1]
+		uringFreeMu.Unlock()
+		return r, nil
+	}
+
+	uringFreeMu.Unlock()
+	return newURing()
+}
+
+func releaseURing(r *uring) {
+	uringFreeMu.Lock()
+
+	defer uringFreeMu.Unlock()
+
+	if r.disabled || len(uringFree) == uringFreeMax {
+		r.close()
+		return
+	}
+
+	uringFree = append(uringFree, r)
+}
+
+// RegisterIOUringVFS registers a VFS named name which forwards to the unix
+// VFS while performing the reads, writes and syncs of its files using
+// io_uring, see https://kernel.dk/io_uring.pdf. The VFS is experimental and
+// built only on Linux with the sqlite_uring build tag. Every operation is
+// still submitted and waited for separately, so the VFS does not batch I/O.
+//
+// If the kernel does not provide io_uring, or its use is not permitted, the
+// files are read and written by the unix VFS as usual. Without the build tag
+// RegisterIOUringVFS registers a VFS forwarding everything to the default
+// VFS.
+//
+// To use the VFS, pass its name in the vfs query parameter of a URI file
+// name, for example
+//
+//	db, err := sql.Open("sqlite3", "file:app.db?vfs=uring")
+func RegisterIOUringVFS(name string) error {
+	_, err := registerShimVFS(name, "unix", openURing)
+	return err
+}
+
+func openURing(tls *libc.TLS, f *shimFile) (fileHooks, error) {
+	r, err := acquireURing()
+	if err != nil {
+		uringNotice.Do(func() {
+			logf(sqlite3.SQLITE_NOTICE, "sqlite: io_uring not available, using the unix VFS: %v", err)
+		})
+		return nil, nil
+	}
+
+	return &uringFile{r: r, fd: (*sqlite3.UnixFile)(unsafe.Pointer(f.real)).Fh}, nil
+}
+
+// uringFile performs the I/O of a unix file using io_uring.
+type uringFile struct {
+	passThrough
+	r  *uring
+	fd int32
+}
+
+func (u *uringFile) close(tls *libc.TLS, f *shimFile) int32 {
+	releaseURing(u.r)
+	return u.passThrough.close(tls, f)
+}
+
+func (u *uringFile) read(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32 {
+	for got := int32(0); got < n; {
+		res, err := u.r.rw(ioringOpReadv, u.fd, p+uintptr(got), n-got, off+int64(got))
+		switch {
+		case err != nil || res < 0:
+			return sqlite3.SQLITE_IOERR_READ
+		case res == 0:
+			// Unread parts must be zero filled, see sqlite3_io_methods.
+			b := memBytes(p+uintptr(got), n-got)
+			for i := range b {
+				b[i] = 0
+			}
+			return sqlite3.SQLITE_IOERR_SHORT_READ
+		}
+
+		got += res
+	}
+	return sqlite3.SQLITE_OK
+}
+
+func (u *uringFile) write(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32 {
+	for done := int32(0); done < n; {
+		res, err := u.r.rw(ioringOpWritev, u.fd, p+uintptr(done), n-done, off+int64(done))
+		switch {
+		case err != nil:
+			return sqlite3.SQLITE_IOERR_WRITE
+		case res == -int32(unix.ENOSPC), res == 0:
+			return sqlite3.SQLITE_FULL
+		case res < 0:
+			return sqlite3.SQLITE_IOERR_WRITE
+		}
+
+		done += res
+	}
+	return sqlite3.SQLITE_OK
+}
+
+func (u *uringFile) sync(tls *libc.TLS, f *shimFile, flags int32) int32 {
+	// The first sync of a new journal also syncs its directory, leave that
+	// to the unix VFS.
+	if int32((*sqlite3.UnixFile)(unsafe.Pointer(f.real)).FctrlFlags)&sqlite3.UNIXFILE_DIRSYNC != 0 {
+		return u.passThrough.sync(tls, f, flags)
+	}
+
+	var opFlags uint32
+	if flags&sqlite3.SQLITE_SYNC_DATAONLY != 0 {
+		opFlags = ioringFsyncDatasync
+	}
+	if res, err := u.r.do(ioringOpFsync, u.fd, 0, 0, 0, opFlags); err != nil || res < 0 {
+		return sqlite3.SQLITE_IOERR_FSYNC
+	}
+
+	return sqlite3.SQLITE_OK
+}
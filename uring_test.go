@@ -0,0 +1,60 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// TestIOUringVFS runs transactions using the VFS registered by
+// RegisterIOUringVFS and checks the database using the default VFS. Run with
+// -tags sqlite_uring on Linux to test io_uring.
+func TestIOUringVFS(t *testing.T) {
+	if err := RegisterIOUringVFS("test-uring"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, journal := range []string{"delete", "wal"} {
+		name := filepath.Join(t.TempDir(), "test.db")
+		db, err := sql.Open(driverName, "file:"+uriEscape(name)+"?vfs=test-uring&_pragma=journal_mode("+journal+")")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec(`
+create table t(i integer primary key, b blob);
+insert into t(b) with recursive s(i) as (select 1 union all select i + 1 from s where i < 1000) select randomblob(1000) from s;
+`); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 20; i++ {
+			if _, err := db.Exec("update t set b = randomblob(500 + ?) where i % 20 = ?", i, i); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if db, err = sql.Open(driverName, name); err != nil {
+			t.Fatal(err)
+		}
+
+		var check string
+		var n int
+		if err := db.QueryRow("select (select * from pragma_integrity_check), count(*) from t").Scan(&check, &n); err != nil {
+			t.Fatal(err)
+		}
+
+		if check != "ok" || n != 1000 {
+			t.Errorf("%s: integrity check %q, %d rows", journal, check, n)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+)
+
+func init() {
+	MustRegisterScalarFunction("uuid", 0, uuidNew)
+	MustRegisterDeterministicScalarFunction("uuid_str", 1, uuidStr)
+	MustRegisterDeterministicScalarFunction("uuid_blob", 1, uuidBlob)
+}
+
+// uuid() returns a new random version 4 UUID as text, like
+// "3b4e2bf9-9d17-4a0e-8c2f-0a6b7be3c5a1".
+func uuidNew(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return nil, err
+	}
+
+	u[6] = u[6]&0x0f | 0x40 // Version 4.
+	u[8] = u[8]&0x3f | 0x80 // Variant RFC 4122.
+	return uuidFormat(u[:]), nil
+}
+
+// uuid_str(X) returns the UUID X, a 16 byte blob or text, in the canonical
+// text form. It returns NULL if X is not a UUID.
+func uuidStr(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	u, ok := uuidParse(args[0])
+	if !ok {
+		return nil, nil
+	}
+
+	return uuidFormat(u), nil
+}
+
+// uuid_blob(X) returns the UUID X, a 16 byte blob or text, as a 16 byte blob.
+// It returns NULL if X is not a UUID.
+func uuidBlob(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	u, ok := uuidParse(args[0])
+	if !ok {
+		return nil, nil
+	}
+
+	return u, nil
+}
+
+func uuidFormat(u []byte) string {
+	s := hex.EncodeToString(u)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", s[:8], s[8:12], s[12:16], s[16:20], s[20:])
+}
+
+// uuidParse accepts a 16 byte blob or 32 hexadecimal digits, optionally
+// enclosed in braces and with a dash after any pair of digits.
+func uuidParse(v driver.Value) ([]byte, bool) {
+	switch x := v.(type) {
+	case []byte:
+		if len(x) == 16 {
+			return x, true
+		}
+	case string:
+		if len(x) > 1 && x[0] == '{' && x[len(x)-1] == '}' {
+			x = x[1 : len(x)-1]
+		}
+		var digits []byte
+		for i := 0; i < len(x); i++ {
+			if x[i] == '-' && len(digits)%2 == 0 && len(digits) != 0 {
+				continue
+			}
+
+			digits = append(digits, x[i])
+		}
+		if len(digits) != 32 {
+			return nil, false
+		}
+
+		u, err := hex.DecodeString(string(digits))
+		return u, err == nil
+	}
+	return nil, false
+}
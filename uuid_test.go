@@ -0,0 +1,55 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestUUID(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	var a, b string
+	if err := db.QueryRow("select uuid(), uuid()").Scan(&a, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	if !re.MatchString(a) || !re.MatchString(b) || a == b {
+		t.Fatalf("got %q and %q, want distinct version 4 UUIDs", a, b)
+	}
+
+	const u = "3b4e2bf9-9d17-4a0e-8c2f-0a6b7be3c5a1"
+	for _, v := range []struct {
+		sql  string
+		want interface{}
+	}{
+		{"select uuid_str('" + u + "')", u},
+		{"select uuid_str('{3B4E2BF99D174A0E8C2F0A6B7BE3C5A1}')", u},
+		{"select uuid_str('3b-4e-2bf99d174a0e8c2f0a6b7be3c5a1')", u},
+		{"select uuid_str(x'3b4e2bf99d174a0e8c2f0a6b7be3c5a1')", u},
+		{"select hex(uuid_blob('" + u + "'))", "3B4E2BF99D174A0E8C2F0A6B7BE3C5A1"},
+		{"select uuid_str(uuid_blob('" + u + "'))", u},
+		{"select uuid_str('-3b4e2bf99d174a0e8c2f0a6b7be3c5a1')", nil},
+		{"select uuid_str('3b4e2bf99d174a0e8c2f0a6b7be3c5a')", nil},
+		{"select uuid_str('3b4e2bf99d174a0e8c2f0a6b7be3c5ag')", nil},
+		{"select uuid_blob(x'00')", nil},
+		{"select uuid_blob(42)", nil},
+		{"select uuid_str(null)", nil},
+	} {
+		var g interface{}
+		if err := db.QueryRow(v.sql).Scan(&g); err != nil {
+			t.Errorf("%s: %v", v.sql, err)
+			continue
+		}
+
+		if g != v.want {
+			t.Errorf("%s: got %v, want %v", v.sql, g, v.want)
+		}
+	}
+}
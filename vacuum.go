@@ -0,0 +1,260 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// VacuumInto writes a compacted copy of the main database to the new file
+// path, see https://www.sqlite.org/lang_vacuum.html#vacuum_with_an_into_clause.
+// The copy is a consistent point-in-time snapshot, taken in a read
+// transaction, so other connections can keep writing meanwhile. It fails if
+// path names an existing non-empty file. Unlike a copy made by the backup API
+// the result is defragmented and contains no free pages.
+//
+// VacuumInto can be reached using (*sql.Conn).Raw.
+func (c *conn) VacuumInto(path string) error {
+	_, err := c.exec(context.Background(), "vacuum into ?", []driver.NamedValue{{Ordinal: 1, Value: path}})
+	return err
+}
+
+// AutoVacuumMode is the auto vacuum mode of a database, see
+// https://www.sqlite.org/pragma.html#pragma_auto_vacuum.
+type AutoVacuumMode int
+
+// Values of AutoVacuumMode.
+const (
+	// AutoVacuumNone keeps the pages freed by deletions in the freelist
+	// for reuse, the file does not shrink until VACUUM.
+	AutoVacuumNone AutoVacuumMode = iota
+	// AutoVacuumFull moves the free pages to the end of the file and
+	// truncates it at every commit.
+	AutoVacuumFull
+	// AutoVacuumIncremental keeps the free pages until they are removed by
+	// IncrementalVacuum.
+	AutoVacuumIncremental
+)
+
+// String implements fmt.Stringer.
+func (m AutoVacuumMode) String() string {
+	switch m {
+	case AutoVacuumNone:
+		return "none"
+	case AutoVacuumFull:
+		return "full"
+	case AutoVacuumIncremental:
+		return "incremental"
+	default:
+		return fmt.Sprintf("AutoVacuumMode(%d)", int(m))
+	}
+}
+
+// AutoVacuum returns the auto vacuum mode of the main database.
+//
+// AutoVacuum can be reached using (*sql.Conn).Raw.
+func (c *conn) AutoVacuum() (AutoVacuumMode, error) {
+	n, err := c.pragmaInt64("auto_vacuum")
+	return AutoVacuumMode(n), err
+}
+
+// SetAutoVacuum changes the auto vacuum mode of the main database. A
+// database can only be switched between AutoVacuumNone and the other modes
+// before its first table is created, later SetAutoVacuum rebuilds the
+// database by VACUUM to apply the change. VACUUM needs as much free disk
+// space as the database uses and it fails if the connection is in a
+// transaction.
+//
+// SetAutoVacuum can be reached using (*sql.Conn).Raw.
+func (c *conn) SetAutoVacuum(mode AutoVacuumMode) error {
+	if mode < AutoVacuumNone || mode > AutoVacuumIncremental {
+		return fmt.Errorf("sqlite: SetAutoVacuum: invalid mode %v", mode)
+	}
+
+	if _, err := c.Pragma("auto_vacuum", int(mode)); err != nil {
+		return err
+	}
+
+	if m, err := c.AutoVacuum(); err != nil || m == mode {
+		return err
+	}
+
+	_, err := c.exec(context.Background(), "vacuum", nil)
+	return err
+}
+
+// FreePages returns the number of unused pages of the main database, see
+// https://www.sqlite.org/pragma.html#pragma_freelist_count.
+//
+// FreePages can be reached using (*sql.Conn).Raw.
+func (c *conn) FreePages() (int64, error) {
+	return c.pragmaInt64("freelist_count")
+}
+
+// IncrementalVacuum removes up to n free pages from the main database,
+// truncating its file, and returns the number of pages removed. If n <= 0,
+// all free pages are removed. IncrementalVacuum does nothing unless the auto
+// vacuum mode of the database is AutoVacuumIncremental. It takes the write
+// lock of the database, so removing a small number of pages at a time keeps
+// the writers of other connections from waiting long.
+//
+// IncrementalVacuum can be reached using (*sql.Conn).Raw.
+func (c *conn) IncrementalVacuum(ctx context.Context, n int) (int64, error) {
+	before, err := c.FreePages()
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 0 {
+		n = 0
+	}
+	// The pragma produces a row per page removed.
+	r, err := c.internalQuery(ctx, fmt.Sprintf("pragma incremental_vacuum(%d)", n), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	for err == nil {
+		err = r.Next(nil)
+	}
+	r.Close()
+	if err != io.EOF {
+		return 0, err
+	}
+
+	after, err := c.FreePages()
+	return before - after, err
+}
+
+// IncrementalVacuumer reclaims the free pages of a database in the background,
+// see StartIncrementalVacuum.
+type IncrementalVacuumer struct {
+	db       *sql.DB
+	interval time.Duration
+	pages    int
+
+	mu        sync.Mutex
+	reclaimed int64
+	err       error
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// StartIncrementalVacuum starts a goroutine removing up to pages free pages
+// from the main database of db every interval, using IncrementalVacuum,
+// while none of the connections of db is in use. The auto vacuum mode of the
+// database must be AutoVacuumIncremental, see SetAutoVacuum. Use a pages
+// value small enough for IncrementalVacuum to not delay other writers
+// noticeably, like a few hundred. A vacuum failing, for example with
+// SQLITE_BUSY because another process writes to the database, is retried at
+// the next interval, see Err.
+//
+// Call Close to stop the goroutine.
+func StartIncrementalVacuum(db *sql.DB, interval time.Duration, pages int) *IncrementalVacuumer {
+	v := &IncrementalVacuumer{
+		db:       db,
+		interval: interval,
+		pages:    pages,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go v.run()
+	return v
+}
+
+// Reclaimed returns the number of pages removed so far.
+func (v *IncrementalVacuumer) Reclaimed() int64 {
+	v.mu.Lock()
+
+	defer v.mu.Unlock()
+
+	return v.reclaimed
+}
+
+// Err returns the error of the last vacuum, nil if it succeeded.
+func (v *IncrementalVacuumer) Err() error {
+	v.mu.Lock()
+
+	defer v.mu.Unlock()
+
+	return v.err
+}
+
+// Close stops the goroutine of v and waits for a vacuum in progress to end.
+func (v *IncrementalVacuumer) Close() error {
+	v.closeOnce.Do(func() { close(v.done) })
+	<-v.stopped
+	return nil
+}
+
+func (v *IncrementalVacuumer) run() {
+	defer close(v.stopped)
+
+	t := time.NewTicker(v.interval)
+
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-v.done:
+			return
+		}
+
+		if v.db.Stats().InUse != 0 {
+			continue
+		}
+
+		n, err := v.vacuum()
+		v.mu.Lock()
+		v.reclaimed += n
+		v.err = err
+		v.mu.Unlock()
+	}
+}
+
+func (v *IncrementalVacuumer) vacuum() (n int64, err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	go func() {
+		select {
+		case <-v.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	sc, err := v.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer sc.Close()
+
+	err = sc.Raw(func(dc interface{}) error {
+		c, ok := dc.(*conn)
+		if !ok {
+			return fmt.Errorf("sqlite: IncrementalVacuum: unexpected driver connection %T", dc)
+		}
+
+		if free, err := c.FreePages(); err != nil || free == 0 {
+			return err
+		}
+
+		n, err = c.IncrementalVacuum(ctx, v.pages)
+		return err
+	})
+	return n, err
+}
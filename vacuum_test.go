@@ -0,0 +1,184 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncrementalVacuum(t *testing.T) {
+	db, err := sql.Open(driverName, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec(`
+create table t(i integer primary key, b blob);
+insert into t(b) with recursive s(i) as (select 1 union all select i + 1 from s where i < 500) select randomblob(1000) from s;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	sc, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := func(f func(c *conn) error) {
+		t.Helper()
+		if err := sc.Raw(func(dc interface{}) error { return f(dc.(*conn)) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mode AutoVacuumMode
+	raw(func(c *conn) (err error) {
+		if err = c.SetAutoVacuum(AutoVacuumIncremental); err != nil {
+			return err
+		}
+
+		mode, err = c.AutoVacuum()
+		return err
+	})
+	if mode != AutoVacuumIncremental {
+		t.Fatalf("auto vacuum mode %v, want %v", mode, AutoVacuumIncremental)
+	}
+
+	if _, err := sc.ExecContext(ctx, "delete from t"); err != nil {
+		t.Fatal(err)
+	}
+
+	var free, n int64
+	raw(func(c *conn) (err error) {
+		if free, err = c.FreePages(); err != nil {
+			return err
+		}
+
+		n, err = c.IncrementalVacuum(ctx, 10)
+		return err
+	})
+	if free < 100 || n != 10 {
+		t.Fatalf("%d free pages, %d removed, want at least 100 and 10", free, n)
+	}
+
+	sc.Close()
+	v := StartIncrementalVacuum(db, time.Millisecond, 50)
+
+	defer v.Close()
+
+	for deadline := time.Now().Add(10 * time.Second); v.Reclaimed() != free-10; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d pages reclaimed, want %d, last error %v", v.Reclaimed(), free-10, v.Err())
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	v.Close()
+	var pages int64
+	if err := db.QueryRow("select freelist_count from pragma_freelist_count").Scan(&pages); err != nil || pages != 0 {
+		t.Errorf("%d free pages, %v", pages, err)
+	}
+}
+
+// TestVacuumInto checks VacuumInto writes a compacted copy of the database
+// and refuses to overwrite an existing file.
+func TestVacuumInto(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open(driverName, filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`
+create table t(i integer primary key, b blob);
+insert into t(b) with recursive s(i) as (select 1 union all select i + 1 from s where i < 500) select randomblob(1000) from s;
+delete from t where i > 250;
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	sc, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer sc.Close()
+
+	vacuumInto := func(path string) error {
+		return sc.Raw(func(dc interface{}) error { return dc.(*conn).VacuumInto(path) })
+	}
+
+	// An existing empty file may be the target.
+	dst := filepath.Join(dir, "copy.db")
+	if err := os.WriteFile(dst, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vacuumInto(dst); err != nil {
+		t.Fatal(err)
+	}
+
+	const q = "select count(*), sum(i), sha1(group_concat(i || hex(b))) from t"
+	var srcN, srcSum, dstN, dstSum int64
+	var srcHash, dstHash string
+	if err := sc.QueryRowContext(ctx, q).Scan(&srcN, &srcSum, &srcHash); err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err := sql.Open(driverName, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer cp.Close()
+
+	if err := cp.QueryRow(q).Scan(&dstN, &dstSum, &dstHash); err != nil {
+		t.Fatal(err)
+	}
+
+	if srcN != 250 || dstN != srcN || dstSum != srcSum || dstHash != srcHash {
+		t.Errorf("copy %v %v %v, want %v %v %v", dstN, dstSum, dstHash, srcN, srcSum, srcHash)
+	}
+
+	var srcFree, dstFree int64
+	if err := sc.QueryRowContext(ctx, "pragma freelist_count").Scan(&srcFree); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cp.QueryRow("pragma freelist_count").Scan(&dstFree); err != nil {
+		t.Fatal(err)
+	}
+
+	if srcFree == 0 || dstFree != 0 {
+		t.Errorf("free pages %v -> %v, want some -> 0", srcFree, dstFree)
+	}
+
+	fi, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vacuumInto(dst); err == nil || !strings.Contains(err.Error(), "output file already exists") {
+		t.Errorf("got %v, want output file already exists", err)
+	}
+
+	if fi2, err := os.Stat(dst); err != nil || fi2.Size() != fi.Size() || !fi2.ModTime().Equal(fi.ModTime()) {
+		t.Errorf("existing target modified: %v", err)
+	}
+}
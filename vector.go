@@ -0,0 +1,651 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// The vec virtual table stores float32 vectors, for example embeddings, and
+// answers k-nearest-neighbor queries by an exhaustive scan:
+//
+//	create virtual table docs_vec using vec(dims=384, distance=cosine);
+//	insert into docs_vec(rowid, vector) values(?, ?);
+//	select rowid, distance from docs_vec where vector match ? and k = 10;
+//
+// The vectors are kept in the shadow table <name>_data.
+
+func init() {
+	registerModule("vec", &goModule{
+		create:     vecCreate,
+		connect:    vecConnect,
+		bestIndex:  vecBestIndex,
+		disconnect: vecDisconnect,
+		destroy:    vecDestroy,
+		open:       vecOpen,
+		close:      vecClose,
+		filter:     vecFilter,
+		next:       vecNext,
+		eof:        vecEOF,
+		column:     vecColumn,
+		rowid:      vecRowid,
+		update:     vecUpdate,
+		rename:     vecRename,
+	})
+	MustRegisterDeterministicScalarFunction("vec_f32", 1, vecF32)
+	MustRegisterDeterministicScalarFunction("vec_to_json", 1, vecToJSON)
+	MustRegisterDeterministicScalarFunction("vec_distance_l2", 2, vecDistanceFunc(vecL2))
+	MustRegisterDeterministicScalarFunction("vec_distance_cosine", 2, vecDistanceFunc(vecCosine))
+}
+
+// Vector is a vector of float32 values. Its Value is a blob of the values in
+// little endian IEEE 754 format, the format of the vectors of the vec virtual
+// table and the vec_* SQL functions. Scan accepts such a blob or text holding
+// a JSON array of numbers.
+type Vector []float32
+
+// Value implements driver.Valuer.
+func (v Vector) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b, nil
+}
+
+// Scan implements sql.Scanner.
+func (v *Vector) Scan(src interface{}) (err error) {
+	switch x := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		*v, err = parseVector(x, false)
+	case string:
+		*v, err = parseVector([]byte(x), true)
+	default:
+		err = fmt.Errorf("sqlite: cannot scan %T into Vector", src)
+	}
+	return err
+}
+
+// parseVector decodes b, a blob of little endian float32 values or, if text
+// is true, a JSON array of numbers.
+func parseVector(b []byte, text bool) (Vector, error) {
+	if text {
+		var v Vector
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("invalid vector JSON: %v", err)
+		}
+
+		if v == nil {
+			return nil, fmt.Errorf("invalid vector JSON: %s", b)
+		}
+
+		return v, nil
+	}
+
+	if len(b)%4 != 0 {
+		return nil, fmt.Errorf("invalid vector blob of %d bytes", len(b))
+	}
+
+	v := make(Vector, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v, nil
+}
+
+// vecArg returns the vector of a function argument, or nil if it is NULL.
+func vecArg(v driver.Value) (Vector, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return parseVector(x, false)
+	case string:
+		return parseVector([]byte(x), true)
+	default:
+		return nil, fmt.Errorf("invalid vector %v", v)
+	}
+}
+
+// vec_f32(X) returns the vector X, a blob or JSON text, as a blob.
+func vecF32(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	v, err := vecArg(args[0])
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	return v.Value()
+}
+
+// vec_to_json(X) returns the vector X, a blob or JSON text, as JSON text.
+func vecToJSON(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	v, err := vecArg(args[0])
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range v {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String(), nil
+}
+
+// vecDistanceFunc returns the SQL function computing the distance d of two
+// vectors.
+func vecDistanceFunc(d func(a, b Vector) float64) func(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+	return func(ctx *FunctionContext, args []driver.Value) (driver.Value, error) {
+		a, err := vecArg(args[0])
+		if err != nil || a == nil {
+			return nil, err
+		}
+
+		b, err := vecArg(args[1])
+		if err != nil || b == nil {
+			return nil, err
+		}
+
+		if len(a) != len(b) {
+			return nil, fmt.Errorf("vector dimensions differ: %d and %d", len(a), len(b))
+		}
+
+		return d(a, b), nil
+	}
+}
+
+// vecL2 returns the Euclidean distance of a and b, which have the same length.
+func vecL2(a, b Vector) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// vecCosine returns the cosine distance, 1 minus the cosine similarity, of a
+// and b, which have the same length. The distance to a zero vector is 1.
+func vecCosine(a, b Vector) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 1
+	}
+
+	return 1 - dot/math.Sqrt(na*nb)
+}
+
+// Columns of the vec table.
+const (
+	vecColVector = iota
+	vecColDistance
+	vecColK
+)
+
+// Bits of idxNum, the constraints passed to xFilter in this order.
+const (
+	vecIdxMatch = 1 << iota
+	vecIdxK
+	vecIdxLimit
+	vecIdxRowid
+)
+
+type vecTable struct {
+	db       uintptr
+	schema   string
+	name     string
+	dims     int
+	distance func(a, b Vector) float64
+}
+
+// data returns the qualified name of the shadow table.
+func (t *vecTable) data() string {
+	return quoteIdentifier(t.schema) + "." + quoteIdentifier(t.name+"_data")
+}
+
+type vecRow struct {
+	id       int64
+	vector   []byte
+	distance float64
+}
+
+type vecCursor struct {
+	rows  []vecRow
+	match bool // distance is valid.
+}
+
+var (
+	vecMu      sync.Mutex
+	vecTables  = map[uintptr]*vecTable{}
+	vecCursors = map[uintptr]*vecCursor{}
+)
+
+func vecTableOf(pVtab uintptr) *vecTable {
+	vecMu.Lock()
+
+	defer vecMu.Unlock()
+
+	return vecTables[pVtab]
+}
+
+func vecCursorOf(pCursor uintptr) *vecCursor {
+	vecMu.Lock()
+
+	defer vecMu.Unlock()
+
+	return vecCursors[pCursor]
+}
+
+func vecCreate(tls *libc.TLS, db, pAux uintptr, argc int32, argv, ppVtab, pzErr uintptr) int32 {
+	return vecInit(tls, db, argc, argv, ppVtab, pzErr, true)
+}
+
+func vecConnect(tls *libc.TLS, db, pAux uintptr, argc int32, argv, ppVtab, pzErr uintptr) int32 {
+	return vecInit(tls, db, argc, argv, ppVtab, pzErr, false)
+}
+
+func vecInit(tls *libc.TLS, db uintptr, argc int32, argv, ppVtab, pzErr uintptr, create bool) int32 {
+	arg := func(i int32) string {
+		return libc.GoString(*(*uintptr)(unsafe.Pointer(argv + uintptr(i)*ptrSize)))
+	}
+	fail := func(msg string) int32 {
+		*(*uintptr)(unsafe.Pointer(pzErr)) = mallocString(tls, msg)
+		return sqlite3.SQLITE_ERROR
+	}
+
+	t := &vecTable{db: db, schema: arg(1), name: arg(2), distance: vecL2}
+	for i := int32(3); i < argc; i++ {
+		a := arg(i)
+		k, v := a, ""
+		if j := strings.IndexByte(a, '='); j >= 0 {
+			k, v = a[:j], a[j+1:]
+		}
+		switch strings.ToLower(strings.TrimSpace(k)) {
+		case "dims":
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n <= 0 {
+				return fail(fmt.Sprintf("vec: invalid dims: %s", v))
+			}
+
+			t.dims = n
+		case "distance":
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "l2":
+				t.distance = vecL2
+			case "cosine":
+				t.distance = vecCosine
+			default:
+				return fail(fmt.Sprintf("vec: unknown distance: %s", v))
+			}
+		default:
+			return fail(fmt.Sprintf("vec: unsupported argument: %s", a))
+		}
+	}
+	if t.dims == 0 {
+		return fail("vec: missing dims argument")
+	}
+
+	if rc := declareVtab(tls, db, "create table x(vector, distance hidden, k hidden)"); rc != sqlite3.SQLITE_OK {
+		return rc
+	}
+
+	if create {
+		if err := vtabExec(tls, db, fmt.Sprintf("create table if not exists %s(id integer primary key, vector blob not null)", t.data()), nil, nil); err != nil {
+			return fail(err.Error())
+		}
+	}
+
+	p := newVtab(tls)
+	if p == 0 {
+		return sqlite3.SQLITE_NOMEM
+	}
+
+	vecMu.Lock()
+	vecTables[p] = t
+	vecMu.Unlock()
+	*(*uintptr)(unsafe.Pointer(ppVtab)) = p
+	return sqlite3.SQLITE_OK
+}
+
+func vecDisconnect(tls *libc.TLS, pVtab uintptr) int32 {
+	vecMu.Lock()
+	delete(vecTables, pVtab)
+	vecMu.Unlock()
+	sqlite3.Xsqlite3_free(tls, pVtab)
+	return sqlite3.SQLITE_OK
+}
+
+func vecDestroy(tls *libc.TLS, pVtab uintptr) int32 {
+	t := vecTableOf(pVtab)
+	if err := vtabExec(tls, t.db, "drop table if exists "+t.data(), nil, nil); err != nil {
+		return vtabError(tls, pVtab, err.Error())
+	}
+
+	return vecDisconnect(tls, pVtab)
+}
+
+func vecRename(tls *libc.TLS, pVtab, zNew uintptr) int32 {
+	t := vecTableOf(pVtab)
+	name := libc.GoString(zNew)
+	if err := vtabExec(tls, t.db, fmt.Sprintf("alter table %s rename to %s", t.data(), quoteIdentifier(name+"_data")), nil, nil); err != nil {
+		return vtabError(tls, pVtab, err.Error())
+	}
+
+	t.name = name
+	return sqlite3.SQLITE_OK
+}
+
+// indexOrderBy is struct sqlite3_index_orderby.
+type indexOrderBy struct {
+	iColumn int32
+	desc    uint8
+	_       [3]byte
+}
+
+func vecBestIndex(tls *libc.TLS, pVtab, pInfo uintptr) int32 {
+	info := (*sqlite3.Sqlite3_index_info)(unsafe.Pointer(pInfo))
+	var plan int32
+	var use [4]int32 // Constraint index per idxNum bit.
+	offset := false
+	for i := int32(0); i < info.FnConstraint; i++ {
+		if c := constraint(info, i); c.usable != 0 && c.op == sqliteIndexConstraintOffset {
+			offset = true
+		}
+	}
+	for i := int32(0); i < info.FnConstraint; i++ {
+		c := constraint(info, i)
+		if c.usable == 0 {
+			continue
+		}
+
+		var bit int32
+		switch {
+		case c.iColumn == vecColVector && c.op == sqlite3.SQLITE_INDEX_CONSTRAINT_MATCH:
+			bit = vecIdxMatch
+		case c.iColumn == vecColK && c.op == sqlite3.SQLITE_INDEX_CONSTRAINT_EQ:
+			bit = vecIdxK
+		case c.op == sqliteIndexConstraintLimit && !offset:
+			bit = vecIdxLimit
+		case c.iColumn < 0 && c.op == sqlite3.SQLITE_INDEX_CONSTRAINT_EQ:
+			bit = vecIdxRowid
+		default:
+			continue
+		}
+		if plan&bit != 0 {
+			continue
+		}
+
+		plan |= bit
+		for j := range use {
+			if bit == 1<<j {
+				use[j] = i
+			}
+		}
+	}
+
+	argv := int32(0)
+	for j := range use {
+		if plan&(1<<j) != 0 {
+			argv++
+			u := constraintUsage(info, use[j])
+			u.argvIndex = argv
+			// SQLite applies the LIMIT itself as well.
+			u.omit = uint8(libc.Bool32(1<<j != vecIdxLimit))
+		}
+	}
+	info.FidxNum = plan
+	switch {
+	case plan&vecIdxRowid != 0:
+		info.FestimatedCost = 5
+		info.FestimatedRows = 1
+	case plan&vecIdxMatch != 0:
+		// The rows of a kNN query are ordered by distance.
+		if info.FnOrderBy == 1 {
+			if ob := (*indexOrderBy)(unsafe.Pointer(info.FaOrderBy)); ob.iColumn == vecColDistance && ob.desc == 0 {
+				info.ForderByConsumed = 1
+			}
+		}
+		info.FestimatedCost = 1e6
+	default:
+		info.FestimatedCost = 1e7
+	}
+	return sqlite3.SQLITE_OK
+}
+
+func vecOpen(tls *libc.TLS, pVtab, ppCursor uintptr) int32 {
+	p := newVtabCursor(tls)
+	if p == 0 {
+		return sqlite3.SQLITE_NOMEM
+	}
+
+	vecMu.Lock()
+	vecCursors[p] = &vecCursor{}
+	vecMu.Unlock()
+	*(*uintptr)(unsafe.Pointer(ppCursor)) = p
+	return sqlite3.SQLITE_OK
+}
+
+func vecClose(tls *libc.TLS, pCursor uintptr) int32 {
+	vecMu.Lock()
+	delete(vecCursors, pCursor)
+	vecMu.Unlock()
+	sqlite3.Xsqlite3_free(tls, pCursor)
+	return sqlite3.SQLITE_OK
+}
+
+// vecValue returns the vector of the sqlite3_value at index i of argv, a blob
+// or JSON text, checking it has the dimensions of t.
+func (t *vecTable) vecValue(tls *libc.TLS, argv uintptr, i int32) (Vector, error) {
+	p := valueAt(argv, i)
+	var v Vector
+	var err error
+	switch sqlite3.Xsqlite3_value_type(tls, p) {
+	case sqlite3.SQLITE_BLOB:
+		n := sqlite3.Xsqlite3_value_bytes(tls, p)
+		var b []byte
+		if n != 0 {
+			b = (*libc.RawMem)(unsafe.Pointer(sqlite3.Xsqlite3_value_blob(tls, p)))[:n:n]
+		}
+		v, err = parseVector(b, false)
+	case sqlite3.SQLITE_TEXT:
+		v, err = parseVector([]byte(valueString(tls, argv, i)), true)
+	default:
+		err = fmt.Errorf("vector must be a blob or JSON text")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", t.name, err)
+	}
+
+	if len(v) != t.dims {
+		return nil, fmt.Errorf("%s: vector has %d dimensions, want %d", t.name, len(v), t.dims)
+	}
+
+	return v, nil
+}
+
+func vecFilter(tls *libc.TLS, pCursor uintptr, idxNum int32, idxStr uintptr, argc int32, argv uintptr) int32 {
+	cur := vecCursorOf(pCursor)
+	t := vecTableOf(cursorVtab(pCursor))
+	*cur = vecCursor{match: idxNum&vecIdxMatch != 0}
+	var query Vector
+	k := int64(-1)
+	var rowid int64
+	iArg := int32(0)
+	for bit := int32(1); bit <= vecIdxRowid; bit <<= 1 {
+		if idxNum&bit == 0 {
+			continue
+		}
+
+		v := valueAt(argv, iArg)
+		switch bit {
+		case vecIdxMatch:
+			var err error
+			if query, err = t.vecValue(tls, argv, iArg); err != nil {
+				return vtabError(tls, cursorVtab(pCursor), err.Error())
+			}
+		case vecIdxK, vecIdxLimit:
+			if n := sqlite3.Xsqlite3_value_int64(tls, v); n >= 0 && (k < 0 || n < k) {
+				k = n
+			}
+		case vecIdxRowid:
+			rowid = sqlite3.Xsqlite3_value_int64(tls, v)
+		}
+		iArg++
+	}
+
+	q := fmt.Sprintf("select id, vector from %s", t.data())
+	var args []interface{}
+	if idxNum&vecIdxRowid != 0 {
+		q += " where id = ?"
+		args = append(args, rowid)
+	}
+	var scanErr error
+	if err := vtabExec(tls, t.db, q, args, func(pstmt uintptr) {
+		r := vecRow{id: sqlite3.Xsqlite3_column_int64(tls, pstmt, 0)}
+		if n := sqlite3.Xsqlite3_column_bytes(tls, pstmt, 1); n != 0 {
+			r.vector = append([]byte(nil), (*libc.RawMem)(unsafe.Pointer(sqlite3.Xsqlite3_column_blob(tls, pstmt, 1)))[:n:n]...)
+		}
+		if cur.match {
+			v, err := parseVector(r.vector, false)
+			if err == nil && len(v) != t.dims {
+				err = fmt.Errorf("row %d: vector has %d dimensions, want %d", r.id, len(v), t.dims)
+			}
+			if err != nil {
+				if scanErr == nil {
+					scanErr = fmt.Errorf("%s: %v", t.name, err)
+				}
+				return
+			}
+
+			r.distance = t.distance(query, v)
+		}
+		cur.rows = append(cur.rows, r)
+	}); err != nil {
+		return vtabError(tls, cursorVtab(pCursor), err.Error())
+	}
+
+	if scanErr != nil {
+		return vtabError(tls, cursorVtab(pCursor), scanErr.Error())
+	}
+
+	if cur.match {
+		sort.SliceStable(cur.rows, func(i, j int) bool { return cur.rows[i].distance < cur.rows[j].distance })
+	}
+	if k >= 0 && int64(len(cur.rows)) > k {
+		cur.rows = cur.rows[:k]
+	}
+	return sqlite3.SQLITE_OK
+}
+
+func vecNext(tls *libc.TLS, pCursor uintptr) int32 {
+	cur := vecCursorOf(pCursor)
+	cur.rows = cur.rows[1:]
+	return sqlite3.SQLITE_OK
+}
+
+func vecEOF(tls *libc.TLS, pCursor uintptr) int32 {
+	if len(vecCursorOf(pCursor).rows) == 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func vecColumn(tls *libc.TLS, pCursor, ctx uintptr, i int32) int32 {
+	cur := vecCursorOf(pCursor)
+	r := &cur.rows[0]
+	switch {
+	case i == vecColVector:
+		resultBlob(tls, ctx, r.vector)
+	case i == vecColDistance && cur.match:
+		sqlite3.Xsqlite3_result_double(tls, ctx, r.distance)
+	default:
+		sqlite3.Xsqlite3_result_null(tls, ctx)
+	}
+	return sqlite3.SQLITE_OK
+}
+
+func vecRowid(tls *libc.TLS, pCursor, pRowid uintptr) int32 {
+	*(*int64)(unsafe.Pointer(pRowid)) = vecCursorOf(pCursor).rows[0].id
+	return sqlite3.SQLITE_OK
+}
+
+func vecUpdate(tls *libc.TLS, pVtab uintptr, argc int32, argv, pRowid uintptr) int32 {
+	t := vecTableOf(pVtab)
+	if argc == 1 {
+		id := sqlite3.Xsqlite3_value_int64(tls, valueAt(argv, 0))
+		if err := vtabExec(tls, t.db, fmt.Sprintf("delete from %s where id = ?", t.data()), []interface{}{id}, nil); err != nil {
+			return vtabError(tls, pVtab, err.Error())
+		}
+
+		return sqlite3.SQLITE_OK
+	}
+
+	isNull := func(i int32) bool {
+		return sqlite3.Xsqlite3_value_type(tls, valueAt(argv, i)) == sqlite3.SQLITE_NULL
+	}
+	col := func(c int32) int32 { return c + 2 }
+	if isNull(col(vecColVector)) {
+		return vtabError(tls, pVtab, fmt.Sprintf("NOT NULL constraint failed: %s.vector", t.name))
+	}
+
+	v, err := t.vecValue(tls, argv, col(vecColVector))
+	if err != nil {
+		return vtabError(tls, pVtab, err.Error())
+	}
+
+	b, _ := v.Value()
+	var newID interface{}
+	if !isNull(1) {
+		newID = sqlite3.Xsqlite3_value_int64(tls, valueAt(argv, 1))
+	}
+	// The conflict clauses are the ones of spellfix1.
+	conflict := spellfixConflict[sqlite3.Xsqlite3_vtab_on_conflict(tls, t.db)]
+	args := []interface{}{newID, b}
+	if isNull(0) {
+		if err := vtabExec(tls, t.db, fmt.Sprintf("insert %sinto %s(id, vector) values(?, ?)", conflict, t.data()), args, nil); err != nil {
+			return vtabError(tls, pVtab, err.Error())
+		}
+
+		*(*int64)(unsafe.Pointer(pRowid)) = sqlite3.Xsqlite3_last_insert_rowid(tls, t.db)
+		return sqlite3.SQLITE_OK
+	}
+
+	args = append(args, sqlite3.Xsqlite3_value_int64(tls, valueAt(argv, 0)))
+	if err := vtabExec(tls, t.db, fmt.Sprintf("update %s%s set id = ?, vector = ? where id = ?", conflict, t.data()), args, nil); err != nil {
+		return vtabError(tls, pVtab, err.Error())
+	}
+
+	return sqlite3.SQLITE_OK
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestVec(t *testing.T) {
+	db, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("create virtual table v using vec(dims=2, distance=cosine); create virtual table l using vec(dims=2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 8; i++ {
+		a := float64(i) * math.Pi / 8
+		vec := Vector{float32(math.Cos(a)), float32(math.Sin(a))}
+		if _, err := db.Exec("insert into v(rowid, vector) values(?, ?)", i+1, vec); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec("insert into l(rowid, vector) values(?, ?)", i+1, fmt.Sprintf("[%d, 0]", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	knn := func(q string, args ...interface{}) (ids []int64, dist []float64) {
+		t.Helper()
+		rows, err := db.Query(q, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			var d float64
+			if err := rows.Scan(&id, &d); err != nil {
+				t.Fatal(err)
+			}
+
+			ids = append(ids, id)
+			dist = append(dist, d)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		return ids, dist
+	}
+
+	ids, dist := knn("select rowid, distance from v where vector match ? and k = 3", Vector{0, 1})
+	if fmt.Sprint(ids) != "[5 4 6]" || math.Abs(dist[0]) > 1e-6 || math.Abs(dist[1]-dist[2]) > 1e-6 {
+		t.Fatalf("%v %v", ids, dist)
+	}
+
+	ids, dist = knn("select rowid, distance from l where vector match '[2.5, 0]' order by distance limit 4")
+	if fmt.Sprint(ids) != "[3 4 2 5]" || dist[0] != 0.5 || dist[3] != 1.5 {
+		t.Fatalf("%v %v", ids, dist)
+	}
+
+	ids, _ = knn("select rowid, distance from l where vector match '[2.5, 0]' order by distance limit 2 offset 2")
+	if fmt.Sprint(ids) != "[2 5]" {
+		t.Fatalf("%v", ids)
+	}
+
+	ids, _ = knn("select rowid, vec_distance_l2(vector, '[0, 0]') from l where rowid = 3")
+	if fmt.Sprint(ids) != "[3]" {
+		t.Fatalf("%v", ids)
+	}
+
+	var v Vector
+	var js string
+	if err := db.QueryRow("select vector, vec_to_json(vector) from l where rowid = 8").Scan(&v, &js); err != nil || fmt.Sprint(v) != "[7 0]" || js != "[7,0]" {
+		t.Fatalf("%v %q %v", v, js, err)
+	}
+
+	if _, err := db.Exec("update l set vector = vec_f32('[1, 1]') where rowid = 8"); err != nil {
+		t.Fatal(err)
+	}
+
+	var d float64
+	if err := db.QueryRow("select vec_distance_cosine(vector, '[2, 2]') from l where rowid = 8").Scan(&d); err != nil || math.Abs(d) > 1e-6 {
+		t.Fatal(d, err)
+	}
+
+	if _, err := db.Exec("insert into l(vector) values('[1, 2, 3]')"); err == nil {
+		t.Fatal("unexpected success inserting a vector of the wrong dimension")
+	}
+
+	if _, err := db.Exec("delete from l where rowid > 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := db.QueryRow("select count(*) from l_data").Scan(&n); err != nil || n != 2 {
+		t.Fatal(n, err)
+	}
+
+	if _, err := db.Exec("drop table l"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.QueryRow("select count(*) from sqlite_master where name = 'l_data'").Scan(&n); err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Version returns the version of the SQLite library, like "3.40.0", see
+// https://www.sqlite.org/c3ref/libversion.html.
+func Version() string {
+	tls := libc.NewTLS()
+
+	defer tls.Close()
+
+	return libc.GoString(sqlite3.Xsqlite3_libversion(tls))
+}
+
+// VersionNumber returns the version of the SQLite library as an integer
+// X*1000000 + Y*1000 + Z for version X.Y.Z, like 3040000.
+func VersionNumber() int {
+	tls := libc.NewTLS()
+
+	defer tls.Close()
+
+	return int(sqlite3.Xsqlite3_libversion_number(tls))
+}
+
+// CompileOptions returns the options the SQLite library was generated with,
+// without the SQLITE_ prefix, like "ENABLE_FTS5" or "MAX_ATTACHED=10", see
+// https://www.sqlite.org/c3ref/compileoption_get.html. They are the rows of
+// "pragma compile_options".
+func CompileOptions() (r []string) {
+	tls := libc.NewTLS()
+
+	defer tls.Close()
+
+	for i := int32(0); ; i++ {
+		p := sqlite3.Xsqlite3_compileoption_get(tls, i)
+		if p == 0 {
+			return r
+		}
+
+		r = append(r, libc.GoString(p))
+	}
+}
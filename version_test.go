@@ -0,0 +1,62 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	db := openMemory(t)
+
+	defer db.Close()
+
+	var version string
+	if err := db.QueryRow("select sqlite_version()").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := Version(); g != version {
+		t.Errorf("Version %q, want %q", g, version)
+	}
+
+	n := VersionNumber()
+	if g := fmt.Sprintf("%d.%d.%d", n/1000000, n/1000%1000, n%1000); g != version {
+		t.Errorf("VersionNumber %d is %s, want %s", n, g, version)
+	}
+
+	rows, err := db.Query("pragma compile_options")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var options []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+
+		options = append(options, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := CompileOptions()
+	if !reflect.DeepEqual(got, options) {
+		t.Errorf("CompileOptions %q, want %q", got, options)
+	}
+
+	for _, v := range got {
+		if v == "ENABLE_FTS5" {
+			return
+		}
+	}
+
+	t.Errorf("CompileOptions %q, want ENABLE_FTS5", got)
+}
@@ -0,0 +1,519 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"modernc.org/libc"
+	"modernc.org/libc/sys/types"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// A shim VFS forwards all operations to another, underlying VFS while letting
+// Go code observe and alter the I/O of the files it opens. A shim file is a
+// sqlite3_file immediately followed by the file of the underlying VFS.
+const shimFileHeader = (unsafe.Sizeof(sqlite3.Sqlite3_file{}) + 7) &^ 7
+
+type shimVFS struct {
+	name   string
+	open   func(tls *libc.TLS, f *shimFile) (fileHooks, error)
+	parent uintptr // *sqlite3.Sqlite3_vfs
+	pVfs   uintptr // *sqlite3.Sqlite3_vfs
+}
+
+// shimFile is a file opened by a shim VFS.
+type shimFile struct {
+	flags int32 // Flags passed to xOpen.
+	hooks fileHooks
+	name  string  // Empty for temporary files.
+	real  uintptr // *sqlite3.Sqlite3_file of the underlying VFS.
+	vfs   *shimVFS
+	zName uintptr // As passed to xOpen, see sqlite3_uri_parameter.
+}
+
+var (
+	shimMu    sync.Mutex
+	shimVFSes = map[uintptr]*shimVFS{}  // pVfs: VFS
+	shimFiles = map[uintptr]*shimFile{} // pFile: file
+)
+
+// fileHooks intercepts the operations on a shim file. Implementations forward
+// an operation to the underlying file by calling the same method of
+// passThrough. Return values are SQLite result codes.
+type fileHooks interface {
+	close(tls *libc.TLS, f *shimFile) int32
+	read(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32
+	write(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32
+	truncate(tls *libc.TLS, f *shimFile, size int64) int32
+	sync(tls *libc.TLS, f *shimFile, flags int32) int32
+	fileSize(tls *libc.TLS, f *shimFile, pSize uintptr) int32
+	lock(tls *libc.TLS, f *shimFile, lock int32) int32
+	unlock(tls *libc.TLS, f *shimFile, lock int32) int32
+	checkReservedLock(tls *libc.TLS, f *shimFile, pResOut uintptr) int32
+	fileControl(tls *libc.TLS, f *shimFile, op int32, pArg uintptr) int32
+	deviceCharacteristics(tls *libc.TLS, f *shimFile) int32
+	fetch(tls *libc.TLS, f *shimFile, off int64, n int32, pp uintptr) int32
+	unfetch(tls *libc.TLS, f *shimFile, off int64, p uintptr) int32
+}
+
+// passThrough implements fileHooks by forwarding every operation to the
+// underlying file unchanged.
+type passThrough struct{}
+
+func (passThrough) close(tls *libc.TLS, f *shimFile) int32 {
+	sqlite3.Xsqlite3OsClose(tls, f.real)
+	return sqlite3.SQLITE_OK
+}
+
+func (passThrough) read(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32 {
+	return sqlite3.Xsqlite3OsRead(tls, f.real, p, n, off)
+}
+
+func (passThrough) write(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32 {
+	return sqlite3.Xsqlite3OsWrite(tls, f.real, p, n, off)
+}
+
+func (passThrough) truncate(tls *libc.TLS, f *shimFile, size int64) int32 {
+	return sqlite3.Xsqlite3OsTruncate(tls, f.real, size)
+}
+
+func (passThrough) sync(tls *libc.TLS, f *shimFile, flags int32) int32 {
+	return sqlite3.Xsqlite3OsSync(tls, f.real, flags)
+}
+
+func (passThrough) fileSize(tls *libc.TLS, f *shimFile, pSize uintptr) int32 {
+	return sqlite3.Xsqlite3OsFileSize(tls, f.real, pSize)
+}
+
+func (passThrough) lock(tls *libc.TLS, f *shimFile, lock int32) int32 {
+	return sqlite3.Xsqlite3OsLock(tls, f.real, lock)
+}
+
+func (passThrough) unlock(tls *libc.TLS, f *shimFile, lock int32) int32 {
+	return sqlite3.Xsqlite3OsUnlock(tls, f.real, lock)
+}
+
+func (passThrough) checkReservedLock(tls *libc.TLS, f *shimFile, pResOut uintptr) int32 {
+	return sqlite3.Xsqlite3OsCheckReservedLock(tls, f.real, pResOut)
+}
+
+func (passThrough) fileControl(tls *libc.TLS, f *shimFile, op int32, pArg uintptr) int32 {
+	return sqlite3.Xsqlite3OsFileControl(tls, f.real, op, pArg)
+}
+
+func (passThrough) deviceCharacteristics(tls *libc.TLS, f *shimFile) int32 {
+	return sqlite3.Xsqlite3OsDeviceCharacteristics(tls, f.real)
+}
+
+func (passThrough) fetch(tls *libc.TLS, f *shimFile, off int64, n int32, pp uintptr) int32 {
+	return sqlite3.Xsqlite3OsFetch(tls, f.real, off, n, pp)
+}
+
+func (passThrough) unfetch(tls *libc.TLS, f *shimFile, off int64, p uintptr) int32 {
+	return sqlite3.Xsqlite3OsUnfetch(tls, f.real, off, p)
+}
+
+// memBytes returns the n bytes at p as a slice sharing the memory.
+func memBytes(p uintptr, n int32) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	return (*libc.RawMem)(unsafe.Pointer(p))[:n:n]
+}
+
+// isMainDB reports whether f is a main database file.
+func (f *shimFile) isMainDB() bool { return f.flags&sqlite3.SQLITE_OPEN_MAIN_DB != 0 }
+
+// isWAL reports whether f is a write-ahead log file.
+func (f *shimFile) isWAL() bool { return f.flags&sqlite3.SQLITE_OPEN_WAL != 0 }
+
+// uriParameter returns the value of the URI query parameter key of a main
+// database file and reports whether it was present.
+func (f *shimFile) uriParameter(tls *libc.TLS, key string) (string, bool) {
+	if f.zName == 0 || !f.isMainDB() {
+		return "", false
+	}
+
+	k, err := libc.CString(key)
+	if err != nil {
+		return "", false
+	}
+
+	defer libc.Xfree(tls, k)
+
+	p := sqlite3.Xsqlite3_uri_parameter(tls, f.zName, k)
+	if p == 0 {
+		return "", false
+	}
+
+	return libc.GoString(p), true
+}
+
+// registerShimVFS registers a new VFS named name which forwards to the VFS
+// named parent, or to the default VFS if parent is empty. The open function
+// is called for every file opened by the new VFS and returns the hooks to use
+// for the file. It fails if a VFS named name is already registered, which
+// SQLite would keep finding first.
+func registerShimVFS(name, parent string, open func(tls *libc.TLS, f *shimFile) (fileHooks, error)) (_ *shimVFS, err error) {
+	tls := libc.NewTLS()
+
+	defer tls.Close()
+
+	var zParent uintptr
+	if parent != "" {
+		if zParent, err = libc.CString(parent); err != nil {
+			return nil, err
+		}
+
+		defer libc.Xfree(tls, zParent)
+	}
+
+	pParent := sqlite3.Xsqlite3_vfs_find(tls, zParent)
+	if pParent == 0 {
+		return nil, fmt.Errorf("sqlite: no such VFS: %q", parent)
+	}
+
+	zName, err := libc.CString(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if sqlite3.Xsqlite3_vfs_find(tls, zName) != 0 {
+		libc.Xfree(tls, zName)
+		return nil, fmt.Errorf("sqlite: VFS %q is already registered", name)
+	}
+
+	// The VFS lives as long as the program, its memory is never freed.
+	pVfs := libc.Xcalloc(tls, 1, types.Size_t(unsafe.Sizeof(sqlite3.Sqlite3_vfs{})))
+	if pVfs == 0 {
+		libc.Xfree(tls, zName)
+		return nil, fmt.Errorf("sqlite: cannot allocate memory")
+	}
+
+	pv := (*sqlite3.Sqlite3_vfs)(unsafe.Pointer(pVfs))
+	pp := (*sqlite3.Sqlite3_vfs)(unsafe.Pointer(pParent))
+	*pv = *pp
+	pv.FiVersion = 2
+	pv.FszOsFile = pp.FszOsFile + int32(shimFileHeader)
+	pv.FpNext = 0
+	pv.FzName = zName
+	pv.FpAppData = 0
+	pv.FxOpen = *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr, uintptr, uintptr, int32, uintptr) int32
+	}{shimOpen}))
+	pv.FxDelete = *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr, uintptr, int32) int32
+	}{shimDelete}))
+	pv.FxAccess = *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr, uintptr, int32, uintptr) int32
+	}{shimAccess}))
+	pv.FxFullPathname = *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr, uintptr, int32, uintptr) int32
+	}{shimFullPathname}))
+	pv.FxRandomness = *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr, int32, uintptr) int32
+	}{shimRandomness}))
+	pv.FxSleep = *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr, int32) int32
+	}{shimSleep}))
+	pv.FxGetLastError = *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr, int32, uintptr) int32
+	}{shimGetLastError}))
+	pv.FxCurrentTimeInt64 = *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr, uintptr) int32
+	}{shimCurrentTimeInt64}))
+	pv.FxSetSystemCall = 0
+	pv.FxGetSystemCall = 0
+	pv.FxNextSystemCall = 0
+
+	v := &shimVFS{name: name, open: open, parent: pParent, pVfs: pVfs}
+	shimMu.Lock()
+	shimVFSes[pVfs] = v
+	shimMu.Unlock()
+	if rc := sqlite3.Xsqlite3_vfs_register(tls, pVfs, 0); rc != sqlite3.SQLITE_OK {
+		shimMu.Lock()
+		delete(shimVFSes, pVfs)
+		shimMu.Unlock()
+		return nil, fmt.Errorf("sqlite: cannot register VFS %q: %s", name, libc.GoString(sqlite3.Xsqlite3_errstr(tls, rc)))
+	}
+
+	return v, nil
+}
+
+func shimVFSOf(pVfs uintptr) *shimVFS {
+	shimMu.Lock()
+
+	defer shimMu.Unlock()
+
+	return shimVFSes[pVfs]
+}
+
+func shimFileOf(pFile uintptr) *shimFile {
+	shimMu.Lock()
+
+	defer shimMu.Unlock()
+
+	return shimFiles[pFile]
+}
+
+var (
+	shimIoMethods = sqlite3.Sqlite3_io_methods{
+		FiVersion: 3,
+		FxClose: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr) int32
+		}{shimClose})),
+		FxRead: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, uintptr, int32, int64) int32
+		}{shimRead})),
+		FxWrite: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, uintptr, int32, int64) int32
+		}{shimWrite})),
+		FxTruncate: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, int64) int32
+		}{shimTruncate})),
+		FxSync: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, int32) int32
+		}{shimSync})),
+		FxFileSize: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, uintptr) int32
+		}{shimFileSize})),
+		FxLock: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, int32) int32
+		}{shimLock})),
+		FxUnlock: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, int32) int32
+		}{shimUnlock})),
+		FxCheckReservedLock: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, uintptr) int32
+		}{shimCheckReservedLock})),
+		FxFileControl: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, int32, uintptr) int32
+		}{shimFileControl})),
+		FxSectorSize: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr) int32
+		}{shimSectorSize})),
+		FxDeviceCharacteristics: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr) int32
+		}{shimDeviceCharacteristics})),
+		FxShmMap: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, int32, int32, int32, uintptr) int32
+		}{shimShmMap})),
+		FxShmLock: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, int32, int32, int32) int32
+		}{shimShmLock})),
+		FxShmBarrier: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr)
+		}{shimShmBarrier})),
+		FxShmUnmap: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, int32) int32
+		}{shimShmUnmap})),
+		FxFetch: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, int64, int32, uintptr) int32
+		}{shimFetch})),
+		FxUnfetch: *(*uintptr)(unsafe.Pointer(&struct {
+			f func(*libc.TLS, uintptr, int64, uintptr) int32
+		}{shimUnfetch})),
+	}
+
+	// shimIoMethodsV1 is used for underlying files not supporting shared
+	// memory and memory mapped I/O.
+	shimIoMethodsV1 = func() (r sqlite3.Sqlite3_io_methods) {
+		r = shimIoMethods
+		r.FiVersion = 1
+		r.FxShmMap = 0
+		r.FxShmLock = 0
+		r.FxShmBarrier = 0
+		r.FxShmUnmap = 0
+		r.FxFetch = 0
+		r.FxUnfetch = 0
+		return r
+	}()
+)
+
+// int (*xOpen)(sqlite3_vfs*, sqlite3_filename zName, sqlite3_file*, int flags, int *pOutFlags);
+func shimOpen(tls *libc.TLS, pVfs, zName, pFile uintptr, flags int32, pOutFlags uintptr) int32 {
+	v := shimVFSOf(pVfs)
+	pf := (*sqlite3.Sqlite3_file)(unsafe.Pointer(pFile))
+	pf.FpMethods = 0
+	real := pFile + shimFileHeader
+	rc := sqlite3.Xsqlite3OsOpen(tls, v.parent, zName, real, flags, pOutFlags)
+	pReal := (*sqlite3.Sqlite3_file)(unsafe.Pointer(real))
+	if rc != sqlite3.SQLITE_OK || pReal.FpMethods == 0 {
+		return rc
+	}
+
+	f := &shimFile{flags: flags, real: real, vfs: v, zName: zName}
+	if zName != 0 {
+		f.name = libc.GoString(zName)
+	}
+	hooks, err := v.open(tls, f)
+	if err != nil {
+		logf(sqlite3.SQLITE_CANTOPEN, "sqlite: VFS %s: cannot open %s: %v", v.name, f.name, err)
+		sqlite3.Xsqlite3OsClose(tls, real)
+		return sqlite3.SQLITE_CANTOPEN
+	}
+
+	if hooks == nil {
+		hooks = passThrough{}
+	}
+	f.hooks = hooks
+	shimMu.Lock()
+	shimFiles[pFile] = f
+	shimMu.Unlock()
+	m := (*sqlite3.Sqlite3_io_methods)(unsafe.Pointer(pReal.FpMethods))
+	switch {
+	case m.FiVersion >= 3 && m.FxShmMap != 0:
+		pf.FpMethods = uintptr(unsafe.Pointer(&shimIoMethods))
+	default:
+		pf.FpMethods = uintptr(unsafe.Pointer(&shimIoMethodsV1))
+	}
+	return rc
+}
+
+// int (*xDelete)(sqlite3_vfs*, const char *zName, int syncDir);
+func shimDelete(tls *libc.TLS, pVfs, zName uintptr, syncDir int32) int32 {
+	return sqlite3.Xsqlite3OsDelete(tls, shimVFSOf(pVfs).parent, zName, syncDir)
+}
+
+// int (*xAccess)(sqlite3_vfs*, const char *zName, int flags, int *pResOut);
+func shimAccess(tls *libc.TLS, pVfs, zName uintptr, flags int32, pResOut uintptr) int32 {
+	return sqlite3.Xsqlite3OsAccess(tls, shimVFSOf(pVfs).parent, zName, flags, pResOut)
+}
+
+// int (*xFullPathname)(sqlite3_vfs*, const char *zName, int nOut, char *zOut);
+func shimFullPathname(tls *libc.TLS, pVfs, zName uintptr, nOut int32, zOut uintptr) int32 {
+	return sqlite3.Xsqlite3OsFullPathname(tls, shimVFSOf(pVfs).parent, zName, nOut, zOut)
+}
+
+// int (*xRandomness)(sqlite3_vfs*, int nByte, char *zOut);
+func shimRandomness(tls *libc.TLS, pVfs uintptr, nByte int32, zOut uintptr) int32 {
+	return sqlite3.Xsqlite3OsRandomness(tls, shimVFSOf(pVfs).parent, nByte, zOut)
+}
+
+// int (*xSleep)(sqlite3_vfs*, int microseconds);
+func shimSleep(tls *libc.TLS, pVfs uintptr, microseconds int32) int32 {
+	return sqlite3.Xsqlite3OsSleep(tls, shimVFSOf(pVfs).parent, microseconds)
+}
+
+// int (*xGetLastError)(sqlite3_vfs*, int, char *);
+func shimGetLastError(tls *libc.TLS, pVfs uintptr, n int32, z uintptr) int32 {
+	return sqlite3.Xsqlite3OsGetLastError(tls, shimVFSOf(pVfs).parent)
+}
+
+// int (*xCurrentTimeInt64)(sqlite3_vfs*, sqlite3_int64*);
+func shimCurrentTimeInt64(tls *libc.TLS, pVfs, pTime uintptr) int32 {
+	return sqlite3.Xsqlite3OsCurrentTimeInt64(tls, shimVFSOf(pVfs).parent, pTime)
+}
+
+// int (*xClose)(sqlite3_file*);
+func shimClose(tls *libc.TLS, pFile uintptr) int32 {
+	f := shimFileOf(pFile)
+	rc := f.hooks.close(tls, f)
+	shimMu.Lock()
+	delete(shimFiles, pFile)
+	shimMu.Unlock()
+	return rc
+}
+
+// int (*xRead)(sqlite3_file*, void*, int iAmt, sqlite3_int64 iOfst);
+func shimRead(tls *libc.TLS, pFile, p uintptr, n int32, off int64) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.read(tls, f, p, n, off)
+}
+
+// int (*xWrite)(sqlite3_file*, const void*, int iAmt, sqlite3_int64 iOfst);
+func shimWrite(tls *libc.TLS, pFile, p uintptr, n int32, off int64) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.write(tls, f, p, n, off)
+}
+
+// int (*xTruncate)(sqlite3_file*, sqlite3_int64 size);
+func shimTruncate(tls *libc.TLS, pFile uintptr, size int64) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.truncate(tls, f, size)
+}
+
+// int (*xSync)(sqlite3_file*, int flags);
+func shimSync(tls *libc.TLS, pFile uintptr, flags int32) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.sync(tls, f, flags)
+}
+
+// int (*xFileSize)(sqlite3_file*, sqlite3_int64 *pSize);
+func shimFileSize(tls *libc.TLS, pFile, pSize uintptr) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.fileSize(tls, f, pSize)
+}
+
+// int (*xLock)(sqlite3_file*, int);
+func shimLock(tls *libc.TLS, pFile uintptr, lock int32) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.lock(tls, f, lock)
+}
+
+// int (*xUnlock)(sqlite3_file*, int);
+func shimUnlock(tls *libc.TLS, pFile uintptr, lock int32) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.unlock(tls, f, lock)
+}
+
+// int (*xCheckReservedLock)(sqlite3_file*, int *pResOut);
+func shimCheckReservedLock(tls *libc.TLS, pFile, pResOut uintptr) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.checkReservedLock(tls, f, pResOut)
+}
+
+// int (*xFileControl)(sqlite3_file*, int op, void *pArg);
+func shimFileControl(tls *libc.TLS, pFile uintptr, op int32, pArg uintptr) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.fileControl(tls, f, op, pArg)
+}
+
+// int (*xSectorSize)(sqlite3_file*);
+func shimSectorSize(tls *libc.TLS, pFile uintptr) int32 {
+	return sqlite3.Xsqlite3OsSectorSize(tls, shimFileOf(pFile).real)
+}
+
+// int (*xDeviceCharacteristics)(sqlite3_file*);
+func shimDeviceCharacteristics(tls *libc.TLS, pFile uintptr) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.deviceCharacteristics(tls, f)
+}
+
+// int (*xShmMap)(sqlite3_file*, int iPg, int pgsz, int, void volatile**);
+func shimShmMap(tls *libc.TLS, pFile uintptr, iPg, pgsz, extend int32, pp uintptr) int32 {
+	return sqlite3.Xsqlite3OsShmMap(tls, shimFileOf(pFile).real, iPg, pgsz, extend, pp)
+}
+
+// int (*xShmLock)(sqlite3_file*, int offset, int n, int flags);
+func shimShmLock(tls *libc.TLS, pFile uintptr, offset, n, flags int32) int32 {
+	return sqlite3.Xsqlite3OsShmLock(tls, shimFileOf(pFile).real, offset, n, flags)
+}
+
+// void (*xShmBarrier)(sqlite3_file*);
+func shimShmBarrier(tls *libc.TLS, pFile uintptr) {
+	sqlite3.Xsqlite3OsShmBarrier(tls, shimFileOf(pFile).real)
+}
+
+// int (*xShmUnmap)(sqlite3_file*, int deleteFlag);
+func shimShmUnmap(tls *libc.TLS, pFile uintptr, deleteFlag int32) int32 {
+	return sqlite3.Xsqlite3OsShmUnmap(tls, shimFileOf(pFile).real, deleteFlag)
+}
+
+// int (*xFetch)(sqlite3_file*, sqlite3_int64 iOfst, int iAmt, void **pp);
+func shimFetch(tls *libc.TLS, pFile uintptr, off int64, n int32, pp uintptr) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.fetch(tls, f, off, n, pp)
+}
+
+// int (*xUnfetch)(sqlite3_file*, sqlite3_int64 iOfst, void *p);
+func shimUnfetch(tls *libc.TLS, pFile uintptr, off int64, p uintptr) int32 {
+	f := shimFileOf(pFile)
+	return f.hooks.unfetch(tls, f, off, p)
+}
@@ -0,0 +1,23 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"testing"
+)
+
+// TestRegisterVFSDuplicate checks a VFS name already in use is rejected, as
+// SQLite would keep using the VFS registered first.
+func TestRegisterVFSDuplicate(t *testing.T) {
+	if err := RegisterAuditVFS("dup-test", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"dup-test", "unix"} {
+		if err := RegisterAuditVFS(name, ""); err == nil {
+			t.Errorf("%s: unexpected success", name)
+		}
+	}
+}
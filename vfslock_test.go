@@ -0,0 +1,90 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// TestUnixVFSLocking checks the default unix VFS of the target excludes
+// concurrent writers, and readers of a database in rollback journal mode.
+func TestUnixVFSLocking(t *testing.T) {
+	for _, journal := range []string{"delete", "wal"} {
+		name := filepath.Join(t.TempDir(), "test.db")
+		db, err := sql.Open(driverName, name+"?_pragma=journal_mode("+journal+")")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec("create table t(i)"); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := context.Background()
+		a, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := a.ExecContext(ctx, "begin immediate; insert into t values(1)"); err != nil {
+			t.Fatal(err)
+		}
+
+		var e *Error
+		if _, err := b.ExecContext(ctx, "begin immediate"); !errors.As(err, &e) || e.Code()&0xff != sqlite3.SQLITE_BUSY {
+			t.Errorf("%s: got %v, want SQLITE_BUSY", journal, err)
+		}
+
+		// The write lock is promoted to an exclusive one by the commit.
+		if _, err := b.ExecContext(ctx, "begin; select count(*) from t"); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = a.ExecContext(ctx, "commit")
+		switch journal {
+		case "wal":
+			if err != nil {
+				t.Fatal(err)
+			}
+		default:
+			if !errors.As(err, &e) || e.Code()&0xff != sqlite3.SQLITE_BUSY {
+				t.Errorf("%s: got %v, want SQLITE_BUSY", journal, err)
+			}
+		}
+
+		if _, err := b.ExecContext(ctx, "commit"); err != nil {
+			t.Fatal(err)
+		}
+
+		if journal != "wal" {
+			if _, err := a.ExecContext(ctx, "commit"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var n int
+		if err := b.QueryRowContext(ctx, "select count(*) from t").Scan(&n); err != nil || n != 1 {
+			t.Errorf("%s: got %v, %v, want 1", journal, n, err)
+		}
+
+		a.Close()
+		b.Close()
+		db.Close()
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"modernc.org/libc"
+	"modernc.org/libc/sys/types"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Helpers shared by the virtual tables implemented in Go, see carray.go and
+// spellfix.go.
+
+// goModule holds the methods of a virtual table module. The fields mirror,
+// in order, the members of struct sqlite3_module following iVersion, nil
+// methods are not provided.
+type goModule struct {
+	create     func(tls *libc.TLS, db, pAux uintptr, argc int32, argv, ppVtab, pzErr uintptr) int32
+	connect    func(tls *libc.TLS, db, pAux uintptr, argc int32, argv, ppVtab, pzErr uintptr) int32
+	bestIndex  func(tls *libc.TLS, pVtab, pInfo uintptr) int32
+	disconnect func(tls *libc.TLS, pVtab uintptr) int32
+	destroy    func(tls *libc.TLS, pVtab uintptr) int32
+	open       func(tls *libc.TLS, pVtab, ppCursor uintptr) int32
+	close      func(tls *libc.TLS, pCursor uintptr) int32
+	filter     func(tls *libc.TLS, pCursor uintptr, idxNum int32, idxStr uintptr, argc int32, argv uintptr) int32
+	next       func(tls *libc.TLS, pCursor uintptr) int32
+	eof        func(tls *libc.TLS, pCursor uintptr) int32
+	column     func(tls *libc.TLS, pCursor, ctx uintptr, i int32) int32
+	rowid      func(tls *libc.TLS, pCursor, pRowid uintptr) int32
+	update     func(tls *libc.TLS, pVtab uintptr, argc int32, argv, pRowid uintptr) int32
+	begin      func(tls *libc.TLS, pVtab uintptr) int32
+	sync       func(tls *libc.TLS, pVtab uintptr) int32
+	commit     func(tls *libc.TLS, pVtab uintptr) int32
+	rollback   func(tls *libc.TLS, pVtab uintptr) int32
+	find       func(tls *libc.TLS, pVtab uintptr, nArg int32, zName, pxFunc, ppArg uintptr) int32
+	rename     func(tls *libc.TLS, pVtab, zNew uintptr) int32
+}
+
+// vtabModules are created on every new connection.
+var vtabModules []struct {
+	name   uintptr // const char*
+	module uintptr // *sqlite3.Sqlite3_module
+}
+
+// registerModule makes the module m available to all new connections as name.
+// It must be called from init.
+func registerModule(name string, m *goModule) {
+	tls := libc.NewTLS()
+
+	defer tls.Close()
+
+	// The module lives as long as the program.
+	p := libc.Xcalloc(tls, 1, types.Size_t(unsafe.Sizeof(sqlite3.Sqlite3_module{})))
+	zName, err := libc.CString(name)
+	if err != nil || p == 0 {
+		panic(fmt.Errorf("cannot allocate memory"))
+	}
+
+	sm := (*sqlite3.Sqlite3_module)(unsafe.Pointer(p))
+	methods := (*[unsafe.Sizeof(goModule{}) / ptrSize]uintptr)(unsafe.Pointer(m))
+	copy((*[unsafe.Sizeof(goModule{}) / ptrSize]uintptr)(unsafe.Pointer(&sm.FxCreate))[:], methods[:])
+	vtabModules = append(vtabModules, struct{ name, module uintptr }{zName, p})
+}
+
+// int sqlite3_create_module(
+//
+//	sqlite3 *db,               /* SQLite connection to register module with */
+//	const char *zName,         /* Name of the module */
+//	const sqlite3_module *p,   /* Methods for the module */
+//	void *pClientData          /* Client data for xCreate/xConnect */
+//
+// );
+func (c *conn) createModules() error {
+	for _, m := range vtabModules {
+		if rc := sqlite3.Xsqlite3_create_module(c.tls, c.db, m.name, m.module, 0); rc != sqlite3.SQLITE_OK {
+			return c.errstr(rc)
+		}
+	}
+
+	return nil
+}
+
+// indexConstraint is struct sqlite3_index_constraint.
+type indexConstraint struct {
+	iColumn     int32
+	op          uint8
+	usable      uint8
+	_           [2]byte
+	iTermOffset int32
+}
+
+// indexConstraintUsage is struct sqlite3_index_constraint_usage.
+type indexConstraintUsage struct {
+	argvIndex int32
+	omit      uint8
+	_         [3]byte
+}
+
+// constraint returns the i-th constraint of info.
+func constraint(info *sqlite3.Sqlite3_index_info, i int32) *indexConstraint {
+	return (*indexConstraint)(unsafe.Pointer(info.FaConstraint + uintptr(i)*unsafe.Sizeof(indexConstraint{})))
+}
+
+// constraintUsage returns the usage of the i-th constraint of info.
+func constraintUsage(info *sqlite3.Sqlite3_index_info, i int32) *indexConstraintUsage {
+	return (*indexConstraintUsage)(unsafe.Pointer(info.FaConstraintUsage + uintptr(i)*unsafe.Sizeof(indexConstraintUsage{})))
+}
+
+// newVtab allocates a struct sqlite3_vtab.
+func newVtab(tls *libc.TLS) uintptr {
+	p := sqlite3.Xsqlite3_malloc(tls, int32(unsafe.Sizeof(sqlite3.Sqlite3_vtab{})))
+	if p != 0 {
+		*(*sqlite3.Sqlite3_vtab)(unsafe.Pointer(p)) = sqlite3.Sqlite3_vtab{}
+	}
+	return p
+}
+
+// newVtabCursor allocates a struct sqlite3_vtab_cursor.
+func newVtabCursor(tls *libc.TLS) uintptr {
+	p := sqlite3.Xsqlite3_malloc(tls, int32(unsafe.Sizeof(sqlite3.Sqlite3_vtab_cursor{})))
+	if p != 0 {
+		*(*sqlite3.Sqlite3_vtab_cursor)(unsafe.Pointer(p)) = sqlite3.Sqlite3_vtab_cursor{}
+	}
+	return p
+}
+
+// cursorVtab returns the virtual table of the cursor pCursor.
+func cursorVtab(pCursor uintptr) uintptr {
+	return (*sqlite3.Sqlite3_vtab_cursor)(unsafe.Pointer(pCursor)).FpVtab
+}
+
+// mallocString returns s as a C string allocated by sqlite3_malloc, or 0 if
+// out of memory.
+func mallocString(tls *libc.TLS, s string) uintptr {
+	p := sqlite3.Xsqlite3_malloc64(tls, uint64(len(s))+1)
+	if p == 0 {
+		return 0
+	}
+
+	copy((*libc.RawMem)(unsafe.Pointer(p))[:len(s):len(s)], s)
+	*(*byte)(unsafe.Pointer(p + uintptr(len(s)))) = 0
+	return p
+}
+
+// vtabError sets the error message of the virtual table pVtab and returns
+// SQLITE_ERROR.
+func vtabError(tls *libc.TLS, pVtab uintptr, msg string) int32 {
+	p := mallocString(tls, msg)
+	if p == 0 {
+		return sqlite3.SQLITE_NOMEM
+	}
+
+	vtab := (*sqlite3.Sqlite3_vtab)(unsafe.Pointer(pVtab))
+	sqlite3.Xsqlite3_free(tls, vtab.FzErrMsg)
+	vtab.FzErrMsg = p
+	return sqlite3.SQLITE_ERROR
+}
+
+// declareVtab declares the schema of a virtual table being created or
+// connected.
+func declareVtab(tls *libc.TLS, db uintptr, schema string) int32 {
+	s, err := libc.CString(schema)
+	if err != nil {
+		return sqlite3.SQLITE_NOMEM
+	}
+
+	defer libc.Xfree(tls, s)
+
+	return sqlite3.Xsqlite3_declare_vtab(tls, db, s)
+}
+
+// vtabExec runs sql on db, binding args, and calls fn, if not nil, for every
+// row of the result. It is used by virtual tables to access their shadow
+// tables. The supported argument types are nil, int64, float64, string and
+// []byte.
+func vtabExec(tls *libc.TLS, db uintptr, sql string, args []interface{}, fn func(pstmt uintptr)) error {
+	psql, err := libc.CString(sql)
+	if err != nil {
+		return err
+	}
+
+	defer libc.Xfree(tls, psql)
+
+	ppstmt := libc.Xmalloc(tls, types.Size_t(ptrSize))
+	if ppstmt == 0 {
+		return fmt.Errorf("out of memory")
+	}
+
+	defer libc.Xfree(tls, ppstmt)
+
+	if rc := sqlite3.Xsqlite3_prepare_v2(tls, db, psql, -1, ppstmt, 0); rc != sqlite3.SQLITE_OK {
+		return vtabExecError(tls, db)
+	}
+
+	pstmt := *(*uintptr)(unsafe.Pointer(ppstmt))
+
+	defer sqlite3.Xsqlite3_finalize(tls, pstmt)
+
+	for i, v := range args {
+		var rc int32
+		switch x := v.(type) {
+		case nil:
+			rc = sqlite3.Xsqlite3_bind_null(tls, pstmt, int32(i+1))
+		case int64:
+			rc = sqlite3.Xsqlite3_bind_int64(tls, pstmt, int32(i+1), x)
+		case float64:
+			rc = sqlite3.Xsqlite3_bind_double(tls, pstmt, int32(i+1), x)
+		case string:
+			p := mallocString(tls, x)
+			if p == 0 {
+				return fmt.Errorf("out of memory")
+			}
+
+			rc = sqlite3.Xsqlite3_bind_text64(tls, pstmt, int32(i+1), p, uint64(len(x)), sqlite3.SQLITE_TRANSIENT, sqlite3.SQLITE_UTF8)
+			sqlite3.Xsqlite3_free(tls, p)
+		case []byte:
+			p := sqlite3.Xsqlite3_malloc64(tls, uint64(len(x))+1)
+			if p == 0 {
+				return fmt.Errorf("out of memory")
+			}
+
+			copy((*libc.RawMem)(unsafe.Pointer(p))[:len(x):len(x)], x)
+			rc = sqlite3.Xsqlite3_bind_blob64(tls, pstmt, int32(i+1), p, uint64(len(x)), sqlite3.SQLITE_TRANSIENT)
+			sqlite3.Xsqlite3_free(tls, p)
+		default:
+			return fmt.Errorf("unsupported argument type %T", v)
+		}
+		if rc != sqlite3.SQLITE_OK {
+			return vtabExecError(tls, db)
+		}
+	}
+
+	for {
+		switch rc := sqlite3.Xsqlite3_step(tls, pstmt); rc {
+		case sqlite3.SQLITE_ROW:
+			if fn != nil {
+				fn(pstmt)
+			}
+		case sqlite3.SQLITE_DONE:
+			return nil
+		default:
+			return vtabExecError(tls, db)
+		}
+	}
+}
+
+func vtabExecError(tls *libc.TLS, db uintptr) error {
+	return fmt.Errorf("%s", libc.GoString(sqlite3.Xsqlite3_errmsg(tls, db)))
+}
+
+// columnString returns the text of column i of the row pstmt is at.
+func columnString(tls *libc.TLS, pstmt uintptr, i int32) string {
+	p := sqlite3.Xsqlite3_column_text(tls, pstmt, i)
+	n := sqlite3.Xsqlite3_column_bytes(tls, pstmt, i)
+	if p == 0 || n == 0 {
+		return ""
+	}
+
+	return string((*libc.RawMem)(unsafe.Pointer(p))[:n:n])
+}
+
+// valueString returns the text of the sqlite3_value at index i of argv.
+func valueString(tls *libc.TLS, argv uintptr, i int32) string {
+	p := valueAt(argv, i)
+	s := sqlite3.Xsqlite3_value_text(tls, p)
+	n := sqlite3.Xsqlite3_value_bytes(tls, p)
+	if s == 0 || n == 0 {
+		return ""
+	}
+
+	return string((*libc.RawMem)(unsafe.Pointer(s))[:n:n])
+}
+
+// valueAt returns the sqlite3_value at index i of argv.
+func valueAt(argv uintptr, i int32) uintptr {
+	return *(*uintptr)(unsafe.Pointer(argv + uintptr(i)*sqliteValPtrSize))
+}
+
+// resultText sets the result of the function or column context ctx to the
+// text s.
+func resultText(tls *libc.TLS, ctx uintptr, s string) {
+	p := mallocString(tls, s)
+	if p == 0 {
+		sqlite3.Xsqlite3_result_error_nomem(tls, ctx)
+		return
+	}
+
+	sqlite3.Xsqlite3_result_text64(tls, ctx, p, uint64(len(s)), sqlite3.SQLITE_TRANSIENT, sqlite3.SQLITE_UTF8)
+	sqlite3.Xsqlite3_free(tls, p)
+}
+
+// resultBlob sets the result of the function or column context ctx to the
+// blob b.
+func resultBlob(tls *libc.TLS, ctx uintptr, b []byte) {
+	p := sqlite3.Xsqlite3_malloc64(tls, uint64(len(b))+1)
+	if p == 0 {
+		sqlite3.Xsqlite3_result_error_nomem(tls, ctx)
+		return
+	}
+
+	copy((*libc.RawMem)(unsafe.Pointer(p))[:len(b):len(b)], b)
+	sqlite3.Xsqlite3_result_blob64(tls, ctx, p, uint64(len(b)), sqlite3.SQLITE_TRANSIENT)
+	sqlite3.Xsqlite3_free(tls, p)
+}
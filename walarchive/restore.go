@@ -0,0 +1,233 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package walarchive // import "modernc.org/sqlite/walarchive"
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var errStop = errors.New("stop")
+
+// Backup describes a base backup of an archive.
+type Backup struct {
+	Seq  uint64    // Sequence number of the last transaction in the backup.
+	Time time.Time // When the backup was taken.
+	Size int64     // In bytes, zero for an empty database.
+}
+
+// Info describes the content of an archive.
+type Info struct {
+	Database string
+	Backups  []Backup
+	First    uint64    // Sequence number of the first archived transaction.
+	Last     uint64    // Sequence number of the last archived transaction.
+	LastTime time.Time // Commit time of the transaction Last.
+}
+
+// Stat returns information about the archive in dir.
+func Stat(dir string) (*Info, error) {
+	r := &Info{}
+	b, err := os.ReadFile(filepath.Join(dir, databaseFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	r.Database = string(trimNewline(b))
+	if err := scanAll(dir, 0, func(rec *record) error {
+		switch rec.kind {
+		case kindBase:
+			if rec.pages != 0 {
+				if _, err := os.Stat(filepath.Join(dir, baseName(rec.seq))); err != nil {
+					return nil // Deleted.
+				}
+			}
+
+			r.Backups = append(r.Backups, Backup{rec.seq, rec.time, int64(rec.pages) * int64(rec.pageSize)})
+		case kindCommit:
+			if r.First == 0 {
+				r.First = rec.seq
+			}
+			r.Last = rec.seq
+			r.LastTime = rec.time
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func trimNewline(b []byte) []byte {
+	for len(b) != 0 && (b[len(b)-1] == '\n' || b[len(b)-1] == '\r') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// Restore writes the database archived in dir, as it was at time until, to
+// the new file dst. It starts from the newest base backup taken no later than
+// until and applies the transactions committed after the backup and no later
+// than until. Restore returns the commit time of the last transaction
+// applied, or the time of the backup if there is none. The restored database
+// is in rollback journal mode. It fails if dst exists or if a transaction
+// needed is missing from the archive.
+func Restore(dir, dst string, until time.Time) (last time.Time, err error) {
+	var base *record
+	if err := scanAll(dir, 0, func(rec *record) error {
+		// A backup is logged after the transactions committed while it was
+		// written, scan on.
+		if rec.kind == kindBase && !rec.time.After(until) {
+			if rec.pages != 0 {
+				if _, err := os.Stat(filepath.Join(dir, baseName(rec.seq))); err != nil {
+					return nil // Deleted.
+				}
+			}
+
+			b := *rec
+			b.data = nil
+			base = &b
+		}
+		return nil
+	}); err != nil {
+		return last, err
+	}
+
+	if base == nil {
+		return last, fmt.Errorf("walarchive: %s: no base backup taken before %s", dir, until.UTC().Format(time.RFC3339Nano))
+	}
+
+	f, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return last, err
+	}
+
+	defer func() {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	if base.pages != 0 {
+		b, err := os.Open(filepath.Join(dir, baseName(base.seq)))
+		if err != nil {
+			return last, err
+		}
+
+		_, err = io.Copy(f, b)
+		b.Close()
+		if err != nil {
+			return last, err
+		}
+	}
+
+	last = base.time
+	next := base.seq + 1
+	pages := base.pages
+	if err := scanAll(dir, next, func(rec *record) error {
+		if rec.kind != kindCommit || rec.seq < next {
+			return nil
+		}
+
+		if rec.time.After(until) {
+			return errStop
+		}
+
+		if rec.seq > next {
+			return fmt.Errorf("%w: transactions %d to %d are missing", ErrBroken, next, rec.seq-1)
+		}
+
+		pageSize := int64(rec.pageSize)
+		for b := rec.data; len(b) != 0; b = b[4+pageSize:] {
+			pgno := int64(be.Uint32(b))
+			if pgno == 0 {
+				return fmt.Errorf("%w: invalid page number 0 in transaction %d", ErrBroken, rec.seq)
+			}
+
+			if _, err := f.WriteAt(b[4:4+pageSize], (pgno-1)*pageSize); err != nil {
+				return err
+			}
+		}
+		if err := f.Truncate(int64(rec.pages) * pageSize); err != nil {
+			return err
+		}
+
+		pages = rec.pages
+		last = rec.time
+		next++
+		return nil
+	}); err != nil {
+		return last, err
+	}
+
+	if pages != 0 {
+		// Switch to rollback journal mode and make the in-header database
+		// size valid, see https://www.sqlite.org/fileformat2.html.
+		var hdr [100]byte
+		if _, err := f.ReadAt(hdr[:], 0); err != nil {
+			return last, err
+		}
+
+		hdr[18] = 1
+		hdr[19] = 1
+		be.PutUint32(hdr[28:], pages)
+		copy(hdr[92:96], hdr[24:28])
+		if _, err := f.WriteAt(hdr[:], 0); err != nil {
+			return last, err
+		}
+	}
+
+	return last, f.Sync()
+}
+
+// scanAll calls fn for the records of the log segments in dir, in order,
+// starting with the segment containing transaction from. A partial record at
+// the end of the last segment is ignored. fn stops the scan by returning
+// errStop.
+func scanAll(dir string, from uint64, fn func(*record) error) error {
+	segs, err := segments(dir)
+	if err != nil {
+		return err
+	}
+
+	for len(segs) > 1 && segs[1].seq <= from {
+		segs = segs[1:]
+	}
+	for i, v := range segs {
+		f, err := os.Open(v.name)
+		if err != nil {
+			return err
+		}
+
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		_, err = scan(bufio.NewReader(f), fi.Size(), fn)
+		f.Close()
+		switch {
+		case err == errStop:
+			return nil
+		case err == io.ErrUnexpectedEOF && i == len(segs)-1:
+			return nil
+		case err == io.ErrUnexpectedEOF:
+			return fmt.Errorf("%w: %s: truncated", ErrBroken, v.name)
+		case err != nil:
+			return fmt.Errorf("%s: %w", v.name, err)
+		}
+	}
+	return nil
+}
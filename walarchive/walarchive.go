@@ -0,0 +1,522 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package walarchive archives the transactions committed to a database of
+// modernc.org/sqlite, together with base backups, and restores the database
+// as it was at a chosen time, for point-in-time recovery.
+//
+// An Archive observes the write-ahead log of the database using a VFS
+// registered by sqlite.RegisterWALVFS:
+//
+//	a, err := walarchive.Open("/backup/app")
+//	err = sqlite.RegisterWALVFS("archive", "", a.Ship)
+//	db, err := sql.Open("sqlite3", "file:app.db?vfs=archive&_pragma=journal_mode(wal)")
+//	err = a.Backup(ctx, db) // Periodically, the first one starts archiving.
+//
+//	...
+//
+//	last, err := walarchive.Restore("/backup/app", "restored.db", when)
+//
+// The archive is a directory holding base backups, named base-SEQ.db, and
+// segments of the archive log, named wal-SEQ.log, where SEQ is the sequence
+// number, as 16 hexadecimal digits, of the last transaction included in the
+// backup or of the first transaction following the start of the segment, and
+// a file naming the database. The backup of an empty database is not written.
+// A log segment starts with a 16 byte magic header followed by records, all
+// integers big endian:
+//
+//	offset	size	field
+//	0	1	kind, 'C' for a transaction, 'B' for a base backup
+//	1	8	sequence number of the transaction, starting at 1, or of the last one in the backup
+//	9	8	time of the commit or of the backup, Unix nanoseconds
+//	17	4	page size
+//	21	4	database size in pages
+//	25	4	number of pages, N
+//	29		N times: page number (4), page content
+//	...	4	CRC-32 (IEEE) of the record
+//
+// Files older than the newest base backup needed for recovery can be deleted,
+// Restore only needs a base backup and the log segments following it.
+package walarchive // import "modernc.org/sqlite/walarchive"
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// Magic is the header of an archive log segment.
+const Magic = "SQLite walarch1\n"
+
+// DefaultSegmentSize is the default size after which a new log segment
+// is started.
+const DefaultSegmentSize = 64 << 20
+
+const (
+	kindCommit = 'C'
+	kindBase   = 'B'
+
+	recordHeaderSize = 29
+	databaseFile     = "database"
+	maxPageSize      = 65536
+)
+
+var be = binary.BigEndian
+
+// ErrBroken is wrapped by the errors reporting a damaged archive.
+var ErrBroken = errors.New("WAL archive is broken")
+
+// Archive writes the archive of a database. An Archive is safe for
+// concurrent use by multiple goroutines. Only one Archive per directory may
+// exist at a time.
+type Archive struct {
+	// SegmentSize is the size after which a new log segment is started. Zero
+	// means DefaultSegmentSize.
+	SegmentSize int64
+	// NoSync disables syncing every record to stable storage. Transactions
+	// committed right before a crash of the system may then be missing from
+	// the archive.
+	NoSync bool
+
+	mu       sync.Mutex
+	dir      string
+	database string // Only archived once set, by the first Backup.
+	seq      uint64 // Of the last archived transaction.
+	f        *os.File
+	size     int64
+	buf      []byte
+	err      error // Sticky write error.
+}
+
+// Open opens the archive in dir, creating the directory if it does not
+// exist. A record partially written by a crash is removed from the end of the
+// last log segment.
+func Open(dir string) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	a := &Archive{dir: dir}
+	b, err := os.ReadFile(filepath.Join(dir, databaseFile))
+	switch {
+	case err == nil:
+		a.database = strings.TrimSpace(string(b))
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	segs, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(segs) == 0 {
+		return a, nil
+	}
+
+	last := segs[len(segs)-1]
+	f, err := os.OpenFile(last.name, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	a.seq = last.seq - 1
+	size, err := scan(bufio.NewReader(f), fi.Size(), func(r *record) error {
+		if r.seq > a.seq {
+			a.seq = r.seq
+		}
+		return nil
+	})
+	if err == io.ErrUnexpectedEOF { // Crash while appending the last record.
+		err = f.Truncate(size)
+	}
+	if err == nil && size == 0 {
+		_, err = f.WriteAt([]byte(Magic), 0)
+		size = int64(len(Magic))
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", last.name, err)
+	}
+
+	a.f = f
+	a.size = size
+	return a, nil
+}
+
+// Close closes the archive.
+func (a *Archive) Close() error {
+	a.mu.Lock()
+
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		return nil
+	}
+
+	err := a.f.Close()
+	a.f = nil
+	a.err = os.ErrClosed
+	return err
+}
+
+// Ship archives c. It is meant to be passed to sqlite.RegisterWALVFS.
+// Transactions of other databases, and transactions committed before the
+// first Backup, are ignored. If archiving fails, the transaction fails, and
+// so do all the following ones.
+func (a *Archive) Ship(c *sqlite.WALCommit) error {
+	a.mu.Lock()
+
+	defer a.mu.Unlock()
+
+	if c.Database != a.database || a.database == "" {
+		return nil
+	}
+
+	if err := a.append(kindCommit, a.seq+1, time.Now(), c.PageSize, c.Frames[len(c.Frames)-1].Commit, c.Frames); err != nil {
+		return err
+	}
+
+	a.seq++
+	return nil
+}
+
+// Backup writes a base backup of the main database of db, which must be
+// opened using the VFS archiving to a and allow at least two open
+// connections. The first Backup of an archive starts archiving the
+// transactions of the database.
+func (a *Archive) Backup(ctx context.Context, db *sql.DB) (err error) {
+	wc, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer wc.Close()
+
+	rc, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+
+	var file string
+	if err := wc.QueryRowContext(ctx, "select file from pragma_database_list where name = 'main'").Scan(&file); err != nil {
+		return err
+	}
+
+	// Holding the write lock, no transaction is being committed. The read
+	// transaction sees exactly the transactions archived so far.
+	if _, err := wc.ExecContext(ctx, "begin immediate"); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	if a.database != file && a.database != "" {
+		err = fmt.Errorf("walarchive: %s: archive of %s, not %s", a.dir, a.database, file)
+	}
+	if err == nil && a.database == "" {
+		if err = os.WriteFile(filepath.Join(a.dir, databaseFile), []byte(file+"\n"), 0644); err == nil {
+			a.database = file
+		}
+	}
+	seq := a.seq
+	a.mu.Unlock()
+	t := time.Now()
+	var n int
+	if err == nil {
+		if _, err = rc.ExecContext(ctx, "begin"); err == nil {
+			err = rc.QueryRowContext(ctx, "select count(*) from sqlite_master").Scan(&n)
+		}
+	}
+	if _, e := wc.ExecContext(context.Background(), "rollback"); e != nil && err == nil {
+		err = e
+	}
+	var b []byte
+	if err == nil {
+		err = rc.Raw(func(driverConn interface{}) error {
+			s, ok := driverConn.(interface{ Serialize(string) ([]byte, error) })
+			if !ok {
+				return fmt.Errorf("walarchive: unexpected driver connection %T", driverConn)
+			}
+
+			b, err = s.Serialize("main")
+			return err
+		})
+	}
+	rc.ExecContext(context.Background(), "rollback")
+	if err != nil {
+		return err
+	}
+
+	pageSize := 0
+	if len(b) >= 100 {
+		if pageSize = int(be.Uint16(b[16:])); pageSize == 1 {
+			pageSize = 65536
+		}
+		if err := writeFile(filepath.Join(a.dir, baseName(seq)), b); err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+
+	defer a.mu.Unlock()
+
+	pages := 0
+	if pageSize != 0 {
+		pages = len(b) / pageSize
+	}
+	return a.append(kindBase, seq, t, pageSize, uint32(pages), nil)
+}
+
+func baseName(seq uint64) string { return fmt.Sprintf("base-%016x.db", seq) }
+
+// writeFile atomically creates the file name with content b.
+func writeFile(name string, b []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); e != nil && err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// append writes a record, starting a new segment if needed. append must be
+// called with a.mu held.
+func (a *Archive) append(kind byte, seq uint64, t time.Time, pageSize int, pages uint32, frames []sqlite.WALFrame) error {
+	if a.err != nil {
+		return a.err
+	}
+
+	segmentSize := a.SegmentSize
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if a.f == nil || a.size >= segmentSize {
+		first := seq // Of the first transaction in the segment.
+		if kind == kindBase {
+			first++
+		}
+		if err := a.startSegment(first); err != nil {
+			a.err = err
+			return err
+		}
+	}
+
+	b := a.buf[:0]
+	b = append(b, kind)
+	b = appendUint64(b, seq)
+	b = appendUint64(b, uint64(t.UnixNano()))
+	b = appendUint32(b, uint32(pageSize))
+	b = appendUint32(b, pages)
+	b = appendUint32(b, uint32(len(frames)))
+	for _, v := range frames {
+		b = appendUint32(b, v.Page)
+		b = append(b, v.Data...)
+	}
+	b = appendUint32(b, crc32.ChecksumIEEE(b))
+	a.buf = b
+	if _, err := a.f.Write(b); err != nil {
+		// Do not leave a partial record behind. If it cannot be removed,
+		// the following records would be written after it, fail them all.
+		e := a.f.Truncate(a.size)
+		if e == nil {
+			_, e = a.f.Seek(a.size, io.SeekStart)
+		}
+		if e != nil {
+			a.err = err
+		}
+		return err
+	}
+
+	if !a.NoSync {
+		if err := a.f.Sync(); err != nil {
+			a.err = err
+			return err
+		}
+	}
+
+	a.size += int64(len(b))
+	return nil
+}
+
+func (a *Archive) startSegment(seq uint64) error {
+	if a.f != nil {
+		if err := a.f.Close(); err != nil {
+			return err
+		}
+
+		a.f = nil
+	}
+
+	name := filepath.Join(a.dir, fmt.Sprintf("wal-%016x.log", seq))
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write([]byte(Magic)); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+
+	a.f = f
+	a.size = int64(len(Magic))
+	return nil
+}
+
+func appendUint32(b []byte, n uint32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(n>>32)), uint32(n))
+}
+
+type segment struct {
+	name string
+	seq  uint64
+}
+
+// segments returns the log segments in dir ordered by sequence number.
+func segments(dir string) (r []segment, err error) {
+	names, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range names {
+		s := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(v), "wal-"), ".log")
+		seq, err := strconv.ParseUint(s, 16, 64)
+		if err != nil {
+			continue
+		}
+
+		r = append(r, segment{v, seq})
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].seq < r[j].seq })
+	return r, nil
+}
+
+type record struct {
+	kind     byte
+	seq      uint64
+	time     time.Time
+	pageSize int
+	pages    uint32
+	data     []byte // Page number and content pairs.
+}
+
+// scan reads a log segment of limit bytes from r and calls fn for every
+// record. It returns the number of bytes of r forming complete, valid
+// records, including the header. A record extending past limit is reported as
+// truncated before its data is read. The data of a record passed to fn is
+// only valid until fn returns.
+func scan(r io.Reader, limit int64, fn func(*record) error) (size int64, err error) {
+	var magic [len(Magic)]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		return 0, err
+	}
+
+	if string(magic[:]) != Magic {
+		return 0, fmt.Errorf("%w: invalid header", ErrBroken)
+	}
+
+	size = int64(len(magic))
+	var buf []byte
+	for {
+		var hdr [recordHeaderSize]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				return size, nil
+			}
+
+			return size, io.ErrUnexpectedEOF
+		}
+
+		rec := record{
+			kind:     hdr[0],
+			seq:      be.Uint64(hdr[1:]),
+			time:     time.Unix(0, int64(be.Uint64(hdr[9:]))),
+			pageSize: int(be.Uint32(hdr[17:])),
+			pages:    be.Uint32(hdr[21:]),
+		}
+		frames := int64(be.Uint32(hdr[25:]))
+		if rec.kind != kindCommit && rec.kind != kindBase || rec.pageSize > maxPageSize ||
+			rec.pageSize&(rec.pageSize-1) != 0 || rec.kind == kindBase && frames != 0 ||
+			rec.kind == kindCommit && (rec.pageSize < 512 || frames == 0) {
+			return size, fmt.Errorf("%w: invalid record at offset %d", ErrBroken, size)
+		}
+
+		n := frames * int64(4+rec.pageSize)
+		if size+recordHeaderSize+n+4 > limit {
+			return size, io.ErrUnexpectedEOF
+		}
+
+		if int64(cap(buf)) < n+4 {
+			buf = make([]byte, n+4)
+		}
+		buf = buf[:n+4]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return size, io.ErrUnexpectedEOF
+		}
+
+		h := crc32.NewIEEE()
+		h.Write(hdr[:])
+		h.Write(buf[:n])
+		if h.Sum32() != be.Uint32(buf[n:]) {
+			return size, fmt.Errorf("%w: checksum mismatch at offset %d", ErrBroken, size)
+		}
+
+		rec.data = buf[:n]
+		if err := fn(&rec); err != nil {
+			return size, err
+		}
+
+		size += recordHeaderSize + n + 4
+	}
+}
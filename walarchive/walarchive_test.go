@@ -0,0 +1,278 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package walarchive // import "modernc.org/sqlite/walarchive"
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+const testVFS = "walarchive-test"
+
+var (
+	registerOnce sync.Once
+	shipMu       sync.Mutex
+	shipTo       *Archive // Of the running test.
+)
+
+// archiveDB opens an archive in a new directory and a database shipping its
+// transactions to it.
+func archiveDB(t *testing.T) (dir, fn string, a *Archive, db *sql.DB) {
+	registerOnce.Do(func() {
+		if err := sqlite.RegisterWALVFS(testVFS, "", func(c *sqlite.WALCommit) error {
+			shipMu.Lock()
+			a := shipTo
+			shipMu.Unlock()
+			if a == nil {
+				return nil
+			}
+
+			return a.Ship(c)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	tmp := t.TempDir()
+	dir = filepath.Join(tmp, "archive")
+	fn = filepath.Join(tmp, "test.db")
+	a, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shipMu.Lock()
+	shipTo = a
+	shipMu.Unlock()
+	t.Cleanup(func() {
+		shipMu.Lock()
+		shipTo = nil
+		shipMu.Unlock()
+		a.Close()
+	})
+
+	if db, err = sql.Open("sqlite3", "file:"+fn+"?vfs="+testVFS+"&_pragma=journal_mode(wal)"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+	return dir, fn, a, db
+}
+
+func exec(t *testing.T, db *sql.DB, sql string, args ...interface{}) {
+	if _, err := db.Exec(sql, args...); err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+}
+
+// content returns the rows of table t of the database file fn.
+func content(t *testing.T, fn string) (r []int) {
+	db, err := sql.Open("sqlite3", fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	var check string
+	if err := db.QueryRow("pragma integrity_check").Scan(&check); err != nil || check != "ok" {
+		t.Fatalf("%s: integrity check: %s %v", fn, check, err)
+	}
+
+	rows, err := db.Query("select i from t order by i")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var i int
+		if err := rows.Scan(&i); err != nil {
+			t.Fatal(err)
+		}
+
+		r = append(r, i)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir, fn, a, db := archiveDB(t)
+	exec(t, db, "create table t(i integer primary key, b blob)")
+	exec(t, db, "insert into t values(1, randomblob(10000))")
+	if err := a.Backup(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 2; i <= 5; i++ {
+		exec(t, db, "insert into t values(?, randomblob(10000))", i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	t1 := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	exec(t, db, "delete from t where i < 3")
+	exec(t, db, "insert into t values(6, randomblob(100000))")
+
+	info, err := Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(info.Backups) != 1 || info.First != 1 || info.Last != 6 || info.Database != fn {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	for _, v := range []struct {
+		until time.Time
+		want  []int
+	}{
+		{t1, []int{1, 2, 3, 4, 5}},
+		{time.Now(), []int{3, 4, 5, 6}},
+	} {
+		dst := filepath.Join(t.TempDir(), "restored.db")
+		if _, err := Restore(dir, dst, v.until); err != nil {
+			t.Fatal(err)
+		}
+
+		if g, e := content(t, dst), v.want; !equal(g, e) {
+			t.Errorf("got %v, want %v", g, e)
+		}
+	}
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lastSegment returns the name of the last log segment in dir.
+func lastSegment(t *testing.T, dir string) string {
+	segs, err := segments(dir)
+	if err != nil || len(segs) == 0 {
+		t.Fatal(segs, err)
+	}
+
+	return segs[len(segs)-1].name
+}
+
+func TestTruncatedTail(t *testing.T) {
+	dir, _, a, db := archiveDB(t)
+	exec(t, db, "create table t(i integer primary key)")
+	if err := a.Backup(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	exec(t, db, "insert into t values(1)")
+	exec(t, db, "insert into t values(2)")
+	db.Close()
+	a.Close()
+
+	// A crash while appending the last record.
+	seg := lastSegment(t, dir)
+	fi, err := os.Stat(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Truncate(seg, fi.Size()-10); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "restored.db")
+	if _, err := Restore(dir, dst, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if g, e := content(t, dst), []int{1}; !equal(g, e) {
+		t.Errorf("got %v, want %v", g, e)
+	}
+
+	// Open removes the partial record, the next transaction follows the
+	// last complete one.
+	a, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer a.Close()
+
+	if a.seq != 1 {
+		t.Fatalf("got seq %d, want 1", a.seq)
+	}
+
+	// A record header claiming more data than the segment holds is a
+	// partial record as well, its data is not allocated.
+	b, err := os.ReadFile(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdr := make([]byte, recordHeaderSize)
+	hdr[0] = kindCommit
+	be.PutUint32(hdr[17:], maxPageSize)
+	be.PutUint32(hdr[25:], 1<<32-1)
+	size, err := scan(bytes.NewReader(append(b, hdr...)), int64(len(b)+len(hdr)), func(*record) error { return nil })
+	if err != io.ErrUnexpectedEOF || size != int64(len(b)) {
+		t.Fatalf("got %d, %v, want %d, %v", size, err, len(b), io.ErrUnexpectedEOF)
+	}
+}
+
+func TestCorruptTail(t *testing.T) {
+	dir, _, a, db := archiveDB(t)
+	exec(t, db, "create table t(i integer primary key)")
+	if err := a.Backup(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	exec(t, db, "insert into t values(1)")
+	db.Close()
+	a.Close()
+
+	seg := lastSegment(t, dir)
+	b, err := os.ReadFile(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b[len(b)-5]++ // Last byte of the page data of the last record.
+	if err := os.WriteFile(seg, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(dir, filepath.Join(t.TempDir(), "restored.db"), time.Now()); !errors.Is(err, ErrBroken) {
+		t.Fatalf("got %v, want %v", err, ErrBroken)
+	}
+
+	if _, err := Stat(dir); !errors.Is(err, ErrBroken) {
+		t.Fatalf("got %v, want %v", err, ErrBroken)
+	}
+
+	if _, err := Open(dir); !errors.Is(err, ErrBroken) {
+		t.Fatalf("got %v, want %v", err, ErrBroken)
+	}
+}
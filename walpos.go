@@ -0,0 +1,193 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// WALPosition identifies a state of a database in WAL mode, the one after a
+// commit. Positions of a database can be compared as long as it does not lose
+// its WAL file, which is deleted when its last connection is closed.
+type WALPosition struct {
+	Salt  uint32 // Salt-1 of the WAL header, incremented when the WAL is restarted.
+	Frame uint32 // Valid frames in the WAL, up to the last commit.
+}
+
+// Before reports whether p is a state earlier than q.
+func (p WALPosition) Before(q WALPosition) bool {
+	return p.Salt < q.Salt || p.Salt == q.Salt && p.Frame < q.Frame
+}
+
+// String implements fmt.Stringer.
+func (p WALPosition) String() string {
+	return fmt.Sprintf("%d.%d", p.Salt, p.Frame)
+}
+
+var (
+	walCommitsMu sync.Mutex
+	walCommits   = map[string]WALPosition{} // Database file name: last commit.
+)
+
+// lastCommit returns the position of the last commit to the database file
+// made by a connection of the process.
+func lastCommit(filename string) WALPosition {
+	walCommitsMu.Lock()
+
+	defer walCommitsMu.Unlock()
+
+	return walCommits[filename]
+}
+
+// recordCommit records the position of the commit which left nFrame frames in
+// the WAL of the database zDb of db, see xWALHook.
+func recordCommit(tls *libc.TLS, db, zDb uintptr, nFrame int32) {
+	// The WAL file is the journal of a database in WAL mode.
+	p := libc.Xmalloc(tls, 8)
+	if p == 0 {
+		return
+	}
+
+	defer libc.Xfree(tls, p)
+
+	*(*uintptr)(unsafe.Pointer(p)) = 0
+	if rc := sqlite3.Xsqlite3_file_control(tls, db, zDb, sqlite3.SQLITE_FCNTL_JOURNAL_POINTER, p); rc != sqlite3.SQLITE_OK {
+		return
+	}
+
+	wal := *(*uintptr)(unsafe.Pointer(p))
+	if wal == 0 || *(*uintptr)(unsafe.Pointer(wal)) == 0 { // No file or not open.
+		return
+	}
+
+	if rc := sqlite3.Xsqlite3OsRead(tls, wal, p, 4, 16); rc != sqlite3.SQLITE_OK {
+		return
+	}
+
+	pos := WALPosition{
+		Salt:  binary.BigEndian.Uint32((*[4]byte)(unsafe.Pointer(p))[:]),
+		Frame: uint32(nFrame),
+	}
+	filename := libc.GoString(sqlite3.Xsqlite3_db_filename(tls, db, zDb))
+	walCommitsMu.Lock()
+	if walCommits[filename].Before(pos) {
+		walCommits[filename] = pos
+	}
+	walCommitsMu.Unlock()
+}
+
+// WALPosition returns the state of the main database seen by the read
+// transaction of the connection, or, if no transaction is open, the state a
+// new read transaction sees. It fails if the database is not in WAL mode or
+// if the connection is in a write transaction.
+//
+// WALPosition can be reached using (*sql.Conn).Raw.
+func (c *conn) WALPosition() (r WALPosition, err error) {
+	if c.autocommit() {
+		if _, err := c.exec(context.Background(), "begin", nil); err != nil {
+			return r, err
+		}
+
+		defer func() {
+			if _, err2 := c.exec(context.Background(), "rollback", nil); err2 != nil && err == nil {
+				err = err2
+			}
+		}()
+	}
+
+	p, err := c.malloc(int(ptrSize))
+	if err != nil {
+		return r, err
+	}
+
+	defer c.free(p)
+
+	zDb, err := libc.CString("main")
+	if err != nil {
+		return r, err
+	}
+
+	defer c.free(zDb)
+
+	// int sqlite3_snapshot_get(
+	//   sqlite3 *db,
+	//   const char *zSchema,
+	//   sqlite3_snapshot **ppSnapshot
+	// );
+	//
+	// The snapshot is a copy of the WAL index header of the read
+	// transaction, opened if needed.
+	if rc := sqlite3.Xsqlite3_snapshot_get(c.tls, c.db, zDb, p); rc != sqlite3.SQLITE_OK {
+		return r, c.errstr(rc)
+	}
+
+	snapshot := *(*uintptr)(unsafe.Pointer(p))
+
+	defer sqlite3.Xsqlite3_snapshot_free(c.tls, snapshot)
+
+	hdr := (*[48]byte)(unsafe.Pointer(snapshot))
+	return WALPosition{
+		Salt:  binary.BigEndian.Uint32(hdr[32:]),
+		Frame: *(*uint32)(unsafe.Pointer(&hdr[16])),
+	}, nil
+}
+
+// LastCommit returns the position of the last commit to the database of the
+// pool made by a connection of the process, using the writer or not. The
+// result is the zero WALPosition if there was none since the database was
+// opened. Pass it to WaitFor to read what was written.
+func (p *Pool) LastCommit() WALPosition { return lastCommit(p.filename) }
+
+// WaitFor waits until the readers of the pool see the database at position
+// pos or later, so that the queries and read only transactions started
+// afterwards observe the commit at pos, or until ctx is done.
+//
+// A read transaction sees all the commits completed before it started, so a
+// write followed by a query on another connection of the pool does not wait.
+// WaitFor guards the reads depending on a write made somewhere else, for
+// example in the request of an HTTP client which passes the position of its
+// last write to the next one.
+func (p *Pool) WaitFor(ctx context.Context, pos WALPosition) error {
+	for i := 0; ; i++ {
+		sc, err := p.r.Conn(ctx)
+		if err != nil {
+			return err
+		}
+
+		var cur WALPosition
+		err = sc.Raw(func(c interface{}) (err error) {
+			cur, err = c.(*conn).WALPosition()
+			return err
+		})
+		sc.Close()
+		if err != nil {
+			return err
+		}
+
+		if !cur.Before(pos) {
+			return nil
+		}
+
+		poll := lockWaitPolls[len(lockWaitPolls)-1]
+		if i < len(lockWaitPolls) {
+			poll = lockWaitPolls[i]
+		}
+		t := time.NewTimer(poll)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPoolWaitFor(t *testing.T) {
+	p, err := OpenPool(filepath.Join(t.TempDir(), "test.db"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer p.Close()
+
+	if g := p.LastCommit(); g != (WALPosition{}) {
+		t.Errorf("LastCommit %v before any commit", g)
+	}
+
+	if _, err := p.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	pos := p.LastCommit()
+	if pos.Frame == 0 {
+		t.Fatalf("LastCommit %v after a commit", pos)
+	}
+
+	tx, err := p.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tx.Exec("insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if g := p.LastCommit(); g != pos {
+		t.Errorf("LastCommit %v before commit, want %v", g, pos)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	pos2 := p.LastCommit()
+	if !pos.Before(pos2) {
+		t.Fatalf("LastCommit %v after %v", pos2, pos)
+	}
+
+	if err := p.WaitFor(context.Background(), pos2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restarting the WAL increments its salt.
+	if _, err := p.Exec("pragma wal_checkpoint(truncate)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Exec("insert into t values(2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	pos3 := p.LastCommit()
+	if pos3.Salt != pos2.Salt+1 || !pos2.Before(pos3) {
+		t.Errorf("LastCommit %v after %v and a WAL restart", pos3, pos2)
+	}
+
+	if err := p.WaitFor(context.Background(), pos3); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := p.QueryRow("select count(*) from t").Scan(&n); err != nil || n != 2 {
+		t.Fatalf("%d rows, %v", n, err)
+	}
+
+	// A read transaction keeps seeing its snapshot.
+	rtx, err := p.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rtx.Rollback()
+
+	if err := rtx.QueryRow("select count(*) from t").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Exec("insert into t values(3)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rtx.QueryRow("select count(*) from t").Scan(&n); err != nil || n != 2 {
+		t.Fatalf("%d rows, %v", n, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+	defer cancel()
+
+	future := WALPosition{pos3.Salt, pos3.Frame + 100}
+	if err := p.WaitFor(ctx, future); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitFor %v: %v, want %v", future, err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+)
+
+// WALFrame is a frame of a write-ahead log, the new content of a database
+// page.
+type WALFrame struct {
+	Page   uint32 // Page number, starting at 1.
+	Commit uint32 // Database size in pages in the last frame of a transaction, otherwise zero.
+	Header []byte // The frame header as stored in the write-ahead log.
+	Data   []byte // Content of the page.
+}
+
+// WALCommit is a transaction appended to the write-ahead log of a database,
+// see RegisterWALVFS.
+type WALCommit struct {
+	Database   string // Name of the database file.
+	Generation uint64 // Number of the write-ahead log started from its beginning.
+	Header     []byte // The header of the write-ahead log.
+	Offset     int64  // Position of the first frame in the write-ahead log.
+	PageSize   int
+	Frames     []WALFrame
+}
+
+// Segment returns the frames of c as they are stored in the write-ahead log
+// at c.Offset. Header followed by all the segments of a generation, in order,
+// forms a valid write-ahead log of the database.
+func (c *WALCommit) Segment() []byte {
+	b := make([]byte, 0, len(c.Frames)*(walFrameHeaderSize+c.PageSize))
+	for _, v := range c.Frames {
+		b = append(b, v.Header...)
+		b = append(b, v.Data...)
+	}
+	return b
+}
+
+// walShips are the write-ahead logs currently observed, shared by all
+// connections of the process using the same database.
+var walShips = struct {
+	sync.Mutex
+	m map[string]*walShip
+}{m: map[string]*walShip{}}
+
+type walShip struct {
+	sync.Mutex
+	db         string
+	fns        map[string]*walShipFn // VFS name: function of the VFS.
+	refs       int
+	generation uint64
+	header     []byte // Nil while unknown.
+	pageSize   int64
+	frames     map[int64][]byte // Frame index: frame of the transaction in progress.
+}
+
+// walShipFn is the function of a VFS registered by RegisterWALVFS and the
+// number of files of the database the VFS has open.
+type walShipFn struct {
+	fn   func(*WALCommit) error
+	refs int
+}
+
+// acquireWALShip returns the walShip of db and adds fn, the function of the
+// VFS named vfs, to the functions it passes transactions to. The same
+// database can be opened using several such VFSes, for example to archive
+// and replicate it, each of them gets every transaction.
+func acquireWALShip(db, vfs string, fn func(*WALCommit) error) *walShip {
+	walShips.Lock()
+
+	defer walShips.Unlock()
+
+	s := walShips.m[db]
+	if s == nil {
+		s = &walShip{db: db, fns: map[string]*walShipFn{}, frames: map[int64][]byte{}}
+		walShips.m[db] = s
+	}
+	s.refs++
+	s.Lock()
+	if f := s.fns[vfs]; f != nil {
+		f.refs++
+	} else {
+		s.fns[vfs] = &walShipFn{fn: fn, refs: 1}
+	}
+	s.Unlock()
+	return s
+}
+
+func releaseWALShip(s *walShip, vfs string) {
+	walShips.Lock()
+
+	defer walShips.Unlock()
+
+	s.Lock()
+	if f := s.fns[vfs]; f != nil {
+		if f.refs--; f.refs == 0 {
+			delete(s.fns, vfs)
+		}
+	}
+	s.Unlock()
+	if s.refs--; s.refs == 0 {
+		delete(walShips.m, s.db)
+	}
+}
+
+// ship passes c to the functions of s, in the order of their VFS names, and
+// returns the first error.
+func (s *walShip) ship(c *WALCommit) error {
+	s.Lock()
+	names := make([]string, 0, len(s.fns))
+	for k := range s.fns {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	fns := make([]func(*WALCommit) error, len(names))
+	for i, k := range names {
+		fns[i] = s.fns[k].fn
+	}
+	s.Unlock()
+	for _, fn := range fns {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterWALVFS registers a VFS named name which forwards to the VFS named
+// parent, or to the default VFS if parent is empty, and passes every
+// transaction appended to the write-ahead log of a database to fn, for
+// example to replicate the database continuously or to back it up
+// incrementally. The frames of a transaction are passed after they are
+// written, before its commit frame is. If fn returns an error, the commit
+// fails with an I/O error and the transaction is rolled back, so no committed
+// transaction escapes fn. A transaction passed to fn can still fail if the
+// write or sync of the commit frame fails afterwards.
+//
+// To use the VFS, pass its name in the vfs query parameter of a URI file
+// name and enable WAL mode, for example
+//
+//	db, err := sql.Open("sqlite3", "file:app.db?vfs=ship&_pragma=journal_mode(wal)")
+//
+// fn is called by the connection committing the transaction, while it holds
+// the write lock of the database, and must not use the database. All the
+// transactions of a database are passed to fn in commit order. When the
+// connections of the process open a database using several VFSes registered
+// by RegisterWALVFS, every transaction is passed to the functions of all of
+// them, whichever connection commits it.
+//
+// A write-ahead log is restarted from its beginning, with a new header, after
+// a checkpoint copied all its frames back to the database. Generation is
+// incremented every time this happens, and is 1 for the log found or created
+// when the process first opens the database. The first transaction of a
+// restarted generation has Offset 32, the Offset of every other one is the
+// end of the previous one. Frames present in the log before the process
+// opened it and frames written by other processes are not passed to fn, which
+// breaks this sequence. Run "pragma wal_checkpoint(truncate)" before shipping
+// starts to get all the changes in the log, and restart from a full copy of
+// the database when the sequence breaks.
+//
+// A replica is brought up to date by writing the Data of every frame at
+// offset (Page-1)*PageSize of the database file and truncating the file to
+// Commit*PageSize pages at the end of the transaction.
+func RegisterWALVFS(name, parent string, fn func(*WALCommit) error) error {
+	if fn == nil {
+		return fmt.Errorf("sqlite: RegisterWALVFS: nil function")
+	}
+
+	_, err := registerShimVFS(name, parent, func(tls *libc.TLS, f *shimFile) (fileHooks, error) {
+		if !f.isWAL() {
+			return nil, nil
+		}
+
+		s := acquireWALShip(libc.GoString(sqlite3.Xsqlite3_filename_database(tls, f.zName)), name, fn)
+		s.readHeader(tls, f)
+		return &walShipHooks{ship: s, vfs: name}, nil
+	})
+	return err
+}
+
+// readHeader reads the header of an existing write-ahead log.
+func (s *walShip) readHeader(tls *libc.TLS, f *shimFile) {
+	s.Lock()
+
+	defer s.Unlock()
+
+	if s.header != nil {
+		return
+	}
+
+	p := libc.Xmalloc(tls, walHeaderSize)
+	if p == 0 {
+		return
+	}
+
+	defer libc.Xfree(tls, p)
+
+	if rc := (passThrough{}).read(tls, f, p, walHeaderSize, 0); rc != sqlite3.SQLITE_OK {
+		return // Empty or new log.
+	}
+
+	s.setHeader(memBytes(p, walHeaderSize))
+}
+
+func (s *walShip) setHeader(b []byte) {
+	if magic := binary.BigEndian.Uint32(b); magic&^1 != 0x377f0682 {
+		return
+	}
+
+	s.header = append([]byte(nil), b...)
+	s.pageSize = int64(binary.BigEndian.Uint32(b[8:]))
+	s.frames = map[int64][]byte{}
+	s.generation++
+}
+
+// write records the bytes written at off and returns the transaction they
+// commit, if any.
+func (s *walShip) write(b []byte, off int64) *WALCommit {
+	if off == 0 && len(b) == walHeaderSize {
+		s.setHeader(b)
+		return nil
+	}
+
+	if s.header == nil || s.pageSize == 0 || off < walHeaderSize {
+		return nil
+	}
+
+	frameSize := walFrameHeaderSize + s.pageSize
+	var commit int64 = -1
+	for len(b) != 0 {
+		ix := (off - walHeaderSize) / frameSize
+		pos := (off - walHeaderSize) % frameSize
+		frame := s.frames[ix]
+		if frame == nil {
+			frame = make([]byte, frameSize)
+			s.frames[ix] = frame
+		}
+		n := copy(frame[pos:], b)
+		b = b[n:]
+		off += int64(n)
+		if pos+int64(n) == frameSize && binary.BigEndian.Uint32(frame[4:]) != 0 {
+			commit = ix
+		}
+	}
+	if commit < 0 {
+		return nil
+	}
+
+	var ixs []int64
+	for ix := range s.frames {
+		if ix <= commit {
+			ixs = append(ixs, ix)
+		}
+	}
+	sort.Slice(ixs, func(i, j int) bool { return ixs[i] < ixs[j] })
+	c := &WALCommit{
+		Database:   s.db,
+		Generation: s.generation,
+		Header:     s.header,
+		Offset:     walHeaderSize + ixs[0]*frameSize,
+		PageSize:   int(s.pageSize),
+	}
+	for _, ix := range ixs {
+		frame := s.frames[ix]
+		delete(s.frames, ix)
+		c.Frames = append(c.Frames, WALFrame{
+			Page:   binary.BigEndian.Uint32(frame),
+			Commit: binary.BigEndian.Uint32(frame[4:]),
+			Header: frame[:walFrameHeaderSize:walFrameHeaderSize],
+			Data:   frame[walFrameHeaderSize:],
+		})
+	}
+	return c
+}
+
+type walShipHooks struct {
+	passThrough
+	ship *walShip
+	vfs  string
+}
+
+func (h *walShipHooks) close(tls *libc.TLS, f *shimFile) int32 {
+	rc := h.passThrough.close(tls, f)
+	releaseWALShip(h.ship, h.vfs)
+	return rc
+}
+
+func (h *walShipHooks) write(tls *libc.TLS, f *shimFile, p uintptr, n int32, off int64) int32 {
+	s := h.ship
+	s.Lock()
+	c := s.write(memBytes(p, n), off)
+	s.Unlock()
+	if c != nil {
+		if err := s.ship(c); err != nil {
+			logf(sqlite3.SQLITE_IOERR_WRITE, "sqlite: shipping WAL of %s: %v", s.db, err)
+			return sqlite3.SQLITE_IOERR_WRITE
+		}
+	}
+
+	return h.passThrough.write(tls, f, p, n, off)
+}
+
+func (h *walShipHooks) truncate(tls *libc.TLS, f *shimFile, size int64) int32 {
+	s := h.ship
+	s.Lock()
+	if size < walHeaderSize {
+		s.header = nil
+		s.frames = map[int64][]byte{}
+	}
+	for ix := range s.frames {
+		if walHeaderSize+ix*(walFrameHeaderSize+s.pageSize) >= size {
+			delete(s.frames, ix)
+		}
+	}
+	s.Unlock()
+	return h.passThrough.truncate(tls, f, size)
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type walRecorder struct {
+	sync.Mutex
+	commits []*WALCommit
+	err     error
+}
+
+func (r *walRecorder) ship(c *WALCommit) error {
+	r.Lock()
+
+	defer r.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	r.commits = append(r.commits, c)
+	return nil
+}
+
+func (r *walRecorder) take() (n int) {
+	r.Lock()
+
+	defer r.Unlock()
+
+	n = len(r.commits)
+	r.commits = nil
+	return n
+}
+
+func (r *walRecorder) fail(err error) {
+	r.Lock()
+
+	defer r.Unlock()
+
+	r.err = err
+}
+
+// TestWALVFSShared checks every VFS registered by RegisterWALVFS which has a
+// database open gets all its transactions, whichever connection commits them.
+func TestWALVFSShared(t *testing.T) {
+	var a, b walRecorder
+	if err := RegisterWALVFS("walship-test-a", "", a.ship); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterWALVFS("walship-test-b", "", b.ship); err != nil {
+		t.Fatal(err)
+	}
+
+	fn := filepath.Join(t.TempDir(), "test.db")
+	open := func(vfs string) *sql.DB {
+		db, err := sql.Open(driverName, "file:"+fn+"?vfs="+vfs+"&_pragma=journal_mode(wal)")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		db.SetMaxOpenConns(1)
+		return db
+	}
+	exec := func(db *sql.DB, sql string) {
+		if _, err := db.Exec(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	dba := open("walship-test-a")
+
+	defer dba.Close()
+
+	exec(dba, "create table t(i)")
+	if n := a.take(); n == 0 {
+		t.Fatal("no transaction shipped")
+	}
+
+	dbb := open("walship-test-b")
+
+	defer dbb.Close()
+
+	exec(dbb, "select count(*) from t")
+	for i, db := range []*sql.DB{dba, dbb} {
+		exec(db, "insert into t values(1)")
+		if na, nb := a.take(), b.take(); na != 1 || nb != 1 {
+			t.Fatalf("%d: got %d and %d transactions, want 1 and 1", i, na, nb)
+		}
+	}
+
+	// An error of any function fails the commit.
+	b.fail(errors.New("test"))
+	if _, err := dba.Exec("insert into t values(2)"); err == nil {
+		t.Fatal("unexpected success")
+	}
+
+	b.fail(nil)
+	var n int
+	if err := dba.QueryRow("select count(*) from t where i = 2").Scan(&n); err != nil || n != 0 {
+		t.Fatal(n, err)
+	}
+
+	a.take()
+	if err := dbb.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	exec(dba, "insert into t values(3)")
+	if na, nb := a.take(), b.take(); na != 1 || nb != 0 {
+		t.Fatalf("got %d and %d transactions, want 1 and 0", na, nb)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DataVersion returns the data version of the main database, see
+// https://www.sqlite.org/pragma.html#pragma_data_version. The value changes
+// when another connection, of the process or of another process, commits
+// changes to the database. It does not change for the commits of the
+// connection itself. The values of different connections are unrelated.
+//
+// DataVersion can be reached using (*sql.Conn).Raw.
+func (c *conn) DataVersion() (int64, error) {
+	return c.pragmaInt64("data_version")
+}
+
+// Watcher reports the changes made to a database file, see Watch.
+type Watcher struct {
+	// C receives a value after changes were committed to the database. The
+	// changes of several polls are coalesced while C is not read. C is closed
+	// by Close.
+	C <-chan struct{}
+
+	c        chan struct{}
+	conn     *conn
+	interval time.Duration
+
+	mu  sync.Mutex
+	err error
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// Watch starts a goroutine polling the data version of the main database of
+// db every interval, see DataVersion, and reporting its changes on C. Unlike
+// Notify, it observes the commits of other processes, including those of
+// other programs and of connections not opened with _notify, so read side
+// caches can be invalidated across processes. It does not tell what changed.
+// The poll uses a connection of its own to the database file, not one of db,
+// and reads only the database header or the WAL index, which is cheap enough
+// for intervals of milliseconds. A poll failing, for example because the
+// database is locked, is retried at the next interval, see Err.
+//
+// Watch polls instead of watching the file system for modifications, which
+// would miss the commits to a WAL database not yet checkpointed and report
+// checkpoints modifying nothing.
+//
+// Call Close to stop the goroutine.
+func Watch(db *sql.DB, interval time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("sqlite: Watch: invalid interval %v", interval)
+	}
+
+	ctx := context.Background()
+	sc, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer sc.Close()
+
+	var filename string
+	if err := sc.Raw(func(dc interface{}) error {
+		c, ok := dc.(*conn)
+		if !ok {
+			return fmt.Errorf("sqlite: Watch: unexpected driver connection %T", dc)
+		}
+
+		filename = libc.GoString(sqlite3.Xsqlite3_db_filename(c.tls, c.db, 0))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if filename == "" {
+		return nil, fmt.Errorf("sqlite: Watch: the database has no file name")
+	}
+
+	c, err := openConn(filename, "")
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := c.DataVersion()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+	w := &Watcher{
+		C:        ch,
+		c:        ch,
+		conn:     c,
+		interval: interval,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go w.run(v)
+	return w, nil
+}
+
+// Err returns the error of the last poll, nil if it succeeded.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// Close stops the goroutine of w, closes its connection and closes C.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() { close(w.done) })
+	<-w.stopped
+	return nil
+}
+
+func (w *Watcher) run(version int64) {
+	defer close(w.stopped)
+
+	defer close(w.c)
+
+	defer w.conn.Close()
+
+	t := time.NewTicker(w.interval)
+
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-w.done:
+			return
+		}
+
+		v, err := w.conn.DataVersion()
+		w.mu.Lock()
+		w.err = err
+		w.mu.Unlock()
+		if err != nil || v == version {
+			continue
+		}
+
+		version = v
+		select {
+		case w.c <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, fn+"?_pragma=journal_mode(wal)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another handle plays the part of another process.
+	other, err := sql.Open(driverName, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer other.Close()
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	version := func() (v int64) {
+		if err := c.Raw(func(dc interface{}) (err error) {
+			v, err = dc.(*conn).DataVersion()
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+	v0 := version()
+	if _, err := other.Exec("insert into t values(1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := version(); v == v0 {
+		t.Fatal("data_version did not change")
+	}
+
+	w, err := Watch(db, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer w.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := other.Exec("insert into t values(?)", i); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-w.C:
+		case <-time.After(10 * time.Second):
+			t.Fatal("no change reported")
+		}
+	}
+
+	select {
+	case <-w.C:
+		t.Fatal("unexpected change")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	w.Close()
+	if _, ok := <-w.C; ok {
+		t.Fatal("C is not closed")
+	}
+
+	mem, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer mem.Close()
+
+	if _, err := Watch(mem, time.Second); err == nil {
+		t.Fatal("unexpected success")
+	}
+}
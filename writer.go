@@ -0,0 +1,105 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// writerLock serializes the write transactions of all the connections of the
+// process using the same database file with _serialize_writes enabled.
+type writerLock chan struct{}
+
+var (
+	writerLocksMu sync.Mutex
+	writerLocks   = map[string]writerLock{}
+)
+
+func writerLockFor(filename string) writerLock {
+	writerLocksMu.Lock()
+
+	defer writerLocksMu.Unlock()
+
+	w := writerLocks[filename]
+	if w == nil {
+		w = make(writerLock, 1)
+		writerLocks[filename] = w
+	}
+	return w
+}
+
+// setSerializeWrites handles the _serialize_writes query parameter.
+func (c *conn) setSerializeWrites(v string) error {
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid _serialize_writes %q", v)
+	}
+
+	c.writer = nil
+	if !on || c.readOnly {
+		return nil
+	}
+
+	filename := libc.GoString(sqlite3.Xsqlite3_db_filename(c.tls, c.db, 0))
+	if filename == "" { // Temporary or private in-memory database.
+		return nil
+	}
+
+	c.writer = writerLockFor(filename)
+	return nil
+}
+
+// acquireWriter waits until c holds the writer lock of its database, or ctx
+// is done. It is a nop if c already holds the lock or does not serialize its
+// writes.
+func (c *conn) acquireWriter(ctx context.Context) error {
+	if c.writer == nil || c.holdsWriter {
+		return nil
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	select {
+	case c.writer <- struct{}{}:
+		c.holdsWriter = true
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquireWriterFor acquires the writer lock before pstmt is stepped, if pstmt
+// may modify the database.
+func (c *conn) acquireWriterFor(ctx context.Context, pstmt uintptr) error {
+	if c.writer == nil || c.holdsWriter || c.stmtReadonly(pstmt) {
+		return nil
+	}
+
+	return c.acquireWriter(ctx)
+}
+
+// releaseWriter releases the writer lock once c is no longer in a
+// transaction.
+func (c *conn) releaseWriter() {
+	if !c.holdsWriter || (c.db != 0 && !c.autocommit()) {
+		return
+	}
+
+	c.holdsWriter = false
+	<-c.writer
+}
+
+// int sqlite3_stmt_readonly(sqlite3_stmt *pStmt);
+func (c *conn) stmtReadonly(pstmt uintptr) bool {
+	return sqlite3.Xsqlite3_stmt_readonly(c.tls, pstmt) != 0
+}
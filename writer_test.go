@@ -0,0 +1,169 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// TestSerializeWrites checks a write waits for the write transaction of
+// another connection, of the same or another pool, where it would fail with
+// SQLITE_BUSY otherwise.
+func TestSerializeWrites(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.db")
+	for _, serialize := range []bool{false, true} {
+		query := "?_pragma=journal_mode(wal)&_pragma=busy_timeout(0)"
+		if serialize {
+			query += "&_serialize_writes=1"
+		}
+		a, err := sql.Open(driverName, fn+query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := sql.Open(driverName, fn+query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := a.Exec("create table if not exists t(i)"); err != nil {
+			t.Fatal(err)
+		}
+
+		tx, err := a.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tx.Exec("insert into t values(1)"); err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			done <- tx.Commit()
+		}()
+
+		var e *Error
+		_, err = b.Exec("insert into t values(2)")
+		switch {
+		case serialize && err != nil:
+			t.Errorf("serialized: %v", err)
+		case !serialize && (!errors.As(err, &e) || e.Code()&0xff != sqlite3.SQLITE_BUSY):
+			t.Errorf("got %v, want SQLITE_BUSY", err)
+		}
+
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+
+		// A write transaction waiting for the writer is canceled by its
+		// context.
+		if serialize {
+			tx, err := a.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			if _, err := b.BeginTx(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+			}
+
+			cancel()
+			tx.Rollback()
+
+			// Another database file is not serialized with fn.
+			other, err := sql.Open(driverName, filepath.Join(dir, "other.db")+query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tx, err = a.Begin(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := other.Exec("create table t(i)"); err != nil {
+				t.Error(err)
+			}
+
+			tx.Rollback()
+			other.Close()
+		}
+
+		a.Close()
+		b.Close()
+	}
+}
+
+// TestSerializeWritesConcurrent runs write transactions reading before they
+// write from many goroutines, which fail with SQLITE_BUSY unless serialized.
+func TestSerializeWritesConcurrent(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open(driverName, fn+"?_pragma=journal_mode(wal)&_pragma=busy_timeout(0)&_serialize_writes=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	db.SetMaxOpenConns(8)
+	if _, err := db.Exec("create table t(i)"); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 32
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			errs <- func() error {
+				tx, err := db.Begin()
+				if err != nil {
+					return err
+				}
+
+				defer tx.Rollback()
+
+				var m int
+				if err := tx.QueryRow("select count(*) from t").Scan(&m); err != nil {
+					return err
+				}
+
+				if _, err := tx.Exec("insert into t values(?)", m); err != nil {
+					return err
+				}
+
+				return tx.Commit()
+			}()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every transaction saw the commits of all the previous ones.
+	var count, distinct int
+	if err := db.QueryRow("select count(*), count(distinct i) from t").Scan(&count, &distinct); err != nil || count != n || distinct != n {
+		t.Fatalf("got %v %v %v, want %v", count, distinct, err, n)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"unsafe"
+
+	"modernc.org/libc"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// The zipfile table-valued function, modeled after ext/misc/zipfile.c of the
+// SQLite source tree, see https://www.sqlite.org/zipfile.html. It lists the
+// entries of a ZIP archive, given as a file name or as a blob:
+//
+//	select name, data from zipfile('archive.zip');
+//
+// Unlike the C implementation, it is read-only and there is no zipfile()
+// aggregate function. Use archive/zip to write archives.
+
+func init() {
+	registerModule("zipfile", &goModule{
+		connect:    zipfileConnect,
+		bestIndex:  zipfileBestIndex,
+		disconnect: zipfileDisconnect,
+		open:       zipfileOpen,
+		close:      zipfileClose,
+		filter:     zipfileFilter,
+		next:       zipfileNext,
+		eof:        zipfileEOF,
+		column:     zipfileColumn,
+		rowid:      zipfileRowid,
+	})
+}
+
+// Columns of the zipfile table.
+const (
+	zipfileColName = iota
+	zipfileColMode
+	zipfileColMtime
+	zipfileColSz
+	zipfileColRawdata
+	zipfileColData
+	zipfileColMethod
+	zipfileColFile
+)
+
+type zipfileCursor struct {
+	files []*zip.File
+	n     int // Entries visited.
+}
+
+var (
+	zipfileCursorsMu sync.Mutex
+	zipfileCursors   = map[uintptr]*zipfileCursor{}
+)
+
+func zipfileCursorOf(pCursor uintptr) *zipfileCursor {
+	zipfileCursorsMu.Lock()
+
+	defer zipfileCursorsMu.Unlock()
+
+	return zipfileCursors[pCursor]
+}
+
+func zipfileConnect(tls *libc.TLS, db, pAux uintptr, argc int32, argv, ppVtab, pzErr uintptr) int32 {
+	if rc := declareVtab(tls, db, "create table x(name, mode, mtime, sz, rawdata, data, method, file hidden)"); rc != sqlite3.SQLITE_OK {
+		return rc
+	}
+
+	p := newVtab(tls)
+	if p == 0 {
+		return sqlite3.SQLITE_NOMEM
+	}
+
+	*(*uintptr)(unsafe.Pointer(ppVtab)) = p
+	return sqlite3.SQLITE_OK
+}
+
+func zipfileDisconnect(tls *libc.TLS, pVtab uintptr) int32 {
+	sqlite3.Xsqlite3_free(tls, pVtab)
+	return sqlite3.SQLITE_OK
+}
+
+func zipfileBestIndex(tls *libc.TLS, pVtab, pInfo uintptr) int32 {
+	info := (*sqlite3.Sqlite3_index_info)(unsafe.Pointer(pInfo))
+	unusable := false
+	for i := int32(0); i < info.FnConstraint; i++ {
+		c := constraint(info, i)
+		if c.iColumn != zipfileColFile || c.op != sqlite3.SQLITE_INDEX_CONSTRAINT_EQ {
+			continue
+		}
+
+		if c.usable == 0 {
+			unusable = true
+			continue
+		}
+
+		u := constraintUsage(info, i)
+		u.argvIndex = 1
+		u.omit = 1
+		info.FidxNum = 1
+		info.FestimatedCost = 1000
+		info.FestimatedRows = 100
+		return sqlite3.SQLITE_OK
+	}
+
+	if unusable {
+		// Make SQLite try another plan, the argument is required.
+		return sqlite3.SQLITE_CONSTRAINT
+	}
+
+	info.FidxNum = 0
+	info.FestimatedCost = 2147483647
+	info.FestimatedRows = 2147483647
+	return sqlite3.SQLITE_OK
+}
+
+func zipfileOpen(tls *libc.TLS, pVtab, ppCursor uintptr) int32 {
+	p := newVtabCursor(tls)
+	if p == 0 {
+		return sqlite3.SQLITE_NOMEM
+	}
+
+	zipfileCursorsMu.Lock()
+	zipfileCursors[p] = &zipfileCursor{}
+	zipfileCursorsMu.Unlock()
+	*(*uintptr)(unsafe.Pointer(ppCursor)) = p
+	return sqlite3.SQLITE_OK
+}
+
+func zipfileClose(tls *libc.TLS, pCursor uintptr) int32 {
+	zipfileCursorsMu.Lock()
+	delete(zipfileCursors, pCursor)
+	zipfileCursorsMu.Unlock()
+	sqlite3.Xsqlite3_free(tls, pCursor)
+	return sqlite3.SQLITE_OK
+}
+
+func zipfileFilter(tls *libc.TLS, pCursor uintptr, idxNum int32, idxStr uintptr, argc int32, argv uintptr) int32 {
+	cur := zipfileCursorOf(pCursor)
+	*cur = zipfileCursor{}
+	if idxNum != 1 || argc < 1 {
+		return vtabError(tls, cursorVtab(pCursor), "zipfile constructor requires one argument")
+	}
+
+	val := valueAt(argv, 0)
+	var b []byte
+	switch sqlite3.Xsqlite3_value_type(tls, val) {
+	case sqlite3.SQLITE_NULL:
+		return sqlite3.SQLITE_OK
+	case sqlite3.SQLITE_BLOB:
+		if n := sqlite3.Xsqlite3_value_bytes(tls, val); n != 0 {
+			b = append([]byte(nil), (*libc.RawMem)(unsafe.Pointer(sqlite3.Xsqlite3_value_blob(tls, val)))[:n:n]...)
+		}
+	default:
+		var err error
+		if b, err = os.ReadFile(valueString(tls, argv, 0)); err != nil {
+			return vtabError(tls, cursorVtab(pCursor), "zipfile: "+err.Error())
+		}
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return vtabError(tls, cursorVtab(pCursor), "zipfile: "+err.Error())
+	}
+
+	cur.files = r.File
+	return sqlite3.SQLITE_OK
+}
+
+func zipfileNext(tls *libc.TLS, pCursor uintptr) int32 {
+	zipfileCursorOf(pCursor).n++
+	return sqlite3.SQLITE_OK
+}
+
+func zipfileEOF(tls *libc.TLS, pCursor uintptr) int32 {
+	if cur := zipfileCursorOf(pCursor); cur.n >= len(cur.files) {
+		return 1
+	}
+
+	return 0
+}
+
+func zipfileColumn(tls *libc.TLS, pCursor, ctx uintptr, i int32) int32 {
+	cur := zipfileCursorOf(pCursor)
+	f := cur.files[cur.n]
+	var err error
+	switch i {
+	case zipfileColName:
+		resultText(tls, ctx, f.Name)
+	case zipfileColMode:
+		sqlite3.Xsqlite3_result_int64(tls, ctx, unixMode(f.Mode()))
+	case zipfileColMtime:
+		sqlite3.Xsqlite3_result_int64(tls, ctx, f.Modified.Unix())
+	case zipfileColSz:
+		sqlite3.Xsqlite3_result_int64(tls, ctx, int64(f.UncompressedSize64))
+	case zipfileColRawdata:
+		var r io.Reader
+		if r, err = f.OpenRaw(); err == nil {
+			err = zipfileResult(tls, ctx, r)
+		}
+	case zipfileColData:
+		if f.Mode().IsDir() {
+			sqlite3.Xsqlite3_result_null(tls, ctx)
+			break
+		}
+
+		var r io.ReadCloser
+		if r, err = f.Open(); err == nil {
+			err = zipfileResult(tls, ctx, r)
+			r.Close()
+		}
+	case zipfileColMethod:
+		sqlite3.Xsqlite3_result_int64(tls, ctx, int64(f.Method))
+	default:
+		sqlite3.Xsqlite3_result_null(tls, ctx)
+	}
+	if err != nil {
+		return vtabError(tls, cursorVtab(pCursor), "zipfile: "+f.Name+": "+err.Error())
+	}
+
+	return sqlite3.SQLITE_OK
+}
+
+// zipfileResult sets the result of ctx to the content of r as a blob.
+func zipfileResult(tls *libc.TLS, ctx uintptr, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	resultBlob(tls, ctx, b)
+	return nil
+}
+
+func zipfileRowid(tls *libc.TLS, pCursor, pRowid uintptr) int32 {
+	*(*int64)(unsafe.Pointer(pRowid)) = int64(zipfileCursorOf(pCursor).n + 1)
+	return sqlite3.SQLITE_OK
+}
+
+// unixMode returns m as the st_mode of a Unix file, the mode stored by ZIP
+// and SQLite Archive files.
+func unixMode(m fs.FileMode) int64 {
+	mode := int64(m.Perm())
+	switch {
+	case m.IsDir():
+		mode |= 0o040000
+	case m&fs.ModeSymlink != 0:
+		mode |= 0o120000
+	default:
+		mode |= 0o100000
+	}
+	return mode
+}
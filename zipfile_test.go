@@ -0,0 +1,106 @@
+// Copyright 2022 The Sqlite Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite // import "modernc.org/sqlite"
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZipfile(t *testing.T) {
+	big := strings.Repeat("compressible ", 1000)
+	mtime := time.Date(2022, 11, 16, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, v := range []struct {
+		name   string
+		method uint16
+		data   string
+	}{
+		{"dir/", zip.Store, ""},
+		{"dir/big.txt", zip.Deflate, big},
+		{"small.txt", zip.Store, "hello"},
+	} {
+		h := &zip.FileHeader{Name: v.name, Method: v.method, Modified: mtime}
+		h.SetMode(0o644)
+		if strings.HasSuffix(v.name, "/") {
+			h.SetMode(0o755 | os.ModeDir)
+		}
+		f, err := w.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := f.Write([]byte(v.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "test.zip")
+	if err := os.WriteFile(name, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	for _, arg := range []interface{}{name, buf.Bytes()} {
+		rows, err := db.Query("select name, mode, mtime, sz, length(rawdata), data, method from zipfile(?)", arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var a []string
+		for rows.Next() {
+			var name string
+			var mode, mtime, sz, raw, method int64
+			var data sql.NullString
+			if err := rows.Scan(&name, &mode, &mtime, &sz, &raw, &data, &method); err != nil {
+				t.Fatal(err)
+			}
+
+			a = append(a, fmt.Sprintf("%s %o %d %d %v %v %d", name, mode, mtime, sz, raw < sz, data.Valid && data.String == map[string]string{"dir/big.txt": big, "small.txt": "hello"}[name], method))
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		rows.Close()
+		if g, e := strings.Join(a, ", "), "dir/ 40755 1668600000 0 false false 0, dir/big.txt 100644 1668600000 13000 true true 8, small.txt 100644 1668600000 5 false true 0"; g != e {
+			t.Fatalf("got %s, want %s", g, e)
+		}
+	}
+
+	if _, err := db.Query("select * from zipfile('nonexistent.zip')"); err == nil {
+		t.Fatal("unexpected success reading a nonexistent file")
+	}
+
+	var b []byte
+	var n int
+	if err := db.QueryRow("select sqlar_uncompress(c, ?), length(c) from (select sqlar_compress(?) c)", len(big), []byte(big)).Scan(&b, &n); err != nil || string(b) != big || n >= len(big) {
+		t.Fatalf("%d bytes, %d compressed, %v", len(b), n, err)
+	}
+
+	for _, v := range []interface{}{[]byte("x"), []byte{}, "text", nil} {
+		var g interface{}
+		if err := db.QueryRow("select sqlar_compress(?)", v).Scan(&g); err != nil || fmt.Sprint(g) != fmt.Sprint(v) {
+			t.Errorf("sqlar_compress(%v): %v, %v", v, g, err)
+		}
+	}
+}